@@ -16,6 +16,8 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"flag"
 	"net/http"
 	"net/url"
@@ -45,6 +47,7 @@ func main() {
 		reloadURLStr  = flag.String("reload-url", "http://127.0.0.1:19090/-/reload", "reload endpoint triggers a reload of the configuration file")
 		readyURLStr   = flag.String("ready-url", "http://127.0.0.1:19090/-/ready", "ready endpoint returns a 200 when ready to serve traffic")
 		listenAddress = flag.String("listen-address", ":19091", "address on which to expose metrics")
+		tlsCAFile     = flag.String("tls-ca-file", "", "certificate authority file to verify the ready and reload endpoints against if they are served over HTTPS")
 	)
 	flag.Var(&watchedDirs, "watched-dir", "directory to watch for file changes (for rule and secret files, may be repeated)")
 
@@ -66,6 +69,22 @@ func main() {
 		os.Exit(1)
 	}
 
+	httpClient := http.Client{}
+	if *tlsCAFile != "" {
+		caData, err := os.ReadFile(*tlsCAFile)
+		if err != nil {
+			level.Error(logger).Log("msg", "reading certificate authority failed", "err", err)
+			os.Exit(1)
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{RootCAs: x509.NewCertPool()}
+		if !transport.TLSClientConfig.RootCAs.AppendCertsFromPEM(caData) {
+			level.Error(logger).Log("msg", "no valid certificate authority found", "file", *tlsCAFile)
+			os.Exit(1)
+		}
+		httpClient.Transport = transport
+	}
+
 	// Set up interrupt signal handler.
 	term := make(chan os.Signal, 1)
 	signal.Notify(term, os.Interrupt, syscall.SIGTERM)
@@ -86,7 +105,7 @@ func main() {
 				level.Info(logger).Log("msg", "received SIGTERM, exiting gracefully...")
 				os.Exit(0)
 			case <-ticker.C:
-				resp, err := http.DefaultClient.Do(req)
+				resp, err := httpClient.Do(req)
 				if err != nil {
 					level.Error(logger).Log("msg", "polling ready-url", "err", err)
 					os.Exit(1)
@@ -119,6 +138,7 @@ func main() {
 			DelayInterval: 3 * time.Second,
 		},
 	)
+	rel.SetHttpClient(httpClient)
 
 	var g run.Group
 	{
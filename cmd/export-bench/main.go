@@ -0,0 +1,131 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// export-bench generates synthetic series and exports them to GCM or a fake GCM
+// endpoint to measure the throughput and resource usage of the exporter.
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	_ "net/http/pprof"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/prometheus/config"
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/GoogleCloudPlatform/prometheus-engine/pkg/export"
+	exportsetup "github.com/GoogleCloudPlatform/prometheus-engine/pkg/export/setup"
+)
+
+func main() {
+	logger := log.NewJSONLogger(log.NewSyncWriter(os.Stderr))
+	logger = log.With(logger, "ts", log.DefaultTimestampUTC)
+	logger = log.With(logger, "caller", log.DefaultCaller)
+
+	a := kingpin.New("export-bench", "Generates synthetic load for the GCM exporter and reports its throughput and resource usage.")
+	a.HelpFlag.Short('h')
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+	)
+	version, err := export.Version()
+	if err != nil {
+		level.Error(logger).Log("msg", "Unable to fetch module version", "err", err)
+		os.Exit(1)
+	}
+	newExporter := exportsetup.FromFlags(a, fmt.Sprintf("export-bench/%s", version))
+
+	var opts export.LoadOpts
+
+	a.Flag("load.series", "Number of active series.").
+		Default(strconv.Itoa(export.DefaultLoadSeries)).IntVar(&opts.Series)
+
+	a.Flag("load.series-per-target", "Number of series of each synthetic target. The samples of a target are exported together like the samples of a scrape.").
+		Default(strconv.Itoa(export.DefaultLoadSeriesPerTarget)).IntVar(&opts.SeriesPerTarget)
+
+	a.Flag("load.metrics", "Number of distinct metric names the series are spread over.").
+		Default(strconv.Itoa(export.DefaultLoadMetrics)).IntVar(&opts.Metrics)
+
+	a.Flag("load.churn", "Ratio of active series that are replaced by new series every interval.").
+		Default("0").Float64Var(&opts.Churn)
+
+	a.Flag("load.interval", "Interval at which a sample of every active series is exported.").
+		Default(export.DefaultLoadInterval.String()).DurationVar(&opts.Interval)
+
+	a.Flag("load.duration", "Duration to generate load for.").
+		Default(export.DefaultLoadDuration.String()).DurationVar(&opts.Duration)
+
+	listenAddress := a.Flag("web.listen-address", "The address to serve metrics and profiles on during the run. Disabled if empty.").
+		Default("").String()
+
+	if _, err := a.Parse(os.Args[1:]); err != nil {
+		level.Error(logger).Log("msg", "Error parsing commandline arguments", "err", err)
+		a.Usage(os.Args[1:])
+		os.Exit(2)
+	}
+
+	exporter, err := newExporter(logger, reg)
+	if err != nil {
+		level.Error(logger).Log("msg", "Creating a Cloud Monitoring Exporter failed", "err", err)
+		os.Exit(1)
+	}
+	if err := exporter.ApplyConfig(&config.DefaultConfig); err != nil {
+		level.Error(logger).Log("msg", "Applying exporter configuration failed", "err", err)
+		os.Exit(1)
+	}
+
+	if *listenAddress != "" {
+		http.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{Registry: reg}))
+		go func() {
+			if err := http.ListenAndServe(*listenAddress, nil); err != nil {
+				level.Error(logger).Log("msg", "Serving metrics failed", "err", err)
+			}
+		}()
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	level.Info(logger).Log("msg", "Generating load", "series", opts.Series, "churn", opts.Churn, "interval", opts.Interval, "duration", opts.Duration)
+
+	res, err := export.RunLoad(ctx, exporter, opts)
+	if err != nil {
+		level.Error(logger).Log("msg", "Generating load failed", "err", err)
+		os.Exit(1)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Duration\t%s\n", res.Duration.Round(1e6))
+	fmt.Fprintf(w, "Series\t%d\n", res.Series)
+	fmt.Fprintf(w, "Samples exported\t%.0f\n", res.SamplesExported)
+	fmt.Fprintf(w, "Samples sent\t%.0f (%.0f/s)\n", res.SamplesSent, res.SamplesPerSecond())
+	fmt.Fprintf(w, "Samples dropped\t%.0f\n", res.SamplesDropped)
+	fmt.Fprintf(w, "Requests\t%.0f (%.0f failed)\n", res.Requests, res.FailedRequests)
+	fmt.Fprintf(w, "Mean request latency\t%s\n", res.MeanRequestLatency)
+	fmt.Fprintf(w, "Max export lag\t%s\n", res.MaxExportLag)
+	fmt.Fprintf(w, "Peak heap\t%.1f MiB\n", float64(res.PeakHeapBytes)/(1<<20))
+	w.Flush()
+}
@@ -0,0 +1,150 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+var errEndpointNotAllowed = errors.New("endpoint not allowed with label access control")
+
+// enabled returns true if access is restricted by label matchers.
+func (c *AuthorizationConfig) enabled() bool {
+	return len(c.Rules) > 0
+}
+
+// identity returns the authenticated identity of the request as set by the trusted
+// proxy in front of the frontend.
+func (c *AuthorizationConfig) identity(req *http.Request) string {
+	if c.IdentityHeader == "" {
+		return ""
+	}
+	return req.Header.Get(c.IdentityHeader)
+}
+
+// matchersFor returns the label matchers enforced on requests of the identity.
+// It returns false if the identity has no access.
+func (c *AuthorizationConfig) matchersFor(identity string) ([]*labels.Matcher, bool, error) {
+	if identity == "" {
+		return nil, false, nil
+	}
+	for _, r := range c.Rules {
+		for _, id := range r.Identities {
+			if id != identity {
+				continue
+			}
+			matchers, err := parser.ParseMetricSelector(r.Selector)
+			return matchers, err == nil, err
+		}
+	}
+	return nil, false, nil
+}
+
+// enforceMatchers rewrites the query parameters of an API request so that it can only
+// access series matching the given matchers. Parameters are rewritten in the URL as
+// well as in form-encoded request bodies. Requests to endpoints that cannot be restricted
+// are rejected with errEndpointNotAllowed.
+func enforceMatchers(req *http.Request, matchers []*labels.Matcher) error {
+	var param string
+	switch p := req.URL.Path; {
+	case p == "/api/v1/query" || p == "/api/v1/query_range":
+		param = "query"
+	case p == "/api/v1/series" || p == "/api/v1/labels" ||
+		strings.HasPrefix(p, "/api/v1/label/") && strings.HasSuffix(p, "/values"):
+		param = "match[]"
+	case strings.HasPrefix(p, "/api/v1/status/"):
+		// Status endpoints do not expose series data.
+		return nil
+	default:
+		return errEndpointNotAllowed
+	}
+	if err := req.ParseForm(); err != nil {
+		return fmt.Errorf("parse form: %w", err)
+	}
+	query := req.URL.Query()
+	if err := rewriteParam(query, param, matchers); err != nil {
+		return err
+	}
+	if err := rewriteParam(req.PostForm, param, matchers); err != nil {
+		return err
+	}
+	// Without any series selector, label endpoints consider all series. Restrict
+	// them to the series matching the matchers.
+	if param == "match[]" && len(query[param]) == 0 && len(req.PostForm[param]) == 0 {
+		query.Set(param, (&parser.VectorSelector{LabelMatchers: matchers}).String())
+	}
+	req.URL.RawQuery = query.Encode()
+
+	if len(req.PostForm) > 0 {
+		body := req.PostForm.Encode()
+		req.Body = io.NopCloser(strings.NewReader(body))
+		req.ContentLength = int64(len(body))
+	}
+	// Reset parsed values so that they are parsed again from the rewritten request.
+	req.Form, req.PostForm = nil, nil
+	return nil
+}
+
+// rewriteParam adds the matchers to all series selectors in the values of the parameter.
+func rewriteParam(values url.Values, param string, matchers []*labels.Matcher) error {
+	for i, v := range values[param] {
+		var (
+			rewritten string
+			err       error
+		)
+		if param == "query" {
+			rewritten, err = injectMatchers(v, matchers)
+		} else {
+			rewritten, err = injectSelectorMatchers(v, matchers)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid %s parameter: %w", param, err)
+		}
+		values[param][i] = rewritten
+	}
+	return nil
+}
+
+// injectMatchers adds the matchers to all series selectors of the PromQL expression.
+func injectMatchers(query string, matchers []*labels.Matcher) (string, error) {
+	expr, err := parser.ParseExpr(query)
+	if err != nil {
+		return "", err
+	}
+	parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		if vs, ok := node.(*parser.VectorSelector); ok {
+			vs.LabelMatchers = append(vs.LabelMatchers, matchers...)
+		}
+		return nil
+	})
+	return expr.String(), nil
+}
+
+// injectSelectorMatchers adds the matchers to a series selector.
+func injectSelectorMatchers(selector string, matchers []*labels.Matcher) (string, error) {
+	ms, err := parser.ParseMetricSelector(selector)
+	if err != nil {
+		return "", err
+	}
+	return (&parser.VectorSelector{LabelMatchers: append(ms, matchers...)}).String(), nil
+}
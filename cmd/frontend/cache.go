@@ -0,0 +1,102 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// responseCache is a size-bounded cache of backend responses whose entries
+// expire after a fixed TTL.
+type responseCache struct {
+	mtx        sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	entries    map[string]*cacheEntry
+}
+
+type cacheEntry struct {
+	status  int
+	header  http.Header
+	body    []byte
+	expires time.Time
+}
+
+func newResponseCache() *responseCache {
+	return &responseCache{entries: map[string]*cacheEntry{}}
+}
+
+// reset drops all cached entries and applies the new TTL and size bounds.
+func (c *responseCache) reset(ttl time.Duration, maxEntries int) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.ttl = ttl
+	c.maxEntries = maxEntries
+	c.entries = map[string]*cacheEntry{}
+}
+
+// get returns the unexpired entry for the key.
+func (c *responseCache) get(key string, now time.Time) (*cacheEntry, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if !now.Before(e.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return e, true
+}
+
+// set adds an entry for the key. If the cache is full, expired entries are dropped
+// first and the entry closest to expiry is evicted if that did not free up space.
+func (c *responseCache) set(key string, now time.Time, status int, header http.Header, body []byte) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if c.ttl <= 0 || c.maxEntries <= 0 {
+		return
+	}
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.maxEntries {
+		var (
+			oldestKey string
+			oldest    time.Time
+		)
+		for k, e := range c.entries {
+			if !now.Before(e.expires) {
+				delete(c.entries, k)
+				continue
+			}
+			if oldestKey == "" || e.expires.Before(oldest) {
+				oldestKey, oldest = k, e.expires
+			}
+		}
+		if len(c.entries) >= c.maxEntries {
+			delete(c.entries, oldestKey)
+		}
+	}
+	c.entries[key] = &cacheEntry{
+		status:  status,
+		header:  header.Clone(),
+		body:    body,
+		expires: now.Add(c.ttl),
+	}
+}
@@ -0,0 +1,249 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/promql/parser"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Config is the configuration of the frontend that can be provided through
+// a YAML file. All settings in the file can be changed at runtime and are
+// applied without restarting the frontend.
+type Config struct {
+	Backend BackendConfig `yaml:"backend,omitempty"`
+	Tenancy TenancyConfig `yaml:"tenancy,omitempty"`
+	Limits  LimitsConfig  `yaml:"limits,omitempty"`
+	Caching CachingConfig `yaml:"caching,omitempty"`
+
+	Authorization AuthorizationConfig `yaml:"authorization,omitempty"`
+}
+
+// BackendConfig configures where authenticated requests are forwarded to.
+type BackendConfig struct {
+	// The URL to forward authenticated requests to. The PROJECT_ID placeholder
+	// is replaced with the project resolved for the request.
+	TargetURL string `yaml:"target_url,omitempty"`
+}
+
+// TenancyConfig configures which Google Cloud Monitoring workspace projects
+// can be queried.
+type TenancyConfig struct {
+	// Project ID of the workspace project queried by default.
+	ProjectID string `yaml:"project_id,omitempty"`
+	// Optional request header through which clients can select a project other
+	// than the default one. Only projects listed in AllowedProjects can be selected.
+	ProjectHeader string `yaml:"project_header,omitempty"`
+	// Projects that may be selected through the project header.
+	AllowedProjects []string `yaml:"allowed_projects,omitempty"`
+}
+
+// LimitsConfig configures limits applied to incoming requests.
+type LimitsConfig struct {
+	// Maximum number of requests forwarded concurrently. Zero means no limit.
+	MaxConcurrentRequests int `yaml:"max_concurrent_requests,omitempty"`
+	// Timeout for forwarded requests. Zero means no timeout.
+	RequestTimeout model.Duration `yaml:"request_timeout,omitempty"`
+}
+
+// CachingConfig configures caching of successful backend responses.
+type CachingConfig struct {
+	// Duration for which responses are cached. Zero disables caching.
+	TTL model.Duration `yaml:"ttl,omitempty"`
+	// Maximum number of cached responses.
+	MaxEntries int `yaml:"max_entries,omitempty"`
+}
+
+// AuthorizationConfig configures label-based access control for authenticated
+// identities. If no rules are configured, access is not restricted.
+type AuthorizationConfig struct {
+	// Request header holding the authenticated identity, set by a trusted
+	// authenticating proxy in front of the frontend. Required if rules are
+	// configured.
+	IdentityHeader string `yaml:"identity_header,omitempty"`
+	// Rules mapping identities to the series they may access. Requests of
+	// identities without a rule are rejected.
+	Rules []AuthorizationRule `yaml:"rules,omitempty"`
+}
+
+// AuthorizationRule restricts a set of identities to series matching a selector.
+type AuthorizationRule struct {
+	// Identities the rule applies to.
+	Identities []string `yaml:"identities"`
+	// Series selector, for example {namespace=~"team-a-.*"}. Its matchers are added
+	// to all series selectors in requests of the identities.
+	Selector string `yaml:"selector"`
+}
+
+const defaultCacheMaxEntries = 1000
+
+// Validate checks the configuration for errors.
+func (c *Config) Validate() error {
+	if c.Tenancy.ProjectID == "" {
+		return errors.New("project ID must be set through --query.project-id or tenancy.project_id")
+	}
+	if c.Backend.TargetURL == "" {
+		return errors.New("target URL must be set through --query.target-url or backend.target_url")
+	}
+	if _, err := c.targetURL(c.Tenancy.ProjectID); err != nil {
+		return err
+	}
+	if c.Tenancy.ProjectHeader == "" && len(c.Tenancy.AllowedProjects) > 0 {
+		return errors.New("tenancy.allowed_projects requires tenancy.project_header to be set")
+	}
+	if c.Limits.MaxConcurrentRequests < 0 {
+		return fmt.Errorf("limits.max_concurrent_requests must not be negative, got %d", c.Limits.MaxConcurrentRequests)
+	}
+	if c.Limits.RequestTimeout < 0 {
+		return fmt.Errorf("limits.request_timeout must not be negative, got %s", c.Limits.RequestTimeout)
+	}
+	if c.Caching.TTL < 0 {
+		return fmt.Errorf("caching.ttl must not be negative, got %s", c.Caching.TTL)
+	}
+	if c.Caching.MaxEntries < 0 {
+		return fmt.Errorf("caching.max_entries must not be negative, got %d", c.Caching.MaxEntries)
+	}
+	if len(c.Authorization.Rules) > 0 && c.Authorization.IdentityHeader == "" {
+		return errors.New("authorization.rules require authorization.identity_header to be set")
+	}
+	identities := map[string]bool{}
+	for i, r := range c.Authorization.Rules {
+		if len(r.Identities) == 0 {
+			return fmt.Errorf("authorization.rules[%d] must have at least one identity", i)
+		}
+		for _, id := range r.Identities {
+			if identities[id] {
+				return fmt.Errorf("authorization.rules[%d]: identity %q is used in multiple rules", i, id)
+			}
+			identities[id] = true
+		}
+		matchers, err := parser.ParseMetricSelector(r.Selector)
+		if err != nil {
+			return fmt.Errorf("authorization.rules[%d]: invalid selector: %w", i, err)
+		}
+		if len(matchers) == 0 {
+			return fmt.Errorf("authorization.rules[%d]: selector must not be empty", i)
+		}
+	}
+	return nil
+}
+
+// targetURL returns the backend URL for the given project.
+func (c *Config) targetURL(projectID string) (*url.URL, error) {
+	u, err := url.Parse(strings.ReplaceAll(c.Backend.TargetURL, projectIDVar, projectID))
+	if err != nil {
+		return nil, fmt.Errorf("parsing target URL failed: %w", err)
+	}
+	return u, nil
+}
+
+// projectAllowed returns true if the project may be selected through the project header.
+func (c *Config) projectAllowed(projectID string) bool {
+	for _, p := range c.Tenancy.AllowedProjects {
+		if p == projectID {
+			return true
+		}
+	}
+	return false
+}
+
+// loadConfig parses the config file at the given path on top of the base
+// configuration. An empty filename returns the base configuration.
+func loadConfig(filename string, base Config) (*Config, error) {
+	cfg := base
+	if filename != "" {
+		b, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, fmt.Errorf("reading config file failed: %w", err)
+		}
+		if err := yaml.UnmarshalStrict(b, &cfg); err != nil {
+			return nil, fmt.Errorf("parsing config file failed: %w", err)
+		}
+	}
+	if cfg.Caching.TTL > 0 && cfg.Caching.MaxEntries == 0 {
+		cfg.Caching.MaxEntries = defaultCacheMaxEntries
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	return &cfg, nil
+}
+
+// configWatcher periodically checks the config file for changes and applies
+// the new configuration to the frontend.
+type configWatcher struct {
+	logger   log.Logger
+	filename string
+	base     Config
+	frontend *frontend
+	interval time.Duration
+
+	last []byte
+}
+
+// Run watches the config file until the context is canceled. File notifications
+// are not reliable for mounted ConfigMaps, so the file is polled instead.
+func (w *configWatcher) Run(ctx context.Context) error {
+	// The initial configuration was loaded on startup. Ignore read errors
+	// here as they will be reported on the first tick.
+	w.last, _ = os.ReadFile(w.filename)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			b, err := os.ReadFile(w.filename)
+			if err != nil {
+				level.Error(w.logger).Log("msg", "reading config file failed", "err", err)
+				continue
+			}
+			if bytes.Equal(b, w.last) {
+				continue
+			}
+			if err := w.reload(); err != nil {
+				level.Error(w.logger).Log("msg", "reloading config failed", "err", err)
+			}
+			// Only attempt reloading again once the file changed again.
+			w.last = b
+		}
+	}
+}
+
+// reload reads the config file and applies it to the frontend.
+func (w *configWatcher) reload() error {
+	cfg, err := loadConfig(w.filename, w.base)
+	if err != nil {
+		return err
+	}
+	w.frontend.ApplyConfig(cfg)
+	level.Info(w.logger).Log("msg", "Completed loading of configuration file", "filename", w.filename)
+	return nil
+}
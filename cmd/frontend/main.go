@@ -20,7 +20,9 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -30,6 +32,7 @@ import (
 	"os/signal"
 	"path"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -63,6 +66,12 @@ var (
 
 	targetURLStr = flag.String("query.target-url", fmt.Sprintf("https://monitoring.googleapis.com/v1/projects/%s/location/global/prometheus", projectIDVar),
 		fmt.Sprintf("The URL to forward authenticated requests to. (%s is replaced with the --query.project-id flag.)", projectIDVar))
+
+	configFile = flag.String("config.file", "",
+		"Optional YAML configuration file. Settings in the file take precedence over flags and changes to the file are applied without restart.")
+
+	configReloadInterval = flag.Duration("config.reload-interval", 10*time.Second,
+		"Interval at which the configuration file is checked for changes.")
 )
 
 func main() {
@@ -78,14 +87,13 @@ func main() {
 		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
 	)
 
-	if *projectID == "" {
-		level.Error(logger).Log("msg", "--query.project-id must be set")
-		os.Exit(1)
+	baseConfig := Config{
+		Backend: BackendConfig{TargetURL: *targetURLStr},
+		Tenancy: TenancyConfig{ProjectID: *projectID},
 	}
-
-	targetURL, err := url.Parse(strings.ReplaceAll(*targetURLStr, projectIDVar, *projectID))
+	cfg, err := loadConfig(*configFile, baseConfig)
 	if err != nil {
-		level.Error(logger).Log("msg", "parsing target URL failed", "err", err)
+		level.Error(logger).Log("msg", "loading configuration failed", "err", err)
 		os.Exit(1)
 	}
 
@@ -128,9 +136,11 @@ func main() {
 			os.Exit(1)
 		}
 
+		fe := newFrontend(logger, transport, cfg)
+
 		server := &http.Server{Addr: *listenAddress}
 		http.Handle("/metrics", promhttp.HandlerFor(metrics, promhttp.HandlerOpts{Registry: metrics}))
-		http.Handle("/api/", authenticate(forward(logger, targetURL, transport)))
+		http.Handle("/api/", authenticate(fe))
 
 		http.HandleFunc("/-/healthy", func(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusOK)
@@ -151,6 +161,22 @@ func main() {
 			server.Shutdown(ctx)
 			cancel()
 		})
+
+		if *configFile != "" {
+			watcher := &configWatcher{
+				logger:   logger,
+				filename: *configFile,
+				base:     baseConfig,
+				frontend: fe,
+				interval: *configReloadInterval,
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			g.Add(func() error {
+				return watcher.Run(ctx)
+			}, func(err error) {
+				cancel()
+			})
+		}
 	}
 
 	if err := g.Run(); err != nil {
@@ -180,48 +206,170 @@ func authenticate(next http.Handler) http.Handler {
 	})
 }
 
-func forward(logger log.Logger, target *url.URL, transport http.RoundTripper) http.Handler {
-	client := http.Client{Transport: transport}
+// frontend forwards authenticated requests to the backend according to
+// the currently applied configuration.
+type frontend struct {
+	logger log.Logger
+	client http.Client
+	now    func() time.Time
 
-	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-		u := *target
-		u.Path = path.Join(u.Path, req.URL.Path)
-
-		method := req.Method
-		// Write all params into the URL and make a GET request to work around
-		// /api/v1/series currently not accepting match[] params on POST.
-		if req.URL.Path == "/api/v1/series" {
-			method = "GET"
-			req.ParseForm()
-			u.RawQuery = req.Form.Encode()
-		} else {
-			u.RawQuery = req.URL.RawQuery
-		}
+	config   atomic.Pointer[Config]
+	inflight atomic.Int64
+	cache    *responseCache
+}
 
-		newReq, err := http.NewRequestWithContext(req.Context(), method, u.String(), req.Body)
+func newFrontend(logger log.Logger, transport http.RoundTripper, cfg *Config) *frontend {
+	f := &frontend{
+		logger: logger,
+		client: http.Client{Transport: transport},
+		now:    time.Now,
+		cache:  newResponseCache(),
+	}
+	f.ApplyConfig(cfg)
+	return f
+}
+
+// ApplyConfig applies a new configuration. Requests in flight continue to use
+// the previous configuration.
+func (f *frontend) ApplyConfig(cfg *Config) {
+	prev := f.config.Swap(cfg)
+	if prev == nil || prev.Caching != cfg.Caching || prev.Backend != cfg.Backend {
+		f.cache.reset(time.Duration(cfg.Caching.TTL), cfg.Caching.MaxEntries)
+	}
+}
+
+func (f *frontend) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	cfg := f.config.Load()
+
+	projectID := cfg.Tenancy.ProjectID
+	if h := cfg.Tenancy.ProjectHeader; h != "" {
+		if p := req.Header.Get(h); p != "" {
+			if !cfg.projectAllowed(p) {
+				http.Error(w, fmt.Sprintf("project %q not allowed", p), http.StatusForbidden)
+				return
+			}
+			projectID = p
+		}
+	}
+	if authz := &cfg.Authorization; authz.enabled() {
+		matchers, ok, err := authz.matchersFor(authz.identity(req))
 		if err != nil {
-			level.Warn(logger).Log("msg", "creating request failed", "err", err)
+			level.Warn(f.logger).Log("msg", "parsing authorization selector failed", "err", err)
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
-		copyHeader(newReq.Header, req.Header)
+		if !ok {
+			http.Error(w, "access denied", http.StatusForbidden)
+			return
+		}
+		if err := enforceMatchers(req, matchers); errors.Is(err, errEndpointNotAllowed) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if max := int64(cfg.Limits.MaxConcurrentRequests); max > 0 {
+		if f.inflight.Add(1) > max {
+			f.inflight.Add(-1)
+			http.Error(w, "too many concurrent requests", http.StatusTooManyRequests)
+			return
+		}
+		defer f.inflight.Add(-1)
+	}
+	target, err := cfg.targetURL(projectID)
+	if err != nil {
+		level.Warn(f.logger).Log("msg", "building target URL failed", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	u := *target
+	u.Path = path.Join(u.Path, req.URL.Path)
+
+	method := req.Method
+	// Write all params into the URL and make a GET request to work around
+	// /api/v1/series currently not accepting match[] params on POST.
+	if req.URL.Path == "/api/v1/series" {
+		method = "GET"
+		req.ParseForm()
+		u.RawQuery = req.Form.Encode()
+	} else {
+		u.RawQuery = req.URL.RawQuery
+	}
+
+	ctx := req.Context()
+	if timeout := time.Duration(cfg.Limits.RequestTimeout); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
 
-		resp, err := client.Do(newReq)
+	// The body is part of the cache key as query parameters are typically sent
+	// as form data in POST requests.
+	var (
+		body     io.Reader = req.Body
+		cacheKey string
+	)
+	if cfg.Caching.TTL > 0 {
+		b, err := io.ReadAll(req.Body)
 		if err != nil {
-			level.Warn(logger).Log("msg", "requesting GCM failed", "err", err)
+			level.Warn(f.logger).Log("msg", "reading request body failed", "err", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body = bytes.NewReader(b)
+		cacheKey = strings.Join([]string{method, u.String(), string(b)}, "\xff")
+
+		if e, ok := f.cache.get(cacheKey, f.now()); ok {
+			copyHeader(w.Header(), e.header)
+			w.WriteHeader(e.status)
+			w.Write(e.body)
+			return
+		}
+	}
+
+	newReq, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		level.Warn(f.logger).Log("msg", "creating request failed", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	copyHeader(newReq.Header, req.Header)
+	if h := cfg.Tenancy.ProjectHeader; h != "" {
+		newReq.Header.Del(h)
+	}
+
+	resp, err := f.client.Do(newReq)
+	if err != nil {
+		level.Warn(f.logger).Log("msg", "requesting GCM failed", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer resp.Body.Close()
+
+	if cacheKey != "" && resp.StatusCode == http.StatusOK {
+		b, err := io.ReadAll(resp.Body)
+		if err != nil {
+			level.Warn(f.logger).Log("msg", "reading response body failed", "err", err)
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
+		f.cache.set(cacheKey, f.now(), resp.StatusCode, resp.Header, b)
 
 		copyHeader(w.Header(), resp.Header)
 		w.WriteHeader(resp.StatusCode)
+		w.Write(b)
+		return
+	}
 
-		defer resp.Body.Close()
-		if _, err := io.Copy(w, resp.Body); err != nil {
-			level.Warn(logger).Log("msg", "copying response body failed", "err", err)
-			return
-		}
-	})
+	copyHeader(w.Header(), resp.Header)
+	w.WriteHeader(resp.StatusCode)
+
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		level.Warn(f.logger).Log("msg", "copying response body failed", "err", err)
+		return
+	}
 }
 
 func copyHeader(dst, src http.Header) {
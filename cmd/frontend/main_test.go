@@ -0,0 +1,385 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/common/model"
+)
+
+func TestLoadConfig(t *testing.T) {
+	base := Config{
+		Backend: BackendConfig{TargetURL: "https://example.com/v1/projects/PROJECT_ID/location/global/prometheus"},
+		Tenancy: TenancyConfig{ProjectID: "flag-project"},
+	}
+	cases := []struct {
+		doc     string
+		content string
+		want    *Config
+		wantErr bool
+	}{
+		{
+			doc:     "empty file keeps flag values",
+			content: "",
+			want:    &base,
+		},
+		{
+			doc: "file overrides flags",
+			content: `
+tenancy:
+  project_id: file-project
+  project_header: X-Project
+  allowed_projects: [a, b]
+limits:
+  max_concurrent_requests: 10
+  request_timeout: 30s
+caching:
+  ttl: 1m
+`,
+			want: &Config{
+				Backend: base.Backend,
+				Tenancy: TenancyConfig{
+					ProjectID:       "file-project",
+					ProjectHeader:   "X-Project",
+					AllowedProjects: []string{"a", "b"},
+				},
+				Limits: LimitsConfig{
+					MaxConcurrentRequests: 10,
+					RequestTimeout:        model.Duration(30 * time.Second),
+				},
+				Caching: CachingConfig{
+					TTL:        model.Duration(time.Minute),
+					MaxEntries: defaultCacheMaxEntries,
+				},
+			},
+		},
+		{
+			doc:     "unknown field",
+			content: "foo: bar",
+			wantErr: true,
+		},
+		{
+			doc: "allowed projects without header",
+			content: `
+tenancy:
+  allowed_projects: [a]
+`,
+			wantErr: true,
+		},
+		{
+			doc: "invalid authorization selector",
+			content: `
+authorization:
+  identity_header: X-Identity
+  rules:
+  - identities: [alice]
+    selector: '{namespace='
+`,
+			wantErr: true,
+		},
+		{
+			doc: "identity in multiple authorization rules",
+			content: `
+authorization:
+  identity_header: X-Identity
+  rules:
+  - identities: [alice]
+    selector: '{namespace="a"}'
+  - identities: [alice]
+    selector: '{namespace="b"}'
+`,
+			wantErr: true,
+		},
+		{
+			doc: "authorization rules without identity header",
+			content: `
+authorization:
+  rules:
+  - identities: [alice]
+    selector: '{namespace="a"}'
+`,
+			wantErr: true,
+		},
+		{
+			doc: "negative limit",
+			content: `
+limits:
+  max_concurrent_requests: -1
+`,
+			wantErr: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.doc, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(filename, []byte(c.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			cfg, err := loadConfig(filename, base)
+			if c.wantErr {
+				if err == nil {
+					t.Fatalf("expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if diff := cmp.Diff(c.want, cfg); diff != "" {
+				t.Errorf("unexpected config (-want, +got): %s", diff)
+			}
+		})
+	}
+}
+
+func TestFrontend(t *testing.T) {
+	var requests []string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests = append(requests, req.URL.Path)
+		if req.Header.Get("X-Project") != "" {
+			t.Errorf("project header was forwarded to backend")
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	cfg := &Config{
+		Backend: BackendConfig{TargetURL: backend.URL + "/projects/PROJECT_ID"},
+		Tenancy: TenancyConfig{
+			ProjectID:       "default",
+			ProjectHeader:   "X-Project",
+			AllowedProjects: []string{"other"},
+		},
+	}
+	fe := newFrontend(log.NewNopLogger(), http.DefaultTransport, cfg)
+
+	do := func(project string) int {
+		req := httptest.NewRequest("GET", "/api/v1/query?query=up", nil)
+		if project != "" {
+			req.Header.Set("X-Project", project)
+		}
+		w := httptest.NewRecorder()
+		fe.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := do(""); code != http.StatusOK {
+		t.Fatalf("unexpected status code %d", code)
+	}
+	if code := do("other"); code != http.StatusOK {
+		t.Fatalf("unexpected status code %d", code)
+	}
+	if code := do("forbidden"); code != http.StatusForbidden {
+		t.Fatalf("expected status code %d but got %d", http.StatusForbidden, code)
+	}
+	want := []string{"/projects/default/api/v1/query", "/projects/other/api/v1/query"}
+	if diff := cmp.Diff(want, requests); diff != "" {
+		t.Fatalf("unexpected backend requests (-want, +got): %s", diff)
+	}
+
+	// Enable caching through a config reload. Repeated requests must be served
+	// from the cache.
+	requests = nil
+	cached := *cfg
+	cached.Caching = CachingConfig{TTL: model.Duration(time.Minute), MaxEntries: 10}
+	fe.ApplyConfig(&cached)
+
+	for i := 0; i < 3; i++ {
+		if code := do(""); code != http.StatusOK {
+			t.Fatalf("unexpected status code %d", code)
+		}
+	}
+	if len(requests) != 1 {
+		t.Fatalf("expected 1 backend request but got %d", len(requests))
+	}
+
+	// Expired entries must be fetched again.
+	fe.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	if code := do(""); code != http.StatusOK {
+		t.Fatalf("unexpected status code %d", code)
+	}
+	if len(requests) != 2 {
+		t.Fatalf("expected 2 backend requests but got %d", len(requests))
+	}
+}
+
+func TestFrontend_ConcurrencyLimit(t *testing.T) {
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-release
+	}))
+	defer backend.Close()
+
+	fe := newFrontend(log.NewNopLogger(), http.DefaultTransport, &Config{
+		Backend: BackendConfig{TargetURL: backend.URL},
+		Tenancy: TenancyConfig{ProjectID: "default"},
+		Limits:  LimitsConfig{MaxConcurrentRequests: 1},
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fe.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/v1/query", nil))
+	}()
+	// Wait for the first request to occupy the only slot.
+	for fe.inflight.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	w := httptest.NewRecorder()
+	fe.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/query", strings.NewReader("")))
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected status code %d but got %d", http.StatusTooManyRequests, w.Code)
+	}
+	close(release)
+	<-done
+}
+
+func TestFrontend_Authorization(t *testing.T) {
+	var requests []string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if err := req.ParseForm(); err != nil {
+			t.Errorf("parse form: %s", err)
+		}
+		requests = append(requests, req.URL.Path+"?"+req.Form.Encode())
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	fe := newFrontend(log.NewNopLogger(), http.DefaultTransport, &Config{
+		Backend: BackendConfig{TargetURL: backend.URL},
+		Tenancy: TenancyConfig{ProjectID: "default"},
+		Authorization: AuthorizationConfig{
+			IdentityHeader: "X-Identity",
+			Rules: []AuthorizationRule{
+				{Identities: []string{"alice", "bob"}, Selector: `{namespace=~"team-a-.*"}`},
+			},
+		},
+	})
+
+	cases := []struct {
+		doc      string
+		identity string
+		method   string
+		target   string
+		body     string
+		wantCode int
+		want     string
+	}{
+		{
+			doc:      "query",
+			identity: "alice",
+			method:   "GET",
+			target:   "/api/v1/query?" + url.Values{"query": {`sum(rate(foo{job="a"}[5m])) / bar`}}.Encode(),
+			wantCode: http.StatusOK,
+			want: "/api/v1/query?" + url.Values{
+				"query": {`sum(rate(foo{job="a",namespace=~"team-a-.*"}[5m])) / bar{namespace=~"team-a-.*"}`},
+			}.Encode(),
+		},
+		{
+			doc:      "query in form body",
+			identity: "bob",
+			method:   "POST",
+			target:   "/api/v1/query_range",
+			body:     url.Values{"query": {"up"}, "step": {"30s"}}.Encode(),
+			wantCode: http.StatusOK,
+			want: "/api/v1/query_range?" + url.Values{
+				"query": {`up{namespace=~"team-a-.*"}`}, "step": {"30s"},
+			}.Encode(),
+		},
+		{
+			doc:      "series",
+			identity: "alice",
+			method:   "GET",
+			target:   "/api/v1/series?" + url.Values{"match[]": {"up", `{job="b"}`}}.Encode(),
+			wantCode: http.StatusOK,
+			want: "/api/v1/series?" + url.Values{
+				"match[]": {`{__name__="up",namespace=~"team-a-.*"}`, `{job="b",namespace=~"team-a-.*"}`},
+			}.Encode(),
+		},
+		{
+			doc:      "label values without selector",
+			identity: "alice",
+			method:   "GET",
+			target:   "/api/v1/label/__name__/values",
+			wantCode: http.StatusOK,
+			want: "/api/v1/label/__name__/values?" + url.Values{
+				"match[]": {`{namespace=~"team-a-.*"}`},
+			}.Encode(),
+		},
+		{
+			doc:      "unknown identity",
+			identity: "eve",
+			method:   "GET",
+			target:   "/api/v1/query?query=up",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			doc:      "missing identity",
+			method:   "GET",
+			target:   "/api/v1/query?query=up",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			doc:      "unrestricted endpoint",
+			identity: "alice",
+			method:   "GET",
+			target:   "/api/v1/query_exemplars?query=up",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			doc:      "invalid query",
+			identity: "alice",
+			method:   "GET",
+			target:   "/api/v1/query?query=sum(",
+			wantCode: http.StatusBadRequest,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.doc, func(t *testing.T) {
+			requests = nil
+
+			req := httptest.NewRequest(c.method, c.target, strings.NewReader(c.body))
+			if c.body != "" {
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			}
+			if c.identity != "" {
+				req.Header.Set("X-Identity", c.identity)
+			}
+			w := httptest.NewRecorder()
+			fe.ServeHTTP(w, req)
+
+			if w.Code != c.wantCode {
+				t.Fatalf("expected status code %d but got %d", c.wantCode, w.Code)
+			}
+			var want []string
+			if c.want != "" {
+				want = []string{c.want}
+			}
+			if diff := cmp.Diff(want, requests); diff != "" {
+				t.Errorf("unexpected backend requests (-want, +got): %s", diff)
+			}
+		})
+	}
+}
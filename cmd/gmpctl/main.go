@@ -0,0 +1,143 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// gmpctl is a command line tool to inspect the state of managed collection
+// in a cluster and to migrate to it.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/generated/clientset/versioned"
+)
+
+// Exit code if the target health regressed.
+const exitCodeRegressed = 2
+
+func main() {
+	app := kingpin.New("gmpctl", "Inspect managed collection of Google Cloud Managed Service for Prometheus.")
+	app.HelpFlag.Short('h')
+
+	kubeconfig := app.Flag("kubeconfig", "Path to the kubeconfig file. Defaults to the standard kubeconfig loading rules.").String()
+	namespace := app.Flag("namespace", "Only consider PodMonitorings in this namespace. All namespaces and ClusterPodMonitorings if empty.").Short('n').String()
+
+	targets := app.Command("targets", "Inspect the target status of PodMonitorings and ClusterPodMonitorings.")
+
+	list := targets.Command("list", "Print a table of all endpoints with their target counts, health, and most frequent error.")
+
+	show := targets.Command("show", "Print the details and sample targets of an endpoint.")
+	showEndpoint := show.Arg("endpoint", "Name of the endpoint, e.g. PodMonitoring/ns/app/metrics, or of a resource to show all of its endpoints, e.g. PodMonitoring/ns/app.").Required().String()
+
+	snapshot := targets.Command("snapshot", "Print a JSON snapshot of the current target status.")
+
+	diff := targets.Command("diff", fmt.Sprintf("Compare target status snapshots. Exits with code %d if target health regressed, i.e. scrape pools disappeared or targets became unhealthy.", exitCodeRegressed))
+	diffBefore := diff.Arg("before", "Snapshot taken before the change.").Required().ExistingFile()
+	diffAfter := diff.Arg("after", "Snapshot taken after the change. If omitted, the current target status is used.").ExistingFile()
+	diffOutput := diff.Flag("output", "Output format.").Short('o').Default("text").Enum("text", "json")
+
+	migrate := app.Command("migrate", "Convert configuration of other collection setups to managed collection.")
+
+	sidecar := migrate.Command("sidecar", "Convert the configuration of the Stackdriver Prometheus sidecar. Prints the equivalent resources and a compatibility report as YAML.")
+	sidecarConfigFile := sidecar.Flag("config-file", "Path to the configuration file of the sidecar.").ExistingFile()
+	sidecarIncludes := sidecar.Flag("include", "Series selector passed to the --include flag of the sidecar. Repeat for multiple selectors.").Strings()
+
+	cmd := kingpin.MustParse(app.Parse(os.Args[1:]))
+	ctx := context.Background()
+
+	switch cmd {
+	case list.FullCommand():
+		client, err := newClient(*kubeconfig)
+		app.FatalIfError(err, "create client")
+		statuses, err := listEndpointStatuses(ctx, client, *namespace)
+		app.FatalIfError(err, "list target status")
+		app.FatalIfError(printTargetsTable(os.Stdout, statuses), "write table")
+
+	case show.FullCommand():
+		client, err := newClient(*kubeconfig)
+		app.FatalIfError(err, "create client")
+		statuses, err := listEndpointStatuses(ctx, client, *namespace)
+		app.FatalIfError(err, "list target status")
+		app.FatalIfError(printEndpoints(os.Stdout, statuses, *showEndpoint), "show endpoint")
+
+	case snapshot.FullCommand():
+		client, err := newClient(*kubeconfig)
+		app.FatalIfError(err, "create client")
+		s, err := takeSnapshot(ctx, client, *namespace)
+		app.FatalIfError(err, "take snapshot")
+
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		app.FatalIfError(enc.Encode(s), "write snapshot")
+
+	case diff.FullCommand():
+		before, err := readSnapshot(*diffBefore)
+		app.FatalIfError(err, "read snapshot")
+
+		var after *targetSnapshot
+		if *diffAfter != "" {
+			after, err = readSnapshot(*diffAfter)
+			app.FatalIfError(err, "read snapshot")
+		} else {
+			client, err := newClient(*kubeconfig)
+			app.FatalIfError(err, "create client")
+			after, err = takeSnapshot(ctx, client, *namespace)
+			app.FatalIfError(err, "take snapshot")
+		}
+		d := diffSnapshots(before, after)
+
+		if *diffOutput == "json" {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			app.FatalIfError(enc.Encode(d), "write diff")
+		} else {
+			printDiff(os.Stdout, d)
+		}
+		if d.regressed() {
+			os.Exit(exitCodeRegressed)
+		}
+
+	case sidecar.FullCommand():
+		var b []byte
+		if *sidecarConfigFile != "" {
+			var err error
+			b, err = os.ReadFile(*sidecarConfigFile)
+			app.FatalIfError(err, "read sidecar config")
+		}
+		m, err := convertSidecarConfig(b, *sidecarIncludes)
+		app.FatalIfError(err, "convert sidecar config")
+		app.FatalIfError(writeSidecarMigration(os.Stdout, m), "write resources")
+	}
+}
+
+func newClient(kubeconfigPath string) (versioned.Interface, error) {
+	cfg, err := loadKubeConfig(kubeconfigPath)
+	if err != nil {
+		return nil, err
+	}
+	return versioned.NewForConfig(cfg)
+}
+
+func loadKubeConfig(kubeconfigPath string) (*rest.Config, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeconfigPath
+
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, nil).ClientConfig()
+}
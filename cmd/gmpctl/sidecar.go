@@ -0,0 +1,239 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/prometheus/promql/parser"
+	yaml "gopkg.in/yaml.v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8syaml "sigs.k8s.io/yaml"
+
+	"github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator"
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+)
+
+// sidecarConfig is the configuration file of the deprecated Stackdriver Prometheus
+// sidecar (https://github.com/Stackdriver/stackdriver-prometheus-sidecar).
+type sidecarConfig struct {
+	MetricRenames []struct {
+		From string `yaml:"from"`
+		To   string `yaml:"to"`
+	} `yaml:"metric_renames"`
+	StaticMetadata []struct {
+		Metric    string `yaml:"metric"`
+		Type      string `yaml:"type"`
+		ValueType string `yaml:"value_type"`
+		Help      string `yaml:"help"`
+	} `yaml:"static_metadata"`
+	AggregatedCounters []struct {
+		Metric  string   `yaml:"metric"`
+		Filters []string `yaml:"filters"`
+		Help    string   `yaml:"help"`
+	} `yaml:"aggregated_counters"`
+}
+
+// Known top-level sections of the sidecar configuration file.
+var sidecarConfigSections = map[string]bool{
+	"metric_renames":      true,
+	"static_metadata":     true,
+	"aggregated_counters": true,
+}
+
+const (
+	// Name of the generated ClusterRules holding aggregated counters.
+	nameSidecarAggregatedCounters = "sidecar-aggregated-counters"
+	// Evaluation interval of the generated recording rules.
+	sidecarRuleInterval = "60s"
+)
+
+// Levels of compatibility report entries.
+const (
+	reportConverted   = "CONVERTED"
+	reportManual      = "MANUAL"
+	reportUnsupported = "UNSUPPORTED"
+)
+
+type reportEntry struct {
+	Level   string
+	Message string
+}
+
+// sidecarMigration is the result of converting a sidecar configuration.
+type sidecarMigration struct {
+	// OperatorConfig holding the export filters. Nil if there are none.
+	OperatorConfig *monitoringv1.OperatorConfig
+	// ClusterRules recording the aggregated counters. Nil if there are none.
+	ClusterRules *monitoringv1.ClusterRules
+	// Metric relabeling rules equivalent to the metric renames. They must be added
+	// to the PodMonitorings scraping the renamed metrics.
+	MetricRelabeling []monitoringv1.RelabelingRule
+	// Compatibility report.
+	Report []reportEntry
+}
+
+func (m *sidecarMigration) report(level, format string, args ...interface{}) {
+	m.Report = append(m.Report, reportEntry{Level: level, Message: fmt.Sprintf(format, args...)})
+}
+
+// convertSidecarConfig converts the sidecar configuration file contents and the series
+// selectors of its --include flags into equivalent managed collection resources.
+func convertSidecarConfig(b []byte, includes []string) (*sidecarMigration, error) {
+	var sections map[string]interface{}
+	if err := yaml.Unmarshal(b, &sections); err != nil {
+		return nil, fmt.Errorf("parse sidecar config: %w", err)
+	}
+	var cfg sidecarConfig
+	if err := yaml.Unmarshal(b, &cfg); err != nil {
+		return nil, fmt.Errorf("parse sidecar config: %w", err)
+	}
+	m := &sidecarMigration{}
+
+	var unknown []string
+	for s := range sections {
+		if !sidecarConfigSections[s] {
+			unknown = append(unknown, s)
+		}
+	}
+	sort.Strings(unknown)
+	for _, s := range unknown {
+		m.report(reportUnsupported, "Unknown configuration section %q is ignored.", s)
+	}
+
+	// Filters map directly to the export filters of the OperatorConfig.
+	for _, inc := range includes {
+		if _, err := parser.ParseMetricSelector(inc); err != nil {
+			return nil, fmt.Errorf("invalid --include selector %q: %w", inc, err)
+		}
+	}
+	if len(includes) > 0 {
+		m.OperatorConfig = &monitoringv1.OperatorConfig{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: monitoringv1.SchemeGroupVersion.String(),
+				Kind:       "OperatorConfig",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: operator.DefaultPublicNamespace,
+				Name:      operator.NameOperatorConfig,
+			},
+			Collection: monitoringv1.CollectionSpec{
+				Filter: monitoringv1.ExportFilters{MatchOneOf: includes},
+			},
+		}
+		m.report(reportConverted, "%d --include filters converted to collection.filter.matchOneOf of the OperatorConfig. Merge them into the existing OperatorConfig instead of replacing it.", len(includes))
+	}
+
+	// Renames are applied at scrape time through metric relabeling.
+	for _, r := range cfg.MetricRenames {
+		if r.From == "" || r.To == "" {
+			return nil, fmt.Errorf("metric rename must have from and to set")
+		}
+		m.MetricRelabeling = append(m.MetricRelabeling, monitoringv1.RelabelingRule{
+			Action:       "replace",
+			SourceLabels: []string{"__name__"},
+			Regex:        regexp.QuoteMeta(r.From),
+			TargetLabel:  "__name__",
+			Replacement:  r.To,
+		})
+	}
+	if n := len(cfg.MetricRenames); n > 0 {
+		m.report(reportManual, "%d metric renames converted to metricRelabeling rules. Add them to the endpoints of the PodMonitorings scraping the renamed metrics.", n)
+	}
+
+	// Aggregated counters are equivalent to recording rules summing all matching series.
+	if len(cfg.AggregatedCounters) > 0 {
+		group := monitoringv1.RuleGroup{
+			Name:     "aggregated-counters",
+			Interval: sidecarRuleInterval,
+		}
+		for _, c := range cfg.AggregatedCounters {
+			if c.Metric == "" || len(c.Filters) == 0 {
+				return nil, fmt.Errorf("aggregated counter must have metric and filters set")
+			}
+			for _, f := range c.Filters {
+				if _, err := parser.ParseMetricSelector(f); err != nil {
+					return nil, fmt.Errorf("invalid filter %q of aggregated counter %q: %w", f, c.Metric, err)
+				}
+			}
+			group.Rules = append(group.Rules, monitoringv1.Rule{
+				Record: c.Metric,
+				// Series matching multiple filters must only be counted once.
+				Expr: fmt.Sprintf("sum(%s)", strings.Join(c.Filters, " or ")),
+			})
+		}
+		m.ClusterRules = &monitoringv1.ClusterRules{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: monitoringv1.SchemeGroupVersion.String(),
+				Kind:       "ClusterRules",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name: nameSidecarAggregatedCounters,
+			},
+			Spec: monitoringv1.RulesSpec{
+				Groups: []monitoringv1.RuleGroup{group},
+			},
+		}
+		m.report(reportConverted, "%d aggregated counters converted to recording rules in ClusterRules %q, evaluated every %s. Unlike the sidecar, the sum is not corrected for resets of individual counters.",
+			len(cfg.AggregatedCounters), nameSidecarAggregatedCounters, sidecarRuleInterval)
+	}
+
+	// Metadata is derived from the scraped targets.
+	for _, md := range cfg.StaticMetadata {
+		m.report(reportUnsupported, "Static metadata for metric %q is ignored. Metric types are derived from the metadata exposed by scrape targets.", md.Metric)
+	}
+	return m, nil
+}
+
+// writeSidecarMigration writes the generated resources as a multi-document YAML
+// stream and the compatibility report as YAML comments.
+func writeSidecarMigration(w io.Writer, m *sidecarMigration) error {
+	fmt.Fprintln(w, "# Compatibility report for the Stackdriver Prometheus sidecar configuration:")
+	if len(m.Report) == 0 {
+		fmt.Fprintln(w, "#   Nothing to convert.")
+	}
+	for _, e := range m.Report {
+		fmt.Fprintf(w, "#   [%s] %s\n", e.Level, e.Message)
+	}
+	if len(m.MetricRelabeling) > 0 {
+		b, err := k8syaml.Marshal(map[string]interface{}{"metricRelabeling": m.MetricRelabeling})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, "#\n# Metric relabeling rules for PodMonitoring endpoints:")
+		for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+			fmt.Fprintf(w, "#   %s\n", line)
+		}
+	}
+	var objs []interface{}
+	if m.OperatorConfig != nil {
+		objs = append(objs, m.OperatorConfig)
+	}
+	if m.ClusterRules != nil {
+		objs = append(objs, m.ClusterRules)
+	}
+	for _, obj := range objs {
+		b, err := k8syaml.Marshal(obj)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "---\n%s", b)
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+)
+
+func TestConvertSidecarConfig(t *testing.T) {
+	cfg := `
+metric_renames:
+- from: original_metric_name
+  to: new_metric_name
+static_metadata:
+- metric: some_metric_name
+  type: counter
+  value_type: double
+aggregated_counters:
+- metric: network_transmit_bytes
+  help: total number of bytes sent over eth0
+  filters:
+  - node_network_transmit_bytes_total{device="eth0"}
+  - node_network_transmit_bytes{device="eth0"}
+unknown_section: {}
+`
+	m, err := convertSidecarConfig([]byte(cfg), []string{`{job="a"}`, `up`})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]string{`{job="a"}`, `up`}, m.OperatorConfig.Collection.Filter.MatchOneOf); diff != "" {
+		t.Errorf("unexpected export filters (-want, +got): %s", diff)
+	}
+	wantRelabeling := []monitoringv1.RelabelingRule{{
+		Action:       "replace",
+		SourceLabels: []string{"__name__"},
+		Regex:        "original_metric_name",
+		TargetLabel:  "__name__",
+		Replacement:  "new_metric_name",
+	}}
+	if diff := cmp.Diff(wantRelabeling, m.MetricRelabeling); diff != "" {
+		t.Errorf("unexpected metric relabeling (-want, +got): %s", diff)
+	}
+	wantGroups := []monitoringv1.RuleGroup{{
+		Name:     "aggregated-counters",
+		Interval: "60s",
+		Rules: []monitoringv1.Rule{{
+			Record: "network_transmit_bytes",
+			Expr:   `sum(node_network_transmit_bytes_total{device="eth0"} or node_network_transmit_bytes{device="eth0"})`,
+		}},
+	}}
+	if diff := cmp.Diff(wantGroups, m.ClusterRules.Spec.Groups); diff != "" {
+		t.Errorf("unexpected rule groups (-want, +got): %s", diff)
+	}
+
+	var levels []string
+	for _, e := range m.Report {
+		levels = append(levels, e.Level)
+	}
+	wantLevels := []string{reportUnsupported, reportConverted, reportManual, reportConverted, reportUnsupported}
+	if diff := cmp.Diff(wantLevels, levels); diff != "" {
+		t.Errorf("unexpected report levels (-want, +got): %s", diff)
+	}
+
+	var buf bytes.Buffer
+	if err := writeSidecarMigration(&buf, m); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"kind: OperatorConfig", "kind: ClusterRules", "#   - action: replace"} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("expected output to contain %q, got %q", s, buf.String())
+		}
+	}
+}
+
+func TestConvertSidecarConfig_Empty(t *testing.T) {
+	m, err := convertSidecarConfig(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.OperatorConfig != nil || m.ClusterRules != nil || len(m.Report) > 0 {
+		t.Errorf("expected empty migration, got %+v", m)
+	}
+}
+
+func TestConvertSidecarConfig_Invalid(t *testing.T) {
+	cases := []struct {
+		doc      string
+		cfg      string
+		includes []string
+	}{
+		{
+			doc:      "invalid include",
+			includes: []string{`{job=}`},
+		},
+		{
+			doc: "invalid aggregated counter filter",
+			cfg: `
+aggregated_counters:
+- metric: foo
+  filters: ['bar{']
+`,
+		},
+		{
+			doc: "aggregated counter without filters",
+			cfg: `
+aggregated_counters:
+- metric: foo
+`,
+		},
+		{
+			doc: "incomplete rename",
+			cfg: `
+metric_renames:
+- from: foo
+`,
+		},
+		{
+			doc: "malformed",
+			cfg: `metric_renames: foo`,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.doc, func(t *testing.T) {
+			if _, err := convertSidecarConfig([]byte(c.cfg), c.includes); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,267 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+	"github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/generated/clientset/versioned"
+)
+
+// targetSnapshot is a point-in-time copy of the target status of all scrape pools.
+type targetSnapshot struct {
+	Time  time.Time      `json:"time"`
+	Pools []poolSnapshot `json:"pools"`
+}
+
+// poolSnapshot is the target status of a single scrape pool, i.e. an endpoint
+// of a PodMonitoring or ClusterPodMonitoring.
+type poolSnapshot struct {
+	Name             string `json:"name"`
+	ActiveTargets    int64  `json:"activeTargets"`
+	UnhealthyTargets int64  `json:"unhealthyTargets"`
+	// Unhealthy targets from the sample groups of the status. The target status
+	// only holds a sample, so this may not contain all unhealthy targets.
+	Unhealthy []targetError `json:"unhealthy,omitempty"`
+}
+
+// targetError is an unhealthy target identified by its labels.
+type targetError struct {
+	Target string `json:"target"`
+	Error  string `json:"error,omitempty"`
+}
+
+// takeSnapshot reads the target status of all PodMonitorings in the namespace, as well
+// as of all ClusterPodMonitorings if the namespace is empty.
+func takeSnapshot(ctx context.Context, client versioned.Interface, namespace string) (*targetSnapshot, error) {
+	s := &targetSnapshot{Time: time.Now().UTC()}
+
+	statuses, err := listEndpointStatuses(ctx, client, namespace)
+	if err != nil {
+		return nil, err
+	}
+	s.add(statuses)
+
+	sort.Slice(s.Pools, func(i, j int) bool {
+		return s.Pools[i].Name < s.Pools[j].Name
+	})
+	return s, nil
+}
+
+// listEndpointStatuses returns the endpoint statuses of all PodMonitorings in the namespace,
+// as well as of all ClusterPodMonitorings if the namespace is empty. Statuses written into
+// dedicated target status objects are read from those.
+func listEndpointStatuses(ctx context.Context, client versioned.Interface, namespace string) ([]monitoringv1.ScrapeEndpointStatus, error) {
+	var res []monitoringv1.ScrapeEndpointStatus
+
+	pms, err := client.MonitoringV1().PodMonitorings(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("list PodMonitorings: %w", err)
+	}
+	for _, pm := range pms.Items {
+		statuses := pm.Status.EndpointStatuses
+		if ref := pm.Status.TargetStatusRef; ref != nil {
+			obj, err := client.MonitoringV1().PodMonitoringTargetStatuses(pm.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+			if err != nil {
+				return nil, fmt.Errorf("get target status of PodMonitoring %s/%s: %w", pm.Namespace, pm.Name, err)
+			}
+			statuses = obj.EndpointStatuses
+		}
+		res = append(res, statuses...)
+	}
+	if namespace == "" {
+		cpms, err := client.MonitoringV1().ClusterPodMonitorings().List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("list ClusterPodMonitorings: %w", err)
+		}
+		for _, cpm := range cpms.Items {
+			statuses := cpm.Status.EndpointStatuses
+			if ref := cpm.Status.TargetStatusRef; ref != nil {
+				obj, err := client.MonitoringV1().ClusterPodMonitoringTargetStatuses().Get(ctx, ref.Name, metav1.GetOptions{})
+				if err != nil {
+					return nil, fmt.Errorf("get target status of ClusterPodMonitoring %s: %w", cpm.Name, err)
+				}
+				statuses = obj.EndpointStatuses
+			}
+			res = append(res, statuses...)
+		}
+	}
+	return res, nil
+}
+
+func (s *targetSnapshot) add(statuses []monitoringv1.ScrapeEndpointStatus) {
+	for _, status := range statuses {
+		pool := poolSnapshot{
+			Name:             status.Name,
+			ActiveTargets:    status.ActiveTargets,
+			UnhealthyTargets: status.UnhealthyTargets,
+		}
+		for _, group := range status.SampleGroups {
+			for _, target := range group.SampleTargets {
+				if target.Health == "up" {
+					continue
+				}
+				te := targetError{Target: target.Labels.String()}
+				if target.LastError != nil {
+					te.Error = *target.LastError
+				}
+				pool.Unhealthy = append(pool.Unhealthy, te)
+			}
+		}
+		sort.Slice(pool.Unhealthy, func(i, j int) bool {
+			return pool.Unhealthy[i].Target < pool.Unhealthy[j].Target
+		})
+		s.Pools = append(s.Pools, pool)
+	}
+}
+
+func readSnapshot(filename string) (*targetSnapshot, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var s targetSnapshot
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("parse snapshot %s: %w", filename, err)
+	}
+	return &s, nil
+}
+
+// targetsDiff holds the changes in target health between two snapshots.
+type targetsDiff struct {
+	AddedPools   []string `json:"addedPools,omitempty"`
+	RemovedPools []string `json:"removedPools,omitempty"`
+	// Pools with more unhealthy targets than before.
+	UnhealthyIncreased []poolCounts `json:"unhealthyIncreased,omitempty"`
+	NewlyUnhealthy     []poolTarget `json:"newlyUnhealthy,omitempty"`
+	Recovered          []poolTarget `json:"recovered,omitempty"`
+}
+
+type poolCounts struct {
+	Pool            string `json:"pool"`
+	UnhealthyBefore int64  `json:"unhealthyBefore"`
+	UnhealthyAfter  int64  `json:"unhealthyAfter"`
+	ActiveAfter     int64  `json:"activeAfter"`
+}
+
+type poolTarget struct {
+	Pool string `json:"pool"`
+	targetError
+}
+
+// regressed returns true if target health got worse.
+func (d *targetsDiff) regressed() bool {
+	return len(d.RemovedPools) > 0 || len(d.UnhealthyIncreased) > 0 || len(d.NewlyUnhealthy) > 0
+}
+
+// diffSnapshots returns the changes in target health from before to after.
+func diffSnapshots(before, after *targetSnapshot) *targetsDiff {
+	var d targetsDiff
+
+	beforePools := map[string]poolSnapshot{}
+	for _, p := range before.Pools {
+		beforePools[p.Name] = p
+	}
+	afterPools := map[string]bool{}
+
+	for _, p := range after.Pools {
+		afterPools[p.Name] = true
+
+		prev, ok := beforePools[p.Name]
+		if !ok {
+			d.AddedPools = append(d.AddedPools, p.Name)
+			for _, te := range p.Unhealthy {
+				d.NewlyUnhealthy = append(d.NewlyUnhealthy, poolTarget{Pool: p.Name, targetError: te})
+			}
+			continue
+		}
+		if p.UnhealthyTargets > prev.UnhealthyTargets {
+			d.UnhealthyIncreased = append(d.UnhealthyIncreased, poolCounts{
+				Pool:            p.Name,
+				UnhealthyBefore: prev.UnhealthyTargets,
+				UnhealthyAfter:  p.UnhealthyTargets,
+				ActiveAfter:     p.ActiveTargets,
+			})
+		}
+		prevUnhealthy := map[string]bool{}
+		for _, te := range prev.Unhealthy {
+			prevUnhealthy[te.Target] = true
+		}
+		unhealthy := map[string]bool{}
+		for _, te := range p.Unhealthy {
+			unhealthy[te.Target] = true
+			if !prevUnhealthy[te.Target] {
+				d.NewlyUnhealthy = append(d.NewlyUnhealthy, poolTarget{Pool: p.Name, targetError: te})
+			}
+		}
+		for _, te := range prev.Unhealthy {
+			if !unhealthy[te.Target] {
+				d.Recovered = append(d.Recovered, poolTarget{Pool: p.Name, targetError: targetError{Target: te.Target}})
+			}
+		}
+	}
+	for _, p := range before.Pools {
+		if !afterPools[p.Name] {
+			d.RemovedPools = append(d.RemovedPools, p.Name)
+		}
+	}
+	return &d
+}
+
+// printDiff writes a human-readable summary of the diff.
+func printDiff(w io.Writer, d *targetsDiff) {
+	if len(d.RemovedPools) > 0 {
+		fmt.Fprintln(w, "Disappeared scrape pools:")
+		for _, p := range d.RemovedPools {
+			fmt.Fprintf(w, "  - %s\n", p)
+		}
+	}
+	if len(d.UnhealthyIncreased) > 0 {
+		fmt.Fprintln(w, "Scrape pools with more unhealthy targets:")
+		for _, c := range d.UnhealthyIncreased {
+			fmt.Fprintf(w, "  - %s: %d -> %d of %d targets\n", c.Pool, c.UnhealthyBefore, c.UnhealthyAfter, c.ActiveAfter)
+		}
+	}
+	if len(d.NewlyUnhealthy) > 0 {
+		fmt.Fprintln(w, "New unhealthy targets:")
+		for _, t := range d.NewlyUnhealthy {
+			fmt.Fprintf(w, "  - %s %s: %s\n", t.Pool, t.Target, t.Error)
+		}
+	}
+	if len(d.Recovered) > 0 {
+		fmt.Fprintln(w, "Recovered targets:")
+		for _, t := range d.Recovered {
+			fmt.Fprintf(w, "  - %s %s\n", t.Pool, t.Target)
+		}
+	}
+	if len(d.AddedPools) > 0 {
+		fmt.Fprintln(w, "New scrape pools:")
+		for _, p := range d.AddedPools {
+			fmt.Fprintf(w, "  - %s\n", p)
+		}
+	}
+	if !d.regressed() {
+		fmt.Fprintln(w, "Target health did not regress.")
+	}
+}
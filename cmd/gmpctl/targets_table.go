@@ -0,0 +1,178 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+)
+
+// Maximum length of errors printed in the targets table.
+const maxTableErrorLength = 80
+
+// endpointHealth summarizes the health of an endpoint from its target counts and
+// service discovery errors.
+func endpointHealth(status *monitoringv1.ScrapeEndpointStatus) string {
+	switch {
+	case len(status.DiscoveryErrors) > 0:
+		return "DiscoveryFailed"
+	case status.ActiveTargets == 0:
+		return "NoTargets"
+	case status.UnhealthyTargets == 0:
+		return "Healthy"
+	case status.UnhealthyTargets == status.ActiveTargets:
+		return "Down"
+	default:
+		return "Degraded"
+	}
+}
+
+// topError returns the most frequent error in the sample groups of the endpoint status
+// and the number of targets that reported it.
+func topError(status *monitoringv1.ScrapeEndpointStatus) (string, int32) {
+	var (
+		top   string
+		count int32
+	)
+	for _, group := range status.SampleGroups {
+		if len(group.SampleTargets) == 0 || group.SampleTargets[0].LastError == nil {
+			continue
+		}
+		n := int32(len(group.SampleTargets))
+		if group.Count != nil {
+			n = *group.Count
+		}
+		if n > count {
+			top, count = *group.SampleTargets[0].LastError, n
+		}
+	}
+	return top, count
+}
+
+// printTargetsTable writes a table with the target counts, health, and most frequent
+// error of each endpoint.
+func printTargetsTable(w io.Writer, statuses []monitoringv1.ScrapeEndpointStatus) error {
+	statuses = append([]monitoringv1.ScrapeEndpointStatus(nil), statuses...)
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "ENDPOINT\tHEALTHY\tSTATUS\tTOP ERROR")
+
+	for i := range statuses {
+		status := &statuses[i]
+		errMsg := ""
+		if msg, n := topError(status); msg != "" {
+			msg = strings.ReplaceAll(msg, "\n", " ")
+			if len(msg) > maxTableErrorLength {
+				msg = msg[:maxTableErrorLength-3] + "..."
+			}
+			errMsg = fmt.Sprintf("(%d) %s", n, msg)
+		}
+		fmt.Fprintf(tw, "%s\t%d/%d\t%s\t%s\n",
+			status.Name,
+			status.ActiveTargets-status.UnhealthyTargets, status.ActiveTargets,
+			endpointHealth(status),
+			errMsg,
+		)
+	}
+	return tw.Flush()
+}
+
+// printEndpoints writes the details and sample targets of the endpoints with the given
+// name. The name is either the full endpoint name, e.g. "PodMonitoring/ns/app/metrics",
+// or the name of a resource, e.g. "PodMonitoring/ns/app", to select all of its endpoints.
+func printEndpoints(w io.Writer, statuses []monitoringv1.ScrapeEndpointStatus, name string) error {
+	var matched []monitoringv1.ScrapeEndpointStatus
+	for _, status := range statuses {
+		if status.Name == name || strings.HasPrefix(status.Name, name+"/") {
+			matched = append(matched, status)
+		}
+	}
+	if len(matched) == 0 {
+		return fmt.Errorf("no target status found for endpoint %q", name)
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		return matched[i].Name < matched[j].Name
+	})
+
+	for i, status := range matched {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "Endpoint:           %s\n", status.Name)
+		fmt.Fprintf(w, "Status:             %s\n", endpointHealth(&status))
+		if status.DiscoveredTargets != nil {
+			fmt.Fprintf(w, "Discovered targets: %d\n", *status.DiscoveredTargets)
+		}
+		fmt.Fprintf(w, "Active targets:     %d\n", status.ActiveTargets)
+		fmt.Fprintf(w, "Unhealthy targets:  %d\n", status.UnhealthyTargets)
+		if status.SamplesScraped != nil {
+			fmt.Fprintf(w, "Samples scraped:    %d\n", *status.SamplesScraped)
+		}
+		if status.SamplesPostMetricRelabeling != nil {
+			fmt.Fprintf(w, "Samples kept:       %d\n", *status.SamplesPostMetricRelabeling)
+		}
+		fmt.Fprintf(w, "Collectors:         %s\n", status.CollectorsFraction)
+		for _, collector := range status.FailedCollectors {
+			fmt.Fprintf(w, "Failed collector:   %s\n", collector)
+		}
+		if status.FlapCount > 0 {
+			fmt.Fprintf(w, "Flaps (last hour):  %d\n", status.FlapCount)
+		}
+		fmt.Fprintf(w, "Last update:        %s\n", status.LastUpdateTime.UTC())
+		for _, msg := range status.DiscoveryErrors {
+			fmt.Fprintf(w, "Discovery error:    %s\n", msg)
+		}
+
+		for _, group := range status.SampleGroups {
+			if len(group.SampleTargets) == 0 {
+				continue
+			}
+			fmt.Fprintln(w)
+			count := int32(len(group.SampleTargets))
+			if group.Count != nil {
+				count = *group.Count
+			}
+			if msg := group.SampleTargets[0].LastError; msg != nil {
+				if code := group.SampleTargets[0].LastScrapeStatusCode; code != nil {
+					fmt.Fprintf(w, "Error (%d targets, HTTP %d): %s\n", count, *code, *msg)
+				} else {
+					fmt.Fprintf(w, "Error (%d targets): %s\n", count, *msg)
+				}
+			} else {
+				fmt.Fprintf(w, "Healthy (%d targets)\n", count)
+			}
+			tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+			fmt.Fprintln(tw, "  TARGET\tHEALTH\tLAST SCRAPE\tDURATION")
+			for _, target := range group.SampleTargets {
+				lastScrape := ""
+				if target.LastScrapeTime != nil {
+					lastScrape = target.LastScrapeTime.UTC().String()
+				}
+				fmt.Fprintf(tw, "  %s\t%s\t%s\t%ss\n", target.Labels, target.Health, lastScrape, target.LastScrapeDurationSeconds)
+			}
+			if err := tw.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
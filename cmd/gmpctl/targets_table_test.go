@@ -0,0 +1,161 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/common/model"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+)
+
+var tableTestStatuses = []monitoringv1.ScrapeEndpointStatus{
+	{
+		Name:             "PodMonitoring/ns1/a/metrics",
+		ActiveTargets:    5,
+		UnhealthyTargets: 3,
+		SampleGroups: []monitoringv1.SampleGroup{{
+			SampleTargets: []monitoringv1.SampleTarget{{
+				Labels:    model.LabelSet{"instance": "a-1"},
+				Health:    "down",
+				LastError: pointer.String("connection refused"),
+			}},
+			Count: pointer.Int32(1),
+		}, {
+			SampleTargets: []monitoringv1.SampleTarget{{
+				Labels:                    model.LabelSet{"instance": "a-2"},
+				Health:                    "down",
+				LastError:                 pointer.String("context deadline exceeded"),
+				LastScrapeDurationSeconds: "10",
+			}},
+			Count: pointer.Int32(2),
+		}, {
+			SampleTargets: []monitoringv1.SampleTarget{{
+				Labels: model.LabelSet{"instance": "a-3"},
+				Health: "up",
+			}},
+			Count: pointer.Int32(2),
+		}},
+		CollectorsFraction:          "0.5",
+		FailedCollectors:            []string{"collector-x7k2p: timeout"},
+		LastUpdateTime:              metav1.NewTime(time.Date(2022, time.January, 4, 0, 0, 0, 0, time.UTC)),
+		FlapCount:                   3,
+		SamplesScraped:              pointer.Int64(120),
+		SamplesPostMetricRelabeling: pointer.Int64(80),
+	},
+	{
+		Name:             "PodMonitoring/ns1/a/other",
+		ActiveTargets:    2,
+		UnhealthyTargets: 1,
+		SampleGroups: []monitoringv1.SampleGroup{{
+			SampleTargets: []monitoringv1.SampleTarget{{
+				Labels:               model.LabelSet{"instance": "a-4"},
+				Health:               "down",
+				LastError:            pointer.String("server returned HTTP status 503 Service Unavailable"),
+				LastScrapeStatusCode: pointer.Int32(503),
+			}},
+		}},
+	},
+	{
+		Name:               "ClusterPodMonitoring/b/metrics",
+		ActiveTargets:      2,
+		UnhealthyTargets:   2,
+		CollectorsFraction: "1",
+	},
+	{
+		Name:              "PodMonitoring/ns2/c/metrics",
+		DiscoveredTargets: pointer.Int64(0),
+	},
+	{
+		Name:            "PodMonitoring/ns2/d/metrics",
+		DiscoveryErrors: []string{"requests to the Kubernetes API failed on 1 collectors"},
+	},
+}
+
+func TestPrintTargetsTable(t *testing.T) {
+	var buf bytes.Buffer
+	if err := printTargetsTable(&buf, tableTestStatuses); err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join([]string{
+		"ENDPOINT                        HEALTHY  STATUS           TOP ERROR",
+		"ClusterPodMonitoring/b/metrics  0/2      Down             ",
+		"PodMonitoring/ns1/a/metrics     2/5      Degraded         (2) context deadline exceeded",
+		"PodMonitoring/ns1/a/other       1/2      Degraded         (1) server returned HTTP status 503 Service Unavailable",
+		"PodMonitoring/ns2/c/metrics     0/0      NoTargets        ",
+		"PodMonitoring/ns2/d/metrics     0/0      DiscoveryFailed  ",
+		"",
+	}, "\n")
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("unexpected table (-want, +got): %s", diff)
+	}
+}
+
+func TestPrintEndpoints(t *testing.T) {
+	var buf bytes.Buffer
+	if err := printEndpoints(&buf, tableTestStatuses, "PodMonitoring/ns1/a/metrics"); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, s := range []string{
+		"Endpoint:           PodMonitoring/ns1/a/metrics",
+		"Status:             Degraded",
+		"Failed collector:   collector-x7k2p: timeout",
+		"Flaps (last hour):  3",
+		"Samples scraped:    120",
+		"Samples kept:       80",
+		"Error (2 targets): context deadline exceeded",
+		`{instance="a-2"}  down`,
+		"Healthy (2 targets)",
+	} {
+		if !strings.Contains(out, s) {
+			t.Errorf("expected output to contain %q:\n%s", s, out)
+		}
+	}
+	if strings.Contains(out, "PodMonitoring/ns1/a/other") {
+		t.Errorf("unexpected other endpoint in output:\n%s", out)
+	}
+
+	// A resource name selects all of its endpoints.
+	buf.Reset()
+	if err := printEndpoints(&buf, tableTestStatuses, "PodMonitoring/ns1/a"); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(buf.String(), "Endpoint:"); got != 2 {
+		t.Errorf("expected 2 endpoints, got %d:\n%s", got, buf.String())
+	}
+	if s := "Error (1 targets, HTTP 503): server returned HTTP status 503"; !strings.Contains(buf.String(), s) {
+		t.Errorf("expected output to contain %q:\n%s", s, buf.String())
+	}
+
+	buf.Reset()
+	if err := printEndpoints(&buf, tableTestStatuses, "PodMonitoring/ns2/d"); err != nil {
+		t.Fatal(err)
+	}
+	if s := "Discovery error:    requests to the Kubernetes API failed"; !strings.Contains(buf.String(), s) {
+		t.Errorf("expected output to contain %q:\n%s", s, buf.String())
+	}
+
+	if err := printEndpoints(&buf, tableTestStatuses, "PodMonitoring/ns1/x"); err == nil {
+		t.Errorf("expected error for unknown endpoint")
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/prometheus/common/model"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+	"github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/generated/clientset/versioned/fake"
+)
+
+func TestTakeSnapshot(t *testing.T) {
+	pm := &monitoringv1.PodMonitoring{
+		ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "ns1"},
+		Status: monitoringv1.PodMonitoringStatus{
+			EndpointStatuses: []monitoringv1.ScrapeEndpointStatus{{
+				Name:             "PodMonitoring/ns1/a/metrics",
+				ActiveTargets:    2,
+				UnhealthyTargets: 1,
+				SampleGroups: []monitoringv1.SampleGroup{{
+					SampleTargets: []monitoringv1.SampleTarget{{
+						Labels:    model.LabelSet{"instance": "x"},
+						Health:    "down",
+						LastError: pointer.String("connection refused"),
+					}},
+				}, {
+					SampleTargets: []monitoringv1.SampleTarget{{
+						Labels: model.LabelSet{"instance": "y"},
+						Health: "up",
+					}},
+				}},
+			}},
+		},
+	}
+	// Target status stored in a dedicated object.
+	pmRef := &monitoringv1.PodMonitoring{
+		ObjectMeta: metav1.ObjectMeta{Name: "b", Namespace: "ns2"},
+		Status: monitoringv1.PodMonitoringStatus{
+			TargetStatusRef: &corev1.LocalObjectReference{Name: "b"},
+		},
+	}
+	pmRefStatus := &monitoringv1.PodMonitoringTargetStatus{
+		ObjectMeta: metav1.ObjectMeta{Name: "b", Namespace: "ns2"},
+		EndpointStatuses: []monitoringv1.ScrapeEndpointStatus{{
+			Name:          "PodMonitoring/ns2/b/metrics",
+			ActiveTargets: 1,
+		}},
+	}
+	cpm := &monitoringv1.ClusterPodMonitoring{
+		ObjectMeta: metav1.ObjectMeta{Name: "c"},
+		Status: monitoringv1.PodMonitoringStatus{
+			EndpointStatuses: []monitoringv1.ScrapeEndpointStatus{{
+				Name:          "ClusterPodMonitoring/c/metrics",
+				ActiveTargets: 3,
+			}},
+		},
+	}
+	client := fake.NewSimpleClientset(pm, pmRef, pmRefStatus, cpm)
+
+	s, err := takeSnapshot(context.Background(), client, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []poolSnapshot{
+		{Name: "ClusterPodMonitoring/c/metrics", ActiveTargets: 3},
+		{
+			Name:             "PodMonitoring/ns1/a/metrics",
+			ActiveTargets:    2,
+			UnhealthyTargets: 1,
+			Unhealthy:        []targetError{{Target: `{instance="x"}`, Error: "connection refused"}},
+		},
+		{Name: "PodMonitoring/ns2/b/metrics", ActiveTargets: 1},
+	}
+	if diff := cmp.Diff(want, s.Pools); diff != "" {
+		t.Errorf("unexpected snapshot (-want, +got): %s", diff)
+	}
+
+	// Namespaced snapshots exclude ClusterPodMonitorings.
+	s, err = takeSnapshot(context.Background(), client, "ns2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want[2:], s.Pools); diff != "" {
+		t.Errorf("unexpected snapshot (-want, +got): %s", diff)
+	}
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	before := &targetSnapshot{Pools: []poolSnapshot{
+		{Name: "PodMonitoring/ns/a/metrics", ActiveTargets: 2},
+		{
+			Name:             "PodMonitoring/ns/b/metrics",
+			ActiveTargets:    2,
+			UnhealthyTargets: 1,
+			Unhealthy:        []targetError{{Target: `{instance="x"}`, Error: "timeout"}},
+		},
+		{Name: "PodMonitoring/ns/c/metrics", ActiveTargets: 1},
+	}}
+
+	cases := []struct {
+		doc       string
+		after     *targetSnapshot
+		want      *targetsDiff
+		regressed bool
+	}{
+		{
+			doc:   "unchanged",
+			after: before,
+			want:  &targetsDiff{},
+		},
+		{
+			doc: "regressed",
+			after: &targetSnapshot{Pools: []poolSnapshot{
+				{
+					Name:             "PodMonitoring/ns/a/metrics",
+					ActiveTargets:    2,
+					UnhealthyTargets: 1,
+					Unhealthy:        []targetError{{Target: `{instance="y"}`, Error: "connection refused"}},
+				},
+				{Name: "PodMonitoring/ns/b/metrics", ActiveTargets: 2},
+				{Name: "PodMonitoring/ns/d/metrics", ActiveTargets: 1},
+			}},
+			want: &targetsDiff{
+				AddedPools:   []string{"PodMonitoring/ns/d/metrics"},
+				RemovedPools: []string{"PodMonitoring/ns/c/metrics"},
+				UnhealthyIncreased: []poolCounts{
+					{Pool: "PodMonitoring/ns/a/metrics", UnhealthyBefore: 0, UnhealthyAfter: 1, ActiveAfter: 2},
+				},
+				NewlyUnhealthy: []poolTarget{
+					{Pool: "PodMonitoring/ns/a/metrics", targetError: targetError{Target: `{instance="y"}`, Error: "connection refused"}},
+				},
+				Recovered: []poolTarget{
+					{Pool: "PodMonitoring/ns/b/metrics", targetError: targetError{Target: `{instance="x"}`}},
+				},
+			},
+			regressed: true,
+		},
+		{
+			doc: "recovered only",
+			after: &targetSnapshot{Pools: []poolSnapshot{
+				{Name: "PodMonitoring/ns/a/metrics", ActiveTargets: 2},
+				{Name: "PodMonitoring/ns/b/metrics", ActiveTargets: 2},
+				{Name: "PodMonitoring/ns/c/metrics", ActiveTargets: 1},
+			}},
+			want: &targetsDiff{
+				Recovered: []poolTarget{
+					{Pool: "PodMonitoring/ns/b/metrics", targetError: targetError{Target: `{instance="x"}`}},
+				},
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.doc, func(t *testing.T) {
+			got := diffSnapshots(before, c.after)
+			if diff := cmp.Diff(c.want, got, cmp.AllowUnexported(poolTarget{}), cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("unexpected diff (-want, +got): %s", diff)
+			}
+			if got.regressed() != c.regressed {
+				t.Errorf("expected regressed=%v", c.regressed)
+			}
+			var buf bytes.Buffer
+			printDiff(&buf, got)
+			if !c.regressed && !strings.Contains(buf.String(), "did not regress") {
+				t.Errorf("unexpected output %q", buf.String())
+			}
+		})
+	}
+}
@@ -75,6 +75,18 @@ func main() {
 			"Address to listen to for incoming kube admission webhook connections.")
 		metricsAddr = flag.String("metrics-addr", ":18080", "Address to emit metrics on.")
 
+		leaderElection = flag.Bool("leader-election", false,
+			"Elect a leader among operator replicas. Only the leader reconciles resources and polls target status. Required to run multiple replicas.")
+
+		collectorTLS = flag.Bool("collector-tls", false,
+			"Make collectors serve over HTTPS with a certificate provisioned by the operator and fetch the target status from them over HTTPS.")
+		collectorTLSServerName = flag.String("collector-tls-server-name", "",
+			"Server name collector certificates are issued for and verified against. Defaults to collector.<operator-namespace>.svc.")
+		collectorAuthTokenFile = flag.String("collector-auth-token-file", "",
+			"File holding a bearer token to authenticate target status requests to collectors.")
+		targetStatusQPS = flag.Float64("target-status-qps", 10,
+			"Maximum number of requests per second to write target status with. Resources whose target health changed are written first.")
+
 		// Permit the operator to cleanup previously-managed resources that
 		// are missing the provided annotation. An empty string disables this
 		// feature.
@@ -112,6 +124,12 @@ func main() {
 		CACert:            *caCert,
 		ListenAddr:        *webhookAddr,
 		CleanupAnnotKey:   *cleanupAnnotKey,
+		LeaderElection:    *leaderElection,
+
+		CollectorTLS:           *collectorTLS,
+		CollectorTLSServerName: *collectorTLSServerName,
+		CollectorAuthTokenFile: *collectorAuthTokenFile,
+		TargetStatusQPS:        *targetStatusQPS,
 	})
 	if err != nil {
 		logger.Error(err, "instantiating operator failed")
@@ -0,0 +1,251 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/GoogleCloudPlatform/prometheus-engine/pkg/export"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/storage"
+)
+
+const (
+	// backfillMaxSteps is the maximum number of evaluation steps of a single range
+	// query, which keeps results below the maximum number of points per series.
+	backfillMaxSteps = 10000
+	// backfillFlushSamples is the number of samples after which the backfill waits for
+	// the results to be written, so that the export queues cannot overflow.
+	backfillFlushSamples = 2000
+)
+
+// backfiller evaluates recording rules over a past time range and writes their results.
+type backfiller struct {
+	logger     log.Logger
+	queryRange func(ctx context.Context, q string, r v1.Range, opts ...v1.Option) (model.Value, v1.Warnings, error)
+	appendable storage.Appendable
+	// flush blocks until all appended samples have been written.
+	flush func(ctx context.Context) error
+}
+
+// backfill evaluates the recording rules of the rule groups at every evaluation of
+// their group between start and end. Groups without an interval are evaluated at the
+// given default interval. Alerting rules are skipped.
+func (b *backfiller) backfill(ctx context.Context, groups []rulefmt.RuleGroup, interval time.Duration, start, end time.Time) error {
+	for _, g := range groups {
+		itv := interval
+		if g.Interval != 0 {
+			itv = time.Duration(g.Interval)
+		}
+		for _, r := range g.Rules {
+			if r.Record.Value == "" {
+				continue
+			}
+			n, err := b.backfillRule(ctx, r, itv, start, end)
+			if err != nil {
+				return fmt.Errorf("group %q, rule %q: %w", g.Name, r.Record.Value, err)
+			}
+			level.Info(b.logger).Log("msg", "Backfilled recording rule", "group", g.Name, "rule", r.Record.Value, "samples", n)
+		}
+	}
+	return nil
+}
+
+// backfillRule evaluates the recording rule with range queries of at most backfillMaxSteps
+// steps and appends the results in order of time. It returns the number of appended samples.
+func (b *backfiller) backfillRule(ctx context.Context, r rulefmt.RuleNode, interval time.Duration, start, end time.Time) (int, error) {
+	var total int
+
+	for chunkStart := start; !chunkStart.After(end); chunkStart = chunkStart.Add(backfillMaxSteps * interval) {
+		chunkEnd := chunkStart.Add((backfillMaxSteps - 1) * interval)
+		if chunkEnd.After(end) {
+			chunkEnd = end
+		}
+		v, warnings, err := b.queryRange(ctx, r.Expr.Value, v1.Range{Start: chunkStart, End: chunkEnd, Step: interval})
+		if len(warnings) > 0 {
+			level.Warn(b.logger).Log("msg", "Querying Prometheus instance returned warnings", "warn", warnings)
+		}
+		if err != nil {
+			return total, fmt.Errorf("query range: %w", err)
+		}
+		m, ok := v.(model.Matrix)
+		if !ok {
+			return total, fmt.Errorf("expected matrix result, got %s", v.Type())
+		}
+		n, err := b.appendMatrix(ctx, r, m)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// appendMatrix appends the range query result of the recording rule. Samples of all series
+// are appended in order of their timestamp, so that waiting for samples to be written
+// never blocks on a single series with many samples.
+func (b *backfiller) appendMatrix(ctx context.Context, r rulefmt.RuleNode, m model.Matrix) (int, error) {
+	lsets := make([]labels.Labels, len(m))
+	for i, s := range m {
+		lsets[i] = recordedLabels(s.Metric, r)
+	}
+	next := make([]int, len(m))
+
+	var total, pending int
+	app := b.appendable.Appender(ctx)
+
+	for {
+		// Find the earliest timestamp of the remaining samples.
+		var t model.Time
+		found := false
+		for i, s := range m {
+			if next[i] < len(s.Values) && (!found || s.Values[next[i]].Timestamp < t) {
+				t, found = s.Values[next[i]].Timestamp, true
+			}
+		}
+		if !found {
+			break
+		}
+		for i, s := range m {
+			if next[i] >= len(s.Values) || s.Values[next[i]].Timestamp != t {
+				continue
+			}
+			if _, err := app.Append(0, lsets[i], int64(t), float64(s.Values[next[i]].Value)); err != nil {
+				app.Rollback()
+				return total, fmt.Errorf("append: %w", err)
+			}
+			next[i]++
+			pending++
+		}
+		if pending < backfillFlushSamples {
+			continue
+		}
+		if err := b.commit(ctx, app); err != nil {
+			return total, err
+		}
+		total += pending
+		pending = 0
+		app = b.appendable.Appender(ctx)
+	}
+	if err := b.commit(ctx, app); err != nil {
+		return total, err
+	}
+	return total + pending, nil
+}
+
+func (b *backfiller) commit(ctx context.Context, app storage.Appender) error {
+	if err := app.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	if err := b.flush(ctx); err != nil {
+		return fmt.Errorf("flush: %w", err)
+	}
+	return nil
+}
+
+// recordedLabels returns the labels of the series the recording rule records for a
+// series of its query result, the same as they are set when evaluating the rule.
+func recordedLabels(metric model.Metric, r rulefmt.RuleNode) labels.Labels {
+	lb := labels.NewBuilder(convertMetricToLabel(metric))
+	lb.Set(labels.MetricName, r.Record.Value)
+	for k, v := range r.Labels {
+		lb.Set(k, v)
+	}
+	return lb.Labels(nil)
+}
+
+// parseTime parses a time given as RFC3339 or as Unix timestamp in seconds.
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Unix(0, int64(f*float64(time.Second))), nil
+	}
+	return time.Time{}, fmt.Errorf("cannot parse %q as RFC3339 or Unix timestamp", s)
+}
+
+// exporterIdle is implemented by the exporter to report whether all samples passed
+// to it were written.
+type exporterIdle interface {
+	Idle() bool
+}
+
+// waitIdle returns a function that blocks until the exporter wrote all samples.
+func waitIdle(e exporterIdle) func(context.Context) error {
+	return func(ctx context.Context) error {
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+
+		for !e.Idle() {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-ticker.C:
+			}
+		}
+		return nil
+	}
+}
+
+// runBackfill backfills the recording rules of the rule files between start and end
+// and writes their results with the export storage, which it configures from the
+// configuration file.
+func runBackfill(logger log.Logger, api v1.API, exporter exporterIdle, destination *export.Storage, configFile string, files []string, start, end string, interval time.Duration) error {
+	startTime, err := parseTime(start)
+	if err != nil {
+		return fmt.Errorf("invalid start: %w", err)
+	}
+	endTime := time.Now()
+	if end != "" {
+		if endTime, err = parseTime(end); err != nil {
+			return fmt.Errorf("invalid end: %w", err)
+		}
+	}
+	if !startTime.Before(endTime) {
+		return fmt.Errorf("start %s must be before end %s", startTime, endTime)
+	}
+	var groups []rulefmt.RuleGroup
+	for _, f := range files {
+		rgs, errs := (ruleLoader{}).Load(f)
+		if len(errs) > 0 {
+			return fmt.Errorf("load rule file: %w", errors.Join(errs...))
+		}
+		groups = append(groups, rgs.Groups...)
+	}
+	if err := reloadConfig(configFile, logger, reloader{name: "exporter", reloader: destination.ApplyConfig}); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go destination.Run(ctx)
+
+	b := &backfiller{
+		logger:     logger,
+		queryRange: api.QueryRange,
+		appendable: destination,
+		flush:      waitIdle(exporter),
+	}
+	return b.backfill(ctx, groups, interval, startTime, endTime)
+}
@@ -0,0 +1,169 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/google/go-cmp/cmp"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/exemplar"
+	"github.com/prometheus/prometheus/model/histogram"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/metadata"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/storage"
+	"gopkg.in/yaml.v3"
+)
+
+type backfillSample struct {
+	Labels string
+	T      int64
+	V      float64
+}
+
+// backfillAppendable records the samples that were committed.
+type backfillAppendable struct {
+	committed []backfillSample
+}
+
+func (a *backfillAppendable) Appender(context.Context) storage.Appender {
+	return &backfillAppender{a: a}
+}
+
+type backfillAppender struct {
+	a       *backfillAppendable
+	samples []backfillSample
+}
+
+func (a *backfillAppender) Append(_ storage.SeriesRef, lset labels.Labels, t int64, v float64) (storage.SeriesRef, error) {
+	a.samples = append(a.samples, backfillSample{lset.String(), t, v})
+	return 0, nil
+}
+
+func (a *backfillAppender) Commit() error {
+	a.a.committed = append(a.a.committed, a.samples...)
+	return nil
+}
+
+func (a *backfillAppender) Rollback() error { return nil }
+
+func (a *backfillAppender) AppendExemplar(storage.SeriesRef, labels.Labels, exemplar.Exemplar) (storage.SeriesRef, error) {
+	return 0, nil
+}
+
+func (a *backfillAppender) AppendHistogram(storage.SeriesRef, labels.Labels, int64, *histogram.Histogram) (storage.SeriesRef, error) {
+	return 0, nil
+}
+
+func (a *backfillAppender) UpdateMetadata(storage.SeriesRef, labels.Labels, metadata.Metadata) (storage.SeriesRef, error) {
+	return 0, nil
+}
+
+func TestBackfill(t *testing.T) {
+	var groups rulefmt.RuleGroups
+	if err := yaml.Unmarshal([]byte(`
+groups:
+- name: test
+  interval: 10s
+  rules:
+  - record: job:up:sum
+    expr: sum by(job) (up)
+    labels:
+      source: backfill
+  - alert: Down
+    expr: up == 0
+`), &groups); err != nil {
+		t.Fatal(err)
+	}
+
+	var ranges []v1.Range
+	queryRange := func(_ context.Context, q string, r v1.Range, _ ...v1.Option) (model.Value, v1.Warnings, error) {
+		if q != "sum by(job) (up)" {
+			t.Errorf("unexpected query %q", q)
+		}
+		ranges = append(ranges, r)
+		// The series of job b starts later.
+		return model.Matrix{
+			{
+				Metric: model.Metric{"job": "a"},
+				Values: []model.SamplePair{{Timestamp: 1000, Value: 1}, {Timestamp: 11000, Value: 2}},
+			}, {
+				Metric: model.Metric{"job": "b"},
+				Values: []model.SamplePair{{Timestamp: 11000, Value: 3}},
+			},
+		}, nil, nil
+	}
+	app := &backfillAppendable{}
+	var flushes int
+	b := &backfiller{
+		logger:     log.NewNopLogger(),
+		queryRange: queryRange,
+		appendable: app,
+		flush: func(context.Context) error {
+			flushes++
+			return nil
+		},
+	}
+	start := time.Unix(1, 0)
+	end := start.Add(backfillMaxSteps * 10 * time.Second)
+
+	if err := b.backfill(context.Background(), groups.Groups, time.Minute, start, end); err != nil {
+		t.Fatal(err)
+	}
+	// The time range has one more step than fits into a single query.
+	wantRanges := []v1.Range{
+		{Start: start, End: start.Add((backfillMaxSteps - 1) * 10 * time.Second), Step: 10 * time.Second},
+		{Start: end, End: end, Step: 10 * time.Second},
+	}
+	if diff := cmp.Diff(wantRanges, ranges); diff != "" {
+		t.Errorf("unexpected query ranges (-want, +got): %s", diff)
+	}
+	if flushes != 2 {
+		t.Errorf("expected 2 flushes, got %d", flushes)
+	}
+	seriesA := `{__name__="job:up:sum", job="a", source="backfill"}`
+	seriesB := `{__name__="job:up:sum", job="b", source="backfill"}`
+	want := []backfillSample{
+		{seriesA, 1000, 1}, {seriesA, 11000, 2}, {seriesB, 11000, 3},
+		{seriesA, 1000, 1}, {seriesA, 11000, 2}, {seriesB, 11000, 3},
+	}
+	if diff := cmp.Diff(want, app.committed); diff != "" {
+		t.Errorf("unexpected samples (-want, +got): %s", diff)
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	for s, want := range map[string]time.Time{
+		"2023-05-01T10:00:00Z": time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC),
+		"1682935200":           time.Unix(1682935200, 0),
+		"1682935200.5":         time.Unix(1682935200, 5e8),
+	} {
+		got, err := parseTime(s)
+		if err != nil {
+			t.Fatalf("parse %q: %s", s, err)
+		}
+		if !got.Equal(want) {
+			t.Errorf("parse %q: expected %s, got %s", s, want, got)
+		}
+	}
+	if _, err := parseTime("yesterday"); err == nil {
+		t.Errorf("expected error for invalid time")
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/rules"
+)
+
+var (
+	evaluationDelay = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "rule_evaluator_evaluation_delay_seconds",
+		Help: "Delay by which all rule queries are evaluated before the evaluation time.",
+	})
+	ruleGroupQueryOffset = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rule_evaluator_rule_group_query_offset_seconds",
+		Help: "Query offset of rule groups, by which the selectors of their rules are offset in addition to the evaluation delay.",
+	}, []string{"file", "rule_group"})
+	queryStaleness = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "rule_evaluator_query_staleness_seconds",
+		Help:    "Age of the time rule queries are evaluated at when they are sent, i.e. the evaluation delay plus how late the evaluation ran. Query offsets of rule groups add to it.",
+		Buckets: []float64{1, 5, 10, 30, 60, 120, 300, 600},
+	})
+)
+
+// delayQueryFunc returns a query function that evaluates queries the delay before the
+// evaluation time, e.g. to compensate for the latency of exporting and ingesting data
+// into GCM, and records the staleness of the queried data.
+func delayQueryFunc(query rules.QueryFunc, delay time.Duration) rules.QueryFunc {
+	evaluationDelay.Set(delay.Seconds())
+
+	return func(ctx context.Context, q string, t time.Time) (promql.Vector, error) {
+		t = t.Add(-delay)
+		queryStaleness.Observe(time.Since(t).Seconds())
+		return query(ctx, q, t)
+	}
+}
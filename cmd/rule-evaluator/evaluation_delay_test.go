@@ -0,0 +1,43 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/promql"
+)
+
+func TestDelayQueryFunc(t *testing.T) {
+	var got time.Time
+	query := delayQueryFunc(func(_ context.Context, _ string, t time.Time) (promql.Vector, error) {
+		got = t
+		return nil, nil
+	}, time.Minute)
+
+	if v := testutil.ToFloat64(evaluationDelay); v != 60 {
+		t.Errorf("expected evaluation delay of 60s, got %v", v)
+	}
+	now := time.Now()
+	if _, err := query(context.Background(), "up", now); err != nil {
+		t.Fatal(err)
+	}
+	if want := now.Add(-time.Minute); !got.Equal(want) {
+		t.Errorf("expected query time %s, got %s", want, got)
+	}
+}
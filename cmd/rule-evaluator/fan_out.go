@@ -0,0 +1,123 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/rules"
+)
+
+// projectLabel is the label that determines the project rule results are written to.
+const projectLabel = "project_id"
+
+// fanOutRuleLoader loads the rules of a rule file that a rule manager evaluates when
+// rules are fanned out across projects.
+//
+// Rules that set the project label are pinned to a project, e.g. rules generated for
+// Rules and ClusterRules resources, and keep being evaluated against the scoping project
+// only. All other rules are evaluated against each fan-out project and get the project
+// label set to it, so that their results are written to and their alerts identify
+// the project.
+type fanOutRuleLoader struct {
+	ruleLoader
+	// project is the fan-out project the rules are evaluated against. If empty, only
+	// the rules pinned to a project are loaded.
+	project string
+}
+
+func (l fanOutRuleLoader) Load(identifier string) (*rulefmt.RuleGroups, []error) {
+	rgs, errs := l.ruleLoader.Load(identifier)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	groups := rgs.Groups[:0]
+
+	for _, g := range rgs.Groups {
+		var rs []rulefmt.RuleNode
+		for _, r := range g.Rules {
+			_, pinned := r.Labels[projectLabel]
+			if pinned != (l.project == "") {
+				continue
+			}
+			if l.project != "" {
+				lset := make(map[string]string, len(r.Labels)+1)
+				for k, v := range r.Labels {
+					lset[k] = v
+				}
+				lset[projectLabel] = l.project
+				r.Labels = lset
+			}
+			rs = append(rs, r)
+		}
+		// Drop groups whose rules are all evaluated by other rule managers.
+		if len(rs) == 0 {
+			continue
+		}
+		g.Rules = rs
+		groups = append(groups, g)
+	}
+	rgs.Groups = groups
+	return rgs, nil
+}
+
+// ruleManagers evaluates the same rule files with several rule managers, one per
+// project the rules are evaluated against.
+type ruleManagers []*rules.Manager
+
+// Update updates the rules of all rule managers. Rule managers that fail to load the
+// rules keep their previous rule set.
+func (ms ruleManagers) Update(interval time.Duration, files []string, externalLabels labels.Labels, externalURL string, ruleGroupPostProcessFunc rules.RuleGroupPostProcessFunc) error {
+	var errs []error
+	for _, m := range ms {
+		if err := m.Update(interval, files, externalLabels, externalURL, ruleGroupPostProcessFunc); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Run runs all rule managers and blocks until they are stopped.
+func (ms ruleManagers) Run() {
+	var wg sync.WaitGroup
+	for _, m := range ms {
+		wg.Add(1)
+		go func(m *rules.Manager) {
+			defer wg.Done()
+			m.Run()
+		}(m)
+	}
+	wg.Wait()
+}
+
+// Stop stops all rule managers.
+func (ms ruleManagers) Stop() {
+	for _, m := range ms {
+		m.Stop()
+	}
+}
+
+// RuleGroups returns the rule groups of all rule managers.
+func (ms ruleManagers) RuleGroups() []*rules.Group {
+	var groups []*rules.Group
+	for _, m := range ms {
+		groups = append(groups, m.RuleGroups()...)
+	}
+	return groups
+}
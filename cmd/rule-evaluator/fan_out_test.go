@@ -0,0 +1,86 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/prometheus/model/rulefmt"
+)
+
+func TestFanOutRuleLoader(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "rules.yaml")
+	if err := os.WriteFile(file, []byte(`
+groups:
+- name: mixed
+  rules:
+  - record: job:up:sum
+    expr: sum by(job) (up)
+  - alert: Down
+    expr: up{project_id="p0"} == 0
+    labels:
+      project_id: p0
+- name: global
+  rules:
+  - alert: Down
+    expr: up == 0
+    labels:
+      severity: page
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	type rule struct {
+		Name   string
+		Labels map[string]string
+	}
+	load := func(l fanOutRuleLoader) map[string][]rule {
+		rgs, errs := l.Load(file)
+		if len(errs) > 0 {
+			t.Fatalf("unexpected errors: %v", errs)
+		}
+		got := map[string][]rule{}
+		for _, g := range rgs.Groups {
+			for _, r := range g.Rules {
+				got[g.Name] = append(got[g.Name], rule{Name: ruleName(r), Labels: r.Labels})
+			}
+		}
+		return got
+	}
+
+	// Only rules pinned to a project are evaluated against the scoping project.
+	if diff := cmp.Diff(map[string][]rule{
+		"mixed": {{Name: "Down", Labels: map[string]string{"project_id": "p0"}}},
+	}, load(fanOutRuleLoader{})); diff != "" {
+		t.Errorf("unexpected pinned rules (-want, +got): %s", diff)
+	}
+	// All other rules are evaluated against each project and labeled with it.
+	if diff := cmp.Diff(map[string][]rule{
+		"mixed":  {{Name: "job:up:sum", Labels: map[string]string{"project_id": "p1"}}},
+		"global": {{Name: "Down", Labels: map[string]string{"project_id": "p1", "severity": "page"}}},
+	}, load(fanOutRuleLoader{project: "p1"})); diff != "" {
+		t.Errorf("unexpected fan-out rules (-want, +got): %s", diff)
+	}
+}
+
+func ruleName(r rulefmt.RuleNode) string {
+	if r.Alert.Value != "" {
+		return r.Alert.Value
+	}
+	return r.Record.Value
+}
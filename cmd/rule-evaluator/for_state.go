@@ -0,0 +1,183 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/rules"
+	"github.com/prometheus/prometheus/storage"
+)
+
+// alertForStateMetricName is the name of the series the 'for' state of alerts is
+// stored as, the same as in Prometheus.
+const alertForStateMetricName = "ALERTS_FOR_STATE"
+
+var forStateSaveFailures = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "rule_evaluator_for_state_save_failures_total",
+	Help: "Number of times saving the 'for' state of alerts to --rules.alert.for-state-file failed.",
+})
+
+// forStateSeries is the ALERTS_FOR_STATE sample of an active alert.
+type forStateSeries struct {
+	Labels labels.Labels `json:"labels"`
+	// Timestamp at which the state was saved in milliseconds.
+	Timestamp int64 `json:"timestamp"`
+	// Time the alert became active as Unix timestamp in seconds.
+	ActiveAt int64 `json:"activeAt"`
+}
+
+// forStateFile persists the 'for' state of active alerts to a local file. At startup,
+// the rule managers restore the state from it instead of from the ALERTS_FOR_STATE
+// series in GCM, which may not be ingested yet or not be written at all, e.g. while
+// the replica is not the HA leader.
+type forStateFile struct {
+	path string
+
+	// Guards series, which is replaced on every save.
+	mtx    sync.Mutex
+	series []forStateSeries
+}
+
+// loadForStateFile returns the state persisted in the file. A missing file holds
+// no state.
+func loadForStateFile(path string) (*forStateFile, error) {
+	f := &forStateFile{path: path}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return f, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &f.series); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", path, err)
+	}
+	return f, nil
+}
+
+// save writes the ALERTS_FOR_STATE series of the active alerts of the rule groups
+// to the file. Subsequent queries return the saved series.
+func (f *forStateFile) save(groups []*rules.Group, now time.Time) error {
+	var series []forStateSeries
+
+	for _, g := range groups {
+		for _, r := range g.Rules() {
+			ar, ok := r.(*rules.AlertingRule)
+			if !ok {
+				continue
+			}
+			ar.ForEachActiveAlert(func(a *rules.Alert) {
+				lb := labels.NewBuilder(a.Labels)
+				lb.Set(labels.MetricName, alertForStateMetricName)
+				series = append(series, forStateSeries{
+					Labels:    lb.Labels(nil),
+					Timestamp: now.UnixMilli(),
+					ActiveAt:  a.ActiveAt.Unix(),
+				})
+			})
+		}
+	}
+	b, err := json.Marshal(series)
+	if err != nil {
+		return err
+	}
+	// Replace the file atomically so that a crash does not leave partial state behind.
+	if err := writeFileAtomic(f.path, b); err != nil {
+		return err
+	}
+	f.mtx.Lock()
+	f.series = series
+	f.mtx.Unlock()
+	return nil
+}
+
+// Querier returns a querier over the state loaded from the file.
+func (f *forStateFile) Querier(_ context.Context, mint, maxt int64) (storage.Querier, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	var series []forStateSeries
+	for _, s := range f.series {
+		if s.Timestamp >= mint && s.Timestamp <= maxt {
+			series = append(series, s)
+		}
+	}
+	return &forStateQuerier{series: series}, nil
+}
+
+// forStateQuerier implements storage.Querier.
+type forStateQuerier struct {
+	// storage.LabelQuerier satisfies the interface. Calling related methods will result in panic.
+	storage.LabelQuerier
+	series []forStateSeries
+}
+
+// Select returns the series that match all matchers.
+func (q *forStateQuerier) Select(_ bool, _ *storage.SelectHints, matchers ...*labels.Matcher) storage.SeriesSet {
+	var m promql.Matrix
+Outer:
+	for _, s := range q.series {
+		for _, matcher := range matchers {
+			if !matcher.Matches(s.Labels.Get(matcher.Name)) {
+				continue Outer
+			}
+		}
+		m = append(m, promql.Series{
+			Metric: s.Labels,
+			Points: []promql.Point{{T: s.Timestamp, V: float64(s.ActiveAt)}},
+		})
+	}
+	return newListSeriesSet(m, nil, nil)
+}
+
+func (q *forStateQuerier) Close() error {
+	return nil
+}
+
+// runForStateFile periodically saves the 'for' state of the alerts of the rule
+// managers to the file until the context is canceled, and once more after that.
+func runForStateFile(ctx context.Context, logger log.Logger, f *forStateFile, m ruleGroupLister, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		done := false
+		select {
+		case <-ctx.Done():
+			done = true
+		case <-ticker.C:
+		}
+		if err := f.save(m.RuleGroups(), time.Now()); err != nil {
+			level.Error(logger).Log("msg", "Saving 'for' state of alerts failed", "file", f.path, "err", err)
+			forStateSaveFailures.Inc()
+		}
+		if done {
+			return
+		}
+	}
+}
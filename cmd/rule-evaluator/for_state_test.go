@@ -0,0 +1,107 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/rules"
+)
+
+func TestForStateFile(t *testing.T) {
+	now := time.Unix(10000, 0).UTC()
+	a := labels.FromStrings("instance", "a")
+	b := labels.FromStrings("instance", "b")
+	path := filepath.Join(t.TempDir(), "for_state.json")
+
+	// A missing file holds no state.
+	f, err := loadForStateFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The state is saved one minute before the restart, with alerts that had been
+	// pending for four minutes by then.
+	before, _ := newTestAlertingGroup(t, now.Add(-5*time.Minute), a, b)
+	if err := f.save([]*rules.Group{before}, now.Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	// Queries return the saved state without reloading the file, e.g. when rule groups
+	// are restored after a config reload.
+	q, err := f.Querier(context.Background(), 0, now.UnixMilli())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved int
+	for ss := q.Select(false, nil); ss.Next(); {
+		saved++
+	}
+	if saved != 2 {
+		t.Errorf("expected 2 saved series, got %d", saved)
+	}
+
+	f, err = loadForStateFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, rule := newTestAlertingGroup(t, now, a)
+	g := rules.NewGroup(rules.GroupOptions{
+		Name:     "group",
+		File:     "rules.yaml",
+		Interval: time.Minute,
+		Rules:    []rules.Rule{rule},
+		Opts: &rules.ManagerOptions{
+			Context:         context.Background(),
+			Queryable:       f,
+			Logger:          log.NewNopLogger(),
+			Registerer:      prometheus.NewRegistry(),
+			OutageTolerance: time.Hour,
+		},
+	})
+	g.RestoreForState(now)
+
+	// The pending time is restored without the time the rule evaluator was down.
+	want := map[string]time.Time{"a": now.Add(-4 * time.Minute)}
+	if diff := cmp.Diff(want, activeAtByInstance(rule)); diff != "" {
+		t.Errorf("unexpected active times (-want, +got): %s", diff)
+	}
+
+	// State saved before the outage tolerance is not restored.
+	_, rule = newTestAlertingGroup(t, now, a)
+	g = rules.NewGroup(rules.GroupOptions{
+		Name:     "group",
+		File:     "rules.yaml",
+		Interval: time.Minute,
+		Rules:    []rules.Rule{rule},
+		Opts: &rules.ManagerOptions{
+			Context:         context.Background(),
+			Queryable:       f,
+			Logger:          log.NewNopLogger(),
+			Registerer:      prometheus.NewRegistry(),
+			OutageTolerance: 30 * time.Second,
+		},
+	})
+	g.RestoreForState(now)
+
+	if diff := cmp.Diff(map[string]time.Time{"a": now}, activeAtByInstance(rule)); diff != "" {
+		t.Errorf("unexpected active times (-want, +got): %s", diff)
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/rules"
+	"github.com/prometheus/prometheus/storage"
+)
+
+var (
+	ruleGroupEvaluationLagDesc = prometheus.NewDesc(
+		"rule_evaluator_rule_group_evaluation_lag_seconds",
+		"Time by which the next evaluation of the rule group is overdue, i.e. the time since its last evaluation minus its interval. It keeps growing while evaluations fall behind.",
+		[]string{"file", "rule_group"}, nil,
+	)
+	ruleGroupDurationRatioDesc = prometheus.NewDesc(
+		"rule_evaluator_rule_group_duration_ratio",
+		"Duration of the last evaluation of the rule group relative to its interval. Evaluations are missed once it exceeds 1.",
+		[]string{"file", "rule_group"}, nil,
+	)
+	ruleGroupUnhealthyRulesDesc = prometheus.NewDesc(
+		"rule_evaluator_rule_group_unhealthy_rules",
+		"Number of rules of the rule group whose last evaluation failed.",
+		[]string{"file", "rule_group"}, nil,
+	)
+)
+
+// ruleGroupHealthCollector collects the evaluation health of the rule groups of a
+// rule manager.
+type ruleGroupHealthCollector struct {
+	m ruleGroupLister
+}
+
+func newRuleGroupHealthCollector(m ruleGroupLister) *ruleGroupHealthCollector {
+	return &ruleGroupHealthCollector{m: m}
+}
+
+func (c *ruleGroupHealthCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- ruleGroupEvaluationLagDesc
+	ch <- ruleGroupDurationRatioDesc
+	ch <- ruleGroupUnhealthyRulesDesc
+}
+
+func (c *ruleGroupHealthCollector) Collect(ch chan<- prometheus.Metric) {
+	now := time.Now()
+
+	for _, g := range c.m.RuleGroups() {
+		var unhealthy int
+		for _, r := range g.Rules() {
+			if r.Health() == rules.HealthBad {
+				unhealthy++
+			}
+		}
+		ch <- prometheus.MustNewConstMetric(ruleGroupUnhealthyRulesDesc, prometheus.GaugeValue, float64(unhealthy), g.File(), g.Name())
+
+		// Groups that were not evaluated yet have no lag or duration.
+		last := g.GetLastEvaluation()
+		if last.IsZero() {
+			continue
+		}
+		lag := math.Max(0, (now.Sub(last) - g.Interval()).Seconds())
+		ch <- prometheus.MustNewConstMetric(ruleGroupEvaluationLagDesc, prometheus.GaugeValue, lag, g.File(), g.Name())
+		ch <- prometheus.MustNewConstMetric(ruleGroupDurationRatioDesc, prometheus.GaugeValue, g.GetEvaluationTime().Seconds()/g.Interval().Seconds(), g.File(), g.Name())
+	}
+}
+
+// appendGathered appends the current values of the gathered metrics at the given
+// timestamp. Summaries and histograms are appended as their sum and count.
+func appendGathered(app storage.Appender, mfs []*dto.MetricFamily, t int64) error {
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			lb := labels.NewBuilder(nil)
+			for _, lp := range m.GetLabel() {
+				lb.Set(lp.GetName(), lp.GetValue())
+			}
+			values := map[string]float64{}
+
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				values[mf.GetName()] = m.GetCounter().GetValue()
+			case dto.MetricType_GAUGE:
+				values[mf.GetName()] = m.GetGauge().GetValue()
+			case dto.MetricType_UNTYPED:
+				values[mf.GetName()] = m.GetUntyped().GetValue()
+			case dto.MetricType_SUMMARY:
+				values[mf.GetName()+"_sum"] = m.GetSummary().GetSampleSum()
+				values[mf.GetName()+"_count"] = float64(m.GetSummary().GetSampleCount())
+			case dto.MetricType_HISTOGRAM:
+				values[mf.GetName()+"_sum"] = m.GetHistogram().GetSampleSum()
+				values[mf.GetName()+"_count"] = float64(m.GetHistogram().GetSampleCount())
+			}
+			for name, v := range values {
+				lb.Set(labels.MetricName, name)
+				if _, err := app.Append(0, lb.Labels(nil), t, v); err != nil {
+					return fmt.Errorf("append %s: %w", name, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// exportRuleGroupMetrics periodically writes the gathered rule group metrics through
+// the appendable, e.g. to GCM, until the context is canceled.
+func exportRuleGroupMetrics(ctx context.Context, logger log.Logger, g prometheus.Gatherer, app storage.Appendable, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		mfs, err := g.Gather()
+		if err != nil {
+			level.Warn(logger).Log("msg", "Gathering rule group metrics failed", "err", err)
+			continue
+		}
+		a := app.Appender(ctx)
+		if err := appendGathered(a, mfs, time.Now().UnixMilli()); err != nil {
+			level.Warn(logger).Log("msg", "Appending rule group metrics failed", "err", err)
+			a.Rollback()
+			continue
+		}
+		if err := a.Commit(); err != nil {
+			level.Warn(logger).Log("msg", "Exporting rule group metrics failed", "err", err)
+		}
+	}
+}
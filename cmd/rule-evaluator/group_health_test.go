@@ -0,0 +1,90 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/rules"
+)
+
+func TestRuleGroupHealthCollector(t *testing.T) {
+	g, rule := newTestAlertingGroup(t, time.Unix(10000, 0), labels.FromStrings("instance", "a"))
+	rule.SetHealth(rules.HealthBad)
+
+	c := newRuleGroupHealthCollector(groupList{g})
+
+	// Lag and duration are only reported once the group was evaluated.
+	want := `
+# HELP rule_evaluator_rule_group_unhealthy_rules Number of rules of the rule group whose last evaluation failed.
+# TYPE rule_evaluator_rule_group_unhealthy_rules gauge
+rule_evaluator_rule_group_unhealthy_rules{file="rules.yaml",rule_group="group"} 1
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+}
+
+// groupList lists a fixed set of rule groups.
+type groupList []*rules.Group
+
+func (l groupList) RuleGroups() []*rules.Group {
+	return l
+}
+
+func TestAppendGathered(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "lag"}, []string{"rule_group"})
+	gauge.WithLabelValues("g1").Set(3)
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "failures_total"})
+	counter.Add(2)
+	summary := prometheus.NewSummary(prometheus.SummaryOpts{Name: "duration_seconds"})
+	summary.Observe(0.5)
+	summary.Observe(1.5)
+	reg.MustRegister(gauge, counter, summary)
+
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := &backfillAppendable{}
+	a := app.Appender(context.Background())
+	if err := appendGathered(a, mfs, 1000); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	sort.Slice(app.committed, func(i, j int) bool {
+		return app.committed[i].Labels < app.committed[j].Labels
+	})
+	want := []backfillSample{
+		{`{__name__="duration_seconds_count"}`, 1000, 2},
+		{`{__name__="duration_seconds_sum"}`, 1000, 2},
+		{`{__name__="failures_total"}`, 1000, 2},
+		{`{__name__="lag", rule_group="g1"}`, 1000, 3},
+	}
+	if diff := cmp.Diff(want, app.committed); diff != "" {
+		t.Errorf("unexpected samples (-want, +got): %s", diff)
+	}
+}
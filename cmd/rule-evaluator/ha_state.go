@@ -0,0 +1,278 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/rules"
+)
+
+// Path under which the alerting state is served to the peer replica.
+const haStatePath = "/api/v1/ha/state"
+
+var haStateRestoredAlerts = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "rule_evaluator_ha_state_restored_alerts_total",
+	Help: "Number of pending alerts whose active time was taken over from the peer replica.",
+})
+
+// haState is the alerting state of all rule groups of a rule-evaluator replica.
+type haState struct {
+	Groups []haGroupState `json:"groups"`
+}
+
+type haGroupState struct {
+	File           string         `json:"file"`
+	Name           string         `json:"name"`
+	LastEvaluation time.Time      `json:"lastEvaluation"`
+	Alerts         []haAlertState `json:"alerts,omitempty"`
+}
+
+type haAlertState struct {
+	Rule     string        `json:"rule"`
+	Labels   labels.Labels `json:"labels"`
+	State    string        `json:"state"`
+	ActiveAt time.Time     `json:"activeAt"`
+}
+
+// buildHAState returns the current alerting state of the rule groups.
+func buildHAState(groups []*rules.Group) *haState {
+	var s haState
+
+	for _, g := range groups {
+		gs := haGroupState{
+			File:           g.File(),
+			Name:           g.Name(),
+			LastEvaluation: g.GetLastEvaluation(),
+		}
+		for _, r := range g.Rules() {
+			ar, ok := r.(*rules.AlertingRule)
+			if !ok {
+				continue
+			}
+			ar.ForEachActiveAlert(func(a *rules.Alert) {
+				gs.Alerts = append(gs.Alerts, haAlertState{
+					Rule:     ar.Name(),
+					Labels:   a.Labels,
+					State:    a.State.String(),
+					ActiveAt: a.ActiveAt,
+				})
+			})
+		}
+		s.Groups = append(s.Groups, gs)
+	}
+	return &s
+}
+
+// restoreHAState moves the active time of pending alerts back to the one of the same
+// alert of the peer, so that alerts the peer has been tracking for longer do not start
+// over in pending state on this replica, e.g. after it restarted or took over leadership.
+// Groups the peer has not evaluated within two of their intervals are considered stale
+// and ignored. It returns the number of updated alerts.
+func restoreHAState(groups []*rules.Group, peer *haState, now time.Time) int {
+	type groupKey struct{ file, name string }
+	type alertKey struct {
+		rule string
+		hash uint64
+	}
+	type peerGroup struct {
+		lastEvaluation time.Time
+		alerts         map[alertKey]time.Time
+	}
+	peerGroups := map[groupKey]peerGroup{}
+
+	for _, g := range peer.Groups {
+		pg := peerGroup{
+			lastEvaluation: g.LastEvaluation,
+			alerts:         map[alertKey]time.Time{},
+		}
+		for _, a := range g.Alerts {
+			pg.alerts[alertKey{a.Rule, a.Labels.Hash()}] = a.ActiveAt
+		}
+		peerGroups[groupKey{g.File, g.Name}] = pg
+	}
+
+	var restored int
+	for _, g := range groups {
+		pg, ok := peerGroups[groupKey{g.File(), g.Name()}]
+		if !ok || now.Sub(pg.lastEvaluation) > 2*g.Interval() {
+			continue
+		}
+		for _, r := range g.Rules() {
+			ar, ok := r.(*rules.AlertingRule)
+			if !ok {
+				continue
+			}
+			ar.ForEachActiveAlert(func(a *rules.Alert) {
+				if a.State != rules.StatePending {
+					return
+				}
+				activeAt, ok := pg.alerts[alertKey{ar.Name(), a.Labels.Hash()}]
+				if ok && activeAt.Before(a.ActiveAt) {
+					a.ActiveAt = activeAt
+					restored++
+				}
+			})
+		}
+	}
+	return restored
+}
+
+// ruleGroupLister provides the rule groups of one or more rule managers.
+type ruleGroupLister interface {
+	RuleGroups() []*rules.Group
+}
+
+// readHAToken reads the bearer token shared by the replicas of an HA pair. It's read
+// on every use so that the token can be rotated.
+func readHAToken(tokenFile string) (string, error) {
+	b, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(b))
+	if token == "" {
+		return "", errors.New("empty token")
+	}
+	return token, nil
+}
+
+// haStateHandler serves the alerting state of the rule manager to requests that
+// authenticate with the bearer token in tokenFile.
+func haStateHandler(m ruleGroupLister, tokenFile string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, err := readHAToken(tokenFile)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("reading token failed: %s", err), http.StatusInternalServerError)
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(buildHAState(m.RuleGroups())); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// fetchHAState retrieves the alerting state from the peer replica.
+func fetchHAState(ctx context.Context, client *http.Client, peerURL, token string) (*haState, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, peerURL+haStatePath, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	var s haState
+	if err := json.NewDecoder(resp.Body).Decode(&s); err != nil {
+		return nil, fmt.Errorf("decode state: %w", err)
+	}
+	return &s, nil
+}
+
+// hostResolver resolves host names to addresses.
+type hostResolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// resolvePeerURLs resolves the host of the peer URL and returns the URL of each of its
+// addresses. This allows addressing the replicas through a headless Service, whose name
+// resolves to the addresses of all replicas.
+func resolvePeerURLs(ctx context.Context, resolver hostResolver, peerURL string) ([]string, error) {
+	u, err := url.Parse(peerURL)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := resolver.LookupHost(ctx, u.Hostname())
+	if err != nil {
+		return nil, err
+	}
+	urls := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		pu := *u
+		if port := u.Port(); port != "" {
+			pu.Host = net.JoinHostPort(addr, port)
+		} else if strings.Contains(addr, ":") {
+			pu.Host = "[" + addr + "]"
+		} else {
+			pu.Host = addr
+		}
+		urls = append(urls, pu.String())
+	}
+	return urls, nil
+}
+
+// syncHAState periodically restores the alerting state from the peer replicas until
+// the context is canceled. The peer URL is resolved on every sync, so that replicas
+// that were rescheduled are found. If it resolves to this replica as well, syncing
+// from itself has no effect.
+func syncHAState(ctx context.Context, logger log.Logger, m ruleGroupLister, resolver hostResolver, peerURL, tokenFile string, interval time.Duration) {
+	client := &http.Client{Timeout: interval}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		token, err := readHAToken(tokenFile)
+		if err != nil {
+			level.Warn(logger).Log("msg", "Reading token failed", "err", err)
+			continue
+		}
+		peers, err := resolvePeerURLs(ctx, resolver, peerURL)
+		if err != nil {
+			level.Warn(logger).Log("msg", "Resolving peers failed", "peer", peerURL, "err", err)
+			continue
+		}
+		for _, peer := range peers {
+			s, err := fetchHAState(ctx, client, peer, token)
+			if err != nil {
+				level.Warn(logger).Log("msg", "Fetching state from peer failed", "peer", peer, "err", err)
+				continue
+			}
+			if n := restoreHAState(m.RuleGroups(), s, time.Now()); n > 0 {
+				level.Info(logger).Log("msg", "Restored alert state from peer", "peer", peer, "alerts", n)
+				haStateRestoredAlerts.Add(float64(n))
+			}
+		}
+	}
+}
@@ -0,0 +1,221 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/rules"
+)
+
+// newTestAlertingGroup returns a group with a single alerting rule that has a pending
+// alert for each of the label sets, which became active at the given time.
+func newTestAlertingGroup(t *testing.T, activeAt time.Time, lsets ...labels.Labels) (*rules.Group, *rules.AlertingRule) {
+	expr, err := parser.ParseExpr("up == 0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rule := rules.NewAlertingRule("Down", expr, 10*time.Minute, nil, nil, nil, "", true, log.NewNopLogger())
+
+	var vec promql.Vector
+	for _, lset := range lsets {
+		vec = append(vec, promql.Sample{Metric: lset, Point: promql.Point{V: 1}})
+	}
+	query := func(context.Context, string, time.Time) (promql.Vector, error) {
+		return vec, nil
+	}
+	if _, err := rule.Eval(context.Background(), activeAt, query, nil, 0); err != nil {
+		t.Fatal(err)
+	}
+	g := rules.NewGroup(rules.GroupOptions{
+		Name:     "group",
+		File:     "rules.yaml",
+		Interval: time.Minute,
+		Rules:    []rules.Rule{rule},
+		Opts:     &rules.ManagerOptions{Registerer: prometheus.NewRegistry()},
+	})
+	return g, rule
+}
+
+func activeAtByInstance(rule *rules.AlertingRule) map[string]time.Time {
+	res := map[string]time.Time{}
+	rule.ForEachActiveAlert(func(a *rules.Alert) {
+		res[a.Labels.Get("instance")] = a.ActiveAt
+	})
+	return res
+}
+
+func TestHAState(t *testing.T) {
+	now := time.Unix(10000, 0).UTC()
+	a := labels.FromStrings("instance", "a")
+	b := labels.FromStrings("instance", "b")
+	c := labels.FromStrings("instance", "c")
+
+	// The peer has been tracking alerts a and b for longer.
+	peerGroup, _ := newTestAlertingGroup(t, now.Add(-5*time.Minute), a, b)
+	peer := buildHAState([]*rules.Group{peerGroup})
+
+	// The state must survive being sent to the peer.
+	buf, err := json.Marshal(peer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded haState
+	if err := json.Unmarshal(buf, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(peer, &decoded); diff != "" {
+		t.Fatalf("unexpected decoded state (-want, +got): %s", diff)
+	}
+	if len(decoded.Groups) != 1 || len(decoded.Groups[0].Alerts) != 2 || decoded.Groups[0].Alerts[0].State != "pending" {
+		t.Fatalf("unexpected state %+v", decoded)
+	}
+	decoded.Groups[0].LastEvaluation = now.Add(-30 * time.Second)
+
+	group, rule := newTestAlertingGroup(t, now, a, c)
+
+	// Stale peer state is ignored.
+	stale := decoded
+	stale.Groups = []haGroupState{decoded.Groups[0]}
+	stale.Groups[0].LastEvaluation = now.Add(-3 * time.Minute)
+	if n := restoreHAState([]*rules.Group{group}, &stale, now); n != 0 {
+		t.Errorf("expected no restored alerts for stale peer state, got %d", n)
+	}
+
+	if n := restoreHAState([]*rules.Group{group}, &decoded, now); n != 1 {
+		t.Errorf("expected 1 restored alert, got %d", n)
+	}
+	want := map[string]time.Time{
+		"a": now.Add(-5 * time.Minute),
+		// Unknown to the peer.
+		"c": now,
+	}
+	if diff := cmp.Diff(want, activeAtByInstance(rule)); diff != "" {
+		t.Errorf("unexpected active times (-want, +got): %s", diff)
+	}
+
+	// Restoring is idempotent.
+	if n := restoreHAState([]*rules.Group{group}, &decoded, now); n != 0 {
+		t.Errorf("expected no restored alerts, got %d", n)
+	}
+}
+
+func TestHAStateHandler(t *testing.T) {
+	now := time.Unix(10000, 0).UTC()
+	group, _ := newTestAlertingGroup(t, now, labels.FromStrings("instance", "a"))
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("token-1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(haStateHandler(groupList{group}, tokenFile))
+	defer srv.Close()
+
+	ctx := context.Background()
+	if _, err := fetchHAState(ctx, srv.Client(), srv.URL, "wrong"); err == nil {
+		t.Fatal("expected request with wrong token to fail")
+	}
+	s, err := fetchHAState(ctx, srv.Client(), srv.URL, "token-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Groups) != 1 || len(s.Groups[0].Alerts) != 1 {
+		t.Errorf("unexpected state %+v", s)
+	}
+
+	// Rotated tokens are picked up without restarting.
+	if err := os.WriteFile(tokenFile, []byte("token-2"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fetchHAState(ctx, srv.Client(), srv.URL, "token-1"); err == nil {
+		t.Error("expected request with the previous token to fail")
+	}
+	if _, err := fetchHAState(ctx, srv.Client(), srv.URL, "token-2"); err != nil {
+		t.Error(err)
+	}
+
+	// Without a token nothing is served.
+	if err := os.WriteFile(tokenFile, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fetchHAState(ctx, srv.Client(), srv.URL, ""); err == nil {
+		t.Error("expected request to fail with an empty token")
+	}
+}
+
+type staticResolver map[string][]string
+
+func (r staticResolver) LookupHost(_ context.Context, host string) ([]string, error) {
+	addrs, ok := r[host]
+	if !ok {
+		return nil, fmt.Errorf("unknown host %q", host)
+	}
+	return addrs, nil
+}
+
+func TestResolvePeerURLs(t *testing.T) {
+	resolver := staticResolver{
+		"rule-evaluator.gmp-system.svc": {"10.0.0.1", "10.0.0.2"},
+		"rule-evaluator-v6":             {"fd00::1"},
+	}
+	cases := []struct {
+		peerURL string
+		want    []string
+		wantErr bool
+	}{
+		{
+			peerURL: "http://rule-evaluator.gmp-system.svc:19092",
+			want:    []string{"http://10.0.0.1:19092", "http://10.0.0.2:19092"},
+		},
+		{
+			peerURL: "http://rule-evaluator-v6",
+			want:    []string{"http://[fd00::1]"},
+		},
+		{
+			peerURL: "http://unknown:19092",
+			wantErr: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.peerURL, func(t *testing.T) {
+			got, err := resolvePeerURLs(context.Background(), resolver, c.peerURL)
+			if c.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(c.want, got); diff != "" {
+				t.Errorf("unexpected peer URLs (-want, +got): %s", diff)
+			}
+		})
+	}
+}
@@ -18,6 +18,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
@@ -82,6 +83,17 @@ func main() {
 		prometheus.NewGoCollector(),
 		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
 		grpc_prometheus.DefaultClientMetrics,
+		haStateRestoredAlerts,
+		evaluationDelay,
+		ruleGroupQueryOffset,
+		queryStaleness,
+		forStateSaveFailures,
+		queryErrors,
+		queryRetries,
+		queryRetriesSkipped,
+		gcsRuleSyncFailures,
+		queriesInFlight,
+		queryConcurrencyWait,
 	)
 
 	// The rule-evaluator version is identical to the export library version for now, so
@@ -108,12 +120,77 @@ func main() {
 	queryCredentialsFile := a.Flag("query.credentials-file", "Credentials file for OAuth2 authentication with --query.target-url.").
 		Default("").String()
 
+	fanOutProjectIDs := a.Flag("query.fan-out-project-id", fmt.Sprintf("Project ID of a Google Cloud Monitoring project or scoping project to evaluate rules against instead of --query.project-id. Repeat to evaluate the same rules against several projects. The %q label of the results and alerts of the rules is set to the project. Rules that already set the label are still evaluated against --query.project-id only.", projectLabel)).
+		PlaceHolder("<project ID>").Strings()
+
+	queryEvaluationDelay := a.Flag("query.evaluation-delay", "Delay by which all rule queries are evaluated before the evaluation time, e.g. to compensate for the latency of exporting and ingesting data into GCM. Applies in addition to the query_offset of rule groups.").
+		Default("0s").Duration()
+
+	retrier := &queryRetrier{}
+	a.Flag("query.retry.max-attempts", "Maximum number of attempts of rule queries that fail with a temporary error, such as a deadline, quota or unavailable error. Each query is only retried within the smallest evaluation interval of all rule groups after the evaluation time. Set to 1 to disable retries.").
+		Default("3").IntVar(&retrier.maxAttempts)
+	a.Flag("query.retry.initial-backoff", "Backoff before the first retry of a rule query. The backoff doubles with each retry.").
+		Default("1s").DurationVar(&retrier.initialBackoff)
+	a.Flag("query.retry.max-backoff", "Maximum backoff between retries of a rule query.").
+		Default("10s").DurationVar(&retrier.maxBackoff)
+
+	queryMaxConcurrency := a.Flag("query.max-concurrency", "Maximum number of rule queries evaluated concurrently across all rule groups. Rule groups are evaluated concurrently, while the rules within a group are evaluated one after another. Queries beyond the limit wait for a free slot, which delays the evaluation of their group. 0 means no limit.").
+		Default("0").Int()
+
 	listenAddress := a.Flag("web.listen-address", "The address to listen on for HTTP requests.").
 		Default(":9091").String()
 
 	configFile := a.Flag("config.file", "Prometheus configuration file path.").
 		Default("prometheus.yml").String()
 
+	haPeerURL := a.Flag("ha.peer-url", "Base URL of the web endpoint of the other replica of an HA pair. If set, pending alerts take over the active time the peer tracked for them, so that they do not restart their pending period after a restart or failover. If the host resolves to several addresses, e.g. a headless Service of both replicas, the state is synced from all of them. Requires --ha.auth-token-file.").
+		PlaceHolder("<URL>").String()
+
+	haAuthTokenFile := a.Flag("ha.auth-token-file", "File holding a bearer token shared by the replicas of an HA pair. If set, the alerting state is served to requests that authenticate with the token, and the token is sent to --ha.peer-url. The file is re-read on every request, so that the token can be rotated.").
+		PlaceHolder("<path>").String()
+
+	haStateSyncInterval := a.Flag("ha.state-sync-interval", "Interval at which the alerting state is synced from --ha.peer-url.").
+		Default("15s").Duration()
+
+	forOutageTolerance := a.Flag("rules.alert.for-outage-tolerance", "Max time to tolerate the rule evaluator being down, or the replica not evaluating rules, for restoring the 'for' state of alerts.").
+		Default("1h").Duration()
+
+	forGracePeriod := a.Flag("rules.alert.for-grace-period", "Minimum duration between an alert and its restored 'for' state. This is maintained only for alerts with a configured 'for' time greater than the grace period.").
+		Default("10m").Duration()
+
+	forStatePath := a.Flag("rules.alert.for-state-file", "File to which the 'for' state of active alerts is saved and from which it is restored at startup. If not set, the state is restored from the ALERTS_FOR_STATE series written to GCM.").
+		PlaceHolder("<path>").String()
+
+	forStateSaveInterval := a.Flag("rules.alert.for-state-save-interval", "Interval at which the 'for' state of alerts is saved to --rules.alert.for-state-file.").
+		Default("15s").Duration()
+
+	exportGroupMetrics := a.Flag("rules.group-metrics.export", "Write the evaluation metrics of rule groups through the export path to GCM in addition to exposing them, so that falling behind with rule evaluation can be alerted on from GCM.").
+		Default("false").Bool()
+
+	exportGroupMetricsInterval := a.Flag("rules.group-metrics.export-interval", "Interval at which the evaluation metrics of rule groups are written if --rules.group-metrics.export is set.").
+		Default("1m").Duration()
+
+	gcsRulesPrefix := a.Flag("rules.gcs-prefix", "GCS prefix of rule files to evaluate in addition to the rule files of the configuration, e.g. centrally managed rules. All objects under the prefix are loaded as rule files. The objects are synced every --rules.gcs-sync-interval and rules are reloaded when their checksums change. Uses the credentials of --query.credentials-file.").
+		PlaceHolder("gs://<bucket>/<prefix>").String()
+
+	gcsRulesDir := a.Flag("rules.gcs-dir", "Directory to which the rule files under --rules.gcs-prefix are synced. Defaults to a temporary directory.").
+		PlaceHolder("<path>").String()
+
+	gcsRulesSyncInterval := a.Flag("rules.gcs-sync-interval", "Interval at which the rule files under --rules.gcs-prefix are synced.").
+		Default("1m").Duration()
+
+	a.Command("run", "Evaluate rules continuously. This is the default command.").Default()
+
+	backfillCmd := a.Command("backfill", "Evaluate the recording rules of rule files over a past time range against --query.target-url and write their results.")
+	backfillStart := backfillCmd.Flag("start", "Start of the time range to backfill as RFC3339 or Unix timestamp.").
+		Required().String()
+	backfillEnd := backfillCmd.Flag("end", "End of the time range to backfill as RFC3339 or Unix timestamp. Defaults to the current time.").
+		String()
+	backfillInterval := backfillCmd.Flag("eval-interval", "Evaluation interval of rule groups that do not set an interval.").
+		Default("1m").Duration()
+	backfillFiles := backfillCmd.Arg("rule-files", "Rule files with the recording rules to backfill.").
+		Required().ExistingFiles()
+
 	a.Flag("alertmanager.notification-queue-capacity", "The capacity of the queue for pending Alertmanager notifications.").
 		Default("10000").IntVar(&notifierOptions.QueueCapacity)
 
@@ -123,7 +200,8 @@ func main() {
 		a.Usage(os.Args[1:])
 		os.Exit(2)
 	}
-	if _, err := a.Parse(append(os.Args[1:], extraArgs...)); err != nil {
+	cmd, err := a.Parse(append(os.Args[1:], extraArgs...))
+	if err != nil {
 		level.Error(logger).Log("msg", "Error parsing commandline arguments", "err", err)
 		a.Usage(os.Args[1:])
 		os.Exit(2)
@@ -134,7 +212,19 @@ func main() {
 		os.Exit(2)
 	}
 
-	*targetURL = strings.ReplaceAll(*targetURL, projectIDVar, *projectID)
+	fanOutProjects := map[string]bool{*projectID: true}
+	for _, p := range *fanOutProjectIDs {
+		if fanOutProjects[p] {
+			level.Error(logger).Log("msg", "--query.fan-out-project-id must be unique and differ from --query.project-id", "project_id", p)
+			os.Exit(2)
+		}
+		fanOutProjects[p] = true
+	}
+
+	if *haPeerURL != "" && *haAuthTokenFile == "" {
+		level.Error(logger).Log("msg", "--ha.peer-url requires --ha.auth-token-file")
+		os.Exit(2)
+	}
 
 	generatorURL := &url.URL{}
 	if *generatorURLStr != "" {
@@ -176,48 +266,134 @@ func main() {
 		os.Exit(1)
 	}
 	roundTripper := makeInstrumentedRoundTripper(transport, reg)
-	client, err := api.NewClient(api.Config{
-		Address:      *targetURL,
-		RoundTripper: roundTripper,
-	})
+	v1api, err := newQueryAPI(strings.ReplaceAll(*targetURL, projectIDVar, *projectID), roundTripper)
 	if err != nil {
 		level.Error(logger).Log("msg", "Error creating client", "err", err)
 		os.Exit(1)
 	}
-	v1api := v1.NewAPI(client)
+	queryFunc := newQueryFunc(logger, v1api)
 
-	queryFunc := func(ctx context.Context, q string, t time.Time) (promql.Vector, error) {
-		v, warnings, err := QueryFunc(ctx, q, t, v1api)
-		if len(warnings) > 0 {
-			level.Warn(logger).Log("msg", "Querying Promethues instance returned warnings", "warn", warnings)
-		}
-		if err != nil {
-			return nil, fmt.Errorf("execute query: %w", err)
-		}
-		vec, ok := v.(promql.Vector)
-		if !ok {
-			return nil, fmt.Errorf("Error querying Prometheus, Expected type vector response. Actual type %v", v.Type())
+	if cmd == backfillCmd.FullCommand() {
+		if err := runBackfill(logger, v1api, exporter, destination, *configFile, *backfillFiles, *backfillStart, *backfillEnd, *backfillInterval); err != nil {
+			level.Error(logger).Log("msg", "Backfilling recording rules failed", "err", err)
+			os.Exit(1)
 		}
-		return vec, nil
+		return
 	}
 
 	discoveryManager := discovery.NewManager(ctxDiscover, log.With(logger, "component", "discovery manager notify"), discovery.Name("notify"))
 	notificationManager := notifier.NewManager(&notifierOptions, log.With(logger, "component", "notifier"))
 
-	externalStorage := &queryStorage{
-		api: v1api,
+	// The limiter is shared by all rule managers and applies below the retries, so that
+	// queries do not hold a slot during their backoff.
+	limiter := newQueryLimiter(*queryMaxConcurrency)
+
+	ruleManagerOpts := rules.ManagerOptions{
+		ExternalURL:     generatorURL,
+		QueryFunc:       retrier.wrap(delayQueryFunc(limiter.wrap(queryFunc), *queryEvaluationDelay)),
+		Context:         ctxRuleManger,
+		Appendable:      destination,
+		Queryable:       &queryStorage{api: v1api},
+		Logger:          logger,
+		NotifyFunc:      sendAlerts(notificationManager, generatorURL.String()),
+		GroupLoader:     ruleLoader{},
+		OutageTolerance: *forOutageTolerance,
+		ForGracePeriod:  *forGracePeriod,
+	}
+	var forState *forStateFile
+	if *forStatePath != "" {
+		forState, err = loadForStateFile(*forStatePath)
+		if err != nil {
+			level.Error(logger).Log("msg", "Error loading 'for' state of alerts", "err", err)
+			os.Exit(1)
+		}
+		ruleManagerOpts.Queryable = forState
+	}
+	// The metrics of rule groups are kept in a separate registry, so that they can be
+	// exported on their own.
+	groupMetricsReg := prometheus.NewRegistry()
+
+	var ruleManager ruleManagers
+	newRuleManager := func(opts rules.ManagerOptions, reg prometheus.Registerer) {
+		opts.Metrics = rules.NewGroupMetrics(reg)
+		m := rules.NewManager(&opts)
+		reg.MustRegister(newRuleGroupHealthCollector(m))
+		ruleManager = append(ruleManager, m)
+	}
+	if len(*fanOutProjectIDs) == 0 {
+		newRuleManager(ruleManagerOpts, groupMetricsReg)
+	} else {
+		// Rules pinned to a project are evaluated against the scoping project and
+		// all other rules against each of the fan-out projects.
+		// The group metrics of all rule managers have a project label, as metrics
+		// with the same name must have the same label names.
+		opts := ruleManagerOpts
+		opts.GroupLoader = fanOutRuleLoader{}
+		newRuleManager(opts, prometheus.WrapRegistererWith(prometheus.Labels{projectLabel: *projectID}, groupMetricsReg))
+
+		for _, p := range *fanOutProjectIDs {
+			projectAPI, err := newQueryAPI(strings.ReplaceAll(*targetURL, projectIDVar, p), roundTripper)
+			if err != nil {
+				level.Error(logger).Log("msg", "Error creating client", "project_id", p, "err", err)
+				os.Exit(1)
+			}
+			projectLogger := log.With(logger, projectLabel, p)
+
+			opts := ruleManagerOpts
+			opts.QueryFunc = retrier.wrap(delayQueryFunc(limiter.wrap(newQueryFunc(projectLogger, projectAPI)), *queryEvaluationDelay))
+			if forState == nil {
+				opts.Queryable = &queryStorage{api: projectAPI}
+			}
+			opts.Logger = projectLogger
+			opts.GroupLoader = fanOutRuleLoader{project: p}
+			newRuleManager(opts, prometheus.WrapRegistererWith(prometheus.Labels{projectLabel: p}, groupMetricsReg))
+		}
 	}
 
-	ruleManager := rules.NewManager(&rules.ManagerOptions{
-		ExternalURL: generatorURL,
-		QueryFunc:   queryFunc,
-		Context:     ctxRuleManger,
-		Appendable:  destination,
-		Queryable:   externalStorage,
-		Logger:      logger,
-		NotifyFunc:  sendAlerts(notificationManager, generatorURL.String()),
-		Metrics:     rules.NewGroupMetrics(reg),
-	})
+	var gcsRules *gcsRuleFiles
+	if *gcsRulesPrefix != "" {
+		dir := *gcsRulesDir
+		if dir == "" {
+			dir, err = os.MkdirTemp("", "rule-evaluator-gcs")
+			if err != nil {
+				level.Error(logger).Log("msg", "Creating directory for rule files from GCS failed", "err", err)
+				os.Exit(1)
+			}
+		}
+		opts := []option.ClientOption{
+			option.WithScopes("https://www.googleapis.com/auth/devstorage.read_only"),
+			option.WithUserAgent(fmt.Sprintf("rule-evaluator/%s", version)),
+		}
+		if *queryCredentialsFile != "" {
+			opts = append(opts, option.WithCredentialsFile(*queryCredentialsFile))
+		}
+		gcsTransport, err := apihttp.NewTransport(ctxRuleManger, http.DefaultTransport, opts...)
+		if err != nil {
+			level.Error(logger).Log("msg", "Creating GCS HTTP transport failed", "err", err)
+			os.Exit(1)
+		}
+		gcsRules, err = newGCSRuleFiles(&http.Client{Transport: gcsTransport}, *gcsRulesPrefix, dir)
+		if err != nil {
+			level.Error(logger).Log("msg", "Invalid --rules.gcs-prefix", "err", err)
+			os.Exit(1)
+		}
+		// The rules are loaded once the sync succeeds if it fails at startup.
+		ctx, cancel := context.WithTimeout(context.Background(), *gcsRulesSyncInterval)
+		if _, err := gcsRules.sync(ctx); err != nil {
+			level.Error(logger).Log("msg", "Syncing rule files from GCS failed", "err", err)
+			gcsRuleSyncFailures.Inc()
+		}
+		cancel()
+	}
+
+	ruleFileLoaded := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "rule_evaluator_rule_file_loaded",
+			Help: "Whether the rule file was successfully loaded (1) or not (0).",
+		},
+		[]string{"file"},
+	)
+	reg.MustRegister(ruleFileLoaded)
 
 	reloaders := []reloader{
 		{
@@ -247,14 +423,24 @@ func main() {
 					}
 					files = append(files, fs...)
 				}
+				if gcsRules != nil {
+					files = append(files, gcsRules.files()...)
+				}
 				return ruleManager.Update(
 					time.Duration(cfg.GlobalConfig.EvaluationInterval),
-					files,
+					loadableRuleFiles(logger, files, ruleFileLoaded),
 					cfg.GlobalConfig.ExternalLabels,
 					"",
 					nil,
 				)
 			},
+		}, {
+			// Must run after the rules are loaded to take the interval of their groups.
+			name: "query_retry",
+			reloader: func(cfg *config.Config) error {
+				retrier.setInterval(minGroupInterval(ruleManager.RuleGroups(), time.Duration(cfg.GlobalConfig.EvaluationInterval)))
+				return nil
+			},
 		},
 	}
 	// Do an initial load of the configuration for all components.
@@ -330,12 +516,42 @@ func main() {
 			cancel()
 		})
 	}
+	if *haPeerURL != "" {
+		// Alerting state sync from the HA peer.
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			syncHAState(ctx, log.With(logger, "component", "ha state sync"), ruleManager, net.DefaultResolver, strings.TrimSuffix(*haPeerURL, "/"), *haAuthTokenFile, *haStateSyncInterval)
+			return nil
+		}, func(error) {
+			cancel()
+		})
+	}
+	if forState != nil {
+		// Persistence of the 'for' state of alerts.
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			runForStateFile(ctx, log.With(logger, "component", "for state"), forState, ruleManager, *forStateSaveInterval)
+			return nil
+		}, func(error) {
+			cancel()
+		})
+	}
+	if *exportGroupMetrics {
+		// Export of rule group metrics.
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			exportRuleGroupMetrics(ctx, log.With(logger, "component", "group metrics export"), groupMetricsReg, destination, *exportGroupMetricsInterval)
+			return nil
+		}, func(error) {
+			cancel()
+		})
+	}
 	reloadCh := make(chan chan error)
 	{
 		// Web Server.
 		server := &http.Server{Addr: *listenAddress}
 
-		http.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{Registry: reg}))
+		http.Handle("/metrics", promhttp.HandlerFor(prometheus.Gatherers{reg, groupMetricsReg}, promhttp.HandlerOpts{Registry: reg}))
 		http.HandleFunc("/-/reload", func(w http.ResponseWriter, r *http.Request) {
 			if r.Method == "POST" {
 				rc := make(chan error)
@@ -347,6 +563,17 @@ func main() {
 				http.Error(w, "Only POST requests allowed.", http.StatusMethodNotAllowed)
 			}
 		})
+		// The alerting state is only served if it can be protected.
+		if *haAuthTokenFile != "" {
+			http.Handle(haStatePath, haStateHandler(ruleManager, *haAuthTokenFile))
+		}
+		http.Handle(ruleErrorsPath, ruleErrorsHandler(ruleManager))
+		http.Handle(rulesAPIPath, rulesAPIHandler(ruleManager))
+		http.Handle(alertsAPIPath, alertsAPIHandler(ruleManager))
+		http.Handle("/-/export/pause", exporter.PauseHandler())
+		http.Handle("/-/export/resume", exporter.ResumeHandler())
+		http.Handle("/-/export/debug", exporter.DebugHandler())
+		http.Handle("/-/export/drop-log", exporter.DropLogHandler())
 		http.HandleFunc("/-/healthy", func(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusOK)
 		})
@@ -363,6 +590,24 @@ func main() {
 			cancel()
 		})
 	}
+	if gcsRules != nil {
+		// Sync of rule files from GCS.
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			runGCSRuleSync(ctx, log.With(logger, "component", "gcs rules"), gcsRules, *gcsRulesSyncInterval, func(ctx context.Context) error {
+				rc := make(chan error)
+				select {
+				case reloadCh <- rc:
+					return <-rc
+				case <-ctx.Done():
+					return nil
+				}
+			})
+			return nil
+		}, func(error) {
+			cancel()
+		})
+	}
 	{
 		// Reload handler.
 		hup := make(chan os.Signal, 1)
@@ -408,6 +653,36 @@ func main() {
 	}
 }
 
+// newQueryAPI returns a client for the Prometheus query API at the address.
+func newQueryAPI(address string, roundTripper http.RoundTripper) (v1.API, error) {
+	client, err := api.NewClient(api.Config{
+		Address:      address,
+		RoundTripper: roundTripper,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v1.NewAPI(client), nil
+}
+
+// newQueryFunc returns the rules.QueryFunc that evaluates rule queries with the API.
+func newQueryFunc(logger log.Logger, v1api v1.API) rules.QueryFunc {
+	return func(ctx context.Context, q string, t time.Time) (promql.Vector, error) {
+		v, warnings, err := QueryFunc(ctx, q, t, v1api)
+		if len(warnings) > 0 {
+			level.Warn(logger).Log("msg", "Querying Promethues instance returned warnings", "warn", warnings)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("execute query: %w", err)
+		}
+		vec, ok := v.(promql.Vector)
+		if !ok {
+			return nil, fmt.Errorf("Error querying Prometheus, Expected type vector response. Actual type %v", v.Type())
+		}
+		return vec, nil
+	}
+}
+
 // QueryFunc queries a Prometheus instance and returns a promql.Vector.
 func QueryFunc(ctx context.Context, q string, t time.Time, v1api v1.API) (parser.Value, v1.Warnings, error) {
 	results, warnings, err := v1api.Query(ctx, q, t)
@@ -444,6 +719,26 @@ func sendAlerts(s *notifier.Manager, externalURL string) rules.NotifyFunc {
 	}
 }
 
+// loadableRuleFiles returns the rule files that can be parsed and records the load
+// status of every file. Invalid files are skipped so that they do not prevent the
+// rules of other files from being loaded.
+func loadableRuleFiles(logger log.Logger, files []string, loaded *prometheus.GaugeVec) []string {
+	loaded.Reset()
+	ruleGroupQueryOffset.Reset()
+
+	var res []string
+	for _, f := range files {
+		if _, errs := (ruleLoader{}).Load(f); len(errs) > 0 {
+			level.Error(logger).Log("msg", "Failed to load rule file", "file", f, "err", errors.Join(errs...))
+			loaded.WithLabelValues(f).Set(0)
+			continue
+		}
+		loaded.WithLabelValues(f).Set(1)
+		res = append(res, f)
+	}
+	return res
+}
+
 type reloader struct {
 	name     string
 	reloader func(*config.Config) error
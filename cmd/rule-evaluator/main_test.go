@@ -18,11 +18,16 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/go-kit/log"
 	"github.com/google/go-cmp/cmp"
 	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/promql"
@@ -176,3 +181,49 @@ func TestSelect(t *testing.T) {
 		})
 	}
 }
+
+func TestLoadableRuleFiles(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "valid.yaml")
+	invalid := filepath.Join(dir, "invalid.yaml")
+	empty := filepath.Join(dir, "empty.yaml")
+
+	if err := os.WriteFile(valid, []byte(`
+groups:
+- name: test
+  rules:
+  - record: foo:sum
+    expr: sum(foo)
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(invalid, []byte(`
+groups:
+- name: test
+  rules:
+  - record: foo:sum
+    expr: sum(foo
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(empty, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "test"}, []string{"file"})
+	// Stale files from a previous load must be dropped.
+	loaded.WithLabelValues("stale.yaml").Set(1)
+
+	got := loadableRuleFiles(log.NewNopLogger(), []string{empty, invalid, valid}, loaded)
+	if diff := cmp.Diff([]string{empty, valid}, got); diff != "" {
+		t.Errorf("unexpected files (-want, +got): %s", diff)
+	}
+	for f, want := range map[string]float64{empty: 1, invalid: 0, valid: 1} {
+		if v := testutil.ToFloat64(loaded.WithLabelValues(f)); v != want {
+			t.Errorf("file %s: expected load status %v but got %v", f, want, v)
+		}
+	}
+	if n := testutil.CollectAndCount(loaded); n != 3 {
+		t.Errorf("expected 3 series but got %d", n)
+	}
+}
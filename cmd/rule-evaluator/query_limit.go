@@ -0,0 +1,71 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/rules"
+)
+
+var (
+	queriesInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "rule_evaluator_queries_in_flight",
+		Help: "Number of rule queries currently being evaluated.",
+	})
+	queryConcurrencyWait = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "rule_evaluator_query_concurrency_wait_seconds_total",
+		Help: "Total time rule queries waited for a slot because of --query.max-concurrency.",
+	})
+)
+
+// queryLimiter bounds the number of rule queries that are evaluated concurrently
+// across all rule groups and rule managers. Each rule group is evaluated in its own
+// goroutine, so without a limit all groups that are due query GCM at once.
+type queryLimiter struct {
+	slots chan struct{}
+}
+
+// newQueryLimiter returns a limiter for n concurrent queries. For n <= 0, the number
+// of concurrent queries is not limited.
+func newQueryLimiter(n int) *queryLimiter {
+	if n <= 0 {
+		return &queryLimiter{}
+	}
+	return &queryLimiter{slots: make(chan struct{}, n)}
+}
+
+// wrap returns a query function that evaluates queries of query once a slot is free.
+func (l *queryLimiter) wrap(query rules.QueryFunc) rules.QueryFunc {
+	return func(ctx context.Context, q string, t time.Time) (promql.Vector, error) {
+		if l.slots != nil {
+			start := time.Now()
+			select {
+			case l.slots <- struct{}{}:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			defer func() { <-l.slots }()
+			queryConcurrencyWait.Add(time.Since(start).Seconds())
+		}
+		queriesInFlight.Inc()
+		defer queriesInFlight.Dec()
+
+		return query(ctx, q, t)
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/promql"
+)
+
+func TestQueryLimiter(t *testing.T) {
+	var (
+		mtx                   sync.Mutex
+		inFlight, maxInFlight int
+	)
+	query := newQueryLimiter(2).wrap(func(context.Context, string, time.Time) (promql.Vector, error) {
+		mtx.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mtx.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mtx.Lock()
+		inFlight--
+		mtx.Unlock()
+		return nil, nil
+	})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			query(context.Background(), "up", time.Now())
+		}()
+	}
+	wg.Wait()
+
+	if maxInFlight != 2 {
+		t.Errorf("unexpected max concurrent queries: want 2, got %d", maxInFlight)
+	}
+}
+
+func TestQueryLimiterCanceled(t *testing.T) {
+	l := newQueryLimiter(1)
+	l.slots <- struct{}{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	query := l.wrap(func(context.Context, string, time.Time) (promql.Vector, error) {
+		t.Fatal("unexpected query while no slot is free")
+		return nil, nil
+	})
+	if _, err := query(ctx, "up", time.Now()); err != context.Canceled {
+		t.Errorf("unexpected error: want %v, got %v", context.Canceled, err)
+	}
+}
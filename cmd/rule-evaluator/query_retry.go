@@ -0,0 +1,238 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	gax "github.com/googleapis/gax-go/v2"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/rules"
+)
+
+const ruleErrorsPath = "/api/v1/rules/errors"
+
+// Reasons for which queries to GCM fail.
+const (
+	queryErrorDeadline    = "deadline"
+	queryErrorQuota       = "quota"
+	queryErrorUnavailable = "unavailable"
+	queryErrorCanceled    = "canceled"
+	queryErrorInvalid     = "invalid"
+	queryErrorOther       = "other"
+)
+
+var (
+	queryErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "rule_evaluator_query_errors_total",
+		Help: "Number of failed rule queries by the reason they failed.",
+	}, []string{"reason"})
+	queryRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "rule_evaluator_query_retries_total",
+		Help: "Number of retried rule queries by the reason the previous attempt failed.",
+	}, []string{"reason"})
+	queryRetriesSkipped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "rule_evaluator_query_retries_skipped_total",
+		Help: "Number of failed rule queries with a temporary error that were not retried by the reason why.",
+	}, []string{"reason"})
+)
+
+// queryErrorReason classifies the error of a failed query.
+func queryErrorReason(err error) string {
+	if errors.Is(err, context.Canceled) {
+		return queryErrorCanceled
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return queryErrorDeadline
+	}
+	var apiErr *v1.Error
+	if errors.As(err, &apiErr) {
+		switch apiErr.Type {
+		case v1.ErrTimeout:
+			return queryErrorDeadline
+		case v1.ErrCanceled:
+			return queryErrorCanceled
+		case v1.ErrBadData, v1.ErrExec:
+			return queryErrorInvalid
+		case v1.ErrClient, v1.ErrServer:
+			// The API client only retains the status code in the message, e.g.
+			// "server error: 503".
+			var (
+				kind string
+				code int
+			)
+			if _, err := fmt.Sscanf(apiErr.Msg, "%s error: %d", &kind, &code); err != nil {
+				return queryErrorOther
+			}
+			switch code {
+			case http.StatusTooManyRequests:
+				return queryErrorQuota
+			case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+				return queryErrorDeadline
+			case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable:
+				return queryErrorUnavailable
+			}
+			if apiErr.Type == v1.ErrClient {
+				return queryErrorInvalid
+			}
+		}
+		return queryErrorOther
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return queryErrorDeadline
+		}
+		return queryErrorUnavailable
+	}
+	return queryErrorOther
+}
+
+// queryErrorRetryable returns whether queries that failed for the reason may succeed
+// if retried.
+func queryErrorRetryable(reason string) bool {
+	switch reason {
+	case queryErrorDeadline, queryErrorQuota, queryErrorUnavailable:
+		return true
+	}
+	return false
+}
+
+// queryRetrier retries rule queries that failed with a temporary error. Each query is
+// only retried within the smallest evaluation interval of all rule groups after the
+// evaluation time, so that retries do not delay the next evaluation of any group.
+type queryRetrier struct {
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+
+	// The evaluation interval within which retries are made.
+	interval atomic.Int64
+}
+
+// setInterval sets the evaluation interval within which queries are retried.
+func (r *queryRetrier) setInterval(interval time.Duration) {
+	r.interval.Store(int64(interval))
+}
+
+// minGroupInterval returns the smallest evaluation interval of the rule groups, or
+// the global interval if there are none.
+func minGroupInterval(groups []*rules.Group, global time.Duration) time.Duration {
+	if len(groups) == 0 {
+		return global
+	}
+	interval := groups[0].Interval()
+	for _, g := range groups[1:] {
+		if g.Interval() < interval {
+			interval = g.Interval()
+		}
+	}
+	return interval
+}
+
+// wrap returns a query function that retries queries of query.
+func (r *queryRetrier) wrap(query rules.QueryFunc) rules.QueryFunc {
+	return func(ctx context.Context, q string, t time.Time) (promql.Vector, error) {
+		deadline := t.Add(time.Duration(r.interval.Load()))
+		bo := gax.Backoff{
+			Initial:    r.initialBackoff,
+			Max:        r.maxBackoff,
+			Multiplier: 2,
+		}
+		for attempt := 1; ; attempt++ {
+			v, err := query(ctx, q, t)
+			if err == nil {
+				return v, nil
+			}
+			reason := queryErrorReason(err)
+			queryErrors.WithLabelValues(reason).Inc()
+
+			if !queryErrorRetryable(reason) {
+				return nil, err
+			}
+			if attempt >= r.maxAttempts {
+				if r.maxAttempts > 1 {
+					queryRetriesSkipped.WithLabelValues("max-attempts").Inc()
+				}
+				return nil, err
+			}
+			pause := bo.Pause()
+			if time.Now().Add(pause).After(deadline) {
+				queryRetriesSkipped.WithLabelValues("interval").Inc()
+				return nil, err
+			}
+			if gax.Sleep(ctx, pause) != nil {
+				queryRetriesSkipped.WithLabelValues("canceled").Inc()
+				return nil, err
+			}
+			queryRetries.WithLabelValues(reason).Inc()
+		}
+	}
+}
+
+type ruleErrors struct {
+	Errors []ruleError `json:"errors"`
+}
+
+type ruleError struct {
+	File           string    `json:"file"`
+	Group          string    `json:"group"`
+	Rule           string    `json:"rule"`
+	LastError      string    `json:"lastError"`
+	Reason         string    `json:"reason"`
+	LastEvaluation time.Time `json:"lastEvaluation"`
+}
+
+// buildRuleErrors returns the last error of all rules whose last evaluation failed.
+func buildRuleErrors(groups []*rules.Group) *ruleErrors {
+	res := &ruleErrors{Errors: []ruleError{}}
+
+	for _, g := range groups {
+		for _, r := range g.Rules() {
+			err := r.LastError()
+			if r.Health() != rules.HealthBad || err == nil {
+				continue
+			}
+			res.Errors = append(res.Errors, ruleError{
+				File:           g.File(),
+				Group:          g.Name(),
+				Rule:           r.Name(),
+				LastError:      err.Error(),
+				Reason:         queryErrorReason(err),
+				LastEvaluation: r.GetEvaluationTimestamp(),
+			})
+		}
+	}
+	return res
+}
+
+// ruleErrorsHandler serves the last error of all failing rules of the rule manager.
+func ruleErrorsHandler(m ruleGroupLister) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(buildRuleErrors(m.RuleGroups())); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/google/go-cmp/cmp"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/rules"
+)
+
+func TestQueryErrorReason(t *testing.T) {
+	cases := []struct {
+		err  error
+		want string
+	}{
+		{context.DeadlineExceeded, queryErrorDeadline},
+		{fmt.Errorf("execute query: %w", context.Canceled), queryErrorCanceled},
+		{&v1.Error{Type: v1.ErrTimeout}, queryErrorDeadline},
+		{&v1.Error{Type: v1.ErrBadData, Msg: "parse error"}, queryErrorInvalid},
+		{&v1.Error{Type: v1.ErrClient, Msg: "client error: 429"}, queryErrorQuota},
+		{&v1.Error{Type: v1.ErrClient, Msg: "client error: 403"}, queryErrorInvalid},
+		{&v1.Error{Type: v1.ErrServer, Msg: "server error: 503"}, queryErrorUnavailable},
+		{&v1.Error{Type: v1.ErrServer, Msg: "server error: 504"}, queryErrorDeadline},
+		{fmt.Errorf("execute query: %w", &v1.Error{Type: v1.ErrServer, Msg: "server error: 501"}), queryErrorOther},
+		{errors.New("unknown"), queryErrorOther},
+	}
+	for _, c := range cases {
+		if got := queryErrorReason(c.err); got != c.want {
+			t.Errorf("unexpected reason for %q: want %q, got %q", c.err, c.want, got)
+		}
+	}
+}
+
+func TestQueryRetrier(t *testing.T) {
+	unavailable := &v1.Error{Type: v1.ErrServer, Msg: "server error: 503"}
+	invalid := &v1.Error{Type: v1.ErrBadData, Msg: "parse error"}
+
+	cases := []struct {
+		desc     string
+		errs     []error
+		interval time.Duration
+		attempts int
+		wantErr  error
+	}{
+		{
+			desc:     "retried until success",
+			errs:     []error{unavailable, unavailable},
+			interval: time.Minute,
+			attempts: 3,
+		}, {
+			desc:     "max attempts",
+			errs:     []error{unavailable, unavailable, unavailable},
+			interval: time.Minute,
+			attempts: 3,
+			wantErr:  unavailable,
+		}, {
+			desc:     "not retryable",
+			errs:     []error{invalid},
+			interval: time.Minute,
+			attempts: 1,
+			wantErr:  invalid,
+		}, {
+			desc:     "beyond interval",
+			errs:     []error{unavailable},
+			interval: 0,
+			attempts: 1,
+			wantErr:  unavailable,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			r := &queryRetrier{
+				maxAttempts:    3,
+				initialBackoff: time.Millisecond,
+				maxBackoff:     time.Millisecond,
+			}
+			r.setInterval(c.interval)
+
+			var attempts int
+			query := r.wrap(func(context.Context, string, time.Time) (promql.Vector, error) {
+				attempts++
+				if attempts <= len(c.errs) {
+					return nil, c.errs[attempts-1]
+				}
+				return promql.Vector{}, nil
+			})
+			_, err := query(context.Background(), "up", time.Now())
+			if err != c.wantErr {
+				t.Errorf("unexpected error: want %v, got %v", c.wantErr, err)
+			}
+			if attempts != c.attempts {
+				t.Errorf("unexpected attempts: want %d, got %d", c.attempts, attempts)
+			}
+		})
+	}
+}
+
+func TestMinGroupInterval(t *testing.T) {
+	group := func(interval time.Duration) *rules.Group {
+		return rules.NewGroup(rules.GroupOptions{
+			Name:     interval.String(),
+			File:     "rules.yaml",
+			Interval: interval,
+			Opts:     &rules.ManagerOptions{Logger: log.NewNopLogger()},
+		})
+	}
+	if got := minGroupInterval(nil, time.Minute); got != time.Minute {
+		t.Errorf("expected global interval without groups, got %s", got)
+	}
+	groups := []*rules.Group{group(time.Minute), group(10 * time.Second), group(5 * time.Minute)}
+	if got := minGroupInterval(groups, time.Minute); got != 10*time.Second {
+		t.Errorf("expected smallest group interval, got %s", got)
+	}
+}
+
+func TestRuleErrorsHandler(t *testing.T) {
+	g, rule := newTestAlertingGroup(t, time.Unix(10000, 0), labels.FromStrings("instance", "a"))
+	rule.SetHealth(rules.HealthBad)
+	rule.SetLastError(fmt.Errorf("execute query: %w", &v1.Error{Type: v1.ErrClient, Msg: "client error: 429"}))
+	rule.SetEvaluationTimestamp(time.Unix(10000, 0).UTC())
+
+	w := httptest.NewRecorder()
+	ruleErrorsHandler(groupList{g}).ServeHTTP(w, httptest.NewRequest(http.MethodGet, ruleErrorsPath, nil))
+
+	want := `{"errors":[{"file":"rules.yaml","group":"group","rule":"Down","lastError":"execute query: client_error: client error: 429","reason":"quota","lastEvaluation":"1970-01-01T02:46:40Z"}]}` + "\n"
+	if diff := cmp.Diff(want, w.Body.String()); diff != "" {
+		t.Errorf("unexpected response (-want, +got): %s", diff)
+	}
+}
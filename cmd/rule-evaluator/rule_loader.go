@@ -0,0 +1,124 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	gmprules "github.com/GoogleCloudPlatform/prometheus-engine/pkg/rules"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/rules"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// queryOffsetKey is the rule group field that sets the query offset of the group.
+const queryOffsetKey = "query_offset"
+
+// ruleLoader loads rule files like the Prometheus file loader and additionally supports
+// a query_offset field in rule groups. The selectors of the rules of a group are
+// offset by its query offset, so that rules can account for the ingestion delay of
+// GCM without offsetting every expression by hand.
+type ruleLoader struct {
+	rules.FileLoader
+}
+
+func (l ruleLoader) Load(identifier string) (*rulefmt.RuleGroups, []error) {
+	b, err := os.ReadFile(identifier)
+	if err != nil {
+		return nil, []error{fmt.Errorf("%s: %w", identifier, err)}
+	}
+	rgs, offsets, errs := parseRuleGroups(b)
+	for i := range errs {
+		errs[i] = fmt.Errorf("%s: %w", identifier, errs[i])
+	}
+	for i, offset := range offsets {
+		ruleGroupQueryOffset.WithLabelValues(identifier, rgs.Groups[i].Name).Set(offset.Seconds())
+	}
+	return rgs, errs
+}
+
+// parseRuleGroups parses rule groups in the Prometheus format with an optional
+// query_offset field per group and applies the offsets to the rule expressions.
+// It returns the offsets by the index of their group.
+func parseRuleGroups(content []byte) (*rulefmt.RuleGroups, map[int]time.Duration, []error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return nil, nil, []error{err}
+	}
+	offsets, err := removeQueryOffsets(&doc)
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+	// Only re-encode the rule groups if they had query offsets, so that errors for
+	// files without them point to the original line numbers.
+	if len(offsets) > 0 {
+		content, err = yaml.Marshal(&doc)
+		if err != nil {
+			return nil, nil, []error{err}
+		}
+	}
+	rgs, errs := rulefmt.Parse(content)
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+	for i, offset := range offsets {
+		g := rgs.Groups[i]
+		for j, r := range g.Rules {
+			expr, err := gmprules.OffsetExpr(r.Expr.Value, offset)
+			if err != nil {
+				return nil, nil, []error{fmt.Errorf("group %q, rule %d: %w", g.Name, j+1, err)}
+			}
+			g.Rules[j].Expr.Value = expr
+		}
+	}
+	return rgs, offsets, nil
+}
+
+// removeQueryOffsets removes the query_offset fields from the rule groups in the YAML
+// document and returns the offsets by the index of their group.
+func removeQueryOffsets(doc *yaml.Node) (map[int]time.Duration, error) {
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	root := doc.Content[0]
+
+	offsets := map[int]time.Duration{}
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value != "groups" || root.Content[i+1].Kind != yaml.SequenceNode {
+			continue
+		}
+		for gi, g := range root.Content[i+1].Content {
+			if g.Kind != yaml.MappingNode {
+				continue
+			}
+			for k := 0; k+1 < len(g.Content); k += 2 {
+				if g.Content[k].Value != queryOffsetKey {
+					continue
+				}
+				offset, err := model.ParseDuration(g.Content[k+1].Value)
+				if err != nil {
+					return nil, fmt.Errorf("group %d: invalid %s: %w", gi+1, queryOffsetKey, err)
+				}
+				offsets[gi] = time.Duration(offset)
+				g.Content = append(g.Content[:k], g.Content[k+2:]...)
+				break
+			}
+		}
+	}
+	return offsets, nil
+}
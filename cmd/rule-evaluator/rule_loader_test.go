@@ -0,0 +1,73 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseRuleGroups_queryOffset(t *testing.T) {
+	rgs, offsets, errs := parseRuleGroups([]byte(`groups:
+- name: delayed
+  interval: 1m
+  query_offset: 2m
+  rules:
+  - record: job:up:sum
+    expr: sum by(job) (up)
+  - alert: Down
+    expr: up == 0
+    for: 5m
+- name: default
+  rules:
+  - record: job:up:count
+    expr: count by(job) (up)
+`))
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if diff := cmp.Diff(map[int]time.Duration{0: 2 * time.Minute}, offsets); diff != "" {
+		t.Errorf("unexpected offsets (-want, +got): %s", diff)
+	}
+	want := [][]string{
+		{"sum by (job) (up offset 2m)", "up offset 2m == 0"},
+		{"count by(job) (up)"},
+	}
+	if len(rgs.Groups) != len(want) {
+		t.Fatalf("expected %d groups, got %d", len(want), len(rgs.Groups))
+	}
+	for i, g := range rgs.Groups {
+		for j, r := range g.Rules {
+			if got := r.Expr.Value; got != want[i][j] {
+				t.Errorf("group %q, rule %d: expected expression %q, got %q", g.Name, j, want[i][j], got)
+			}
+		}
+	}
+
+	for _, content := range []string{
+		"groups:\n- name: g\n  query_offset: abc\n  rules: []\n",
+		"groups:\n- name: g\n  query_offset: 1m\n  unknown: 1\n  rules: []\n",
+	} {
+		if _, _, errs := parseRuleGroups([]byte(content)); len(errs) == 0 {
+			t.Errorf("expected error for %q", content)
+		}
+	}
+	// Empty files are valid.
+	if _, _, errs := parseRuleGroups(nil); len(errs) > 0 {
+		t.Errorf("unexpected errors for empty file: %v", errs)
+	}
+}
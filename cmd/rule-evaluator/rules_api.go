@@ -0,0 +1,226 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/rules"
+)
+
+const (
+	rulesAPIPath  = "/api/v1/rules"
+	alertsAPIPath = "/api/v1/alerts"
+)
+
+// The types below mirror the responses of the rules and alerts endpoints of the
+// Prometheus HTTP API, so that tools built for Prometheus, such as Grafana, can
+// read the rules and alerts of the rule evaluator.
+
+type apiResponse struct {
+	Status    string      `json:"status"`
+	Data      interface{} `json:"data,omitempty"`
+	ErrorType string      `json:"errorType,omitempty"`
+	Error     string      `json:"error,omitempty"`
+}
+
+type apiAlert struct {
+	Labels      labels.Labels `json:"labels"`
+	Annotations labels.Labels `json:"annotations"`
+	State       string        `json:"state"`
+	ActiveAt    *time.Time    `json:"activeAt,omitempty"`
+	Value       string        `json:"value"`
+}
+
+type apiAlertDiscovery struct {
+	Alerts []*apiAlert `json:"alerts"`
+}
+
+type apiRuleDiscovery struct {
+	RuleGroups []*apiRuleGroup `json:"groups"`
+}
+
+type apiRuleGroup struct {
+	Name string `json:"name"`
+	File string `json:"file"`
+	// Rules holds apiAlertingRule and apiRecordingRule values.
+	Rules          []interface{} `json:"rules"`
+	Interval       float64       `json:"interval"`
+	Limit          int           `json:"limit"`
+	EvaluationTime float64       `json:"evaluationTime"`
+	LastEvaluation time.Time     `json:"lastEvaluation"`
+}
+
+type apiAlertingRule struct {
+	State          string        `json:"state"`
+	Name           string        `json:"name"`
+	Query          string        `json:"query"`
+	Duration       float64       `json:"duration"`
+	Labels         labels.Labels `json:"labels"`
+	Annotations    labels.Labels `json:"annotations"`
+	Alerts         []*apiAlert   `json:"alerts"`
+	Health         string        `json:"health"`
+	LastError      string        `json:"lastError,omitempty"`
+	EvaluationTime float64       `json:"evaluationTime"`
+	LastEvaluation time.Time     `json:"lastEvaluation"`
+	Type           string        `json:"type"`
+}
+
+type apiRecordingRule struct {
+	Name           string        `json:"name"`
+	Query          string        `json:"query"`
+	Labels         labels.Labels `json:"labels,omitempty"`
+	Health         string        `json:"health"`
+	LastError      string        `json:"lastError,omitempty"`
+	EvaluationTime float64       `json:"evaluationTime"`
+	LastEvaluation time.Time     `json:"lastEvaluation"`
+	Type           string        `json:"type"`
+}
+
+func toAPIAlerts(alerts []*rules.Alert) []*apiAlert {
+	res := make([]*apiAlert, 0, len(alerts))
+	for _, a := range alerts {
+		activeAt := a.ActiveAt
+		res = append(res, &apiAlert{
+			Labels:      a.Labels,
+			Annotations: a.Annotations,
+			State:       a.State.String(),
+			ActiveAt:    &activeAt,
+			Value:       strconv.FormatFloat(a.Value, 'e', -1, 64),
+		})
+	}
+	return res
+}
+
+func lastErrorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// buildRuleDiscovery returns the rule groups with the rules of the given type, which
+// is "alert", "record", or empty for all rules.
+func buildRuleDiscovery(groups []*rules.Group, typ string) *apiRuleDiscovery {
+	res := &apiRuleDiscovery{RuleGroups: make([]*apiRuleGroup, 0, len(groups))}
+
+	for _, g := range groups {
+		apiGroup := &apiRuleGroup{
+			Name:           g.Name(),
+			File:           g.File(),
+			Rules:          []interface{}{},
+			Interval:       g.Interval().Seconds(),
+			Limit:          g.Limit(),
+			EvaluationTime: g.GetEvaluationTime().Seconds(),
+			LastEvaluation: g.GetLastEvaluation(),
+		}
+		for _, r := range g.Rules() {
+			switch rule := r.(type) {
+			case *rules.AlertingRule:
+				if typ != "" && typ != "alert" {
+					continue
+				}
+				apiGroup.Rules = append(apiGroup.Rules, apiAlertingRule{
+					State:          rule.State().String(),
+					Name:           rule.Name(),
+					Query:          rule.Query().String(),
+					Duration:       rule.HoldDuration().Seconds(),
+					Labels:         rule.Labels(),
+					Annotations:    rule.Annotations(),
+					Alerts:         toAPIAlerts(rule.ActiveAlerts()),
+					Health:         string(rule.Health()),
+					LastError:      lastErrorString(rule.LastError()),
+					EvaluationTime: rule.GetEvaluationDuration().Seconds(),
+					LastEvaluation: rule.GetEvaluationTimestamp(),
+					Type:           "alerting",
+				})
+			case *rules.RecordingRule:
+				if typ != "" && typ != "record" {
+					continue
+				}
+				apiGroup.Rules = append(apiGroup.Rules, apiRecordingRule{
+					Name:           rule.Name(),
+					Query:          rule.Query().String(),
+					Labels:         rule.Labels(),
+					Health:         string(rule.Health()),
+					LastError:      lastErrorString(rule.LastError()),
+					EvaluationTime: rule.GetEvaluationDuration().Seconds(),
+					LastEvaluation: rule.GetEvaluationTimestamp(),
+					Type:           "recording",
+				})
+			}
+		}
+		res.RuleGroups = append(res.RuleGroups, apiGroup)
+	}
+	return res
+}
+
+// buildAlertDiscovery returns the active alerts of all alerting rules.
+func buildAlertDiscovery(groups []*rules.Group) *apiAlertDiscovery {
+	var alerts []*rules.Alert
+	for _, g := range groups {
+		for _, r := range g.AlertingRules() {
+			alerts = append(alerts, r.ActiveAlerts()...)
+		}
+	}
+	return &apiAlertDiscovery{Alerts: toAPIAlerts(alerts)}
+}
+
+func writeAPIResponse(w http.ResponseWriter, code int, resp *apiResponse) {
+	b, err := json.Marshal(resp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(b)
+}
+
+// rulesAPIHandler serves the rule groups of the rule manager like the rules
+// endpoint of the Prometheus HTTP API.
+func rulesAPIHandler(m ruleGroupLister) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		typ := r.URL.Query().Get("type")
+		if typ != "" && typ != "alert" && typ != "record" {
+			writeAPIResponse(w, http.StatusBadRequest, &apiResponse{
+				Status:    "error",
+				ErrorType: "bad_data",
+				Error:     fmt.Sprintf("invalid type %q, must be one of \"alert\" or \"record\"", typ),
+			})
+			return
+		}
+		writeAPIResponse(w, http.StatusOK, &apiResponse{
+			Status: "success",
+			Data:   buildRuleDiscovery(m.RuleGroups(), typ),
+		})
+	}
+}
+
+// alertsAPIHandler serves the active alerts of the rule manager like the alerts
+// endpoint of the Prometheus HTTP API.
+func alertsAPIHandler(m ruleGroupLister) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeAPIResponse(w, http.StatusOK, &apiResponse{
+			Status: "success",
+			Data:   buildAlertDiscovery(m.RuleGroups()),
+		})
+	}
+}
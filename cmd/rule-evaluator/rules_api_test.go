@@ -0,0 +1,110 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/rules"
+)
+
+// newTestRulesAPIGroup returns a group with an alerting rule with a pending alert and
+// a recording rule.
+func newTestRulesAPIGroup(t *testing.T) *rules.Group {
+	_, alert := newTestAlertingGroup(t, time.Unix(10000, 0).UTC(), labels.FromStrings("instance", "a"))
+	alert.SetHealth(rules.HealthGood)
+	alert.SetEvaluationTimestamp(time.Unix(10000, 0).UTC())
+
+	expr, err := parser.ParseExpr("sum(up)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := rules.NewRecordingRule("job:up:sum", expr, labels.FromStrings("team", "a"))
+	record.SetHealth(rules.HealthGood)
+	record.SetEvaluationTimestamp(time.Unix(10000, 0).UTC())
+
+	return rules.NewGroup(rules.GroupOptions{
+		Name:     "group",
+		File:     "rules.yaml",
+		Interval: time.Minute,
+		Rules:    []rules.Rule{alert, record},
+		Opts:     &rules.ManagerOptions{Registerer: prometheus.NewRegistry()},
+	})
+}
+
+func TestRulesAPIHandler(t *testing.T) {
+	g := newTestRulesAPIGroup(t)
+
+	cases := []struct {
+		desc     string
+		url      string
+		wantCode int
+		want     string
+	}{
+		{
+			desc:     "all rules",
+			url:      rulesAPIPath,
+			wantCode: http.StatusOK,
+			want: `{"status":"success","data":{"groups":[{"name":"group","file":"rules.yaml","rules":[` +
+				`{"state":"pending","name":"Down","query":"up == 0","duration":600,"labels":{},"annotations":{},"alerts":[{"labels":{"alertname":"Down","instance":"a"},"annotations":{},"state":"pending","activeAt":"1970-01-01T02:46:40Z","value":"1e+00"}],"health":"ok","evaluationTime":0,"lastEvaluation":"1970-01-01T02:46:40Z","type":"alerting"},` +
+				`{"name":"job:up:sum","query":"sum(up)","labels":{"team":"a"},"health":"ok","evaluationTime":0,"lastEvaluation":"1970-01-01T02:46:40Z","type":"recording"}` +
+				`],"interval":60,"limit":0,"evaluationTime":0,"lastEvaluation":"0001-01-01T00:00:00Z"}]}}`,
+		}, {
+			desc:     "recording rules",
+			url:      rulesAPIPath + "?type=record",
+			wantCode: http.StatusOK,
+			want: `{"status":"success","data":{"groups":[{"name":"group","file":"rules.yaml","rules":[` +
+				`{"name":"job:up:sum","query":"sum(up)","labels":{"team":"a"},"health":"ok","evaluationTime":0,"lastEvaluation":"1970-01-01T02:46:40Z","type":"recording"}` +
+				`],"interval":60,"limit":0,"evaluationTime":0,"lastEvaluation":"0001-01-01T00:00:00Z"}]}}`,
+		}, {
+			desc:     "invalid type",
+			url:      rulesAPIPath + "?type=foo",
+			wantCode: http.StatusBadRequest,
+			want:     `{"status":"error","errorType":"bad_data","error":"invalid type \"foo\", must be one of \"alert\" or \"record\""}`,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			rulesAPIHandler(groupList{g}).ServeHTTP(w, httptest.NewRequest(http.MethodGet, c.url, nil))
+
+			if w.Code != c.wantCode {
+				t.Errorf("unexpected status code: want %d, got %d", c.wantCode, w.Code)
+			}
+			if diff := cmp.Diff(c.want, w.Body.String()); diff != "" {
+				t.Errorf("unexpected response (-want, +got): %s", diff)
+			}
+		})
+	}
+}
+
+func TestAlertsAPIHandler(t *testing.T) {
+	g := newTestRulesAPIGroup(t)
+
+	w := httptest.NewRecorder()
+	alertsAPIHandler(groupList{g}).ServeHTTP(w, httptest.NewRequest(http.MethodGet, alertsAPIPath, nil))
+
+	want := `{"status":"success","data":{"alerts":[{"labels":{"alertname":"Down","instance":"a"},"annotations":{},"state":"pending","activeAt":"1970-01-01T02:46:40Z","value":"1e+00"}]}}`
+	if diff := cmp.Diff(want, w.Body.String()); diff != "" {
+		t.Errorf("unexpected response (-want, +got): %s", diff)
+	}
+}
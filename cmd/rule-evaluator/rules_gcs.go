@@ -0,0 +1,295 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const gcsEndpoint = "https://storage.googleapis.com/storage/v1"
+
+var gcsRuleSyncFailures = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "rule_evaluator_rules_gcs_sync_failures_total",
+	Help: "Number of times syncing rule files from --rules.gcs-prefix failed.",
+})
+
+// gcsObject is the subset of the GCS object resource needed to sync rule files.
+type gcsObject struct {
+	Name string `json:"name"`
+	// Base64 encoded big-endian CRC32C checksum of the object data.
+	CRC32C string `json:"crc32c"`
+}
+
+// gcsRuleFiles mirrors the objects under a GCS prefix to a local directory, from
+// which they are loaded like the rule files of the configuration. Objects are only
+// downloaded again once their checksum changed.
+type gcsRuleFiles struct {
+	client *http.Client
+	// Base URL of the GCS JSON API.
+	endpoint string
+	bucket   string
+	prefix   string
+	dir      string
+
+	mtx sync.Mutex
+	// Checksums of the synced objects by object name.
+	checksums map[string]string
+}
+
+// newGCSRuleFiles returns rule files synced from the gs://<bucket>/<prefix> URL to
+// the directory.
+func newGCSRuleFiles(client *http.Client, gcsPrefix, dir string) (*gcsRuleFiles, error) {
+	u, err := url.Parse(gcsPrefix)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "gs" || u.Host == "" {
+		return nil, fmt.Errorf("invalid GCS prefix %q, must be of the form gs://<bucket>/<prefix>", gcsPrefix)
+	}
+	return &gcsRuleFiles{
+		client:    client,
+		endpoint:  gcsEndpoint,
+		bucket:    u.Host,
+		prefix:    strings.TrimPrefix(u.Path, "/"),
+		dir:       filepath.Clean(dir),
+		checksums: map[string]string{},
+	}, nil
+}
+
+// files returns the paths of the synced rule files.
+func (s *gcsRuleFiles) files() []string {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	var res []string
+	for name := range s.checksums {
+		res = append(res, s.localPath(name))
+	}
+	sort.Strings(res)
+	return res
+}
+
+// localPath returns the path an object is synced to, or an empty string if it
+// cannot be synced, e.g. because its name would escape the directory.
+func (s *gcsRuleFiles) localPath(name string) string {
+	if strings.HasSuffix(name, "/") {
+		return ""
+	}
+	p := filepath.Join(s.dir, filepath.FromSlash(strings.TrimPrefix(name, s.prefix)))
+	if !strings.HasPrefix(p, s.dir+string(filepath.Separator)) {
+		return ""
+	}
+	return p
+}
+
+// sync downloads the objects whose checksum changed since the last sync and removes
+// the files of deleted objects. It returns whether any rule files changed. If any
+// object fails to download, no files are changed.
+func (s *gcsRuleFiles) sync(ctx context.Context) (bool, error) {
+	objects, err := s.listObjects(ctx)
+	if err != nil {
+		return false, fmt.Errorf("list objects: %w", err)
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	present := map[string]bool{}
+	updated := map[string][]byte{}
+	for _, o := range objects {
+		if s.localPath(o.Name) == "" {
+			continue
+		}
+		present[o.Name] = true
+		if s.checksums[o.Name] == o.CRC32C {
+			continue
+		}
+		b, err := s.download(ctx, o)
+		if err != nil {
+			return false, fmt.Errorf("download %s: %w", o.Name, err)
+		}
+		updated[o.Name] = b
+	}
+	changed := false
+	for _, o := range objects {
+		b, ok := updated[o.Name]
+		if !ok {
+			continue
+		}
+		if err := writeFileAtomic(s.localPath(o.Name), b); err != nil {
+			return changed, err
+		}
+		s.checksums[o.Name] = o.CRC32C
+		changed = true
+	}
+	for name := range s.checksums {
+		if present[name] {
+			continue
+		}
+		if err := os.Remove(s.localPath(name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return changed, err
+		}
+		delete(s.checksums, name)
+		changed = true
+	}
+	return changed, nil
+}
+
+// listObjects returns all objects under the prefix.
+func (s *gcsRuleFiles) listObjects(ctx context.Context) ([]gcsObject, error) {
+	var (
+		res       []gcsObject
+		pageToken string
+	)
+	for {
+		q := url.Values{}
+		q.Set("prefix", s.prefix)
+		q.Set("fields", "items(name,crc32c),nextPageToken")
+		if pageToken != "" {
+			q.Set("pageToken", pageToken)
+		}
+		u := fmt.Sprintf("%s/b/%s/o?%s", s.endpoint, url.PathEscape(s.bucket), q.Encode())
+
+		var page struct {
+			Items         []gcsObject `json:"items"`
+			NextPageToken string      `json:"nextPageToken"`
+		}
+		b, err := s.get(ctx, u)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(b, &page); err != nil {
+			return nil, fmt.Errorf("decode object list: %w", err)
+		}
+		res = append(res, page.Items...)
+
+		if page.NextPageToken == "" {
+			return res, nil
+		}
+		pageToken = page.NextPageToken
+	}
+}
+
+// download returns the data of the object and verifies it against its checksum.
+func (s *gcsRuleFiles) download(ctx context.Context, o gcsObject) ([]byte, error) {
+	// Object names must be escaped as a single path segment.
+	name := strings.ReplaceAll(url.PathEscape(o.Name), "/", "%2F")
+	b, err := s.get(ctx, fmt.Sprintf("%s/b/%s/o/%s?alt=media", s.endpoint, url.PathEscape(s.bucket), name))
+	if err != nil {
+		return nil, err
+	}
+	if got := crc32cChecksum(b); got != o.CRC32C {
+		return nil, fmt.Errorf("checksum mismatch: want %s, got %s", o.CRC32C, got)
+	}
+	return b, nil
+}
+
+func (s *gcsRuleFiles) get(ctx context.Context, u string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s: %s", resp.Status, b)
+	}
+	return b, nil
+}
+
+// crc32cChecksum returns the checksum of the data in the format of GCS.
+func crc32cChecksum(b []byte) string {
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc32.Checksum(b, crc32.MakeTable(crc32.Castagnoli)))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// writeFileAtomic replaces the file with the data, so that rule reloads never see
+// partially written files.
+func writeFileAtomic(path string, b []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// runGCSRuleSync periodically syncs the rule files from GCS and reloads the
+// configuration when they changed, until the context is canceled.
+func runGCSRuleSync(ctx context.Context, logger log.Logger, s *gcsRuleFiles, interval time.Duration, reload func(context.Context) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		syncCtx, cancel := context.WithTimeout(ctx, interval)
+		changed, err := s.sync(syncCtx)
+		cancel()
+		if err != nil {
+			level.Error(logger).Log("msg", "Syncing rule files from GCS failed", "err", err)
+			gcsRuleSyncFailures.Inc()
+		}
+		if !changed {
+			continue
+		}
+		level.Info(logger).Log("msg", "Rule files in GCS changed, reloading")
+		if err := reload(ctx); err != nil {
+			level.Error(logger).Log("msg", "Error reloading config", "err", err)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// fakeGCS serves the objects of a bucket through the subset of the GCS JSON API
+// used to sync rule files.
+type fakeGCS struct {
+	bucket    string
+	objects   map[string]string
+	downloads int
+}
+
+func (f *fakeGCS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	listPath := "/b/" + f.bucket + "/o"
+	switch {
+	case r.URL.Path == listPath:
+		var items []gcsObject
+		for name, data := range f.objects {
+			if strings.HasPrefix(name, r.URL.Query().Get("prefix")) {
+				items = append(items, gcsObject{Name: name, CRC32C: crc32cChecksum([]byte(data))})
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"items": items})
+	case strings.HasPrefix(r.URL.Path, listPath+"/") && r.URL.Query().Get("alt") == "media":
+		data, ok := f.objects[strings.TrimPrefix(r.URL.Path, listPath+"/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		f.downloads++
+		w.Write([]byte(data))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestGCSRuleFiles(t *testing.T) {
+	gcs := &fakeGCS{
+		bucket: "bucket",
+		objects: map[string]string{
+			"rules/a.yaml":     "groups: []",
+			"rules/sub/b.yaml": "groups: []",
+			"other/c.yaml":     "groups: []",
+		},
+	}
+	srv := httptest.NewServer(gcs)
+	defer srv.Close()
+
+	dir := t.TempDir()
+	s, err := newGCSRuleFiles(srv.Client(), "gs://bucket/rules/", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.endpoint = srv.URL
+
+	sync := func(wantChanged bool, wantFiles ...string) {
+		t.Helper()
+		changed, err := s.sync(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if changed != wantChanged {
+			t.Errorf("unexpected change: want %v, got %v", wantChanged, changed)
+		}
+		var want []string
+		for _, f := range wantFiles {
+			want = append(want, filepath.Join(dir, f))
+		}
+		if diff := cmp.Diff(want, s.files()); diff != "" {
+			t.Errorf("unexpected files (-want, +got): %s", diff)
+		}
+	}
+	sync(true, "a.yaml", "sub/b.yaml")
+
+	// Unchanged objects are not downloaded again.
+	sync(false, "a.yaml", "sub/b.yaml")
+	if gcs.downloads != 2 {
+		t.Errorf("unexpected downloads: want 2, got %d", gcs.downloads)
+	}
+
+	gcs.objects["rules/a.yaml"] = "groups: [{name: a, rules: []}]"
+	delete(gcs.objects, "rules/sub/b.yaml")
+	sync(true, "a.yaml")
+
+	b, err := os.ReadFile(filepath.Join(dir, "a.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(b), gcs.objects["rules/a.yaml"]; got != want {
+		t.Errorf("unexpected file content: want %q, got %q", want, got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "sub/b.yaml")); !os.IsNotExist(err) {
+		t.Errorf("expected file of deleted object to be removed, got %v", err)
+	}
+}
+
+func TestNewGCSRuleFiles(t *testing.T) {
+	for _, prefix := range []string{"bucket/rules", "gs:///rules", "https://bucket/rules"} {
+		if _, err := newGCSRuleFiles(http.DefaultClient, prefix, t.TempDir()); err == nil {
+			t.Errorf("expected error for prefix %q", prefix)
+		}
+	}
+}
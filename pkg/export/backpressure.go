@@ -0,0 +1,193 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	backpressureActive = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "gcm_export_backpressure_active",
+		Help: "Whether the export queues have been above the backpressure threshold for long enough that scrapes of low priority pools are skipped or stretched.",
+	})
+	backpressureScrapesSkipped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "gcm_export_backpressure_scrapes_skipped_total",
+		Help: "Number of scrapes of low priority pools that were skipped because of backpressure from the export queues, by scrape pool.",
+	}, []string{"pool"})
+)
+
+const (
+	// DefaultBackpressureDuration is the default duration for which the export queues
+	// must exceed the backpressure threshold before scrapes are backed off.
+	DefaultBackpressureDuration = time.Minute
+
+	// Interval at which the utilization of the export queues is checked against the
+	// backpressure threshold.
+	backpressureCheckInterval = 5 * time.Second
+)
+
+// BackpressureOpts represents exporter options for backing off scrapes of low priority
+// scrape pools while the export queues are backed up, e.g. during a long GCM outage,
+// so that memory does not grow unboundedly.
+type BackpressureOpts struct {
+	// Threshold is the ratio of the capacity of the export queues that must be used
+	// for scrapes to be backed off. Disabled if 0.
+	Threshold float64
+	// Duration for which the queues must exceed the threshold before scrapes are backed
+	// off. Scrapes resume as soon as the queues are below the threshold again.
+	// Defaults to DefaultBackpressureDuration when 0.
+	Duration time.Duration
+	// Pools are the names of the low priority scrape pools, i.e. the job names of
+	// their scrape configs, whose scrapes are backed off.
+	Pools []string
+	// StretchFactor stretches the scrape interval of the low priority pools under
+	// backpressure by only running every StretchFactor-th scrape. All scrapes are
+	// skipped if 0.
+	StretchFactor int
+}
+
+func (o *BackpressureOpts) validate() error {
+	if o.Threshold < 0 || o.Threshold > 1 {
+		return fmt.Errorf("backpressure threshold must be between 0 and 1, got %f", o.Threshold)
+	}
+	if o.Duration == 0 {
+		o.Duration = DefaultBackpressureDuration
+	}
+	if o.Duration < 0 {
+		return fmt.Errorf("backpressure duration must be positive, got %s", o.Duration)
+	}
+	if o.StretchFactor < 0 {
+		return fmt.Errorf("backpressure stretch factor must not be negative, got %d", o.StretchFactor)
+	}
+	if o.Threshold > 0 && len(o.Pools) == 0 {
+		return fmt.Errorf("backpressure requires at least one low priority scrape pool")
+	}
+	return nil
+}
+
+// backpressure tracks whether the export queues have exceeded the threshold for the
+// configured duration and decides which scrapes of low priority pools are skipped.
+// A nil backpressure never skips scrapes.
+type backpressure struct {
+	logger log.Logger
+	opts   BackpressureOpts
+	pools  map[string]struct{}
+
+	mtx sync.Mutex
+	// Time since which the queues exceed the threshold. Zero if they do not.
+	exceededSince time.Time
+	active        bool
+	// Number of scrapes of each pool since backpressure became active.
+	scrapes map[string]int
+}
+
+func newBackpressure(logger log.Logger, opts BackpressureOpts) *backpressure {
+	if opts.Threshold == 0 {
+		return nil
+	}
+	b := &backpressure{
+		logger:  logger,
+		opts:    opts,
+		pools:   map[string]struct{}{},
+		scrapes: map[string]int{},
+	}
+	for _, p := range opts.Pools {
+		b.pools[p] = struct{}{}
+	}
+	return b
+}
+
+// update records the current utilization of the export queues.
+func (b *backpressure) update(utilization float64, now time.Time) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if utilization < b.opts.Threshold {
+		b.exceededSince = time.Time{}
+		if b.active {
+			level.Info(b.logger).Log("msg", "export queues recovered, resuming scrapes of low priority pools", "utilization", utilization)
+			b.setActive(false)
+		}
+		return
+	}
+	if b.exceededSince.IsZero() {
+		b.exceededSince = now
+	}
+	if !b.active && now.Sub(b.exceededSince) >= b.opts.Duration {
+		level.Warn(b.logger).Log("msg", "export queues backed up, backing off scrapes of low priority pools", "utilization", utilization, "pools", fmt.Sprint(b.opts.Pools))
+		b.setActive(true)
+	}
+}
+
+// setActive must be called with mtx held.
+func (b *backpressure) setActive(active bool) {
+	b.active = active
+	b.scrapes = map[string]int{}
+	if active {
+		backpressureActive.Set(1)
+	} else {
+		backpressureActive.Set(0)
+	}
+}
+
+// skip returns whether the next scrape of the pool is skipped.
+func (b *backpressure) skip(pool string) bool {
+	if b == nil {
+		return false
+	}
+	if _, ok := b.pools[pool]; !ok {
+		return false
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if !b.active {
+		return false
+	}
+	n := b.scrapes[pool]
+	b.scrapes[pool] = n + 1
+
+	if b.opts.StretchFactor > 0 && n%b.opts.StretchFactor == 0 {
+		return false
+	}
+	backpressureScrapesSkipped.WithLabelValues(pool).Inc()
+	return true
+}
+
+// queueUtilization returns the ratio of the capacity of all shards that is used.
+// It must only be called from Run.
+func (e *Exporter) queueUtilization() float64 {
+	var n int
+	for _, s := range e.shards {
+		n += s.length()
+	}
+	return float64(n) / float64(uint(len(e.shards))*e.shardCapacity())
+}
+
+// SkipScrape returns whether the scrape layer should skip the next scrape of a target
+// in the scrape pool because the export queues are backed up. It is called before
+// every scrape and always returns false for pools that are not low priority or if
+// backpressure is disabled. Upstream Prometheus has no such hook, so the scrape loop of
+// the Prometheus fork must call it for backpressure to have any effect.
+func (e *Exporter) SkipScrape(pool string) bool {
+	return e.backpressure.skip(pool)
+}
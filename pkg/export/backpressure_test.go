@@ -0,0 +1,94 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestBackpressureOpts_validate(t *testing.T) {
+	for _, o := range []BackpressureOpts{
+		{Threshold: 1.5, Pools: []string{"p1"}},
+		{Threshold: 0.5},
+		{Threshold: 0.5, Pools: []string{"p1"}, Duration: -time.Second},
+		{Threshold: 0.5, Pools: []string{"p1"}, StretchFactor: -1},
+	} {
+		if err := o.validate(); err == nil {
+			t.Errorf("expected error for %+v", o)
+		}
+	}
+	if newBackpressure(log.NewNopLogger(), BackpressureOpts{}) != nil {
+		t.Errorf("expected backpressure to be disabled without threshold")
+	}
+}
+
+func TestBackpressure(t *testing.T) {
+	backpressureScrapesSkipped.Reset()
+
+	opts := BackpressureOpts{Threshold: 0.8, Pools: []string{"low"}}
+	if err := opts.validate(); err != nil {
+		t.Fatal(err)
+	}
+	b := newBackpressure(log.NewNopLogger(), opts)
+	start := time.Unix(1000, 0)
+
+	// Scrapes are not backed off until the threshold was exceeded for the duration.
+	b.update(0.9, start)
+	b.update(0.9, start.Add(opts.Duration/2))
+	if b.skip("low") {
+		t.Fatalf("unexpected skip before the duration passed")
+	}
+	b.update(0.9, start.Add(opts.Duration))
+	if !b.skip("low") || !b.skip("low") {
+		t.Fatalf("expected scrapes of low priority pool to be skipped")
+	}
+	if b.skip("high") {
+		t.Errorf("unexpected skip of pool that is not low priority")
+	}
+	if got := testutil.ToFloat64(backpressureScrapesSkipped.WithLabelValues("low")); got != 2 {
+		t.Errorf("expected 2 skipped scrapes, got %v", got)
+	}
+
+	// Scrapes resume once the queues are below the threshold.
+	b.update(0.5, start.Add(opts.Duration+time.Second))
+	if b.skip("low") {
+		t.Errorf("unexpected skip after the queues recovered")
+	}
+
+	// With a stretch factor, every n-th scrape runs.
+	b.opts.StretchFactor = 3
+	b.update(0.9, start)
+	b.update(0.9, start.Add(opts.Duration))
+	var got []bool
+	for i := 0; i < 6; i++ {
+		got = append(got, b.skip("low"))
+	}
+	want := []bool{false, true, true, false, true, true}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected skips %v, got %v", want, got)
+		}
+	}
+
+	// A nil backpressure never skips.
+	var nilBackpressure *backpressure
+	if nilBackpressure.skip("low") {
+		t.Errorf("unexpected skip of disabled backpressure")
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/labels"
+)
+
+var seriesLimited = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "gcm_export_series_limited",
+	Help: "Number of active series that are not exported because their metric exceeds the series limit per metric, by metric name.",
+}, []string{"metric"})
+
+// admit counts the series towards the series limit of its metric. If the limit is
+// reached, the series is marked as limited and dropped instead. Series that were
+// admitted once keep being exported while they are active, so the same series are
+// dropped consistently rather than flapping.
+// Limited series are reconsidered on refresh once series of the metric became stale.
+// Series are also counted if only the bucket series limit of the type policy is set.
+// Must be called with mtx held.
+func (c *seriesCache) admit(e *seriesCacheEntry) {
+	if c.opts.MaxSeriesPerMetric <= 0 && c.typePolicy.MaxBucketSeries <= 0 {
+		return
+	}
+	name := e.lset.Get(labels.MetricName)
+
+	if c.opts.MaxSeriesPerMetric > 0 && c.metricSeries[name] >= c.opts.MaxSeriesPerMetric {
+		if !e.limited {
+			e.limited = true
+			e.dropped = true
+			c.addLimited(name, 1)
+		}
+		return
+	}
+	if e.limited {
+		e.limited = false
+		e.dropped = false
+		c.addLimited(name, -1)
+	}
+	e.counted = true
+	c.metricSeries[name]++
+}
+
+// release removes the series from the counts of its metric. Must be called with mtx held.
+func (c *seriesCache) release(e *seriesCacheEntry) {
+	name := e.lset.Get(labels.MetricName)
+
+	if e.counted {
+		if c.metricSeries[name]--; c.metricSeries[name] <= 0 {
+			delete(c.metricSeries, name)
+		}
+	}
+	if e.limited {
+		c.addLimited(name, -1)
+	}
+}
+
+// addLimited updates the number of limited series of the metric. Must be called with
+// mtx held.
+func (c *seriesCache) addLimited(name string, n int) {
+	before := c.limitedSeries[name]
+	c.limitedSeries[name] += n
+
+	after := c.limitedSeries[name]
+	if after <= 0 {
+		delete(c.limitedSeries, name)
+		seriesLimited.DeleteLabelValues(name)
+		return
+	}
+	if before == 0 {
+		level.Warn(c.logger).Log("msg", "metric exceeds series limit, new series are dropped", "metric", name, "limit", c.opts.MaxSeriesPerMetric)
+	}
+	seriesLimited.WithLabelValues(name).Set(float64(after))
+}
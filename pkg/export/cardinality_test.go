@@ -0,0 +1,86 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/textparse"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/prometheus/prometheus/tsdb/record"
+)
+
+func TestSeriesCache_maxSeriesPerMetric(t *testing.T) {
+	cache := newSeriesCache(nil, nil, MetricTypePrefix, nil)
+	cache.opts.MaxSeriesPerMetric = 2
+	cache.getLabelsByRef = func(ref storage.SeriesRef) labels.Labels {
+		// Series 1 to 3 belong to metric1, series 4 to metric2.
+		if ref == 4 {
+			return labels.FromStrings("__name__", "metric2")
+		}
+		return labels.FromStrings("__name__", "metric1", "instance", fmt.Sprintf("i%d", ref))
+	}
+	now := int64(100000)
+	cache.now = func() time.Time { return time.Unix(now, 0) }
+
+	externalLabels := labels.FromStrings("project_id", "p1", "location", "l1")
+	metadata := testMetadataFunc(metricMetadataMap{
+		"metric1": {Type: textparse.MetricTypeGauge},
+		"metric2": {Type: textparse.MetricTypeGauge},
+	})
+	dropped := func(ref chunks.HeadSeriesRef, ts int64) bool {
+		e, ok := cache.get(record.RefSample{Ref: ref, T: ts * 1000}, externalLabels, metadata)
+		if !ok {
+			t.Fatalf("no entry for series %d", ref)
+		}
+		return e.dropped
+	}
+	for ref := chunks.HeadSeriesRef(1); ref <= 4; ref++ {
+		if got, want := dropped(ref, now-100), ref == 3; got != want {
+			t.Errorf("expected dropped=%t for series %d, got %t", want, ref, got)
+		}
+	}
+	if got := testutil.ToFloat64(seriesLimited.WithLabelValues("metric1")); got != 1 {
+		t.Errorf("expected 1 limited series of metric1, got %v", got)
+	}
+	// Admitted series keep being exported.
+	if dropped(1, now) {
+		t.Errorf("expected admitted series to remain exported")
+	}
+
+	// Once series 2 became stale, series 3 is admitted on its next refresh.
+	dropped(3, now)
+	if err := cache.garbageCollect(50 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if cache.entry(2) != nil {
+		t.Fatalf("expected series 2 to be garbage collected")
+	}
+	cache.forceRefresh()
+	if dropped(3, now) {
+		t.Errorf("expected series 3 to be admitted")
+	}
+	if got := cache.metricSeries["metric1"]; got != 2 {
+		t.Errorf("expected 2 admitted series of metric1, got %d", got)
+	}
+	if _, ok := cache.limitedSeries["metric1"]; ok {
+		t.Errorf("expected no limited series of metric1")
+	}
+}
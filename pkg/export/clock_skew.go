@@ -0,0 +1,175 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	monitoring_pb "google.golang.org/genproto/googleapis/monitoring/v3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var (
+	clockSkew = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "gcm_export_clock_skew_seconds",
+		Help: "Estimated offset of the local clock from the GCM API server clock. Positive values indicate that the local clock is ahead.",
+	})
+)
+
+const (
+	// Minimum time between repeated warnings while the clock remains skewed.
+	clockSkewWarnInterval = time.Minute
+)
+
+// Supported policies for samples written while the local clock is skewed.
+const (
+	// The skew is only reported through logs and the gcm_export_clock_skew_seconds metric.
+	ClockSkewPolicyWarn = "warn"
+	// The timestamps of written samples are additionally shifted by the skew, so that
+	// GCM accepts samples of skewed nodes instead of rejecting them as out of range.
+	ClockSkewPolicyAdjust = "adjust"
+)
+
+// clockSkewDetector estimates the skew of the local clock from the Date header
+// of GCM API responses. Samples from skewed clocks are rejected by GCM as out of
+// range, which otherwise only surfaces as opaque write errors.
+type clockSkewDetector struct {
+	logger    log.Logger
+	threshold time.Duration
+	// Whether sample timestamps are adjusted by the skew.
+	adjust bool
+	now    func() time.Time
+
+	mtx      sync.Mutex
+	skew     time.Duration
+	skewed   bool
+	lastWarn time.Time
+	// Offset sample timestamps are adjusted by.
+	applied time.Duration
+}
+
+func newClockSkewDetector(logger log.Logger, threshold time.Duration, policy string) *clockSkewDetector {
+	return &clockSkewDetector{
+		logger:    logger,
+		threshold: threshold,
+		adjust:    policy == ClockSkewPolicyAdjust,
+		now:       time.Now,
+	}
+}
+
+// interceptor returns a gRPC client interceptor that observes the server time of
+// every response.
+func (d *clockSkewDetector) interceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		var header metadata.MD
+		start := d.now()
+		err := invoker(ctx, method, req, reply, cc, append(opts, grpc.Header(&header))...)
+		end := d.now()
+
+		if v := header.Get("date"); len(v) > 0 {
+			if serverTime, perr := http.ParseTime(v[0]); perr == nil {
+				d.observe(start.Add(end.Sub(start)/2), serverTime)
+			}
+		}
+		return err
+	}
+}
+
+// offset returns the last observed skew of the local clock. It is positive if the
+// local clock is ahead of the server clock.
+func (d *clockSkewDetector) offset() time.Duration {
+	if d == nil {
+		return 0
+	}
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	return d.skew
+}
+
+// adjustment returns the offset to subtract from sample timestamps. It is zero unless
+// the adjust policy is configured.
+func (d *clockSkewDetector) adjustment() time.Duration {
+	if d == nil || !d.adjust {
+		return 0
+	}
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	return d.applied
+}
+
+// adjustTimestamps shifts the interval of each point of the time series back by the
+// adjustment. Each time series must only be adjusted once.
+func (d *clockSkewDetector) adjustTimestamps(ts *monitoring_pb.TimeSeries) {
+	offset := d.adjustment()
+	if offset == 0 {
+		return
+	}
+	for _, p := range ts.Points {
+		if p.Interval.StartTime != nil {
+			p.Interval.StartTime = timestamppb.New(p.Interval.StartTime.AsTime().Add(-offset))
+		}
+		p.Interval.EndTime = timestamppb.New(p.Interval.EndTime.AsTime().Add(-offset))
+	}
+}
+
+// observe records the skew between the local time and the server time of a response.
+func (d *clockSkewDetector) observe(local, server time.Time) {
+	// The Date header has a resolution of one second. Truncating the local time
+	// the same way avoids reporting skew that is just an artifact of the resolution.
+	skew := local.Truncate(time.Second).Sub(server)
+	clockSkew.Set(skew.Seconds())
+
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	d.skew = skew
+	if d.threshold <= 0 {
+		return
+	}
+	abs := skew
+	if abs < 0 {
+		abs = -abs
+	}
+	// The estimate jitters by about a second due to the resolution of the Date header.
+	// Only follow it once it deviates by more than the threshold, so that the adjusted
+	// timestamps of a series stay in order.
+	if diff := skew - d.applied; d.adjust && (diff > d.threshold || diff < -d.threshold) {
+		level.Warn(d.logger).Log("msg", "Adjusting sample timestamps for clock skew", "skew", skew, "previous", d.applied)
+		d.applied = skew
+	}
+
+	if abs <= d.threshold {
+		if d.skewed {
+			level.Info(d.logger).Log("msg", "Local clock is no longer skewed against the GCM API", "skew", skew)
+			d.skewed = false
+		}
+		return
+	}
+	if !d.skewed || local.Sub(d.lastWarn) >= clockSkewWarnInterval {
+		level.Warn(d.logger).Log(
+			"msg", "Local clock is skewed against the GCM API. Samples with timestamps outside of the accepted range are rejected. Ensure the node's clock is synchronized, for example through NTP.",
+			"skew", skew, "threshold", d.threshold)
+		d.lastWarn = local
+	}
+	d.skewed = true
+}
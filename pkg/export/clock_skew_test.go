@@ -0,0 +1,147 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	monitoring_pb "google.golang.org/genproto/googleapis/monitoring/v3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestClockSkewDetector_Interceptor(t *testing.T) {
+	serverTime := time.Date(2022, time.January, 4, 10, 0, 0, 0, time.UTC)
+
+	var buf bytes.Buffer
+	d := newClockSkewDetector(log.NewLogfmtLogger(&buf), 30*time.Second, ClockSkewPolicyWarn)
+	d.now = func() time.Time { return serverTime.Add(time.Minute) }
+
+	// Fake invoker that returns the server time in the response header.
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		for _, o := range opts {
+			if h, ok := o.(grpc.HeaderCallOption); ok {
+				*h.HeaderAddr = metadata.Pairs("date", serverTime.Format(http.TimeFormat))
+			}
+		}
+		return nil
+	}
+	if err := d.interceptor()(context.Background(), "/test", nil, nil, nil, invoker); err != nil {
+		t.Fatal(err)
+	}
+	if v := testutil.ToFloat64(clockSkew); v != 60 {
+		t.Errorf("expected skew of 60s but got %v", v)
+	}
+	if got := d.offset(); got != time.Minute {
+		t.Errorf("expected offset of 1m but got %s", got)
+	}
+	if !strings.Contains(buf.String(), "Local clock is skewed") {
+		t.Errorf("expected warning but got %q", buf.String())
+	}
+}
+
+func TestClockSkewDetector_Observe(t *testing.T) {
+	var buf bytes.Buffer
+	d := newClockSkewDetector(log.NewLogfmtLogger(&buf), 30*time.Second, ClockSkewPolicyWarn)
+
+	server := time.Date(2022, time.January, 4, 10, 0, 0, 0, time.UTC)
+	warnings := func() int {
+		return strings.Count(buf.String(), "Local clock is skewed")
+	}
+
+	// Sub-second offsets are within the resolution of the Date header.
+	d.observe(server.Add(900*time.Millisecond), server)
+	if v := testutil.ToFloat64(clockSkew); v != 0 {
+		t.Errorf("expected no skew but got %v", v)
+	}
+
+	// Skew behind the server beyond the threshold warns once.
+	d.observe(server.Add(-45*time.Second), server)
+	d.observe(server.Add(-44*time.Second), server.Add(time.Second))
+	if v := testutil.ToFloat64(clockSkew); v != -45 {
+		t.Errorf("expected skew of -45s but got %v", v)
+	}
+	if n := warnings(); n != 1 {
+		t.Errorf("expected 1 warning but got %d", n)
+	}
+	// Warnings repeat after the warn interval.
+	d.observe(server.Add(-45*time.Second+clockSkewWarnInterval), server.Add(clockSkewWarnInterval))
+	if n := warnings(); n != 2 {
+		t.Errorf("expected 2 warnings but got %d", n)
+	}
+	// Recovery is logged and resets the state.
+	d.observe(server, server)
+	if !strings.Contains(buf.String(), "no longer skewed") {
+		t.Errorf("expected recovery message but got %q", buf.String())
+	}
+	d.observe(server.Add(time.Minute), server)
+	if n := warnings(); n != 3 {
+		t.Errorf("expected 3 warnings but got %d", n)
+	}
+}
+
+func TestClockSkewDetector_AdjustTimestamps(t *testing.T) {
+	d := newClockSkewDetector(log.NewNopLogger(), 30*time.Second, ClockSkewPolicyAdjust)
+
+	server := time.Date(2022, time.January, 4, 10, 0, 0, 0, time.UTC)
+	end := server.Add(time.Minute)
+	series := func() *monitoring_pb.TimeSeries {
+		return &monitoring_pb.TimeSeries{
+			Points: []*monitoring_pb.Point{{
+				Interval: &monitoring_pb.TimeInterval{
+					StartTime: timestamppb.New(server),
+					EndTime:   timestamppb.New(end),
+				},
+			}},
+		}
+	}
+	check := func(wantOffset time.Duration) {
+		t.Helper()
+		ts := series()
+		d.adjustTimestamps(ts)
+		if got := ts.Points[0].Interval.StartTime.AsTime(); !got.Equal(server.Add(-wantOffset)) {
+			t.Errorf("expected start time %s but got %s", server.Add(-wantOffset), got)
+		}
+		if got := ts.Points[0].Interval.EndTime.AsTime(); !got.Equal(end.Add(-wantOffset)) {
+			t.Errorf("expected end time %s but got %s", end.Add(-wantOffset), got)
+		}
+	}
+
+	// Skew within the threshold is not adjusted.
+	d.observe(server.Add(20*time.Second), server)
+	check(0)
+	// Skew beyond the threshold is adjusted.
+	d.observe(server.Add(45*time.Second), server)
+	check(45 * time.Second)
+	// Jitter of the estimate does not change the adjustment.
+	d.observe(server.Add(46*time.Second), server)
+	check(45 * time.Second)
+	// Once the clock is corrected, timestamps are no longer adjusted.
+	d.observe(server, server)
+	check(0)
+
+	// Timestamps are never adjusted with the warn policy.
+	d = newClockSkewDetector(log.NewNopLogger(), 30*time.Second, ClockSkewPolicyWarn)
+	d.observe(server.Add(45*time.Second), server)
+	check(0)
+}
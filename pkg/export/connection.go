@@ -0,0 +1,119 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+)
+
+var streamLimitWaits = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "gcm_export_stream_limit_waits_total",
+	Help: "Number of requests to GCM that waited because the stream limit of the connections was reached.",
+})
+
+const (
+	// DefaultConnectionPoolSize is the default number of gRPC connections to the GCM API.
+	DefaultConnectionPoolSize = 4
+	// DefaultMaxStreamsPerConnection is the default number of concurrent requests per
+	// connection to the GCM API.
+	DefaultMaxStreamsPerConnection = 100
+	// DefaultKeepaliveTime is the default time after which an idle connection to the
+	// GCM API is pinged.
+	DefaultKeepaliveTime = 30 * time.Second
+	// DefaultKeepaliveTimeout is the default time after which a connection to the GCM
+	// API is closed if a ping is not acknowledged.
+	DefaultKeepaliveTimeout = 10 * time.Second
+)
+
+// ConnectionOpts represents exporter options for the gRPC connections to the GCM API.
+// A single connection caps the throughput of collectors on large nodes.
+type ConnectionOpts struct {
+	// PoolSize is the number of connections requests are balanced across. Defaults
+	// to DefaultConnectionPoolSize when 0.
+	PoolSize int
+	// MaxStreamsPerConnection limits the number of concurrent requests per connection.
+	// Further requests wait until a request completes. Defaults to
+	// DefaultMaxStreamsPerConnection when 0.
+	MaxStreamsPerConnection int
+	// KeepaliveTime is the time after which an idle connection is pinged to check
+	// whether it is still alive. Defaults to DefaultKeepaliveTime when 0.
+	KeepaliveTime time.Duration
+	// KeepaliveTimeout is the time after which a connection is closed if a ping is not
+	// acknowledged. Defaults to DefaultKeepaliveTimeout when 0.
+	KeepaliveTimeout time.Duration
+}
+
+func (o *ConnectionOpts) validate() error {
+	if o.PoolSize == 0 {
+		o.PoolSize = DefaultConnectionPoolSize
+	}
+	if o.MaxStreamsPerConnection == 0 {
+		o.MaxStreamsPerConnection = DefaultMaxStreamsPerConnection
+	}
+	if o.KeepaliveTime == 0 {
+		o.KeepaliveTime = DefaultKeepaliveTime
+	}
+	if o.KeepaliveTimeout == 0 {
+		o.KeepaliveTimeout = DefaultKeepaliveTimeout
+	}
+	if o.PoolSize < 0 || o.MaxStreamsPerConnection < 0 {
+		return fmt.Errorf("connection pool size and streams per connection must be positive")
+	}
+	// gRPC raises keepalive times below 10s to 10s anyway.
+	if o.KeepaliveTime < 10*time.Second || o.KeepaliveTimeout < 0 {
+		return fmt.Errorf("keepalive time must be at least 10s and keepalive timeout positive, got %s and %s", o.KeepaliveTime, o.KeepaliveTimeout)
+	}
+	return nil
+}
+
+// clientOptions returns the client options for the connection pool and keepalives.
+func (o *ConnectionOpts) clientOptions() []option.ClientOption {
+	return []option.ClientOption{
+		option.WithGRPCConnectionPool(o.PoolSize),
+		option.WithGRPCDialOption(grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:    o.KeepaliveTime,
+			Timeout: o.KeepaliveTimeout,
+		})),
+	}
+}
+
+// streamLimiter returns an interceptor that limits the number of concurrent requests
+// across the connection pool to the streams allowed per connection.
+func (o *ConnectionOpts) streamLimiter() grpc.UnaryClientInterceptor {
+	sem := make(chan struct{}, o.PoolSize*o.MaxStreamsPerConnection)
+
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		select {
+		case sem <- struct{}{}:
+		default:
+			streamLimitWaits.Inc()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		defer func() { <-sem }()
+
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
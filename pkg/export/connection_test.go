@@ -0,0 +1,89 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+func TestConnectionOpts_validate(t *testing.T) {
+	var opts ConnectionOpts
+	if err := opts.validate(); err != nil {
+		t.Fatal(err)
+	}
+	want := ConnectionOpts{
+		PoolSize:                DefaultConnectionPoolSize,
+		MaxStreamsPerConnection: DefaultMaxStreamsPerConnection,
+		KeepaliveTime:           DefaultKeepaliveTime,
+		KeepaliveTimeout:        DefaultKeepaliveTimeout,
+	}
+	if opts != want {
+		t.Errorf("expected defaults %+v, got %+v", want, opts)
+	}
+	for _, opts := range []ConnectionOpts{
+		{PoolSize: -1},
+		{MaxStreamsPerConnection: -1},
+		{KeepaliveTime: time.Second},
+	} {
+		if err := opts.validate(); err == nil {
+			t.Errorf("expected error for %+v", opts)
+		}
+	}
+}
+
+func TestConnectionOpts_streamLimiter(t *testing.T) {
+	opts := ConnectionOpts{PoolSize: 1, MaxStreamsPerConnection: 2}
+	limiter := opts.streamLimiter()
+
+	release := make(chan struct{})
+	started := make(chan struct{}, 3)
+	blocking := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		started <- struct{}{}
+		<-release
+		return nil
+	}
+	for i := 0; i < 2; i++ {
+		go limiter(context.Background(), "", nil, nil, nil, blocking)
+	}
+	<-started
+	<-started
+
+	// A third request waits for a stream and gives up once its context is canceled.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := limiter(ctx, "", nil, nil, nil, blocking); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	close(release)
+
+	// Requests proceed again once the pending ones completed.
+	done := make(chan error)
+	go func() {
+		done <- limiter(context.Background(), "", nil, nil, nil, blocking)
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("request did not complete")
+	}
+}
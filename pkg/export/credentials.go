@@ -0,0 +1,191 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	monitoring "cloud.google.com/go/monitoring/apiv3/v2"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var credentialClients = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "gcm_export_namespace_credential_clients",
+	Help: "Number of cached metric clients for namespace credentials.",
+})
+
+// DefaultNamespaceCredentialsIdleTimeout is the default time after which the metric
+// client for namespace credentials is closed if it was not used.
+const DefaultNamespaceCredentialsIdleTimeout = 10 * time.Minute
+
+// NamespaceCredentialsOpts represents exporter options for writing the series of a
+// namespace with dedicated credentials, e.g. the GCP service account of a tenant.
+type NamespaceCredentialsOpts struct {
+	// Files maps namespaces to credentials files, e.g. Workload Identity Federation
+	// credential configurations, used for requests with the series of the namespace.
+	// They take precedence over the credentials of the project. The namespace is taken
+	// from the namespace label of the monitored resource.
+	Files map[string]string
+	// IdleTimeout is the time after which the client for a credentials file is closed
+	// if it was not used. Defaults to DefaultNamespaceCredentialsIdleTimeout when 0.
+	IdleTimeout time.Duration
+}
+
+func (o *NamespaceCredentialsOpts) validate() error {
+	for namespace, file := range o.Files {
+		if namespace == "" || file == "" {
+			return fmt.Errorf("invalid namespace credentials %q=%q", namespace, file)
+		}
+	}
+	if o.IdleTimeout == 0 {
+		o.IdleTimeout = DefaultNamespaceCredentialsIdleTimeout
+	}
+	if o.IdleTimeout < 0 {
+		return fmt.Errorf("namespace credentials idle timeout must be positive, got %s", o.IdleTimeout)
+	}
+	return nil
+}
+
+type credentialsFileKey struct{}
+
+// withCredentialsFile returns a context for a request to GCM made with the client for
+// the given credentials file.
+func withCredentialsFile(ctx context.Context, file string) context.Context {
+	return context.WithValue(ctx, credentialsFileKey{}, file)
+}
+
+func credentialsFileFromContext(ctx context.Context) string {
+	file, _ := ctx.Value(credentialsFileKey{}).(string)
+	return file
+}
+
+// clientCache lazily creates metric clients by credentials file. Clients are recreated
+// when their file changes, e.g. as credentials are rotated, and closed once they were not
+// used for the idle timeout.
+type clientCache struct {
+	logger      log.Logger
+	idleTimeout time.Duration
+	now         func() time.Time
+	newClient   func(file string) (*monitoring.MetricClient, error)
+
+	mtx     sync.Mutex
+	entries map[string]*clientCacheEntry
+	// Clients replaced after their file changed. They may still be used by in-flight
+	// requests and are closed once idle.
+	retired []*clientCacheEntry
+}
+
+type clientCacheEntry struct {
+	client   *monitoring.MetricClient
+	modTime  time.Time
+	lastUsed time.Time
+}
+
+func newClientCache(logger log.Logger, idleTimeout time.Duration, newClient func(string) (*monitoring.MetricClient, error)) *clientCache {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	return &clientCache{
+		logger:      logger,
+		idleTimeout: idleTimeout,
+		now:         time.Now,
+		newClient:   newClient,
+		entries:     map[string]*clientCacheEntry{},
+	}
+}
+
+// get returns the client for the credentials file.
+func (c *clientCache) get(file string) (*monitoring.MetricClient, error) {
+	fi, err := os.Stat(file)
+	if err != nil {
+		return nil, fmt.Errorf("stat credentials file: %w", err)
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	now := c.now()
+	if e, ok := c.entries[file]; ok {
+		if e.modTime.Equal(fi.ModTime()) {
+			e.lastUsed = now
+			return e.client, nil
+		}
+		level.Info(c.logger).Log("msg", "credentials file changed, creating new metric client", "file", file)
+		c.retired = append(c.retired, e)
+		delete(c.entries, file)
+	}
+	client, err := c.newClient(file)
+	if err != nil {
+		return nil, fmt.Errorf("create metric client for credentials file %q: %w", file, err)
+	}
+	c.entries[file] = &clientCacheEntry{client: client, modTime: fi.ModTime(), lastUsed: now}
+	credentialClients.Set(float64(len(c.entries)))
+	return client, nil
+}
+
+// closeIdle closes the clients that were not used for the idle timeout.
+func (c *clientCache) closeIdle() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	cutoff := c.now().Add(-c.idleTimeout)
+	for file, e := range c.entries {
+		if e.lastUsed.Before(cutoff) {
+			e.client.Close()
+			delete(c.entries, file)
+		}
+	}
+	retired := c.retired[:0]
+	for _, e := range c.retired {
+		if e.lastUsed.Before(cutoff) {
+			e.client.Close()
+		} else {
+			retired = append(retired, e)
+		}
+	}
+	c.retired = retired
+	credentialClients.Set(float64(len(c.entries)))
+}
+
+// run closes idle clients periodically until the context is canceled and closes all
+// clients afterwards.
+func (c *clientCache) run(ctx context.Context) {
+	ticker := time.NewTicker(c.idleTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			c.mtx.Lock()
+			for _, e := range c.entries {
+				e.client.Close()
+			}
+			for _, e := range c.retired {
+				e.client.Close()
+			}
+			c.entries, c.retired = map[string]*clientCacheEntry{}, nil
+			credentialClients.Set(0)
+			c.mtx.Unlock()
+			return
+		case <-ticker.C:
+			c.closeIdle()
+		}
+	}
+}
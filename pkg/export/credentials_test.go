@@ -0,0 +1,123 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	monitoring "cloud.google.com/go/monitoring/apiv3/v2"
+	"github.com/google/go-cmp/cmp"
+	gax "github.com/googleapis/gax-go/v2"
+	"google.golang.org/api/option"
+	monitoredres_pb "google.golang.org/genproto/googleapis/api/monitoredres"
+	monitoring_pb "google.golang.org/genproto/googleapis/monitoring/v3"
+	"google.golang.org/grpc"
+)
+
+func TestClientCache(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "credentials.json")
+	if err := os.WriteFile(file, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	created := 0
+	cache := newClientCache(nil, time.Minute, func(string) (*monitoring.MetricClient, error) {
+		created++
+		return monitoring.NewMetricClient(context.Background(),
+			option.WithoutAuthentication(),
+			option.WithGRPCDialOption(grpc.WithInsecure()),
+			option.WithEndpoint("localhost:0"),
+		)
+	})
+	now := time.Unix(1000, 0)
+	cache.now = func() time.Time { return now }
+
+	c1, err := cache.get(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2, err := cache.get(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c1 != c2 || created != 1 {
+		t.Fatalf("expected client to be reused, created %d clients", created)
+	}
+
+	// A changed file results in a new client while the old one is retired.
+	if err := os.Chtimes(file, now, now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	c3, err := cache.get(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c3 == c1 || created != 2 || len(cache.retired) != 1 {
+		t.Fatalf("expected new client after file change, created %d clients", created)
+	}
+
+	// Clients are kept until they were idle for the timeout.
+	now = now.Add(30 * time.Second)
+	cache.closeIdle()
+	if len(cache.entries) != 1 || len(cache.retired) != 1 {
+		t.Fatalf("expected clients to be kept")
+	}
+	now = now.Add(time.Minute)
+	cache.closeIdle()
+	if len(cache.entries) != 0 || len(cache.retired) != 0 {
+		t.Fatalf("expected idle clients to be closed")
+	}
+
+	if _, err := cache.get(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Errorf("expected error for missing credentials file")
+	}
+}
+
+func TestBatchSendNamespaceCredentials(t *testing.T) {
+	b := newBatch(nil, DefaultShardCount, 100)
+	b.credentials = map[string]string{"tenant": "tenant.json"}
+
+	for _, namespace := range []string{"tenant", "tenant", "other", ""} {
+		b.add(&monitoring_pb.TimeSeries{
+			Resource: &monitoredres_pb.MonitoredResource{
+				Labels: map[string]string{
+					KeyProjectID: "p1",
+					KeyNamespace: namespace,
+				},
+			},
+		})
+	}
+	var (
+		mtx  sync.Mutex
+		reqs []string
+	)
+	b.send(context.Background(), func(ctx context.Context, req *monitoring_pb.CreateTimeSeriesRequest, opts ...gax.CallOption) error {
+		mtx.Lock()
+		defer mtx.Unlock()
+		reqs = append(reqs, credentialsFileFromContext(ctx)+":"+string(rune('0'+len(req.TimeSeries))))
+		return nil
+	})
+	sort.Strings(reqs)
+
+	// Samples of namespaces with credentials are sent in a separate request.
+	if diff := cmp.Diff([]string{":2", "tenant.json:2"}, reqs); diff != "" {
+		t.Errorf("unexpected requests (-want, +got): %s", diff)
+	}
+}
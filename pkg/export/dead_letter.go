@@ -0,0 +1,215 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	monitoring_pb "google.golang.org/genproto/googleapis/monitoring/v3"
+)
+
+var deadLetterRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "gcm_export_dead_letter_requests_total",
+	Help: "Number of requests rejected by GCM that were written to or skipped by the dead-letter log, by result.",
+}, []string{"result"})
+
+const (
+	// DefaultDeadLetterSampleRatio is the default ratio of rejected requests that are
+	// written to the dead-letter log.
+	DefaultDeadLetterSampleRatio = 0.01
+	// DefaultDeadLetterMaxSeries is the default number of series of a rejected request
+	// that are written to the dead-letter log.
+	DefaultDeadLetterMaxSeries = 10
+	// DefaultDeadLetterMaxBytes is the default size limit of the dead-letter log.
+	DefaultDeadLetterMaxBytes = 64 << 20
+)
+
+// DeadLetterOpts represents exporter options for logging series of requests that
+// were permanently rejected by GCM, e.g. for invalid labels or out of order samples.
+type DeadLetterOpts struct {
+	// Path is the file the rejected series are appended to as JSON lines, each holding
+	// the series of one request and the exact error returned by GCM. The dead-letter
+	// log is disabled if empty.
+	Path string
+	// SampleRatio is the ratio of rejected requests that are logged.
+	// Defaults to DefaultDeadLetterSampleRatio when 0.
+	SampleRatio float64
+	// MaxSeries is the maximum number of series logged per rejected request.
+	// Defaults to DefaultDeadLetterMaxSeries when 0.
+	MaxSeries int
+	// MaxBytes limits the size of the log. If exceeded, the file is moved to Path
+	// with a ".1" suffix, replacing the previous one, and a new file is started.
+	// Defaults to DefaultDeadLetterMaxBytes when 0.
+	MaxBytes int64
+}
+
+func (o *DeadLetterOpts) validate() error {
+	if o.SampleRatio == 0 {
+		o.SampleRatio = DefaultDeadLetterSampleRatio
+	}
+	if o.SampleRatio < 0 || o.SampleRatio > 1 {
+		return fmt.Errorf("dead-letter sample ratio must be between 0 and 1, got %f", o.SampleRatio)
+	}
+	if o.MaxSeries == 0 {
+		o.MaxSeries = DefaultDeadLetterMaxSeries
+	}
+	if o.MaxSeries < 0 {
+		return fmt.Errorf("dead-letter maximum series must be positive, got %d", o.MaxSeries)
+	}
+	if o.MaxBytes == 0 {
+		o.MaxBytes = DefaultDeadLetterMaxBytes
+	}
+	if o.MaxBytes < 0 {
+		return fmt.Errorf("dead-letter log size must be positive, got %d", o.MaxBytes)
+	}
+	return nil
+}
+
+// deadLetterRecord is a line of the dead-letter log.
+type deadLetterRecord struct {
+	Time    time.Time `json:"time"`
+	Project string    `json:"project"`
+	Reason  string    `json:"reason"`
+	Code    string    `json:"code"`
+	Error   string    `json:"error"`
+	// Number of series of the request, of which at most MaxSeries are logged.
+	TotalSeries int               `json:"totalSeries"`
+	Series      []json.RawMessage `json:"series"`
+}
+
+// deadLetterLog appends a sample of the series of rejected requests to a file.
+type deadLetterLog struct {
+	opts DeadLetterOpts
+	rand func() float64
+
+	mtx  sync.Mutex
+	f    *os.File
+	size int64
+}
+
+func openDeadLetterLog(opts DeadLetterOpts) (*deadLetterLog, error) {
+	l := &deadLetterLog{opts: opts, rand: rand.Float64}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *deadLetterLog) open() error {
+	f, err := os.OpenFile(l.opts.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o666)
+	if err != nil {
+		return fmt.Errorf("open dead-letter log: %w", err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("stat dead-letter log: %w", err)
+	}
+	l.f, l.size = f, fi.Size()
+	return nil
+}
+
+// rotate replaces the previous log file with the current one and starts a new one.
+func (l *deadLetterLog) rotate() error {
+	if err := l.f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(l.opts.Path, l.opts.Path+".1"); err != nil {
+		return err
+	}
+	return l.open()
+}
+
+// add logs the series of a request that failed with err if it was rejected for a
+// reason the owners of the series can act on and the request is sampled.
+func (l *deadLetterLog) add(project string, series []*monitoring_pb.TimeSeries, reason string, err error, now time.Time) error {
+	if !targetRejectionReasons[reason] {
+		return nil
+	}
+	if l.rand() >= l.opts.SampleRatio {
+		deadLetterRequests.WithLabelValues("skipped").Inc()
+		return nil
+	}
+	st := status.Convert(err)
+	rec := deadLetterRecord{
+		Time:        now,
+		Project:     project,
+		Reason:      reason,
+		Code:        st.Code().String(),
+		Error:       st.Message(),
+		TotalSeries: len(series),
+	}
+	if len(series) > l.opts.MaxSeries {
+		series = series[:l.opts.MaxSeries]
+	}
+	for _, s := range series {
+		b, err := protojson.Marshal(s)
+		if err != nil {
+			deadLetterRequests.WithLabelValues("failed").Inc()
+			return fmt.Errorf("marshal series: %w", err)
+		}
+		rec.Series = append(rec.Series, b)
+	}
+	b, err := json.Marshal(rec)
+	if err != nil {
+		deadLetterRequests.WithLabelValues("failed").Inc()
+		return fmt.Errorf("marshal dead-letter record: %w", err)
+	}
+	b = append(b, '\n')
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	if l.f == nil {
+		deadLetterRequests.WithLabelValues("failed").Inc()
+		return fmt.Errorf("dead-letter log is closed")
+	}
+	if l.size > 0 && l.size+int64(len(b)) > l.opts.MaxBytes {
+		if err := l.rotate(); err != nil {
+			l.f = nil
+			deadLetterRequests.WithLabelValues("failed").Inc()
+			return fmt.Errorf("rotate dead-letter log: %w", err)
+		}
+	}
+	n, err := l.f.Write(b)
+	l.size += int64(n)
+	if err != nil {
+		deadLetterRequests.WithLabelValues("failed").Inc()
+		return fmt.Errorf("write dead-letter log: %w", err)
+	}
+	deadLetterRequests.WithLabelValues("written").Inc()
+	return nil
+}
+
+func (l *deadLetterLog) close() error {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	if l.f == nil {
+		return nil
+	}
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
@@ -0,0 +1,166 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/testing/protocmp"
+
+	"github.com/google/go-cmp/cmp"
+	metric_pb "google.golang.org/genproto/googleapis/api/metric"
+	monitoring_pb "google.golang.org/genproto/googleapis/monitoring/v3"
+)
+
+func readDeadLetters(t *testing.T, path string) []deadLetterRecord {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var res []deadLetterRecord
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		var rec deadLetterRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			t.Fatal(err)
+		}
+		res = append(res, rec)
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestDeadLetterLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dead_letters.jsonl")
+	opts := DeadLetterOpts{Path: path, SampleRatio: 0.5, MaxSeries: 2}
+	if err := opts.validate(); err != nil {
+		t.Fatal(err)
+	}
+	l, err := openDeadLetterLog(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.close()
+
+	var r float64
+	l.rand = func() float64 { return r }
+
+	series := []*monitoring_pb.TimeSeries{
+		{Metric: &metric_pb.Metric{Type: "prometheus.googleapis.com/a/gauge"}},
+		{Metric: &metric_pb.Metric{Type: "prometheus.googleapis.com/b/gauge"}},
+		{Metric: &metric_pb.Metric{Type: "prometheus.googleapis.com/c/gauge"}},
+	}
+	now := time.Unix(1000, 0).UTC()
+	rejected := status.Error(codes.InvalidArgument, "Field timeSeries[0].labels had an invalid value")
+
+	if err := l.add("p1", series, "invalid-labels", rejected, now); err != nil {
+		t.Fatal(err)
+	}
+	// Requests that failed for reasons other than their series are not logged.
+	if err := l.add("p1", series, "quota", status.Error(codes.ResourceExhausted, "quota"), now); err != nil {
+		t.Fatal(err)
+	}
+	// Requests that are not sampled are not logged.
+	r = 0.5
+	if err := l.add("p2", series, "invalid-labels", rejected, now); err != nil {
+		t.Fatal(err)
+	}
+
+	got := readDeadLetters(t, path)
+	if len(got) != 1 {
+		t.Fatalf("expected 1 record, got %d", len(got))
+	}
+	rec := got[0]
+	if rec.Project != "p1" || rec.Reason != "invalid-labels" || rec.Code != "InvalidArgument" || rec.TotalSeries != 3 {
+		t.Errorf("unexpected record %+v", rec)
+	}
+	if rec.Error != "Field timeSeries[0].labels had an invalid value" {
+		t.Errorf("unexpected error %q", rec.Error)
+	}
+	if !rec.Time.Equal(now) {
+		t.Errorf("expected time %s, got %s", now, rec.Time)
+	}
+	if len(rec.Series) != 2 {
+		t.Fatalf("expected 2 series, got %d", len(rec.Series))
+	}
+	for i, b := range rec.Series {
+		var s monitoring_pb.TimeSeries
+		if err := protojson.Unmarshal(b, &s); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(series[i], &s, protocmp.Transform()); diff != "" {
+			t.Errorf("unexpected series %d (-want, +got): %s", i, diff)
+		}
+	}
+}
+
+func TestDeadLetterLog_rotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dead_letters.jsonl")
+	opts := DeadLetterOpts{Path: path, SampleRatio: 1, MaxBytes: 300}
+	if err := opts.validate(); err != nil {
+		t.Fatal(err)
+	}
+	l, err := openDeadLetterLog(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	series := []*monitoring_pb.TimeSeries{
+		{Metric: &metric_pb.Metric{Type: "prometheus.googleapis.com/a/gauge"}},
+	}
+	rejected := status.Error(codes.InvalidArgument, "invalid")
+
+	for i := 0; i < 3; i++ {
+		if err := l.add("p1", series, "too-old", rejected, time.Unix(int64(i), 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.close(); err != nil {
+		t.Fatal(err)
+	}
+	// Every record exceeds half of the size limit, so each one starts a new file.
+	if got := readDeadLetters(t, path); len(got) != 1 || got[0].Time.Unix() != 2 {
+		t.Errorf("unexpected records in current file: %+v", got)
+	}
+	if got := readDeadLetters(t, path+".1"); len(got) != 1 || got[0].Time.Unix() != 1 {
+		t.Errorf("unexpected records in previous file: %+v", got)
+	}
+
+	// Records are appended to the existing file after a restart.
+	l, err = openDeadLetterLog(DeadLetterOpts{Path: path, SampleRatio: 1, MaxSeries: 1, MaxBytes: 1 << 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.close()
+	if err := l.add("p1", series, "too-old", rejected, time.Unix(3, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if got := readDeadLetters(t, path); len(got) != 2 {
+		t.Errorf("expected 2 records after restart, got %d", len(got))
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/status"
+)
+
+// maxRecentErrors is the number of distinct send errors kept for the debug endpoint.
+const maxRecentErrors = 20
+
+// DebugStatus is a snapshot of the exporter's state to debug export lag.
+type DebugStatus struct {
+	Paused bool `json:"paused"`
+	// Samples are assigned to shards by their series hash modulo the shard count.
+	ShardCount int           `json:"shardCount"`
+	Shards     []ShardStatus `json:"shards"`
+	// Total number of samples queued across all shards.
+	QueuedSamples int `json:"queuedSamples"`
+	// Age of the oldest sample queued in any shard.
+	OldestSampleAgeSeconds float64 `json:"oldestSampleAgeSeconds"`
+	// Whether samples are queued in the disk buffer.
+	DiskBufferPending bool `json:"diskBufferPending"`
+	// Distinct send errors, most recent first.
+	RecentErrors []ErrorSummary `json:"recentErrors"`
+}
+
+// ShardStatus is the state of a single shard.
+type ShardStatus struct {
+	Index int `json:"index"`
+	// Number of queued samples.
+	QueueLength int `json:"queueLength"`
+	// Whether the shard has samples in an in-flight batch.
+	Pending bool `json:"pending"`
+	// Age of the oldest queued sample, 0 if the queue is empty.
+	OldestSampleAgeSeconds float64 `json:"oldestSampleAgeSeconds"`
+}
+
+// ErrorSummary aggregates send errors with the same project, class, and message.
+type ErrorSummary struct {
+	Project   string    `json:"project"`
+	Class     string    `json:"class"`
+	Message   string    `json:"message"`
+	Count     int       `json:"count"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+}
+
+type errorKey struct {
+	project, class, message string
+}
+
+// errorLog keeps summaries of the most recent distinct send errors.
+type errorLog struct {
+	mtx     sync.Mutex
+	entries map[errorKey]*ErrorSummary
+}
+
+func newErrorLog() *errorLog {
+	return &errorLog{entries: map[errorKey]*ErrorSummary{}}
+}
+
+// record adds a failed request to the given project to the log.
+func (l *errorLog) record(project string, err error, now time.Time) {
+	key := errorKey{
+		project: project,
+		class:   errorClass(err),
+		message: status.Convert(err).Message(),
+	}
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	e, ok := l.entries[key]
+	if !ok {
+		// Evict the entry that was seen least recently to make room.
+		if len(l.entries) >= maxRecentErrors {
+			var (
+				oldest    *ErrorSummary
+				oldestKey errorKey
+			)
+			for k, e := range l.entries {
+				if oldest == nil || e.LastSeen.Before(oldest.LastSeen) {
+					oldest, oldestKey = e, k
+				}
+			}
+			delete(l.entries, oldestKey)
+		}
+		e = &ErrorSummary{
+			Project:   key.project,
+			Class:     key.class,
+			Message:   key.message,
+			FirstSeen: now,
+		}
+		l.entries[key] = e
+	}
+	e.Count++
+	e.LastSeen = now
+}
+
+// summary returns the logged errors, most recent first.
+func (l *errorLog) summary() []ErrorSummary {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	res := make([]ErrorSummary, 0, len(l.entries))
+	for _, e := range l.entries {
+		res = append(res, *e)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].LastSeen.After(res[j].LastSeen)
+	})
+	return res
+}
+
+// status returns the number of queued samples, whether the shard is pending, and the
+// end time of the oldest queued sample.
+func (s *shard) status() (length int, pending bool, oldest time.Time) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	for _, q := range s.queues() {
+		e, ok := q.peek()
+		if !ok || len(e.sample.Points) == 0 {
+			continue
+		}
+		if t := e.sample.Points[0].Interval.EndTime.AsTime(); oldest.IsZero() || t.Before(oldest) {
+			oldest = t
+		}
+	}
+	return s.lengthLocked(), s.pending, oldest
+}
+
+// DebugStatus returns a snapshot of the exporter's state.
+func (e *Exporter) DebugStatus() DebugStatus {
+	now := time.Now()
+	res := DebugStatus{Paused: e.Paused()}
+
+	e.shardsMtx.RLock()
+	res.ShardCount = len(e.shards)
+	res.Shards = make([]ShardStatus, 0, len(e.shards))
+
+	var oldest time.Time
+	for i, s := range e.shards {
+		length, pending, t := s.status()
+		st := ShardStatus{Index: i, QueueLength: length, Pending: pending}
+		if !t.IsZero() {
+			st.OldestSampleAgeSeconds = now.Sub(t).Seconds()
+			if oldest.IsZero() || t.Before(oldest) {
+				oldest = t
+			}
+		}
+		res.Shards = append(res.Shards, st)
+		res.QueuedSamples += length
+	}
+	res.DiskBufferPending = e.diskBuffer != nil && !e.diskBufferEmpty()
+	e.shardsMtx.RUnlock()
+
+	if !oldest.IsZero() {
+		res.OldestSampleAgeSeconds = now.Sub(oldest).Seconds()
+	}
+	if e.sendErrors != nil {
+		res.RecentErrors = e.sendErrors.summary()
+	}
+	return res
+}
+
+// DebugHandler returns a handler that serves the exporter's DebugStatus as JSON.
+func (e *Exporter) DebugHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Only GET requests allowed.", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(e.DebugStatus()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	monitoring_pb "google.golang.org/genproto/googleapis/monitoring/v3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestErrorLog(t *testing.T) {
+	l := newErrorLog()
+	start := time.Unix(1000, 0)
+
+	l.record("p1", status.Error(codes.InvalidArgument, "bad"), start)
+	l.record("p1", status.Error(codes.InvalidArgument, "bad"), start.Add(time.Second))
+	l.record("p2", status.Error(codes.Unavailable, "down"), start.Add(2*time.Second))
+
+	got := l.summary()
+	if len(got) != 2 {
+		t.Fatalf("expected 2 summaries, got %v", got)
+	}
+	if got[0].Project != "p2" || got[0].Class != errorClassRetryable || got[0].Count != 1 {
+		t.Errorf("unexpected most recent summary %+v", got[0])
+	}
+	if got[1].Project != "p1" || got[1].Count != 2 || got[1].Message != "bad" ||
+		!got[1].FirstSeen.Equal(start) || !got[1].LastSeen.Equal(start.Add(time.Second)) {
+		t.Errorf("unexpected summary %+v", got[1])
+	}
+
+	// The least recently seen errors are evicted once the limit is reached.
+	for i := 0; i < maxRecentErrors; i++ {
+		l.record("p3", fmt.Errorf("error %d", i), start.Add(time.Duration(3+i)*time.Second))
+	}
+	got = l.summary()
+	if len(got) != maxRecentErrors {
+		t.Fatalf("expected %d summaries, got %d", maxRecentErrors, len(got))
+	}
+	for _, s := range got {
+		if s.Project != "p3" {
+			t.Errorf("expected summary to be evicted: %+v", s)
+		}
+	}
+}
+
+func TestExporter_DebugHandler(t *testing.T) {
+	e, err := New(nil, nil, ExporterOpts{DisableAuth: true, Efficiency: EfficiencyOpts{ShardCount: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	e.shards[1].enqueue(queueEntry{hash: 1, sample: &monitoring_pb.TimeSeries{
+		Points: []*monitoring_pb.Point{{
+			Interval: &monitoring_pb.TimeInterval{EndTime: getTimestamp(now.Add(-time.Minute).UnixMilli())},
+		}},
+	}})
+	e.sendErrors.record("p1", status.Error(codes.PermissionDenied, "denied"), now)
+
+	rec := httptest.NewRecorder()
+	e.DebugHandler()(rec, httptest.NewRequest(http.MethodPost, "/-/export/debug", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status %d for POST, got %d", http.StatusMethodNotAllowed, rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	e.DebugHandler()(rec, httptest.NewRequest(http.MethodGet, "/-/export/debug", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d", rec.Code)
+	}
+	var got DebugStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.ShardCount != 2 || got.QueuedSamples != 1 || got.Shards[1].QueueLength != 1 {
+		t.Errorf("unexpected shard status %+v", got)
+	}
+	if got.OldestSampleAgeSeconds < 60 || got.Shards[0].OldestSampleAgeSeconds != 0 {
+		t.Errorf("unexpected oldest sample age %+v", got)
+	}
+	if len(got.RecentErrors) != 1 || got.RecentErrors[0].Message != "denied" {
+		t.Errorf("unexpected recent errors %+v", got.RecentErrors)
+	}
+}
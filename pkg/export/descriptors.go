@@ -0,0 +1,253 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	gax "github.com/googleapis/gax-go/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/time/rate"
+
+	label_pb "google.golang.org/genproto/googleapis/api/label"
+	metric_pb "google.golang.org/genproto/googleapis/api/metric"
+	monitoring_pb "google.golang.org/genproto/googleapis/monitoring/v3"
+)
+
+var metricDescriptorWrites = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "gcm_export_metric_descriptor_writes_total",
+	Help: "Number of metric descriptors written to GCM by whether the write succeeded, failed, or was dropped because the queue was full.",
+}, []string{"result"})
+
+const (
+	// DefaultMetricDescriptorRateLimit is the default maximum number of metric
+	// descriptor writes per second.
+	DefaultMetricDescriptorRateLimit = 1.0
+
+	// Number of metric descriptors that can be queued for writing.
+	metricDescriptorQueueSize = 1000
+)
+
+// MetricDescriptorOpts represents exporter options for writing the metadata of scraped
+// metrics as metric descriptors to GCM.
+type MetricDescriptorOpts struct {
+	// Enable writing a metric descriptor with the help text and unit of a metric when
+	// its metric type is first exported.
+	Enable bool
+	// RateLimit is the maximum number of metric descriptor writes per second.
+	// Defaults to DefaultMetricDescriptorRateLimit when 0.
+	RateLimit float64
+	// Units overrides the unit of metrics by metric name prefix, where the longest
+	// matching prefix applies. Units are Prometheus base units like "seconds" or
+	// "bytes_per_second", or otherwise taken as UCUM units like "By/s". An empty unit
+	// writes no unit for the metrics.
+	Units map[string]string
+}
+
+type createMetricDescriptorFunc func(context.Context, *monitoring_pb.CreateMetricDescriptorRequest, ...gax.CallOption) (*metric_pb.MetricDescriptor, error)
+
+// descriptorWriter writes metric descriptors for the metric types of exported series.
+// Every metric type is written once per project and process lifetime. Writes are
+// rate limited as there may be many new metric types at startup.
+type descriptorWriter struct {
+	logger  log.Logger
+	limiter *rate.Limiter
+	queue   chan *monitoring_pb.CreateMetricDescriptorRequest
+	// Unit overrides by metric name prefix, and the prefixes from longest to shortest.
+	units        map[string]string
+	unitPrefixes []string
+
+	mtx sync.Mutex
+	// Set of written or queued metric descriptors by request name and metric type.
+	written map[string]struct{}
+}
+
+func newDescriptorWriter(logger log.Logger, opts MetricDescriptorOpts) *descriptorWriter {
+	w := &descriptorWriter{
+		logger:  logger,
+		limiter: rate.NewLimiter(rate.Limit(opts.RateLimit), 1),
+		queue:   make(chan *monitoring_pb.CreateMetricDescriptorRequest, metricDescriptorQueueSize),
+		units:   map[string]string{},
+		written: map[string]struct{}{},
+	}
+	for prefix, unit := range opts.Units {
+		if u, ok := ucumUnit(unit); ok {
+			unit = u
+		}
+		w.units[prefix] = unit
+		w.unitPrefixes = append(w.unitPrefixes, prefix)
+	}
+	sort.Slice(w.unitPrefixes, func(i, j int) bool {
+		return len(w.unitPrefixes[i]) > len(w.unitPrefixes[j])
+	})
+	return w
+}
+
+func descriptorKey(req *monitoring_pb.CreateMetricDescriptorRequest) string {
+	return req.Name + "/" + req.MetricDescriptor.Type
+}
+
+// add queues a metric descriptor for the series of the metric if none was written for
+// its metric type yet. The unit is only set if the series has the unit of the metric.
+func (w *descriptorWriter) add(series *monitoring_pb.TimeSeries, metadata MetricMetadata, metric string, withUnit bool) {
+	desc := &metric_pb.MetricDescriptor{
+		Type:        series.Metric.Type,
+		MetricKind:  series.MetricKind,
+		ValueType:   series.ValueType,
+		Description: metadata.Help,
+	}
+	if withUnit {
+		desc.Unit = w.unit(metadata.Unit, metric)
+	}
+	keys := make([]string, 0, len(series.Metric.Labels))
+	for k := range series.Metric.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		desc.Labels = append(desc.Labels, &label_pb.LabelDescriptor{Key: k, ValueType: label_pb.LabelDescriptor_STRING})
+	}
+	req := &monitoring_pb.CreateMetricDescriptorRequest{
+		Name:             fmt.Sprintf("projects/%s", series.Resource.Labels[KeyProjectID]),
+		MetricDescriptor: desc,
+	}
+	key := descriptorKey(req)
+
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	if _, ok := w.written[key]; ok {
+		return
+	}
+	select {
+	case w.queue <- req:
+		w.written[key] = struct{}{}
+	default:
+		// The descriptor is queued again when the series is refreshed.
+		metricDescriptorWrites.WithLabelValues("dropped").Inc()
+	}
+}
+
+// unit returns the UCUM unit of the metric from the unit overrides or, if none
+// matches, from its metadata unit and name.
+func (w *descriptorWriter) unit(unit, metric string) string {
+	for _, prefix := range w.unitPrefixes {
+		if strings.HasPrefix(metric, prefix) {
+			return w.units[prefix]
+		}
+	}
+	return metricUnit(unit, metric)
+}
+
+// run writes queued metric descriptors until the context is canceled.
+func (w *descriptorWriter) run(ctx context.Context, create createMetricDescriptorFunc) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case req := <-w.queue:
+			if err := w.limiter.Wait(ctx); err != nil {
+				return
+			}
+			if _, err := create(ctx, req); err != nil {
+				level.Debug(w.logger).Log("msg", "writing metric descriptor failed", "type", req.MetricDescriptor.Type, "err", err)
+				metricDescriptorWrites.WithLabelValues("error").Inc()
+
+				// Allow another attempt on the next refresh of a series of the metric type.
+				if errorClass(err) == errorClassRetryable {
+					w.mtx.Lock()
+					delete(w.written, descriptorKey(req))
+					w.mtx.Unlock()
+				}
+				continue
+			}
+			metricDescriptorWrites.WithLabelValues("success").Inc()
+		}
+	}
+}
+
+// Prometheus base units and their equivalents in the UCUM notation used by GCM.
+var ucumUnits = map[string]string{
+	"seconds":      "s",
+	"milliseconds": "ms",
+	"microseconds": "us",
+	"nanoseconds":  "ns",
+	"bytes":        "By",
+	"bits":         "bit",
+	"ratio":        "1",
+	"percent":      "%",
+	"meters":       "m",
+	"grams":        "g",
+	"celsius":      "Cel",
+	"volts":        "V",
+	"amperes":      "A",
+	"joules":       "J",
+	"watts":        "W",
+	"hertz":        "Hz",
+	"minutes":      "min",
+	"hours":        "h",
+	"days":         "d",
+
+	// Singular units as used in the denominator of ratios, e.g. bytes_per_second.
+	"second": "s",
+	"minute": "min",
+	"hour":   "h",
+	"day":    "d",
+}
+
+// ucumUnit returns the UCUM equivalent of a Prometheus unit, which may be a ratio of
+// two units like "bytes_per_second", and false if the unit is unknown.
+func ucumUnit(unit string) (string, bool) {
+	if num, den, ok := strings.Cut(unit, "_per_"); ok {
+		n, ok1 := ucumUnits[num]
+		d, ok2 := ucumUnits[den]
+		if !ok1 || !ok2 {
+			return "", false
+		}
+		return n + "/" + d, true
+	}
+	u, ok := ucumUnits[unit]
+	return u, ok
+}
+
+// metricUnit returns the UCUM unit of a metric from the unit in its metadata or, if not
+// set, from the unit suffix of its name. It returns an empty string if the unit is unknown.
+func metricUnit(unit, metric string) string {
+	if unit != "" {
+		u, _ := ucumUnit(unit)
+		return u
+	}
+	name := strings.TrimSuffix(metric, string(metricSuffixTotal))
+
+	// Names ending in a ratio like _bytes_per_second only have the ratio as unit, and
+	// in particular not the unit of the denominator.
+	if i := strings.LastIndex(name, "_per_"); i >= 0 && !strings.Contains(name[i+len("_per_"):], "_") {
+		if j := strings.LastIndexByte(name[:i], '_'); j >= 0 {
+			u, _ := ucumUnit(name[j+1:])
+			return u
+		}
+		return ""
+	}
+	if i := strings.LastIndexByte(name, '_'); i >= 0 {
+		return ucumUnits[name[i+1:]]
+	}
+	return ""
+}
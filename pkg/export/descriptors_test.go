@@ -0,0 +1,185 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/google/go-cmp/cmp"
+	gax "github.com/googleapis/gax-go/v2"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/textparse"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/prometheus/prometheus/tsdb/record"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/testing/protocmp"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	label_pb "google.golang.org/genproto/googleapis/api/label"
+	metric_pb "google.golang.org/genproto/googleapis/api/metric"
+	monitoredres_pb "google.golang.org/genproto/googleapis/api/monitoredres"
+	monitoring_pb "google.golang.org/genproto/googleapis/monitoring/v3"
+)
+
+func TestMetricUnit(t *testing.T) {
+	cases := []struct {
+		unit, metric, want string
+	}{
+		{metric: "http_request_duration_seconds", want: "s"},
+		{metric: "http_response_size_bytes_total", want: "By"},
+		{metric: "process_open_fds", want: ""},
+		{metric: "up", want: ""},
+		{unit: "milliseconds", metric: "latency", want: "ms"},
+		{unit: "furlongs", metric: "distance_seconds", want: ""},
+		{metric: "network_transmit_bytes_per_second", want: "By/s"},
+		{metric: "disk_writes_per_second", want: ""},
+		{metric: "jobs_per_day_total", want: ""},
+		{unit: "bytes_per_second", metric: "throughput", want: "By/s"},
+		{unit: "bytes_per_fortnight", metric: "throughput", want: ""},
+	}
+	for _, c := range cases {
+		if got := metricUnit(c.unit, c.metric); got != c.want {
+			t.Errorf("metricUnit(%q, %q): expected %q, got %q", c.unit, c.metric, c.want, got)
+		}
+	}
+}
+
+func TestDescriptorWriter_unit(t *testing.T) {
+	w := newDescriptorWriter(log.NewNopLogger(), MetricDescriptorOpts{
+		Units: map[string]string{
+			"app_":          "bytes",
+			"app_latency_":  "milliseconds",
+			"app_queue_":    "{items}",
+			"legacy_":       "",
+			"net_transmit_": "bits_per_second",
+		},
+	})
+	cases := []struct {
+		unit, metric, want string
+	}{
+		{metric: "app_heap", want: "By"},
+		{metric: "app_latency_seconds", want: "ms"},
+		{metric: "app_queue_length", want: "{items}"},
+		{metric: "legacy_duration_seconds", want: ""},
+		{unit: "seconds", metric: "legacy_duration", want: ""},
+		{metric: "net_transmit_rate", want: "bit/s"},
+		{unit: "seconds", metric: "other_duration", want: "s"},
+		{metric: "other_size_bytes", want: "By"},
+	}
+	for _, c := range cases {
+		if got := w.unit(c.unit, c.metric); got != c.want {
+			t.Errorf("unit(%q, %q): expected %q, got %q", c.unit, c.metric, c.want, got)
+		}
+	}
+}
+
+func TestSeriesCache_metricDescriptors(t *testing.T) {
+	cache := newSeriesCache(nil, nil, MetricTypePrefix, nil)
+	cache.descriptors = newDescriptorWriter(log.NewNopLogger(), MetricDescriptorOpts{RateLimit: DefaultMetricDescriptorRateLimit})
+
+	series := map[storage.SeriesRef]labels.Labels{
+		1: labels.FromStrings("__name__", "rpc_duration_seconds_count", "method", "get"),
+		2: labels.FromStrings("__name__", "rpc_duration_seconds_sum", "method", "get"),
+		3: labels.FromStrings("__name__", "rpc_duration_seconds_count", "method", "put"),
+	}
+	cache.getLabelsByRef = func(ref storage.SeriesRef) labels.Labels {
+		return series[ref]
+	}
+	externalLabels := labels.FromStrings("project_id", "p1", "location", "l1")
+	metadata := testMetadataFunc(metricMetadataMap{
+		"rpc_duration_seconds": {Type: textparse.MetricTypeSummary, Help: "RPC latency."},
+	})
+	for ref := range series {
+		if _, ok := cache.get(record.RefSample{Ref: chunks.HeadSeriesRef(ref)}, externalLabels, metadata); !ok {
+			t.Fatalf("no entry for series %d", ref)
+		}
+	}
+	got := map[string]*metric_pb.MetricDescriptor{}
+	for len(cache.descriptors.queue) > 0 {
+		req := <-cache.descriptors.queue
+		if req.Name != "projects/p1" {
+			t.Errorf("unexpected request name %q", req.Name)
+		}
+		got[req.MetricDescriptor.Type] = req.MetricDescriptor
+	}
+	// The series of the count must only produce a single descriptor without unit.
+	want := map[string]*metric_pb.MetricDescriptor{
+		"prometheus.googleapis.com/rpc_duration_seconds_count/summary": {
+			Type:        "prometheus.googleapis.com/rpc_duration_seconds_count/summary",
+			MetricKind:  metric_pb.MetricDescriptor_CUMULATIVE,
+			ValueType:   metric_pb.MetricDescriptor_DOUBLE,
+			Description: "RPC latency.",
+			Labels: []*label_pb.LabelDescriptor{
+				{Key: "method", ValueType: label_pb.LabelDescriptor_STRING},
+			},
+		},
+		"prometheus.googleapis.com/rpc_duration_seconds_sum/summary:counter": {
+			Type:        "prometheus.googleapis.com/rpc_duration_seconds_sum/summary:counter",
+			MetricKind:  metric_pb.MetricDescriptor_CUMULATIVE,
+			ValueType:   metric_pb.MetricDescriptor_DOUBLE,
+			Description: "RPC latency.",
+			Unit:        "s",
+			Labels: []*label_pb.LabelDescriptor{
+				{Key: "method", ValueType: label_pb.LabelDescriptor_STRING},
+			},
+		},
+	}
+	if diff := cmp.Diff(want, got, protocmp.Transform()); diff != "" {
+		t.Errorf("unexpected metric descriptors (-want, +got): %s", diff)
+	}
+}
+
+func TestDescriptorWriter_run(t *testing.T) {
+	w := newDescriptorWriter(log.NewNopLogger(), MetricDescriptorOpts{RateLimit: 1000})
+	series := &monitoring_pb.TimeSeries{
+		Resource: &monitoredres_pb.MonitoredResource{Labels: map[string]string{KeyProjectID: "p1"}},
+		Metric:   &metric_pb.Metric{Type: "prometheus.googleapis.com/metric1/gauge"},
+	}
+	created := make(chan error)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go w.run(ctx, func(context.Context, *monitoring_pb.CreateMetricDescriptorRequest, ...gax.CallOption) (*metric_pb.MetricDescriptor, error) {
+		return nil, <-created
+	})
+	queued := func() bool {
+		w.mtx.Lock()
+		defer w.mtx.Unlock()
+		return len(w.written) > 0
+	}
+	// A descriptor that failed with a retryable error can be queued again.
+	w.add(series, MetricMetadata{}, "metric1", true)
+	created <- status.Error(codes.Unavailable, "unavailable")
+
+	if err := wait.Poll(10*time.Millisecond, time.Second, func() (bool, error) {
+		return !queued(), nil
+	}); err != nil {
+		t.Fatal("descriptor was not removed after retryable error")
+	}
+	w.add(series, MetricMetadata{}, "metric1", true)
+	created <- nil
+
+	// A written descriptor is not queued again.
+	w.add(series, MetricMetadata{}, "metric1", true)
+	if len(w.queue) > 0 {
+		t.Fatal("unexpected queued descriptor after successful write")
+	}
+}
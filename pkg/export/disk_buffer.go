@@ -0,0 +1,489 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/protobuf/proto"
+
+	monitoring_pb "google.golang.org/genproto/googleapis/monitoring/v3"
+)
+
+var (
+	diskBufferBytes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "gcm_export_disk_buffer_bytes",
+		Help: "Size of the samples buffered on disk.",
+	})
+	diskBufferSamples = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "gcm_export_disk_buffer_samples_total",
+		Help: "Number of samples written to and read from the disk buffer.",
+	}, []string{"op"})
+)
+
+const (
+	// Maximum size of a single segment file of the disk buffer.
+	diskBufferSegmentSizeMax = 16 << 20
+	// Suffix of the segment files of the disk buffer.
+	diskBufferSegmentSuffix = ".seg"
+	// File holding the read position of the disk buffer across restarts.
+	diskBufferPositionFile = "position"
+	// Interval in which written samples and the read position are synced to disk.
+	diskBufferSyncInterval = 5 * time.Second
+	// Number of written bytes after which they are synced to disk regardless of
+	// the sync interval.
+	diskBufferSyncBytes = 4 << 20
+)
+
+// diskBuffer is a bounded FIFO queue of samples on disk. Samples are appended to
+// segment files and read back oldest-first. If the size limit is exceeded, the
+// oldest segment is dropped.
+// Written samples and the read position are synced to disk periodically, after a
+// bounded amount of writes, and on close. Samples survive restarts without being
+// sent twice and after a crash at most the samples written or read since the last
+// sync are lost or sent twice.
+type diskBuffer struct {
+	logger      log.Logger
+	dir         string
+	maxBytes    int64
+	segmentSize int64
+
+	mtx sync.Mutex
+	// Segments ordered from oldest to newest. Samples are read from the first
+	// and written to the last segment.
+	segments []*diskSegment
+	// Total size of all segments.
+	size int64
+	// Number of samples that were not read yet.
+	unread int
+
+	w  *os.File
+	bw *bufio.Writer
+	// Number of bytes written since the last sync.
+	unsynced int64
+
+	r       *os.File
+	br      *bufio.Reader
+	readOff int64
+	// Record that was read by peek but not consumed yet.
+	next *diskRecord
+}
+
+type diskSegment struct {
+	index int
+	size  int64
+	// Number of records in the segment and how many of them were consumed.
+	count, read int
+}
+
+type diskRecord struct {
+	hash   uint64
+	sample *monitoring_pb.TimeSeries
+	size   int64
+}
+
+func segmentFile(dir string, index int) string {
+	return filepath.Join(dir, fmt.Sprintf("%08d%s", index, diskBufferSegmentSuffix))
+}
+
+// openDiskBuffer opens the disk buffer in dir and loads segments left over from a
+// previous run. It always starts writing to a new segment.
+func openDiskBuffer(logger log.Logger, dir string, maxBytes int64) (*diskBuffer, error) {
+	if maxBytes <= 0 {
+		return nil, fmt.Errorf("disk buffer size must be positive, got %d", maxBytes)
+	}
+	if err := os.MkdirAll(dir, 0o777); err != nil {
+		return nil, fmt.Errorf("create disk buffer directory: %w", err)
+	}
+	segmentSize := maxBytes / 4
+	if segmentSize > diskBufferSegmentSizeMax {
+		segmentSize = diskBufferSegmentSizeMax
+	}
+	b := &diskBuffer{
+		logger:      logger,
+		dir:         dir,
+		maxBytes:    maxBytes,
+		segmentSize: segmentSize,
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read disk buffer directory: %w", err)
+	}
+	var indices []int
+	for _, f := range files {
+		name := f.Name()
+		if !strings.HasSuffix(name, diskBufferSegmentSuffix) {
+			continue
+		}
+		index, err := strconv.Atoi(strings.TrimSuffix(name, diskBufferSegmentSuffix))
+		if err != nil {
+			continue
+		}
+		indices = append(indices, index)
+	}
+	sort.Ints(indices)
+
+	posIndex, posOffset, posRead := b.readPosition()
+
+	for _, index := range indices {
+		seg, err := loadSegment(segmentFile(dir, index), index)
+		if err != nil {
+			return nil, err
+		}
+		if seg.count == 0 {
+			os.Remove(segmentFile(dir, index))
+			continue
+		}
+		// Skip the part of the first segment that was consumed before the restart.
+		if len(b.segments) == 0 && index == posIndex && posOffset <= seg.size && posRead <= seg.count {
+			b.readOff, seg.read = posOffset, posRead
+		}
+		b.segments = append(b.segments, seg)
+		b.size += seg.size
+		b.unread += seg.count - seg.read
+	}
+	next := 0
+	if len(indices) > 0 {
+		next = indices[len(indices)-1] + 1
+	}
+	if err := b.newSegment(next); err != nil {
+		return nil, err
+	}
+	diskBufferBytes.Set(float64(b.size))
+
+	if b.unread > 0 {
+		level.Info(logger).Log("msg", "loaded samples from disk buffer", "samples", b.unread, "bytes", b.size)
+	}
+	return b, nil
+}
+
+// loadSegment counts the records of a segment file and truncates a partially written
+// record at its end.
+func loadSegment(fn string, index int) (*diskSegment, error) {
+	f, err := os.OpenFile(fn, os.O_RDWR, 0o666)
+	if err != nil {
+		return nil, fmt.Errorf("open disk buffer segment: %w", err)
+	}
+	defer f.Close()
+
+	seg := &diskSegment{index: index}
+	br := bufio.NewReader(f)
+	for {
+		rec, err := readRecord(br)
+		if err != nil {
+			break
+		}
+		seg.count++
+		seg.size += rec.size
+	}
+	if err := f.Truncate(seg.size); err != nil {
+		return nil, fmt.Errorf("truncate disk buffer segment: %w", err)
+	}
+	return seg, nil
+}
+
+func (b *diskBuffer) readPosition() (index int, offset int64, read int) {
+	data, err := os.ReadFile(filepath.Join(b.dir, diskBufferPositionFile))
+	if err != nil {
+		return -1, 0, 0
+	}
+	if _, err := fmt.Sscanf(string(data), "%d %d %d", &index, &offset, &read); err != nil {
+		return -1, 0, 0
+	}
+	return index, offset, read
+}
+
+func (b *diskBuffer) newSegment(index int) error {
+	f, err := os.OpenFile(segmentFile(b.dir, index), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o666)
+	if err != nil {
+		return fmt.Errorf("create disk buffer segment: %w", err)
+	}
+	b.w = f
+	b.bw = bufio.NewWriter(f)
+	b.segments = append(b.segments, &diskSegment{index: index})
+	return nil
+}
+
+// rotate closes the current write segment and starts a new one.
+func (b *diskBuffer) rotate() error {
+	if err := b.bw.Flush(); err != nil {
+		return err
+	}
+	if err := b.w.Close(); err != nil {
+		return err
+	}
+	return b.newSegment(b.segments[len(b.segments)-1].index + 1)
+}
+
+// evictOldest drops the oldest segment along with its unread samples.
+func (b *diskBuffer) evictOldest() {
+	seg := b.segments[0]
+	dropped := seg.count - seg.read
+
+	b.closeReader()
+	b.next, b.readOff = nil, 0
+	os.Remove(segmentFile(b.dir, seg.index))
+
+	b.segments = b.segments[1:]
+	b.size -= seg.size
+	b.unread -= dropped
+	samplesDropped.WithLabelValues("disk-buffer-evicted").Add(float64(dropped))
+}
+
+func (b *diskBuffer) closeReader() {
+	if b.r != nil {
+		b.r.Close()
+	}
+	b.r, b.br = nil, nil
+}
+
+// add appends a sample to the buffer. If the buffer is full, the oldest segment
+// is evicted to make space for it.
+func (b *diskBuffer) add(hash uint64, sample *monitoring_pb.TimeSeries) error {
+	data, err := proto.Marshal(sample)
+	if err != nil {
+		return fmt.Errorf("marshal sample: %w", err)
+	}
+	var header [binary.MaxVarintLen64 + 8]byte
+	n := binary.PutUvarint(header[:], uint64(len(data)))
+	binary.LittleEndian.PutUint64(header[n:], hash)
+	n += 8
+	size := int64(n + len(data))
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if size > b.segmentSize {
+		samplesDropped.WithLabelValues("disk-buffer-evicted").Inc()
+		return fmt.Errorf("sample of %d bytes exceeds disk buffer segment size", size)
+	}
+	if cur := b.segments[len(b.segments)-1]; cur.size+size > b.segmentSize {
+		if err := b.rotate(); err != nil {
+			return fmt.Errorf("rotate disk buffer segment: %w", err)
+		}
+	}
+	for b.size+size > b.maxBytes && len(b.segments) > 1 {
+		b.evictOldest()
+	}
+	if _, err := b.bw.Write(header[:n]); err != nil {
+		return err
+	}
+	if _, err := b.bw.Write(data); err != nil {
+		return err
+	}
+	cur := b.segments[len(b.segments)-1]
+	cur.size += size
+	cur.count++
+	b.size += size
+	b.unread++
+
+	diskBufferBytes.Set(float64(b.size))
+	diskBufferSamples.WithLabelValues("write").Inc()
+
+	b.unsynced += size
+	if b.unsynced >= diskBufferSyncBytes {
+		return b.syncLocked()
+	}
+	return nil
+}
+
+// empty returns true if all buffered samples were consumed.
+func (b *diskBuffer) empty() bool {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	return b.unread == 0
+}
+
+// peek returns the oldest buffered sample without consuming it.
+func (b *diskBuffer) peek() (uint64, *monitoring_pb.TimeSeries, bool) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	for b.next == nil {
+		if b.unread == 0 {
+			return 0, nil, false
+		}
+		seg := b.segments[0]
+		if seg.read == seg.count {
+			// The oldest segment is fully consumed and is not written to anymore
+			// since there are unread samples in later segments.
+			b.closeReader()
+			b.readOff = 0
+			os.Remove(segmentFile(b.dir, seg.index))
+			b.segments = b.segments[1:]
+			b.size -= seg.size
+			diskBufferBytes.Set(float64(b.size))
+			continue
+		}
+		if len(b.segments) == 1 {
+			if err := b.bw.Flush(); err != nil {
+				level.Error(b.logger).Log("msg", "flushing disk buffer failed", "err", err)
+				return 0, nil, false
+			}
+		}
+		if b.r == nil {
+			f, err := os.Open(segmentFile(b.dir, seg.index))
+			if err != nil {
+				level.Error(b.logger).Log("msg", "opening disk buffer segment failed", "err", err)
+				b.skipSegment(seg)
+				continue
+			}
+			if _, err := f.Seek(b.readOff, io.SeekStart); err != nil {
+				f.Close()
+				level.Error(b.logger).Log("msg", "seeking disk buffer segment failed", "err", err)
+				b.skipSegment(seg)
+				continue
+			}
+			b.r, b.br = f, bufio.NewReader(f)
+		}
+		rec, err := readRecord(b.br)
+		if err != nil {
+			level.Error(b.logger).Log("msg", "reading disk buffer segment failed", "err", err)
+			b.skipSegment(seg)
+			continue
+		}
+		b.next = rec
+	}
+	return b.next.hash, b.next.sample, true
+}
+
+// skipSegment drops the remaining samples of a segment that cannot be read.
+func (b *diskBuffer) skipSegment(seg *diskSegment) {
+	dropped := seg.count - seg.read
+	seg.read = seg.count
+	b.unread -= dropped
+	samplesDropped.WithLabelValues("disk-buffer-corrupted").Add(float64(dropped))
+}
+
+// advance consumes the sample returned by the last call to peek.
+func (b *diskBuffer) advance() {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if b.next == nil {
+		return
+	}
+	b.readOff += b.next.size
+	b.segments[0].read++
+	b.unread--
+	b.next = nil
+
+	diskBufferSamples.WithLabelValues("read").Inc()
+}
+
+// sync flushes written samples and persists the read position to stable storage.
+func (b *diskBuffer) sync() error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	return b.syncLocked()
+}
+
+func (b *diskBuffer) syncLocked() error {
+	if err := b.bw.Flush(); err != nil {
+		return fmt.Errorf("flush disk buffer segment: %w", err)
+	}
+	if err := b.w.Sync(); err != nil {
+		return fmt.Errorf("sync disk buffer segment: %w", err)
+	}
+	b.unsynced = 0
+
+	if err := b.writePosition(); err != nil {
+		return fmt.Errorf("write disk buffer position: %w", err)
+	}
+	return nil
+}
+
+// writePosition atomically replaces the position file with the current read position.
+func (b *diskBuffer) writePosition() error {
+	seg := b.segments[0]
+	pos := fmt.Sprintf("%d %d %d\n", seg.index, b.readOff, seg.read)
+
+	fn := filepath.Join(b.dir, diskBufferPositionFile)
+	f, err := os.Create(fn + ".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(pos); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(fn+".tmp", fn)
+}
+
+// close syncs the buffer to disk and closes its files.
+func (b *diskBuffer) close() error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	err := b.syncLocked()
+	if cerr := b.w.Close(); err == nil {
+		err = cerr
+	}
+	b.closeReader()
+	return err
+}
+
+// readRecord reads the next record from r.
+func readRecord(r *bufio.Reader) (*diskRecord, error) {
+	length, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	var hash [8]byte
+	if _, err := io.ReadFull(r, hash[:]); err != nil {
+		return nil, err
+	}
+	if length > diskBufferSegmentSizeMax {
+		return nil, errors.New("invalid record length")
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	sample := &monitoring_pb.TimeSeries{}
+	if err := proto.Unmarshal(data, sample); err != nil {
+		return nil, fmt.Errorf("unmarshal sample: %w", err)
+	}
+	var varint [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(varint[:], length)
+
+	return &diskRecord{
+		hash:   binary.LittleEndian.Uint64(hash[:]),
+		sample: sample,
+		size:   int64(n + 8 + len(data)),
+	}, nil
+}
@@ -0,0 +1,194 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"os"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/google/go-cmp/cmp"
+
+	monitoring_pb "google.golang.org/genproto/googleapis/monitoring/v3"
+)
+
+func diskBufferSample(v int64) *monitoring_pb.TimeSeries {
+	return &monitoring_pb.TimeSeries{
+		Points: []*monitoring_pb.Point{{
+			Value: &monitoring_pb.TypedValue{
+				Value: &monitoring_pb.TypedValue_Int64Value{Int64Value: v},
+			},
+		}},
+	}
+}
+
+// readDiskBuffer consumes up to n samples from the buffer and returns their hashes
+// and values.
+func readDiskBuffer(t *testing.T, b *diskBuffer, n int) (hashes []uint64, values []int64) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		hash, sample, ok := b.peek()
+		if !ok {
+			break
+		}
+		hashes = append(hashes, hash)
+		values = append(values, sample.Points[0].Value.GetInt64Value())
+		b.advance()
+	}
+	return hashes, values
+}
+
+func TestDiskBuffer(t *testing.T) {
+	b, err := openDiskBuffer(log.NewNopLogger(), t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.close()
+
+	if !b.empty() {
+		t.Fatal("expected new buffer to be empty")
+	}
+	for i := 0; i < 5; i++ {
+		if err := b.add(uint64(i), diskBufferSample(int64(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Peeking does not consume the sample.
+	if hash, _, _ := b.peek(); hash != 0 {
+		t.Fatalf("expected hash 0, got %d", hash)
+	}
+	hashes, values := readDiskBuffer(t, b, 3)
+	if diff := cmp.Diff([]uint64{0, 1, 2}, hashes); diff != "" {
+		t.Errorf("unexpected hashes (-want, +got): %s", diff)
+	}
+	if diff := cmp.Diff([]int64{0, 1, 2}, values); diff != "" {
+		t.Errorf("unexpected values (-want, +got): %s", diff)
+	}
+	// Samples added after reading started are appended.
+	if err := b.add(5, diskBufferSample(5)); err != nil {
+		t.Fatal(err)
+	}
+	_, values = readDiskBuffer(t, b, 10)
+	if diff := cmp.Diff([]int64{3, 4, 5}, values); diff != "" {
+		t.Errorf("unexpected values (-want, +got): %s", diff)
+	}
+	if !b.empty() {
+		t.Fatal("expected buffer to be empty")
+	}
+}
+
+func TestDiskBuffer_evict(t *testing.T) {
+	// Every segment holds a few samples and only a few segments fit into the buffer.
+	b, err := openDiskBuffer(log.NewNopLogger(), t.TempDir(), 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.close()
+
+	for i := 0; i < 100; i++ {
+		if err := b.add(uint64(i), diskBufferSample(int64(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if b.size > b.maxBytes {
+		t.Fatalf("expected size to be at most %d, got %d", b.maxBytes, b.size)
+	}
+	_, values := readDiskBuffer(t, b, 100)
+	if len(values) == 0 || len(values) == 100 {
+		t.Fatalf("expected some but not all samples to be evicted, got %v", values)
+	}
+	// The newest samples are retained in order.
+	for i, v := range values {
+		if want := int64(100 - len(values) + i); v != want {
+			t.Fatalf("expected value %d at position %d, got %v", want, i, values)
+		}
+	}
+}
+
+func TestDiskBuffer_reopen(t *testing.T) {
+	dir := t.TempDir()
+
+	b, err := openDiskBuffer(log.NewNopLogger(), dir, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := b.add(uint64(i), diskBufferSample(int64(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	readDiskBuffer(t, b, 2)
+	if err := b.close(); err != nil {
+		t.Fatal(err)
+	}
+	// Append a partially written record, which must be discarded.
+	f, err := os.OpenFile(segmentFile(dir, 0), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte{100, 1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	b, err = openDiskBuffer(log.NewNopLogger(), dir, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.close()
+
+	// Reading continues where it stopped and new samples are appended.
+	if err := b.add(5, diskBufferSample(5)); err != nil {
+		t.Fatal(err)
+	}
+	_, values := readDiskBuffer(t, b, 10)
+	if diff := cmp.Diff([]int64{2, 3, 4, 5}, values); diff != "" {
+		t.Errorf("unexpected values (-want, +got): %s", diff)
+	}
+}
+
+func TestDiskBuffer_sync(t *testing.T) {
+	dir := t.TempDir()
+
+	b, err := openDiskBuffer(log.NewNopLogger(), dir, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.close()
+
+	for i := 0; i < 5; i++ {
+		if err := b.add(uint64(i), diskBufferSample(int64(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	readDiskBuffer(t, b, 2)
+	if err := b.sync(); err != nil {
+		t.Fatal(err)
+	}
+	// Samples read after the sync are sent again after a crash.
+	readDiskBuffer(t, b, 1)
+
+	// Open the buffer without closing it, as after a crash.
+	crashed, err := openDiskBuffer(log.NewNopLogger(), dir, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer crashed.close()
+
+	_, values := readDiskBuffer(t, crashed, 10)
+	if diff := cmp.Diff([]int64{2, 3, 4}, values); diff != "" {
+		t.Errorf("unexpected values (-want, +got): %s", diff)
+	}
+}
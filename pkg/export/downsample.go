@@ -0,0 +1,117 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DownsampleOpts represents exporter options for writing series at a lower resolution
+// than they are scraped at, e.g. every 30s for targets scraped every 5s.
+type DownsampleOpts struct {
+	// Interval at which points of a series are written. Intervals are aligned to
+	// multiples of the interval and only the first sample of a series within an
+	// interval is written. Disabled if 0.
+	Interval time.Duration
+	// Align sets the end time of written points to the start of their interval. Points
+	// of cumulative series whose start time is not before that keep their end time.
+	Align bool
+}
+
+func (o *DownsampleOpts) validate() error {
+	if o.Interval < 0 || (o.Interval > 0 && o.Interval < time.Second) {
+		return fmt.Errorf("downsample interval must be at least 1s, got %s", o.Interval)
+	}
+	if o.Align && o.Interval == 0 {
+		return fmt.Errorf("aligning points requires a downsample interval")
+	}
+	return nil
+}
+
+// downsampler decides which samples of a series are written based on the interval of
+// the last written one.
+type downsampler struct {
+	interval int64
+	align    bool
+
+	mtx sync.Mutex
+	// Interval of the last written point by series hash.
+	last map[uint64]int64
+}
+
+func newDownsampler(opts DownsampleOpts) *downsampler {
+	return &downsampler{
+		interval: opts.Interval.Milliseconds(),
+		align:    opts.Align,
+		last:     map[uint64]int64{},
+	}
+}
+
+// keep returns whether the sample is the first of its series in its interval and
+// should be written. Kept samples are aligned to the start of the interval if enabled.
+func (d *downsampler) keep(s hashedSeries) bool {
+	p := s.proto.Points[0]
+	interval := p.Interval.EndTime.AsTime().UnixMilli() / d.interval
+
+	d.mtx.Lock()
+	last, ok := d.last[s.hash]
+	if ok && interval <= last {
+		d.mtx.Unlock()
+		return false
+	}
+	d.last[s.hash] = interval
+	d.mtx.Unlock()
+
+	if d.align {
+		end := interval * d.interval
+		if start := p.Interval.StartTime; start == nil || start.AsTime().UnixMilli() < end {
+			p.Interval.EndTime = getTimestamp(end)
+		}
+	}
+	return true
+}
+
+// run removes the state of series without samples for the given period until the
+// context is canceled.
+func (d *downsampler) run(ctx context.Context, period time.Duration) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			d.gc(now.Add(-period))
+		}
+	}
+}
+
+// gc removes the state of series whose last written point is before the given time.
+func (d *downsampler) gc(before time.Time) {
+	interval := before.UnixMilli() / d.interval
+
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	for hash, last := range d.last {
+		if last < interval {
+			delete(d.last, hash)
+		}
+	}
+}
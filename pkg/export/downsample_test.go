@@ -0,0 +1,86 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"testing"
+	"time"
+
+	monitoring_pb "google.golang.org/genproto/googleapis/monitoring/v3"
+)
+
+func TestDownsampleOpts_validate(t *testing.T) {
+	for _, opts := range []DownsampleOpts{
+		{Interval: -time.Second},
+		{Interval: time.Millisecond},
+		{Align: true},
+	} {
+		if err := opts.validate(); err == nil {
+			t.Errorf("expected error for %+v", opts)
+		}
+	}
+	for _, opts := range []DownsampleOpts{{}, {Interval: 30 * time.Second, Align: true}} {
+		if err := opts.validate(); err != nil {
+			t.Errorf("unexpected error for %+v: %s", opts, err)
+		}
+	}
+}
+
+func TestDownsampler(t *testing.T) {
+	d := newDownsampler(DownsampleOpts{Interval: 30 * time.Second, Align: true})
+
+	sample := func(hash uint64, start, end int64) hashedSeries {
+		p := &monitoring_pb.Point{Interval: &monitoring_pb.TimeInterval{EndTime: getTimestamp(end)}}
+		if start > 0 {
+			p.Interval.StartTime = getTimestamp(start)
+		}
+		return hashedSeries{hash: hash, proto: &monitoring_pb.TimeSeries{Points: []*monitoring_pb.Point{p}}}
+	}
+	cases := []struct {
+		sample  hashedSeries
+		keep    bool
+		wantEnd int64
+	}{
+		// Gauges are aligned to the start of the interval.
+		{sample: sample(1, 0, 65000), keep: true, wantEnd: 60000},
+		{sample: sample(1, 0, 70000), keep: false},
+		{sample: sample(1, 0, 89999), keep: false},
+		{sample: sample(1, 0, 90000), keep: true, wantEnd: 90000},
+		// Other series are independent.
+		{sample: sample(2, 0, 70000), keep: true, wantEnd: 60000},
+		// Cumulatives keep their end time if it cannot be aligned after the start time.
+		{sample: sample(3, 61000, 65000), keep: true, wantEnd: 65000},
+		{sample: sample(3, 61000, 95000), keep: true, wantEnd: 90000},
+	}
+	for i, c := range cases {
+		if got := d.keep(c.sample); got != c.keep {
+			t.Fatalf("case %d: expected keep=%t, got %t", i, c.keep, got)
+		}
+		if !c.keep {
+			continue
+		}
+		if got := c.sample.proto.Points[0].Interval.EndTime.AsTime().UnixMilli(); got != c.wantEnd {
+			t.Errorf("case %d: expected end time %d, got %d", i, c.wantEnd, got)
+		}
+	}
+
+	d.gc(time.UnixMilli(90000))
+	if _, ok := d.last[2]; ok {
+		t.Errorf("expected state of series 2 to be removed")
+	}
+	if _, ok := d.last[1]; !ok {
+		t.Errorf("expected state of series 1 to be kept")
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/prometheus/model/labels"
+	"golang.org/x/time/rate"
+
+	monitoring_pb "google.golang.org/genproto/googleapis/monitoring/v3"
+)
+
+// DefaultDropLogRate is the default maximum number of log records of dropped samples
+// per second.
+const DefaultDropLogRate = 1.0
+
+// DropLogOpts represents exporter options for logging a sample of dropped points.
+type DropLogOpts struct {
+	// Enable logging of dropped points at startup. Logging can be toggled at runtime
+	// through SetDropLogging.
+	Enable bool
+	// Rate is the maximum number of log records per second. Points dropped beyond
+	// the rate are only counted by the drop metrics.
+	// Defaults to DefaultDropLogRate when 0.
+	Rate float64
+}
+
+func (o *DropLogOpts) validate() error {
+	if o.Rate == 0 {
+		o.Rate = DefaultDropLogRate
+	}
+	if o.Rate < 0 {
+		return fmt.Errorf("drop log rate must be positive, got %f", o.Rate)
+	}
+	return nil
+}
+
+// dropLog writes rate limited, structured log records for a sample of dropped points,
+// which identify the dropped series in addition to the aggregate drop metrics.
+// A nil dropLog logs nothing.
+type dropLog struct {
+	logger  log.Logger
+	enabled atomic.Bool
+	limiter *rate.Limiter
+}
+
+func newDropLog(logger log.Logger, opts DropLogOpts) *dropLog {
+	l := &dropLog{
+		logger:  logger,
+		limiter: rate.NewLimiter(rate.Limit(opts.Rate), int(math.Max(1, opts.Rate))),
+	}
+	l.enabled.Store(opts.Enable)
+	return l
+}
+
+// sampled returns whether a dropped point is logged.
+func (l *dropLog) sampled() bool {
+	return l != nil && l.enabled.Load() && l.limiter.Allow()
+}
+
+// series logs n points of the Prometheus series dropped for the reason if sampled.
+func (l *dropLog) series(reason string, lset labels.Labels, n int) {
+	if !l.sampled() {
+		return
+	}
+	level.Info(l.logger).Log(
+		"msg", "dropped samples",
+		"reason", reason,
+		"metric", lset.Get(labels.MetricName),
+		"labels_hash", strconv.FormatUint(lset.Hash(), 16),
+		"samples", n,
+	)
+}
+
+// timeSeries logs n points of the GCM series dropped for the reason if sampled.
+func (l *dropLog) timeSeries(reason string, s *monitoring_pb.TimeSeries, n int) {
+	if !l.sampled() {
+		return
+	}
+	level.Info(l.logger).Log(
+		"msg", "dropped samples",
+		"reason", reason,
+		"metric_type", s.Metric.Type,
+		"labels_hash", strconv.FormatUint(hashSeries(s), 16),
+		"samples", n,
+	)
+}
+
+// SetDropLogging enables or disables logging of dropped points at runtime.
+func (e *Exporter) SetDropLogging(enabled bool) {
+	if e.drops.enabled.Swap(enabled) != enabled {
+		level.Info(e.logger).Log("msg", "changed logging of dropped samples", "enabled", enabled)
+	}
+}
+
+// DropLogging returns whether dropped points are logged.
+func (e *Exporter) DropLogging() bool {
+	return e.drops.enabled.Load()
+}
+
+// DropLogHandler returns a handler that enables or disables logging of dropped points
+// on POST requests according to the boolean enable query parameter.
+func (e *Exporter) DropLogHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Only POST requests allowed.", http.StatusMethodNotAllowed)
+			return
+		}
+		enabled, err := strconv.ParseBool(r.URL.Query().Get("enable"))
+		if err != nil {
+			http.Error(w, "The enable parameter must be true or false.", http.StatusBadRequest)
+			return
+		}
+		e.SetDropLogging(enabled)
+		fmt.Fprintf(w, "drop logging: %t\n", e.DropLogging())
+	}
+}
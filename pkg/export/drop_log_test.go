@@ -0,0 +1,104 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/prometheus/model/labels"
+)
+
+func TestDropLog(t *testing.T) {
+	var buf bytes.Buffer
+	opts := DropLogOpts{Rate: 2}
+	if err := opts.validate(); err != nil {
+		t.Fatal(err)
+	}
+	l := newDropLog(log.NewLogfmtLogger(&buf), opts)
+	lset := labels.FromStrings("__name__", "metric1", "k1", "v1")
+
+	// Nothing is logged while disabled.
+	l.series("series-limit", lset, 1)
+	if buf.Len() != 0 {
+		t.Fatalf("expected no log records while disabled, got %q", buf.String())
+	}
+
+	// Once enabled, records are limited to the burst of the rate.
+	l.enabled.Store(true)
+	for i := 0; i < 10; i++ {
+		l.series("series-limit", lset, 1)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 log records, got %d: %q", len(lines), buf.String())
+	}
+	for _, want := range []string{
+		"reason=series-limit",
+		"metric=metric1",
+		"labels_hash=" + strconv.FormatUint(lset.Hash(), 16),
+		"samples=1",
+	} {
+		if !strings.Contains(lines[0], want) {
+			t.Errorf("expected log record %q to contain %q", lines[0], want)
+		}
+	}
+
+	// A nil log is a no-op.
+	var nilLog *dropLog
+	nilLog.series("filtered", lset, 1)
+}
+
+func TestExporter_dropLogHandler(t *testing.T) {
+	e, err := New(nil, nil, ExporterOpts{DisableAuth: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.DropLogging() {
+		t.Fatalf("expected drop logging to be disabled by default")
+	}
+
+	rec := httptest.NewRecorder()
+	e.DropLogHandler()(rec, httptest.NewRequest(http.MethodGet, "/-/export/drop-log?enable=true", nil))
+	if rec.Code != http.StatusMethodNotAllowed || e.DropLogging() {
+		t.Fatalf("expected GET to be rejected, got status %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	e.DropLogHandler()(rec, httptest.NewRequest(http.MethodPost, "/-/export/drop-log?enable=foo", nil))
+	if rec.Code != http.StatusBadRequest || e.DropLogging() {
+		t.Fatalf("expected invalid parameter to be rejected, got status %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	e.DropLogHandler()(rec, httptest.NewRequest(http.MethodPost, "/-/export/drop-log?enable=true", nil))
+	if rec.Code != http.StatusOK || !e.DropLogging() {
+		t.Fatalf("expected drop logging to be enabled, got status %d", rec.Code)
+	}
+	if got, want := rec.Body.String(), "drop logging: true\n"; got != want {
+		t.Errorf("expected body %q, got %q", want, got)
+	}
+
+	rec = httptest.NewRecorder()
+	e.DropLogHandler()(rec, httptest.NewRequest(http.MethodPost, "/-/export/drop-log?enable=false", nil))
+	if rec.Code != http.StatusOK || e.DropLogging() {
+		t.Fatalf("expected drop logging to be disabled, got status %d", rec.Code)
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	monitoredres_pb "google.golang.org/genproto/googleapis/api/monitoredres"
+	monitoring_pb "google.golang.org/genproto/googleapis/monitoring/v3"
+)
+
+var (
+	dualWriteSamples = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "gcm_export_dual_write_samples_total",
+		Help: "Number of samples written to the dual write project by whether they were sent, failed to be sent, or dropped because the queue was full.",
+	}, []string{"result"})
+	dualWriteSendDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "gcm_export_dual_write_send_duration_seconds",
+		Help:    "Duration of requests to GCM for the dual write project by whether they succeeded.",
+		Buckets: []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	}, []string{"result"})
+)
+
+// DefaultDualWriteQueueSize is the default number of batches that can be queued for
+// the dual write project.
+const DefaultDualWriteQueueSize = 100
+
+// DualWriteOpts represents exporter options for writing all samples to a second project
+// in addition to their regular one, e.g. while migrating to a new project.
+type DualWriteOpts struct {
+	// ProjectID of the second project. Dual writing is disabled if empty.
+	ProjectID string
+	// CredentialsFile for requests to the second project. The regular credentials
+	// are used if empty.
+	CredentialsFile string
+	// Number of batches that can be queued for the second project. Batches are
+	// dropped if the queue is full. Defaults to DefaultDualWriteQueueSize when 0.
+	QueueSize int
+}
+
+func (o *DualWriteOpts) validate() error {
+	if o.QueueSize == 0 {
+		o.QueueSize = DefaultDualWriteQueueSize
+	}
+	if o.QueueSize < 0 {
+		return fmt.Errorf("dual write queue size must be positive, got %d", o.QueueSize)
+	}
+	return nil
+}
+
+// dualWriter writes samples to a second project. Failures and slow requests do not
+// affect the regular export as batches are queued and sent by a separate sender.
+// Batches are sent one after another, which keeps the samples of each series in order.
+// Failed requests are not retried.
+type dualWriter struct {
+	logger  log.Logger
+	project string
+	queue   chan [][]*monitoring_pb.TimeSeries
+}
+
+func newDualWriter(logger log.Logger, opts DualWriteOpts) *dualWriter {
+	return &dualWriter{
+		logger:  logger,
+		project: opts.ProjectID,
+		queue:   make(chan [][]*monitoring_pb.TimeSeries, opts.QueueSize),
+	}
+}
+
+// add queues the samples of a batch, grouped into requests, for the second project.
+func (w *dualWriter) add(requests [][]*monitoring_pb.TimeSeries) {
+	converted := make([][]*monitoring_pb.TimeSeries, 0, len(requests))
+	n := 0
+	for _, l := range requests {
+		series := make([]*monitoring_pb.TimeSeries, 0, len(l))
+		for _, s := range l {
+			series = append(series, w.convert(s))
+		}
+		converted = append(converted, series)
+		n += len(series)
+	}
+	select {
+	case w.queue <- converted:
+	default:
+		dualWriteSamples.WithLabelValues("dropped").Add(float64(n))
+	}
+}
+
+// convert returns a copy of the series that is written to the second project.
+// The copy shares all fields but the monitored resource with the original.
+func (w *dualWriter) convert(s *monitoring_pb.TimeSeries) *monitoring_pb.TimeSeries {
+	resourceLabels := make(map[string]string, len(s.Resource.Labels))
+	for k, v := range s.Resource.Labels {
+		resourceLabels[k] = v
+	}
+	resourceLabels[KeyProjectID] = w.project
+
+	return &monitoring_pb.TimeSeries{
+		Metric: s.Metric,
+		Resource: &monitoredres_pb.MonitoredResource{
+			Type:   s.Resource.Type,
+			Labels: resourceLabels,
+		},
+		MetricKind: s.MetricKind,
+		ValueType:  s.ValueType,
+		Points:     s.Points,
+		Unit:       s.Unit,
+	}
+}
+
+// run sends queued batches until the context is canceled.
+func (w *dualWriter) run(ctx context.Context, send sendFunc) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case requests := <-w.queue:
+			w.send(ctx, send, requests)
+		}
+	}
+}
+
+// send writes the requests of a batch concurrently and returns once all completed.
+func (w *dualWriter) send(ctx context.Context, send sendFunc, requests [][]*monitoring_pb.TimeSeries) {
+	sendCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, l := range requests {
+		wg.Add(1)
+		go func(l []*monitoring_pb.TimeSeries) {
+			defer wg.Done()
+
+			start := time.Now()
+			err := send(sendCtx, &monitoring_pb.CreateTimeSeriesRequest{
+				Name:       fmt.Sprintf("projects/%s", w.project),
+				TimeSeries: l,
+			})
+			if err != nil {
+				dualWriteSendDuration.WithLabelValues("error").Observe(time.Since(start).Seconds())
+				dualWriteSamples.WithLabelValues("failed").Add(float64(len(l)))
+				level.Error(w.logger).Log("msg", "dual write send batch", "project", w.project, "size", len(l), "class", errorClass(err), "err", err)
+				return
+			}
+			dualWriteSendDuration.WithLabelValues("success").Observe(time.Since(start).Seconds())
+			dualWriteSamples.WithLabelValues("sent").Add(float64(len(l)))
+		}(l)
+	}
+	wg.Wait()
+}
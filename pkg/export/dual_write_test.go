@@ -0,0 +1,91 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	gax "github.com/googleapis/gax-go/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	monitoredres_pb "google.golang.org/genproto/googleapis/api/monitoredres"
+	monitoring_pb "google.golang.org/genproto/googleapis/monitoring/v3"
+)
+
+func TestBatchSendDualWrite(t *testing.T) {
+	w := newDualWriter(nil, DualWriteOpts{ProjectID: "target", QueueSize: 1})
+
+	b := newBatch(nil, DefaultShardCount, 100)
+	b.dualWriter = w
+	for i := 0; i < 4; i++ {
+		b.add(&monitoring_pb.TimeSeries{
+			Resource: &monitoredres_pb.MonitoredResource{
+				Type:   "prometheus_target",
+				Labels: map[string]string{KeyProjectID: fmt.Sprintf("project-%d", i%2), KeyJob: "j1"},
+			},
+		})
+	}
+	// The regular requests fail, which does not affect the dual write.
+	b.send(context.Background(), func(context.Context, *monitoring_pb.CreateTimeSeriesRequest, ...gax.CallOption) error {
+		return errors.New("failed")
+	})
+	requests := <-w.queue
+	if len(requests) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(requests))
+	}
+	for _, l := range requests {
+		for _, s := range l {
+			if got := s.Resource.Labels[KeyProjectID]; got != "target" {
+				t.Errorf("expected project %q, got %q", "target", got)
+			}
+			if got := s.Resource.Labels[KeyJob]; got != "j1" {
+				t.Errorf("expected job %q, got %q", "j1", got)
+			}
+		}
+	}
+	// The original samples are not modified.
+	for key, l := range b.m {
+		for _, s := range l {
+			if got := s.Resource.Labels[KeyProjectID]; got != key.project {
+				t.Errorf("expected original project %q, got %q", key.project, got)
+			}
+		}
+	}
+
+	var (
+		mtx      sync.Mutex
+		projects = map[string]int{}
+	)
+	w.send(context.Background(), func(ctx context.Context, req *monitoring_pb.CreateTimeSeriesRequest, opts ...gax.CallOption) error {
+		mtx.Lock()
+		defer mtx.Unlock()
+		projects[req.Name] += len(req.TimeSeries)
+		return nil
+	}, requests)
+	if projects["projects/target"] != 4 || len(projects) != 1 {
+		t.Errorf("unexpected requests %v", projects)
+	}
+
+	// Batches are dropped if the queue is full.
+	dropped := testutil.ToFloat64(dualWriteSamples.WithLabelValues("dropped"))
+	w.add(requests)
+	w.add(requests)
+	if got := testutil.ToFloat64(dualWriteSamples.WithLabelValues("dropped")) - dropped; got != 4 {
+		t.Errorf("expected 4 dropped samples, got %v", got)
+	}
+}
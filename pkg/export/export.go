@@ -26,6 +26,7 @@ import (
 	"runtime/debug"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	monitoring "cloud.google.com/go/monitoring/apiv3/v2"
@@ -41,9 +42,13 @@ import (
 	"github.com/prometheus/prometheus/storage"
 	"github.com/prometheus/prometheus/tsdb/record"
 	"google.golang.org/api/option"
+	metric_pb "google.golang.org/genproto/googleapis/api/metric"
+	monitoredres_pb "google.golang.org/genproto/googleapis/api/monitoredres"
 	monitoring_pb "google.golang.org/genproto/googleapis/monitoring/v3"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/status"
 )
 
 var (
@@ -100,6 +105,41 @@ var (
 		// Limit buckets to 200, which is the real-world batch size for GCM.
 		Buckets: []float64{1, 2, 5, 10, 20, 50, 100, 150, 200},
 	})
+	matcherReloads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "gcm_export_matcher_reloads_total",
+		Help: "Number of times the matchers file was read by whether it succeeded.",
+	}, []string{"result"})
+	batchesSent = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "gcm_export_batches_sent_total",
+		Help: "Number of batches sent to GCM by whether they were full or the batch delay expired.",
+	}, []string{"reason"})
+	untypedSeries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "gcm_export_untyped_series_total",
+		Help: "Number of untyped series added to the series cache by the mode they are exported in.",
+	}, []string{"mode"})
+	sendDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "gcm_export_send_duration_seconds",
+		Help:    "Duration of requests to GCM, including retries, by whether they succeeded.",
+		Buckets: []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	}, []string{"result"})
+	shardSendDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "gcm_export_shard_send_duration_seconds",
+		Help:    "Duration for which a shard was blocked by an in-flight batch, observed once per shard in the batch.",
+		Buckets: []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	})
+	batchFillRatio = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "gcm_export_batch_fill_ratio",
+		Help:    "Ratio of the number of samples in a request to GCM to the maximum batch size.",
+		Buckets: []float64{0.05, 0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.7, 0.8, 0.9, 1},
+	})
+	queuedSamples = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "gcm_export_queued_samples",
+		Help: "Number of samples queued in the shards waiting to be sent.",
+	})
+	queueCapacity = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "gcm_export_queue_capacity_samples",
+		Help: "Number of samples that can be queued in the shards in total.",
+	})
 	ErrLocationGlobal = errors.New("Location must be set to a named Google Cloud " +
 		"region and cannot be set to \"global\". Please choose the " +
 		"Google Cloud region that is physically nearest to your cluster. " +
@@ -112,12 +152,53 @@ type Exporter struct {
 	opts   ExporterOpts
 
 	metricClient *monitoring.MetricClient
-	seriesCache  *seriesCache
-	shards       []*shard
+	// Clients for projects with dedicated credentials by project ID.
+	projectClients map[string]*monitoring.MetricClient
+	// Clients for namespaces with dedicated credentials by credentials file.
+	namespaceClients *clientCache
+	seriesCache      *seriesCache
+	// Detects skew of the local clock and adjusts sample timestamps for it.
+	clockSkew *clockSkewDetector
+	// The shards may be resized by Run and must be read locked with shardsMtx
+	// outside of it.
+	shardsMtx sync.RWMutex
+	shards    []*shard
+	// Optional buffer holding samples on disk while the shards are full.
+	diskBuffer *diskBuffer
+	// Guards the decision whether samples are queued in the shards or the disk buffer
+	// and the samples read from the disk buffer that wait for their shard.
+	diskBufferMtx sync.Mutex
+	// Samples read from the disk buffer, oldest first, that did not fit into their
+	// shard yet.
+	diskBufferHeld []queueEntry
+	retrier        *retrier
+	// Optional sink mirroring samples to a Prometheus remote write endpoint.
+	remoteWriter *remoteWriter
+	// Optional writer of all samples to a second project and the client used for it.
+	dualWriter       *dualWriter
+	dualWriterClient *monitoring.MetricClient
+	// Optional client used for writing service level objectives.
+	sloClient *monitoring.ServiceMonitoringClient
+	// Optional filter writing series at a lower resolution.
+	downsampler *downsampler
+	// Summaries of recent send errors served by the debug handler.
+	sendErrors *errorLog
+	// Counts of samples rejected by GCM by target.
+	rejections *targetRejections
+	// Optional log of series rejected by GCM.
+	deadLetters *deadLetterLog
+	// Optional local TSDB that sent samples are written to for debugging.
+	tsdbSink *tsdbSink
+	// Log of a sample of dropped points, which can be toggled at runtime.
+	drops *dropLog
+	// Optional backpressure signal for scrapes of low priority pools.
+	backpressure *backpressure
 
 	// Channel for signaling that there may be more work items to
 	// be processed.
 	nextc chan struct{}
+	// Whether sending samples is paused. Samples are queued but not sent while set.
+	paused atomic.Bool
 
 	// The external labels may be updated asynchronously by configuration changes
 	// and must be locked with mtx.
@@ -134,12 +215,19 @@ const (
 	// DefaultShardBufferSize represents the buffer size for each individual shard.
 	// Each element in buffer (queue) consists of sample and hash.
 	DefaultShardBufferSize = 2048
+	// ShardBufferSizeMax represents the maximum buffer size for each individual shard.
+	// Buffers are allocated upfront, so this bounds the memory used by the shards.
+	ShardBufferSizeMax = 65536
 
 	// BatchSizeMax represents maximum number of samples to pack into a batch sent to GCM.
 	BatchSizeMax = 200
-	// Time after an accumulating batch is flushed to GCM. This avoids data being
-	// held indefinititely if not enough new data flows in to fill up the batch.
-	batchDelayMax = 50 * time.Millisecond
+	// DefaultBatchDelay represents the time after which an accumulating batch is flushed
+	// to GCM. This avoids data being held indefinititely if not enough new data flows in
+	// to fill up the batch.
+	DefaultBatchDelay = 50 * time.Millisecond
+	// BatchDelayMin and BatchDelayMax represent the bounds of the batch delay.
+	BatchDelayMin = time.Millisecond
+	BatchDelayMax = 10 * time.Second
 
 	// Prefix for GCM metric.
 	MetricTypePrefix = "prometheus.googleapis.com"
@@ -151,16 +239,45 @@ const (
 	CompressionGZIP = "gzip"
 )
 
+// Supported modes for exporting summaries.
+const (
+	// Quantiles are written as gauges with a quantile label, count and sum as cumulatives.
+	SummaryModeAll = "all"
+	// Only quantiles are written.
+	SummaryModeQuantiles = "quantiles"
+	// Only count and sum are written.
+	SummaryModeCountSum = "count-sum"
+	// Summaries are not written at all.
+	SummaryModeDrop = "drop"
+)
+
 // ExporterOpts holds options for an exporter.
 type ExporterOpts struct {
 	// Whether to disable exporting of metrics.
 	Disable bool
+	// Whether to start with sending samples paused. See Exporter.Pause.
+	Paused bool
+	// Whether to disable exporting of exemplars. Exemplars are only exported for
+	// histograms as Cloud Monitoring only supports them on distributions.
+	DisableExemplars bool
 	// GCM API endpoint to send metric data to.
 	Endpoint string
 	// Compression format to use for gRPC requests.
 	Compression string
+	// TLS configures the TLS connection to the GCM API endpoint. Proxies set through
+	// the HTTPS_PROXY and NO_PROXY environment variables are always honored.
+	TLS TLSOpts
+	// Connection configures the pool of gRPC connections to the GCM API endpoint.
+	Connection ConnectionOpts
 	// Credentials file for authentication with the GCM API.
 	CredentialsFile string
+	// Token configures fetching the OAuth tokens of requests.
+	Token TokenOpts
+	// ProjectRouting configures writing series to different projects.
+	ProjectRouting ProjectRoutingOpts
+	// NamespaceCredentials configures writing the series of namespaces with
+	// dedicated credentials.
+	NamespaceCredentials NamespaceCredentialsOpts
 	// Disable authentication (for debugging purposes).
 	DisableAuth bool
 	// A user agent product string added to the regular user agent.
@@ -181,10 +298,43 @@ type ExporterOpts struct {
 	// This option matches the semantics of the Prometheus federation match[]
 	// parameter.
 	Matchers Matchers
+	// Optional file with further matchers, one per line. Series are exported if they
+	// match at least one of Matchers or the matchers in the file. The file is read
+	// again whenever ApplyConfig is called, i.e. on every configuration reload.
+	MatchersFile string
+	// Filter of exported series by metric name that applies in addition to the
+	// matchers, e.g. as a cluster-wide cost control.
+	MetricNames MetricNameOpts
 
 	// Prefix under which metrics are written to GCM.
 	MetricTypePrefix string
 
+	// Which series of summaries are written to GCM. Defaults to SummaryModeAll.
+	SummaryMode string
+
+	// How staleness markers of series are handled. Defaults to StalenessModeSilent.
+	StalenessMode string
+
+	// Series matching at least one of the matchers are of high priority, e.g. recorded
+	// series used for alerting. Their samples are queued separately and sent ahead of
+	// other samples, which are dropped first once the shards are full. If set, series
+	// selected by ServiceLevelObjectives are of high priority as well.
+	PriorityMatchers Matchers
+
+	// Untyped controls how metrics without a type are written to GCM.
+	Untyped UntypedOpts
+
+	// TypeConflicts controls how series whose metric type conflicts with the type of
+	// the other series of their metric are written to GCM.
+	TypeConflicts TypeConflictOpts
+
+	// TypePolicy drops or transforms all series of selected metric types.
+	TypePolicy TypePolicyOpts
+
+	// Metadata controls whether the types of series are looked up in the metadata of
+	// their targets or derived from the series themselves.
+	Metadata MetadataOpts
+
 	// A lease on a time range for which the exporter send sample data.
 	// It is checked for on each batch provided to the Export method.
 	// If unset, data is always sent.
@@ -198,10 +348,108 @@ type ExporterOpts struct {
 	// The project ID of an alternative project for quota attribution.
 	QuotaProject string
 
+	// Absolute skew of the local clock against the GCM API above which warnings
+	// are logged. Disabled if zero.
+	ClockSkewThreshold time.Duration
+	// Policy for samples written while the local clock is skewed by more than the
+	// threshold. One of ClockSkewPolicyWarn and ClockSkewPolicyAdjust. Defaults to
+	// ClockSkewPolicyWarn.
+	ClockSkewPolicy string
+
 	// Efficiency represents exporter options that allows fine-tuning of
 	// internal data structure sizes. Only for advance users. No compatibility
 	// guarantee (might change in future).
 	Efficiency EfficiencyOpts
+
+	// DiskBuffer configures buffering of samples on disk if they cannot be sent
+	// fast enough, e.g. during an outage of the GCM API.
+	DiskBuffer DiskBufferOpts
+
+	// DeadLetter configures logging the series of requests permanently rejected
+	// by GCM.
+	DeadLetter DeadLetterOpts
+
+	// Retry configures retries of requests to the GCM API that failed with a
+	// retryable error.
+	Retry RetryOpts
+
+	// Throttle configures client-side throttling of requests to the GCM API
+	// when it responds with quota errors.
+	Throttle ThrottleOpts
+
+	// RemoteWrite configures mirroring of samples to a Prometheus remote write
+	// endpoint in addition to GCM.
+	RemoteWrite RemoteWriteOpts
+
+	// DualWrite configures writing samples to a second project in addition to
+	// their regular one.
+	DualWrite DualWriteOpts
+
+	// DropLog configures logging of a sample of dropped points.
+	DropLog DropLogOpts
+
+	// Backpressure configures backing off scrapes of low priority pools while the
+	// export queues are backed up.
+	Backpressure BackpressureOpts
+
+	// TSDBSink configures writing samples into a local Prometheus TSDB for debugging,
+	// instead of or in addition to GCM.
+	TSDBSink TSDBSinkOpts
+
+	// MetricDescriptors configures writing the metadata of metrics as metric
+	// descriptors to GCM.
+	MetricDescriptors MetricDescriptorOpts
+
+	// SeriesCache configures the size limits of the cache of series metadata.
+	SeriesCache SeriesCacheOpts
+
+	// LabelSanitization configures how metric labels that are not compatible
+	// with GCM are handled.
+	LabelSanitization LabelSanitizationOpts
+
+	// ResourceMappings configures series that are written as other monitored resource
+	// types than prometheus_target. The first matching mapping applies.
+	ResourceMappings []ResourceMapping
+
+	// ServiceLevelObjectives configures service level objectives that are written to
+	// GCM for exported series.
+	ServiceLevelObjectives []ServiceLevelObjective
+
+	// Histograms configures bucket limits of histograms.
+	Histograms HistogramOpts
+
+	// Downsample configures writing series at a lower resolution than they are
+	// scraped at.
+	Downsample DownsampleOpts
+}
+
+// ProjectRoutingOpts represents exporter options for writing series to different
+// projects, e.g. projects owned by the tenants of a cluster.
+type ProjectRoutingOpts struct {
+	// Label is the name of a series label whose value is the project ID the series is
+	// written to. It takes precedence over the project_id label and is removed from
+	// the series. Series without the label are written to their regular project.
+	Label string
+	// Credentials maps project IDs to credentials files used for requests to the
+	// respective project. Requests to other projects use CredentialsFile.
+	Credentials map[string]string
+}
+
+// DefaultDiskBufferSize is the default size limit of the disk buffer.
+const DefaultDiskBufferSize = 1 << 30
+
+// DiskBufferOpts represents exporter options for buffering samples on disk.
+type DiskBufferOpts struct {
+	// Dir is the directory the buffered samples are stored in. The disk buffer is
+	// disabled if empty.
+	// Samples that do not fit into the buffer of their shard are written to the
+	// directory and sent once the shards have capacity again. Buffered samples are
+	// kept across restarts and synced to disk every few seconds, so that a crash
+	// loses or resends at most the samples of the last seconds.
+	Dir string
+	// MaxBytes limits the size of the buffered samples on disk. If exceeded, the
+	// oldest samples are dropped. Defaults to DefaultDiskBufferSize when 0.
+	MaxBytes int64
 }
 
 // EfficiencyOpts represents exporter options that allows fine-tuning of
@@ -220,8 +468,69 @@ type EfficiencyOpts struct {
 	// ShardBufferSize controls the size for each individual shard. Each element
 	// in buffer (queue) consists of sample and hash. Refer to Exporter.Run
 	// documentation to learn more about algorithm. Defaults to
-	// DefaultShardBufferSize when 0.
+	// DefaultShardBufferSize when 0 and must not exceed ShardBufferSizeMax. Samples
+	// are dropped if the buffer of their shard is full.
 	ShardBufferSize uint
+	// BatchDelay controls how long a batch that is not full is held back before it
+	// is sent. Larger values lead to fewer requests to the GCM API at the cost of
+	// latency. Defaults to DefaultBatchDelay when 0 and must be within BatchDelayMin
+	// and BatchDelayMax.
+	BatchDelay time.Duration
+
+	// MinShardCount and MaxShardCount bound the number of shards if they are resized
+	// at runtime based on how full their buffers are. ShardCount is the initial number
+	// of shards and must be within the bounds. Resizing is disabled if MaxShardCount
+	// is 0.
+	MinShardCount uint
+	MaxShardCount uint
+	// ShardResizeInterval controls how often the number of shards is reconsidered.
+	// Defaults to DefaultShardResizeInterval when 0.
+	ShardResizeInterval time.Duration
+}
+
+// Supported modes and metric type suffixes for exporting untyped metrics.
+const (
+	// Untyped series are written both as a gauge and as a cumulative.
+	UntypedModeDouble = "double"
+	// Untyped series are only written as a gauge.
+	UntypedModeGauge = "gauge"
+
+	// Untyped series written as a gauge only keep the metric type of the gauge they
+	// are written as in double mode, i.e. prometheus.googleapis.com/<name>/unknown.
+	UntypedGaugeSuffixUnknown = "unknown"
+	// Untyped series written as a gauge only get the metric type of regular gauges,
+	// i.e. prometheus.googleapis.com/<name>/gauge.
+	UntypedGaugeSuffixGauge = "gauge"
+)
+
+// UntypedOpts represents exporter options for metrics without a type, for example
+// because the target did not expose metadata for them.
+type UntypedOpts struct {
+	// How untyped series are written. Defaults to UntypedModeDouble.
+	Mode string
+	// Untyped series matching at least one of the matchers are written in gauge mode,
+	// regardless of Mode.
+	GaugeMatchers Matchers
+	// Untyped series matching at least one of the matchers are written in double mode,
+	// regardless of Mode. GaugeMatchers take precedence.
+	DoubleMatchers Matchers
+	// Metric type suffix of untyped series written in gauge mode.
+	// Defaults to UntypedGaugeSuffixUnknown.
+	GaugeSuffix string
+}
+
+// mode returns the mode in which the untyped series is written.
+func (o *UntypedOpts) mode(lset labels.Labels) string {
+	if len(o.GaugeMatchers) > 0 && o.GaugeMatchers.Matches(lset) {
+		return UntypedModeGauge
+	}
+	if len(o.DoubleMatchers) > 0 && o.DoubleMatchers.Matches(lset) {
+		return UntypedModeDouble
+	}
+	if o.Mode == UntypedModeGauge {
+		return UntypedModeGauge
+	}
+	return UntypedModeDouble
 }
 
 // NopExporter returns an inactive exporter.
@@ -258,7 +567,24 @@ func (alwaysLease) OnLeaderChange(f func()) {
 	// We never lose the lease as it's always owned.
 }
 
-func newMetricClient(ctx context.Context, opts ExporterOpts) (*monitoring.MetricClient, error) {
+func newMetricClient(ctx context.Context, logger log.Logger, opts ExporterOpts, skew *clockSkewDetector) (*monitoring.MetricClient, error) {
+	clientOpts, err := newClientOptions(logger, opts, skew)
+	if err != nil {
+		return nil, err
+	}
+	client, err := monitoring.NewMetricClient(ctx, clientOpts...)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Compression == CompressionGZIP {
+		client.CallOptions.CreateTimeSeries = append(client.CallOptions.CreateTimeSeries,
+			gax.WithGRPCOptions(grpc.UseCompressor(gzip.Name)))
+	}
+	return client, nil
+}
+
+// newClientOptions returns the options shared by all clients of GCM APIs.
+func newClientOptions(logger log.Logger, opts ExporterOpts, skew *clockSkewDetector) ([]option.ClientOption, error) {
 	version, err := Version()
 	if err != nil {
 		return nil, fmt.Errorf("unable to fetch user agent version: %w", err)
@@ -269,9 +595,14 @@ func newMetricClient(ctx context.Context, opts ExporterOpts) (*monitoring.Metric
 		ClientName, version, opts.UserAgentProduct, opts.UserAgentEnv, opts.UserAgentMode))
 
 	clientOpts := []option.ClientOption{
-		option.WithGRPCDialOption(grpc.WithUnaryInterceptor(grpc_prometheus.UnaryClientInterceptor)),
+		option.WithGRPCDialOption(grpc.WithChainUnaryInterceptor(
+			grpc_prometheus.UnaryClientInterceptor,
+			skew.interceptor(),
+			opts.Connection.streamLimiter(),
+		)),
 		option.WithUserAgent(ua),
 	}
+	clientOpts = append(clientOpts, opts.Connection.clientOptions()...)
 	if opts.Endpoint != "" {
 		clientOpts = append(clientOpts, option.WithEndpoint(opts.Endpoint))
 	}
@@ -280,26 +611,23 @@ func newMetricClient(ctx context.Context, opts ExporterOpts) (*monitoring.Metric
 			option.WithoutAuthentication(),
 			option.WithGRPCDialOption(grpc.WithInsecure()),
 		)
-	}
-	if opts.CredentialsFile != "" {
-		clientOpts = append(clientOpts, option.WithCredentialsFile(opts.CredentialsFile))
-	}
-	if opts.TokenURL != "" && opts.TokenBody != "" {
-		tokenSource := NewAltTokenSource(opts.TokenURL, opts.TokenBody)
+	} else {
+		creds, err := opts.TLS.transportCredentials()
+		if err != nil {
+			return nil, err
+		}
+		if creds != nil {
+			clientOpts = append(clientOpts, option.WithGRPCDialOption(grpc.WithTransportCredentials(creds)))
+		}
+		// Tokens for the credentials file, token URL, or the default credentials are
+		// fetched ahead of their expiry.
+		tokenSource := newPrefetchTokenSource(logger, opts.Token, newTokenSourceFunc(opts), skew)
 		clientOpts = append(clientOpts, option.WithTokenSource(tokenSource))
 	}
 	if opts.QuotaProject != "" {
 		clientOpts = append(clientOpts, option.WithQuotaProject(opts.QuotaProject))
 	}
-	client, err := monitoring.NewMetricClient(ctx, clientOpts...)
-	if err != nil {
-		return nil, err
-	}
-	if opts.Compression == CompressionGZIP {
-		client.CallOptions.CreateTimeSeries = append(client.CallOptions.CreateTimeSeries,
-			gax.WithGRPCOptions(grpc.UseCompressor(gzip.Name)))
-	}
-	return client, nil
+	return clientOpts, nil
 }
 
 // New returns a new Cloud Monitoring Exporter.
@@ -324,6 +652,43 @@ func New(logger log.Logger, reg prometheus.Registerer, opts ExporterOpts) (*Expo
 			pendingRequests,
 			projectsPerBatch,
 			samplesPerRPCBatch,
+			batchesSent,
+			untypedSeries,
+			clockSkew,
+			diskBufferBytes,
+			diskBufferSamples,
+			sendErrors,
+			sendRetries,
+			sendRetriesSkipped,
+			throttledRequests,
+			throttleRatio,
+			remoteWriteSamples,
+			remoteWriteRetries,
+			metricDescriptorWrites,
+			serviceLevelObjectiveWrites,
+			histogramsReduced,
+			sendDuration,
+			shardSendDuration,
+			batchFillRatio,
+			queuedSamples,
+			queueCapacity,
+			shardCount,
+			shardResizes,
+			shardUtilization,
+			labelViolations,
+			matcherReloads,
+			exportPaused,
+			credentialClients,
+			dualWriteSamples,
+			dualWriteSendDuration,
+			streamLimitWaits,
+			tokenRefreshes,
+			tokenRefreshDuration,
+			targetSamplesRejected,
+			deadLetterRequests,
+			tsdbSinkSamples,
+			backpressureActive,
+			backpressureScrapesSkipped,
 		)
 	}
 
@@ -339,34 +704,305 @@ func New(logger log.Logger, reg prometheus.Registerer, opts ExporterOpts) (*Expo
 	if opts.Efficiency.ShardBufferSize == 0 {
 		opts.Efficiency.ShardBufferSize = DefaultShardBufferSize
 	}
+	if opts.Efficiency.ShardBufferSize > ShardBufferSizeMax {
+		return nil, fmt.Errorf("maximum supported shard buffer size is %d, got %d", ShardBufferSizeMax, opts.Efficiency.ShardBufferSize)
+	}
+	if opts.Efficiency.BatchDelay == 0 {
+		opts.Efficiency.BatchDelay = DefaultBatchDelay
+	}
+	if opts.Efficiency.BatchDelay < BatchDelayMin || opts.Efficiency.BatchDelay > BatchDelayMax {
+		return nil, fmt.Errorf("batch delay must be between %s and %s, got %s", BatchDelayMin, BatchDelayMax, opts.Efficiency.BatchDelay)
+	}
+	if opts.Efficiency.MaxShardCount > 0 {
+		if opts.Efficiency.MinShardCount == 0 {
+			opts.Efficiency.MinShardCount = 1
+		}
+		if opts.Efficiency.ShardCount < opts.Efficiency.MinShardCount || opts.Efficiency.ShardCount > opts.Efficiency.MaxShardCount {
+			return nil, fmt.Errorf("shard count must be between the minimum %d and maximum %d, got %d",
+				opts.Efficiency.MinShardCount, opts.Efficiency.MaxShardCount, opts.Efficiency.ShardCount)
+		}
+		if opts.Efficiency.ShardResizeInterval == 0 {
+			opts.Efficiency.ShardResizeInterval = DefaultShardResizeInterval
+		}
+		if opts.Efficiency.ShardResizeInterval < 0 {
+			return nil, fmt.Errorf("shard resize interval must be positive, got %s", opts.Efficiency.ShardResizeInterval)
+		}
+	}
 
 	if opts.MetricTypePrefix == "" {
 		opts.MetricTypePrefix = MetricTypePrefix
 	}
+	switch opts.SummaryMode {
+	case "":
+		opts.SummaryMode = SummaryModeAll
+	case SummaryModeAll, SummaryModeQuantiles, SummaryModeCountSum, SummaryModeDrop:
+	default:
+		return nil, fmt.Errorf("unknown summary mode %q", opts.SummaryMode)
+	}
+	switch opts.ClockSkewPolicy {
+	case "":
+		opts.ClockSkewPolicy = ClockSkewPolicyWarn
+	case ClockSkewPolicyWarn:
+	case ClockSkewPolicyAdjust:
+		if opts.ClockSkewThreshold <= 0 {
+			return nil, fmt.Errorf("clock skew policy %q requires a positive clock skew threshold", opts.ClockSkewPolicy)
+		}
+	default:
+		return nil, fmt.Errorf("unknown clock skew policy %q", opts.ClockSkewPolicy)
+	}
+	switch opts.StalenessMode {
+	case "":
+		opts.StalenessMode = StalenessModeSilent
+	case StalenessModeSilent, StalenessModeEnd:
+	default:
+		return nil, fmt.Errorf("unknown staleness mode %q", opts.StalenessMode)
+	}
+	switch opts.Untyped.Mode {
+	case "":
+		opts.Untyped.Mode = UntypedModeDouble
+	case UntypedModeDouble, UntypedModeGauge:
+	default:
+		return nil, fmt.Errorf("unknown untyped mode %q", opts.Untyped.Mode)
+	}
+	switch opts.Untyped.GaugeSuffix {
+	case "":
+		opts.Untyped.GaugeSuffix = UntypedGaugeSuffixUnknown
+	case UntypedGaugeSuffixUnknown, UntypedGaugeSuffixGauge:
+	default:
+		return nil, fmt.Errorf("unknown untyped gauge suffix %q", opts.Untyped.GaugeSuffix)
+	}
+	if opts.DiskBuffer.MaxBytes == 0 {
+		opts.DiskBuffer.MaxBytes = DefaultDiskBufferSize
+	}
+	if opts.DiskBuffer.MaxBytes < 0 {
+		return nil, fmt.Errorf("disk buffer size must not be negative, got %d", opts.DiskBuffer.MaxBytes)
+	}
+	if err := opts.Retry.validate(); err != nil {
+		return nil, err
+	}
+	if err := opts.Throttle.validate(); err != nil {
+		return nil, err
+	}
+	if err := opts.RemoteWrite.validate(); err != nil {
+		return nil, err
+	}
+	if err := opts.DualWrite.validate(); err != nil {
+		return nil, err
+	}
+	if err := opts.TSDBSink.validate(); err != nil {
+		return nil, err
+	}
+	if err := opts.DropLog.validate(); err != nil {
+		return nil, err
+	}
+	if err := opts.Backpressure.validate(); err != nil {
+		return nil, err
+	}
+	if opts.TSDBSink.Only || opts.RemoteWrite.Only {
+		// No requests are made to GCM, so no credentials are needed.
+		opts.DisableAuth = true
+	}
+	if err := opts.Connection.validate(); err != nil {
+		return nil, err
+	}
+	if err := opts.SeriesCache.validate(); err != nil {
+		return nil, err
+	}
+	if err := opts.LabelSanitization.validate(); err != nil {
+		return nil, err
+	}
+	if err := opts.Token.validate(); err != nil {
+		return nil, err
+	}
+	if err := opts.DeadLetter.validate(); err != nil {
+		return nil, err
+	}
+	if err := opts.TypeConflicts.validate(); err != nil {
+		return nil, err
+	}
+	if err := opts.TypePolicy.validate(); err != nil {
+		return nil, err
+	}
+	if err := opts.Metadata.validate(); err != nil {
+		return nil, err
+	}
+	if err := opts.NamespaceCredentials.validate(); err != nil {
+		return nil, err
+	}
+	if err := opts.Histograms.validate(); err != nil {
+		return nil, err
+	}
+	if err := opts.Downsample.validate(); err != nil {
+		return nil, err
+	}
+	for i := range opts.ResourceMappings {
+		if err := opts.ResourceMappings[i].validate(); err != nil {
+			return nil, err
+		}
+	}
+	for i := range opts.ServiceLevelObjectives {
+		if err := opts.ServiceLevelObjectives[i].validate(); err != nil {
+			return nil, err
+		}
+	}
+	if opts.MetricDescriptors.RateLimit == 0 {
+		opts.MetricDescriptors.RateLimit = DefaultMetricDescriptorRateLimit
+	}
+	if opts.MetricDescriptors.RateLimit < 0 {
+		return nil, fmt.Errorf("metric descriptor rate limit must be positive, got %f", opts.MetricDescriptors.RateLimit)
+	}
 	if opts.Lease == nil {
 		opts.Lease = alwaysLease{}
 	}
 
-	metricClient, err := newMetricClient(context.Background(), opts)
+	skew := newClockSkewDetector(logger, opts.ClockSkewThreshold, opts.ClockSkewPolicy)
+
+	if opts.Endpoint != "" {
+		proxy, err := endpointProxy(opts.Endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy configuration: %w", err)
+		}
+		if proxy != nil {
+			level.Info(logger).Log("msg", "connecting to GCM API through proxy", "endpoint", opts.Endpoint, "proxy", proxy.Redacted())
+		}
+	}
+
+	metricClient, err := newMetricClient(context.Background(), logger, opts, skew)
 	if err != nil {
 		return nil, fmt.Errorf("create metric client: %w", err)
 	}
+	projectClients := make(map[string]*monitoring.MetricClient, len(opts.ProjectRouting.Credentials))
+	for project, credentialsFile := range opts.ProjectRouting.Credentials {
+		projectOpts := opts
+		projectOpts.CredentialsFile = credentialsFile
+
+		client, err := newMetricClient(context.Background(), logger, projectOpts, skew)
+		if err != nil {
+			return nil, fmt.Errorf("create metric client for project %q: %w", project, err)
+		}
+		projectClients[project] = client
+	}
 	e := &Exporter{
 		logger:               logger,
 		opts:                 opts,
 		metricClient:         metricClient,
+		projectClients:       projectClients,
+		clockSkew:            skew,
 		nextc:                make(chan struct{}, 1),
 		shards:               make([]*shard, opts.Efficiency.ShardCount),
+		sendErrors:           newErrorLog(),
+		rejections:           newTargetRejections(),
 		warnedUntypedMetrics: map[string]struct{}{},
 	}
-	e.seriesCache = newSeriesCache(logger, reg, opts.MetricTypePrefix, opts.Matchers)
+	if len(opts.NamespaceCredentials.Files) > 0 {
+		e.namespaceClients = newClientCache(logger, opts.NamespaceCredentials.IdleTimeout, func(file string) (*monitoring.MetricClient, error) {
+			namespaceOpts := opts
+			namespaceOpts.CredentialsFile = file
+			return newMetricClient(context.Background(), logger, namespaceOpts, skew)
+		})
+	}
+	if opts.Paused {
+		e.paused.Store(true)
+		exportPaused.Set(1)
+	}
+	matchers := opts.Matchers
+	if opts.MatchersFile != "" {
+		fileMatchers, err := readMatchersFile(opts.MatchersFile)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(append(Matchers{}, opts.Matchers...), fileMatchers...)
+	}
+	e.seriesCache = newSeriesCache(logger, reg, opts.MetricTypePrefix, matchers)
+	e.drops = newDropLog(logger, opts.DropLog)
+	e.seriesCache.drops = e.drops
+	e.seriesCache.metricNames, err = newMetricNameFilter(opts.MetricNames)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Throttle.Disable {
+		e.retrier = newRetrier(opts.Retry, nil)
+	} else {
+		e.retrier = newRetrier(opts.Retry, newThrottler(opts.Throttle))
+	}
+	e.seriesCache.summaryMode = opts.SummaryMode
+	e.seriesCache.stalenessMode = opts.StalenessMode
+	e.seriesCache.priorityMatchers = opts.PriorityMatchers
+	e.seriesCache.projectLabel = opts.ProjectRouting.Label
+	e.seriesCache.opts = opts.SeriesCache
+	if opts.SeriesCache.StateFile != "" {
+		if err := e.seriesCache.loadResetState(); err != nil {
+			// Start without the state rather than failing as it only improves continuity.
+			level.Warn(logger).Log("msg", "loading counter reset state failed", "err", err)
+		}
+	}
+	e.seriesCache.sanitizer = newLabelSanitizer(logger, opts.LabelSanitization)
+	e.seriesCache.resourceMappings = opts.ResourceMappings
+	e.seriesCache.histograms = opts.Histograms
+	if opts.RemoteWrite.URL != "" {
+		e.remoteWriter = newRemoteWriter(logger, opts.RemoteWrite)
+	}
+	if opts.DualWrite.ProjectID != "" {
+		e.dualWriter = newDualWriter(logger, opts.DualWrite)
+		if opts.DualWrite.CredentialsFile != "" {
+			dualWriteOpts := opts
+			dualWriteOpts.CredentialsFile = opts.DualWrite.CredentialsFile
+
+			e.dualWriterClient, err = newMetricClient(context.Background(), logger, dualWriteOpts, skew)
+			if err != nil {
+				return nil, fmt.Errorf("create metric client for dual write project: %w", err)
+			}
+		}
+	}
+	if opts.MetricDescriptors.Enable {
+		e.seriesCache.descriptors = newDescriptorWriter(logger, opts.MetricDescriptors)
+	}
+	if opts.Downsample.Interval > 0 {
+		e.downsampler = newDownsampler(opts.Downsample)
+	}
+	e.backpressure = newBackpressure(logger, opts.Backpressure)
+	if len(opts.ServiceLevelObjectives) > 0 {
+		clientOpts, err := newClientOptions(logger, opts, skew)
+		if err != nil {
+			return nil, err
+		}
+		e.sloClient, err = monitoring.NewServiceMonitoringClient(context.Background(), clientOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("create service monitoring client: %w", err)
+		}
+		e.seriesCache.slos = newSLOWriter(logger, opts.ServiceLevelObjectives)
+	}
+	e.seriesCache.untyped = opts.Untyped
+	e.seriesCache.typeConflicts = opts.TypeConflicts.Strategy
+	e.seriesCache.typePolicy = opts.TypePolicy
+	e.seriesCache.metadata = opts.Metadata
 
 	// Whenever the lease is lost, clear the series cache so we don't start off of out-of-range
 	// reset timestamps when we gain the lease again.
 	opts.Lease.OnLeaderChange(e.seriesCache.clear)
 
 	for i := range e.shards {
-		e.shards[i] = newShard(opts.Efficiency.ShardBufferSize)
+		e.shards[i] = e.newShard()
+	}
+	queueCapacity.Set(float64(uint(len(e.shards)) * e.shardCapacity()))
+	shardCount.Set(float64(len(e.shards)))
+	if opts.DiskBuffer.Dir != "" {
+		e.diskBuffer, err = openDiskBuffer(logger, opts.DiskBuffer.Dir, opts.DiskBuffer.MaxBytes)
+		if err != nil {
+			return nil, fmt.Errorf("open disk buffer: %w", err)
+		}
+	}
+	if opts.DeadLetter.Path != "" {
+		e.deadLetters, err = openDeadLetterLog(opts.DeadLetter)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if opts.TSDBSink.Path != "" {
+		e.tsdbSink, err = openTSDBSink(logger, opts.TSDBSink)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return e, nil
@@ -382,9 +1018,41 @@ const (
 	KeyInstance  = "instance"
 )
 
+// KeyMetricTypePrefix is the label overriding the metric type prefix of a series.
+// It is reserved for relabeling rules generated by the operator, which drop scraped
+// labels of the same name. It is not written as a metric label.
+const KeyMetricTypePrefix = "__gmp_metric_type_prefix__"
+
+// metricTypePrefixDomains are the domains of metric types whose prefix may be set
+// through KeyMetricTypePrefix.
+var metricTypePrefixDomains = []string{
+	"prometheus.googleapis.com",
+	"custom.googleapis.com",
+	"external.googleapis.com",
+	"workload.googleapis.com",
+}
+
+// ValidateMetricTypePrefix returns an error if the prefix is not within one of the
+// metric type domains series may be written to through KeyMetricTypePrefix.
+func ValidateMetricTypePrefix(prefix string) error {
+	for _, d := range metricTypePrefixDomains {
+		if prefix == d || strings.HasPrefix(prefix, d+"/") {
+			return nil
+		}
+	}
+	return fmt.Errorf("metric type prefix %q must be one of or below %s", prefix, strings.Join(metricTypePrefixDomains, ", "))
+}
+
 // ApplyConfig updates the exporter state to the given configuration.
 // Must be called at least once before Export() can be used.
 func (e *Exporter) ApplyConfig(cfg *config.Config) (err error) {
+	if e.opts.MatchersFile != "" {
+		if err := e.reloadMatchers(); err != nil {
+			matcherReloads.WithLabelValues("failure").Inc()
+			return err
+		}
+		matcherReloads.WithLabelValues("success").Inc()
+	}
 	// If project_id, location, or cluster were set through the external_labels in the config file,
 	// these values take precedence. If they are unset, the flag value, which defaults to an
 	// environment-specific value on GCE/GKE, is used.
@@ -425,6 +1093,39 @@ func (e *Exporter) ApplyConfig(cfg *config.Config) (err error) {
 	return nil
 }
 
+// reloadMatchers reads the matchers file again and applies the matchers if they changed.
+func (e *Exporter) reloadMatchers() error {
+	fileMatchers, err := readMatchersFile(e.opts.MatchersFile)
+	if err != nil {
+		return err
+	}
+	matchers := append(append(Matchers{}, e.opts.Matchers...), fileMatchers...)
+	if e.seriesCache.setMatchers(matchers) {
+		level.Info(e.logger).Log("msg", "applied new export matchers", "matchers", matchers.String())
+	}
+	return nil
+}
+
+// readMatchersFile reads matchers from a file with one matcher per line. Empty lines
+// and lines starting with # are ignored.
+func readMatchersFile(filename string) (Matchers, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("read matchers file: %w", err)
+	}
+	var matchers Matchers
+	for _, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := matchers.Set(line); err != nil {
+			return nil, fmt.Errorf("matchers file %q: %w", filename, err)
+		}
+	}
+	return matchers, nil
+}
+
 // SetLabelsByIDFunc injects a function that can be used to retrieve a label set
 // based on a series ID we got through exported sample records.
 // Must be called before any call to Export is made.
@@ -450,7 +1151,13 @@ func (e *Exporter) Export(metadata MetadataFunc, batch []record.RefSample, exemp
 		return
 	}
 
-	metadata = e.wrapMetadata(metadata)
+	if e.opts.Metadata.Mode == MetadataModeHeuristic {
+		// The series cache derives the metadata from the series instead.
+		metadata = nil
+	} else {
+		metadata = e.wrapMetadata(metadata)
+	}
+	exemplarMap = e.filterExemplars(exemplarMap)
 
 	e.mtx.Lock()
 	externalLabels := e.externalLabels
@@ -466,6 +1173,11 @@ func (e *Exporter) Export(metadata MetadataFunc, batch []record.RefSample, exemp
 	defer builder.close()
 	exemplarsExported.Add(float64(len(exemplarMap)))
 
+	if e.remoteWriter != nil {
+		// Building the samples populates the series cache, from which the mirrored
+		// samples take their labels.
+		defer e.mirror(batch, externalLabels)
+	}
 	for len(batch) > 0 {
 		var (
 			samples []hashedSeries
@@ -476,24 +1188,119 @@ func (e *Exporter) Export(metadata MetadataFunc, batch []record.RefSample, exemp
 			level.Debug(e.logger).Log("msg", "building sample failed", "err", err)
 			continue
 		}
+		// Samples only written to the remote write endpoint are not sent to GCM and
+		// must not count towards its metrics.
+		if e.opts.RemoteWrite.Only {
+			continue
+		}
 		for _, s := range samples {
-			// Only enqueue samples for within our HA range.
-			if sampleInRange(s.proto, start, end) {
-				e.enqueue(s.hash, s.proto)
-			} else {
-				// Hashed series protos should only ever have one point. If this is
-				// a distribution increase exemplarsDropped if there are exemplars.
-				if dist := s.proto.Points[0].Value.GetDistributionValue(); dist != nil {
-					exemplarsDropped.WithLabelValues("not-in-ha-range").Add(float64(len(dist.GetExemplars())))
-				}
-				samplesDropped.WithLabelValues("not-in-ha-range").Inc()
-			}
+			e.enqueueInRange(s, start, end)
 		}
 	}
 	// Signal that new data is available.
 	e.triggerNext()
 }
 
+// ExportHistograms enqueues the native histogram samples and exemplars to be written to
+// Cloud Monitoring as distributions. Native histograms are always written as histograms,
+// regardless of the type returned by the metadata function.
+func (e *Exporter) ExportHistograms(metadata MetadataFunc, batch []record.RefHistogramSample, exemplarMap map[storage.SeriesRef]record.RefExemplar) {
+	samplesExported.Add(float64(len(batch)))
+
+	if e.opts.Disable {
+		return
+	}
+
+	if e.opts.Metadata.Mode == MetadataModeHeuristic {
+		metadata = nil
+	}
+	metadata = e.wrapMetadata(nativeHistogramMetadata(metadata))
+	exemplarMap = e.filterExemplars(exemplarMap)
+
+	e.mtx.Lock()
+	externalLabels := e.externalLabels
+	start, end, ok := e.opts.Lease.Range()
+	e.mtx.Unlock()
+
+	if !ok {
+		exemplarsDropped.WithLabelValues("no-ha-range").Add(float64(len(exemplarMap)))
+		samplesDropped.WithLabelValues("no-ha-range").Add(float64(len(batch)))
+		return
+	}
+	// Native histograms cannot be written to the remote write endpoint.
+	if e.opts.RemoteWrite.Only {
+		exemplarsDropped.WithLabelValues("remote-write-only").Add(float64(len(exemplarMap)))
+		samplesDropped.WithLabelValues("remote-write-only").Add(float64(len(batch)))
+		return
+	}
+	builder := newSampleBuilder(e.seriesCache)
+	defer builder.close()
+	exemplarsExported.Add(float64(len(exemplarMap)))
+
+	for _, sample := range batch {
+		s, err := builder.nextHistogram(metadata, externalLabels, sample, exemplarMap)
+		if err != nil {
+			level.Debug(e.logger).Log("msg", "building histogram sample failed", "err", err)
+			continue
+		}
+		if s != nil {
+			e.enqueueInRange(*s, start, end)
+		}
+	}
+	// Signal that new data is available.
+	e.triggerNext()
+}
+
+// filterExemplars returns nil and counts the exemplars as dropped if exporting
+// exemplars is disabled.
+func (e *Exporter) filterExemplars(exemplarMap map[storage.SeriesRef]record.RefExemplar) map[storage.SeriesRef]record.RefExemplar {
+	if !e.opts.DisableExemplars {
+		return exemplarMap
+	}
+	exemplarsDropped.WithLabelValues("disabled").Add(float64(len(exemplarMap)))
+	return nil
+}
+
+// mirror queues the samples for the remote write endpoint with the external labels
+// merged into the series labels. Like for GCM, only series passing the export
+// filters are mirrored.
+func (e *Exporter) mirror(batch []record.RefSample, externalLabels labels.Labels) {
+	for _, s := range batch {
+		lset := e.seriesCache.getExportedLabels(storage.SeriesRef(s.Ref))
+		if lset == nil {
+			continue
+		}
+		builder := labels.NewBuilder(lset)
+		for _, l := range externalLabels {
+			if !lset.Has(l.Name) {
+				builder.Set(l.Name, l.Value)
+			}
+		}
+		e.remoteWriter.add(builder.Labels(labels.EmptyLabels()), s.T, s.V)
+	}
+}
+
+// enqueueInRange enqueues the sample if it is within our HA range and drops it otherwise.
+func (e *Exporter) enqueueInRange(s hashedSeries, start, end time.Time) {
+	if sampleInRange(s.proto, start, end) {
+		if e.downsampler != nil && !e.downsampler.keep(s) {
+			samplesDropped.WithLabelValues("downsampled").Inc()
+			e.drops.timeSeries("downsampled", s.proto, 1)
+			return
+		}
+		e.clockSkew.adjustTimestamps(s.proto)
+		e.enqueue(queueEntry{hash: s.hash, sample: s.proto, priority: s.priority})
+		return
+	}
+	// Hashed series protos should only ever have one point. If this is
+	// a distribution increase exemplarsDropped if there are exemplars.
+	if dist := s.proto.Points[0].Value.GetDistributionValue(); dist != nil {
+		exemplarsDropped.WithLabelValues("not-in-ha-range").Add(float64(len(dist.GetExemplars())))
+	}
+	samplesDropped.WithLabelValues("not-in-ha-range").Inc()
+	e.drops.timeSeries("not-in-ha-range", s.proto, 1)
+}
+
 func sampleInRange(sample *monitoring_pb.TimeSeries, start, end time.Time) bool {
 	// A sample has exactly one point in the time series. The start timestamp may be unset for gauges.
 	if s := sample.Points[0].Interval.StartTime; s != nil && s.AsTime().Before(start) {
@@ -505,9 +1312,141 @@ func sampleInRange(sample *monitoring_pb.TimeSeries, start, end time.Time) bool
 	return true
 }
 
-func (e *Exporter) enqueue(hash uint64, sample *monitoring_pb.TimeSeries) {
-	idx := hash % uint64(len(e.shards))
-	e.shards[idx].enqueue(hash, sample)
+func (e *Exporter) enqueue(qe queueEntry) {
+	e.shardsMtx.RLock()
+	defer e.shardsMtx.RUnlock()
+
+	idx := qe.hash % uint64(len(e.shards))
+	if e.diskBuffer == nil {
+		if !e.shards[idx].enqueue(qe) {
+			e.drops.timeSeries("queue-full", qe.sample, 1)
+		}
+		return
+	}
+	// While the disk buffer holds samples, new samples are appended to it as well
+	// so that samples of a series are sent in order. The disk buffer does not retain
+	// the priority of samples.
+	e.diskBufferMtx.Lock()
+	defer e.diskBufferMtx.Unlock()
+
+	if len(e.diskBufferHeld) == 0 && e.diskBuffer.empty() && e.shards[idx].tryEnqueue(qe) {
+		return
+	}
+	if err := e.diskBuffer.add(qe.hash, qe.sample); err != nil {
+		level.Error(e.logger).Log("msg", "writing sample to disk buffer failed", "err", err)
+		samplesDropped.WithLabelValues("disk-buffer-error").Inc()
+	}
+}
+
+// Maximum number of samples read from the disk buffer that are held in memory while
+// their shard is full.
+const diskBufferHeldMax = 10000
+
+// refillShards moves samples from the disk buffer into the shards, oldest first.
+// Samples whose shard is full are held back along with all later samples of the same
+// shard, which keeps the samples of each series in order, while the other shards
+// continue to be filled.
+func (e *Exporter) refillShards() {
+	if e.diskBuffer == nil {
+		return
+	}
+	e.diskBufferMtx.Lock()
+	defer e.diskBufferMtx.Unlock()
+
+	full := map[uint64]struct{}{}
+	tryEnqueue := func(qe queueEntry) bool {
+		idx := qe.hash % uint64(len(e.shards))
+		if _, ok := full[idx]; ok {
+			return false
+		}
+		if !e.shards[idx].tryEnqueue(qe) {
+			full[idx] = struct{}{}
+			return false
+		}
+		return true
+	}
+	held := e.diskBufferHeld[:0]
+	for _, qe := range e.diskBufferHeld {
+		if !tryEnqueue(qe) {
+			held = append(held, qe)
+		}
+	}
+	for len(held) < diskBufferHeldMax && len(full) < len(e.shards) {
+		hash, sample, ok := e.diskBuffer.peek()
+		if !ok {
+			break
+		}
+		e.diskBuffer.advance()
+
+		if qe := (queueEntry{hash: hash, sample: sample}); !tryEnqueue(qe) {
+			held = append(held, qe)
+		}
+	}
+	e.diskBufferHeld = held
+}
+
+// diskBufferEmpty returns true if no samples are in the disk buffer or held back
+// after reading them from it.
+func (e *Exporter) diskBufferEmpty() bool {
+	e.diskBufferMtx.Lock()
+	defer e.diskBufferMtx.Unlock()
+
+	return len(e.diskBufferHeld) == 0 && e.diskBuffer.empty()
+}
+
+// closeDiskBuffer persists the samples remaining in the shards and closes the disk buffer.
+// If the disk buffer is not empty, the samples in the shards and those held back are older
+// than the buffered ones and cannot be appended to it. They are counted as dropped.
+func (e *Exporter) closeDiskBuffer() {
+	e.diskBufferMtx.Lock()
+	defer e.diskBufferMtx.Unlock()
+
+	var queued []queueEntry
+	for _, s := range e.shards {
+		queued = append(queued, s.drain()...)
+	}
+	queued = append(queued, e.diskBufferHeld...)
+	e.diskBufferHeld = nil
+
+	if e.diskBuffer.empty() {
+		for _, qe := range queued {
+			if err := e.diskBuffer.add(qe.hash, qe.sample); err != nil {
+				level.Error(e.logger).Log("msg", "writing sample to disk buffer failed", "err", err)
+				samplesDropped.WithLabelValues("disk-buffer-error").Inc()
+			}
+		}
+	} else if len(queued) > 0 {
+		level.Warn(e.logger).Log("msg", "dropping queued samples older than the disk buffer on shutdown", "samples", len(queued))
+		samplesDropped.WithLabelValues("disk-buffer-shutdown").Add(float64(len(queued)))
+	}
+	if err := e.diskBuffer.close(); err != nil {
+		level.Error(e.logger).Log("msg", "closing disk buffer failed", "err", err)
+	}
+}
+
+// createTimeSeries writes the time series of the request with the client for the
+// request's namespace credentials or project.
+func (e *Exporter) createTimeSeries(ctx context.Context, req *monitoring_pb.CreateTimeSeriesRequest, opts ...gax.CallOption) error {
+	if file := credentialsFileFromContext(ctx); file != "" {
+		client, err := e.namespaceClients.get(file)
+		if err != nil {
+			return err
+		}
+		return client.CreateTimeSeries(ctx, req, opts...)
+	}
+	if client, ok := e.projectClients[strings.TrimPrefix(req.Name, "projects/")]; ok {
+		return client.CreateTimeSeries(ctx, req, opts...)
+	}
+	return e.metricClient.CreateTimeSeries(ctx, req, opts...)
+}
+
+// createMetricDescriptor writes the metric descriptor of the request with the client for
+// the request's project.
+func (e *Exporter) createMetricDescriptor(ctx context.Context, req *monitoring_pb.CreateMetricDescriptorRequest, opts ...gax.CallOption) (*metric_pb.MetricDescriptor, error) {
+	if client, ok := e.projectClients[strings.TrimPrefix(req.Name, "projects/")]; ok {
+		return client.CreateMetricDescriptor(ctx, req, opts...)
+	}
+	return e.metricClient.CreateMetricDescriptor(ctx, req, opts...)
 }
 
 func (e *Exporter) triggerNext() {
@@ -517,6 +1456,23 @@ func (e *Exporter) triggerNext() {
 	}
 }
 
+// Idle returns whether all samples passed to Export have been sent, i.e. no samples
+// are queued in the shards or the disk buffer and no batch is in flight.
+func (e *Exporter) Idle() bool {
+	e.shardsMtx.RLock()
+	defer e.shardsMtx.RUnlock()
+
+	if e.diskBuffer != nil && !e.diskBufferEmpty() {
+		return false
+	}
+	for _, s := range e.shards {
+		if s.length() > 0 || s.isPending() {
+			return false
+		}
+	}
+	return true
+}
+
 const (
 	// ClientName is used to identify the User Agent.
 	ClientName = "prometheus-engine-export"
@@ -621,10 +1577,46 @@ func Version() (string, error) {
 // user configuration or, even worse, runtime changes to the shard number.
 func (e *Exporter) Run(ctx context.Context) error {
 	defer e.metricClient.Close()
+	for _, client := range e.projectClients {
+		defer client.Close()
+	}
 	go e.seriesCache.run(ctx)
 	go e.opts.Lease.Run(ctx)
+	if e.remoteWriter != nil {
+		go e.remoteWriter.run(ctx)
+	}
+	if e.tsdbSink != nil {
+		go e.tsdbSink.run(ctx)
+	}
+	if e.dualWriter != nil {
+		send := e.createTimeSeries
+		if e.dualWriterClient != nil {
+			defer e.dualWriterClient.Close()
+			send = func(ctx context.Context, req *monitoring_pb.CreateTimeSeriesRequest, opts ...gax.CallOption) error {
+				return e.dualWriterClient.CreateTimeSeries(ctx, req, opts...)
+			}
+		}
+		go e.dualWriter.run(ctx, send)
+	}
+	if e.seriesCache.descriptors != nil {
+		go e.seriesCache.descriptors.run(ctx, e.createMetricDescriptor)
+	}
+	if e.seriesCache.slos != nil {
+		defer e.sloClient.Close()
+		go e.seriesCache.slos.run(ctx, e.sloClient)
+	}
+	if e.namespaceClients != nil {
+		go e.namespaceClients.run(ctx)
+	}
+	if e.downsampler != nil {
+		go e.downsampler.run(ctx, e.opts.SeriesCache.StalenessPeriod)
+	}
+	go e.rejections.run(ctx)
+	if e.deadLetters != nil {
+		defer e.deadLetters.close()
+	}
 
-	timer := time.NewTimer(batchDelayMax)
+	timer := time.NewTimer(e.opts.Efficiency.BatchDelay)
 	stopTimer := func() {
 		if !timer.Stop() {
 			select {
@@ -635,16 +1627,49 @@ func (e *Exporter) Run(ctx context.Context) error {
 	}
 	defer stopTimer()
 
-	curBatch := newBatch(e.logger, e.opts.Efficiency.ShardCount, e.opts.Efficiency.BatchSize)
+	// The number of shards is reconsidered periodically if resizing is enabled. A resize
+	// is deferred until no batch is in flight.
+	var (
+		resizec      <-chan time.Time
+		resizeShards uint
+	)
+	if e.opts.Efficiency.MaxShardCount > 0 {
+		ticker := time.NewTicker(e.opts.Efficiency.ShardResizeInterval)
+		defer ticker.Stop()
+		resizec = ticker.C
+	}
+	var backpressurec <-chan time.Time
+	if e.backpressure != nil {
+		ticker := time.NewTicker(backpressureCheckInterval)
+		defer ticker.Stop()
+		backpressurec = ticker.C
+	}
+	var diskBufferSyncc <-chan time.Time
+	if e.diskBuffer != nil {
+		ticker := time.NewTicker(diskBufferSyncInterval)
+		defer ticker.Stop()
+		diskBufferSyncc = ticker.C
+	}
+
+	curBatch := e.newBatch()
+
+	sendOne := e.retrier.wrap(e.createTimeSeries)
+	if e.opts.TSDBSink.Only || e.opts.RemoteWrite.Only {
+		sendOne = func(context.Context, *monitoring_pb.CreateTimeSeriesRequest, ...gax.CallOption) error {
+			return nil
+		}
+	}
 
 	// Send the currently accumulated batch to GCM asynchronously.
-	send := func() {
+	send := func(reason string) {
+		batchesSent.WithLabelValues(reason).Inc()
+
 		// Send the batch and once it completed, trigger next to process remaining data in the
 		// shards that were part of the batch. This ensures that if we didn't take all samples
 		// from a shard when filling the batch, we'll come back for them and any queue built-up
 		// gets sent eventually.
 		go func(ctx context.Context, b *batch) {
-			b.send(ctx, e.metricClient.CreateTimeSeries)
+			b.send(ctx, sendOne)
 			// We could only trigger if we didn't fully empty shards in this batch.
 			// Benchmarking showed no beneficial impact of this optimization.
 			e.triggerNext()
@@ -652,9 +1677,9 @@ func (e *Exporter) Run(ctx context.Context) error {
 
 		// Reset state for new batch.
 		stopTimer()
-		timer.Reset(batchDelayMax)
+		timer.Reset(e.opts.Efficiency.BatchDelay)
 
-		curBatch = newBatch(e.logger, e.opts.Efficiency.ShardCount, e.opts.Efficiency.BatchSize)
+		curBatch = e.newBatch()
 	}
 
 	for {
@@ -662,13 +1687,35 @@ func (e *Exporter) Run(ctx context.Context) error {
 		// NOTE(freinartz): we will terminate once context is cancelled and not flush remaining
 		// buffered data. In-flight requests will be aborted as well.
 		// This is fine once we persist data submitted via Export() but for now there may be some
-		// data loss on shutdown.
+		// data loss on shutdown. If the disk buffer is enabled, queued samples are persisted to it.
 		case <-ctx.Done():
+			if e.diskBuffer != nil {
+				e.closeDiskBuffer()
+			}
 			return nil
 		// This is activated for each new sample that arrives
 		case <-e.nextc:
 			sendIterations.Inc()
 
+			if resizeShards > 0 {
+				// Send the accumulated batch so that its shards are no longer pending. New
+				// batches are only filled once the resize is done. Completed sends trigger
+				// another attempt.
+				if !curBatch.empty() {
+					send("resize")
+				}
+				if !e.resizeShards(resizeShards) {
+					continue
+				}
+				resizeShards = 0
+			}
+			e.refillShards()
+
+			// While paused, samples stay queued in the shards until they are full.
+			if e.Paused() {
+				continue
+			}
+
 			// Drain shards to fill up the batch.
 			//
 			// If the shard count is high given the overall throughput, a lot of shards may
@@ -680,16 +1727,34 @@ func (e *Exporter) Run(ctx context.Context) error {
 			for _, shard := range e.shards {
 				shard.fill(curBatch)
 				if curBatch.full() {
-					send()
+					send("full")
 				}
 			}
 
+		case <-resizec:
+			if n := e.desiredShardCount(); n != uint(len(e.shards)) {
+				resizeShards = n
+				e.triggerNext()
+			}
+
+		case now := <-backpressurec:
+			e.backpressure.update(e.queueUtilization(), now)
+
+		case <-diskBufferSyncc:
+			if err := e.diskBuffer.sync(); err != nil {
+				level.Error(e.logger).Log("msg", "syncing disk buffer failed", "err", err)
+			}
+
 		case <-timer.C:
+			// Pick up samples from the disk buffer if no new samples triggered a send.
+			if e.diskBuffer != nil && !e.diskBufferEmpty() {
+				e.triggerNext()
+			}
 			// Flush batch that has been pending for too long.
-			if !curBatch.empty() {
-				send()
+			if !curBatch.empty() && !e.Paused() {
+				send("delay")
 			} else {
-				timer.Reset(batchDelayMax)
+				timer.Reset(e.opts.Efficiency.BatchDelay)
 			}
 		}
 	}
@@ -849,13 +1914,49 @@ func (e *Exporter) withUntypedDefaultMetadata(f MetadataFunc) MetadataFunc {
 type batch struct {
 	logger  log.Logger
 	maxSize uint
-
-	m       map[string][]*monitoring_pb.TimeSeries
+	// Credentials files by namespace. Samples of these namespaces are sent in
+	// separate requests made with the respective credentials.
+	credentials map[string]string
+	// Optional writer that the samples are additionally passed to when the batch is sent.
+	dualWriter *dualWriter
+	// Optional log that failed requests are recorded in.
+	errors *errorLog
+	// Optional counts of rejected samples by target.
+	rejections *targetRejections
+	// Optional log of the series of rejected requests.
+	deadLetters *deadLetterLog
+	// Optional local TSDB that the samples are additionally written to when the batch
+	// is sent.
+	tsdbSink *tsdbSink
+	// Optional log of a sample of the points of failed requests.
+	drops *dropLog
+
+	m       map[batchKey][]*monitoring_pb.TimeSeries
 	shards  []*shard
 	oneFull bool
 	total   int
 }
 
+// batchKey identifies the samples of a batch that are sent in the same request.
+type batchKey struct {
+	project string
+	// Optional credentials file the request is made with.
+	credentials string
+}
+
+// newBatch returns a new batch for the current shards.
+func (e *Exporter) newBatch() *batch {
+	b := newBatch(e.logger, uint(len(e.shards)), e.opts.Efficiency.BatchSize)
+	b.credentials = e.opts.NamespaceCredentials.Files
+	b.dualWriter = e.dualWriter
+	b.errors = e.sendErrors
+	b.rejections = e.rejections
+	b.deadLetters = e.deadLetters
+	b.tsdbSink = e.tsdbSink
+	b.drops = e.drops
+	return b
+}
+
 func newBatch(logger log.Logger, shardsCount uint, maxSize uint) *batch {
 	if logger == nil {
 		logger = log.NewNopLogger()
@@ -863,7 +1964,7 @@ func newBatch(logger log.Logger, shardsCount uint, maxSize uint) *batch {
 	return &batch{
 		logger:  logger,
 		maxSize: maxSize,
-		m:       make(map[string][]*monitoring_pb.TimeSeries, 1),
+		m:       make(map[batchKey][]*monitoring_pb.TimeSeries, 1),
 		shards:  make([]*shard, 0, shardsCount/2),
 	}
 }
@@ -874,14 +1975,16 @@ func (b *batch) addShard(s *shard) {
 
 // add a new sample to the batch. Must only be called after full() returned false.
 func (b *batch) add(s *monitoring_pb.TimeSeries) {
-	pid := s.Resource.Labels[KeyProjectID]
-
-	l, ok := b.m[pid]
+	key := batchKey{
+		project:     s.Resource.Labels[KeyProjectID],
+		credentials: b.credentials[s.Resource.Labels[KeyNamespace]],
+	}
+	l, ok := b.m[key]
 	if !ok {
 		l = make([]*monitoring_pb.TimeSeries, 0, b.maxSize)
 	}
 	l = append(l, s)
-	b.m[pid] = l
+	b.m[key] = l
 
 	if len(l) == cap(l) {
 		b.oneFull = true
@@ -916,39 +2019,152 @@ func (b batch) send(
 	sendCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
+	start := time.Now()
+
 	projectsPerBatch.Observe(float64(len(b.m)))
+
+	for _, l := range b.m {
+		packByResource(l)
+	}
+
+	if b.dualWriter != nil || b.tsdbSink != nil {
+		requests := make([][]*monitoring_pb.TimeSeries, 0, len(b.m))
+		for _, l := range b.m {
+			requests = append(requests, l)
+		}
+		if b.dualWriter != nil {
+			b.dualWriter.add(requests)
+		}
+		if b.tsdbSink != nil {
+			b.tsdbSink.add(requests)
+		}
+	}
 	var wg sync.WaitGroup
 
-	for pid, l := range b.m {
+	for key, l := range b.m {
 		wg.Add(1)
 
-		go func(pid string, l []*monitoring_pb.TimeSeries) {
+		go func(key batchKey, l []*monitoring_pb.TimeSeries) {
 			defer wg.Done()
 
 			pendingRequests.Inc()
 			defer pendingRequests.Dec()
 
 			samplesPerRPCBatch.Observe(float64(len(l)))
+			batchFillRatio.Observe(float64(len(l)) / float64(b.maxSize))
 
-			// We do not retry any requests due to the risk of producing a backlog
+			// Retries are disabled by default due to the risk of producing a backlog
 			// that cannot be worked down, especially if large amounts of clients try to do so.
-			err := sendOne(sendCtx, &monitoring_pb.CreateTimeSeriesRequest{
-				Name:       fmt.Sprintf("projects/%s", pid),
+			reqCtx := sendCtx
+			if key.credentials != "" {
+				reqCtx = withCredentialsFile(sendCtx, key.credentials)
+			}
+			reqStart := time.Now()
+			err := sendOne(reqCtx, &monitoring_pb.CreateTimeSeriesRequest{
+				Name:       fmt.Sprintf("projects/%s", key.project),
 				TimeSeries: l,
 			})
-			if err != nil {
-				level.Error(b.logger).Log("msg", "send batch", "size", len(l), "err", err)
+			if errors.Is(err, errThrottled) {
+				samplesDropped.WithLabelValues("throttled").Add(float64(len(l)))
+				b.drops.timeSeries("throttled", l[0], len(l))
+				level.Debug(b.logger).Log("msg", "send batch throttled", "size", len(l))
+			} else if err != nil {
+				sendDuration.WithLabelValues("error").Observe(time.Since(reqStart).Seconds())
+				reason := sendDropReason(err)
+				samplesDropped.WithLabelValues(reason).Add(float64(len(l)))
+				b.drops.timeSeries(reason, l[0], len(l))
+				if b.rejections != nil {
+					b.rejections.add(l, reason, time.Now())
+				}
+				level.Error(b.logger).Log("msg", "send batch", "size", len(l), "class", errorClass(err), "err", err)
+				if b.errors != nil {
+					b.errors.record(key.project, err, time.Now())
+				}
+				if b.deadLetters != nil {
+					if err := b.deadLetters.add(key.project, l, reason, err, time.Now()); err != nil {
+						level.Warn(b.logger).Log("msg", "writing dead-letter log failed", "err", err)
+					}
+				}
+			} else {
+				sendDuration.WithLabelValues("success").Observe(time.Since(reqStart).Seconds())
 			}
 			samplesSent.Add(float64(len(l)))
-		}(pid, l)
+		}(key, l)
 	}
 	wg.Wait()
 
 	for _, s := range b.shards {
+		shardSendDuration.Observe(time.Since(start).Seconds())
 		s.notifyDone()
 	}
 }
 
+// packByResource reorders the series in place so that series of the same monitored
+// resource are adjacent, keeping resources in the order they were first added.
+// Cached series share their interned resource proto, which makes repeated resources
+// compress well and lets GCM process the series of a resource together.
+func packByResource(l []*monitoring_pb.TimeSeries) {
+	if len(l) < 3 {
+		return
+	}
+	// Index of each resource's group in order of first occurrence and the group of
+	// each series.
+	groups := make(map[*monitoredres_pb.MonitoredResource]int, len(l)/4)
+	seriesGroups := make([]int, len(l))
+	var offsets []int
+
+	for i, s := range l {
+		g, ok := groups[s.Resource]
+		if !ok {
+			g = len(offsets)
+			groups[s.Resource] = g
+			offsets = append(offsets, 0)
+		}
+		seriesGroups[i] = g
+		offsets[g]++
+	}
+	// Every series has its own resource and there is nothing to pack.
+	if len(offsets) == len(l) {
+		return
+	}
+	// Turn group sizes into the offsets at which each group starts.
+	next := 0
+	for g, n := range offsets {
+		offsets[g] = next
+		next += n
+	}
+	unpacked := append([]*monitoring_pb.TimeSeries(nil), l...)
+	for i, s := range unpacked {
+		g := seriesGroups[i]
+		l[offsets[g]] = s
+		offsets[g]++
+	}
+}
+
+// sendDropReason returns the reason for which the samples of a request that failed
+// with err were dropped, based on the error returned by the GCM API.
+// The error messages are not part of the API contract, so the reason is best effort.
+func sendDropReason(err error) string {
+	msg := strings.ToLower(status.Convert(err).Message())
+
+	switch status.Code(err) {
+	case codes.ResourceExhausted:
+		return "quota"
+	case codes.InvalidArgument, codes.FailedPrecondition:
+		switch {
+		case strings.Contains(msg, "time series") && strings.Contains(msg, "would cause"):
+			return "cardinality"
+		case strings.Contains(msg, "written in order"), strings.Contains(msg, "too far in the past"),
+			strings.Contains(msg, "older than"):
+			return "too-old"
+		case strings.Contains(msg, "label"):
+			return "invalid-labels"
+		}
+		return "invalid-request"
+	}
+	return "send-error"
+}
+
 // Matchers holds a list of metric selectors that can be set as a flag.
 type Matchers []labels.Selector
 
@@ -15,10 +15,12 @@
 package export
 
 import (
+	"compress/gzip"
 	"context"
 	"fmt"
 	"net"
 	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
@@ -33,10 +35,14 @@ import (
 	"github.com/prometheus/prometheus/storage"
 	"github.com/prometheus/prometheus/tsdb/record"
 	"google.golang.org/api/option"
+	metric_pb "google.golang.org/genproto/googleapis/api/metric"
 	monitoredres_pb "google.golang.org/genproto/googleapis/api/monitoredres"
 	monitoring_pb "google.golang.org/genproto/googleapis/monitoring/v3"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
 	empty_pb "google.golang.org/protobuf/types/known/emptypb"
 )
 
@@ -89,13 +95,13 @@ func TestBatchFillFromShardsAndSend(t *testing.T) {
 		shards = append(shards, newShard(10000))
 	}
 	for i := 0; i < 10000; i++ {
-		shards[i%100].enqueue(uint64(i), &monitoring_pb.TimeSeries{
+		shards[i%100].enqueue(queueEntry{hash: uint64(i), sample: &monitoring_pb.TimeSeries{
 			Resource: &monitoredres_pb.MonitoredResource{
 				Labels: map[string]string{
 					KeyProjectID: fmt.Sprintf("project-%d", i%100),
 				},
 			},
-		})
+		}})
 	}
 
 	b := newBatch(nil, DefaultShardCount, 101)
@@ -131,6 +137,152 @@ func TestBatchFillFromShardsAndSend(t *testing.T) {
 	}
 }
 
+func TestPackByResource(t *testing.T) {
+	r1 := &monitoredres_pb.MonitoredResource{Type: "r1"}
+	r2 := &monitoredres_pb.MonitoredResource{Type: "r2"}
+	r3 := &monitoredres_pb.MonitoredResource{Type: "r3"}
+
+	series := func(r *monitoredres_pb.MonitoredResource, metric string) *monitoring_pb.TimeSeries {
+		return &monitoring_pb.TimeSeries{Resource: r, Metric: &metric_pb.Metric{Type: metric}}
+	}
+	l := []*monitoring_pb.TimeSeries{
+		series(r1, "m1"), series(r2, "m1"), series(r1, "m2"), series(r3, "m1"), series(r2, "m2"), series(r1, "m3"),
+	}
+	packByResource(l)
+
+	var got []string
+	for _, s := range l {
+		got = append(got, s.Resource.Type+"/"+s.Metric.Type)
+	}
+	want := []string{"r1/m1", "r1/m2", "r1/m3", "r2/m1", "r2/m2", "r3/m1"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected order (-want, +got): %s", diff)
+	}
+}
+
+// benchmarkSeries returns n interned series spread across resources with perResource
+// series each. Consecutive series belong to different resources, as is the case for
+// samples taken from shards.
+func benchmarkSeries(n, perResource int) []*monitoring_pb.TimeSeries {
+	p := newPool(nil)
+	resources := n / perResource
+
+	result := make([]*monitoring_pb.TimeSeries, 0, n)
+	for i := 0; i < n; i++ {
+		r := i % resources
+		ts := &monitoring_pb.TimeSeries{
+			Resource: &monitoredres_pb.MonitoredResource{
+				Type: "prometheus_target",
+				Labels: map[string]string{
+					KeyProjectID: fmt.Sprintf("project-%d", r%10),
+					KeyLocation:  "europe-west1-b",
+					KeyCluster:   "cluster-1",
+					KeyNamespace: fmt.Sprintf("namespace-%d", r%50),
+					KeyJob:       "job-1",
+					KeyInstance:  fmt.Sprintf("instance-%d", r),
+				},
+			},
+			Metric: &metric_pb.Metric{
+				Type:   fmt.Sprintf("prometheus.googleapis.com/metric_%d/gauge", i/resources),
+				Labels: map[string]string{"label": "value"},
+			},
+			MetricKind: metric_pb.MetricDescriptor_GAUGE,
+			ValueType:  metric_pb.MetricDescriptor_DOUBLE,
+		}
+		p.intern(ts)
+		ts.Points = []*monitoring_pb.Point{{
+			Interval: &monitoring_pb.TimeInterval{EndTime: getTimestamp(1000)},
+			Value:    &monitoring_pb.TypedValue{Value: &monitoring_pb.TypedValue_DoubleValue{DoubleValue: float64(i)}},
+		}}
+		result = append(result, ts)
+	}
+	return result
+}
+
+// BenchmarkBatchSend measures assembling and serializing the requests for 1M active series.
+func BenchmarkBatchSend(b *testing.B) {
+	series := benchmarkSeries(1<<20, 100)
+
+	var (
+		mtx      sync.Mutex
+		requests int
+	)
+	sendOne := func(_ context.Context, req *monitoring_pb.CreateTimeSeriesRequest, _ ...gax.CallOption) error {
+		if _, err := proto.Marshal(req); err != nil {
+			return err
+		}
+		mtx.Lock()
+		requests++
+		mtx.Unlock()
+		return nil
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		batch := newBatch(nil, DefaultShardCount, BatchSizeMax)
+		for _, s := range series {
+			batch.add(s)
+			if batch.full() {
+				batch.send(context.Background(), sendOne)
+				batch = newBatch(nil, DefaultShardCount, BatchSizeMax)
+			}
+		}
+		batch.send(context.Background(), sendOne)
+	}
+	b.ReportMetric(float64(requests)/float64(b.N), "requests/op")
+}
+
+// BenchmarkPackByResource compares the compressed request size and CPU cost of
+// requests with and without packing their series by resource.
+func BenchmarkPackByResource(b *testing.B) {
+	// Few large targets, e.g. kube-state-metrics, result in many series per resource
+	// within a request.
+	series := benchmarkSeries(1<<20, 1<<15)
+
+	for _, packed := range []bool{false, true} {
+		b.Run(fmt.Sprintf("packed=%t", packed), func(b *testing.B) {
+			var (
+				w     = &countingWriter{}
+				gz    = gzip.NewWriter(w)
+				batch = make([]*monitoring_pb.TimeSeries, BatchSizeMax)
+			)
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				for j := 0; j < len(series); j += BatchSizeMax {
+					n := copy(batch, series[j:])
+					if packed {
+						packByResource(batch[:n])
+					}
+					data, err := proto.Marshal(&monitoring_pb.CreateTimeSeriesRequest{TimeSeries: batch[:n]})
+					if err != nil {
+						b.Fatal(err)
+					}
+					gz.Reset(w)
+					if _, err := gz.Write(data); err != nil {
+						b.Fatal(err)
+					}
+					if err := gz.Close(); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+			b.ReportMetric(float64(w.n)/float64(b.N*len(series)), "compressed-bytes/series")
+		})
+	}
+}
+
+type countingWriter struct {
+	n int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += len(p)
+	return len(p), nil
+}
+
 func TestSampleInRange(t *testing.T) {
 	cases := []struct {
 		interval   monitoring_pb.TimeInterval
@@ -204,6 +356,61 @@ func TestSampleInRange(t *testing.T) {
 	}
 }
 
+func TestSendDropReason(t *testing.T) {
+	cases := []struct {
+		err  error
+		want string
+	}{
+		{
+			err:  status.Error(codes.ResourceExhausted, "Quota exceeded for quota metric 'Time series ingestion requests'"),
+			want: "quota",
+		}, {
+			err:  status.Error(codes.InvalidArgument, "One or more TimeSeries could not be written: Points must be written in order."),
+			want: "too-old",
+		}, {
+			err:  status.Error(codes.InvalidArgument, "One or more TimeSeries could not be written: The new labels would cause the metric to have over 1000000 active time series."),
+			want: "cardinality",
+		}, {
+			err:  status.Error(codes.InvalidArgument, "Field timeSeries[0].metric.labels[1] had an invalid value."),
+			want: "invalid-labels",
+		}, {
+			err:  status.Error(codes.InvalidArgument, "Field timeSeries[0].points had an invalid value."),
+			want: "invalid-request",
+		}, {
+			err:  status.Error(codes.Unavailable, "unavailable"),
+			want: "send-error",
+		}, {
+			err:  context.DeadlineExceeded,
+			want: "send-error",
+		},
+	}
+	for _, c := range cases {
+		if got := sendDropReason(c.err); got != c.want {
+			t.Errorf("unexpected drop reason for %q: want %q, got %q", c.err, c.want, got)
+		}
+	}
+}
+
+func TestReadMatchersFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "matchers")
+	if err := os.WriteFile(filename, []byte("# Allowed series.\n{job=\"job1\"}\n\n  up  \n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	matchers, err := readMatchersFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := `[[job="job1"] [__name__="up"]]`, matchers.String(); got != want {
+		t.Errorf("expected matchers %s, got %s", want, got)
+	}
+	if err := os.WriteFile(filename, []byte("{job="), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readMatchersFile(filename); err == nil {
+		t.Error("expected error for invalid matcher")
+	}
+}
+
 func TestExporter_wrapMetadata(t *testing.T) {
 	cases := []struct {
 		desc   string
@@ -324,6 +531,45 @@ func TestExporter_wrapMetadata(t *testing.T) {
 	}
 }
 
+func TestExporter_filterExemplars(t *testing.T) {
+	exemplars := map[storage.SeriesRef]record.RefExemplar{
+		1: {Ref: 1, T: 1000, V: 1, Labels: labels.FromStrings("trace_id", "abc")},
+	}
+	for _, disable := range []bool{false, true} {
+		e, err := New(log.NewJSONLogger(log.NewSyncWriter(os.Stderr)), nil, ExporterOpts{DisableAuth: true, DisableExemplars: disable})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := e.filterExemplars(exemplars)
+		if disable && got != nil {
+			t.Errorf("expected exemplars to be dropped, got %v", got)
+		}
+		if !disable && len(got) != len(exemplars) {
+			t.Errorf("expected exemplars to be kept, got %v", got)
+		}
+	}
+}
+
+func TestNew_efficiencyBounds(t *testing.T) {
+	for _, eff := range []EfficiencyOpts{
+		{BatchSize: BatchSizeMax + 1},
+		{ShardBufferSize: ShardBufferSizeMax + 1},
+		{BatchDelay: time.Microsecond},
+		{BatchDelay: time.Minute},
+	} {
+		if _, err := New(nil, nil, ExporterOpts{DisableAuth: true, Efficiency: eff}); err == nil {
+			t.Errorf("expected error for %+v", eff)
+		}
+	}
+	e, err := New(nil, nil, ExporterOpts{DisableAuth: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.opts.Efficiency.BatchDelay != DefaultBatchDelay {
+		t.Errorf("expected default batch delay %s, got %s", DefaultBatchDelay, e.opts.Efficiency.BatchDelay)
+	}
+}
+
 type testMetricService struct {
 	monitoring_pb.MetricServiceServer // Inherit all interface methods
 	samples                           []*monitoring_pb.TimeSeries
@@ -377,14 +623,114 @@ func TestExporter_drainBacklog(t *testing.T) {
 		}, nil)
 	}
 
+	if e.Idle() {
+		t.Fatalf("unexpected idle exporter with queued samples")
+	}
+
 	go e.Run(ctx)
 	// As our samples are all for the same series, each batch can only contain a single sample.
 	// The exporter waits for the batch delay duration before sending it.
 	// We sleep for an appropriate multiple of it to allow it to drain the shard.
-	time.Sleep(55 * batchDelayMax)
+	time.Sleep(55 * DefaultBatchDelay)
 
 	// Check that we received all samples that went in.
 	if got, want := len(metricServer.samples), 50; got != want {
 		t.Fatalf("got %d, want %d", got, want)
 	}
+	if !e.Idle() {
+		t.Errorf("expected exporter to be idle after sending all samples")
+	}
+}
+
+func TestExporter_diskBuffer(t *testing.T) {
+	e, err := New(nil, nil, ExporterOpts{
+		DisableAuth: true,
+		Efficiency:  EfficiencyOpts{ShardCount: 1, ShardBufferSize: 2},
+		DiskBuffer:  DiskBufferOpts{Dir: t.TempDir()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.diskBuffer.close()
+
+	shard := e.shards[0]
+	for i := 0; i < 5; i++ {
+		e.enqueue(queueEntry{hash: 1, sample: diskBufferSample(int64(i))})
+	}
+	// Samples that do not fit into the shard are written to disk.
+	if got := shard.queue.length(); got != 2 {
+		t.Fatalf("expected 2 samples in shard, got %d", got)
+	}
+	if got := e.diskBuffer.unread; got != 3 {
+		t.Fatalf("expected 3 samples on disk, got %d", got)
+	}
+	// Samples are refilled from disk in order once the shard has capacity.
+	var values []int64
+	for len(values) < 5 {
+		entries := shard.drain()
+		if len(entries) == 0 {
+			t.Fatalf("expected samples in shard, got %v so far", values)
+		}
+		for _, qe := range entries {
+			values = append(values, qe.sample.Points[0].Value.GetInt64Value())
+		}
+		e.refillShards()
+	}
+	if diff := cmp.Diff([]int64{0, 1, 2, 3, 4}, values); diff != "" {
+		t.Errorf("unexpected values (-want, +got): %s", diff)
+	}
+	// New samples bypass the disk buffer once it is empty.
+	e.enqueue(queueEntry{hash: 1, sample: diskBufferSample(5)})
+	if got := shard.queue.length(); got != 1 || !e.diskBuffer.empty() {
+		t.Errorf("expected sample to be added to the shard directly")
+	}
+}
+
+func TestExporter_diskBufferRefillFullShard(t *testing.T) {
+	e, err := New(nil, nil, ExporterOpts{
+		DisableAuth: true,
+		Efficiency:  EfficiencyOpts{ShardCount: 2, ShardBufferSize: 1},
+		DiskBuffer:  DiskBufferOpts{Dir: t.TempDir()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.diskBuffer.close()
+
+	// Fill the first shard and buffer two more samples for each shard.
+	e.enqueue(queueEntry{hash: 0, sample: diskBufferSample(0)})
+	for i := 1; i <= 4; i++ {
+		if err := e.diskBuffer.add(uint64(i%2), diskBufferSample(int64(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	values := func(s *shard) (res []int64) {
+		for _, qe := range s.drain() {
+			res = append(res, qe.sample.Points[0].Value.GetInt64Value())
+		}
+		return res
+	}
+	// The full first shard does not block refilling the second one.
+	e.refillShards()
+	if diff := cmp.Diff([]int64{0}, values(e.shards[0])); diff != "" {
+		t.Errorf("unexpected values of first shard (-want, +got): %s", diff)
+	}
+	if diff := cmp.Diff([]int64{1}, values(e.shards[1])); diff != "" {
+		t.Errorf("unexpected values of second shard (-want, +got): %s", diff)
+	}
+	// Held back samples are refilled in order.
+	e.refillShards()
+	if diff := cmp.Diff([]int64{2}, values(e.shards[0])); diff != "" {
+		t.Errorf("unexpected values of first shard (-want, +got): %s", diff)
+	}
+	if diff := cmp.Diff([]int64{3}, values(e.shards[1])); diff != "" {
+		t.Errorf("unexpected values of second shard (-want, +got): %s", diff)
+	}
+	e.refillShards()
+	if diff := cmp.Diff([]int64{4}, values(e.shards[0])); diff != "" {
+		t.Errorf("unexpected values of first shard (-want, +got): %s", diff)
+	}
+	if !e.diskBufferEmpty() {
+		t.Errorf("expected disk buffer to be empty")
+	}
 }
@@ -82,12 +82,15 @@ func (a *AltTokenSource) token() (*oauth2.Token, error) {
 
 // NewAltTokenSource constructs a new alternate token source for generating tokens.
 func NewAltTokenSource(tokenURL, tokenBody string) oauth2.TokenSource {
+	return oauth2.ReuseTokenSource( /* token */ nil, newAltTokenSource(tokenURL, tokenBody))
+}
+
+func newAltTokenSource(tokenURL, tokenBody string) *AltTokenSource {
 	client := oauth2.NewClient(context.Background(), google.ComputeTokenSource(""))
-	a := &AltTokenSource{
+	return &AltTokenSource{
 		oauthClient: client,
 		tokenURL:    tokenURL,
 		tokenBody:   tokenBody,
 		throttle:    rate.NewLimiter(tokenURLQPS, tokenURLBurst),
 	}
-	return oauth2.ReuseTokenSource( /* token */ nil, a)
 }
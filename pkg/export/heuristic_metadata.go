@@ -0,0 +1,133 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"fmt"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/textparse"
+)
+
+// Supported modes for determining the type of exported series.
+const (
+	// The type is looked up in the metadata exposed by the scraped targets.
+	MetadataModeScrape = "scrape"
+	// The type is derived from the metric name and labels of the series without any
+	// metadata lookups, which saves memory and CPU where metadata fidelity matters
+	// less, e.g. in edge deployments. Help texts and units are not written.
+	MetadataModeHeuristic = "heuristic"
+)
+
+// MetadataOpts represents exporter options for determining the type of exported series.
+type MetadataOpts struct {
+	// Mode is MetadataModeScrape or MetadataModeHeuristic.
+	// Defaults to MetadataModeScrape when empty.
+	Mode string
+	// Types overrides the derived type by metric name in MetadataModeHeuristic. For
+	// histograms and summaries the name is given without suffix.
+	Types map[string]textparse.MetricType
+}
+
+func (o *MetadataOpts) validate() error {
+	switch o.Mode {
+	case "":
+		o.Mode = MetadataModeScrape
+	case MetadataModeScrape, MetadataModeHeuristic:
+	default:
+		return fmt.Errorf("unknown metadata mode %q", o.Mode)
+	}
+	for metric, typ := range o.Types {
+		switch typ {
+		case textparse.MetricTypeCounter, textparse.MetricTypeGauge, textparse.MetricTypeHistogram,
+			textparse.MetricTypeGaugeHistogram, textparse.MetricTypeSummary, textparse.MetricTypeUnknown:
+		default:
+			return fmt.Errorf("unknown type %q for metric %q", typ, metric)
+		}
+	}
+	return nil
+}
+
+// heuristicMetadata derives the metadata, base metric name, and metric name suffix of
+// the series from its metric name and labels. The type is determined as follows:
+//
+//   - The type set for the metric name or its name without suffix in the options.
+//   - Counter for names with the _total suffix.
+//   - Histogram for _bucket series with an le label and their _sum and _count series,
+//     which are exposed after the buckets.
+//   - Summary for series with a quantile label and other _sum and _count series.
+//   - The type of the metric for _created series of counters, histograms, and
+//     summaries, which are exposed after the other series of their metric.
+//   - Gauge otherwise.
+//
+// Must be called with mtx held.
+func (c *seriesCache) heuristicMetadata(lset labels.Labels) (MetricMetadata, string, metricSuffix) {
+	name := lset.Get(labels.MetricName)
+	if t, ok := c.metadata.Types[name]; ok {
+		return MetricMetadata{Metric: name, Type: t}, name, metricSuffixNone
+	}
+	gauge := MetricMetadata{Metric: name, Type: textparse.MetricTypeGauge}
+
+	base, suffix, ok := splitMetricSuffix(name)
+	if !ok {
+		if lset.Has(model.QuantileLabel) {
+			return MetricMetadata{Metric: name, Type: textparse.MetricTypeSummary}, name, metricSuffixNone
+		}
+		return gauge, name, metricSuffixNone
+	}
+	if t, ok := c.metadata.Types[base]; ok {
+		return MetricMetadata{Metric: base, Type: t}, base, suffix
+	}
+	withType := func(t textparse.MetricType) (MetricMetadata, string, metricSuffix) {
+		return MetricMetadata{Metric: base, Type: t}, base, suffix
+	}
+	switch suffix {
+	case metricSuffixTotal:
+		return MetricMetadata{Metric: name, Type: textparse.MetricTypeCounter}, name, metricSuffixNone
+
+	case metricSuffixBucket:
+		if lset.Has(labels.BucketLabel) {
+			return withType(textparse.MetricTypeHistogram)
+		}
+
+	case metricSuffixSum, metricSuffixCount:
+		if c.establishedType(base) == textparse.MetricTypeHistogram {
+			return withType(textparse.MetricTypeHistogram)
+		}
+		return withType(textparse.MetricTypeSummary)
+
+	case metricSuffixCreated:
+		// Gauges with the _created suffix are common, e.g. for the creation time of
+		// objects, and are only considered created series of known metrics.
+		switch t := c.establishedType(base); t {
+		case textparse.MetricTypeHistogram, textparse.MetricTypeSummary:
+			return withType(t)
+		}
+		if c.establishedType(base+string(metricSuffixTotal)) == textparse.MetricTypeCounter {
+			return withType(textparse.MetricTypeCounter)
+		}
+	}
+	return gauge, name, metricSuffixNone
+}
+
+// establishedType returns the type of the active series of the metric or an empty type
+// if it has none. Must be called with mtx held.
+func (c *seriesCache) establishedType(metric string) textparse.MetricType {
+	if mt, ok := c.metricTypes[metric]; ok {
+		return mt.established
+	}
+	return ""
+}
@@ -0,0 +1,102 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"testing"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/textparse"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/prometheus/prometheus/tsdb/record"
+)
+
+func TestSeriesCache_heuristicMetadata(t *testing.T) {
+	opts := MetadataOpts{
+		Mode: MetadataModeHeuristic,
+		Types: map[string]textparse.MetricType{
+			"metric5": textparse.MetricTypeCounter,
+			"metric6": textparse.MetricTypeGaugeHistogram,
+		},
+	}
+	if err := opts.validate(); err != nil {
+		t.Fatal(err)
+	}
+	cache := newSeriesCache(nil, nil, MetricTypePrefix, nil)
+	cache.metadata = opts
+
+	// Series are populated in the order in which targets expose them.
+	series := []struct {
+		lset labels.Labels
+		// Metric type the series is written as, none for _created series.
+		want string
+	}{
+		{lset: labels.FromStrings("__name__", "metric1_total"), want: "metric1_total/counter"},
+		{lset: labels.FromStrings("__name__", "metric1_created")},
+		{lset: labels.FromStrings("__name__", "metric2"), want: "metric2/gauge"},
+		{lset: labels.FromStrings("__name__", "metric3_bucket", "le", "1"), want: "metric3/histogram"},
+		{lset: labels.FromStrings("__name__", "metric3_sum"), want: "metric3/histogram"},
+		{lset: labels.FromStrings("__name__", "metric3_count"), want: "metric3/histogram"},
+		{lset: labels.FromStrings("__name__", "metric4", "quantile", "0.5"), want: "metric4/summary"},
+		{lset: labels.FromStrings("__name__", "metric4_sum"), want: "metric4_sum/summary:counter"},
+		{lset: labels.FromStrings("__name__", "metric4_count"), want: "metric4_count/summary"},
+		{lset: labels.FromStrings("__name__", "metric4_created")},
+		// Gauges with the _created suffix are not mistaken for created series.
+		{lset: labels.FromStrings("__name__", "object_created"), want: "object_created/gauge"},
+		{lset: labels.FromStrings("__name__", "other_bucket"), want: "other_bucket/gauge"},
+		// Types set in the options take precedence.
+		{lset: labels.FromStrings("__name__", "metric5"), want: "metric5/counter"},
+		{lset: labels.FromStrings("__name__", "metric6_bucket", "le", "1"), want: "metric6/gaugehistogram"},
+		{lset: labels.FromStrings("__name__", "metric6_gsum"), want: "metric6/gaugehistogram"},
+	}
+	cache.getLabelsByRef = func(ref storage.SeriesRef) labels.Labels {
+		return series[ref].lset
+	}
+	externalLabels := labels.FromStrings("project_id", "p1", "location", "l1")
+
+	for i, s := range series {
+		e, ok := cache.get(record.RefSample{Ref: chunks.HeadSeriesRef(i)}, externalLabels, nil)
+		if !ok {
+			t.Fatalf("no valid entry for series %s", s.lset)
+		}
+		if s.want == "" {
+			if e.suffix != metricSuffixCreated {
+				t.Errorf("expected created series for %s, got suffix %q", s.lset, e.suffix)
+			}
+			continue
+		}
+		var got string
+		if p := e.protos.cumulative.proto; p != nil {
+			got = p.Metric.Type
+		} else if p := e.protos.gauge.proto; p != nil {
+			got = p.Metric.Type
+		}
+		if want := MetricTypePrefix + "/" + s.want; got != want {
+			t.Errorf("expected metric type %q for %s, got %q", want, s.lset, got)
+		}
+	}
+}
+
+func TestMetadataOpts_validate(t *testing.T) {
+	opts := MetadataOpts{Types: map[string]textparse.MetricType{"metric1": "count"}}
+	if err := opts.validate(); err == nil {
+		t.Error("expected error for unknown type")
+	}
+	opts = MetadataOpts{}
+	if err := opts.validate(); err != nil || opts.Mode != MetadataModeScrape {
+		t.Errorf("expected default mode %q, got %q and error %v", MetadataModeScrape, opts.Mode, err)
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var histogramsReduced = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "gcm_export_histograms_reduced_total",
+	Help: "Number of histogram samples whose buckets were merged to stay within the bucket limit.",
+})
+
+// Supported modes for exporting OpenMetrics gauge histograms.
+const (
+	// Gauge histograms are written as gauge distributions of the metric type with the
+	// "gaugehistogram" suffix. Their _gsum and _gcount series provide the sum and count.
+	GaugeHistogramModeDistribution = "distribution"
+	// Every series of a gauge histogram, including the buckets with their le label, is
+	// written as a separate gauge, which keeps them queryable by their Prometheus names.
+	GaugeHistogramModeGauge = "gauge"
+)
+
+// HistogramOpts represents exporter options for reducing the number of buckets of
+// histograms before they are written as distributions, which bounds the cost of
+// histograms with hundreds of buckets, and for how gauge histograms are written.
+type HistogramOpts struct {
+	// MaxBuckets is the maximum number of buckets of a histogram. Adjacent buckets of
+	// histograms with more buckets are merged. For classic histograms the +Inf bucket
+	// counts towards the limit, for native histograms the range of populated positive
+	// buckets does. Unlimited if 0.
+	MaxBuckets int
+	// MaxBucketsByMetric overrides MaxBuckets by the metric name of histograms, without
+	// the _bucket suffix. A value of 0 disables the limit for the metric.
+	MaxBucketsByMetric map[string]int
+	// GaugeMode determines how OpenMetrics gauge histograms are written.
+	// Defaults to GaugeHistogramModeDistribution.
+	GaugeMode string
+}
+
+func (o *HistogramOpts) validate() error {
+	switch o.GaugeMode {
+	case "":
+		o.GaugeMode = GaugeHistogramModeDistribution
+	case GaugeHistogramModeDistribution, GaugeHistogramModeGauge:
+	default:
+		return fmt.Errorf("unknown gauge histogram mode %q", o.GaugeMode)
+	}
+	if o.MaxBuckets < 0 || o.MaxBuckets == 1 {
+		return fmt.Errorf("histogram bucket limit must be 0 or at least 2, got %d", o.MaxBuckets)
+	}
+	for metric, n := range o.MaxBucketsByMetric {
+		if n < 0 || n == 1 {
+			return fmt.Errorf("histogram bucket limit for metric %q must be 0 or at least 2, got %d", metric, n)
+		}
+	}
+	return nil
+}
+
+// maxBuckets returns the bucket limit for histograms of the metric or 0 if unlimited.
+func (o *HistogramOpts) maxBuckets(metric string) int {
+	if n, ok := o.MaxBucketsByMetric[metric]; ok {
+		return n
+	}
+	return o.MaxBuckets
+}
+
+// reduceBuckets merges adjacent buckets of the sorted distribution so that at most n
+// buckets remain. As bucket values are cumulative, merging buckets only drops their
+// upper bounds. The kept bounds are spread evenly across the finite bounds, always
+// including the highest one and the +Inf bucket, so the same bounds are kept for every
+// sample of a histogram.
+func (d *distribution) reduceBuckets(n int) {
+	if n <= 0 || len(d.bounds) <= n {
+		return
+	}
+	finite := len(d.bounds) - 1
+	for k := 0; k < n-1; k++ {
+		// Index of the highest bucket merged into the k-th bucket.
+		i := ((k+1)*finite+n-2)/(n-1) - 1
+		d.bounds[k], d.values[k] = d.bounds[i], d.values[i]
+	}
+	d.bounds[n-1], d.values[n-1] = d.bounds[finite], d.values[finite]
+	d.bounds, d.values = d.bounds[:n], d.values[:n]
+
+	histogramsReduced.Inc()
+}
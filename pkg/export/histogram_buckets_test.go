@@ -0,0 +1,132 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"math"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/prometheus/model/histogram"
+	"github.com/prometheus/prometheus/model/labels"
+)
+
+func TestHistogramOpts(t *testing.T) {
+	opts := HistogramOpts{
+		MaxBuckets:         10,
+		MaxBucketsByMetric: map[string]int{"m1": 0, "m2": 5},
+	}
+	if err := opts.validate(); err != nil {
+		t.Fatal(err)
+	}
+	for metric, want := range map[string]int{"m1": 0, "m2": 5, "m3": 10} {
+		if got := opts.maxBuckets(metric); got != want {
+			t.Errorf("expected limit %d for %s, got %d", want, metric, got)
+		}
+	}
+	for _, opts := range []HistogramOpts{
+		{MaxBuckets: 1},
+		{MaxBuckets: -1},
+		{MaxBucketsByMetric: map[string]int{"m1": 1}},
+	} {
+		if err := opts.validate(); err == nil {
+			t.Errorf("expected error for %+v", opts)
+		}
+	}
+}
+
+func TestDistributionBuildMaxBuckets(t *testing.T) {
+	newDist := func() *distribution {
+		// Ten finite buckets with one observation each and the +Inf bucket.
+		d := &distribution{sum: 55, count: 11}
+		for i := 1; i <= 10; i++ {
+			d.bounds = append(d.bounds, float64(i))
+			d.values = append(d.values, int64(i))
+		}
+		d.bounds = append(d.bounds, math.Inf(1))
+		d.values = append(d.values, 11)
+		return d
+	}
+	cases := []struct {
+		maxBuckets    int
+		wantBounds    []float64
+		wantCounts    []int64
+		wantUnchanged bool
+	}{
+		{
+			maxBuckets:    0,
+			wantUnchanged: true,
+		}, {
+			maxBuckets:    11,
+			wantUnchanged: true,
+		}, {
+			maxBuckets: 4,
+			wantBounds: []float64{4, 7, 10},
+			wantCounts: []int64{4, 3, 3, 1},
+		}, {
+			maxBuckets: 2,
+			wantBounds: []float64{10},
+			wantCounts: []int64{10, 1},
+		},
+	}
+	for _, c := range cases {
+		dp, err := newDist().build(labels.EmptyLabels(), c.maxBuckets)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dp.Count != 11 {
+			t.Errorf("expected count 11, got %d", dp.Count)
+		}
+		bounds := dp.BucketOptions.GetExplicitBuckets().Bounds
+		if c.wantUnchanged {
+			if len(bounds) != 10 || len(dp.BucketCounts) != 11 {
+				t.Errorf("expected unchanged buckets with limit %d, got %v", c.maxBuckets, bounds)
+			}
+			continue
+		}
+		if diff := cmp.Diff(c.wantBounds, bounds); diff != "" {
+			t.Errorf("unexpected bounds with limit %d (-want, +got): %s", c.maxBuckets, diff)
+		}
+		if diff := cmp.Diff(c.wantCounts, dp.BucketCounts); diff != "" {
+			t.Errorf("unexpected bucket counts with limit %d (-want, +got): %s", c.maxBuckets, diff)
+		}
+	}
+}
+
+func TestBuildNativeDistributionMaxBuckets(t *testing.T) {
+	h := &histogram.FloatHistogram{
+		Schema:          0,
+		Count:           8,
+		Sum:             100,
+		PositiveSpans:   []histogram.Span{{Offset: 1, Length: 8}},
+		PositiveBuckets: []float64{1, 1, 1, 1, 1, 1, 1, 1},
+	}
+	dp, err := buildNativeDistribution(h, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Four buckets cannot cover the required range at any resolution, so the
+	// histogram is reduced to the lowest one, which merges all eight buckets.
+	exp := dp.BucketOptions.GetExponentialBuckets()
+	if got := len(dp.BucketCounts) - 2; got != 4 {
+		t.Errorf("expected 4 finite buckets, got %d", got)
+	}
+	if exp.GrowthFactor != 65536 {
+		t.Errorf("unexpected growth factor %v", exp.GrowthFactor)
+	}
+	if dp.Count != 8 {
+		t.Errorf("expected count 8, got %d", dp.Count)
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"golang.org/x/time/rate"
+)
+
+var labelViolations = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "gcm_export_label_violations_total",
+	Help: "Number of series with metric labels that are not compatible with GCM by the violation and whether the labels were mutated or only reported.",
+}, []string{"violation", "action"})
+
+// Policies for metric labels that are not compatible with GCM.
+const (
+	// Incompatible labels are written as is and reported. GCM may reject the series.
+	LabelPolicyPermissive = "permissive"
+	// Incompatible labels are sanitized, truncated, or dropped before the series is
+	// written and reported.
+	LabelPolicyStrict = "strict"
+)
+
+const (
+	// Limits of GCM for metric label names and values in bytes.
+	maxLabelNameLength  = 100
+	maxLabelValueLength = 1024
+
+	// Minimum interval between logged series with incompatible labels.
+	labelViolationLogInterval = time.Minute
+)
+
+// Violations of the GCM requirements for metric labels.
+const (
+	labelViolationInvalidName   = "invalid-name"
+	labelViolationNameTooLong   = "name-too-long"
+	labelViolationValueTooLong  = "value-too-long"
+	labelViolationInvalidUTF8   = "invalid-utf8"
+	labelViolationDuplicateName = "duplicate-name"
+)
+
+// LabelSanitizationOpts represents exporter options for handling metric labels that
+// are not compatible with GCM.
+type LabelSanitizationOpts struct {
+	// Policy for incompatible labels. Defaults to LabelPolicyPermissive when empty.
+	Policy string
+	// LogSamples enables logging the labels of a series with incompatible labels at
+	// most once per minute, to help find the producers that need fixing.
+	LogSamples bool
+}
+
+func (o *LabelSanitizationOpts) validate() error {
+	switch o.Policy {
+	case "":
+		o.Policy = LabelPolicyPermissive
+	case LabelPolicyPermissive, LabelPolicyStrict:
+	default:
+		return fmt.Errorf("invalid label policy %q, must be one of %q or %q", o.Policy, LabelPolicyPermissive, LabelPolicyStrict)
+	}
+	return nil
+}
+
+// labelSanitizer checks metric labels against the GCM requirements and sanitizes them
+// according to its policy.
+type labelSanitizer struct {
+	logger log.Logger
+	strict bool
+	// Limits logged series. Nil if logging is disabled.
+	limiter *rate.Limiter
+}
+
+func newLabelSanitizer(logger log.Logger, opts LabelSanitizationOpts) *labelSanitizer {
+	s := &labelSanitizer{
+		logger: logger,
+		strict: opts.Policy == LabelPolicyStrict,
+	}
+	if opts.LogSamples {
+		s.limiter = rate.NewLimiter(rate.Every(labelViolationLogInterval), 1)
+	}
+	return s
+}
+
+// sanitize returns the metric labels of the series with the given metric name. In strict
+// mode, invalid characters in label names are replaced with underscores, invalid UTF-8 in
+// values is replaced, and too long names and values are truncated. Labels whose sanitized
+// name is already taken are dropped. The input labels are not modified.
+func (s *labelSanitizer) sanitize(metric string, lset labels.Labels) labels.Labels {
+	var violations []string
+
+	for _, l := range lset {
+		_, _, vs := sanitizeLabel(l)
+		violations = append(violations, vs...)
+	}
+	if len(violations) == 0 {
+		return lset
+	}
+	result := lset
+	action := "reported"
+
+	if s.strict {
+		action = "mutated"
+		result = make(labels.Labels, 0, len(lset))
+		seen := make(map[string]struct{}, len(lset))
+
+		for _, l := range lset {
+			name, value, _ := sanitizeLabel(l)
+			if _, ok := seen[name]; ok {
+				violations = append(violations, labelViolationDuplicateName)
+				continue
+			}
+			seen[name] = struct{}{}
+			result = append(result, labels.Label{Name: name, Value: value})
+		}
+		sort.Sort(result)
+	}
+	for _, v := range violations {
+		labelViolations.WithLabelValues(v, action).Inc()
+	}
+	if s.limiter != nil && s.limiter.Allow() {
+		level.Warn(s.logger).Log("msg", "series has metric labels that are not compatible with GCM",
+			"metric", metric, "labels", lset, "violations", strings.Join(violations, ","), "action", action)
+	}
+	return result
+}
+
+// sanitizeLabel returns the label name and value made compatible with GCM and the
+// violations of the original label.
+func sanitizeLabel(l labels.Label) (name, value string, violations []string) {
+	name, value = l.Name, l.Value
+
+	if !model.LabelName(name).IsValid() {
+		violations = append(violations, labelViolationInvalidName)
+		name = sanitizeLabelName(name)
+	}
+	if len(name) > maxLabelNameLength {
+		violations = append(violations, labelViolationNameTooLong)
+		name = name[:maxLabelNameLength]
+	}
+	if !utf8.ValidString(value) {
+		violations = append(violations, labelViolationInvalidUTF8)
+		value = strings.ToValidUTF8(value, string(utf8.RuneError))
+	}
+	if len(value) > maxLabelValueLength {
+		violations = append(violations, labelViolationValueTooLong)
+		value = truncateUTF8(value, maxLabelValueLength)
+	}
+	return name, value, violations
+}
+
+// sanitizeLabelName replaces all characters that are not valid in a label name with
+// underscores and prefixes names starting with a digit with an underscore.
+func sanitizeLabelName(name string) string {
+	if name == "" {
+		return "_"
+	}
+	b := []byte(name)
+	for i, c := range b {
+		if !(c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')) {
+			b[i] = '_'
+		}
+	}
+	if b[0] >= '0' && b[0] <= '9' {
+		return "_" + string(b)
+	}
+	return string(b)
+}
+
+// truncateUTF8 truncates s to at most n bytes without splitting a multi-byte character.
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,84 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/prometheus/model/labels"
+)
+
+func TestLabelSanitizer(t *testing.T) {
+	longName := strings.Repeat("a", maxLabelNameLength+10)
+	longValue := strings.Repeat("ü", maxLabelValueLength)
+
+	cases := []struct {
+		doc        string
+		lset       labels.Labels
+		wantStrict labels.Labels
+	}{
+		{
+			doc:        "valid labels",
+			lset:       labels.FromStrings("a", "1", "b", "2"),
+			wantStrict: labels.FromStrings("a", "1", "b", "2"),
+		}, {
+			doc:        "invalid name",
+			lset:       labels.Labels{{Name: "0a.b", Value: "1"}, {Name: "c", Value: "2"}},
+			wantStrict: labels.FromStrings("_0a_b", "1", "c", "2"),
+		}, {
+			doc:        "too long name and value",
+			lset:       labels.Labels{{Name: longName, Value: longValue}},
+			wantStrict: labels.FromStrings(longName[:maxLabelNameLength], longValue[:maxLabelValueLength]),
+		}, {
+			doc:        "invalid utf-8",
+			lset:       labels.FromStrings("a", "x\xffy"),
+			wantStrict: labels.FromStrings("a", "x�y"),
+		}, {
+			doc:        "duplicate name after sanitization",
+			lset:       labels.Labels{{Name: "a-b", Value: "1"}, {Name: "a_b", Value: "2"}},
+			wantStrict: labels.FromStrings("a_b", "1"),
+		},
+	}
+	permissive := newLabelSanitizer(log.NewNopLogger(), LabelSanitizationOpts{Policy: LabelPolicyPermissive})
+	strict := newLabelSanitizer(log.NewNopLogger(), LabelSanitizationOpts{Policy: LabelPolicyStrict, LogSamples: true})
+
+	for _, c := range cases {
+		t.Run(c.doc, func(t *testing.T) {
+			input := append(labels.Labels{}, c.lset...)
+
+			if diff := cmp.Diff(c.lset, permissive.sanitize("metric1", input)); diff != "" {
+				t.Errorf("unexpected permissive labels (-want, +got): %s", diff)
+			}
+			if diff := cmp.Diff(c.wantStrict, strict.sanitize("metric1", input)); diff != "" {
+				t.Errorf("unexpected strict labels (-want, +got): %s", diff)
+			}
+			if diff := cmp.Diff(c.lset, input); diff != "" {
+				t.Errorf("input labels were modified (-want, +got): %s", diff)
+			}
+		})
+	}
+}
+
+func TestTruncateUTF8(t *testing.T) {
+	if got := truncateUTF8("aüb", 2); got != "a" {
+		t.Errorf("expected multi-byte character to be dropped, got %q", got)
+	}
+	if got := truncateUTF8("aüb", 3); got != "aü" {
+		t.Errorf("expected %q, got %q", "aü", got)
+	}
+}
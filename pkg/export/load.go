@@ -0,0 +1,327 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/textparse"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/prometheus/prometheus/tsdb/record"
+)
+
+const (
+	// DefaultLoadSeries is the default number of active synthetic series.
+	DefaultLoadSeries = 100000
+	// DefaultLoadSeriesPerTarget is the default number of synthetic series per target.
+	DefaultLoadSeriesPerTarget = 1000
+	// DefaultLoadMetrics is the default number of synthetic metric names.
+	DefaultLoadMetrics = 100
+	// DefaultLoadInterval is the default interval at which samples of all synthetic
+	// series are exported.
+	DefaultLoadInterval = 30 * time.Second
+	// DefaultLoadDuration is the default duration of a load run.
+	DefaultLoadDuration = 5 * time.Minute
+
+	// Interval at which the memory usage and export lag are sampled during a load run.
+	loadStatsInterval = time.Second
+)
+
+// LoadOpts configures synthetic load generated by RunLoad.
+type LoadOpts struct {
+	// Series is the number of active series. Defaults to DefaultLoadSeries when 0.
+	Series int
+	// SeriesPerTarget is the number of series of each synthetic target, which are
+	// exported together like the samples of a scrape.
+	// Defaults to DefaultLoadSeriesPerTarget when 0.
+	SeriesPerTarget int
+	// Metrics is the number of distinct metric names the series are spread over.
+	// Defaults to DefaultLoadMetrics when 0.
+	Metrics int
+	// Churn is the ratio of active series that are replaced by new series every
+	// interval, e.g. through pod restarts. Series are not replaced if 0.
+	Churn float64
+	// Interval is the interval at which a sample of every active series is
+	// exported. Defaults to DefaultLoadInterval when 0.
+	Interval time.Duration
+	// Duration is how long load is generated. Defaults to DefaultLoadDuration when 0.
+	Duration time.Duration
+}
+
+func (o *LoadOpts) validate() error {
+	if o.Series == 0 {
+		o.Series = DefaultLoadSeries
+	}
+	if o.SeriesPerTarget == 0 {
+		o.SeriesPerTarget = DefaultLoadSeriesPerTarget
+	}
+	if o.Metrics == 0 {
+		o.Metrics = DefaultLoadMetrics
+	}
+	if o.Interval == 0 {
+		o.Interval = DefaultLoadInterval
+	}
+	if o.Duration == 0 {
+		o.Duration = DefaultLoadDuration
+	}
+	if o.Series < 0 || o.SeriesPerTarget < 0 || o.Metrics < 0 {
+		return fmt.Errorf("series, series per target, and metrics must be positive, got %d, %d, and %d", o.Series, o.SeriesPerTarget, o.Metrics)
+	}
+	if o.Churn < 0 || o.Churn > 1 {
+		return fmt.Errorf("churn must be between 0 and 1, got %f", o.Churn)
+	}
+	if o.Interval < 0 || o.Duration < 0 {
+		return fmt.Errorf("interval and duration must be positive, got %s and %s", o.Interval, o.Duration)
+	}
+	return nil
+}
+
+// LoadResult summarizes a load run.
+type LoadResult struct {
+	// Duration of the run, including sending the samples that were queued when load
+	// generation ended.
+	Duration time.Duration
+	// Number of distinct series that were exported, including churned ones.
+	Series int
+	// Number of samples passed to the exporter, how many of them were in requests
+	// to GCM, including failed ones, and how many were dropped for any reason,
+	// including failed requests.
+	SamplesExported float64
+	SamplesSent     float64
+	SamplesDropped  float64
+	// Number of requests to GCM and how many of them failed.
+	Requests       float64
+	FailedRequests float64
+	// Mean duration of requests to GCM.
+	MeanRequestLatency time.Duration
+	// Maximum age of the oldest sample queued in the exporter, i.e. how far sending
+	// fell behind.
+	MaxExportLag time.Duration
+	// Maximum heap memory in use.
+	PeakHeapBytes uint64
+}
+
+// SamplesPerSecond returns the rate at which samples were sent to GCM.
+func (r LoadResult) SamplesPerSecond() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return r.SamplesSent / r.Duration.Seconds()
+}
+
+// loadGenerator derives the labels of synthetic series from their series refs. The
+// active series are a window of consecutive refs, which is shifted for churn.
+type loadGenerator struct {
+	opts LoadOpts
+	// First ref of the active series.
+	offset uint64
+}
+
+func (g *loadGenerator) labels(ref storage.SeriesRef) labels.Labels {
+	i := uint64(ref)
+	return labels.FromStrings(
+		labels.MetricName, "synthetic_metric_"+strconv.FormatUint(i%uint64(g.opts.Metrics), 10),
+		KeyNamespace, "synthetic",
+		KeyJob, "load",
+		KeyInstance, "target-"+strconv.FormatUint(i/uint64(g.opts.SeriesPerTarget), 10),
+		"series", strconv.FormatUint(i, 10),
+	)
+}
+
+func (g *loadGenerator) metadata(metric string) (MetricMetadata, bool) {
+	return MetricMetadata{Metric: metric, Type: textparse.MetricTypeGauge}, true
+}
+
+// export exports a sample of every active series in batches of the series of a target.
+func (g *loadGenerator) export(e *Exporter, t time.Time) {
+	var (
+		ts    = t.UnixMilli()
+		batch = make([]record.RefSample, 0, g.opts.SeriesPerTarget)
+	)
+	for i := 0; i < g.opts.Series; i++ {
+		batch = append(batch, record.RefSample{
+			Ref: chunks.HeadSeriesRef(g.offset + uint64(i)),
+			T:   ts,
+			V:   float64(ts % 1000),
+		})
+		if len(batch) == g.opts.SeriesPerTarget || i == g.opts.Series-1 {
+			e.Export(g.metadata, batch, nil)
+			batch = batch[:0]
+		}
+	}
+}
+
+// RunLoad generates synthetic series according to opts, exports them through e, and
+// reports how well the exporter kept up. It runs the exporter itself, which must
+// not have been run before, and blocks until the load duration has passed or ctx
+// is canceled, in which case the results cover the load generated until then.
+// The exporter's configuration must have been applied through ApplyConfig.
+// The results are derived from the exporter's metrics and do not account for other
+// exporters in the same process.
+func RunLoad(ctx context.Context, e *Exporter, opts LoadOpts) (*LoadResult, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	g := &loadGenerator{opts: opts}
+	e.SetLabelsByIDFunc(g.labels)
+
+	before := collectLoadMetrics()
+	start := time.Now()
+
+	runCtx, cancelRun := context.WithCancel(ctx)
+	defer cancelRun()
+	genCtx, cancelGen := context.WithTimeout(ctx, opts.Duration)
+	defer cancelGen()
+
+	runErr := make(chan error, 1)
+	go func() { runErr <- e.Run(runCtx) }()
+
+	var (
+		res      LoadResult
+		churned  uint64
+		interval = time.NewTicker(opts.Interval)
+		stats    = time.NewTicker(loadStatsInterval)
+		mem      runtime.MemStats
+	)
+	defer interval.Stop()
+	defer stats.Stop()
+
+	sampleStats := func() {
+		runtime.ReadMemStats(&mem)
+		if mem.HeapInuse > res.PeakHeapBytes {
+			res.PeakHeapBytes = mem.HeapInuse
+		}
+		lag := time.Duration(e.DebugStatus().OldestSampleAgeSeconds * float64(time.Second))
+		if lag > res.MaxExportLag {
+			res.MaxExportLag = lag
+		}
+	}
+	g.export(e, start)
+	for done := false; !done; {
+		select {
+		case <-genCtx.Done():
+			done = true
+		case t := <-interval.C:
+			if n := uint64(opts.Churn * float64(opts.Series)); n > 0 {
+				g.offset += n
+				churned += n
+			}
+			g.export(e, t)
+		case <-stats.C:
+			sampleStats()
+		}
+	}
+	// Sample once more at the end so that runs shorter than the stats interval are covered.
+	sampleStats()
+	// Give the exporter up to an interval to send the remaining queued samples, so
+	// that they are not counted as failed.
+	drainCtx, cancelDrain := context.WithTimeout(ctx, opts.Interval)
+	defer cancelDrain()
+	for !loadDrained(e) && drainCtx.Err() == nil {
+		select {
+		case <-drainCtx.Done():
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	cancelRun()
+
+	if err := <-runErr; err != nil && !errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, context.Canceled) {
+		return nil, fmt.Errorf("run exporter: %w", err)
+	}
+	after := collectLoadMetrics()
+
+	res.Duration = time.Since(start)
+	res.Series = opts.Series + int(churned)
+	res.SamplesExported = after.exported - before.exported
+	res.SamplesSent = after.sent - before.sent
+	res.SamplesDropped = after.dropped - before.dropped
+	res.Requests = after.requests - before.requests
+	res.FailedRequests = after.failedRequests - before.failedRequests
+	if res.Requests > 0 {
+		mean := (after.requestSeconds - before.requestSeconds) / res.Requests
+		res.MeanRequestLatency = time.Duration(mean * float64(time.Second))
+	}
+	return &res, nil
+}
+
+// loadDrained returns whether the exporter has no queued or pending samples.
+func loadDrained(e *Exporter) bool {
+	status := e.DebugStatus()
+	if status.QueuedSamples > 0 {
+		return false
+	}
+	for _, s := range status.Shards {
+		if s.Pending {
+			return false
+		}
+	}
+	return true
+}
+
+// loadMetrics are the values of the exporter metrics a load run is evaluated by.
+type loadMetrics struct {
+	exported, sent, dropped  float64
+	requests, failedRequests float64
+	requestSeconds           float64
+}
+
+func collectLoadMetrics() loadMetrics {
+	var m loadMetrics
+	forEachMetric(samplesExported, func(pb *dto.Metric) {
+		m.exported += pb.GetCounter().GetValue()
+	})
+	forEachMetric(samplesSent, func(pb *dto.Metric) {
+		m.sent += pb.GetCounter().GetValue()
+	})
+	forEachMetric(samplesDropped, func(pb *dto.Metric) {
+		m.dropped += pb.GetCounter().GetValue()
+	})
+	forEachMetric(sendDuration, func(pb *dto.Metric) {
+		h := pb.GetHistogram()
+		m.requests += float64(h.GetSampleCount())
+		m.requestSeconds += h.GetSampleSum()
+		for _, l := range pb.GetLabel() {
+			if l.GetName() == "result" && l.GetValue() == "error" {
+				m.failedRequests += float64(h.GetSampleCount())
+			}
+		}
+	})
+	return m
+}
+
+// forEachMetric calls f with every metric collected from c.
+func forEachMetric(c prometheus.Collector, f func(*dto.Metric)) {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		c.Collect(ch)
+		close(ch)
+	}()
+	for m := range ch {
+		var pb dto.Metric
+		if err := m.Write(&pb); err != nil {
+			continue
+		}
+		f(&pb)
+	}
+}
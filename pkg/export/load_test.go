@@ -0,0 +1,136 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	monitoring "cloud.google.com/go/monitoring/apiv3/v2"
+	"github.com/prometheus/prometheus/config"
+	"github.com/prometheus/prometheus/model/labels"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+	empty_pb "google.golang.org/protobuf/types/known/emptypb"
+
+	monitoring_pb "google.golang.org/genproto/googleapis/monitoring/v3"
+)
+
+type countingMetricService struct {
+	monitoring_pb.MetricServiceServer
+
+	mtx     sync.Mutex
+	samples int
+}
+
+func (srv *countingMetricService) CreateTimeSeries(ctx context.Context, req *monitoring_pb.CreateTimeSeriesRequest) (*empty_pb.Empty, error) {
+	srv.mtx.Lock()
+	srv.samples += len(req.TimeSeries)
+	srv.mtx.Unlock()
+	return &empty_pb.Empty{}, nil
+}
+
+func TestLoadGenerator_labels(t *testing.T) {
+	g := &loadGenerator{opts: LoadOpts{SeriesPerTarget: 10, Metrics: 3}}
+
+	want := labels.FromStrings(
+		"__name__", "synthetic_metric_1",
+		"namespace", "synthetic",
+		"job", "load",
+		"instance", "target-2",
+		"series", "25",
+	)
+	if got := g.labels(25); !labels.Equal(want, got) {
+		t.Errorf("expected labels %s, got %s", want, got)
+	}
+}
+
+func TestRunLoad(t *testing.T) {
+	var (
+		srv          = grpc.NewServer()
+		listener     = bufconn.Listen(1e6)
+		metricServer = &countingMetricService{}
+	)
+	monitoring_pb.RegisterMetricServiceServer(srv, metricServer)
+
+	go srv.Serve(listener)
+	defer srv.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	metricClient, err := monitoring.NewMetricClient(ctx,
+		option.WithoutAuthentication(),
+		option.WithGRPCDialOption(grpc.WithInsecure()),
+		option.WithGRPCDialOption(grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return listener.Dial()
+		})),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := New(nil, nil, ExporterOpts{
+		DisableAuth: true,
+		ProjectID:   "test-project",
+		Location:    "us-central1-b",
+		Cluster:     "test-cluster",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.metricClient = metricClient
+	if err := e.ApplyConfig(&config.DefaultConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := RunLoad(ctx, e, LoadOpts{
+		Series:          100,
+		SeriesPerTarget: 10,
+		Metrics:         5,
+		Churn:           0.5,
+		Interval:        200 * time.Millisecond,
+		Duration:        time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.SamplesExported < 100 || int(res.SamplesExported)%100 != 0 {
+		t.Fatalf("expected samples of all series to be exported every interval, got %v", res.SamplesExported)
+	}
+	// Half of the series are replaced every interval after the first one.
+	intervals := int(res.SamplesExported) / 100
+	if want := 100 + 50*(intervals-1); res.Series != want {
+		t.Errorf("expected %d series after %d intervals, got %d", want, intervals, res.Series)
+	}
+	if res.SamplesSent == 0 || res.Requests == 0 {
+		t.Errorf("expected samples to be sent, got %+v", res)
+	}
+	if res.PeakHeapBytes == 0 {
+		t.Errorf("expected heap usage to be sampled")
+	}
+	// Queued samples are sent before the run ends.
+	if res.SamplesSent != res.SamplesExported || res.FailedRequests != 0 {
+		t.Errorf("expected all %v samples to be sent, got %v in %v failed requests", res.SamplesExported, res.SamplesSent, res.FailedRequests)
+	}
+	metricServer.mtx.Lock()
+	defer metricServer.mtx.Unlock()
+	if received := float64(metricServer.samples); received != res.SamplesSent {
+		t.Errorf("expected %v samples received, got %v", res.SamplesSent, received)
+	}
+}
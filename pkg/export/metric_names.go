@@ -0,0 +1,83 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// MetricNameOpts represents exporter options for filtering exported series by their
+// metric name. The filter applies in addition to the matchers, so that series must
+// pass both to be exported.
+type MetricNameOpts struct {
+	// Allow holds regular expressions of which the metric name of exported series must
+	// fully match at least one. All metric names are allowed if empty.
+	Allow []string
+	// Deny holds regular expressions of metric names that are never exported, even if
+	// they match an expression in Allow.
+	Deny []string
+}
+
+// metricNameFilter decides whether series are exported by their metric name. A nil
+// filter allows all metric names.
+type metricNameFilter struct {
+	allow, deny *regexp.Regexp
+}
+
+func newMetricNameFilter(opts MetricNameOpts) (*metricNameFilter, error) {
+	if len(opts.Allow) == 0 && len(opts.Deny) == 0 {
+		return nil, nil
+	}
+	var (
+		f   metricNameFilter
+		err error
+	)
+	if f.allow, err = compileMetricNameRegexps(opts.Allow); err != nil {
+		return nil, fmt.Errorf("allowed metric names: %w", err)
+	}
+	if f.deny, err = compileMetricNameRegexps(opts.Deny); err != nil {
+		return nil, fmt.Errorf("denied metric names: %w", err)
+	}
+	return &f, nil
+}
+
+// compileMetricNameRegexps compiles a regular expression that fully matches the
+// strings that any of exprs matches. It returns nil if exprs is empty.
+func compileMetricNameRegexps(exprs []string) (*regexp.Regexp, error) {
+	if len(exprs) == 0 {
+		return nil, nil
+	}
+	groups := make([]string, 0, len(exprs))
+	for _, expr := range exprs {
+		if _, err := regexp.Compile(expr); err != nil {
+			return nil, fmt.Errorf("invalid regular expression %q: %w", expr, err)
+		}
+		groups = append(groups, "(?:"+expr+")")
+	}
+	return regexp.Compile("^(?:" + strings.Join(groups, "|") + ")$")
+}
+
+// allowed returns whether series of the metric name may be exported.
+func (f *metricNameFilter) allowed(name string) bool {
+	if f == nil {
+		return true
+	}
+	if f.deny != nil && f.deny.MatchString(name) {
+		return false
+	}
+	return f.allow == nil || f.allow.MatchString(name)
+}
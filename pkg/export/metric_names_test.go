@@ -0,0 +1,141 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/textparse"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/prometheus/prometheus/tsdb/record"
+)
+
+func TestMetricNameFilter(t *testing.T) {
+	f, err := newMetricNameFilter(MetricNameOpts{
+		Allow: []string{"kube_.+", "up"},
+		Deny:  []string{"kube_pod_.+", "kube_.*_labels"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]bool{
+		"up":                      true,
+		"kube_node_info":          true,
+		"kube_pod_info":           false,
+		"kube_namespace_labels":   false,
+		"node_cpu_seconds_total":  false,
+		"upstream_requests_total": false,
+		"my_kube_node_info":       false,
+	} {
+		if got := f.allowed(name); got != want {
+			t.Errorf("allowed(%q): expected %t, got %t", name, want, got)
+		}
+	}
+
+	// Without allowed names, all names but the denied ones are allowed.
+	f, err = newMetricNameFilter(MetricNameOpts{Deny: []string{"go_.+"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.allowed("up") || f.allowed("go_goroutines") {
+		t.Errorf("unexpected filter result for deny-only filter")
+	}
+
+	if f, err := newMetricNameFilter(MetricNameOpts{}); err != nil || f != nil || !f.allowed("up") {
+		t.Errorf("expected nil filter that allows all names, got %v, %v", f, err)
+	}
+	if _, err := newMetricNameFilter(MetricNameOpts{Deny: []string{"go_("}}); err == nil {
+		t.Errorf("expected error for invalid regular expression")
+	}
+}
+
+func TestSeriesCache_metricNames(t *testing.T) {
+	cache := newSeriesCache(nil, nil, MetricTypePrefix, Matchers{
+		labels.Selector{labels.MustNewMatcher(labels.MatchEqual, "job", "a")},
+	})
+	var err error
+	cache.metricNames, err = newMetricNameFilter(MetricNameOpts{Deny: []string{"metric2"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	series := map[storage.SeriesRef]labels.Labels{
+		1: labels.FromStrings("__name__", "metric1", "job", "a"),
+		2: labels.FromStrings("__name__", "metric2", "job", "a"),
+		3: labels.FromStrings("__name__", "metric1", "job", "b"),
+	}
+	cache.getLabelsByRef = func(ref storage.SeriesRef) labels.Labels {
+		return series[ref]
+	}
+	externalLabels := labels.FromStrings("project_id", "p1", "location", "l1")
+	metadata := testMetadataFunc(metricMetadataMap{
+		"metric1": {Type: textparse.MetricTypeGauge},
+		"metric2": {Type: textparse.MetricTypeGauge},
+	})
+	check := func(want map[storage.SeriesRef]bool) {
+		t.Helper()
+		for ref, wantDropped := range want {
+			e, ok := cache.get(record.RefSample{Ref: chunks.HeadSeriesRef(ref)}, externalLabels, metadata)
+			if !ok {
+				t.Fatalf("no entry for series %d", ref)
+			}
+			if e.dropped != wantDropped {
+				t.Errorf("series %d: expected dropped=%t, got %t", ref, wantDropped, e.dropped)
+			}
+		}
+	}
+	check(map[storage.SeriesRef]bool{1: false, 2: true, 3: true})
+
+	// The metric name filter still applies after the matchers change.
+	cache.setMatchers(nil)
+	check(map[storage.SeriesRef]bool{1: false, 2: true, 3: false})
+}
+
+func TestSeriesCache_getExportedLabels(t *testing.T) {
+	cache := newSeriesCache(nil, nil, MetricTypePrefix, Matchers{
+		labels.Selector{labels.MustNewMatcher(labels.MatchEqual, "job", "a")},
+	})
+	var err error
+	cache.metricNames, err = newMetricNameFilter(MetricNameOpts{Deny: []string{"metric2"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	series := map[storage.SeriesRef]labels.Labels{
+		1: labels.FromStrings("__name__", "metric1", "job", "a"),
+		2: labels.FromStrings("__name__", "metric2", "job", "a"),
+		3: labels.FromStrings("__name__", "metric1", "job", "b"),
+		// Has no metadata and cannot be converted.
+		4: labels.FromStrings("__name__", "metric3", "job", "a"),
+	}
+	cache.getLabelsByRef = func(ref storage.SeriesRef) labels.Labels {
+		return series[ref]
+	}
+	externalLabels := labels.FromStrings("project_id", "p1", "location", "l1")
+	metadata := testMetadataFunc(metricMetadataMap{
+		"metric1": {Type: textparse.MetricTypeGauge},
+		"metric2": {Type: textparse.MetricTypeGauge},
+	})
+	for ref := range series {
+		cache.get(record.RefSample{Ref: chunks.HeadSeriesRef(ref)}, externalLabels, metadata)
+	}
+	for ref, want := range map[storage.SeriesRef]labels.Labels{1: series[1], 2: nil, 3: nil, 4: nil, 5: nil} {
+		if diff := cmp.Diff(want, cache.getExportedLabels(ref)); diff != "" {
+			t.Errorf("series %d: unexpected labels (-want, +got): %s", ref, diff)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/prometheus/prometheus/model/histogram"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/textparse"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb/record"
+
+	distribution_pb "google.golang.org/genproto/googleapis/api/distribution"
+	metric_pb "google.golang.org/genproto/googleapis/api/metric"
+	monitoring_pb "google.golang.org/genproto/googleapis/monitoring/v3"
+)
+
+const (
+	// Maximum number of finite buckets of a distribution converted from a native
+	// histogram. Together with the underflow and overflow bucket this matches the
+	// bucket limit of Cloud Monitoring distributions.
+	maxNativeHistogramBuckets = 198
+	// Lowest resolution native histograms can be reduced to.
+	minNativeHistogramSchema = -4
+	// Native histograms are reduced to a resolution at which the finite buckets
+	// cover at least the values between 2^-nativeHistogramRangeExp and
+	// 2^nativeHistogramRangeExp.
+	nativeHistogramRangeExp = 40
+)
+
+// nativeHistogramMetadata wraps a MetadataFunc and always returns the histogram type,
+// as native histogram samples are histograms regardless of the exposed metadata.
+// The help text and unit are retained if metadata is found.
+func nativeHistogramMetadata(f MetadataFunc) MetadataFunc {
+	return func(metric string) (MetricMetadata, bool) {
+		var md MetricMetadata
+		if f != nil {
+			md, _ = f(metric)
+		}
+		md.Metric = metric
+		md.Type = textparse.MetricTypeHistogram
+		return md, true
+	}
+}
+
+// nextHistogram converts a native histogram sample into a distribution sample and attaches
+// the exemplar of the series if there is one. It returns nil if the sample did not produce a
+// time series, e.g. because it was the first sample of the series and only initialized its
+// reset timestamp.
+func (b *sampleBuilder) nextHistogram(metadata MetadataFunc, externalLabels labels.Labels, sample record.RefHistogramSample, exemplars map[storage.SeriesRef]record.RefExemplar) (*hashedSeries, error) {
+	ref := storage.SeriesRef(sample.Ref)
+
+	// Staleness markers are currently not supported by Cloud Monitoring.
+	if value.IsStaleNaN(sample.H.Sum) {
+		prometheusSamplesDiscarded.WithLabelValues("staleness-marker").Inc()
+		b.series.markStale(ref)
+		discardExemplarIncIfExists(ref, exemplars, "staleness-marker")
+		return nil, nil
+	}
+	entry, ok := b.series.get(record.RefSample{Ref: sample.Ref, T: sample.T}, externalLabels, metadata)
+	if !ok {
+		prometheusSamplesDiscarded.WithLabelValues("no-cache-series-found").Inc()
+		discardExemplarIncIfExists(ref, exemplars, "no-cache-series-found")
+		return nil, nil
+	}
+	if entry.dropped {
+		b.discardDropped(entry)
+		return nil, nil
+	}
+	// The series may have been cached with float samples before.
+	c := entry.protos.cumulative
+	if c.proto == nil || c.proto.ValueType != metric_pb.MetricDescriptor_DISTRIBUTION {
+		prometheusSamplesDiscarded.WithLabelValues("native-histogram-type-mismatch").Inc()
+		discardExemplarIncIfExists(ref, exemplars, "native-histogram-type-mismatch")
+		return nil, nil
+	}
+	resetTimestamp, h, ok := b.series.getResetAdjustedHistogram(ref, sample.T, sample.H.ToFloat())
+	if !ok {
+		discardExemplarIncIfExists(ref, exemplars, "zero-histogram-samples-processed")
+		return nil, nil
+	}
+	maxBuckets := maxNativeHistogramBuckets
+	if n := b.series.histograms.maxBuckets(entry.lset.Get(labels.MetricName)); n > 0 && n < maxBuckets {
+		maxBuckets = n
+	}
+	v, err := buildNativeDistribution(h, maxBuckets)
+	if err != nil {
+		prometheusSamplesDiscarded.WithLabelValues("native-histogram-negative-bucket-count").Inc()
+		discardExemplarIncIfExists(ref, exemplars, "native-histogram-negative-bucket-count")
+		return nil, fmt.Errorf("invalid native histogram %s: %w", entry.lset, err)
+	}
+	if exemplar, ok := exemplars[ref]; ok {
+		v.Exemplars = buildExemplars([]record.RefExemplar{exemplar})
+	}
+	ts := &monitoring_pb.TimeSeries{
+		Resource:   c.proto.Resource,
+		Metric:     c.proto.Metric,
+		MetricKind: c.proto.MetricKind,
+		ValueType:  c.proto.ValueType,
+		Points: []*monitoring_pb.Point{{
+			Interval: &monitoring_pb.TimeInterval{
+				StartTime: getTimestamp(resetTimestamp),
+				EndTime:   getTimestamp(sample.T),
+			},
+			Value: &monitoring_pb.TypedValue{
+				Value: &monitoring_pb.TypedValue_DistributionValue{DistributionValue: v},
+			},
+		}},
+	}
+	return &hashedSeries{hash: c.hash, proto: ts, priority: c.priority}, nil
+}
+
+// nativeDistributionSchema returns the schema native histograms of the given schema are
+// converted at so that maxBuckets finite buckets cover at least the values between
+// 2^-nativeHistogramRangeExp and 2^nativeHistogramRangeExp. It only depends on the schema
+// and bucket limit of a series, which keeps the buckets of its points stable.
+func nativeDistributionSchema(schema int32, maxBuckets int) int32 {
+	// Half of the buckets cover the values between 2^-rangeExp and 1, which requires
+	// 2^-schema >= 2*rangeExp/maxBuckets.
+	target := int32(math.Floor(math.Log2(float64(maxBuckets) / (2 * nativeHistogramRangeExp))))
+	if target < minNativeHistogramSchema {
+		target = minNativeHistogramSchema
+	}
+	if schema < target {
+		return schema
+	}
+	return target
+}
+
+// buildNativeDistribution converts a native histogram into a distribution with exponential
+// buckets. The histogram is reduced to the schema returned by nativeDistributionSchema and
+// the maxBuckets finite buckets are anchored around the value 1. This way all points of a
+// series have the same bucket options, regardless of which buckets are populated.
+// Buckets below the finite buckets, the zero bucket, and negative buckets are counted in the
+// underflow bucket as exponential buckets cannot represent them. Buckets above the finite
+// buckets are counted in the overflow bucket.
+func buildNativeDistribution(h *histogram.FloatHistogram, maxBuckets int) (*distribution_pb.Distribution, error) {
+	if schema := nativeDistributionSchema(h.Schema, maxBuckets); schema < h.Schema {
+		h = h.CopyToSchema(schema)
+	}
+	var (
+		growth = math.Exp2(math.Exp2(float64(-h.Schema)))
+		n      = int32(maxBuckets)
+		// Positive bucket i covers (growth^(i-1), growth^i]. The finite buckets are the
+		// buckets first to first+n-1.
+		first = 1 - n/2
+		scale = math.Pow(growth, float64(first-1))
+	)
+	var (
+		counts  = make([]int64, n+2)
+		mean    float64
+		dev     float64
+		count   int64
+		outside bool
+	)
+	if !math.IsNaN(h.Sum) && h.Count > 0 {
+		mean = h.Sum / h.Count
+	}
+	add := func(idx int32, c, x float64) error {
+		if c < 0 {
+			return fmt.Errorf("negative bucket count %f", c)
+		}
+		v := int64(math.Round(c))
+		counts[idx] += v
+		count += v
+		dev += float64(v) * (x - mean) * (x - mean)
+		return nil
+	}
+	if err := add(0, h.ZeroCount, 0); err != nil {
+		return nil, err
+	}
+	for it := h.NegativeBucketIterator(); it.Next(); {
+		b := it.At()
+		if err := add(0, b.Count, (b.Lower+b.Upper)/2); err != nil {
+			return nil, err
+		}
+	}
+	for it := h.PositiveBucketIterator(); it.Next(); {
+		b := it.At()
+		if b.Count == 0 {
+			continue
+		}
+		idx := b.Index - first + 1
+		if idx < 1 {
+			idx, outside = 0, true
+		} else if idx > n {
+			idx, outside = n+1, true
+		}
+		if err := add(idx, b.Count, (b.Lower+b.Upper)/2); err != nil {
+			return nil, err
+		}
+	}
+	if outside {
+		histogramsReduced.Inc()
+	}
+	// Deviation and mean must be 0 if count is 0.
+	if count == 0 {
+		mean, dev = 0, 0
+	}
+	return &distribution_pb.Distribution{
+		Count:                 count,
+		Mean:                  mean,
+		SumOfSquaredDeviation: dev,
+		BucketOptions: &distribution_pb.Distribution_BucketOptions{
+			Options: &distribution_pb.Distribution_BucketOptions_ExponentialBuckets{
+				ExponentialBuckets: &distribution_pb.Distribution_BucketOptions_Exponential{
+					NumFiniteBuckets: n,
+					GrowthFactor:     growth,
+					Scale:            scale,
+				},
+			},
+		},
+		BucketCounts: counts,
+	}, nil
+}
@@ -0,0 +1,304 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"math"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/prometheus/prometheus/model/histogram"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/textparse"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb/record"
+	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	distribution_pb "google.golang.org/genproto/googleapis/api/distribution"
+	metric_pb "google.golang.org/genproto/googleapis/api/metric"
+	monitoring_pb "google.golang.org/genproto/googleapis/monitoring/v3"
+)
+
+// nativeBucketCounts returns the bucket counts of a distribution with the maximum number
+// of finite buckets in which the buckets at the given positions are populated.
+func nativeBucketCounts(populated map[int]int64) []int64 {
+	counts := make([]int64, maxNativeHistogramBuckets+2)
+	for i, c := range populated {
+		counts[i] = c
+	}
+	return counts
+}
+
+func TestBuildNativeDistribution(t *testing.T) {
+	// The finite buckets are anchored so that bucket 0 is the 99th of them.
+	exponentialBuckets := func(growth, scale float64) *distribution_pb.Distribution_BucketOptions {
+		return &distribution_pb.Distribution_BucketOptions{
+			Options: &distribution_pb.Distribution_BucketOptions_ExponentialBuckets{
+				ExponentialBuckets: &distribution_pb.Distribution_BucketOptions_Exponential{
+					NumFiniteBuckets: maxNativeHistogramBuckets,
+					GrowthFactor:     growth,
+					Scale:            scale,
+				},
+			},
+		}
+	}
+	cases := []struct {
+		doc     string
+		h       *histogram.FloatHistogram
+		want    *distribution_pb.Distribution
+		wantErr bool
+	}{
+		{
+			doc: "positive, negative, and zero buckets",
+			h: &histogram.FloatHistogram{
+				Schema:          0,
+				ZeroThreshold:   0.001,
+				ZeroCount:       1,
+				Count:           5,
+				Sum:             2,
+				PositiveSpans:   []histogram.Span{{Offset: 0, Length: 2}},
+				PositiveBuckets: []float64{1, 2},
+				NegativeSpans:   []histogram.Span{{Offset: 0, Length: 1}},
+				NegativeBuckets: []float64{1},
+			},
+			want: &distribution_pb.Distribution{
+				Count: 5,
+				Mean:  0.4,
+				// Zero bucket at 0, negative bucket at -0.75, positive buckets at 0.75 and 1.5.
+				SumOfSquaredDeviation: 0.16 + 1.3225 + 0.1225 + 2*1.21,
+				BucketOptions:         exponentialBuckets(2, math.Exp2(-99)),
+				BucketCounts:          nativeBucketCounts(map[int]int64{0: 2, 99: 1, 100: 2}),
+			},
+		}, {
+			doc: "empty buckets are skipped",
+			h: &histogram.FloatHistogram{
+				Schema:          1,
+				Count:           3,
+				Sum:             9,
+				PositiveSpans:   []histogram.Span{{Offset: 3, Length: 4}},
+				PositiveBuckets: []float64{0, 1, 2, 0},
+			},
+			want: &distribution_pb.Distribution{
+				Count: 3,
+				Mean:  3,
+				// Buckets 4 and 5 cover (2.83, 4] and (4, 5.66].
+				SumOfSquaredDeviation: math.Pow((math.Sqrt(8)+4)/2-3, 2) + 2*math.Pow((4+math.Sqrt(32))/2-3, 2),
+				BucketOptions:         exponentialBuckets(math.Sqrt2, math.Exp2(-49.5)),
+				BucketCounts:          nativeBucketCounts(map[int]int64{103: 1, 104: 2}),
+			},
+		}, {
+			doc: "high resolution histograms are reduced",
+			h: &histogram.FloatHistogram{
+				Schema:          3,
+				Count:           2,
+				Sum:             2,
+				PositiveSpans:   []histogram.Span{{Offset: -1, Length: 2}},
+				PositiveBuckets: []float64{1, 1},
+			},
+			want: &distribution_pb.Distribution{
+				Count: 2,
+				Mean:  1,
+				// Buckets -1 and 0 are merged into bucket 0 of schema 1, which covers (0.71, 1].
+				SumOfSquaredDeviation: 2 * math.Pow((math.Sqrt(0.5)+1)/2-1, 2),
+				BucketOptions:         exponentialBuckets(math.Sqrt2, math.Exp2(-49.5)),
+				BucketCounts:          nativeBucketCounts(map[int]int64{99: 2}),
+			},
+		}, {
+			doc: "buckets beyond the finite buckets are counted in the overflow bucket",
+			h: &histogram.FloatHistogram{
+				Schema:          0,
+				Count:           2,
+				Sum:             2,
+				PositiveSpans:   []histogram.Span{{Offset: 1, Length: 1}, {Offset: 298, Length: 1}},
+				PositiveBuckets: []float64{1, 1},
+			},
+			want: &distribution_pb.Distribution{
+				Count: 2,
+				Mean:  1,
+				// Buckets 1 and 300 cover (1, 2] and (2^299, 2^300].
+				SumOfSquaredDeviation: math.Pow(1.5-1, 2) + math.Pow(1.5*0x1p299-1, 2),
+				BucketOptions:         exponentialBuckets(2, math.Exp2(-99)),
+				BucketCounts:          nativeBucketCounts(map[int]int64{100: 1, maxNativeHistogramBuckets + 1: 1}),
+			},
+		}, {
+			doc: "no populated buckets",
+			h: &histogram.FloatHistogram{
+				Schema: 0,
+			},
+			want: &distribution_pb.Distribution{
+				BucketOptions: exponentialBuckets(2, math.Exp2(-99)),
+				BucketCounts:  nativeBucketCounts(nil),
+			},
+		}, {
+			doc: "negative bucket count",
+			h: &histogram.FloatHistogram{
+				Schema:          0,
+				Count:           1,
+				PositiveSpans:   []histogram.Span{{Offset: 0, Length: 2}},
+				PositiveBuckets: []float64{2, -1},
+			},
+			wantErr: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.doc, func(t *testing.T) {
+			got, err := buildNativeDistribution(c.h, maxNativeHistogramBuckets)
+			if err == nil && c.wantErr {
+				t.Fatal("expected error but got none")
+			}
+			if err != nil && !c.wantErr {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if diff := cmp.Diff(c.want, got, protocmp.Transform(), cmpopts.EquateApprox(0, 1e-9)); diff != "" {
+				t.Errorf("unexpected distribution (-want, +got): %v", diff)
+			}
+		})
+	}
+}
+
+func TestSampleBuilderNativeHistogram(t *testing.T) {
+	externalLabels := labels.FromMap(map[string]string{
+		"project_id": "example-project",
+		"location":   "europe",
+		"cluster":    "foo-cluster",
+	})
+	cache := newSeriesCache(nil, nil, MetricTypePrefix, nil)
+	cache.getLabelsByRef = func(ref storage.SeriesRef) labels.Labels {
+		return labels.FromStrings("job", "job1", "instance", "instance1", "__name__", "metric1")
+	}
+	// The metadata of native histograms is always of type histogram.
+	metadata := nativeHistogramMetadata(testMetadataFunc(metricMetadataMap{
+		"metric1": {Type: textparse.MetricTypeGauge, Help: "metric1 help text"},
+	}))
+
+	newHistogram := func(count, sum float64, buckets ...float64) *histogram.Histogram {
+		h := &histogram.Histogram{
+			Schema:        0,
+			Count:         uint64(count),
+			Sum:           sum,
+			PositiveSpans: []histogram.Span{{Offset: 0, Length: uint32(len(buckets))}},
+		}
+		// Integer histograms are delta encoded.
+		var prev float64
+		for _, b := range buckets {
+			h.PositiveBuckets = append(h.PositiveBuckets, int64(b-prev))
+			prev = b
+		}
+		return h
+	}
+	samples := []record.RefHistogramSample{
+		{Ref: 1, T: 1000, H: newHistogram(2, 2, 1, 1)},
+		{Ref: 1, T: 2000, H: newHistogram(5, 5, 2, 3)},
+		// Counter reset.
+		{Ref: 1, T: 3000, H: newHistogram(1, 1, 1, 0)},
+		{Ref: 1, T: 4000, H: newHistogram(3, 4, 2, 1)},
+	}
+	type point struct {
+		start, end int64
+		counts     []int64
+	}
+	var got []point
+	var bucketOptions []*distribution_pb.Distribution_BucketOptions
+
+	b := newSampleBuilder(cache)
+	defer b.close()
+
+	for _, s := range samples {
+		out, err := b.nextHistogram(metadata, externalLabels, s, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if out == nil {
+			continue
+		}
+		if want := "prometheus.googleapis.com/metric1/histogram"; out.proto.Metric.Type != want {
+			t.Errorf("expected metric type %q, got %q", want, out.proto.Metric.Type)
+		}
+		if out.proto.MetricKind != metric_pb.MetricDescriptor_CUMULATIVE {
+			t.Errorf("expected cumulative metric kind, got %s", out.proto.MetricKind)
+		}
+		p := out.proto.Points[0]
+		got = append(got, point{
+			start:  p.Interval.StartTime.AsTime().UnixMilli(),
+			end:    p.Interval.EndTime.AsTime().UnixMilli(),
+			counts: p.Value.GetDistributionValue().BucketCounts,
+		})
+		bucketOptions = append(bucketOptions, p.Value.GetDistributionValue().BucketOptions)
+	}
+	want := []point{
+		// The first sample only initializes the reset timestamp.
+		{start: 1000, end: 2000, counts: nativeBucketCounts(map[int]int64{99: 1, 100: 2})},
+		{start: 2999, end: 3000, counts: nativeBucketCounts(map[int]int64{99: 1})},
+		{start: 2999, end: 4000, counts: nativeBucketCounts(map[int]int64{99: 2, 100: 1})},
+	}
+	if diff := cmp.Diff(want, got, cmp.AllowUnexported(point{})); diff != "" {
+		t.Errorf("unexpected points (-want, +got): %v", diff)
+	}
+	// The points populate different buckets but must share the bucket layout of the series.
+	for i := 1; i < len(bucketOptions); i++ {
+		if diff := cmp.Diff(bucketOptions[0], bucketOptions[i], protocmp.Transform()); diff != "" {
+			t.Errorf("bucket options of point %d differ from the first point (-first, +got): %v", i, diff)
+		}
+	}
+}
+
+func TestSampleBuilderNativeHistogramExemplars(t *testing.T) {
+	cache := newSeriesCache(nil, nil, MetricTypePrefix, nil)
+	cache.getLabelsByRef = func(ref storage.SeriesRef) labels.Labels {
+		return labels.FromStrings("job", "job1", "instance", "instance1", "__name__", "metric1")
+	}
+	externalLabels := labels.FromStrings("project_id", "example-project", "location", "europe")
+	metadata := nativeHistogramMetadata(nil)
+
+	h := &histogram.Histogram{
+		Count:           1,
+		Sum:             1,
+		PositiveSpans:   []histogram.Span{{Offset: 0, Length: 1}},
+		PositiveBuckets: []int64{1},
+	}
+	exemplars := map[storage.SeriesRef]record.RefExemplar{
+		1: {
+			Ref:    1,
+			T:      2000,
+			V:      0.8,
+			Labels: labels.FromStrings("project_id", "p1", "span_id", "00f067aa0ba902b7", "trace_id", "4bf92f3577b34da6a3ce929d0e0e4736"),
+		},
+	}
+	b := newSampleBuilder(cache)
+	defer b.close()
+
+	if _, err := b.nextHistogram(metadata, externalLabels, record.RefHistogramSample{Ref: 1, T: 1000, H: h}, nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	out, err := b.nextHistogram(metadata, externalLabels, record.RefHistogramSample{Ref: 1, T: 2000, H: h}, exemplars)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := []*distribution_pb.Distribution_Exemplar{{
+		Value:     0.8,
+		Timestamp: getTimestamp(2000),
+		Attachments: []*anypb.Any{
+			wrapAsAny(&monitoring_pb.SpanContext{
+				SpanName: "projects/p1/traces/4bf92f3577b34da6a3ce929d0e0e4736/spans/00f067aa0ba902b7",
+			}),
+		},
+	}}
+	got := out.proto.Points[0].Value.GetDistributionValue().GetExemplars()
+	if diff := cmp.Diff(want, got, protocmp.Transform()); diff != "" {
+		t.Errorf("unexpected exemplars (-want, +got): %v", diff)
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var exportPaused = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "gcm_export_paused",
+	Help: "Whether sending samples to GCM is paused.",
+})
+
+// Pause stops sending samples to GCM. Samples are still accepted and queued in the
+// shards, and the disk buffer if enabled, until they are full. Samples that do not fit
+// anymore are dropped.
+func (e *Exporter) Pause() {
+	if e.opts.Disable {
+		return
+	}
+	if e.paused.Swap(true) {
+		return
+	}
+	exportPaused.Set(1)
+	level.Info(e.logger).Log("msg", "paused export")
+}
+
+// Resume continues sending samples to GCM after Pause, starting with the queued samples.
+func (e *Exporter) Resume() {
+	if e.opts.Disable {
+		return
+	}
+	if !e.paused.Swap(false) {
+		return
+	}
+	exportPaused.Set(0)
+	level.Info(e.logger).Log("msg", "resumed export")
+	e.triggerNext()
+}
+
+// Paused returns whether sending samples to GCM is paused.
+func (e *Exporter) Paused() bool {
+	return e.paused.Load()
+}
+
+// PauseHandler returns a handler that pauses the export on POST requests.
+func (e *Exporter) PauseHandler() http.HandlerFunc {
+	return e.pauseHandler(e.Pause)
+}
+
+// ResumeHandler returns a handler that resumes the export on POST requests.
+func (e *Exporter) ResumeHandler() http.HandlerFunc {
+	return e.pauseHandler(e.Resume)
+}
+
+func (e *Exporter) pauseHandler(f func()) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Only POST requests allowed.", http.StatusMethodNotAllowed)
+			return
+		}
+		f()
+		fmt.Fprintf(w, "paused: %t\n", e.Paused())
+	}
+}
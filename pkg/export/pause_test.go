@@ -0,0 +1,61 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestExporter_pauseHandlers(t *testing.T) {
+	e, err := New(nil, nil, ExporterOpts{DisableAuth: true, Paused: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !e.Paused() {
+		t.Fatalf("expected exporter to start paused")
+	}
+
+	rec := httptest.NewRecorder()
+	e.ResumeHandler()(rec, httptest.NewRequest(http.MethodGet, "/-/export/resume", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status %d for GET, got %d", http.StatusMethodNotAllowed, rec.Code)
+	}
+	if !e.Paused() {
+		t.Fatalf("expected exporter to remain paused")
+	}
+
+	rec = httptest.NewRecorder()
+	e.ResumeHandler()(rec, httptest.NewRequest(http.MethodPost, "/-/export/resume", nil))
+	if rec.Code != http.StatusOK || e.Paused() {
+		t.Fatalf("expected exporter to be resumed, got status %d", rec.Code)
+	}
+	// A resume signals the send loop to pick up the queued samples.
+	select {
+	case <-e.nextc:
+	default:
+		t.Errorf("expected resume to trigger sending")
+	}
+
+	rec = httptest.NewRecorder()
+	e.PauseHandler()(rec, httptest.NewRequest(http.MethodPost, "/-/export/pause", nil))
+	if rec.Code != http.StatusOK || !e.Paused() {
+		t.Fatalf("expected exporter to be paused, got status %d", rec.Code)
+	}
+	if got, want := rec.Body.String(), "paused: true\n"; got != want {
+		t.Errorf("expected body %q, got %q", want, got)
+	}
+}
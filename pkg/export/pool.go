@@ -20,6 +20,7 @@ import (
 	"sync"
 
 	"github.com/prometheus/client_golang/prometheus"
+	monitoredres_pb "google.golang.org/genproto/googleapis/api/monitoredres"
 	monitoring_pb "google.golang.org/genproto/googleapis/monitoring/v3"
 )
 
@@ -38,12 +39,13 @@ var (
 	)
 )
 
-// pool holds interned strings and label sets to deduplicate memory across
-// cached monitoring_pb.TimeSeries entries.
+// pool holds interned strings, label sets, and monitored resources to deduplicate
+// memory across cached monitoring_pb.TimeSeries entries.
 type pool struct {
-	mtx     sync.Mutex
-	strings map[string]*stringEntry
-	labels  map[uint64]*labelsEntry
+	mtx       sync.Mutex
+	strings   map[string]*stringEntry
+	labels    map[uint64]*labelsEntry
+	resources map[uint64]*resourceEntry
 }
 
 func newPool(reg prometheus.Registerer) *pool {
@@ -51,8 +53,9 @@ func newPool(reg prometheus.Registerer) *pool {
 		reg.MustRegister(poolIntern, poolRelease)
 	}
 	return &pool{
-		strings: map[string]*stringEntry{},
-		labels:  map[uint64]*labelsEntry{},
+		strings:   map[string]*stringEntry{},
+		labels:    map[uint64]*labelsEntry{},
+		resources: map[uint64]*resourceEntry{},
 	}
 }
 
@@ -66,7 +69,14 @@ type labelsEntry struct {
 	labels map[string]string
 }
 
-// intern the strings and label sets in ts.
+type resourceEntry struct {
+	refs     uint32
+	resource *monitoredres_pb.MonitoredResource
+}
+
+// intern the strings, label sets, and monitored resource in ts. All series of the
+// same target share a single resource proto afterwards, which allows batches to
+// group them by pointer.
 func (p *pool) intern(ts *monitoring_pb.TimeSeries) {
 	if ts == nil {
 		return
@@ -76,7 +86,7 @@ func (p *pool) intern(ts *monitoring_pb.TimeSeries) {
 
 	poolIntern.Inc()
 
-	ts.Resource.Labels = p.internLabels(ts.Resource.Labels)
+	ts.Resource = p.internResource(ts.Resource)
 	ts.Metric.Type = p.internString(ts.Metric.Type)
 	ts.Metric.Labels = p.internLabels(ts.Metric.Labels)
 }
@@ -97,6 +107,26 @@ func (p *pool) labelSum(lset map[string]string) uint64 {
 	return h.Sum64()
 }
 
+func (p *pool) resourceSum(r *monitoredres_pb.MonitoredResource) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(r.Type))
+	hashLabels(h, r.Labels)
+	return h.Sum64()
+}
+
+func (p *pool) internResource(r *monitoredres_pb.MonitoredResource) *monitoredres_pb.MonitoredResource {
+	hsum := p.resourceSum(r)
+
+	e, ok := p.resources[hsum]
+	if !ok {
+		r.Labels = p.internLabels(r.Labels)
+		e = &resourceEntry{resource: r}
+		p.resources[hsum] = e
+	}
+	e.refs++
+	return e.resource
+}
+
 func (p *pool) internLabels(lset map[string]string) map[string]string {
 	hsum := p.labelSum(lset)
 
@@ -128,7 +158,7 @@ func (p *pool) release(ts *monitoring_pb.TimeSeries) {
 
 	poolRelease.Inc()
 
-	p.releaseLabels(ts.Resource.Labels)
+	p.releaseResource(ts.Resource)
 	p.releaseString(ts.Metric.Type)
 	p.releaseLabels(ts.Metric.Labels)
 }
@@ -160,3 +190,17 @@ func (p *pool) releaseLabels(lset map[string]string) {
 		delete(p.labels, hsum)
 	}
 }
+
+func (p *pool) releaseResource(r *monitoredres_pb.MonitoredResource) {
+	hsum := p.resourceSum(r)
+
+	e, ok := p.resources[hsum]
+	if !ok {
+		panic(fmt.Sprintf("release of non-interned resource %s", r))
+	}
+	e.refs--
+	if e.refs == 0 {
+		p.releaseLabels(e.resource.Labels)
+		delete(p.resources, hsum)
+	}
+}
@@ -88,3 +88,42 @@ func TestPool(t *testing.T) {
 		t.Errorf("Expected %d unique label sets to be interned but got %d. All entries: %v", want, got, p.labels)
 	}
 }
+
+func TestPool_resources(t *testing.T) {
+	p := newPool(nil)
+
+	newSeries := func(instance, metric string) *monitoring_pb.TimeSeries {
+		return &monitoring_pb.TimeSeries{
+			Resource: &monitoredres_pb.MonitoredResource{
+				Type:   "prometheus_target",
+				Labels: map[string]string{"instance": instance},
+			},
+			Metric: &metric_pb.Metric{Type: metric},
+		}
+	}
+	ts1, ts2, ts3 := newSeries("a", "metric1"), newSeries("a", "metric2"), newSeries("b", "metric1")
+	p.intern(ts1)
+	p.intern(ts2)
+	p.intern(ts3)
+
+	// Series of the same resource must share its proto.
+	if ts1.Resource != ts2.Resource {
+		t.Errorf("expected series with equal resources to share the resource proto")
+	}
+	if ts1.Resource == ts3.Resource {
+		t.Errorf("expected series with different resources to not share the resource proto")
+	}
+	if want, got := 2, len(p.resources); want != got {
+		t.Errorf("Expected %d unique resources to be interned but got %d", want, got)
+	}
+
+	p.release(ts1)
+	if want, got := 2, len(p.resources); want != got {
+		t.Errorf("Expected %d unique resources to be interned but got %d", want, got)
+	}
+	p.release(ts2)
+	p.release(ts3)
+	if len(p.resources) != 0 || len(p.labels) != 0 || len(p.strings) != 0 {
+		t.Errorf("expected pool to be empty, got %d resources, %d label sets, %d strings", len(p.resources), len(p.labels), len(p.strings))
+	}
+}
@@ -0,0 +1,34 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+// newShard returns a new shard with a priority queue if priority matchers are set.
+// The priority queue has the same size as the regular queue, so that high priority
+// samples are not dropped because the regular queue is full of other samples.
+func (e *Exporter) newShard() *shard {
+	s := newShard(e.opts.Efficiency.ShardBufferSize)
+	if len(e.opts.PriorityMatchers) > 0 {
+		s.priorityQueue = newQueue(e.opts.Efficiency.ShardBufferSize)
+	}
+	return s
+}
+
+// shardCapacity returns the number of samples that can be queued in a single shard.
+func (e *Exporter) shardCapacity() uint {
+	if len(e.opts.PriorityMatchers) > 0 {
+		return 2 * e.opts.Efficiency.ShardBufferSize
+	}
+	return e.opts.Efficiency.ShardBufferSize
+}
@@ -0,0 +1,99 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/textparse"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/prometheus/prometheus/tsdb/record"
+	monitoredres_pb "google.golang.org/genproto/googleapis/api/monitoredres"
+	monitoring_pb "google.golang.org/genproto/googleapis/monitoring/v3"
+)
+
+func TestShard_priority(t *testing.T) {
+	s := newShard(2)
+	s.priorityQueue = newQueue(2)
+
+	sample := func(name string) *monitoring_pb.TimeSeries {
+		return &monitoring_pb.TimeSeries{
+			Resource: &monitoredres_pb.MonitoredResource{Type: name},
+		}
+	}
+	// Regular samples are dropped once their queue is full, high priority samples are not.
+	for i := 0; i < 3; i++ {
+		ok := s.tryEnqueue(queueEntry{hash: uint64(i), sample: sample(fmt.Sprintf("regular-%d", i))})
+		if ok != (i < 2) {
+			t.Fatalf("unexpected enqueue result %t for regular sample %d", ok, i)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if !s.tryEnqueue(queueEntry{hash: uint64(10 + i), sample: sample(fmt.Sprintf("priority-%d", i)), priority: true}) {
+			t.Fatalf("unexpected full queue for priority sample %d", i)
+		}
+	}
+	if got := s.length(); got != 4 {
+		t.Fatalf("expected 4 queued samples, got %d", got)
+	}
+
+	// A batch that cannot take all samples is filled with the high priority samples first.
+	b := newBatch(nil, 1, 3)
+	took, remaining := s.fill(b)
+	if took != 3 || remaining != 1 {
+		t.Fatalf("unexpected fill result took=%d, remaining=%d", took, remaining)
+	}
+	var got []string
+	for _, l := range b.m {
+		for _, s := range l {
+			got = append(got, s.Resource.Type)
+		}
+	}
+	want := []string{"priority-0", "priority-1", "regular-0"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("expected batch %v, got %v", want, got)
+	}
+}
+
+func TestSeriesCache_priority(t *testing.T) {
+	cache := newSeriesCache(nil, nil, MetricTypePrefix, nil)
+	cache.priorityMatchers = Matchers{labels.Selector{labels.MustNewMatcher(labels.MatchRegexp, "__name__", ".+:.+")}}
+	cache.getLabelsByRef = func(ref storage.SeriesRef) labels.Labels {
+		if ref == 1 {
+			return labels.FromStrings("__name__", "job:metric1:sum")
+		}
+		return labels.FromStrings("__name__", "metric1")
+	}
+	externalLabels := labels.FromStrings("project_id", "p1", "location", "l1")
+	metadata := testMetadataFunc(metricMetadataMap{
+		"job:metric1:sum": {Type: textparse.MetricTypeGauge},
+		"metric1":         {Type: textparse.MetricTypeGauge},
+	})
+	b := newSampleBuilder(cache)
+	defer b.close()
+
+	for ref, want := range map[uint64]bool{1: true, 2: false} {
+		samples, _, err := b.next(metadata, externalLabels, []record.RefSample{{Ref: chunks.HeadSeriesRef(ref), T: 1000, V: 1}}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(samples) != 1 || samples[0].priority != want {
+			t.Errorf("expected priority=%t for series %d, got %+v", want, ref, samples)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/golang/snappy"
+	gax "github.com/googleapis/gax-go/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+var remoteWriteSamples = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "gcm_export_remote_write_samples_total",
+	Help: "Number of samples mirrored to the remote write endpoint by whether they were sent, failed to be sent, or dropped because the queue was full.",
+}, []string{"result"})
+
+var remoteWriteRetries = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "gcm_export_remote_write_retries_total",
+	Help: "Number of remote write requests retried when only writing to the remote write endpoint.",
+})
+
+const (
+	// DefaultRemoteWriteBatchSize is the default maximum number of samples per
+	// remote write request.
+	DefaultRemoteWriteBatchSize = 2000
+	// DefaultRemoteWriteQueueSize is the default number of samples that can be
+	// queued for the remote write endpoint.
+	DefaultRemoteWriteQueueSize = 100000
+	// DefaultRemoteWriteTimeout is the default timeout of remote write requests.
+	DefaultRemoteWriteTimeout = 30 * time.Second
+
+	// Maximum time samples are held back before they are sent.
+	remoteWriteFlushInterval = 5 * time.Second
+
+	// Bounds of the backoff between retries of failed requests.
+	remoteWriteInitialBackoff = 500 * time.Millisecond
+	remoteWriteMaxBackoff     = 30 * time.Second
+)
+
+// RemoteWriteOpts represents exporter options for mirroring samples to a Prometheus
+// remote write endpoint in addition to GCM, e.g. to validate a migration, or for
+// writing them to the endpoint instead of GCM.
+type RemoteWriteOpts struct {
+	// URL of the remote write endpoint. Mirroring is disabled if empty.
+	URL string
+	// Only write samples to the remote write endpoint and make no requests to GCM,
+	// which then need no credentials. Failed requests are retried until they succeed
+	// or fail permanently. Native histograms cannot be written and are dropped.
+	Only bool
+	// A list of metric selectors. Only series matching at least one of the matchers
+	// are mirrored. All series are mirrored if empty. Must be empty if Only is set.
+	Matchers Matchers
+	// Maximum number of samples per request. Defaults to DefaultRemoteWriteBatchSize
+	// when 0.
+	BatchSize int
+	// Number of samples that can be queued. Samples are dropped if the queue is full.
+	// Defaults to DefaultRemoteWriteQueueSize when 0.
+	QueueSize int
+	// Timeout of requests. Defaults to DefaultRemoteWriteTimeout when 0.
+	Timeout time.Duration
+}
+
+func (o *RemoteWriteOpts) validate() error {
+	if o.URL == "" {
+		if o.Only {
+			return fmt.Errorf("remote write URL must be set to only write to the remote write endpoint")
+		}
+		return nil
+	}
+	if _, err := url.Parse(o.URL); err != nil {
+		return fmt.Errorf("invalid remote write URL: %w", err)
+	}
+	if o.Only && len(o.Matchers) > 0 {
+		return fmt.Errorf("remote write matchers cannot be set when only writing to the remote write endpoint")
+	}
+	if o.BatchSize == 0 {
+		o.BatchSize = DefaultRemoteWriteBatchSize
+	}
+	if o.QueueSize == 0 {
+		o.QueueSize = DefaultRemoteWriteQueueSize
+	}
+	if o.Timeout == 0 {
+		o.Timeout = DefaultRemoteWriteTimeout
+	}
+	if o.BatchSize < 0 || o.QueueSize < 0 || o.Timeout < 0 {
+		return fmt.Errorf("remote write batch size, queue size, and timeout must be positive")
+	}
+	return nil
+}
+
+// remoteWriter mirrors samples to a Prometheus remote write endpoint. Samples are
+// sent in the order they were added by a single sender, which keeps the samples of
+// each series in order. Failed requests are only retried if the endpoint is the
+// only destination of samples.
+type remoteWriter struct {
+	logger log.Logger
+	opts   RemoteWriteOpts
+	client *http.Client
+	queue  chan prompb.TimeSeries
+}
+
+func newRemoteWriter(logger log.Logger, opts RemoteWriteOpts) *remoteWriter {
+	return &remoteWriter{
+		logger: logger,
+		opts:   opts,
+		client: &http.Client{Timeout: opts.Timeout},
+		queue:  make(chan prompb.TimeSeries, opts.QueueSize),
+	}
+}
+
+// add queues a sample of the series for sending if the series matches. It never
+// blocks so that a slow endpoint does not stall the export of samples.
+func (w *remoteWriter) add(lset labels.Labels, t int64, v float64) {
+	if len(w.opts.Matchers) > 0 && !w.opts.Matchers.Matches(lset) {
+		return
+	}
+	ts := prompb.TimeSeries{
+		Labels:  make([]prompb.Label, 0, len(lset)),
+		Samples: []prompb.Sample{{Timestamp: t, Value: v}},
+	}
+	for _, l := range lset {
+		ts.Labels = append(ts.Labels, prompb.Label{Name: l.Name, Value: l.Value})
+	}
+	select {
+	case w.queue <- ts:
+	default:
+		remoteWriteSamples.WithLabelValues("dropped").Inc()
+	}
+}
+
+// run sends queued samples until the context is canceled.
+func (w *remoteWriter) run(ctx context.Context) {
+	ticker := time.NewTicker(remoteWriteFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]prompb.TimeSeries, 0, w.opts.BatchSize)
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := w.sendWithRetry(ctx, batch); err != nil {
+			level.Error(w.logger).Log("msg", "remote write failed", "size", len(batch), "err", err)
+			remoteWriteSamples.WithLabelValues("failed").Add(float64(len(batch)))
+		} else {
+			remoteWriteSamples.WithLabelValues("sent").Add(float64(len(batch)))
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ts := <-w.queue:
+			batch = append(batch, ts)
+			if len(batch) >= w.opts.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// sendWithRetry sends the samples and, if the endpoint is the only destination of
+// samples, retries recoverable errors until the context is canceled.
+func (w *remoteWriter) sendWithRetry(ctx context.Context, samples []prompb.TimeSeries) error {
+	bo := gax.Backoff{
+		Initial:    remoteWriteInitialBackoff,
+		Max:        remoteWriteMaxBackoff,
+		Multiplier: 2,
+	}
+	for {
+		err := w.send(ctx, samples)
+		var rerr recoverableError
+		if err == nil || !w.opts.Only || !errors.As(err, &rerr) {
+			return err
+		}
+		level.Warn(w.logger).Log("msg", "remote write failed, retrying", "size", len(samples), "err", err)
+		remoteWriteRetries.Inc()
+
+		if err := gax.Sleep(ctx, bo.Pause()); err != nil {
+			return err
+		}
+	}
+}
+
+// recoverableError is returned for failed remote write requests that may succeed
+// if retried.
+type recoverableError struct {
+	error
+}
+
+// send writes the samples to the remote write endpoint.
+func (w *remoteWriter) send(ctx context.Context, samples []prompb.TimeSeries) error {
+	data, err := (&prompb.WriteRequest{Timeseries: samples}).Marshal()
+	if err != nil {
+		return fmt.Errorf("marshal request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.opts.URL, bytes.NewReader(snappy.Encode(nil, data)))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", ClientName)
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return recoverableError{err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+		err := fmt.Errorf("remote write returned HTTP status %s: %s", resp.Status, bytes.TrimSpace(body))
+		// Like Prometheus, retry server errors and rate limited requests.
+		if resp.StatusCode/100 == 5 || resp.StatusCode == http.StatusTooManyRequests {
+			return recoverableError{err}
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/golang/snappy"
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+func TestRemoteWriter(t *testing.T) {
+	reqc := make(chan *prompb.WriteRequest, 1)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Content-Encoding"); got != "snappy" {
+			t.Errorf("unexpected content encoding %q", got)
+		}
+		compressed, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		data, err := snappy.Decode(nil, compressed)
+		if err != nil {
+			t.Error(err)
+		}
+		var req prompb.WriteRequest
+		if err := req.Unmarshal(data); err != nil {
+			t.Error(err)
+		}
+		reqc <- &req
+	}))
+	defer srv.Close()
+
+	var matchers Matchers
+	if err := matchers.Set(`{job="job1"}`); err != nil {
+		t.Fatal(err)
+	}
+	opts := RemoteWriteOpts{URL: srv.URL, Matchers: matchers, BatchSize: 2}
+	if err := opts.validate(); err != nil {
+		t.Fatal(err)
+	}
+	w := newRemoteWriter(log.NewNopLogger(), opts)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.run(ctx)
+
+	w.add(labels.FromStrings("__name__", "metric1", "job", "job1"), 1000, 1)
+	// Filtered out by the matchers.
+	w.add(labels.FromStrings("__name__", "metric1", "job", "job2"), 1000, 2)
+	w.add(labels.FromStrings("__name__", "metric1", "job", "job1"), 2000, 3)
+
+	want := &prompb.WriteRequest{
+		Timeseries: []prompb.TimeSeries{
+			{
+				Labels:  []prompb.Label{{Name: "__name__", Value: "metric1"}, {Name: "job", Value: "job1"}},
+				Samples: []prompb.Sample{{Timestamp: 1000, Value: 1}},
+			},
+			{
+				Labels:  []prompb.Label{{Name: "__name__", Value: "metric1"}, {Name: "job", Value: "job1"}},
+				Samples: []prompb.Sample{{Timestamp: 2000, Value: 3}},
+			},
+		},
+	}
+	if diff := cmp.Diff(want, <-reqc); diff != "" {
+		t.Errorf("unexpected request (-want, +got): %s", diff)
+	}
+}
+
+func TestRemoteWriter_only(t *testing.T) {
+	var attempts atomic.Int64
+	reqc := make(chan *prompb.WriteRequest, 3)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Fail the first request with a recoverable error.
+		if attempts.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		compressed, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		data, err := snappy.Decode(nil, compressed)
+		if err != nil {
+			t.Error(err)
+		}
+		var req prompb.WriteRequest
+		if err := req.Unmarshal(data); err != nil {
+			t.Error(err)
+		}
+		reqc <- &req
+	}))
+	defer srv.Close()
+
+	opts := RemoteWriteOpts{URL: srv.URL, Only: true, BatchSize: 1, QueueSize: 3}
+	if err := opts.validate(); err != nil {
+		t.Fatal(err)
+	}
+	w := newRemoteWriter(log.NewNopLogger(), opts)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.run(ctx)
+
+	// The first request is retried and the queued samples are sent in order.
+	for i := 1; i <= 3; i++ {
+		w.add(labels.FromStrings("__name__", "metric1"), int64(i*1000), float64(i))
+	}
+	for i := 1; i <= 3; i++ {
+		want := &prompb.WriteRequest{
+			Timeseries: []prompb.TimeSeries{{
+				Labels:  []prompb.Label{{Name: "__name__", Value: "metric1"}},
+				Samples: []prompb.Sample{{Timestamp: int64(i * 1000), Value: float64(i)}},
+			}},
+		}
+		if diff := cmp.Diff(want, <-reqc); diff != "" {
+			t.Errorf("unexpected request (-want, +got): %s", diff)
+		}
+	}
+	if got := attempts.Load(); got != 4 {
+		t.Errorf("expected 4 attempts, got %d", got)
+	}
+}
+
+func TestRemoteWriter_queueFull(t *testing.T) {
+	opts := RemoteWriteOpts{URL: "http://localhost:9090/api/v1/write", Only: true, QueueSize: 1}
+	if err := opts.validate(); err != nil {
+		t.Fatal(err)
+	}
+	w := newRemoteWriter(log.NewNopLogger(), opts)
+
+	// Without a running sender, adding more samples than the queue holds must not block.
+	for i := 1; i <= 3; i++ {
+		w.add(labels.FromStrings("__name__", "metric1"), int64(i*1000), float64(i))
+	}
+	if got := len(w.queue); got != 1 {
+		t.Errorf("expected 1 queued sample, got %d", got)
+	}
+}
+
+func TestRemoteWriteOptsValidate(t *testing.T) {
+	opts := RemoteWriteOpts{Only: true}
+	if err := opts.validate(); err == nil {
+		t.Error("expected error for only writing to the remote write endpoint without URL")
+	}
+	opts = RemoteWriteOpts{URL: "http://localhost:9090/api/v1/write", Only: true}
+	if err := opts.validate(); err != nil {
+		t.Fatal(err)
+	}
+	if opts.BatchSize != DefaultRemoteWriteBatchSize || opts.QueueSize != DefaultRemoteWriteQueueSize || opts.Timeout != DefaultRemoteWriteTimeout {
+		t.Errorf("unexpected defaults: %+v", opts)
+	}
+
+	var matchers Matchers
+	if err := matchers.Set(`{job="job1"}`); err != nil {
+		t.Fatal(err)
+	}
+	opts = RemoteWriteOpts{URL: "http://localhost:9090/api/v1/write", Only: true, Matchers: matchers}
+	if err := opts.validate(); err == nil {
+		t.Error("expected error for matchers when only writing to the remote write endpoint")
+	}
+}
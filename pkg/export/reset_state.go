@@ -0,0 +1,163 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/storage"
+)
+
+var seriesCacheRestored = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "gcm_export_series_cache_restored_total",
+	Help: "Number of series whose counter reset state was restored from the state file of a previous run.",
+})
+
+const (
+	// Interval at which the counter reset state is written to the state file.
+	resetStateSaveInterval = time.Minute
+
+	// Header of the state file, followed by a version byte.
+	resetStateMagic   = "GCMRST"
+	resetStateVersion = 1
+)
+
+// resetState is the counter reset state of a series that is persisted across restarts,
+// keyed by the hash of the series labels as series references are not stable.
+type resetState struct {
+	Hash           uint64
+	ResetTimestamp int64
+	ResetValue     float64
+	LastValue      float64
+	LastTimestamp  int64
+}
+
+// loadResetState reads the counter reset state of a previous run from the state file.
+// A missing state file is not an error.
+func (c *seriesCache) loadResetState() error {
+	f, err := os.Open(c.opts.StateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("open series cache state file: %w", err)
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	header := make([]byte, len(resetStateMagic)+1)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return fmt.Errorf("read series cache state file header: %w", err)
+	}
+	if string(header[:len(resetStateMagic)]) != resetStateMagic || header[len(resetStateMagic)] != resetStateVersion {
+		return fmt.Errorf("series cache state file %q has an unknown format", c.opts.StateFile)
+	}
+	var count uint64
+	if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
+		return fmt.Errorf("read series cache state file: %w", err)
+	}
+	restored := map[uint64]resetState{}
+	for i := uint64(0); i < count; i++ {
+		var s resetState
+		if err := binary.Read(r, binary.LittleEndian, &s); err != nil {
+			return fmt.Errorf("read series cache state file: %w", err)
+		}
+		restored[s.Hash] = s
+	}
+
+	c.resetMtx.Lock()
+	c.restored = restored
+	c.resetMtx.Unlock()
+
+	level.Info(c.logger).Log("msg", "loaded counter reset state", "series", len(restored))
+	return nil
+}
+
+// saveResetState writes the counter reset state of all counters for which points were
+// exported to the state file. Restored state that was not used yet is kept.
+// Native histograms are not persisted.
+func (c *seriesCache) saveResetState() error {
+	var states []resetState
+	c.each(func(_ storage.SeriesRef, e *seriesCacheEntry) {
+		if e.lset == nil || !e.hasReset || e.lastTimestamp == 0 || e.lastHistogram != nil {
+			return
+		}
+		states = append(states, resetState{
+			Hash:           e.lset.Hash(),
+			ResetTimestamp: e.resetTimestamp,
+			ResetValue:     e.resetValue,
+			LastValue:      e.lastValue,
+			LastTimestamp:  e.lastTimestamp,
+		})
+	})
+	c.resetMtx.Lock()
+	for _, s := range c.restored {
+		states = append(states, s)
+	}
+	c.resetMtx.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(c.opts.StateFile), 0o777); err != nil {
+		return fmt.Errorf("create series cache state directory: %w", err)
+	}
+	// Write to a temporary file first so that a crash never leaves a partial state file.
+	tmp := c.opts.StateFile + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("create series cache state file: %w", err)
+	}
+	w := bufio.NewWriter(f)
+	w.WriteString(resetStateMagic)
+	w.WriteByte(resetStateVersion)
+	binary.Write(w, binary.LittleEndian, uint64(len(states)))
+	binary.Write(w, binary.LittleEndian, states)
+
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("write series cache state file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("close series cache state file: %w", err)
+	}
+	if err := os.Rename(tmp, c.opts.StateFile); err != nil {
+		return fmt.Errorf("rename series cache state file: %w", err)
+	}
+	return nil
+}
+
+// restoreResetState returns and removes the restored counter reset state of the entry.
+// Must be called with the lock of the entry's stripe held.
+func (c *seriesCache) restoreResetState(e *seriesCacheEntry) (resetState, bool) {
+	c.resetMtx.Lock()
+	defer c.resetMtx.Unlock()
+
+	if len(c.restored) == 0 || e.lset == nil {
+		return resetState{}, false
+	}
+	h := e.lset.Hash()
+	s, ok := c.restored[h]
+	if ok {
+		delete(c.restored, h)
+		seriesCacheRestored.Inc()
+	}
+	return s, ok
+}
@@ -0,0 +1,82 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+)
+
+func TestSeriesCache_resetState(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state", "series_cache")
+
+	newCache := func() *seriesCache {
+		cache := newSeriesCache(nil, nil, MetricTypePrefix, nil)
+		cache.opts.StateFile = stateFile
+		if err := cache.loadResetState(); err != nil {
+			t.Fatal(err)
+		}
+		cache.stripe(1).entries[1] = &seriesCacheEntry{lset: labels.FromStrings("__name__", "c1_total")}
+		cache.stripe(2).entries[2] = &seriesCacheEntry{lset: labels.FromStrings("__name__", "c2_total")}
+		cache.stripe(3).entries[3] = &seriesCacheEntry{lset: labels.FromStrings("__name__", "c3_total")}
+		return cache
+	}
+	// A missing state file is not an error.
+	cache := newCache()
+
+	// The first sample of each series only initializes the reset state. Series 3 never
+	// exports a point and has no state to persist.
+	for ref := 1; ref <= 3; ref++ {
+		if _, _, ok := cache.getResetAdjusted(storage.SeriesRef(ref), 1000, 10); ok {
+			t.Fatalf("expected first sample of series %d to be dropped", ref)
+		}
+	}
+	for ref := 1; ref <= 2; ref++ {
+		if rt, v, ok := cache.getResetAdjusted(storage.SeriesRef(ref), 2000, 15); !ok || rt != 1000 || v != 5 {
+			t.Fatalf("unexpected sample %d, %v, %t", rt, v, ok)
+		}
+	}
+	if err := cache.saveResetState(); err != nil {
+		t.Fatal(err)
+	}
+
+	// After a restart, series continue with their previous reset timestamp.
+	cache = newCache()
+	if rt, v, ok := cache.getResetAdjusted(1, 3000, 20); !ok || rt != 1000 || v != 10 {
+		t.Errorf("unexpected sample for continued series %d, %v, %t", rt, v, ok)
+	}
+	// Series that were reset while the exporter was not running start after the last point.
+	if rt, v, ok := cache.getResetAdjusted(2, 3000, 3); !ok || rt != 2000 || v != 3 {
+		t.Errorf("unexpected sample for reset series %d, %v, %t", rt, v, ok)
+	}
+	// Series without persisted state start over.
+	if _, _, ok := cache.getResetAdjusted(3, 3000, 20); ok {
+		t.Errorf("expected first sample of series without state to be dropped")
+	}
+	if len(cache.restored) != 0 {
+		t.Errorf("expected restored state to be consumed, got %v", cache.restored)
+	}
+
+	if err := os.WriteFile(stateFile, []byte("invalid"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.loadResetState(); err == nil {
+		t.Errorf("expected error for invalid state file")
+	}
+}
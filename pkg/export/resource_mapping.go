@@ -0,0 +1,133 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/prometheus/prometheus/model/labels"
+	monitoredres_pb "google.golang.org/genproto/googleapis/api/monitoredres"
+	"gopkg.in/yaml.v2"
+)
+
+// ResourceMapping writes series as a monitored resource type other than prometheus_target,
+// for example to attach them to the GCE or GKE resources that existing alerting policies
+// refer to.
+type ResourceMapping struct {
+	// Series matching at least one of the matchers are written with the mapping.
+	Matchers Matchers
+	// Type is the monitored resource type, e.g. gce_instance or k8s_container.
+	Type string
+	// Labels maps the labels of the monitored resource to the series labels their
+	// values are taken from. External labels are considered as well. The series
+	// labels are not written as metric labels.
+	// The project_id resource label is taken from the project_id label unless mapped
+	// explicitly.
+	Labels map[string]string
+}
+
+func (m *ResourceMapping) validate() error {
+	if m.Type == "" {
+		return fmt.Errorf("resource mapping is missing a monitored resource type")
+	}
+	if len(m.Matchers) == 0 {
+		return fmt.Errorf("resource mapping for type %q has no matchers", m.Type)
+	}
+	for name, label := range m.Labels {
+		if name == "" || label == "" {
+			return fmt.Errorf("resource mapping for type %q has an empty label %q=%q", m.Type, name, label)
+		}
+	}
+	return nil
+}
+
+// ReadResourceMappingsFile reads resource mappings from a YAML file of the form:
+//
+//	mappings:
+//	- match: ['{__name__=~"node_.*"}']
+//	  type: gce_instance
+//	  labels:
+//	    instance_id: instance_id
+//	    zone: location
+func ReadResourceMappingsFile(filename string) ([]ResourceMapping, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("read resource mappings file: %w", err)
+	}
+	var file struct {
+		Mappings []struct {
+			Match  []string          `yaml:"match"`
+			Type   string            `yaml:"type"`
+			Labels map[string]string `yaml:"labels"`
+		} `yaml:"mappings"`
+	}
+	if err := yaml.UnmarshalStrict(b, &file); err != nil {
+		return nil, fmt.Errorf("resource mappings file %q: %w", filename, err)
+	}
+	mappings := make([]ResourceMapping, 0, len(file.Mappings))
+	for _, e := range file.Mappings {
+		m := ResourceMapping{Type: e.Type, Labels: e.Labels}
+		for _, s := range e.Match {
+			if err := m.Matchers.Set(s); err != nil {
+				return nil, fmt.Errorf("resource mappings file %q: %w", filename, err)
+			}
+		}
+		mappings = append(mappings, m)
+	}
+	return mappings, nil
+}
+
+// mapResource returns the monitored resource and the remaining metric labels of the series
+// according to the first matching resource mapping. It returns false if no mapping matches.
+func mapResource(mappings []ResourceMapping, externalLabels, lset labels.Labels) (*monitoredres_pb.MonitoredResource, labels.Labels, bool, error) {
+	var mapping *ResourceMapping
+	for i := range mappings {
+		if mappings[i].Matchers.Matches(lset) {
+			mapping = &mappings[i]
+			break
+		}
+	}
+	if mapping == nil {
+		return nil, nil, false, nil
+	}
+	// Merge external labels with the same precedence as extractResource.
+	builder := labels.NewBuilder(lset)
+	for _, l := range externalLabels {
+		if !lset.Has(l.Name) {
+			builder.Set(l.Name, l.Value)
+		}
+	}
+	lset = builder.Labels(labels.EmptyLabels())
+
+	mres := &monitoredres_pb.MonitoredResource{
+		Type:   mapping.Type,
+		Labels: make(map[string]string, len(mapping.Labels)+1),
+	}
+	// The project_id label only determines the project and is never a metric label.
+	if _, ok := mapping.Labels[KeyProjectID]; !ok {
+		mres.Labels[KeyProjectID] = lset.Get(KeyProjectID)
+	}
+	builder.Del(KeyProjectID)
+	// Missing labels are set to an empty string and left to the API to validate.
+	for name, label := range mapping.Labels {
+		mres.Labels[name] = lset.Get(label)
+		builder.Del(label)
+	}
+	if mres.Labels[KeyProjectID] == "" {
+		return nil, nil, true, fmt.Errorf("missing required resource field %q", KeyProjectID)
+	}
+	return mres, builder.Labels(labels.EmptyLabels()), true, nil
+}
@@ -0,0 +1,141 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/prometheus/model/labels"
+	monitoredres_pb "google.golang.org/genproto/googleapis/api/monitoredres"
+	"google.golang.org/protobuf/testing/protocmp"
+)
+
+func TestReadResourceMappingsFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "mappings.yaml")
+	content := `
+mappings:
+- match: ['{__name__=~"node_.*"}']
+  type: gce_instance
+  labels:
+    instance_id: instance_id
+    zone: location
+`
+	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mappings, err := ReadResourceMappingsFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mappings) != 1 {
+		t.Fatalf("expected 1 mapping, got %d", len(mappings))
+	}
+	m := mappings[0]
+	if err := m.validate(); err != nil {
+		t.Fatal(err)
+	}
+	if m.Type != "gce_instance" || len(m.Matchers) != 1 {
+		t.Errorf("unexpected mapping %+v", m)
+	}
+	if diff := cmp.Diff(map[string]string{"instance_id": "instance_id", "zone": "location"}, m.Labels); diff != "" {
+		t.Errorf("unexpected labels (-want, +got): %s", diff)
+	}
+
+	if err := os.WriteFile(filename, []byte("mappings:\n- match: ['{']\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadResourceMappingsFile(filename); err == nil {
+		t.Errorf("expected error for invalid matcher")
+	}
+}
+
+func TestMapResource(t *testing.T) {
+	var mappings []ResourceMapping
+	for _, m := range []struct {
+		match  string
+		typ    string
+		labels map[string]string
+	}{
+		{`{__name__=~"node_.*"}`, "gce_instance", map[string]string{"instance_id": "node_id", "zone": "location"}},
+		{`{job="tenant"}`, "generic_task", map[string]string{"project_id": "tenant_project", "job": "job", "task_id": "instance"}},
+	} {
+		mapping := ResourceMapping{Type: m.typ, Labels: m.labels}
+		if err := mapping.Matchers.Set(m.match); err != nil {
+			t.Fatal(err)
+		}
+		mappings = append(mappings, mapping)
+	}
+	externalLabels := labels.FromStrings("project_id", "p1", "location", "l1", "cluster", "c1")
+
+	cases := []struct {
+		doc          string
+		seriesLabels labels.Labels
+		wantResource *monitoredres_pb.MonitoredResource
+		wantLabels   labels.Labels
+		wantMapped   bool
+		wantErr      bool
+	}{
+		{
+			doc:          "project from external labels",
+			seriesLabels: labels.FromStrings("__name__", "node_load1", "node_id", "123", "mode", "m1"),
+			wantResource: &monitoredres_pb.MonitoredResource{
+				Type:   "gce_instance",
+				Labels: map[string]string{"project_id": "p1", "instance_id": "123", "zone": "l1"},
+			},
+			wantLabels: labels.FromStrings("__name__", "node_load1", "cluster", "c1", "mode", "m1"),
+			wantMapped: true,
+		},
+		{
+			doc:          "explicit project mapping",
+			seriesLabels: labels.FromStrings("__name__", "up", "job", "tenant", "instance", "i1", "tenant_project", "p2"),
+			wantResource: &monitoredres_pb.MonitoredResource{
+				Type:   "generic_task",
+				Labels: map[string]string{"project_id": "p2", "job": "tenant", "task_id": "i1"},
+			},
+			wantLabels: labels.FromStrings("__name__", "up", "cluster", "c1", "location", "l1"),
+			wantMapped: true,
+		},
+		{
+			doc:          "mapped project must be set",
+			seriesLabels: labels.FromStrings("__name__", "up", "job", "tenant", "instance", "i1"),
+			wantMapped:   true,
+			wantErr:      true,
+		},
+		{
+			doc:          "no matching mapping",
+			seriesLabels: labels.FromStrings("__name__", "up", "job", "other"),
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.doc, func(t *testing.T) {
+			resource, lset, mapped, err := mapResource(mappings, externalLabels, c.seriesLabels)
+			if mapped != c.wantMapped {
+				t.Fatalf("expected mapped %v, got %v", c.wantMapped, mapped)
+			}
+			if c.wantErr != (err != nil) {
+				t.Fatalf("expected error %v, got %v", c.wantErr, err)
+			}
+			if diff := cmp.Diff(c.wantResource, resource, protocmp.Transform()); diff != "" {
+				t.Errorf("unexpected resource (-want, +got): %s", diff)
+			}
+			if diff := cmp.Diff(c.wantLabels, lset); diff != "" {
+				t.Errorf("unexpected labels (-want, +got): %s", diff)
+			}
+		})
+	}
+}
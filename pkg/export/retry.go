@@ -0,0 +1,218 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	gax "github.com/googleapis/gax-go/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	monitoring_pb "google.golang.org/genproto/googleapis/monitoring/v3"
+)
+
+var (
+	sendErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "gcm_export_send_errors_total",
+		Help: "Number of failed requests to the GCM API by whether the error is retryable or permanent.",
+	}, []string{"class"})
+	sendRetries = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "gcm_export_send_retries_total",
+		Help: "Number of retried requests to the GCM API.",
+	})
+	sendRetriesSkipped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "gcm_export_send_retries_skipped_total",
+		Help: "Number of failed requests with a retryable error that were not retried by the reason why.",
+	}, []string{"reason"})
+)
+
+// Classes of errors returned by the GCM API.
+const (
+	errorClassRetryable = "retryable"
+	errorClassPermanent = "permanent"
+)
+
+const (
+	// DefaultRetryInitialBackoff is the default backoff before the first retry.
+	DefaultRetryInitialBackoff = 100 * time.Millisecond
+	// DefaultRetryMaxBackoff is the default upper bound of the backoff between retries.
+	DefaultRetryMaxBackoff = 5 * time.Second
+	// DefaultRetryBudget is the default ratio of requests that may be retried.
+	DefaultRetryBudget = 0.1
+
+	// Number of retries that can be made in a burst if the retry budget was not
+	// used for a while.
+	retryBudgetBurst = 10
+)
+
+// RetryOpts represents exporter options for retrying failed requests to the GCM API.
+type RetryOpts struct {
+	// MaxAttempts is the maximum number of attempts per request, including the first
+	// one. Defaults to 1, i.e. requests are not retried.
+	MaxAttempts int
+	// InitialBackoff is the backoff before the first retry, which doubles with every
+	// further retry. A random jitter is applied to every backoff.
+	// Defaults to DefaultRetryInitialBackoff when 0.
+	InitialBackoff time.Duration
+	// MaxBackoff is the upper bound of the backoff between retries.
+	// Defaults to DefaultRetryMaxBackoff when 0.
+	MaxBackoff time.Duration
+	// Budget is the ratio of requests that may be retried across all requests. It
+	// bounds the additional load on the GCM API during outages.
+	// Defaults to DefaultRetryBudget when 0.
+	Budget float64
+}
+
+func (o *RetryOpts) validate() error {
+	if o.MaxAttempts == 0 {
+		o.MaxAttempts = 1
+	}
+	if o.MaxAttempts < 0 {
+		return fmt.Errorf("maximum retry attempts must be positive, got %d", o.MaxAttempts)
+	}
+	if o.InitialBackoff == 0 {
+		o.InitialBackoff = DefaultRetryInitialBackoff
+	}
+	if o.MaxBackoff == 0 {
+		o.MaxBackoff = DefaultRetryMaxBackoff
+	}
+	if o.InitialBackoff < 0 || o.InitialBackoff > o.MaxBackoff {
+		return fmt.Errorf("initial retry backoff must be between 0 and the maximum backoff %s, got %s", o.MaxBackoff, o.InitialBackoff)
+	}
+	if o.Budget == 0 {
+		o.Budget = DefaultRetryBudget
+	}
+	if o.Budget < 0 {
+		return fmt.Errorf("retry budget must not be negative, got %f", o.Budget)
+	}
+	return nil
+}
+
+// errorClass returns whether a request that failed with err may succeed if retried.
+func errorClass(err error) string {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return errorClassRetryable
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted, codes.Internal:
+		return errorClassRetryable
+	}
+	return errorClassPermanent
+}
+
+type sendFunc func(context.Context, *monitoring_pb.CreateTimeSeriesRequest, ...gax.CallOption) error
+
+// retrier retries requests to the GCM API that failed with a retryable error. Every
+// request adds a fraction of a token to the budget and every retry takes a whole one,
+// which limits the ratio of retried requests.
+// If a throttler is set, it decides whether attempts are made at all.
+type retrier struct {
+	opts      RetryOpts
+	throttler *throttler
+
+	mtx    sync.Mutex
+	tokens float64
+}
+
+func newRetrier(opts RetryOpts, throttler *throttler) *retrier {
+	return &retrier{opts: opts, throttler: throttler, tokens: retryBudgetBurst}
+}
+
+func (r *retrier) deposit() {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.tokens += r.opts.Budget
+	if r.tokens > retryBudgetBurst {
+		r.tokens = retryBudgetBurst
+	}
+}
+
+func (r *retrier) withdraw() bool {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if r.tokens < 1 {
+		return false
+	}
+	r.tokens--
+	return true
+}
+
+// wrap returns a sendFunc that retries requests of sendOne.
+func (r *retrier) wrap(sendOne sendFunc) sendFunc {
+	return func(ctx context.Context, req *monitoring_pb.CreateTimeSeriesRequest, opts ...gax.CallOption) error {
+		r.deposit()
+
+		bo := gax.Backoff{
+			Initial:    r.opts.InitialBackoff,
+			Max:        r.opts.MaxBackoff,
+			Multiplier: 2,
+		}
+		var lastErr error
+
+		for attempt := 1; ; attempt++ {
+			if r.throttler != nil {
+				priority := priorityRegular
+				if attempt > 1 {
+					priority = priorityLow
+				}
+				if !r.throttler.allow(priority) {
+					if lastErr == nil {
+						return errThrottled
+					}
+					sendRetriesSkipped.WithLabelValues("throttled").Inc()
+					return lastErr
+				}
+			}
+			err := sendOne(ctx, req, opts...)
+			if r.throttler != nil {
+				r.throttler.record(err)
+			}
+			lastErr = err
+			if err == nil {
+				return nil
+			}
+			class := errorClass(err)
+			sendErrors.WithLabelValues(class).Inc()
+
+			if class != errorClassRetryable {
+				return err
+			}
+			if attempt >= r.opts.MaxAttempts {
+				if r.opts.MaxAttempts > 1 {
+					sendRetriesSkipped.WithLabelValues("max-attempts").Inc()
+				}
+				return err
+			}
+			if !r.withdraw() {
+				sendRetriesSkipped.WithLabelValues("budget").Inc()
+				return err
+			}
+			// The request timeout also bounds the retries.
+			if gax.Sleep(ctx, bo.Pause()) != nil {
+				sendRetriesSkipped.WithLabelValues("timeout").Inc()
+				return err
+			}
+			sendRetries.Inc()
+		}
+	}
+}
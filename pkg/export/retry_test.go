@@ -0,0 +1,154 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	gax "github.com/googleapis/gax-go/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	monitoring_pb "google.golang.org/genproto/googleapis/monitoring/v3"
+)
+
+func TestErrorClass(t *testing.T) {
+	cases := []struct {
+		err  error
+		want string
+	}{
+		{err: status.Error(codes.Unavailable, "unavailable"), want: errorClassRetryable},
+		{err: status.Error(codes.ResourceExhausted, "quota"), want: errorClassRetryable},
+		{err: status.Error(codes.DeadlineExceeded, "timeout"), want: errorClassRetryable},
+		{err: fmt.Errorf("send: %w", context.DeadlineExceeded), want: errorClassRetryable},
+		{err: status.Error(codes.InvalidArgument, "out of order"), want: errorClassPermanent},
+		{err: status.Error(codes.PermissionDenied, "denied"), want: errorClassPermanent},
+		{err: errors.New("unknown"), want: errorClassPermanent},
+	}
+	for _, c := range cases {
+		if got := errorClass(c.err); got != c.want {
+			t.Errorf("expected class %q for %v, got %q", c.want, c.err, got)
+		}
+	}
+}
+
+func TestRetrier(t *testing.T) {
+	// failing returns a sendFunc that fails with err for the first n calls.
+	failing := func(n int, err error, calls *int) sendFunc {
+		return func(context.Context, *monitoring_pb.CreateTimeSeriesRequest, ...gax.CallOption) error {
+			*calls++
+			if *calls <= n {
+				return err
+			}
+			return nil
+		}
+	}
+	unavailable := status.Error(codes.Unavailable, "unavailable")
+
+	cases := []struct {
+		doc       string
+		opts      RetryOpts
+		failures  int
+		err       error
+		wantCalls int
+		wantErr   bool
+	}{
+		{
+			doc:       "retries disabled by default",
+			failures:  1,
+			err:       unavailable,
+			wantCalls: 1,
+			wantErr:   true,
+		}, {
+			doc:       "retry until success",
+			opts:      RetryOpts{MaxAttempts: 5},
+			failures:  2,
+			err:       unavailable,
+			wantCalls: 3,
+		}, {
+			doc:       "retry until max attempts",
+			opts:      RetryOpts{MaxAttempts: 3},
+			failures:  10,
+			err:       unavailable,
+			wantCalls: 3,
+			wantErr:   true,
+		}, {
+			doc:       "permanent errors are not retried",
+			opts:      RetryOpts{MaxAttempts: 5},
+			failures:  10,
+			err:       status.Error(codes.InvalidArgument, "invalid"),
+			wantCalls: 1,
+			wantErr:   true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.doc, func(t *testing.T) {
+			c.opts.InitialBackoff = time.Millisecond
+			if err := c.opts.validate(); err != nil {
+				t.Fatal(err)
+			}
+			var calls int
+			err := newRetrier(c.opts, nil).wrap(failing(c.failures, c.err, &calls))(context.Background(), nil)
+			if (err != nil) != c.wantErr {
+				t.Errorf("unexpected error %v", err)
+			}
+			if calls != c.wantCalls {
+				t.Errorf("expected %d calls, got %d", c.wantCalls, calls)
+			}
+		})
+	}
+}
+
+func TestRetrier_budget(t *testing.T) {
+	opts := RetryOpts{MaxAttempts: 2, InitialBackoff: time.Millisecond, Budget: 0.5}
+	if err := opts.validate(); err != nil {
+		t.Fatal(err)
+	}
+	r := newRetrier(opts, nil)
+
+	var calls int
+	send := r.wrap(func(context.Context, *monitoring_pb.CreateTimeSeriesRequest, ...gax.CallOption) error {
+		calls++
+		return status.Error(codes.Unavailable, "unavailable")
+	})
+	// Exhaust the initial burst of retries.
+	for i := 0; i < 100; i++ {
+		send(context.Background(), nil)
+	}
+	// Afterwards only every second request is retried.
+	calls = 0
+	for i := 0; i < 10; i++ {
+		send(context.Background(), nil)
+	}
+	if calls != 15 {
+		t.Errorf("expected 15 calls, got %d", calls)
+	}
+}
+
+func TestRetryOpts_validate(t *testing.T) {
+	for _, opts := range []RetryOpts{
+		{MaxAttempts: -1},
+		{InitialBackoff: time.Minute, MaxBackoff: time.Second},
+		{Budget: -1},
+	} {
+		if err := opts.validate(); err == nil {
+			t.Errorf("expected error for %+v", opts)
+		}
+	}
+}
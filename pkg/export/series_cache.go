@@ -21,14 +21,18 @@ import (
 	"fmt"
 	"hash"
 	"hash/fnv"
+	"math"
 	"math/rand"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/histogram"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/model/textparse"
 	"github.com/prometheus/prometheus/storage"
@@ -39,6 +43,71 @@ import (
 	monitoring_pb "google.golang.org/genproto/googleapis/monitoring/v3"
 )
 
+var (
+	seriesCacheEntries = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "gcm_export_series_cache_entries",
+		Help: "Number of series in the series cache.",
+	})
+	seriesCacheBytes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "gcm_export_series_cache_bytes",
+		Help: "Estimated memory used by the series in the series cache.",
+	})
+	seriesCacheEvictions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "gcm_export_series_cache_evictions_total",
+		Help: "Number of series evicted from the series cache by whether they were stale or evicted to stay within the size limits.",
+	}, []string{"reason"})
+)
+
+const (
+	// DefaultSeriesCacheStalenessPeriod is the default period after which unused series
+	// are considered stale and garbage collected.
+	DefaultSeriesCacheStalenessPeriod = 10 * time.Minute
+
+	// Estimated memory used by a series cache entry on top of its labels, which includes
+	// the entry itself, its map slot, and its share of the interned protos.
+	seriesCacheEntryOverhead = 512
+	// Ratio of the size limits the series cache is reduced to when one is exceeded, so
+	// that evictions happen in batches.
+	seriesCacheEvictionTarget = 0.9
+	// Number of stripes the entries of the series cache are split into. Samples of series
+	// in different stripes are processed without contending for the same lock.
+	seriesCacheStripes = 256
+)
+
+// SeriesCacheOpts represents exporter options for bounding the memory used by the
+// series cache.
+type SeriesCacheOpts struct {
+	// MaxEntries is the maximum number of series in the cache. Unlimited if 0.
+	MaxEntries int
+	// MaxBytes is the maximum estimated memory used by the series in the cache.
+	// Unlimited if 0.
+	MaxBytes int64
+	// StalenessPeriod is the period after which series without samples are considered
+	// stale. Stale series are garbage collected periodically and evicted first if a
+	// limit is exceeded. Defaults to DefaultSeriesCacheStalenessPeriod when 0.
+	StalenessPeriod time.Duration
+	// MaxSeriesPerMetric is the maximum number of active series per metric name. New
+	// series of a metric that reached the limit are dropped. Unlimited if 0.
+	MaxSeriesPerMetric int
+	// StateFile is a file the counter reset state of series is written to periodically.
+	// It is restored on startup so that restarts do not reset the start times of
+	// cumulative series. The state is not persisted if empty.
+	StateFile string
+}
+
+func (o *SeriesCacheOpts) validate() error {
+	if o.MaxEntries < 0 || o.MaxBytes < 0 || o.MaxSeriesPerMetric < 0 {
+		return fmt.Errorf("series cache limits must not be negative")
+	}
+	if o.StalenessPeriod == 0 {
+		o.StalenessPeriod = DefaultSeriesCacheStalenessPeriod
+	}
+	if o.StalenessPeriod < 0 {
+		return fmt.Errorf("series cache staleness period must be positive, got %s", o.StalenessPeriod)
+	}
+	return nil
+}
+
 // seriesCache holds a mapping from series reference to label set.
 // It can garbage collect obsolete entries based on the most recent WAL checkpoint.
 // Implements seriesGetter.
@@ -47,11 +116,32 @@ type seriesCache struct {
 	now    func() time.Time
 	pool   *pool
 
-	// Guards access to the entries and intervals maps and the lastRefresh
-	// field of individual cache entries.
+	// Guards the state shared by all series, e.g. the series counts and types of metrics
+	// and the size of the cache, and populating entries. If held together with the lock
+	// of a stripe, mtx must be acquired first.
 	mtx sync.Mutex
-	// Map from series reference to various cached information about it.
-	entries map[storage.SeriesRef]*seriesCacheEntry
+	// Entries of the series by series reference, split into stripes by the reference.
+	// Samples of cached series only acquire the lock of their stripe.
+	stripes [seriesCacheStripes]seriesCacheStripe
+	// Number of entries across all stripes.
+	numEntries int
+
+	// Guards the created and restored maps. It may be acquired while holding the lock
+	// of a stripe.
+	resetMtx sync.Mutex
+	// Map from created key to the most recent created timestamp in milliseconds
+	// reported by the OpenMetrics _created series of a counter, histogram, or summary.
+	created map[uint64]int64
+	// Counter reset state restored from the state file by the hash of the series labels.
+	// Entries are removed once their series is exported again or becomes stale.
+	restored map[uint64]resetState
+	// Number of admitted and limited series by metric name if a series limit per
+	// metric is set.
+	metricSeries  map[string]int
+	limitedSeries map[string]int
+	// Types of the active series by metric name and how conflicting types are handled.
+	metricTypes   map[string]*metricTypes
+	typeConflicts string
 
 	// Function to retrieve a label set for a series reference number.
 	// Returns nil if the reference is no longer valid.
@@ -61,9 +151,59 @@ type seriesCache struct {
 	// don't match at least one of the matchers.
 	// If the matchers are empty, all series pass.
 	matchers Matchers
+	// Optional filter of exported series by metric name, which applies in addition to
+	// the matchers.
+	metricNames *metricNameFilter
 
 	// Prefix under which metrics are written to GCM.
 	metricTypePrefix string
+
+	// Which series of summaries are written to GCM. All series are written if empty.
+	summaryMode string
+	// How untyped series are written to GCM.
+	untyped UntypedOpts
+	// Types of metrics whose series are populated without metadata.
+	metadata MetadataOpts
+	// Label whose value overrides the project series are written to.
+	projectLabel string
+	// Optional writer of metric descriptors for new metric types.
+	descriptors *descriptorWriter
+	// Optional writer of service level objectives for selected series.
+	slos *sloWriter
+	// Optional log of a sample of the points of dropped series.
+	drops *dropLog
+	// Optional sanitizer for metric labels that are not compatible with GCM.
+	sanitizer *labelSanitizer
+	// Mappings of series to monitored resource types other than prometheus_target.
+	resourceMappings []ResourceMapping
+	// Bucket limits of histograms and how gauge histograms are written.
+	histograms HistogramOpts
+	// Actions for dropping or transforming all series of a metric type.
+	typePolicy TypePolicyOpts
+	// How staleness markers are handled.
+	stalenessMode string
+	// Series matching at least one of the matchers are of high priority. No series
+	// are if empty.
+	priorityMatchers Matchers
+	// Number of entries whose last sample was a staleness marker.
+	stale atomic.Int64
+
+	// Size limits and staleness period of the cache.
+	opts SeriesCacheOpts
+	// Estimated memory used by all entries.
+	bytes int64
+}
+
+// seriesCacheStripe holds the entries of the series whose references map to it.
+type seriesCacheStripe struct {
+	// Guards the entries map and the state of its entries that changes with every
+	// sample, e.g. the counter reset state. Entries are only added, removed, and
+	// populated while holding the lock of the cache as well.
+	mtx     sync.Mutex
+	entries map[storage.SeriesRef]*seriesCacheEntry
+	// Pad the stripe to the size of a cache line so that the locks of adjacent stripes
+	// are not in the same one.
+	_ [48]byte
 }
 
 type seriesCacheEntry struct {
@@ -82,19 +222,49 @@ type seriesCacheEntry struct {
 	nextRefresh int64
 	// Unix timestamp at which the we last used the entry.
 	lastUsed int64
-	// Whether the series is dropped from exporting.
-	dropped bool
+	// Whether the series is dropped from exporting, and whether it is dropped because
+	// it does not pass the matchers or the metric name filter.
+	dropped, filtered bool
+	// Whether the series counts towards the series limit of its metric or is dropped
+	// because the limit was reached.
+	counted, limited bool
+	// Whether the last sample of the series was a staleness marker.
+	stale bool
+	// Metric name the type of the series is tracked under and the type it is written
+	// as. Whether the type conflicts with the type of the metric and the series is
+	// dropped because of it.
+	typeKey                   string
+	typ                       textparse.MetricType
+	typeConflict, typeDropped bool
+	// Type and action of the type policy applied to the series if it is not kept, and
+	// whether the series is dropped because of it.
+	policyType    textparse.MetricType
+	policyAction  string
+	policyDropped bool
+	// Key shared by the cumulative series of a metric and its _created series.
+	// It is zero if the series cannot have a created timestamp.
+	createdKey uint64
+	// Estimated memory used by the entry.
+	size int64
 
 	// Tracked counter reset state for conversion to GCM cumulatives.
 	hasReset       bool
 	resetValue     float64
 	lastValue      float64
 	resetTimestamp int64
+	// Timestamp of the last sample that was exported as a cumulative point.
+	lastTimestamp int64
+	// Tracked counter reset state of native histograms. The reset histogram is
+	// nil if the series was reset after it was first seen.
+	resetHistogram *histogram.FloatHistogram
+	lastHistogram  *histogram.FloatHistogram
 }
 
 type hashedSeries struct {
 	hash  uint64
 	proto *monitoring_pb.TimeSeries
+	// Whether the series is sent ahead of regular series.
+	priority bool
 }
 
 type cachedProtos struct {
@@ -112,15 +282,16 @@ const (
 
 // valid returns true if the Prometheus series can be converted to a GCM series.
 func (e *seriesCacheEntry) valid() bool {
-	return e.lset != nil && (e.dropped || !e.protos.empty())
+	return e.lset != nil && (e.dropped || e.suffix == metricSuffixCreated || !e.protos.empty())
 }
 
 // shouldRefresh returns true if the cached state should be refreshed.
 func (e *seriesCacheEntry) shouldRefresh() bool {
-	// Matchers cannot be changed at runtime and are applied to the local time series labels
-	// without external labels. Thus the dropped status can never change at runtime and thus
-	// no refresh is required.
-	return !e.dropped && time.Now().Unix() > e.nextRefresh
+	// Matchers are applied to the local time series labels without external labels. Thus the
+	// dropped status only changes if the matchers are changed, which updates it directly, and
+	// no refresh is required. Series dropped by the series limit or for a type conflict
+	// are reconsidered.
+	return (!e.dropped || e.limited || e.typeDropped) && time.Now().Unix() > e.nextRefresh
 }
 
 // setNextRefresh determines a timestamp for the next refresh.
@@ -141,13 +312,53 @@ func newSeriesCache(
 	if logger == nil {
 		logger = log.NewNopLogger()
 	}
-	return &seriesCache{
+	if reg != nil {
+		reg.MustRegister(seriesCacheEntries, seriesCacheBytes, seriesCacheEvictions, seriesCacheRestored, seriesLimited, staleSeries, metricTypeConflicts, typePolicySeries)
+	}
+	c := &seriesCache{
 		logger:           logger,
 		now:              time.Now,
 		pool:             newPool(reg),
-		entries:          map[storage.SeriesRef]*seriesCacheEntry{},
+		created:          map[uint64]int64{},
+		metricSeries:     map[string]int{},
+		limitedSeries:    map[string]int{},
+		metricTypes:      map[string]*metricTypes{},
+		typeConflicts:    TypeConflictFork,
+		histograms:       HistogramOpts{GaugeMode: GaugeHistogramModeDistribution},
 		matchers:         matchers,
 		metricTypePrefix: metricTypePrefix,
+		opts:             SeriesCacheOpts{StalenessPeriod: DefaultSeriesCacheStalenessPeriod},
+	}
+	for i := range c.stripes {
+		c.stripes[i].entries = map[storage.SeriesRef]*seriesCacheEntry{}
+	}
+	return c
+}
+
+// stripe returns the stripe holding the entry of the series.
+func (c *seriesCache) stripe(ref storage.SeriesRef) *seriesCacheStripe {
+	return &c.stripes[uint64(ref)%seriesCacheStripes]
+}
+
+// entry returns the entry of the series or nil if it is not cached.
+func (c *seriesCache) entry(ref storage.SeriesRef) *seriesCacheEntry {
+	s := c.stripe(ref)
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return s.entries[ref]
+}
+
+// each calls f for every entry while holding the lock of its stripe. Entries may be
+// removed from within f if mtx is held.
+func (c *seriesCache) each(f func(storage.SeriesRef, *seriesCacheEntry)) {
+	for i := range c.stripes {
+		s := &c.stripes[i]
+		s.mtx.Lock()
+		for ref, e := range s.entries {
+			f(ref, e)
+		}
+		s.mtx.Unlock()
 	}
 }
 
@@ -155,14 +366,30 @@ func (c *seriesCache) run(ctx context.Context) {
 	tick := time.NewTicker(10 * time.Minute)
 	defer tick.Stop()
 
+	var savec <-chan time.Time
+	if c.opts.StateFile != "" {
+		saveTick := time.NewTicker(resetStateSaveInterval)
+		defer saveTick.Stop()
+		savec = saveTick.C
+	}
+	save := func() {
+		if err := c.saveResetState(); err != nil {
+			level.Error(c.logger).Log("msg", "saving counter reset state failed", "err", err)
+		}
+	}
 	for {
 		select {
 		case <-ctx.Done():
+			if c.opts.StateFile != "" {
+				save()
+			}
 			return
 		case <-tick.C:
-			if err := c.garbageCollect(10 * time.Minute); err != nil {
+			if err := c.garbageCollect(c.opts.StalenessPeriod); err != nil {
 				level.Error(c.logger).Log("msg", "garbage collection failed", "err", err)
 			}
+		case <-savec:
+			save()
 		}
 	}
 }
@@ -170,13 +397,50 @@ func (c *seriesCache) run(ctx context.Context) {
 // forceRefresh forces all series to be reconstructed on the next sample. This will not
 // invalidate counter reset state.
 func (c *seriesCache) forceRefresh() {
+	// Set next refresh to the zero timestamp to trigger a refresh.
+	c.each(func(_ storage.SeriesRef, e *seriesCacheEntry) {
+		e.nextRefresh = 0
+	})
+}
+
+// setMatchers replaces the matchers and updates whether cached series are dropped.
+// It returns false if the matchers did not change.
+func (c *seriesCache) setMatchers(matchers Matchers) bool {
 	c.mtx.Lock()
 	defer c.mtx.Unlock()
 
-	// Set next refresh to the zero timestamp to trigger a refresh.
-	for _, e := range c.entries {
-		e.nextRefresh = 0
+	if c.matchers.String() == matchers.String() {
+		return false
 	}
+	c.matchers = matchers
+
+	c.each(func(_ storage.SeriesRef, e *seriesCacheEntry) {
+		if e.lset == nil {
+			return
+		}
+		e.filtered = !c.exported(e.lset)
+		dropped := e.limited || e.filtered
+		if dropped && !e.dropped {
+			c.pool.release(e.protos.gauge.proto)
+			c.pool.release(e.protos.cumulative.proto)
+			e.protos = cachedProtos{}
+			c.releaseType(e)
+		}
+		e.dropped = dropped
+		if !dropped && !e.counted {
+			c.admit(e)
+		}
+		// Series that are no longer dropped must be populated. Series that were dropped
+		// for other reasons than the matchers are dropped again on refresh.
+		e.nextRefresh = 0
+	})
+	return true
+}
+
+// exported returns whether the series passes the matchers and the metric name filter.
+// Must be called with mtx held.
+func (c *seriesCache) exported(lset labels.Labels) bool {
+	return c.matchers.Matches(lset) && c.metricNames.allowed(lset.Get(labels.MetricName))
 }
 
 // clear the entire cache state.
@@ -184,11 +448,99 @@ func (c *seriesCache) clear() {
 	c.mtx.Lock()
 	defer c.mtx.Unlock()
 
-	for ref, entry := range c.entries {
-		c.pool.release(entry.protos.gauge.proto)
-		c.pool.release(entry.protos.cumulative.proto)
-		delete(c.entries, ref)
+	c.each(c.remove)
+
+	c.resetMtx.Lock()
+	for key := range c.created {
+		delete(c.created, key)
 	}
+	c.restored = nil
+	c.resetMtx.Unlock()
+
+	c.updateSizeMetrics()
+}
+
+// remove the entry of the series from the cache and release its resources.
+// Must be called with mtx and the lock of the entry's stripe held.
+func (c *seriesCache) remove(ref storage.SeriesRef, entry *seriesCacheEntry) {
+	c.pool.release(entry.protos.gauge.proto)
+	c.pool.release(entry.protos.cumulative.proto)
+	if entry.suffix == metricSuffixCreated {
+		c.resetMtx.Lock()
+		delete(c.created, entry.createdKey)
+		c.resetMtx.Unlock()
+	}
+	c.release(entry)
+	c.releaseType(entry)
+	c.setPolicyAction(entry, "", TypePolicyKeep)
+	c.setStale(entry, false)
+	c.bytes -= entry.size
+	c.numEntries--
+	delete(c.stripe(ref).entries, ref)
+}
+
+// updateSizeMetrics sets the metrics for the current size of the cache.
+// Must be called with mtx held.
+func (c *seriesCache) updateSizeMetrics() {
+	seriesCacheEntries.Set(float64(c.numEntries))
+	seriesCacheBytes.Set(float64(c.bytes))
+}
+
+// exceedsLimits returns whether the cache holds more entries or uses more memory than
+// the given ratio of its limits allows. Must be called with mtx held.
+func (c *seriesCache) exceedsLimits(ratio float64) bool {
+	if c.opts.MaxEntries > 0 && float64(c.numEntries) > ratio*float64(c.opts.MaxEntries) {
+		return true
+	}
+	return c.opts.MaxBytes > 0 && float64(c.bytes) > ratio*float64(c.opts.MaxBytes)
+}
+
+// evict removes entries until the cache is within seriesCacheEvictionTarget of its limits.
+// Stale entries are removed first and the least recently used ones after that. Evicting a
+// series that is still in use loses its counter reset state, so the next sample is dropped
+// as for a new series. The series with the given reference is never evicted.
+// Must be called with mtx held.
+func (c *seriesCache) evict(keep storage.SeriesRef) {
+	start := c.now()
+	staleBefore := start.Add(-c.opts.StalenessPeriod).Unix()
+
+	type candidate struct {
+		ref      storage.SeriesRef
+		lastUsed int64
+	}
+	candidates := make([]candidate, 0, c.numEntries)
+	c.each(func(ref storage.SeriesRef, e *seriesCacheEntry) {
+		if ref != keep {
+			candidates = append(candidates, candidate{ref: ref, lastUsed: e.lastUsed})
+		}
+	})
+	// The least recently used entries come first, which includes all stale ones.
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].lastUsed < candidates[j].lastUsed
+	})
+	var stale, active int
+	for _, cand := range candidates {
+		if !c.exceedsLimits(seriesCacheEvictionTarget) {
+			break
+		}
+		s := c.stripe(cand.ref)
+		s.mtx.Lock()
+		// Entries are only removed with mtx held but may have been used since they were
+		// collected.
+		entry := s.entries[cand.ref]
+		if entry.lastUsed < staleBefore {
+			stale++
+		} else {
+			active++
+		}
+		c.remove(cand.ref, entry)
+		s.mtx.Unlock()
+	}
+	seriesCacheEvictions.WithLabelValues("stale").Add(float64(stale))
+	seriesCacheEvictions.WithLabelValues("capacity").Add(float64(active))
+	c.updateSizeMetrics()
+
+	level.Debug(c.logger).Log("msg", "series cache eviction completed", "took", time.Since(start), "stale", stale, "active", active)
 }
 
 // garbageCollect drops obsolete cache entries that have not been updated for
@@ -209,33 +561,69 @@ func (c *seriesCache) garbageCollect(delay time.Duration) error {
 	deleteBefore := start.Add(-delay).Unix()
 	i := 0
 
-	for ref, entry := range c.entries {
+	c.each(func(ref storage.SeriesRef, entry *seriesCacheEntry) {
 		if entry.lastUsed >= deleteBefore {
-			continue
+			return
 		}
-		c.pool.release(entry.protos.gauge.proto)
-		c.pool.release(entry.protos.cumulative.proto)
-		delete(c.entries, ref)
+		c.remove(ref, entry)
 		i++
+	})
+	c.resetMtx.Lock()
+	for h, s := range c.restored {
+		if s.LastTimestamp/1000 < deleteBefore {
+			delete(c.restored, h)
+		}
 	}
+	c.resetMtx.Unlock()
+
+	seriesCacheEvictions.WithLabelValues("stale").Add(float64(i))
+	c.updateSizeMetrics()
 	level.Info(c.logger).Log("msg", "garbage collection completed", "took", time.Since(start), "seriesPurged", i)
 
 	return nil
 }
 
+// getExportedLabels returns the cached labels of the series if it is valid and passes
+// the matchers and the metric name filter. It returns nil otherwise.
+func (c *seriesCache) getExportedLabels(ref storage.SeriesRef) labels.Labels {
+	s := c.stripe(ref)
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if e, ok := s.entries[ref]; ok && e.valid() && !e.filtered {
+		return e.lset
+	}
+	return nil
+}
+
 // get a cache entry for the given series reference. The passed timestamp indicates when data was
 // last seen for the entry.
 // If the series cannot be converted the returned boolean is false.
 func (c *seriesCache) get(s record.RefSample, externalLabels labels.Labels, metadata MetadataFunc) (*seriesCacheEntry, bool) {
+	ref := storage.SeriesRef(s.Ref)
+	stripe := c.stripe(ref)
+
+	// Most samples are of cached series that need no refresh and only require the lock
+	// of their stripe.
+	stripe.mtx.Lock()
+	if e, ok := stripe.entries[ref]; ok && !e.shouldRefresh() {
+		c.use(e, s.T)
+		valid := e.valid()
+		stripe.mtx.Unlock()
+		return e, valid
+	}
+	stripe.mtx.Unlock()
+
 	c.mtx.Lock()
 	defer c.mtx.Unlock()
+	stripe.mtx.Lock()
 
-	ref := storage.SeriesRef(s.Ref)
-
-	e, ok := c.entries[ref]
+	// The entry may have been added or refreshed while no lock was held.
+	e, ok := stripe.entries[ref]
 	if !ok {
 		e = &seriesCacheEntry{}
-		c.entries[ref] = e
+		stripe.entries[ref] = e
+		c.numEntries++
 	}
 	if e.shouldRefresh() {
 		if err := c.populate(ref, e, externalLabels, metadata); err != nil {
@@ -243,24 +631,67 @@ func (c *seriesCache) get(s record.RefSample, externalLabels labels.Labels, meta
 		}
 		e.setNextRefresh()
 	}
+	c.use(e, s.T)
+	valid := e.valid()
+	stripe.mtx.Unlock()
+
+	if !ok {
+		if c.exceedsLimits(1) {
+			c.evict(ref)
+		} else {
+			c.updateSizeMetrics()
+		}
+	}
+	return e, valid
+}
+
+// use records that a sample with the given timestamp was seen for the series.
+// Must be called with the lock of the entry's stripe held.
+func (c *seriesCache) use(e *seriesCacheEntry, t int64) {
 	// Store millisecond sample timestamp in seconds.
-	e.lastUsed = s.T / 1000
-	return e, e.valid()
+	e.lastUsed = t / 1000
+	c.setStale(e, false)
 }
 
 // getResetAdjusted takes a sample for a referenced series and returns
 // its reset timestamp and adjusted value.
 // If the last return argument is false, the sample should be dropped.
 func (c *seriesCache) getResetAdjusted(ref storage.SeriesRef, t int64, v float64) (int64, float64, bool) {
-	c.mtx.Lock()
-	e, ok := c.entries[ref]
-	c.mtx.Unlock()
+	s := c.stripe(ref)
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	e, ok := s.entries[ref]
 	if !ok {
 		return 0, 0, false
 	}
+	ct, hasCreated := c.getCreated(e, t)
+
 	hasReset := e.hasReset
 	e.hasReset = true
 	if !hasReset {
+		if hasCreated {
+			// The created timestamp tells us exactly over which window the current cumulative
+			// value was built up, so the sample can be used right away.
+			e.resetTimestamp = ct
+			e.resetValue = 0
+			e.lastValue = v
+			e.lastTimestamp = t
+			return e.resetTimestamp, v, true
+		}
+		if s, ok := c.restoreResetState(e); ok && t > s.LastTimestamp {
+			// Continue the cumulative series of the previous run. If the value decreased,
+			// the series was reset after the last exported point.
+			e.resetTimestamp = s.ResetTimestamp
+			e.resetValue = s.ResetValue
+			if v < s.LastValue {
+				e.resetTimestamp = s.LastTimestamp
+				e.resetValue = 0
+			}
+			e.lastValue = v
+			e.lastTimestamp = t
+			return e.resetTimestamp, v - e.resetValue, true
+		}
 		e.resetTimestamp = t
 		e.resetValue = v
 		// If we just initialized the reset timestamp, this sample should be skipped.
@@ -279,7 +710,15 @@ func (c *seriesCache) getResetAdjusted(ref storage.SeriesRef, t int64, v float64
 		// more sophisticated state management.
 		return 0, 0, false
 	}
-	if v < e.lastValue {
+	if hasCreated && (e.lastTimestamp == 0 || ct > e.lastTimestamp) {
+		// Switch to the created timestamp if no point was written yet or if it is newer
+		// than the last written point, which means the series was reset.
+		// Series whose created timestamp only appears after points were written, e.g.
+		// after the target started exposing it, keep their start time until the next reset
+		// as moving it back would overlap with the written points.
+		e.resetValue = 0
+		e.resetTimestamp = ct
+	} else if v < e.lastValue {
 		// If the series was reset, set the reset timestamp to be one millisecond
 		// before the timestamp of the current sample.
 		// We don't know the true reset time but this ensures the range is non-zero
@@ -288,21 +727,111 @@ func (c *seriesCache) getResetAdjusted(ref storage.SeriesRef, t int64, v float64
 		e.resetTimestamp = t - 1
 	}
 	e.lastValue = v
+	e.lastTimestamp = t
 
 	return e.resetTimestamp, v - e.resetValue, true
 }
 
-// getMetricType creates a GCM metric type from the Prometheus metric name and a type suffix.
+// getCreated returns the created timestamp for the cumulative series of the entry if one
+// was reported and it lies before the given sample timestamp.
+// Must be called with the lock of the entry's stripe held.
+func (c *seriesCache) getCreated(e *seriesCacheEntry, t int64) (int64, bool) {
+	if e.createdKey == 0 {
+		return 0, false
+	}
+	c.resetMtx.Lock()
+	ct, ok := c.created[e.createdKey]
+	c.resetMtx.Unlock()
+
+	return ct, ok && ct < t
+}
+
+// setCreated records the value of a _created series as the created timestamp of the
+// cumulative series of its metric. The value is the created time in seconds.
+func (c *seriesCache) setCreated(e *seriesCacheEntry, v float64) {
+	if math.IsNaN(v) || v <= 0 {
+		return
+	}
+	c.resetMtx.Lock()
+	c.created[e.createdKey] = int64(v * 1000)
+	c.resetMtx.Unlock()
+}
+
+// summarySeriesExported returns whether a summary series with the given metric name
+// suffix is written in the configured summary mode.
+func (c *seriesCache) summarySeriesExported(suffix metricSuffix) bool {
+	quantile := suffix == metricSuffixNone
+
+	switch c.summaryMode {
+	case SummaryModeQuantiles:
+		return quantile
+	case SummaryModeCountSum:
+		return !quantile
+	case SummaryModeDrop:
+		return false
+	}
+	return true
+}
+
+// getCreatedKey returns the key that matches the cumulative series of a metric with its
+// _created series. It is derived from the series labels with the metric name set to the
+// base name of the metric and without the histogram bucket label.
+func getCreatedKey(lset labels.Labels, baseMetricName string) uint64 {
+	b := labels.NewBuilder(lset)
+	b.Set(labels.MetricName, baseMetricName)
+	b.Del(labels.BucketLabel)
+	return b.Labels(labels.EmptyLabels()).Hash()
+}
+
+// getResetAdjustedHistogram takes a native histogram sample for a referenced series and
+// returns its reset timestamp and adjusted histogram. It follows the same logic as
+// getResetAdjusted.
+// If the last return argument is false, the sample should be dropped.
+func (c *seriesCache) getResetAdjustedHistogram(ref storage.SeriesRef, t int64, h *histogram.FloatHistogram) (int64, *histogram.FloatHistogram, bool) {
+	s := c.stripe(ref)
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	e, ok := s.entries[ref]
+	if !ok {
+		return 0, nil, false
+	}
+	hasReset := e.hasReset
+	e.hasReset = true
+	if !hasReset {
+		e.resetTimestamp = t
+		e.resetHistogram = h
+		e.lastHistogram = h
+		return 0, nil, false
+	} else if t <= e.resetTimestamp {
+		return 0, nil, false
+	}
+	if h.DetectReset(e.lastHistogram) {
+		e.resetHistogram = nil
+		e.resetTimestamp = t - 1
+	}
+	e.lastHistogram = h
+
+	if e.resetHistogram == nil {
+		return e.resetTimestamp, h, true
+	}
+	// The schema of a histogram cannot increase and its zero threshold cannot decrease
+	// without a detected reset. This satisfies the preconditions of the subtraction.
+	return e.resetTimestamp, h.Copy().Sub(e.resetHistogram), true
+}
+
+// getMetricType creates a GCM metric type under the prefix from the Prometheus metric name and
+// a type suffix.
 // Optionally, a secondary type suffix may be provided for series for which a Prometheus type
 // may be written as different GCM series.
 // The general rule is that if the primary suffix is ambigious about whether the specific series
 // is to be treated as a counter or gauge at query time, the secondarySuffix is set to "counter"
 // for the counter variant, and left empty for the gauge variant.
-func (c *seriesCache) getMetricType(name string, suffix, secondarySuffix gcmMetricSuffix) string {
+func getMetricType(prefix, name string, suffix, secondarySuffix gcmMetricSuffix) string {
 	if secondarySuffix == gcmMetricSuffixNone {
-		return fmt.Sprintf("%s/%s/%s", c.metricTypePrefix, name, suffix)
+		return fmt.Sprintf("%s/%s/%s", prefix, name, suffix)
 	}
-	return fmt.Sprintf("%s/%s/%s:%s", c.metricTypePrefix, name, suffix, secondarySuffix)
+	return fmt.Sprintf("%s/%s/%s:%s", prefix, name, suffix, secondarySuffix)
 }
 
 // Metric name suffixes used by various Prometheus metric types.
@@ -314,6 +843,11 @@ const (
 	metricSuffixBucket metricSuffix = "_bucket"
 	metricSuffixSum    metricSuffix = "_sum"
 	metricSuffixCount  metricSuffix = "_count"
+	// OpenMetrics series holding the sum and count of gauge histograms.
+	metricSuffixGSum   metricSuffix = "_gsum"
+	metricSuffixGCount metricSuffix = "_gcount"
+	// OpenMetrics series holding the created timestamp of counters, histograms, and summaries.
+	metricSuffixCreated metricSuffix = "_created"
 )
 
 // Suffixes appended to GCM metric types. They are equivalent to the respective
@@ -328,25 +862,51 @@ const (
 	gcmMetricSuffixCounter   gcmMetricSuffix = "counter"
 	gcmMetricSuffixHistogram gcmMetricSuffix = "histogram"
 	gcmMetricSuffixSummary   gcmMetricSuffix = "summary"
+
+	gcmMetricSuffixGaugeHistogram gcmMetricSuffix = "gaugehistogram"
 )
 
 // Maximum number of labels allowed on GCM series.
 const maxLabelCount = 100
 
-// populate cached state for the given entry.
+// populate cached state for the given entry. If getMetadata is nil, the metadata is
+// derived from the series labels.
+// Must be called with mtx and the lock of the entry's stripe held.
 func (c *seriesCache) populate(ref storage.SeriesRef, entry *seriesCacheEntry, externalLabels labels.Labels, getMetadata MetadataFunc) error {
 	if entry.lset == nil {
 		entry.lset = c.getLabelsByRef(ref)
 		if entry.lset == nil {
 			return errors.New("series reference invalid")
 		}
-		entry.dropped = !c.matchers.Matches(entry.lset)
+		entry.size = seriesCacheEntryOverhead
+		for _, l := range entry.lset {
+			entry.size += int64(len(l.Name) + len(l.Value))
+		}
+		c.bytes += entry.size
+		entry.filtered = !c.exported(entry.lset)
+		entry.dropped = entry.filtered
+		if !entry.dropped {
+			c.admit(entry)
+		}
+	} else if entry.limited {
+		c.admit(entry)
+	}
+	// Series dropped for a type conflict or by the type policy are reconsidered as the
+	// type of their metric may have changed.
+	if entry.typeDropped || entry.policyDropped {
+		entry.policyDropped = false
+		entry.dropped = entry.limited || entry.filtered
 	}
 	if entry.dropped {
+		c.releaseType(entry)
 		return nil
 	}
 	// Break the series into resource and metric labels.
-	resource, metricLabels, err := extractResource(externalLabels, entry.lset)
+	lset := routeProject(entry.lset, c.projectLabel)
+	resource, metricLabels, ok, err := mapResource(c.resourceMappings, externalLabels, lset)
+	if !ok {
+		resource, metricLabels, err = extractResource(externalLabels, lset)
+	}
 	if err != nil {
 		return fmt.Errorf("extracting resource for series %s failed: %w", entry.lset, err)
 	}
@@ -358,6 +918,22 @@ func (c *seriesCache) populate(ref storage.SeriesRef, entry *seriesCacheEntry, e
 			break
 		}
 	}
+	// The metric type prefix may be overridden per series, e.g. through a relabeling
+	// rule generated for a PodMonitoring. The label itself is not written.
+	prefix := c.metricTypePrefix
+	for i, l := range metricLabels {
+		if l.Name == KeyMetricTypePrefix {
+			if err := ValidateMetricTypePrefix(l.Value); err != nil {
+				return err
+			}
+			prefix = l.Value
+			metricLabels = append(metricLabels[:i], metricLabels[i+1:]...)
+			break
+		}
+	}
+	if c.sanitizer != nil {
+		metricLabels = c.sanitizer.sanitize(entry.lset.Get("__name__"), metricLabels)
+	}
 	// Drop series with too many labels.
 	// TODO: remove once field limit is lifted in the GCM API.
 	if len(metricLabels) > maxLabelCount {
@@ -368,9 +944,11 @@ func (c *seriesCache) populate(ref storage.SeriesRef, entry *seriesCacheEntry, e
 		metricName     = entry.lset.Get("__name__")
 		baseMetricName = metricName
 		suffix         metricSuffix
+		metadata       MetricMetadata
 	)
-	metadata, ok := getMetadata(metricName)
-	if !ok {
+	if getMetadata == nil {
+		metadata, baseMetricName, suffix = c.heuristicMetadata(entry.lset)
+	} else if metadata, ok = getMetadata(metricName); !ok {
 		// The full name didn't turn anything up. Check again in case it's a summary
 		// or histogram without the metric name suffix. If the underlying target
 		// returned the OpenMetrics format, counter metadata is also stored with the
@@ -383,9 +961,51 @@ func (c *seriesCache) populate(ref storage.SeriesRef, entry *seriesCacheEntry, e
 			return fmt.Errorf("no metadata found for metric name %q", metricName)
 		}
 	}
+	if metadata.Type == textparse.MetricTypeSummary && !c.summarySeriesExported(suffix) {
+		// The summary mode cannot be changed at runtime, so the series can be dropped
+		// the same way as series that don't pass the matchers.
+		c.pool.release(entry.protos.gauge.proto)
+		c.pool.release(entry.protos.cumulative.proto)
+		entry.protos = cachedProtos{}
+		entry.dropped = true
+		c.releaseType(entry)
+		return nil
+	}
+	var countSum bool
+	if suffix != metricSuffixCreated {
+		typ, ok := c.resolveType(entry, c.typeKey(metricName, baseMetricName, metadata.Type), metadata.Type)
+		if !ok {
+			c.pool.release(entry.protos.gauge.proto)
+			c.pool.release(entry.protos.cumulative.proto)
+			entry.protos = cachedProtos{}
+			entry.dropped = true
+			return nil
+		}
+		metadata.Type = typ
+
+		action := c.policyAction(metadata.Type, baseMetricName)
+		c.setPolicyAction(entry, metadata.Type, action)
+
+		// Only the count and sum series of histograms and summaries are written with
+		// TypePolicyCountSum.
+		if action == TypePolicyDrop || (action == TypePolicyCountSum && suffix != metricSuffixCount && suffix != metricSuffixSum) {
+			c.pool.release(entry.protos.gauge.proto)
+			c.pool.release(entry.protos.cumulative.proto)
+			entry.protos = cachedProtos{}
+			entry.dropped = true
+			entry.policyDropped = true
+			c.releaseType(entry)
+			return nil
+		}
+		countSum = action == TypePolicyCountSum
+	}
+	// Gauge histograms are written as distributions, unless they are configured to be
+	// written as separate gauges.
+	gaugeDistribution := metadata.Type == textparse.MetricTypeGaugeHistogram && c.histograms.GaugeMode == GaugeHistogramModeDistribution
+
 	// Handle label modifications for histograms early so we don't build the label map twice.
 	// We have to remove the 'le' label which defines the bucket boundary.
-	if metadata.Type == textparse.MetricTypeHistogram {
+	if metadata.Type == textparse.MetricTypeHistogram || gaugeDistribution {
 		for i, l := range metricLabels {
 			if l.Name == "le" {
 				metricLabels = append(metricLabels[:i], metricLabels[i+1:]...)
@@ -394,6 +1014,10 @@ func (c *seriesCache) populate(ref storage.SeriesRef, entry *seriesCacheEntry, e
 		}
 	}
 
+	// Series selected by service level objectives are of high priority as well once
+	// priority lanes are enabled.
+	priority := len(c.priorityMatchers) > 0 && (c.priorityMatchers.Matches(entry.lset) || c.slos.selects(entry.lset))
+
 	newSeries := func(mtype string, kind metric_pb.MetricDescriptor_MetricKind, vtype metric_pb.MetricDescriptor_ValueType) hashedSeries {
 		s := &monitoring_pb.TimeSeries{
 			Resource:   resource,
@@ -401,50 +1025,87 @@ func (c *seriesCache) populate(ref storage.SeriesRef, entry *seriesCacheEntry, e
 			MetricKind: kind,
 			ValueType:  vtype,
 		}
-		return hashedSeries{hash: hashSeries(s), proto: s}
+		return hashedSeries{hash: hashSeries(s), proto: s, priority: priority}
 	}
 	var protos cachedProtos
 
+	// The _created series of a metric is not written itself but provides the start time
+	// of the metric's cumulative series.
+	if suffix == metricSuffixCreated {
+		switch metadata.Type {
+		case textparse.MetricTypeCounter, textparse.MetricTypeHistogram, textparse.MetricTypeSummary:
+		default:
+			return fmt.Errorf("unexpected metric name suffix %q for metric %q", suffix, metricName)
+		}
+		c.pool.release(entry.protos.gauge.proto)
+		c.pool.release(entry.protos.cumulative.proto)
+
+		entry.protos = protos
+		entry.metadata = metadata
+		entry.suffix = suffix
+		entry.createdKey = getCreatedKey(entry.lset, baseMetricName)
+		return nil
+	}
+	var createdKey uint64
+
 	switch metadata.Type {
 	case textparse.MetricTypeCounter:
+		createdKey = getCreatedKey(entry.lset, strings.TrimSuffix(baseMetricName, string(metricSuffixTotal)))
 		protos.cumulative = newSeries(
-			c.getMetricType(metricName, gcmMetricSuffixCounter, gcmMetricSuffixNone),
+			getMetricType(prefix, metricName, gcmMetricSuffixCounter, gcmMetricSuffixNone),
 			metric_pb.MetricDescriptor_CUMULATIVE,
 			metric_pb.MetricDescriptor_DOUBLE)
 
 	case textparse.MetricTypeGauge:
 		protos.gauge = newSeries(
-			c.getMetricType(metricName, gcmMetricSuffixGauge, gcmMetricSuffixNone),
+			getMetricType(prefix, metricName, gcmMetricSuffixGauge, gcmMetricSuffixNone),
 			metric_pb.MetricDescriptor_GAUGE,
 			metric_pb.MetricDescriptor_DOUBLE)
 
 	case textparse.MetricTypeUnknown:
+		mode := c.untyped.mode(entry.lset)
+		if entry.protos.empty() {
+			untypedSeries.WithLabelValues(mode).Inc()
+		}
+		if mode == UntypedModeGauge {
+			gaugeSuffix := gcmMetricSuffixUnknown
+			if c.untyped.GaugeSuffix == UntypedGaugeSuffixGauge {
+				gaugeSuffix = gcmMetricSuffixGauge
+			}
+			protos.gauge = newSeries(
+				getMetricType(prefix, metricName, gaugeSuffix, gcmMetricSuffixNone),
+				metric_pb.MetricDescriptor_GAUGE,
+				metric_pb.MetricDescriptor_DOUBLE)
+			break
+		}
 		protos.gauge = newSeries(
-			c.getMetricType(metricName, gcmMetricSuffixUnknown, gcmMetricSuffixNone),
+			getMetricType(prefix, metricName, gcmMetricSuffixUnknown, gcmMetricSuffixNone),
 			metric_pb.MetricDescriptor_GAUGE,
 			metric_pb.MetricDescriptor_DOUBLE)
 		protos.cumulative = newSeries(
-			c.getMetricType(metricName, gcmMetricSuffixUnknown, gcmMetricSuffixCounter),
+			getMetricType(prefix, metricName, gcmMetricSuffixUnknown, gcmMetricSuffixCounter),
 			metric_pb.MetricDescriptor_CUMULATIVE,
 			metric_pb.MetricDescriptor_DOUBLE)
 
 	case textparse.MetricTypeSummary:
 		switch suffix {
 		case metricSuffixSum:
+			createdKey = getCreatedKey(entry.lset, baseMetricName)
 			protos.cumulative = newSeries(
-				c.getMetricType(metricName, gcmMetricSuffixSummary, gcmMetricSuffixCounter),
+				getMetricType(prefix, metricName, gcmMetricSuffixSummary, gcmMetricSuffixCounter),
 				metric_pb.MetricDescriptor_CUMULATIVE,
 				metric_pb.MetricDescriptor_DOUBLE)
 
 		case metricSuffixCount:
+			createdKey = getCreatedKey(entry.lset, baseMetricName)
 			protos.cumulative = newSeries(
-				c.getMetricType(metricName, gcmMetricSuffixSummary, gcmMetricSuffixNone),
+				getMetricType(prefix, metricName, gcmMetricSuffixSummary, gcmMetricSuffixNone),
 				metric_pb.MetricDescriptor_CUMULATIVE,
 				metric_pb.MetricDescriptor_DOUBLE)
 
 		case metricSuffixNone: // Actual quantiles.
 			protos.gauge = newSeries(
-				c.getMetricType(metricName, gcmMetricSuffixSummary, gcmMetricSuffixNone),
+				getMetricType(prefix, metricName, gcmMetricSuffixSummary, gcmMetricSuffixNone),
 				metric_pb.MetricDescriptor_GAUGE,
 				metric_pb.MetricDescriptor_DOUBLE)
 
@@ -453,15 +1114,59 @@ func (c *seriesCache) populate(ref storage.SeriesRef, entry *seriesCacheEntry, e
 		}
 
 	case textparse.MetricTypeHistogram:
+		createdKey = getCreatedKey(entry.lset, baseMetricName)
+		if countSum {
+			protos.cumulative = newSeries(
+				getMetricType(prefix, metricName, gcmMetricSuffixCounter, gcmMetricSuffixNone),
+				metric_pb.MetricDescriptor_CUMULATIVE,
+				metric_pb.MetricDescriptor_DOUBLE)
+			break
+		}
 		protos.cumulative = newSeries(
-			c.getMetricType(baseMetricName, gcmMetricSuffixHistogram, gcmMetricSuffixNone),
+			getMetricType(prefix, baseMetricName, gcmMetricSuffixHistogram, gcmMetricSuffixNone),
 			metric_pb.MetricDescriptor_CUMULATIVE,
 			metric_pb.MetricDescriptor_DISTRIBUTION)
 
+	case textparse.MetricTypeGaugeHistogram:
+		if !gaugeDistribution {
+			protos.gauge = newSeries(
+				getMetricType(prefix, metricName, gcmMetricSuffixGauge, gcmMetricSuffixNone),
+				metric_pb.MetricDescriptor_GAUGE,
+				metric_pb.MetricDescriptor_DOUBLE)
+			break
+		}
+		switch suffix {
+		case metricSuffixBucket, metricSuffixGSum, metricSuffixGCount:
+		default:
+			return fmt.Errorf("unexpected metric name suffix %q for metric %q", suffix, metricName)
+		}
+		protos.gauge = newSeries(
+			getMetricType(prefix, baseMetricName, gcmMetricSuffixGaugeHistogram, gcmMetricSuffixNone),
+			metric_pb.MetricDescriptor_GAUGE,
+			metric_pb.MetricDescriptor_DISTRIBUTION)
+
 	default:
 		return fmt.Errorf("unexpected metric type %s for metric %q", metadata.Type, metricName)
 	}
 
+	if c.descriptors != nil {
+		// The count of a summary, of a histogram written as count and sum, or of a gauge
+		// histogram written as gauges does not have the unit of the metric.
+		withUnit := (metadata.Type == textparse.MetricTypeHistogram && !countSum) || gaugeDistribution ||
+			(suffix != metricSuffixCount && suffix != metricSuffixGCount)
+		for _, s := range []hashedSeries{protos.gauge, protos.cumulative} {
+			if s.proto != nil {
+				c.descriptors.add(s.proto, metadata, baseMetricName, withUnit)
+			}
+		}
+	}
+	if c.slos != nil {
+		if s := protos.gauge.proto; s != nil {
+			c.slos.add(entry.lset, s)
+		} else if s := protos.cumulative.proto; s != nil {
+			c.slos.add(entry.lset, s)
+		}
+	}
 	c.pool.release(entry.protos.gauge.proto)
 	c.pool.release(entry.protos.cumulative.proto)
 	c.pool.intern(protos.gauge.proto)
@@ -470,6 +1175,7 @@ func (c *seriesCache) populate(ref storage.SeriesRef, entry *seriesCacheEntry, e
 	entry.protos = protos
 	entry.metadata = metadata
 	entry.suffix = suffix
+	entry.createdKey = createdKey
 
 	return nil
 }
@@ -538,6 +1244,20 @@ func extractResource(externalLabels, lset labels.Labels) (*monitoredres_pb.Monit
 	return mres, builder.Labels(labels.EmptyLabels()), nil
 }
 
+// routeProject sets the project_id label of the series to the value of the routing label
+// and removes the routing label. The series is returned unchanged if the routing label is
+// not set on it.
+func routeProject(lset labels.Labels, label string) labels.Labels {
+	if label == "" || label == KeyProjectID {
+		return lset
+	}
+	project := lset.Get(label)
+	if project == "" {
+		return lset
+	}
+	return labels.NewBuilder(lset).Set(KeyProjectID, project).Del(label).Labels(labels.EmptyLabels())
+}
+
 func splitMetricSuffix(name string) (prefix string, suffix metricSuffix, ok bool) {
 	if strings.HasSuffix(name, string(metricSuffixTotal)) {
 		return name[:len(name)-len(metricSuffixTotal)], metricSuffixTotal, true
@@ -551,6 +1271,15 @@ func splitMetricSuffix(name string) (prefix string, suffix metricSuffix, ok bool
 	if strings.HasSuffix(name, string(metricSuffixSum)) {
 		return name[:len(name)-len(metricSuffixSum)], metricSuffixSum, true
 	}
+	if strings.HasSuffix(name, string(metricSuffixCreated)) {
+		return name[:len(name)-len(metricSuffixCreated)], metricSuffixCreated, true
+	}
+	if strings.HasSuffix(name, string(metricSuffixGCount)) {
+		return name[:len(name)-len(metricSuffixGCount)], metricSuffixGCount, true
+	}
+	if strings.HasSuffix(name, string(metricSuffixGSum)) {
+		return name[:len(name)-len(metricSuffixGSum)], metricSuffixGSum, true
+	}
 	return name, metricSuffixNone, false
 }
 
@@ -15,12 +15,19 @@
 package export
 
 import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/textparse"
 	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb/chunks"
 	"github.com/prometheus/prometheus/tsdb/record"
 	monitoredres_pb "google.golang.org/genproto/googleapis/api/monitoredres"
 	"google.golang.org/protobuf/testing/protocmp"
@@ -168,10 +175,452 @@ func TestSeriesCache_garbageCollect(t *testing.T) {
 	cache.garbageCollect(100 * time.Second)
 
 	// Entry for series 1 should remain while 2 got dropped.
-	if len(cache.entries) != 1 {
-		t.Errorf("Expected exactly one cache entry left, but cache is %v", cache.entries)
+	if cache.numEntries != 1 {
+		t.Errorf("Expected exactly one cache entry left, but cache has %d", cache.numEntries)
 	}
-	if _, ok := cache.entries[1]; !ok {
-		t.Errorf("Expected cache entry for series 1 but cache is %v", cache.entries)
+	if cache.entry(1) == nil {
+		t.Errorf("Expected cache entry for series 1")
 	}
 }
+
+func TestSeriesCache_evict(t *testing.T) {
+	cache := newSeriesCache(nil, nil, MetricTypePrefix, nil)
+	cache.opts.MaxEntries = 10
+	cache.getLabelsByRef = func(storage.SeriesRef) labels.Labels { return labels.FromStrings("__name__", "metric1") }
+
+	now := int64(100000)
+	cache.now = func() time.Time { return time.Unix(now, 0) }
+
+	// Series 1 to 10 were last used in order, series 1 to 3 are stale.
+	for ref := 1; ref <= 10; ref++ {
+		cache.get(record.RefSample{Ref: chunks.HeadSeriesRef(ref), T: (now - 1000 + int64(ref)) * 1000}, nil, nil)
+	}
+	for ref := 4; ref <= 10; ref++ {
+		cache.get(record.RefSample{Ref: chunks.HeadSeriesRef(ref), T: (now - 100 + int64(ref)) * 1000}, nil, nil)
+	}
+	if cache.numEntries != 10 {
+		t.Fatalf("expected 10 cache entries, got %d", cache.numEntries)
+	}
+	// Exceeding the limit evicts the least recently used series until the cache
+	// is at 90% of the limit.
+	cache.get(record.RefSample{Ref: 11, T: now * 1000}, nil, nil)
+
+	var got []storage.SeriesRef
+	cache.each(func(ref storage.SeriesRef, _ *seriesCacheEntry) {
+		got = append(got, ref)
+	})
+	sort.Slice(got, func(i, j int) bool { return got[i] < got[j] })
+	if diff := cmp.Diff([]storage.SeriesRef{3, 4, 5, 6, 7, 8, 9, 10, 11}, got); diff != "" {
+		t.Errorf("unexpected cache entries (-want, +got): %s", diff)
+	}
+	if want := int64(9 * (seriesCacheEntryOverhead + len("__name__metric1"))); cache.bytes != want {
+		t.Errorf("expected estimated size %d, got %d", want, cache.bytes)
+	}
+	// The byte limit is enforced as well.
+	cache.opts.MaxEntries = 0
+	cache.opts.MaxBytes = 4 * (seriesCacheEntryOverhead + int64(len("__name__metric1")))
+	cache.get(record.RefSample{Ref: 12, T: now * 1000}, nil, nil)
+
+	if cache.numEntries != 3 {
+		t.Errorf("expected 3 cache entries, got %d", cache.numEntries)
+	}
+	if cache.entry(12) == nil {
+		t.Errorf("expected cache entry for the new series 12")
+	}
+}
+
+func TestSeriesCache_setMatchers(t *testing.T) {
+	var matchers Matchers
+	if err := matchers.Set(`{job="job1"}`); err != nil {
+		t.Fatal(err)
+	}
+	cache := newSeriesCache(nil, nil, MetricTypePrefix, matchers)
+	cache.getLabelsByRef = func(ref storage.SeriesRef) labels.Labels {
+		return labels.FromStrings("__name__", "metric1", "job", fmt.Sprintf("job%d", ref))
+	}
+	externalLabels := labels.FromStrings("project_id", "p1", "location", "l1")
+	metadata := testMetadataFunc(metricMetadataMap{
+		"metric1": {Type: textparse.MetricTypeGauge},
+	})
+	dropped := func(ref chunks.HeadSeriesRef) bool {
+		e, ok := cache.get(record.RefSample{Ref: ref}, externalLabels, metadata)
+		if !ok {
+			t.Fatalf("no entry for series %d", ref)
+		}
+		return e.dropped
+	}
+	if dropped(1) || !dropped(2) {
+		t.Fatal("expected only series 2 to be dropped")
+	}
+	if cache.setMatchers(matchers) {
+		t.Error("expected unchanged matchers to be ignored")
+	}
+	var newMatchers Matchers
+	if err := newMatchers.Set(`{job="job2"}`); err != nil {
+		t.Fatal(err)
+	}
+	if !cache.setMatchers(newMatchers) {
+		t.Fatal("expected matchers to be changed")
+	}
+	if !dropped(1) || dropped(2) {
+		t.Fatal("expected only series 1 to be dropped after changing the matchers")
+	}
+	e := cache.entry(2)
+	if e.protos.gauge.proto == nil || e.protos.gauge.proto.Metric.Type != "prometheus.googleapis.com/metric1/gauge" {
+		t.Errorf("expected series 2 to be populated, got %v", e.protos.gauge.proto)
+	}
+	if !cache.entry(1).protos.empty() {
+		t.Errorf("expected protos of dropped series 1 to be released")
+	}
+}
+
+func TestSeriesCache_summaryMode(t *testing.T) {
+	series := map[storage.SeriesRef]labels.Labels{
+		1: labels.FromStrings("job", "job1", "instance", "instance1", "__name__", "metric1", "quantile", "0.5"),
+		2: labels.FromStrings("job", "job1", "instance", "instance1", "__name__", "metric1_sum"),
+		3: labels.FromStrings("job", "job1", "instance", "instance1", "__name__", "metric1_count"),
+	}
+	externalLabels := labels.FromStrings("project_id", "example-project", "location", "europe")
+	metadata := func(metric string) (MetricMetadata, bool) {
+		if metric != "metric1" {
+			return MetricMetadata{}, false
+		}
+		return MetricMetadata{Metric: metric, Type: textparse.MetricTypeSummary}, true
+	}
+	cases := []struct {
+		mode string
+		// Expected metric types by series reference. Series without a type are dropped.
+		want map[storage.SeriesRef]string
+	}{
+		{
+			mode: "",
+			want: map[storage.SeriesRef]string{
+				1: "prometheus.googleapis.com/metric1/summary",
+				2: "prometheus.googleapis.com/metric1_sum/summary:counter",
+				3: "prometheus.googleapis.com/metric1_count/summary",
+			},
+		}, {
+			mode: SummaryModeAll,
+			want: map[storage.SeriesRef]string{
+				1: "prometheus.googleapis.com/metric1/summary",
+				2: "prometheus.googleapis.com/metric1_sum/summary:counter",
+				3: "prometheus.googleapis.com/metric1_count/summary",
+			},
+		}, {
+			mode: SummaryModeQuantiles,
+			want: map[storage.SeriesRef]string{
+				1: "prometheus.googleapis.com/metric1/summary",
+			},
+		}, {
+			mode: SummaryModeCountSum,
+			want: map[storage.SeriesRef]string{
+				2: "prometheus.googleapis.com/metric1_sum/summary:counter",
+				3: "prometheus.googleapis.com/metric1_count/summary",
+			},
+		}, {
+			mode: SummaryModeDrop,
+			want: map[storage.SeriesRef]string{},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.mode, func(t *testing.T) {
+			cache := newSeriesCache(nil, nil, MetricTypePrefix, nil)
+			cache.summaryMode = c.mode
+			cache.getLabelsByRef = func(ref storage.SeriesRef) labels.Labels {
+				return series[ref]
+			}
+			got := map[storage.SeriesRef]string{}
+
+			for ref := range series {
+				e, ok := cache.get(record.RefSample{Ref: chunks.HeadSeriesRef(ref), T: 1000}, externalLabels, metadata)
+				if !ok {
+					t.Fatalf("unexpected invalid entry for series %d", ref)
+				}
+				if e.dropped {
+					continue
+				}
+				if p := e.protos.gauge.proto; p != nil {
+					got[ref] = p.Metric.Type
+				}
+				if p := e.protos.cumulative.proto; p != nil {
+					got[ref] = p.Metric.Type
+				}
+			}
+			if diff := cmp.Diff(c.want, got); diff != "" {
+				t.Errorf("unexpected metric types (-want, +got): %s", diff)
+			}
+		})
+	}
+}
+
+func TestSeriesCache_untyped(t *testing.T) {
+	series := map[storage.SeriesRef]labels.Labels{
+		1: labels.FromStrings("job", "job1", "instance", "instance1", "__name__", "metric1"),
+		2: labels.FromStrings("job", "job2", "instance", "instance1", "__name__", "metric1"),
+	}
+	externalLabels := labels.FromStrings("project_id", "example-project", "location", "europe")
+	metadata := func(metric string) (MetricMetadata, bool) {
+		return MetricMetadata{Metric: metric, Type: textparse.MetricTypeUnknown}, true
+	}
+	job2 := Matchers{labels.Selector{labels.MustNewMatcher(labels.MatchEqual, "job", "job2")}}
+
+	cases := []struct {
+		doc     string
+		untyped UntypedOpts
+		// Expected metric types by series reference.
+		want map[storage.SeriesRef][]string
+	}{
+		{
+			doc: "default",
+			want: map[storage.SeriesRef][]string{
+				1: {"prometheus.googleapis.com/metric1/unknown", "prometheus.googleapis.com/metric1/unknown:counter"},
+				2: {"prometheus.googleapis.com/metric1/unknown", "prometheus.googleapis.com/metric1/unknown:counter"},
+			},
+		}, {
+			doc:     "gauge mode",
+			untyped: UntypedOpts{Mode: UntypedModeGauge},
+			want: map[storage.SeriesRef][]string{
+				1: {"prometheus.googleapis.com/metric1/unknown"},
+				2: {"prometheus.googleapis.com/metric1/unknown"},
+			},
+		}, {
+			doc:     "gauge mode with gauge suffix",
+			untyped: UntypedOpts{Mode: UntypedModeGauge, GaugeSuffix: UntypedGaugeSuffixGauge},
+			want: map[storage.SeriesRef][]string{
+				1: {"prometheus.googleapis.com/metric1/gauge"},
+				2: {"prometheus.googleapis.com/metric1/gauge"},
+			},
+		}, {
+			doc:     "gauge matchers",
+			untyped: UntypedOpts{Mode: UntypedModeDouble, GaugeMatchers: job2},
+			want: map[storage.SeriesRef][]string{
+				1: {"prometheus.googleapis.com/metric1/unknown", "prometheus.googleapis.com/metric1/unknown:counter"},
+				2: {"prometheus.googleapis.com/metric1/unknown"},
+			},
+		}, {
+			doc:     "double matchers",
+			untyped: UntypedOpts{Mode: UntypedModeGauge, DoubleMatchers: job2},
+			want: map[storage.SeriesRef][]string{
+				1: {"prometheus.googleapis.com/metric1/unknown"},
+				2: {"prometheus.googleapis.com/metric1/unknown", "prometheus.googleapis.com/metric1/unknown:counter"},
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.doc, func(t *testing.T) {
+			cache := newSeriesCache(nil, nil, MetricTypePrefix, nil)
+			cache.untyped = c.untyped
+			cache.getLabelsByRef = func(ref storage.SeriesRef) labels.Labels {
+				return series[ref]
+			}
+			got := map[storage.SeriesRef][]string{}
+
+			for ref := range series {
+				e, ok := cache.get(record.RefSample{Ref: chunks.HeadSeriesRef(ref), T: 1000}, externalLabels, metadata)
+				if !ok {
+					t.Fatalf("unexpected invalid entry for series %d", ref)
+				}
+				if p := e.protos.gauge.proto; p != nil {
+					got[ref] = append(got[ref], p.Metric.Type)
+				}
+				if p := e.protos.cumulative.proto; p != nil {
+					got[ref] = append(got[ref], p.Metric.Type)
+				}
+			}
+			if diff := cmp.Diff(c.want, got); diff != "" {
+				t.Errorf("unexpected metric types (-want, +got): %s", diff)
+			}
+		})
+	}
+}
+
+func TestRouteProject(t *testing.T) {
+	cases := []struct {
+		doc   string
+		label string
+		lset  labels.Labels
+		want  labels.Labels
+	}{
+		{
+			doc:  "routing disabled",
+			lset: labels.FromStrings("project_id", "p1", "tenant", "p2"),
+			want: labels.FromStrings("project_id", "p1", "tenant", "p2"),
+		}, {
+			doc:   "routing label overrides project",
+			label: "tenant",
+			lset:  labels.FromStrings("project_id", "p1", "tenant", "p2"),
+			want:  labels.FromStrings("project_id", "p2"),
+		}, {
+			doc:   "routing label sets project",
+			label: "tenant",
+			lset:  labels.FromStrings("__name__", "metric1", "tenant", "p2"),
+			want:  labels.FromStrings("__name__", "metric1", "project_id", "p2"),
+		}, {
+			doc:   "routing label not set",
+			label: "tenant",
+			lset:  labels.FromStrings("project_id", "p1"),
+			want:  labels.FromStrings("project_id", "p1"),
+		}, {
+			doc:   "routing by project_id",
+			label: "project_id",
+			lset:  labels.FromStrings("project_id", "p1"),
+			want:  labels.FromStrings("project_id", "p1"),
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.doc, func(t *testing.T) {
+			if got := routeProject(c.lset, c.label); !labels.Equal(got, c.want) {
+				t.Errorf("expected %s, got %s", c.want, got)
+			}
+		})
+	}
+}
+
+func TestSeriesCache_metricTypePrefix(t *testing.T) {
+	cache := newSeriesCache(nil, nil, MetricTypePrefix, nil)
+	cache.getLabelsByRef = func(ref storage.SeriesRef) labels.Labels {
+		switch ref {
+		case 1:
+			return labels.FromStrings("__name__", "metric1", KeyMetricTypePrefix, "custom.googleapis.com/team-a", "foo", "bar")
+		case 3:
+			return labels.FromStrings("__name__", "metric1", KeyMetricTypePrefix, "example.com", "foo", "bar")
+		}
+		return labels.FromStrings("__name__", "metric1", "foo", "bar")
+	}
+	externalLabels := labels.FromStrings("project_id", "p1", "location", "l1")
+	metadata := testMetadataFunc(metricMetadataMap{
+		"metric1": {Type: textparse.MetricTypeGauge},
+	})
+	for ref, want := range map[chunks.HeadSeriesRef]string{
+		1: "custom.googleapis.com/team-a/metric1/gauge",
+		2: "prometheus.googleapis.com/metric1/gauge",
+	} {
+		entry, ok := cache.get(record.RefSample{Ref: ref}, externalLabels, metadata)
+		if !ok {
+			t.Fatalf("no entry for series %d", ref)
+		}
+		metric := entry.protos.gauge.proto.Metric
+		if metric.Type != want {
+			t.Errorf("expected metric type %q, got %q", want, metric.Type)
+		}
+		if diff := cmp.Diff(map[string]string{"foo": "bar"}, metric.Labels); diff != "" {
+			t.Errorf("unexpected metric labels (-want, +got): %s", diff)
+		}
+	}
+	// Series with a prefix outside of the allowed domains are dropped.
+	if _, ok := cache.get(record.RefSample{Ref: 3}, externalLabels, metadata); ok {
+		t.Errorf("expected series with invalid metric type prefix to be dropped")
+	}
+}
+
+func TestSeriesCache_concurrent(t *testing.T) {
+	cache := newSeriesCache(nil, nil, MetricTypePrefix, nil)
+	cache.opts.MaxEntries = 500
+	cache.getLabelsByRef = func(ref storage.SeriesRef) labels.Labels {
+		return labels.FromStrings("__name__", "metric1_total", "instance", fmt.Sprintf("i%d", ref))
+	}
+	externalLabels := labels.FromStrings("project_id", "p1", "location", "l1")
+	metadata := testMetadataFunc(metricMetadataMap{
+		"metric1_total": {Type: textparse.MetricTypeCounter},
+	})
+
+	// Samples of more series than the cache holds are processed concurrently, while the
+	// cache is refreshed and garbage collected, which must leave it consistent.
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 2000; j++ {
+				ref := chunks.HeadSeriesRef((i*100+j)%1000 + 1)
+				ts := int64(j) * 1000
+				cache.get(record.RefSample{Ref: ref, T: ts}, externalLabels, metadata)
+				cache.getResetAdjusted(storage.SeriesRef(ref), ts, float64(j))
+				if j%100 == 0 {
+					cache.markStale(storage.SeriesRef(ref))
+				}
+			}
+		}(i)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			cache.forceRefresh()
+			if err := cache.garbageCollect(time.Hour); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+	wg.Wait()
+
+	var (
+		entries int
+		bytes   int64
+	)
+	cache.each(func(_ storage.SeriesRef, e *seriesCacheEntry) {
+		entries++
+		bytes += e.size
+	})
+	if entries != cache.numEntries || entries > cache.opts.MaxEntries {
+		t.Errorf("expected at most %d entries, counted %d, found %d", cache.opts.MaxEntries, cache.numEntries, entries)
+	}
+	if bytes != cache.bytes {
+		t.Errorf("expected estimated size %d, got %d", bytes, cache.bytes)
+	}
+}
+
+// BenchmarkSeriesCache_get measures processing samples of a large number of series
+// from parallel goroutines, e.g. the shards of a collector. Run it with -cpu to see how
+// it scales with the number of goroutines.
+func BenchmarkSeriesCache_get(b *testing.B) {
+	const numSeries = 1 << 18
+
+	externalLabels := labels.FromStrings("project_id", "p1", "location", "l1")
+	metadata := testMetadataFunc(metricMetadataMap{
+		"metric1_total": {Type: textparse.MetricTypeCounter},
+	})
+	newCache := func() *seriesCache {
+		cache := newSeriesCache(nil, nil, MetricTypePrefix, nil)
+		cache.getLabelsByRef = func(ref storage.SeriesRef) labels.Labels {
+			return labels.FromStrings("__name__", "metric1_total", "job", "job1", "instance", strconv.FormatUint(uint64(ref), 10))
+		}
+		return cache
+	}
+
+	// Samples of cached series, which is the case for almost all samples.
+	b.Run("cached", func(b *testing.B) {
+		cache := newCache()
+		for ref := 1; ref <= numSeries; ref++ {
+			cache.get(record.RefSample{Ref: chunks.HeadSeriesRef(ref), T: 1000}, externalLabels, metadata)
+		}
+		var offset atomic.Uint64
+		b.ReportAllocs()
+		b.ResetTimer()
+
+		b.RunParallel(func(pb *testing.PB) {
+			// Every goroutine processes different series like the shards of the exporter.
+			i := offset.Add(numSeries / 16)
+			for ts := int64(2000); pb.Next(); ts++ {
+				i++
+				ref := storage.SeriesRef(i%numSeries + 1)
+				cache.get(record.RefSample{Ref: chunks.HeadSeriesRef(ref), T: ts}, externalLabels, metadata)
+				cache.getResetAdjusted(ref, ts, float64(ts))
+			}
+		})
+	})
+	// Samples of new series, e.g. after a rollout of many pods.
+	b.Run("new", func(b *testing.B) {
+		cache := newCache()
+		var next atomic.Uint64
+		b.ReportAllocs()
+		b.ResetTimer()
+
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				ref := chunks.HeadSeriesRef(next.Add(1))
+				cache.get(record.RefSample{Ref: ref, T: 1000}, externalLabels, metadata)
+			}
+		})
+	})
+}
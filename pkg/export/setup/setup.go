@@ -27,6 +27,7 @@ import (
 	"github.com/go-kit/log"
 	"github.com/google/shlex"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/textparse"
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
@@ -121,15 +122,51 @@ func FromFlags(a *kingpin.Application, userAgentProduct string) func(log.Logger,
 	a.Flag("export.disable", "Disable exporting to GCM.").
 		Default("false").BoolVar(&opts.Disable)
 
+	a.Flag("export.pause", "Start with sending samples to GCM paused. Samples are still queued until the buffers are full. Sending can be paused and resumed at runtime through the admin endpoints of the binary.").
+		Default("false").BoolVar(&opts.Paused)
+
+	a.Flag("export.disable-exemplars", "Disable exporting exemplars to GCM. Exemplars are attached to histograms and linked to Cloud Trace spans if they have project_id, trace_id, and span_id labels.").
+		Default("false").BoolVar(&opts.DisableExemplars)
+
 	a.Flag("export.endpoint", "GCM API endpoint to send metric data to.").
 		Default("monitoring.googleapis.com:443").StringVar(&opts.Endpoint)
 
 	a.Flag("export.compression", "The compression format to use for gRPC requests ('none' or 'gzip').").
 		Default(export.CompressionNone).EnumVar(&opts.Compression, export.CompressionNone, export.CompressionGZIP)
 
+	a.Flag("export.tls.ca-file", "File with PEM encoded certificates of additional certificate authorities the certificate of the GCM API endpoint is verified with, e.g. of a TLS-intercepting proxy. Proxies are configured through the HTTPS_PROXY and NO_PROXY environment variables.").
+		Default("").StringVar(&opts.TLS.CAFile)
+
+	a.Flag("export.tls.server-name", "Name the certificate of the GCM API endpoint is verified against, e.g. monitoring.googleapis.com if --export.endpoint is set to a Private Service Connect endpoint. Defaults to the host of the endpoint.").
+		Default("").StringVar(&opts.TLS.ServerName)
+
+	a.Flag("export.connection.pool-size", "Number of gRPC connections to the GCM API that requests are balanced across.").
+		Default(strconv.Itoa(export.DefaultConnectionPoolSize)).IntVar(&opts.Connection.PoolSize)
+
+	a.Flag("export.connection.max-streams", "Maximum number of concurrent requests per gRPC connection to the GCM API. Further requests wait until a request completes.").
+		Default(strconv.Itoa(export.DefaultMaxStreamsPerConnection)).IntVar(&opts.Connection.MaxStreamsPerConnection)
+
+	a.Flag("export.connection.keepalive-time", "Time after which an idle gRPC connection to the GCM API is pinged to check whether it is still alive. Must be at least 10s.").
+		Default(export.DefaultKeepaliveTime.String()).DurationVar(&opts.Connection.KeepaliveTime)
+
+	a.Flag("export.connection.keepalive-timeout", "Time after which a gRPC connection to the GCM API is closed if a ping is not acknowledged.").
+		Default(export.DefaultKeepaliveTimeout.String()).DurationVar(&opts.Connection.KeepaliveTimeout)
+
 	a.Flag("export.credentials-file", "Credentials file for authentication with the GCM API.").
 		Default("").StringVar(&opts.CredentialsFile)
 
+	a.Flag("export.token.prefetch-window", "Time before expiry at which a new OAuth token is fetched in the background. Requests keep using the cached token meanwhile, so that slow token fetches, e.g. from the metadata server, do not delay them. Expiry is checked against the GCM API server clock. Failed fetches are counted by the gcm_export_token_refreshes_total metric.").
+		Default(export.DefaultTokenPrefetchWindow.String()).DurationVar(&opts.Token.PrefetchWindow)
+
+	a.Flag("export.token.fetch-timeout", "Maximum time requests wait for an OAuth token if no valid one is cached.").
+		Default(export.DefaultTokenFetchTimeout.String()).DurationVar(&opts.Token.FetchTimeout)
+
+	a.Flag("export.clock-skew-threshold", "Absolute skew of the local clock against the GCM API above which warnings are logged. The current skew is exposed through the gcm_export_clock_skew_seconds metric. Set to 0 to disable warnings.").
+		Default("30s").DurationVar(&opts.ClockSkewThreshold)
+
+	a.Flag("export.clock-skew-policy", fmt.Sprintf("Policy for samples written while the local clock is skewed by more than --export.clock-skew-threshold. With %q, the skew is only reported. With %q, sample timestamps are additionally shifted by the skew so that GCM does not reject them as out of range.", export.ClockSkewPolicyWarn, export.ClockSkewPolicyAdjust)).
+		Default(export.ClockSkewPolicyWarn).EnumVar(&opts.ClockSkewPolicy, export.ClockSkewPolicyWarn, export.ClockSkewPolicyAdjust)
+
 	a.Flag("export.label.project-id", fmt.Sprintf("Default project ID set for all exported data. Prefer setting the external label %q in the Prometheus configuration if not using the auto-discovered default.", export.KeyProjectID)).
 		Default(opts.ProjectID).StringVar(&opts.ProjectID)
 
@@ -148,6 +185,57 @@ func FromFlags(a *kingpin.Application, userAgentProduct string) func(log.Logger,
 	a.Flag("export.match", `A Prometheus time series matcher. Can be repeated. Every time series must match at least one of the matchers to be exported. This flag can be used equivalently to the match[] parameter of the Prometheus federation endpoint to selectively export data. (Example: --export.match='{job="prometheus"}' --export.match='{__name__=~"job:.*"})`).
 		Default("").SetValue(&opts.Matchers)
 
+	a.Flag("export.match-file", "A file with Prometheus time series matchers, one per line, in addition to --export.match. The file is read again on every configuration reload, e.g. on SIGHUP, so the exported time series can be changed without a restart.").
+		Default("").StringVar(&opts.MatchersFile)
+
+	a.Flag("export.metric-name.allow", "A regular expression of metric names. Can be repeated. If set, only series whose metric name fully matches at least one of the expressions are exported. Applies in addition to --export.match. (Example: --export.metric-name.allow='kube_.+')").
+		StringsVar(&opts.MetricNames.Allow)
+
+	a.Flag("export.metric-name.deny", "A regular expression of metric names. Can be repeated. Series whose metric name fully matches any of the expressions are never exported, even if allowed by --export.metric-name.allow. Applies in addition to --export.match.").
+		StringsVar(&opts.MetricNames.Deny)
+
+	a.Flag("export.priority-match", `A Prometheus time series matcher. Can be repeated. Time series matching at least one of the matchers are of high priority: their samples are queued separately and sent ahead of other samples, so that under backpressure other samples are dropped first. Series selected by --export.slo-file are of high priority as well if the flag is set. Intended for recorded and alerting series. (Example: --export.priority-match='{__name__=~".+:.+"}')`).
+		Default("").SetValue(&opts.PriorityMatchers)
+
+	a.Flag("export.summary-mode", fmt.Sprintf("Which series of summaries to export. Valid values are %q (quantiles as gauges with a quantile label, count and sum as cumulatives), %q, %q, or %q.", export.SummaryModeAll, export.SummaryModeQuantiles, export.SummaryModeCountSum, export.SummaryModeDrop)).
+		Default(export.SummaryModeAll).EnumVar(&opts.SummaryMode, export.SummaryModeAll, export.SummaryModeQuantiles, export.SummaryModeCountSum, export.SummaryModeDrop)
+
+	a.Flag("export.downsample.interval", "Interval at which points of a series are written, e.g. 30s for targets scraped every 5s. Only the first sample of a series within each interval, aligned to multiples of the interval, is written. Disabled if 0.").
+		Default("0").DurationVar(&opts.Downsample.Interval)
+
+	a.Flag("export.downsample.align", "Set the end time of written points to the start of their downsample interval.").
+		Default("false").BoolVar(&opts.Downsample.Align)
+
+	a.Flag("export.staleness-mode", fmt.Sprintf("How staleness markers of series are handled. With %q, the series silently stops and its cumulative points continue from before the gap if it reappears. With %q, the staleness marker ends the series and it starts a new cumulative interval if it reappears. Series whose last sample was a staleness marker are counted by the gcm_export_stale_series metric.", export.StalenessModeSilent, export.StalenessModeEnd)).
+		Default(export.StalenessModeSilent).EnumVar(&opts.StalenessMode, export.StalenessModeSilent, export.StalenessModeEnd)
+
+	a.Flag("export.untyped.mode", fmt.Sprintf("How to export metrics without a type. Valid values are %q (as a gauge and a cumulative) or %q (as a gauge only).", export.UntypedModeDouble, export.UntypedModeGauge)).
+		Default(export.UntypedModeDouble).EnumVar(&opts.Untyped.Mode, export.UntypedModeDouble, export.UntypedModeGauge)
+
+	a.Flag("export.untyped.gauge-match", "A Prometheus time series matcher. Can be repeated. Untyped time series matching at least one of the matchers are exported as a gauge only, regardless of --export.untyped.mode.").
+		Default("").SetValue(&opts.Untyped.GaugeMatchers)
+
+	a.Flag("export.untyped.double-match", "A Prometheus time series matcher. Can be repeated. Untyped time series matching at least one of the matchers are exported as a gauge and a cumulative, regardless of --export.untyped.mode. Matches of --export.untyped.gauge-match take precedence.").
+		Default("").SetValue(&opts.Untyped.DoubleMatchers)
+
+	a.Flag("export.untyped.gauge-suffix", fmt.Sprintf("Metric type suffix of untyped metrics exported as a gauge only. Valid values are %q (same metric type as the gauge written in double mode) or %q (same metric type as regular gauges).", export.UntypedGaugeSuffixUnknown, export.UntypedGaugeSuffixGauge)).
+		Default(export.UntypedGaugeSuffixUnknown).EnumVar(&opts.Untyped.GaugeSuffix, export.UntypedGaugeSuffixUnknown, export.UntypedGaugeSuffixGauge)
+
+	a.Flag("export.type-conflict.strategy", fmt.Sprintf("Handling of series whose metric type conflicts with the type of the oldest active series of their metric, e.g. because it changed between scrapes. With %q, they are written as a separate GCM metric of their own type. With %q, they are dropped. With %q, counters, gauges, and untyped series are written as the type of their metric and others are dropped. Conflicts are reported through the gcm_export_metric_type_conflicts metric.", export.TypeConflictFork, export.TypeConflictDrop, export.TypeConflictCoerce)).
+		Default(export.TypeConflictFork).EnumVar(&opts.TypeConflicts.Strategy, export.TypeConflictFork, export.TypeConflictDrop, export.TypeConflictCoerce)
+
+	typePolicy := a.Flag("export.type-policy", fmt.Sprintf("Action for all series of a metric type in the form <type>=<action>, e.g. summary=drop. Valid actions are %q, %q, and %q (only the _count and _sum series of histograms and summaries are written). Affected series are reported through the gcm_export_type_policy_series metric. Can be repeated.", export.TypePolicyKeep, export.TypePolicyDrop, export.TypePolicyCountSum)).
+		StringMap()
+
+	a.Flag("export.type-policy.max-bucket-series", fmt.Sprintf("Maximum number of active _bucket series of a histogram metric. Histograms of metrics with more bucket series are written as with the %q action. Unlimited if 0.", export.TypePolicyCountSum)).
+		Default("0").IntVar(&opts.TypePolicy.MaxBucketSeries)
+
+	a.Flag("export.metadata.mode", fmt.Sprintf("How the types of series are determined. With %q, they are looked up in the metadata exposed by their targets. With %q, they are derived from metric names and labels without metadata lookups, which saves memory and CPU: _total series are counters, _bucket series with an le label are histograms, series with a quantile label are summaries, and other series are gauges. Help texts and units are not written then.", export.MetadataModeScrape, export.MetadataModeHeuristic)).
+		Default(export.MetadataModeScrape).EnumVar(&opts.Metadata.Mode, export.MetadataModeScrape, export.MetadataModeHeuristic)
+
+	metadataTypes := a.Flag("export.metadata.type", "Type of a metric in the form <metric>=<type>, overriding the derived type with --export.metadata.mode=heuristic. Histograms and summaries are given without suffix. Can be repeated.").
+		StringMap()
+
 	a.Flag("export.debug.metric-prefix", "Google Cloud Monitoring metric prefix to use.").
 		Default(export.MetricTypePrefix).StringVar(&opts.MetricTypePrefix)
 
@@ -163,6 +251,165 @@ func FromFlags(a *kingpin.Application, userAgentProduct string) func(log.Logger,
 	a.Flag("export.debug.shard-buffer-size", "The buffer size for each individual shard. Each element in buffer (queue) consists of sample and hash.").
 		Default(strconv.Itoa(export.DefaultShardBufferSize)).UintVar(&opts.Efficiency.ShardBufferSize)
 
+	a.Flag("export.debug.batch-delay", fmt.Sprintf("Maximum time a batch that is not full is held back before it is sent to the GCM API. Must be between %s and %s.", export.BatchDelayMin, export.BatchDelayMax)).
+		Default(export.DefaultBatchDelay.String()).DurationVar(&opts.Efficiency.BatchDelay)
+
+	a.Flag("export.shards.min-count", "Minimum number of shards if they are resized at runtime based on how full their buffers are.").
+		Default("1").UintVar(&opts.Efficiency.MinShardCount)
+
+	a.Flag("export.shards.max-count", "Maximum number of shards if they are resized at runtime based on how full their buffers are. Resizing is disabled if 0.").
+		Default("0").UintVar(&opts.Efficiency.MaxShardCount)
+
+	a.Flag("export.shards.resize-interval", "Interval at which the number of shards is reconsidered if resizing is enabled.").
+		Default(export.DefaultShardResizeInterval.String()).DurationVar(&opts.Efficiency.ShardResizeInterval)
+
+	a.Flag("export.disk-buffer.dir", "Directory to buffer samples in while they cannot be sent fast enough to the GCM API, e.g. during an outage. Buffered samples are kept across restarts. Disabled if empty.").
+		Default("").StringVar(&opts.DiskBuffer.Dir)
+
+	a.Flag("export.disk-buffer.max-bytes", "Maximum size of the samples buffered on disk. The oldest samples are dropped if it is exceeded.").
+		Default(strconv.Itoa(export.DefaultDiskBufferSize)).Int64Var(&opts.DiskBuffer.MaxBytes)
+
+	a.Flag("export.dead-letter.path", "File to log a sample of the series of requests permanently rejected by the GCM API to, together with the returned error, e.g. to debug invalid labels. Disabled if empty.").
+		Default("").StringVar(&opts.DeadLetter.Path)
+
+	a.Flag("export.dead-letter.sample-ratio", "Ratio of rejected requests whose series are logged to the dead-letter log.").
+		Default(strconv.FormatFloat(export.DefaultDeadLetterSampleRatio, 'f', -1, 64)).Float64Var(&opts.DeadLetter.SampleRatio)
+
+	a.Flag("export.dead-letter.max-series", "Maximum number of series logged per rejected request.").
+		Default(strconv.Itoa(export.DefaultDeadLetterMaxSeries)).IntVar(&opts.DeadLetter.MaxSeries)
+
+	a.Flag("export.dead-letter.max-bytes", "Maximum size of the dead-letter log. The log is rotated once it is exceeded, keeping one previous file.").
+		Default(strconv.Itoa(export.DefaultDeadLetterMaxBytes)).Int64Var(&opts.DeadLetter.MaxBytes)
+
+	a.Flag("export.retry.max-attempts", "Maximum number of attempts of a request to the GCM API that failed with a retryable error, including the first one. Requests are not retried if set to 1.").
+		Default("1").IntVar(&opts.Retry.MaxAttempts)
+
+	a.Flag("export.retry.initial-backoff", "Backoff before the first retry of a request to the GCM API. It doubles with every further retry.").
+		Default(export.DefaultRetryInitialBackoff.String()).DurationVar(&opts.Retry.InitialBackoff)
+
+	a.Flag("export.retry.max-backoff", "Maximum backoff between retries of a request to the GCM API.").
+		Default(export.DefaultRetryMaxBackoff.String()).DurationVar(&opts.Retry.MaxBackoff)
+
+	a.Flag("export.retry.budget", "Ratio of requests to the GCM API that may be retried across all requests.").
+		Default(strconv.FormatFloat(export.DefaultRetryBudget, 'f', -1, 64)).Float64Var(&opts.Retry.Budget)
+
+	a.Flag("export.throttle.disable", "Disable client-side throttling of requests to the GCM API when it responds with quota errors.").
+		Default("false").BoolVar(&opts.Throttle.Disable)
+
+	a.Flag("export.throttle.multiplier", "Number of requests per request accepted by the GCM API that may be made before requests are shed. Lower values shed more aggressively when quota errors occur. Must be at least 1.").
+		Default(strconv.FormatFloat(export.DefaultThrottleMultiplier, 'f', -1, 64)).Float64Var(&opts.Throttle.Multiplier)
+
+	a.Flag("export.throttle.window", "Time window over which requests are tracked for client-side throttling.").
+		Default(export.DefaultThrottleWindow.String()).DurationVar(&opts.Throttle.Window)
+
+	a.Flag("export.project-routing.label", fmt.Sprintf("Name of a series label whose value is the project ID the series is written to. It takes precedence over the %q label and is removed from the series.", export.KeyProjectID)).
+		Default("").StringVar(&opts.ProjectRouting.Label)
+
+	a.Flag("export.project-routing.credentials", "Credentials file for requests to a project in the form <project_id>=<file>. Can be repeated. Requests to other projects use --export.credentials-file.").
+		StringMapVar(&opts.ProjectRouting.Credentials)
+
+	a.Flag("export.namespace-credentials", "Credentials file, e.g. a Workload Identity Federation credential configuration, for requests with the time series of a namespace in the form <namespace>=<file>. Can be repeated. Takes precedence over the credentials of the project.").
+		StringMapVar(&opts.NamespaceCredentials.Files)
+
+	a.Flag("export.namespace-credentials.idle-timeout", "Time after which the client for namespace credentials is closed if it was not used.").
+		Default(export.DefaultNamespaceCredentialsIdleTimeout.String()).DurationVar(&opts.NamespaceCredentials.IdleTimeout)
+
+	a.Flag("export.remote-write.url", "URL of a Prometheus remote write endpoint that samples are mirrored to in addition to the GCM API. Disabled if empty.").
+		Default("").StringVar(&opts.RemoteWrite.URL)
+
+	a.Flag("export.remote-write.only", "Only write samples to --export.remote-write.url and make no requests to GCM, which then need no credentials. Failed requests are retried. Cannot be combined with --export.remote-write.match.").
+		Default("false").BoolVar(&opts.RemoteWrite.Only)
+
+	a.Flag("export.remote-write.match", "A Prometheus time series matcher. Can be repeated. Only time series matching at least one of the matchers are mirrored to the remote write endpoint.").
+		Default("").SetValue(&opts.RemoteWrite.Matchers)
+
+	a.Flag("export.remote-write.batch-size", "Maximum number of samples per request to the remote write endpoint.").
+		Default(strconv.Itoa(export.DefaultRemoteWriteBatchSize)).IntVar(&opts.RemoteWrite.BatchSize)
+
+	a.Flag("export.remote-write.queue-size", "Number of samples that can be queued for the remote write endpoint. Samples are dropped if the queue is full.").
+		Default(strconv.Itoa(export.DefaultRemoteWriteQueueSize)).IntVar(&opts.RemoteWrite.QueueSize)
+
+	a.Flag("export.remote-write.timeout", "Timeout of requests to the remote write endpoint.").
+		Default(export.DefaultRemoteWriteTimeout.String()).DurationVar(&opts.RemoteWrite.Timeout)
+
+	a.Flag("export.dual-write.project-id", "Project ID of a second project all samples are written to in addition to their regular project, e.g. while migrating to a new project. Failures of writes to the second project do not affect the regular export. Disabled if empty.").
+		Default("").StringVar(&opts.DualWrite.ProjectID)
+
+	a.Flag("export.dual-write.credentials-file", "Credentials file for requests to the dual write project. Defaults to --export.credentials-file.").
+		Default("").StringVar(&opts.DualWrite.CredentialsFile)
+
+	a.Flag("export.dual-write.queue-size", "Number of batches that can be queued for the dual write project. Batches are dropped if the queue is full.").
+		Default(strconv.Itoa(export.DefaultDualWriteQueueSize)).IntVar(&opts.DualWrite.QueueSize)
+
+	a.Flag("export.drop-log.enable", "Log structured records with the metric name, labels hash, and reason for a sample of dropped points. Can be toggled at runtime.").
+		Default("false").BoolVar(&opts.DropLog.Enable)
+
+	a.Flag("export.drop-log.rate", "Maximum number of log records of dropped points per second.").
+		Default(strconv.FormatFloat(export.DefaultDropLogRate, 'f', -1, 64)).Float64Var(&opts.DropLog.Rate)
+
+	a.Flag("export.backpressure.threshold", "Ratio of the capacity of the export queues that must be used before scrapes of the pools set by --export.backpressure.pool are skipped or stretched, e.g. during a long GCM outage. Disabled if 0. The --export.backpressure.* flags only take effect with a Prometheus fork whose scrape loop calls Exporter.SkipScrape before every scrape, which upstream Prometheus does not.").
+		Default("0").Float64Var(&opts.Backpressure.Threshold)
+
+	a.Flag("export.backpressure.duration", "Duration for which the export queues must exceed --export.backpressure.threshold before scrapes are backed off.").
+		Default(export.DefaultBackpressureDuration.String()).DurationVar(&opts.Backpressure.Duration)
+
+	a.Flag("export.backpressure.pool", "Name of a low priority scrape pool, i.e. the job name of a scrape config, whose scrapes are backed off while the export queues are backed up. Can be repeated.").
+		StringsVar(&opts.Backpressure.Pools)
+
+	a.Flag("export.backpressure.stretch-factor", "Factor by which the scrape interval of low priority pools is stretched while the export queues are backed up, by only running every n-th scrape. All scrapes are skipped if 0.").
+		Default("0").IntVar(&opts.Backpressure.StretchFactor)
+
+	a.Flag("export.debug.tsdb-sink.path", "Directory of a local Prometheus TSDB that all samples sent to GCM are written to for debugging, e.g. to inspect them with promtool. Series are written with the labels of their monitored resource and metric, their GCM metric type and resource type as gcm_metric_type and gcm_resource_type labels, and distributions as histogram series. Disabled if empty.").
+		Default("").StringVar(&opts.TSDBSink.Path)
+
+	a.Flag("export.debug.tsdb-sink.only", "Only write samples to --export.debug.tsdb-sink.path and make no requests to GCM, which then need no credentials.").
+		Default("false").BoolVar(&opts.TSDBSink.Only)
+
+	a.Flag("export.metric-descriptors.enable", "Write the help text and unit of metrics as metric descriptors to the GCM API when their metric type is first exported.").
+		Default("false").BoolVar(&opts.MetricDescriptors.Enable)
+
+	a.Flag("export.metric-descriptors.rate-limit", "Maximum number of metric descriptor writes per second.").
+		Default(strconv.FormatFloat(export.DefaultMetricDescriptorRateLimit, 'f', -1, 64)).Float64Var(&opts.MetricDescriptors.RateLimit)
+
+	a.Flag("export.metric-descriptors.unit", "Unit of the metrics with a name prefix in the form <metric prefix>=<unit>, overriding the unit from metadata and metric name suffixes. Units are Prometheus units like seconds or bytes_per_second, or UCUM units like By/s. An empty unit writes no unit. The longest matching prefix applies. Can be repeated.").
+		StringMapVar(&opts.MetricDescriptors.Units)
+
+	a.Flag("export.series-cache.max-entries", "Maximum number of series in the series cache. The least recently used series are evicted if it is exceeded. Unlimited if 0.").
+		Default("0").IntVar(&opts.SeriesCache.MaxEntries)
+
+	a.Flag("export.series-cache.max-bytes", "Maximum estimated memory used by the series cache. The least recently used series are evicted if it is exceeded. Unlimited if 0.").
+		Default("0").Int64Var(&opts.SeriesCache.MaxBytes)
+
+	a.Flag("export.series-cache.staleness-period", "Period after which series without samples are considered stale and removed from the series cache.").
+		Default(export.DefaultSeriesCacheStalenessPeriod.String()).DurationVar(&opts.SeriesCache.StalenessPeriod)
+
+	a.Flag("export.series-cache.max-series-per-metric", "Maximum number of active series per metric name. New series of a metric that reached the limit are dropped and reported through the gcm_export_series_limited metric, while its existing series keep being exported. Unlimited if 0.").
+		Default("0").IntVar(&opts.SeriesCache.MaxSeriesPerMetric)
+
+	a.Flag("export.histogram.max-buckets", "Maximum number of buckets of a histogram. Adjacent buckets of histograms with more buckets are merged before they are written. Unlimited if 0.").
+		Default("0").IntVar(&opts.Histograms.MaxBuckets)
+
+	a.Flag("export.histogram.gauge-mode", fmt.Sprintf("How OpenMetrics gauge histograms are written. In %q mode they are written as gauge distributions of the metric type with the \"gaugehistogram\" suffix. In %q mode each of their series, including every bucket, is written as a separate gauge.", export.GaugeHistogramModeDistribution, export.GaugeHistogramModeGauge)).
+		Default(export.GaugeHistogramModeDistribution).EnumVar(&opts.Histograms.GaugeMode, export.GaugeHistogramModeDistribution, export.GaugeHistogramModeGauge)
+
+	maxBucketsByMetric := a.Flag("export.histogram.max-buckets-by-metric", "Maximum number of buckets of the histograms of a metric in the form <metric>=<buckets>, overriding --export.histogram.max-buckets. Can be repeated.").
+		StringMap()
+
+	a.Flag("export.series-cache.state-file", "File the counter reset state of series is persisted to periodically and restored from on startup, so that restarts do not reset the start time of cumulative series. Must be on a volume that survives restarts, e.g. a hostPath volume for collectors. Not persisted if empty.").
+		Default("").StringVar(&opts.SeriesCache.StateFile)
+
+	a.Flag("export.label-sanitization.policy", fmt.Sprintf("Handling of metric labels that are not compatible with GCM. With %q, they are written as is and reported. With %q, they are sanitized or truncated before they are written and reported.", export.LabelPolicyPermissive, export.LabelPolicyStrict)).
+		Default(export.LabelPolicyPermissive).EnumVar(&opts.LabelSanitization.Policy, export.LabelPolicyPermissive, export.LabelPolicyStrict)
+
+	a.Flag("export.label-sanitization.log-samples", "Log a sample series with metric labels that are not compatible with GCM at most once per minute.").
+		Default("false").BoolVar(&opts.LabelSanitization.LogSamples)
+
+	resourceMappingsFile := a.Flag("export.resource-mappings-file", "A YAML file mapping time series to monitored resource types other than prometheus_target. Each mapping has a list of time series matchers, a monitored resource type, and the time series labels each resource label is populated from. Time series that match no mapping are written as prometheus_target.").
+		Default("").String()
+
+	sloFile := a.Flag("export.slo-file", "A YAML file of service level objectives that are written to the GCM API for selected time series, typically recorded by rules. A window of an objective is good if the mean of its time series is within a range.").
+		Default("").String()
+
 	a.Flag("export.token-url", "The request URL to generate token that's needed to ingest metrics to the project").
 		StringVar(&opts.TokenURL)
 
@@ -183,6 +430,42 @@ func FromFlags(a *kingpin.Application, userAgentProduct string) func(log.Logger,
 		Default("").OverrideDefaultFromEnvar("KUBE_NAME").String()
 
 	return func(logger log.Logger, metrics prometheus.Registerer) (*export.Exporter, error) {
+		if *resourceMappingsFile != "" {
+			var err error
+			opts.ResourceMappings, err = export.ReadResourceMappingsFile(*resourceMappingsFile)
+			if err != nil {
+				return nil, err
+			}
+		}
+		for metric, s := range *maxBucketsByMetric {
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid bucket limit for metric %q: %w", metric, err)
+			}
+			if opts.Histograms.MaxBucketsByMetric == nil {
+				opts.Histograms.MaxBucketsByMetric = map[string]int{}
+			}
+			opts.Histograms.MaxBucketsByMetric[metric] = n
+		}
+		for typ, action := range *typePolicy {
+			if opts.TypePolicy.Actions == nil {
+				opts.TypePolicy.Actions = map[textparse.MetricType]string{}
+			}
+			opts.TypePolicy.Actions[textparse.MetricType(typ)] = action
+		}
+		for metric, typ := range *metadataTypes {
+			if opts.Metadata.Types == nil {
+				opts.Metadata.Types = map[string]textparse.MetricType{}
+			}
+			opts.Metadata.Types[metric] = textparse.MetricType(typ)
+		}
+		if *sloFile != "" {
+			var err error
+			opts.ServiceLevelObjectives, err = export.ReadServiceLevelObjectivesFile(*sloFile)
+			if err != nil {
+				return nil, err
+			}
+		}
 		switch *haBackend {
 		case HABackendNone:
 		case HABackendKubernetes:
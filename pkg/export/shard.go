@@ -23,9 +23,12 @@ import (
 
 // shard holds a queue of data for a subset of samples.
 type shard struct {
-	mtx     sync.Mutex
-	queue   *queue
-	pending bool
+	mtx   sync.Mutex
+	queue *queue
+	// Optional queue for samples of high priority series, which are added to
+	// batches before the samples in queue.
+	priorityQueue *queue
+	pending       bool
 
 	// A cache of series IDs that have been added to the batch in fill already.
 	// It's only part of the struct to not re-allocate on each call to fill.
@@ -39,19 +42,63 @@ func newShard(queueSize uint) *shard {
 	}
 }
 
-func (s *shard) enqueue(hash uint64, sample *monitoring_pb.TimeSeries) {
+// enqueue adds the sample to the queue and drops it if the queue is full. It returns
+// whether the sample was added.
+func (s *shard) enqueue(e queueEntry) bool {
+	if !s.tryEnqueue(e) {
+		// TODO(freinartz): tail drop is not a great solution. Once we have the WAL buffer,
+		// we can just block here when enqueueing from it.
+		samplesDropped.WithLabelValues("queue-full").Inc()
+		return false
+	}
+	return true
+}
+
+// tryEnqueue adds the sample to the queue of its priority and returns false if the
+// queue is full. High priority samples are added to the regular queue if the shard
+// has no priority queue.
+func (s *shard) tryEnqueue(e queueEntry) bool {
 	s.mtx.Lock()
 	defer s.mtx.Unlock()
 
-	e := queueEntry{
-		hash:   hash,
-		sample: sample,
+	q := s.queue
+	if e.priority && s.priorityQueue != nil {
+		q = s.priorityQueue
 	}
-	if !s.queue.add(e) {
-		// TODO(freinartz): tail drop is not a great solution. Once we have the WAL buffer,
-		// we can just block here when enqueueing from it.
-		samplesDropped.WithLabelValues("queue-full").Inc()
+	if !q.add(e) {
+		return false
+	}
+	queuedSamples.Inc()
+	return true
+}
+
+// drain removes all samples from the queues and returns them, high priority
+// samples first.
+func (s *shard) drain() []queueEntry {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	var res []queueEntry
+	for _, q := range s.queues() {
+		for {
+			e, ok := q.peek()
+			if !ok {
+				break
+			}
+			q.remove()
+			res = append(res, e)
+		}
 	}
+	queuedSamples.Sub(float64(len(res)))
+	return res
+}
+
+// queues returns the queues of the shard in the order they are processed.
+func (s *shard) queues() []*queue {
+	if s.priorityQueue == nil {
+		return []*queue{s.queue}
+	}
+	return []*queue{s.priorityQueue, s.queue}
 }
 
 // fill adds samples to the batch until its capacity is reached or the shard
@@ -64,28 +111,34 @@ func (s *shard) fill(batch *batch) (took, remaining int) {
 
 	if s.pending {
 		shardProcessPending.Inc()
-		return 0, s.queue.length()
+		return 0, s.lengthLocked()
 	}
 	n := 0
 
-	for !batch.full() {
-		e, ok := s.queue.peek()
-		if !ok {
-			break
-		}
-
-		// If we already added a sample for the same series to the batch, stop
-		// the filling entirely.
-		if _, ok := s.seen[e.hash]; ok {
-			break
+	// High priority samples are taken first so that they are sent ahead of regular
+	// samples if the shard cannot be emptied in one batch.
+	for _, q := range s.queues() {
+		for !batch.full() {
+			e, ok := q.peek()
+			if !ok {
+				break
+			}
+
+			// If we already added a sample for the same series to the batch, stop
+			// the filling of the queue entirely.
+			if _, ok := s.seen[e.hash]; ok {
+				break
+			}
+			q.remove()
+
+			batch.add(e.sample)
+			s.seen[e.hash] = struct{}{}
+			n++
 		}
-		s.queue.remove()
-
-		batch.add(e.sample)
-		s.seen[e.hash] = struct{}{}
-		n++
 	}
 
+	queuedSamples.Sub(float64(n))
+
 	if n > 0 {
 		s.setPending(true)
 		batch.addShard(s)
@@ -96,7 +149,7 @@ func (s *shard) fill(batch *batch) (took, remaining int) {
 	for k := range s.seen {
 		delete(s.seen, k)
 	}
-	return n, s.queue.length()
+	return n, s.lengthLocked()
 }
 
 func (s *shard) setPending(b bool) {
@@ -107,6 +160,29 @@ func (s *shard) setPending(b bool) {
 	s.pending = b
 }
 
+// isPending returns whether the shard has samples in an in-flight batch.
+func (s *shard) isPending() bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.pending
+}
+
+// length returns the number of queued samples.
+func (s *shard) length() int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.lengthLocked()
+}
+
+// lengthLocked returns the number of queued samples. Must be called with mtx held.
+func (s *shard) lengthLocked() int {
+	n := s.queue.length()
+	if s.priorityQueue != nil {
+		n += s.priorityQueue.length()
+	}
+	return n
+}
+
 func (s *shard) notifyDone() {
 	s.mtx.Lock()
 	defer s.mtx.Unlock()
@@ -122,6 +198,8 @@ type queue struct {
 type queueEntry struct {
 	hash   uint64
 	sample *monitoring_pb.TimeSeries
+	// Whether the series is of high priority.
+	priority bool
 }
 
 func newQueue(size uint) *queue {
@@ -0,0 +1,128 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	shardCount = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "gcm_export_shards",
+		Help: "Current number of shards that track series to send.",
+	})
+	shardResizes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "gcm_export_shard_resizes_total",
+		Help: "Number of times the shards were resized by whether they were grown or shrunk.",
+	}, []string{"direction"})
+	shardUtilization = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "gcm_export_shard_utilization_ratio",
+		Help:    "Ratio of the buffer of each shard that is used, observed for every shard whenever resizing is considered.",
+		Buckets: []float64{0.01, 0.05, 0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.7, 0.8, 0.9, 1},
+	})
+)
+
+const (
+	// DefaultShardResizeInterval is the default interval at which the number of
+	// shards is reconsidered if resizing is enabled.
+	DefaultShardResizeInterval = time.Minute
+
+	// The shards are doubled if the buffer of any shard is used at least by this ratio
+	// and halved if the buffers of all shards are used less than this ratio.
+	shardGrowUtilization   = 0.5
+	shardShrinkUtilization = 0.1
+)
+
+// desiredShardCount returns the number of shards based on how full the buffer of the
+// fullest shard is. It must only be called from Run.
+func (e *Exporter) desiredShardCount() uint {
+	var maxLen int
+	for _, s := range e.shards {
+		n := s.length()
+		if n > maxLen {
+			maxLen = n
+		}
+		shardUtilization.Observe(float64(n) / float64(e.shardCapacity()))
+	}
+	return nextShardCount(
+		uint(len(e.shards)),
+		e.opts.Efficiency.MinShardCount,
+		e.opts.Efficiency.MaxShardCount,
+		float64(maxLen)/float64(e.shardCapacity()),
+	)
+}
+
+// nextShardCount returns the number of shards within the bounds given the current
+// number and the utilization of the fullest shard.
+func nextShardCount(cur, min, max uint, utilization float64) uint {
+	switch {
+	case utilization >= shardGrowUtilization && cur < max:
+		if cur*2 > max {
+			return max
+		}
+		return cur * 2
+	case utilization < shardShrinkUtilization && cur > min:
+		if cur/2 < min {
+			return min
+		}
+		return cur / 2
+	}
+	return cur
+}
+
+// resizeShards replaces the shards with n new shards and moves queued samples to the
+// shards of their series. It returns false without resizing if a shard has an in-flight
+// batch, as samples of its series could otherwise be sent out of order.
+// It must only be called from Run.
+func (e *Exporter) resizeShards(n uint) bool {
+	for _, s := range e.shards {
+		if s.isPending() {
+			return false
+		}
+	}
+	shards := make([]*shard, n)
+	for i := range shards {
+		shards[i] = e.newShard()
+	}
+	// Block enqueueing until the queued samples were moved so that they stay ahead
+	// of new samples of their series.
+	e.shardsMtx.Lock()
+	defer e.shardsMtx.Unlock()
+
+	direction := "grow"
+	if n < uint(len(e.shards)) {
+		direction = "shrink"
+	}
+	level.Info(e.logger).Log("msg", "resizing shards", "from", len(e.shards), "to", n)
+
+	for _, s := range e.shards {
+		for _, qe := range s.drain() {
+			// Shrinking may exceed the buffer of a shard if the series of the merged
+			// shards were not distributed evenly.
+			if !shards[qe.hash%uint64(n)].tryEnqueue(qe) {
+				samplesDropped.WithLabelValues("queue-full").Inc()
+			}
+		}
+	}
+	e.shards = shards
+
+	shardResizes.WithLabelValues(direction).Inc()
+	shardCount.Set(float64(n))
+	queueCapacity.Set(float64(n * e.shardCapacity()))
+	return true
+}
@@ -0,0 +1,96 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNextShardCount(t *testing.T) {
+	cases := []struct {
+		cur, min, max uint
+		utilization   float64
+		want          uint
+	}{
+		{cur: 16, min: 1, max: 64, utilization: 0.3, want: 16},
+		{cur: 16, min: 1, max: 64, utilization: 0.5, want: 32},
+		{cur: 48, min: 1, max: 64, utilization: 0.9, want: 64},
+		{cur: 64, min: 1, max: 64, utilization: 1, want: 64},
+		{cur: 16, min: 1, max: 64, utilization: 0.05, want: 8},
+		{cur: 16, min: 12, max: 64, utilization: 0, want: 12},
+		{cur: 12, min: 12, max: 64, utilization: 0, want: 12},
+	}
+	for _, c := range cases {
+		if got := nextShardCount(c.cur, c.min, c.max, c.utilization); got != c.want {
+			t.Errorf("nextShardCount(%d, %d, %d, %v): expected %d, got %d", c.cur, c.min, c.max, c.utilization, c.want, got)
+		}
+	}
+}
+
+func TestNew_shardResizeBounds(t *testing.T) {
+	for _, eff := range []EfficiencyOpts{
+		{ShardCount: 8, MinShardCount: 16, MaxShardCount: 32},
+		{ShardCount: 64, MinShardCount: 16, MaxShardCount: 32},
+		{ShardCount: 16, MaxShardCount: 32, ShardResizeInterval: -1},
+	} {
+		if _, err := New(nil, nil, ExporterOpts{DisableAuth: true, Efficiency: eff}); err == nil {
+			t.Errorf("expected error for %+v", eff)
+		}
+	}
+}
+
+func TestExporter_resizeShards(t *testing.T) {
+	e, err := New(nil, nil, ExporterOpts{
+		DisableAuth: true,
+		Efficiency:  EfficiencyOpts{ShardCount: 4, ShardBufferSize: 10, MaxShardCount: 8},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		e.enqueue(queueEntry{hash: uint64(i % 5), sample: diskBufferSample(int64(i))})
+	}
+	// Resizing is deferred while a shard has an in-flight batch.
+	e.shards[1].setPending(true)
+	if e.resizeShards(8) {
+		t.Fatal("expected resize to be deferred")
+	}
+	e.shards[1].notifyDone()
+	if !e.resizeShards(8) {
+		t.Fatal("expected resize to succeed")
+	}
+	if len(e.shards) != 8 {
+		t.Fatalf("expected 8 shards, got %d", len(e.shards))
+	}
+	// Queued samples are moved to the shard of their series in order.
+	for i, s := range e.shards {
+		var got []int64
+		for _, qe := range s.drain() {
+			if qe.hash%8 != uint64(i) {
+				t.Errorf("sample with hash %d in shard %d", qe.hash, i)
+			}
+			got = append(got, qe.sample.Points[0].Value.GetInt64Value())
+		}
+		if i != 0 {
+			continue
+		}
+		// Shard 0 held the samples with hash 0 before and after the resize.
+		if diff := cmp.Diff([]int64{0, 5, 10, 15}, got); diff != "" {
+			t.Errorf("unexpected values (-want, +got): %s", diff)
+		}
+	}
+}
@@ -12,7 +12,7 @@ func TestEnqueue(t *testing.T) {
 
 	ch := make(chan bool)
 	go func() {
-		s.enqueue(1, nil)
+		s.enqueue(queueEntry{hash: 1})
 		ch <- true
 	}()
 
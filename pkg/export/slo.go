@@ -0,0 +1,372 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	gax "github.com/googleapis/gax-go/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+	monitoring_pb "google.golang.org/genproto/googleapis/monitoring/v3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"gopkg.in/yaml.v2"
+)
+
+var serviceLevelObjectiveWrites = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "gcm_export_slo_writes_total",
+	Help: "Number of service level objectives written to GCM by whether the write succeeded, failed, or was dropped because the queue was full.",
+}, []string{"result"})
+
+const (
+	// DefaultSLORollingPeriod is the default period service level objectives are
+	// evaluated over.
+	DefaultSLORollingPeriod = 28 * 24 * time.Hour
+	// DefaultSLOWindowPeriod is the default duration of the windows that are
+	// classified as good or bad.
+	DefaultSLOWindowPeriod = 5 * time.Minute
+
+	// Number of service level objectives that can be queued for writing.
+	sloQueueSize = 100
+)
+
+// ServiceLevelObjective is a service level objective in GCM that is evaluated against
+// exported series, typically the availability or latency ratio of a service recorded
+// by a rule. A window of the objective is good if the mean of the series in the
+// window is within [Min, Max].
+type ServiceLevelObjective struct {
+	// Service is the ID of the custom service in GCM the objective belongs to. The
+	// service is created if it does not exist.
+	Service string
+	// ID of the objective within the service.
+	ID string
+	// DisplayName of the objective in GCM.
+	DisplayName string
+	// Selector selects the series the objective is evaluated against. It must match
+	// the metric name exactly. Its matchers are translated into the filter of the
+	// objective in GCM.
+	Selector labels.Selector
+	// Min and Max are the bounds of the series values of good windows.
+	Min, Max float64
+	// Goal is the fraction of windows that must be good, e.g. 0.999.
+	Goal float64
+	// RollingPeriod is the period the goal applies to. It must be a whole number of
+	// days. Defaults to DefaultSLORollingPeriod when 0.
+	RollingPeriod time.Duration
+	// WindowPeriod is the duration of the windows. It must be a whole number of
+	// minutes. Defaults to DefaultSLOWindowPeriod when 0.
+	WindowPeriod time.Duration
+}
+
+func (o *ServiceLevelObjective) validate() error {
+	if o.RollingPeriod == 0 {
+		o.RollingPeriod = DefaultSLORollingPeriod
+	}
+	if o.WindowPeriod == 0 {
+		o.WindowPeriod = DefaultSLOWindowPeriod
+	}
+	if o.Service == "" || o.ID == "" {
+		return fmt.Errorf("service level objective requires a service and an ID")
+	}
+	if o.metricName() == "" {
+		return fmt.Errorf("service level objective %q must select an exact metric name", o.ID)
+	}
+	if o.Min > o.Max {
+		return fmt.Errorf("service level objective %q has a minimum %v above its maximum %v", o.ID, o.Min, o.Max)
+	}
+	if o.Goal <= 0 || o.Goal >= 1 {
+		return fmt.Errorf("service level objective %q must have a goal between 0 and 1, got %v", o.ID, o.Goal)
+	}
+	const day = 24 * time.Hour
+	if o.RollingPeriod%day != 0 || o.RollingPeriod < day || o.RollingPeriod > 30*day {
+		return fmt.Errorf("service level objective %q must have a rolling period of 1 to 30 days, got %s", o.ID, o.RollingPeriod)
+	}
+	if o.WindowPeriod%time.Minute != 0 || o.WindowPeriod < time.Minute || o.WindowPeriod > day {
+		return fmt.Errorf("service level objective %q must have a window period of whole minutes up to a day, got %s", o.ID, o.WindowPeriod)
+	}
+	return nil
+}
+
+// metricName returns the metric name the selector matches exactly.
+func (o *ServiceLevelObjective) metricName() string {
+	for _, m := range o.Selector {
+		if m.Name == labels.MetricName && m.Type == labels.MatchEqual {
+			return m.Value
+		}
+	}
+	return ""
+}
+
+// ReadServiceLevelObjectivesFile reads service level objectives from a YAML file of
+// the form:
+//
+//	objectives:
+//	- service: checkout
+//	  id: availability
+//	  displayName: Checkout availability
+//	  match: '{__name__="service:availability:ratio_rate5m", service="checkout"}'
+//	  min: 0.99
+//	  max: 1
+//	  goal: 0.995
+//	  rollingPeriod: 28d
+//	  windowPeriod: 5m
+func ReadServiceLevelObjectivesFile(filename string) ([]ServiceLevelObjective, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("read service level objectives file: %w", err)
+	}
+	var file struct {
+		Objectives []struct {
+			Service       string         `yaml:"service"`
+			ID            string         `yaml:"id"`
+			DisplayName   string         `yaml:"displayName"`
+			Match         string         `yaml:"match"`
+			Min           float64        `yaml:"min"`
+			Max           float64        `yaml:"max"`
+			Goal          float64        `yaml:"goal"`
+			RollingPeriod model.Duration `yaml:"rollingPeriod"`
+			WindowPeriod  model.Duration `yaml:"windowPeriod"`
+		} `yaml:"objectives"`
+	}
+	if err := yaml.UnmarshalStrict(b, &file); err != nil {
+		return nil, fmt.Errorf("service level objectives file %q: %w", filename, err)
+	}
+	objectives := make([]ServiceLevelObjective, 0, len(file.Objectives))
+	for _, e := range file.Objectives {
+		sel, err := parser.ParseMetricSelector(e.Match)
+		if err != nil {
+			return nil, fmt.Errorf("service level objectives file %q: invalid matcher %q: %w", filename, e.Match, err)
+		}
+		objectives = append(objectives, ServiceLevelObjective{
+			Service:       e.Service,
+			ID:            e.ID,
+			DisplayName:   e.DisplayName,
+			Selector:      sel,
+			Min:           e.Min,
+			Max:           e.Max,
+			Goal:          e.Goal,
+			RollingPeriod: time.Duration(e.RollingPeriod),
+			WindowPeriod:  time.Duration(e.WindowPeriod),
+		})
+	}
+	return objectives, nil
+}
+
+// serviceMonitoringClient is the subset of the GCM service monitoring API used to
+// write service level objectives.
+type serviceMonitoringClient interface {
+	GetService(context.Context, *monitoring_pb.GetServiceRequest, ...gax.CallOption) (*monitoring_pb.Service, error)
+	CreateService(context.Context, *monitoring_pb.CreateServiceRequest, ...gax.CallOption) (*monitoring_pb.Service, error)
+	CreateServiceLevelObjective(context.Context, *monitoring_pb.CreateServiceLevelObjectiveRequest, ...gax.CallOption) (*monitoring_pb.ServiceLevelObjective, error)
+	UpdateServiceLevelObjective(context.Context, *monitoring_pb.UpdateServiceLevelObjectiveRequest, ...gax.CallOption) (*monitoring_pb.ServiceLevelObjective, error)
+}
+
+type sloKey struct {
+	project   string
+	objective int
+}
+
+type sloRequest struct {
+	sloKey
+	// Filter selecting the series of the objective in GCM.
+	filter string
+}
+
+// sloWriter writes service level objectives for exported series. An objective is
+// written once per project and process lifetime when the first series it selects is
+// exported to the project, which resolves the metric and monitored resource types
+// the objective filters on.
+type sloWriter struct {
+	logger     log.Logger
+	objectives []ServiceLevelObjective
+	queue      chan sloRequest
+
+	mtx sync.Mutex
+	// Set of written or queued objectives.
+	written map[sloKey]struct{}
+}
+
+func newSLOWriter(logger log.Logger, objectives []ServiceLevelObjective) *sloWriter {
+	return &sloWriter{
+		logger:     logger,
+		objectives: objectives,
+		queue:      make(chan sloRequest, sloQueueSize),
+		written:    map[sloKey]struct{}{},
+	}
+}
+
+// selects returns whether any objective selects the series labels.
+func (w *sloWriter) selects(lset labels.Labels) bool {
+	if w == nil {
+		return false
+	}
+	for _, o := range w.objectives {
+		if o.Selector.Matches(lset) {
+			return true
+		}
+	}
+	return false
+}
+
+// add queues the objectives selecting the series labels that were not written for the
+// project of the series yet.
+func (w *sloWriter) add(lset labels.Labels, series *monitoring_pb.TimeSeries) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	for i, o := range w.objectives {
+		if !o.Selector.Matches(lset) {
+			continue
+		}
+		key := sloKey{project: series.Resource.Labels[KeyProjectID], objective: i}
+		if _, ok := w.written[key]; ok {
+			continue
+		}
+		select {
+		case w.queue <- sloRequest{sloKey: key, filter: sloFilter(o.Selector, series)}:
+			w.written[key] = struct{}{}
+		default:
+			// The objective is queued again when the series is refreshed.
+			serviceLevelObjectiveWrites.WithLabelValues("dropped").Inc()
+		}
+	}
+}
+
+// sloFilter returns a GCM filter for the series of the metric and monitored resource
+// type of the series that match the selector. Matchers on labels that are resource
+// labels of the series filter on the resource.
+func sloFilter(sel labels.Selector, series *monitoring_pb.TimeSeries) string {
+	filters := []string{
+		fmt.Sprintf("metric.type=%q", series.Metric.Type),
+		fmt.Sprintf("resource.type=%q", series.Resource.Type),
+	}
+	for _, m := range sel {
+		if m.Name == labels.MetricName {
+			continue
+		}
+		field := "metric.labels." + m.Name
+		if _, ok := series.Resource.Labels[m.Name]; ok {
+			field = "resource.labels." + m.Name
+		}
+		switch m.Type {
+		case labels.MatchEqual:
+			filters = append(filters, fmt.Sprintf("%s=%q", field, m.Value))
+		case labels.MatchNotEqual:
+			filters = append(filters, fmt.Sprintf("%s!=%q", field, m.Value))
+		case labels.MatchRegexp:
+			filters = append(filters, fmt.Sprintf("%s=monitoring.regex.full_match(%q)", field, m.Value))
+		case labels.MatchNotRegexp:
+			filters = append(filters, fmt.Sprintf("NOT %s=monitoring.regex.full_match(%q)", field, m.Value))
+		}
+	}
+	return strings.Join(filters, " AND ")
+}
+
+// run writes queued objectives until the context is canceled.
+func (w *sloWriter) run(ctx context.Context, client serviceMonitoringClient) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case req := <-w.queue:
+			o := w.objectives[req.objective]
+
+			if err := w.write(ctx, client, req); err != nil {
+				level.Error(w.logger).Log("msg", "writing service level objective failed", "project", req.project, "service", o.Service, "objective", o.ID, "err", err)
+				serviceLevelObjectiveWrites.WithLabelValues("error").Inc()
+
+				// Allow another attempt on the next refresh of a selected series.
+				if errorClass(err) == errorClassRetryable {
+					w.mtx.Lock()
+					delete(w.written, req.sloKey)
+					w.mtx.Unlock()
+				}
+				continue
+			}
+			serviceLevelObjectiveWrites.WithLabelValues("success").Inc()
+		}
+	}
+}
+
+// write creates the service of the objective if it does not exist and creates or
+// replaces the objective.
+func (w *sloWriter) write(ctx context.Context, client serviceMonitoringClient, req sloRequest) error {
+	o := w.objectives[req.objective]
+	parent := fmt.Sprintf("projects/%s", req.project)
+	service := fmt.Sprintf("%s/services/%s", parent, o.Service)
+
+	_, err := client.GetService(ctx, &monitoring_pb.GetServiceRequest{Name: service})
+	if status.Code(err) == codes.NotFound {
+		_, err = client.CreateService(ctx, &monitoring_pb.CreateServiceRequest{
+			Parent:    parent,
+			ServiceId: o.Service,
+			Service: &monitoring_pb.Service{
+				DisplayName: o.Service,
+				Identifier:  &monitoring_pb.Service_Custom_{Custom: &monitoring_pb.Service_Custom{}},
+			},
+		})
+		if status.Code(err) == codes.AlreadyExists {
+			err = nil
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	slo := &monitoring_pb.ServiceLevelObjective{
+		Name:        fmt.Sprintf("%s/serviceLevelObjectives/%s", service, o.ID),
+		DisplayName: o.DisplayName,
+		Goal:        o.Goal,
+		Period: &monitoring_pb.ServiceLevelObjective_RollingPeriod{
+			RollingPeriod: durationpb.New(o.RollingPeriod),
+		},
+		ServiceLevelIndicator: &monitoring_pb.ServiceLevelIndicator{
+			Type: &monitoring_pb.ServiceLevelIndicator_WindowsBased{
+				WindowsBased: &monitoring_pb.WindowsBasedSli{
+					WindowCriterion: &monitoring_pb.WindowsBasedSli_MetricMeanInRange{
+						MetricMeanInRange: &monitoring_pb.WindowsBasedSli_MetricRange{
+							TimeSeries: req.filter,
+							Range:      &monitoring_pb.Range{Min: o.Min, Max: o.Max},
+						},
+					},
+					WindowPeriod: durationpb.New(o.WindowPeriod),
+				},
+			},
+		},
+	}
+	_, err = client.UpdateServiceLevelObjective(ctx, &monitoring_pb.UpdateServiceLevelObjectiveRequest{
+		ServiceLevelObjective: slo,
+	})
+	if status.Code(err) == codes.NotFound {
+		slo.Name = ""
+		_, err = client.CreateServiceLevelObjective(ctx, &monitoring_pb.CreateServiceLevelObjectiveRequest{
+			Parent:                  service,
+			ServiceLevelObjectiveId: o.ID,
+			ServiceLevelObjective:   slo,
+		})
+	}
+	return err
+}
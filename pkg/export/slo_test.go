@@ -0,0 +1,212 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	gax "github.com/googleapis/gax-go/v2"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+	metric_pb "google.golang.org/genproto/googleapis/api/metric"
+	monitoredres_pb "google.golang.org/genproto/googleapis/api/monitoredres"
+	monitoring_pb "google.golang.org/genproto/googleapis/monitoring/v3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestReadServiceLevelObjectivesFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "slos.yaml")
+	content := `
+objectives:
+- service: checkout
+  id: availability
+  match: '{__name__="service:availability:ratio_rate5m", service="checkout"}'
+  min: 0.99
+  max: 1
+  goal: 0.995
+  rollingPeriod: 7d
+`
+	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	objectives, err := ReadServiceLevelObjectivesFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objectives) != 1 {
+		t.Fatalf("expected 1 objective, got %d", len(objectives))
+	}
+	o := objectives[0]
+	if err := o.validate(); err != nil {
+		t.Fatal(err)
+	}
+	if o.Service != "checkout" || o.ID != "availability" || o.Goal != 0.995 || o.Min != 0.99 || o.Max != 1 {
+		t.Errorf("unexpected objective %+v", o)
+	}
+	if o.RollingPeriod != 7*24*time.Hour || o.WindowPeriod != DefaultSLOWindowPeriod {
+		t.Errorf("unexpected periods %s and %s", o.RollingPeriod, o.WindowPeriod)
+	}
+	if got := o.metricName(); got != "service:availability:ratio_rate5m" {
+		t.Errorf("unexpected metric name %q", got)
+	}
+
+	if err := os.WriteFile(filename, []byte("objectives:\n- match: '{'\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadServiceLevelObjectivesFile(filename); err == nil {
+		t.Errorf("expected error for invalid matcher")
+	}
+}
+
+func mustParseMetricSelector(s string) labels.Selector {
+	sel, err := parser.ParseMetricSelector(s)
+	if err != nil {
+		panic(err)
+	}
+	return sel
+}
+
+func TestServiceLevelObjective_validate(t *testing.T) {
+	sel := mustParseMetricSelector
+	valid := ServiceLevelObjective{
+		Service:  "s",
+		ID:       "o",
+		Selector: sel(`{__name__="ratio"}`),
+		Max:      1,
+		Goal:     0.99,
+	}
+	for _, mod := range []func(o *ServiceLevelObjective){
+		func(o *ServiceLevelObjective) { o.Service = "" },
+		func(o *ServiceLevelObjective) { o.Selector = sel(`{__name__=~"ratio.*"}`) },
+		func(o *ServiceLevelObjective) { o.Min = 2 },
+		func(o *ServiceLevelObjective) { o.Goal = 1 },
+		func(o *ServiceLevelObjective) { o.RollingPeriod = 36 * time.Hour },
+		func(o *ServiceLevelObjective) { o.RollingPeriod = 31 * 24 * time.Hour },
+		func(o *ServiceLevelObjective) { o.WindowPeriod = 90 * time.Second },
+	} {
+		o := valid
+		mod(&o)
+		if err := o.validate(); err == nil {
+			t.Errorf("expected error for %+v", o)
+		}
+	}
+	if err := valid.validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type fakeServiceMonitoringClient struct {
+	services map[string]*monitoring_pb.Service
+	slos     map[string]*monitoring_pb.ServiceLevelObjective
+}
+
+func (c *fakeServiceMonitoringClient) GetService(_ context.Context, req *monitoring_pb.GetServiceRequest, _ ...gax.CallOption) (*monitoring_pb.Service, error) {
+	if s, ok := c.services[req.Name]; ok {
+		return s, nil
+	}
+	return nil, status.Error(codes.NotFound, "service not found")
+}
+
+func (c *fakeServiceMonitoringClient) CreateService(_ context.Context, req *monitoring_pb.CreateServiceRequest, _ ...gax.CallOption) (*monitoring_pb.Service, error) {
+	c.services[req.Parent+"/services/"+req.ServiceId] = req.Service
+	return req.Service, nil
+}
+
+func (c *fakeServiceMonitoringClient) CreateServiceLevelObjective(_ context.Context, req *monitoring_pb.CreateServiceLevelObjectiveRequest, _ ...gax.CallOption) (*monitoring_pb.ServiceLevelObjective, error) {
+	if _, ok := c.services[req.Parent]; !ok {
+		return nil, status.Error(codes.NotFound, "service not found")
+	}
+	c.slos[req.Parent+"/serviceLevelObjectives/"+req.ServiceLevelObjectiveId] = req.ServiceLevelObjective
+	return req.ServiceLevelObjective, nil
+}
+
+func (c *fakeServiceMonitoringClient) UpdateServiceLevelObjective(_ context.Context, req *monitoring_pb.UpdateServiceLevelObjectiveRequest, _ ...gax.CallOption) (*monitoring_pb.ServiceLevelObjective, error) {
+	if _, ok := c.slos[req.ServiceLevelObjective.Name]; !ok {
+		return nil, status.Error(codes.NotFound, "objective not found")
+	}
+	c.slos[req.ServiceLevelObjective.Name] = req.ServiceLevelObjective
+	return req.ServiceLevelObjective, nil
+}
+
+func TestSLOWriter(t *testing.T) {
+	objectives := []ServiceLevelObjective{
+		{
+			Service:  "checkout",
+			ID:       "availability",
+			Selector: mustParseMetricSelector(`{__name__="ratio", job="checkout", code!~"5.."}`),
+			Min:      0.99,
+			Max:      1,
+			Goal:     0.995,
+		},
+	}
+	if err := objectives[0].validate(); err != nil {
+		t.Fatal(err)
+	}
+	w := newSLOWriter(nil, objectives)
+
+	series := &monitoring_pb.TimeSeries{
+		Metric: &metric_pb.Metric{Type: "prometheus.googleapis.com/ratio/gauge"},
+		Resource: &monitoredres_pb.MonitoredResource{
+			Type:   "prometheus_target",
+			Labels: map[string]string{KeyProjectID: "p1", KeyJob: "checkout"},
+		},
+	}
+	// Non-matching series are ignored and matching ones are queued once per project.
+	w.add(labels.FromStrings("__name__", "ratio", "job", "other"), series)
+	w.add(labels.FromStrings("__name__", "ratio", "job", "checkout"), series)
+	w.add(labels.FromStrings("__name__", "ratio", "job", "checkout", "code", "200"), series)
+	if len(w.queue) != 1 {
+		t.Fatalf("expected 1 queued objective, got %d", len(w.queue))
+	}
+	req := <-w.queue
+
+	wantFilter := `metric.type="prometheus.googleapis.com/ratio/gauge" AND resource.type="prometheus_target" AND resource.labels.job="checkout" AND NOT metric.labels.code=monitoring.regex.full_match("5..")`
+	if req.filter != wantFilter {
+		t.Errorf("expected filter\n%s\ngot\n%s", wantFilter, req.filter)
+	}
+
+	client := &fakeServiceMonitoringClient{
+		services: map[string]*monitoring_pb.Service{},
+		slos:     map[string]*monitoring_pb.ServiceLevelObjective{},
+	}
+	// The first write creates the service and objective, the second one updates it.
+	for i := 0; i < 2; i++ {
+		if err := w.write(context.Background(), client, req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok := client.services["projects/p1/services/checkout"]; !ok {
+		t.Errorf("service was not created")
+	}
+	slo, ok := client.slos["projects/p1/services/checkout/serviceLevelObjectives/availability"]
+	if !ok {
+		t.Fatalf("objective was not created")
+	}
+	if slo.Goal != 0.995 || slo.GetRollingPeriod().AsDuration() != DefaultSLORollingPeriod {
+		t.Errorf("unexpected objective %v", slo)
+	}
+	sli := slo.ServiceLevelIndicator.GetWindowsBased()
+	if got := sli.GetMetricMeanInRange().TimeSeries; got != wantFilter {
+		t.Errorf("unexpected filter %q", got)
+	}
+	if got := sli.WindowPeriod.AsDuration(); got != DefaultSLOWindowPeriod {
+		t.Errorf("unexpected window period %s", got)
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/storage"
+)
+
+var staleSeries = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "gcm_export_stale_series",
+	Help: "Number of cached series whose last sample was a staleness marker.",
+})
+
+// Supported modes for handling staleness markers. Cloud Monitoring has no equivalent of
+// staleness markers, so they are never written.
+const (
+	// The series silently stops. If it reappears, its cumulative points continue from
+	// before the gap.
+	StalenessModeSilent = "silent"
+	// The staleness marker ends the series. If it reappears, it starts a new cumulative
+	// interval like a new series, so that the gap is attributed to the series ending.
+	StalenessModeEnd = "end"
+)
+
+// markStale records a staleness marker for the series. In StalenessModeEnd, its counter
+// reset state is cleared.
+func (c *seriesCache) markStale(ref storage.SeriesRef) {
+	s := c.stripe(ref)
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	e, ok := s.entries[ref]
+	if !ok {
+		return
+	}
+	c.setStale(e, true)
+
+	if c.stalenessMode == StalenessModeEnd {
+		e.hasReset = false
+		e.resetValue, e.lastValue = 0, 0
+		e.resetTimestamp, e.lastTimestamp = 0, 0
+		e.resetHistogram, e.lastHistogram = nil, nil
+	}
+}
+
+// setStale updates whether the last sample of the series was a staleness marker.
+// Must be called with the lock of the entry's stripe held.
+func (c *seriesCache) setStale(e *seriesCacheEntry, stale bool) {
+	if e.stale == stale {
+		return
+	}
+	e.stale = stale
+	if stale {
+		staleSeries.Set(float64(c.stale.Add(1)))
+	} else {
+		staleSeries.Set(float64(c.stale.Add(-1)))
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/textparse"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb/record"
+)
+
+func TestSeriesCache_markStale(t *testing.T) {
+	externalLabels := labels.FromStrings("project_id", "p1", "location", "l1")
+	metadata := testMetadataFunc(metricMetadataMap{
+		"metric1_total": {Type: textparse.MetricTypeCounter},
+	})
+	cases := []struct {
+		mode string
+		// Whether the first sample after the staleness marker continues the series.
+		wantContinued bool
+	}{
+		{mode: StalenessModeSilent, wantContinued: true},
+		{mode: StalenessModeEnd, wantContinued: false},
+	}
+	for _, c := range cases {
+		t.Run(c.mode, func(t *testing.T) {
+			cache := newSeriesCache(nil, nil, MetricTypePrefix, nil)
+			cache.stalenessMode = c.mode
+			cache.getLabelsByRef = func(storage.SeriesRef) labels.Labels {
+				return labels.FromStrings("__name__", "metric1_total")
+			}
+			for i, ts := range []int64{1000, 2000} {
+				cache.get(record.RefSample{Ref: 1, T: ts}, externalLabels, metadata)
+				if _, _, ok := cache.getResetAdjusted(1, ts, float64(10*(i+1))); ok != (i > 0) {
+					t.Fatalf("unexpected result for sample %d", i)
+				}
+			}
+			// Markers of unknown series are ignored.
+			cache.markStale(2)
+			cache.markStale(1)
+			if !cache.entry(1).stale || testutil.ToFloat64(staleSeries) != 1 {
+				t.Fatalf("expected series to be stale")
+			}
+
+			cache.get(record.RefSample{Ref: 1, T: 5000}, externalLabels, metadata)
+			if cache.entry(1).stale || testutil.ToFloat64(staleSeries) != 0 {
+				t.Errorf("expected series to no longer be stale")
+			}
+			rt, v, ok := cache.getResetAdjusted(1, 5000, 30)
+			if ok != c.wantContinued {
+				t.Fatalf("expected continued=%t, got %t", c.wantContinued, ok)
+			}
+			if ok && (rt != 1000 || v != 20) {
+				t.Errorf("unexpected continued sample %d, %v", rt, v)
+			}
+		})
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"sync"
 
 	"github.com/prometheus/prometheus/config"
+	"github.com/prometheus/prometheus/model/histogram"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/storage"
 	"github.com/prometheus/prometheus/tsdb/chunks"
@@ -78,13 +79,16 @@ func (s *Storage) setLabels(lset labels.Labels) storage.SeriesRef {
 	return h
 }
 
-func (s *Storage) clearLabels(samples []record.RefSample) {
+func (s *Storage) clearLabels(samples []record.RefSample, histograms []record.RefHistogramSample) {
 	s.mtx.Lock()
 	defer s.mtx.Unlock()
 
 	for _, sample := range samples {
 		delete(s.labels, storage.SeriesRef(sample.Ref))
 	}
+	for _, sample := range histograms {
+		delete(s.labels, storage.SeriesRef(sample.Ref))
+	}
 }
 
 // Appender returns a new Appender.
@@ -100,8 +104,9 @@ type storageAppender struct {
 	// are expected and intended if a method is used unexpectedly.
 	storage.Appender
 
-	storage *Storage
-	samples []record.RefSample
+	storage    *Storage
+	samples    []record.RefSample
+	histograms []record.RefHistogramSample
 }
 
 func (a *storageAppender) Append(_ storage.SeriesRef, lset labels.Labels, t int64, v float64) (storage.SeriesRef, error) {
@@ -117,6 +122,19 @@ func (a *storageAppender) Append(_ storage.SeriesRef, lset labels.Labels, t int6
 	return 0, nil
 }
 
+func (a *storageAppender) AppendHistogram(_ storage.SeriesRef, lset labels.Labels, t int64, h *histogram.Histogram) (storage.SeriesRef, error) {
+	if lset == nil {
+		return 0, errors.New("label set is nil")
+	}
+	a.histograms = append(a.histograms, record.RefHistogramSample{
+		Ref: chunks.HeadSeriesRef(a.storage.setLabels(lset)),
+		T:   t,
+		H:   h,
+	})
+	// Return 0 ID to indicate that we don't support fast path appending.
+	return 0, nil
+}
+
 func (a *storageAppender) Commit() error {
 	// This method is used to export rule results. It's generally safe to assume that
 	// they are of type gauge. Thus we pass in a metadata func that always returns the
@@ -126,9 +144,12 @@ func (a *storageAppender) Commit() error {
 	// Exemplars can be nil since rules do not query for exemplars.
 	// This support is raised in https://github.com/prometheus/prometheus/issues/8798.
 	a.storage.exporter.Export(gaugeMetadata, a.samples, nil)
+	if len(a.histograms) > 0 {
+		a.storage.exporter.ExportHistograms(nil, a.histograms, nil)
+	}
 
 	// After export is complete, we can clear the labels again.
-	a.storage.clearLabels(a.samples)
+	a.storage.clearLabels(a.samples, a.histograms)
 
 	return nil
 }
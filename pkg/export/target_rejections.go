@@ -0,0 +1,117 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	monitoring_pb "google.golang.org/genproto/googleapis/monitoring/v3"
+)
+
+// TargetSamplesRejectedMetric is the name of the counter of samples rejected by GCM by
+// the target they were scraped from. The operator reads it from the collectors to report
+// rejected samples in the status of the monitoring resources.
+const TargetSamplesRejectedMetric = "gcm_export_target_samples_rejected_total"
+
+var targetSamplesRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: TargetSamplesRejectedMetric,
+	Help: "Number of samples rejected by GCM by the namespace, job, and instance of the target they were scraped from and the reason. Targets without rejections for an hour are removed.",
+}, []string{KeyNamespace, KeyJob, KeyInstance, "reason"})
+
+// targetRejectionsTTL is the time after which the counters of a target without further
+// rejections are removed.
+const targetRejectionsTTL = time.Hour
+
+// Drop reasons for which the samples were rejected because of their content rather than
+// the state of the API, which the owners of the target can act on.
+var targetRejectionReasons = map[string]bool{
+	"invalid-labels":  true,
+	"too-old":         true,
+	"cardinality":     true,
+	"invalid-request": true,
+}
+
+type targetRejectionKey struct {
+	namespace, job, instance, reason string
+}
+
+// targetRejections counts samples rejected by GCM by their target.
+type targetRejections struct {
+	mtx sync.Mutex
+	// Time of the last rejection by target and reason.
+	last map[targetRejectionKey]time.Time
+}
+
+func newTargetRejections() *targetRejections {
+	return &targetRejections{last: map[targetRejectionKey]time.Time{}}
+}
+
+// add counts the series of a request that failed with the given drop reason as rejected
+// by their targets. GCM does not report which series of a request were invalid, so all
+// of them are counted.
+func (r *targetRejections) add(series []*monitoring_pb.TimeSeries, reason string, now time.Time) {
+	if !targetRejectionReasons[reason] {
+		return
+	}
+	counts := map[targetRejectionKey]int{}
+	for _, s := range series {
+		labels := s.Resource.Labels
+		counts[targetRejectionKey{
+			namespace: labels[KeyNamespace],
+			job:       labels[KeyJob],
+			instance:  labels[KeyInstance],
+			reason:    reason,
+		}]++
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	for k, n := range counts {
+		targetSamplesRejected.WithLabelValues(k.namespace, k.job, k.instance, k.reason).Add(float64(n))
+		r.last[k] = now
+	}
+}
+
+// run removes the counters of targets without recent rejections until the context
+// is canceled.
+func (r *targetRejections) run(ctx context.Context) {
+	ticker := time.NewTicker(targetRejectionsTTL / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			r.gc(now.Add(-targetRejectionsTTL))
+		}
+	}
+}
+
+// gc removes the counters of targets whose last rejection is before the given time.
+func (r *targetRejections) gc(before time.Time) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	for k, t := range r.last {
+		if t.Before(before) {
+			targetSamplesRejected.DeleteLabelValues(k.namespace, k.job, k.instance, k.reason)
+			delete(r.last, k)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	monitoredres_pb "google.golang.org/genproto/googleapis/api/monitoredres"
+	monitoring_pb "google.golang.org/genproto/googleapis/monitoring/v3"
+)
+
+func TestTargetRejections(t *testing.T) {
+	targetSamplesRejected.Reset()
+	r := newTargetRejections()
+
+	series := func(instance string) *monitoring_pb.TimeSeries {
+		return &monitoring_pb.TimeSeries{
+			Resource: &monitoredres_pb.MonitoredResource{
+				Labels: map[string]string{KeyNamespace: "ns1", KeyJob: "app", KeyInstance: instance},
+			},
+		}
+	}
+	start := time.Unix(1000, 0)
+	l := []*monitoring_pb.TimeSeries{series("a:80"), series("a:80"), series("b:80")}
+
+	r.add(l, "invalid-labels", start)
+	r.add(l[2:], "cardinality", start.Add(time.Hour))
+	// Failures that are not caused by the samples are not attributed to their targets.
+	r.add(l, "quota", start)
+
+	if got := testutil.ToFloat64(targetSamplesRejected.WithLabelValues("ns1", "app", "a:80", "invalid-labels")); got != 2 {
+		t.Errorf("expected 2 rejected samples for target a, got %v", got)
+	}
+	if got := testutil.CollectAndCount(targetSamplesRejected); got != 3 {
+		t.Errorf("expected 3 counters, got %d", got)
+	}
+
+	r.gc(start.Add(time.Minute))
+	if got := testutil.CollectAndCount(targetSamplesRejected); got != 1 {
+		t.Errorf("expected 1 counter after GC, got %d", got)
+	}
+	if got := testutil.ToFloat64(targetSamplesRejected.WithLabelValues("ns1", "app", "b:80", "cardinality")); got != 1 {
+		t.Errorf("expected 1 rejected sample for target b, got %v", got)
+	}
+}
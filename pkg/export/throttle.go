@@ -0,0 +1,187 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	throttledRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "gcm_export_throttled_requests_total",
+		Help: "Number of requests to the GCM API that were shed on the client side due to quota errors by their priority.",
+	}, []string{"priority"})
+	throttleRatio = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "gcm_export_throttle_ratio",
+		Help: "Ratio of regular priority requests to the GCM API that are currently shed on the client side.",
+	})
+)
+
+const (
+	// DefaultThrottleMultiplier is the default number of requests per request accepted
+	// by the GCM API that may be made before requests are shed.
+	DefaultThrottleMultiplier = 2.0
+	// DefaultThrottleWindow is the default time window over which requests are tracked.
+	DefaultThrottleWindow = 2 * time.Minute
+
+	// Number of buckets the throttle window is split into.
+	throttleBuckets = 12
+)
+
+// Priorities of requests to the GCM API. Low priority requests are shed earlier.
+const (
+	priorityRegular = "regular"
+	priorityLow     = "low"
+)
+
+var errThrottled = errors.New("request shed by client-side throttling after quota errors")
+
+// ThrottleOpts represents exporter options for client-side adaptive throttling of
+// requests to the GCM API when it responds with quota errors.
+type ThrottleOpts struct {
+	// Disable turns off throttling.
+	Disable bool
+	// Multiplier is the number of requests per request accepted by the GCM API within
+	// the window that may be made. Requests beyond that are shed with increasing
+	// probability. Lower values shed more aggressively.
+	// Defaults to DefaultThrottleMultiplier when 0 and must be at least 1.
+	Multiplier float64
+	// Window is the time window over which requests are tracked.
+	// Defaults to DefaultThrottleWindow when 0.
+	Window time.Duration
+}
+
+func (o *ThrottleOpts) validate() error {
+	if o.Multiplier == 0 {
+		o.Multiplier = DefaultThrottleMultiplier
+	}
+	if o.Multiplier < 1 {
+		return fmt.Errorf("throttle multiplier must be at least 1, got %f", o.Multiplier)
+	}
+	if o.Window == 0 {
+		o.Window = DefaultThrottleWindow
+	}
+	if o.Window < 0 {
+		return fmt.Errorf("throttle window must be positive, got %s", o.Window)
+	}
+	return nil
+}
+
+// throttler implements adaptive throttling as described in the "Handling Overload"
+// chapter of the SRE book. It tracks how many requests were made and how many of them
+// were not rejected for quota reasons. Requests are shed with probability
+//
+//	(requests - multiplier*accepts) / (requests + 1)
+//
+// so that the client backs off once the GCM API rejects a significant share of requests,
+// instead of amplifying the quota problem. Low priority requests, i.e. retries, are shed
+// with a multiplier of 1, so they stop as soon as any requests are rejected.
+type throttler struct {
+	multiplier float64
+	bucketSize time.Duration
+	now        func() time.Time
+	rand       func() float64
+
+	mtx     sync.Mutex
+	buckets [throttleBuckets]throttleBucket
+}
+
+type throttleBucket struct {
+	start             time.Time
+	requests, accepts float64
+}
+
+func newThrottler(opts ThrottleOpts) *throttler {
+	return &throttler{
+		multiplier: opts.Multiplier,
+		bucketSize: opts.Window / throttleBuckets,
+		now:        time.Now,
+		rand:       rand.Float64,
+	}
+}
+
+// totals returns the number of requests and accepts within the window.
+func (t *throttler) totals(now time.Time) (requests, accepts float64) {
+	for _, b := range t.buckets {
+		if now.Sub(b.start) < throttleBuckets*t.bucketSize {
+			requests += b.requests
+			accepts += b.accepts
+		}
+	}
+	return requests, accepts
+}
+
+// current returns the bucket for the current time.
+func (t *throttler) current(now time.Time) *throttleBucket {
+	start := now.Truncate(t.bucketSize)
+	b := &t.buckets[(start.UnixNano()/int64(t.bucketSize))%throttleBuckets]
+	if !b.start.Equal(start) {
+		*b = throttleBucket{start: start}
+	}
+	return b
+}
+
+func rejectProbability(requests, accepts, multiplier float64) float64 {
+	return math.Max(0, (requests-multiplier*accepts)/(requests+1))
+}
+
+// allow returns whether a request of the given priority may be sent.
+func (t *throttler) allow(priority string) bool {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	now := t.now()
+	requests, accepts := t.totals(now)
+
+	multiplier := t.multiplier
+	if priority == priorityLow {
+		multiplier = 1
+	}
+	p := rejectProbability(requests, accepts, multiplier)
+	throttleRatio.Set(rejectProbability(requests, accepts, t.multiplier))
+
+	if t.rand() < p {
+		// Shed requests are tracked as well, so that the probability increases if the
+		// quota problem persists.
+		t.current(now).requests++
+		throttledRequests.WithLabelValues(priority).Inc()
+		return false
+	}
+	return true
+}
+
+// record tracks the result of a request that was allowed. Allowed requests are only
+// counted once they completed, so that a burst of requests in flight is not mistaken
+// for requests rejected by the GCM API.
+func (t *throttler) record(err error) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	b := t.current(t.now())
+	b.requests++
+	// HTTP 429 responses are translated to this code as well.
+	if status.Code(err) != codes.ResourceExhausted {
+		b.accepts++
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	gax "github.com/googleapis/gax-go/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	monitoring_pb "google.golang.org/genproto/googleapis/monitoring/v3"
+)
+
+func newTestThrottler(t *testing.T, now *time.Time) *throttler {
+	opts := ThrottleOpts{}
+	if err := opts.validate(); err != nil {
+		t.Fatal(err)
+	}
+	th := newThrottler(opts)
+	th.now = func() time.Time { return *now }
+	// Shed requests exactly if the reject probability is above one half.
+	th.rand = func() float64 { return 0.5 }
+	return th
+}
+
+func TestThrottler(t *testing.T) {
+	now := time.Unix(1000, 0)
+	th := newTestThrottler(t, &now)
+	quotaErr := status.Error(codes.ResourceExhausted, "quota exceeded")
+
+	// Successful requests and other errors never lead to throttling.
+	for i := 0; i < 100; i++ {
+		if !th.allow(priorityRegular) {
+			t.Fatalf("unexpected throttling at request %d", i)
+		}
+		if i%2 == 0 {
+			th.record(nil)
+		} else {
+			th.record(status.Error(codes.InvalidArgument, "invalid"))
+		}
+	}
+	// Requests in flight are not mistaken for rejected ones.
+	for i := 0; i < 100; i++ {
+		if !th.allow(priorityRegular) {
+			t.Fatalf("unexpected throttling of request %d in flight", i)
+		}
+	}
+	// Once all requests are rejected for quota reasons, low priority requests are shed
+	// before regular ones.
+	var lowShed, regularShed int
+	for i := 0; i < 1000 && regularShed == 0; i++ {
+		if th.allow(priorityRegular) {
+			th.record(quotaErr)
+		} else {
+			regularShed = i
+		}
+		if lowShed == 0 && !th.allow(priorityLow) {
+			lowShed = i
+		}
+	}
+	if regularShed == 0 {
+		t.Fatal("expected regular requests to be shed eventually")
+	}
+	if lowShed == 0 || lowShed >= regularShed {
+		t.Fatalf("expected low priority requests to be shed first, got %d and %d", lowShed, regularShed)
+	}
+	// Requests are allowed again after the window passed.
+	now = now.Add(DefaultThrottleWindow)
+	if !th.allow(priorityRegular) {
+		t.Fatal("expected request to be allowed after the window passed")
+	}
+}
+
+func TestRetrier_throttled(t *testing.T) {
+	now := time.Unix(1000, 0)
+	th := newTestThrottler(t, &now)
+
+	opts := RetryOpts{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+	if err := opts.validate(); err != nil {
+		t.Fatal(err)
+	}
+	var calls int
+	send := newRetrier(opts, th).wrap(func(context.Context, *monitoring_pb.CreateTimeSeriesRequest, ...gax.CallOption) error {
+		calls++
+		return status.Error(codes.ResourceExhausted, "quota exceeded")
+	})
+	var err error
+	for i := 0; i < 100; i++ {
+		if err = send(context.Background(), nil); errors.Is(err, errThrottled) {
+			break
+		}
+	}
+	if !errors.Is(err, errThrottled) {
+		t.Fatalf("expected requests to be throttled, got %v", err)
+	}
+	// Retries are shed early, so there must be fewer calls than attempts.
+	if calls >= 3*100 {
+		t.Errorf("expected retries to be shed, got %d calls", calls)
+	}
+}
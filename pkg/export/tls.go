@@ -0,0 +1,70 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+
+	"google.golang.org/grpc/credentials"
+)
+
+// TLSOpts represents exporter options for the TLS connection to the GCM API, e.g.
+// for endpoints behind a TLS-intercepting proxy or a Private Service Connect endpoint.
+type TLSOpts struct {
+	// CAFile is a file with PEM encoded certificates of additional certificate
+	// authorities the server certificate is verified with, in addition to the ones
+	// of the system.
+	CAFile string
+	// ServerName is the name the server certificate is verified against. Defaults
+	// to the host of the endpoint if empty.
+	ServerName string
+}
+
+// transportCredentials returns the credentials for the gRPC connection to the GCM API
+// or nil if the defaults should be used.
+func (o *TLSOpts) transportCredentials() (credentials.TransportCredentials, error) {
+	if o.CAFile == "" && o.ServerName == "" {
+		return nil, nil
+	}
+	cfg := &tls.Config{ServerName: o.ServerName}
+
+	if o.CAFile != "" {
+		b, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read CA file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("no valid certificates in CA file %q", o.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+	return credentials.NewTLS(cfg), nil
+}
+
+// endpointProxy returns the proxy that connections to the endpoint are made through
+// based on the HTTPS_PROXY and NO_PROXY environment variables, which are honored by
+// the gRPC client. It returns nil if no proxy is used.
+func endpointProxy(endpoint string) (*url.URL, error) {
+	return http.ProxyFromEnvironment(&http.Request{URL: &url.URL{Scheme: "https", Host: endpoint}})
+}
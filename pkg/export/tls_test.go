@@ -0,0 +1,56 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"encoding/pem"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTLSOpts_transportCredentials(t *testing.T) {
+	var opts TLSOpts
+	if creds, err := opts.transportCredentials(); err != nil || creds != nil {
+		t.Fatalf("expected default credentials, got %v, %v", creds, err)
+	}
+
+	srv := httptest.NewTLSServer(nil)
+	defer srv.Close()
+
+	dir := t.TempDir()
+	opts.CAFile = filepath.Join(dir, "ca.pem")
+	opts.ServerName = "monitoring.googleapis.com"
+
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(opts.CAFile, caPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+	creds, err := opts.transportCredentials()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := creds.Info().ServerName; got != opts.ServerName {
+		t.Errorf("expected server name %q, got %q", opts.ServerName, got)
+	}
+
+	if err := os.WriteFile(opts.CAFile, []byte("invalid"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := opts.transportCredentials(); err == nil {
+		t.Errorf("expected error for CA file without certificates")
+	}
+}
@@ -0,0 +1,244 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	monitoring "cloud.google.com/go/monitoring/apiv3/v2"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+var (
+	tokenRefreshes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "gcm_export_token_refreshes_total",
+		Help: "Number of OAuth token fetches by whether they were made ahead of expiry or because no valid token was cached, and whether they succeeded or failed. Requests that timed out waiting for a token are counted with the timeout result.",
+	}, []string{"trigger", "result"})
+	tokenRefreshDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "gcm_export_token_refresh_duration_seconds",
+		Help:    "Duration of OAuth token fetches.",
+		Buckets: []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	})
+)
+
+const (
+	// DefaultTokenPrefetchWindow is the default time before expiry at which a new token
+	// is fetched in the background.
+	DefaultTokenPrefetchWindow = 5 * time.Minute
+	// DefaultTokenFetchTimeout is the default time requests wait for a token if none
+	// is cached.
+	DefaultTokenFetchTimeout = 10 * time.Second
+
+	// Tokens are not used within this margin of their expiry, as measured by the
+	// server clock, so that they do not expire while a request is in flight.
+	tokenExpiryMargin = 30 * time.Second
+	// Minimum time between background fetches, which may return the same token if the
+	// credentials provider caches it, e.g. the GCE metadata server.
+	tokenRetryInterval = 10 * time.Second
+)
+
+var errTokenFetchTimeout = errors.New("timed out fetching OAuth token")
+
+// TokenOpts represents exporter options for fetching the OAuth tokens of requests to GCM.
+type TokenOpts struct {
+	// Time before expiry at which a new token is fetched in the background. Requests
+	// keep using the cached token meanwhile, so that slow or failing token fetches, e.g.
+	// from the GCE metadata server, do not affect them while the token is valid.
+	// Defaults to DefaultTokenPrefetchWindow.
+	PrefetchWindow time.Duration
+	// Maximum time requests wait for a token if no valid one is cached. Defaults to
+	// DefaultTokenFetchTimeout.
+	FetchTimeout time.Duration
+}
+
+func (o *TokenOpts) validate() error {
+	if o.PrefetchWindow == 0 {
+		o.PrefetchWindow = DefaultTokenPrefetchWindow
+	}
+	if o.PrefetchWindow < tokenExpiryMargin {
+		return fmt.Errorf("token prefetch window must be at least %s, got %s", tokenExpiryMargin, o.PrefetchWindow)
+	}
+	if o.FetchTimeout == 0 {
+		o.FetchTimeout = DefaultTokenFetchTimeout
+	}
+	if o.FetchTimeout < 0 {
+		return fmt.Errorf("token fetch timeout must be positive, got %s", o.FetchTimeout)
+	}
+	return nil
+}
+
+// newTokenSourceFunc returns a new token source for the credentials of the options.
+// The token sources of the oauth2 packages cache tokens until shortly before they
+// expire, so a new one is created for every fetch to get a fresh token.
+func newTokenSourceFunc(opts ExporterOpts) func(context.Context) (oauth2.TokenSource, error) {
+	scopes := monitoring.DefaultAuthScopes()
+
+	if opts.TokenURL != "" && opts.TokenBody != "" {
+		// The alternate token source throttles requests, so it must be reused.
+		src := newAltTokenSource(opts.TokenURL, opts.TokenBody)
+		return func(context.Context) (oauth2.TokenSource, error) {
+			return src, nil
+		}
+	}
+	if opts.CredentialsFile != "" {
+		return func(ctx context.Context) (oauth2.TokenSource, error) {
+			data, err := os.ReadFile(opts.CredentialsFile)
+			if err != nil {
+				return nil, fmt.Errorf("read credentials file: %w", err)
+			}
+			creds, err := google.CredentialsFromJSON(ctx, data, scopes...)
+			if err != nil {
+				return nil, err
+			}
+			return creds.TokenSource, nil
+		}
+	}
+	return func(ctx context.Context) (oauth2.TokenSource, error) {
+		creds, err := google.FindDefaultCredentials(ctx, scopes...)
+		if err != nil {
+			return nil, err
+		}
+		return creds.TokenSource, nil
+	}
+}
+
+// prefetchTokenSource caches a token and fetches a new one in the background before
+// it expires. The expiry is checked against the server clock as estimated by the
+// clock skew detector, as GCM rejects tokens that expired by its own clock.
+type prefetchTokenSource struct {
+	logger    log.Logger
+	opts      TokenOpts
+	newSource func(context.Context) (oauth2.TokenSource, error)
+	skew      *clockSkewDetector
+	now       func() time.Time
+
+	mtx   sync.Mutex
+	token *oauth2.Token
+	// Closed once the in-flight fetch completed, nil if no fetch is in flight.
+	fetching  chan struct{}
+	lastErr   error
+	lastFetch time.Time
+}
+
+func newPrefetchTokenSource(logger log.Logger, opts TokenOpts, newSource func(context.Context) (oauth2.TokenSource, error), skew *clockSkewDetector) *prefetchTokenSource {
+	return &prefetchTokenSource{
+		logger:    logger,
+		opts:      opts,
+		newSource: newSource,
+		skew:      skew,
+		now:       time.Now,
+	}
+}
+
+// serverNow returns the estimated current time of the server clock.
+func (s *prefetchTokenSource) serverNow() time.Time {
+	return s.now().Add(-s.skew.offset())
+}
+
+// usable returns whether the token can be used for a request at the given time.
+// Must be called with mtx held.
+func (s *prefetchTokenSource) usable(now time.Time) bool {
+	if s.token == nil || s.token.AccessToken == "" {
+		return false
+	}
+	// Tokens without expiry never expire.
+	return s.token.Expiry.IsZero() || now.Add(tokenExpiryMargin).Before(s.token.Expiry)
+}
+
+// Token returns the cached token if it is usable and fetches a new one otherwise.
+func (s *prefetchTokenSource) Token() (*oauth2.Token, error) {
+	now := s.serverNow()
+
+	s.mtx.Lock()
+	if s.usable(now) {
+		token := s.token
+		if !token.Expiry.IsZero() && !now.Add(s.opts.PrefetchWindow).Before(token.Expiry) &&
+			now.Sub(s.lastFetch) >= tokenRetryInterval {
+			s.fetch("prefetch")
+		}
+		s.mtx.Unlock()
+		return token, nil
+	}
+	done := s.fetch("expired")
+	s.mtx.Unlock()
+
+	select {
+	case <-done:
+	case <-time.After(s.opts.FetchTimeout):
+		// The fetch continues in the background and its token is used once it completes.
+		tokenRefreshes.WithLabelValues("expired", "timeout").Inc()
+		return nil, errTokenFetchTimeout
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.usable(s.serverNow()) {
+		return s.token, nil
+	}
+	if s.lastErr != nil {
+		return nil, s.lastErr
+	}
+	return nil, errors.New("fetched OAuth token is already expired")
+}
+
+// fetch starts fetching a new token unless a fetch is in flight already and returns
+// a channel that is closed once the fetch completed. Must be called with mtx held.
+func (s *prefetchTokenSource) fetch(trigger string) <-chan struct{} {
+	if s.fetching != nil {
+		return s.fetching
+	}
+	done := make(chan struct{})
+	s.fetching = done
+
+	go func() {
+		defer close(done)
+
+		start := time.Now()
+		token, err := s.fetchToken()
+		tokenRefreshDuration.Observe(time.Since(start).Seconds())
+
+		s.mtx.Lock()
+		defer s.mtx.Unlock()
+
+		s.fetching = nil
+		s.lastErr = err
+		s.lastFetch = s.serverNow()
+		if err != nil {
+			tokenRefreshes.WithLabelValues(trigger, "error").Inc()
+			level.Warn(s.logger).Log("msg", "fetching OAuth token failed", "trigger", trigger, "err", err)
+			return
+		}
+		tokenRefreshes.WithLabelValues(trigger, "success").Inc()
+		s.token = token
+	}()
+	return done
+}
+
+func (s *prefetchTokenSource) fetchToken() (*oauth2.Token, error) {
+	src, err := s.newSource(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return src.Token()
+}
@@ -0,0 +1,188 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"golang.org/x/oauth2"
+)
+
+// fakeClock is a clock that is advanced manually and safe for concurrent use.
+type fakeClock struct {
+	mtx sync.Mutex
+	t   time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) add(d time.Duration) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.t = c.t.Add(d)
+}
+
+// fakeTokenSource returns tokens that expire after a fixed lifetime. Fetches block
+// until release is closed if it is set.
+type fakeTokenSource struct {
+	now      func() time.Time
+	lifetime time.Duration
+	release  chan struct{}
+
+	mtx     sync.Mutex
+	fetches int
+	err     error
+}
+
+func (s *fakeTokenSource) newSource(context.Context) (oauth2.TokenSource, error) {
+	return s, nil
+}
+
+func (s *fakeTokenSource) Token() (*oauth2.Token, error) {
+	if s.release != nil {
+		<-s.release
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.fetches++
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &oauth2.Token{
+		AccessToken: fmt.Sprintf("token-%d", s.fetches),
+		Expiry:      s.now().Add(s.lifetime),
+	}, nil
+}
+
+func (s *fakeTokenSource) fetchCount() int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.fetches
+}
+
+func TestPrefetchTokenSource(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+
+	fake := &fakeTokenSource{now: clock.now, lifetime: time.Hour}
+	src := newPrefetchTokenSource(log.NewNopLogger(), TokenOpts{PrefetchWindow: 5 * time.Minute, FetchTimeout: time.Second}, fake.newSource, nil)
+	src.now = clock.now
+
+	// The first token is fetched synchronously.
+	token, err := src.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "token-1" {
+		t.Fatalf("unexpected token %q", token.AccessToken)
+	}
+	// The cached token is used until the prefetch window.
+	clock.add(50 * time.Minute)
+	if token, err = src.Token(); err != nil || token.AccessToken != "token-1" || fake.fetchCount() != 1 {
+		t.Fatalf("expected cached token, got %v, %v", token, err)
+	}
+
+	// Within the prefetch window, the cached token is returned while a new one is
+	// fetched in the background.
+	fake.release = make(chan struct{})
+	clock.add(6 * time.Minute)
+	if token, err = src.Token(); err != nil || token.AccessToken != "token-1" {
+		t.Fatalf("expected cached token while prefetching, got %v, %v", token, err)
+	}
+	close(fake.release)
+	waitForToken(t, src, "token-2")
+
+	// A failed prefetch keeps the cached token.
+	fake.release = nil
+	fake.err = errors.New("metadata server unavailable")
+	clock.add(56 * time.Minute)
+	if token, err = src.Token(); err != nil || token.AccessToken != "token-2" {
+		t.Fatalf("expected cached token after failed prefetch, got %v, %v", token, err)
+	}
+	// Once the token is expired, the error of the fetch is returned.
+	clock.add(5 * time.Minute)
+	if _, err = src.Token(); err == nil {
+		t.Fatalf("expected error for expired token")
+	}
+}
+
+func TestPrefetchTokenSource_skew(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+
+	// The local clock is a minute behind the server.
+	skew := newClockSkewDetector(log.NewNopLogger(), 0, ClockSkewPolicyWarn)
+	skew.observe(clock.now(), clock.now().Add(time.Minute))
+
+	fake := &fakeTokenSource{now: clock.now, lifetime: time.Hour}
+	src := newPrefetchTokenSource(log.NewNopLogger(), TokenOpts{PrefetchWindow: time.Minute, FetchTimeout: time.Second}, fake.newSource, skew)
+	src.now = clock.now
+
+	if _, err := src.Token(); err != nil {
+		t.Fatal(err)
+	}
+	// The token is within the prefetch window by the server clock, but not the local one.
+	fake.release = make(chan struct{})
+	clock.add(58 * time.Minute)
+	if token, err := src.Token(); err != nil || token.AccessToken != "token-1" {
+		t.Fatalf("expected cached token, got %v, %v", token, err)
+	}
+	// The token is expired by the server clock, so requests wait for the fetch.
+	clock.add(time.Minute)
+	if _, err := src.Token(); !errors.Is(err, errTokenFetchTimeout) {
+		t.Fatalf("expected timeout, got %v", err)
+	}
+	close(fake.release)
+	waitForToken(t, src, "token-2")
+}
+
+// waitForToken waits until the token source returns the given token.
+func waitForToken(t *testing.T, src *prefetchTokenSource, want string) {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		if token, err := src.Token(); err == nil && token.AccessToken == want {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("token %q was not fetched", want)
+}
+
+func TestTokenOpts_validate(t *testing.T) {
+	opts := TokenOpts{}
+	if err := opts.validate(); err != nil {
+		t.Fatal(err)
+	}
+	if opts.PrefetchWindow != DefaultTokenPrefetchWindow || opts.FetchTimeout != DefaultTokenFetchTimeout {
+		t.Errorf("unexpected defaults %+v", opts)
+	}
+	for _, opts := range []TokenOpts{
+		{PrefetchWindow: time.Second},
+		{FetchTimeout: -time.Second},
+	} {
+		if err := opts.validate(); err == nil {
+			t.Errorf("expected error for %+v", opts)
+		}
+	}
+}
@@ -26,13 +26,13 @@ import (
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/prometheus/model/labels"
-	"github.com/prometheus/prometheus/model/textparse"
 	"github.com/prometheus/prometheus/model/value"
 	"github.com/prometheus/prometheus/storage"
 	"github.com/prometheus/prometheus/tsdb/record"
 
 	timestamp_pb "github.com/golang/protobuf/ptypes/timestamp"
 	distribution_pb "google.golang.org/genproto/googleapis/api/distribution"
+	metric_pb "google.golang.org/genproto/googleapis/api/metric"
 	monitoring_pb "google.golang.org/genproto/googleapis/monitoring/v3"
 	"google.golang.org/protobuf/types/known/anypb"
 )
@@ -87,6 +87,24 @@ func (b *sampleBuilder) close() {
 	}
 }
 
+// discardDropped counts and logs a discarded sample of a dropped series. Samples of
+// series that are filtered out by the matchers or export options are only logged.
+func (b *sampleBuilder) discardDropped(e *seriesCacheEntry) {
+	reason := "filtered"
+	switch {
+	case e.limited:
+		reason = "series-limit"
+	case e.typeDropped:
+		reason = "type-conflict"
+	case e.policyDropped:
+		reason = "type-policy"
+	}
+	if reason != "filtered" {
+		prometheusSamplesDiscarded.WithLabelValues(reason).Inc()
+	}
+	b.series.drops.series(reason, e.lset, 1)
+}
+
 // next extracts the next sample from the input sample batch and returns
 // the remainder of the input. It also attaches valid exemplars if applicable.
 // Returns a nil time series for samples that couldn't be converted.
@@ -97,6 +115,7 @@ func (b *sampleBuilder) next(metadata MetadataFunc, externalLabels labels.Labels
 	// Staleness markers are currently not supported by Cloud Monitoring.
 	if value.IsStaleNaN(sample.V) {
 		prometheusSamplesDiscarded.WithLabelValues("staleness-marker").Inc()
+		b.series.markStale(storage.SeriesRef(sample.Ref))
 		discardExemplarIncIfExists(storage.SeriesRef(sample.Ref), exemplars, "staleness-marker")
 		return nil, tailSamples, nil
 	}
@@ -108,6 +127,11 @@ func (b *sampleBuilder) next(metadata MetadataFunc, externalLabels labels.Labels
 		return nil, tailSamples, nil
 	}
 	if entry.dropped {
+		b.discardDropped(entry)
+		return nil, tailSamples, nil
+	}
+	if entry.suffix == metricSuffixCreated {
+		b.series.setCreated(entry, sample.V)
 		return nil, tailSamples, nil
 	}
 
@@ -118,24 +142,50 @@ func (b *sampleBuilder) next(metadata MetadataFunc, externalLabels labels.Labels
 	// based on the type determined in the series cache.
 	// If both are set, we double-write the series as a gauge and a cumulative.
 	if g := entry.protos.gauge; g.proto != nil {
-		ts := *g.proto
+		value := &monitoring_pb.TypedValue{
+			Value: &monitoring_pb.TypedValue_DoubleValue{sample.V},
+		}
+		if g.proto.ValueType == metric_pb.MetricDescriptor_DISTRIBUTION {
+			// Consume the set of series of a gauge histogram as a single distribution sample.
+			var v *distribution_pb.Distribution
+			var err error
+			v, _, tailSamples, err = b.buildDistribution(
+				entry.metadata.Metric,
+				entry.lset,
+				samples,
+				exemplars,
+				externalLabels,
+				metadata,
+				true,
+			)
+			if err != nil {
+				return nil, tailSamples, err
+			}
+			value = nil
+			if v != nil {
+				value = &monitoring_pb.TypedValue{
+					Value: &monitoring_pb.TypedValue_DistributionValue{v},
+				}
+			}
+		}
+		if value != nil {
+			ts := *g.proto
 
-		ts.Points = []*monitoring_pb.Point{{
-			Interval: &monitoring_pb.TimeInterval{
-				EndTime: getTimestamp(sample.T),
-			},
-			Value: &monitoring_pb.TypedValue{
-				Value: &monitoring_pb.TypedValue_DoubleValue{sample.V},
-			},
-		}}
-		result = append(result, hashedSeries{hash: g.hash, proto: &ts})
+			ts.Points = []*monitoring_pb.Point{{
+				Interval: &monitoring_pb.TimeInterval{
+					EndTime: getTimestamp(sample.T),
+				},
+				Value: value,
+			}}
+			result = append(result, hashedSeries{hash: g.hash, proto: &ts, priority: g.priority})
+		}
 	}
 	if c := entry.protos.cumulative; c.proto != nil {
 		var (
 			value          *monitoring_pb.TypedValue
 			resetTimestamp int64
 		)
-		if entry.metadata.Type == textparse.MetricTypeHistogram {
+		if c.proto.ValueType == metric_pb.MetricDescriptor_DISTRIBUTION {
 			// Consume a set of series as a single distribution sample.
 
 			// We pass in the original lset for matching since Prometheus's target label must
@@ -149,6 +199,7 @@ func (b *sampleBuilder) next(metadata MetadataFunc, externalLabels labels.Labels
 				exemplars,
 				externalLabels,
 				metadata,
+				false,
 			)
 			if err != nil {
 				return nil, tailSamples, err
@@ -183,7 +234,7 @@ func (b *sampleBuilder) next(metadata MetadataFunc, externalLabels labels.Labels
 				},
 				Value: value,
 			}}
-			result = append(result, hashedSeries{hash: c.hash, proto: &ts})
+			result = append(result, hashedSeries{hash: c.hash, proto: &ts, priority: c.priority})
 		}
 	}
 	return result, tailSamples, nil
@@ -270,7 +321,7 @@ func (d *distribution) Swap(i, j int) {
 	d.values[i], d.values[j] = d.values[j], d.values[i]
 }
 
-func (d *distribution) build(lset labels.Labels) (*distribution_pb.Distribution, error) {
+func (d *distribution) build(lset labels.Labels, maxBuckets int) (*distribution_pb.Distribution, error) {
 	// The exposition format in general requires buckets to be in-order but we observed
 	// some cases in the wild where this was not the case.
 	// Ensure sorting here to gracefully handle those cases sometimes. This cannot handle
@@ -278,6 +329,7 @@ func (d *distribution) build(lset labels.Labels) (*distribution_pb.Distribution,
 	// return true before all buckets have been read. Then we will send a distribution
 	// with only a subset of buckets.
 	sort.Sort(d)
+	d.reduceBuckets(maxBuckets)
 
 	// Populate new values and bounds slices for the final proto as d will be returned to
 	// the memory pool while the proto will be enqueued for sending.
@@ -359,11 +411,14 @@ func (d *distribution) build(lset labels.Labels) (*distribution_pb.Distribution,
 	return dp, nil
 }
 
-func isHistogramSeries(metric, name string) bool {
+func isHistogramSeries(metric, name string, gauge bool) bool {
 	if !strings.HasPrefix(name, metric) {
 		return false
 	}
 	s := metricSuffix(name[len(metric):])
+	if gauge {
+		return s == metricSuffixBucket || s == metricSuffixGSum || s == metricSuffixGCount
+	}
 	return s == metricSuffixBucket || s == metricSuffixSum || s == metricSuffixCount
 }
 
@@ -371,6 +426,7 @@ func isHistogramSeries(metric, name string) bool {
 // It returns when a series is consumed which completes a full distribution.
 // Once all series for a single distribution have been observed, it returns it.
 // It returns the reset timestamp along with the distrubution and the remaining samples.
+// For gauge histograms the values are not reset adjusted and no reset timestamp is returned.
 func (b *sampleBuilder) buildDistribution(
 	metric string,
 	matchLset labels.Labels,
@@ -378,6 +434,7 @@ func (b *sampleBuilder) buildDistribution(
 	exemplars map[storage.SeriesRef]record.RefExemplar,
 	externalLabels labels.Labels,
 	metadata MetadataFunc,
+	gauge bool,
 ) (*distribution_pb.Distribution, int64, []record.RefSample, error) {
 	// The Prometheus/OpenMetrics exposition format does not require all histogram series for a single distribution
 	// to be grouped together. But it does require that all series for a histogram metric in general are grouped
@@ -397,17 +454,21 @@ Loop:
 		name := e.lset.Get(labels.MetricName)
 		// Abort if the series is not for the intended histogram metric. All series for it must be grouped
 		// together so we can rely on no further relevant series are in the batch.
-		if !isHistogramSeries(metric, name) {
+		if !isHistogramSeries(metric, name, gauge) {
 			break
 		}
 		consumed++
 
+		series := e.protos.cumulative
+		if gauge {
+			series = e.protos.gauge
+		}
 		// Create or update the cached distribution for the given histogram series
-		dist, ok := b.dists[e.protos.cumulative.hash]
+		dist, ok := b.dists[series.hash]
 		if !ok {
 			dist = getDistribution()
 			dist.timestamp = s.T
-			b.dists[e.protos.cumulative.hash] = dist
+			b.dists[series.hash] = dist
 		}
 		// If there are diverging timestamps within a single batch, the histogram is not valid.
 		if s.T != dist.timestamp {
@@ -417,23 +478,27 @@ Loop:
 			continue
 		}
 
-		rt, v, ok := b.series.getResetAdjusted(storage.SeriesRef(s.Ref), s.T, s.V)
-		// If a series appeared for the first time, we won't get a valid reset timestamp yet.
-		// This may happen if the histogram is entirely new or if new series appeared through bucket changes.
-		// We skip the entire distribution sample in this case.
-		if !ok {
-			dist.skip = true
-			continue
+		// Gauge histograms may go down at any time and are written as they are.
+		rt, v := int64(0), s.V
+		if !gauge {
+			rt, v, ok = b.series.getResetAdjusted(storage.SeriesRef(s.Ref), s.T, s.V)
+			// If a series appeared for the first time, we won't get a valid reset timestamp yet.
+			// This may happen if the histogram is entirely new or if new series appeared through bucket changes.
+			// We skip the entire distribution sample in this case.
+			if !ok {
+				dist.skip = true
+				continue
+			}
 		}
 
 		// All series can in principle have a NaN value (staleness NaNs already filtered).
 		// We permit this for sum and count as we handle it explicitly when building the distribution.
 		// For buckets there's not sensible way to handle it however and we discard those bucket samples.
 		switch metricSuffix(name[len(metric):]) {
-		case metricSuffixSum:
+		case metricSuffixSum, metricSuffixGSum:
 			dist.hasSum, dist.sum = true, v
 
-		case metricSuffixCount:
+		case metricSuffixCount, metricSuffixGCount:
 			dist.hasCount, dist.count = true, v
 			// We take the count series as the authoritative source for the overall reset timestamp.
 			dist.resetTimestamp = rt
@@ -467,7 +532,7 @@ Loop:
 		if !dist.complete() {
 			continue
 		}
-		dp, err := dist.build(e.lset)
+		dp, err := dist.build(e.lset, b.series.histograms.maxBuckets(metric))
 		if err != nil {
 			return nil, 0, samples[consumed:], err
 		}
@@ -1522,3 +1522,235 @@ func TestSampleBuilder(t *testing.T) {
 		})
 	}
 }
+
+func TestSampleBuilder_createdTimestamps(t *testing.T) {
+	externalLabels := labels.FromStrings("project_id", "example-project", "location", "europe")
+	metadata := testMetadataFunc(metricMetadataMap{
+		"metric1": {Type: textparse.MetricTypeCounter, Help: "metric1 help text"},
+		"metric2": {Type: textparse.MetricTypeCounter, Help: "metric2 help text"},
+	})
+	series := seriesMap{
+		1: labels.FromStrings("job", "job1", "instance", "instance1", "__name__", "metric1_total"),
+		2: labels.FromStrings("job", "job1", "instance", "instance1", "__name__", "metric1_created"),
+		3: labels.FromStrings("job", "job1", "instance", "instance1", "__name__", "metric2_total"),
+	}
+	type point struct {
+		metric     string
+		start, end int64
+		value      float64
+	}
+	cases := []struct {
+		doc     string
+		samples [][]record.RefSample
+		want    []point
+	}{
+		{
+			doc: "created timestamp before first sample",
+			samples: [][]record.RefSample{
+				{{Ref: 2, T: 1000, V: 0.5}, {Ref: 1, T: 1000, V: 5}},
+				{{Ref: 2, T: 2000, V: 0.5}, {Ref: 1, T: 2000, V: 7}},
+			},
+			// The first sample is not skipped.
+			want: []point{
+				{metric: "prometheus.googleapis.com/metric1_total/counter", start: 500, end: 1000, value: 5},
+				{metric: "prometheus.googleapis.com/metric1_total/counter", start: 500, end: 2000, value: 7},
+			},
+		}, {
+			doc: "created timestamp after first sample",
+			samples: [][]record.RefSample{
+				{{Ref: 1, T: 1000, V: 5}, {Ref: 2, T: 1000, V: 0.5}},
+				{{Ref: 1, T: 2000, V: 7}, {Ref: 2, T: 2000, V: 0.5}},
+			},
+			// No point was written yet, so the created timestamp replaces the first-seen one.
+			want: []point{
+				{metric: "prometheus.googleapis.com/metric1_total/counter", start: 500, end: 2000, value: 7},
+			},
+		}, {
+			doc: "reset with created timestamp",
+			samples: [][]record.RefSample{
+				{{Ref: 2, T: 1000, V: 0.5}, {Ref: 1, T: 1000, V: 5}},
+				{{Ref: 2, T: 2000, V: 1.5}, {Ref: 1, T: 2000, V: 1}},
+			},
+			want: []point{
+				{metric: "prometheus.googleapis.com/metric1_total/counter", start: 500, end: 1000, value: 5},
+				{metric: "prometheus.googleapis.com/metric1_total/counter", start: 1500, end: 2000, value: 1},
+			},
+		}, {
+			doc: "created timestamp appears after points were written",
+			samples: [][]record.RefSample{
+				{{Ref: 1, T: 1000, V: 5}},
+				{{Ref: 1, T: 2000, V: 7}},
+				{{Ref: 1, T: 3000, V: 9}, {Ref: 2, T: 3000, V: 0.5}},
+				{{Ref: 1, T: 4000, V: 11}, {Ref: 2, T: 4000, V: 0.5}},
+			},
+			// The start time is kept as the created timestamp is older than the written points.
+			want: []point{
+				{metric: "prometheus.googleapis.com/metric1_total/counter", start: 1000, end: 2000, value: 2},
+				{metric: "prometheus.googleapis.com/metric1_total/counter", start: 1000, end: 3000, value: 4},
+				{metric: "prometheus.googleapis.com/metric1_total/counter", start: 1000, end: 4000, value: 6},
+			},
+		}, {
+			doc: "series without created timestamp",
+			samples: [][]record.RefSample{
+				{{Ref: 3, T: 1000, V: 5}, {Ref: 2, T: 1000, V: 0.5}},
+				{{Ref: 3, T: 2000, V: 7}, {Ref: 2, T: 2000, V: 0.5}},
+			},
+			want: []point{
+				{metric: "prometheus.googleapis.com/metric2_total/counter", start: 1000, end: 2000, value: 2},
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.doc, func(t *testing.T) {
+			cache := newSeriesCache(nil, nil, MetricTypePrefix, nil)
+			cache.getLabelsByRef = func(ref storage.SeriesRef) labels.Labels {
+				return series[ref]
+			}
+			var got []point
+
+			for _, batch := range c.samples {
+				b := newSampleBuilder(cache)
+
+				for len(batch) > 0 {
+					out, tail, err := b.next(metadata, externalLabels, batch, nil)
+					if err != nil {
+						t.Fatalf("unexpected error: %s", err)
+					}
+					for _, s := range out {
+						p := s.proto.Points[0]
+						got = append(got, point{
+							metric: s.proto.Metric.Type,
+							start:  p.Interval.StartTime.AsTime().UnixMilli(),
+							end:    p.Interval.EndTime.AsTime().UnixMilli(),
+							value:  p.Value.GetDoubleValue(),
+						})
+					}
+					batch = tail
+				}
+				b.close()
+			}
+			if diff := cmp.Diff(c.want, got, cmp.AllowUnexported(point{})); diff != "" {
+				t.Errorf("unexpected points (-want, +got): %v", diff)
+			}
+		})
+	}
+}
+
+func TestSampleBuilder_gaugeHistograms(t *testing.T) {
+	externalLabels := labels.FromStrings("project_id", "example-project", "location", "europe")
+	metadata := testMetadataFunc(metricMetadataMap{
+		"metric1": {Type: textparse.MetricTypeGaugeHistogram, Help: "metric1 help text"},
+	})
+	series := seriesMap{
+		1: labels.FromStrings("__name__", "metric1_bucket", "job", "job1", "instance", "instance1", "le", "1"),
+		2: labels.FromStrings("__name__", "metric1_bucket", "job", "job1", "instance", "instance1", "le", "+Inf"),
+		3: labels.FromStrings("__name__", "metric1_gcount", "job", "job1", "instance", "instance1"),
+		4: labels.FromStrings("__name__", "metric1_gsum", "job", "job1", "instance", "instance1"),
+	}
+	// The second sample of the gauge histogram is lower than the first one, which must
+	// not be treated as a reset.
+	samples := [][]record.RefSample{
+		{
+			{Ref: 1, T: 1000, V: 1},
+			{Ref: 2, T: 1000, V: 3},
+			{Ref: 3, T: 1000, V: 3},
+			{Ref: 4, T: 1000, V: 3},
+		}, {
+			{Ref: 1, T: 2000, V: 1},
+			{Ref: 2, T: 2000, V: 1},
+			{Ref: 3, T: 2000, V: 1},
+			{Ref: 4, T: 2000, V: 0.5},
+		},
+	}
+	distribution := func(count int64, mean, dev float64, buckets ...int64) *monitoring_pb.TypedValue {
+		return &monitoring_pb.TypedValue{
+			Value: &monitoring_pb.TypedValue_DistributionValue{
+				DistributionValue: &distribution_pb.Distribution{
+					Count:                 count,
+					Mean:                  mean,
+					SumOfSquaredDeviation: dev,
+					BucketOptions: &distribution_pb.Distribution_BucketOptions{
+						Options: &distribution_pb.Distribution_BucketOptions_ExplicitBuckets{
+							ExplicitBuckets: &distribution_pb.Distribution_BucketOptions_Explicit{
+								Bounds: []float64{1},
+							},
+						},
+					},
+					BucketCounts: buckets,
+				},
+			},
+		}
+	}
+	double := func(v float64) *monitoring_pb.TypedValue {
+		return &monitoring_pb.TypedValue{Value: &monitoring_pb.TypedValue_DoubleValue{v}}
+	}
+	type point struct {
+		metric string
+		labels map[string]string
+		kind   metric_pb.MetricDescriptor_MetricKind
+		end    int64
+		value  *monitoring_pb.TypedValue
+	}
+	for _, c := range []struct {
+		mode string
+		want []point
+	}{
+		{
+			mode: GaugeHistogramModeDistribution,
+			want: []point{
+				{metric: "prometheus.googleapis.com/metric1/gaugehistogram", kind: metric_pb.MetricDescriptor_GAUGE, end: 1000, value: distribution(3, 1, 0.25, 1, 2)},
+				{metric: "prometheus.googleapis.com/metric1/gaugehistogram", kind: metric_pb.MetricDescriptor_GAUGE, end: 2000, value: distribution(1, 0.5, 0, 1, 0)},
+			},
+		}, {
+			mode: GaugeHistogramModeGauge,
+			want: []point{
+				{metric: "prometheus.googleapis.com/metric1_bucket/gauge", labels: map[string]string{"le": "1"}, kind: metric_pb.MetricDescriptor_GAUGE, end: 1000, value: double(1)},
+				{metric: "prometheus.googleapis.com/metric1_bucket/gauge", labels: map[string]string{"le": "+Inf"}, kind: metric_pb.MetricDescriptor_GAUGE, end: 1000, value: double(3)},
+				{metric: "prometheus.googleapis.com/metric1_gcount/gauge", kind: metric_pb.MetricDescriptor_GAUGE, end: 1000, value: double(3)},
+				{metric: "prometheus.googleapis.com/metric1_gsum/gauge", kind: metric_pb.MetricDescriptor_GAUGE, end: 1000, value: double(3)},
+				{metric: "prometheus.googleapis.com/metric1_bucket/gauge", labels: map[string]string{"le": "1"}, kind: metric_pb.MetricDescriptor_GAUGE, end: 2000, value: double(1)},
+				{metric: "prometheus.googleapis.com/metric1_bucket/gauge", labels: map[string]string{"le": "+Inf"}, kind: metric_pb.MetricDescriptor_GAUGE, end: 2000, value: double(1)},
+				{metric: "prometheus.googleapis.com/metric1_gcount/gauge", kind: metric_pb.MetricDescriptor_GAUGE, end: 2000, value: double(1)},
+				{metric: "prometheus.googleapis.com/metric1_gsum/gauge", kind: metric_pb.MetricDescriptor_GAUGE, end: 2000, value: double(0.5)},
+			},
+		},
+	} {
+		t.Run(c.mode, func(t *testing.T) {
+			cache := newSeriesCache(nil, nil, MetricTypePrefix, nil)
+			cache.histograms.GaugeMode = c.mode
+			cache.getLabelsByRef = func(ref storage.SeriesRef) labels.Labels {
+				return series[ref]
+			}
+			var got []point
+
+			for _, batch := range samples {
+				b := newSampleBuilder(cache)
+
+				for len(batch) > 0 {
+					out, tail, err := b.next(metadata, externalLabels, batch, nil)
+					if err != nil {
+						t.Fatalf("unexpected error: %s", err)
+					}
+					for _, s := range out {
+						p := s.proto.Points[0]
+						if p.Interval.StartTime != nil {
+							t.Errorf("unexpected start time for gauge point of %s", s.proto.Metric.Type)
+						}
+						got = append(got, point{
+							metric: s.proto.Metric.Type,
+							labels: s.proto.Metric.Labels,
+							kind:   s.proto.MetricKind,
+							end:    p.Interval.EndTime.AsTime().UnixMilli(),
+							value:  p.Value,
+						})
+					}
+					batch = tail
+				}
+				b.close()
+			}
+			if diff := cmp.Diff(c.want, got, cmp.AllowUnexported(point{}), protocmp.Transform(), cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("unexpected points (-want, +got): %v", diff)
+			}
+		})
+	}
+}
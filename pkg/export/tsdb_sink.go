@@ -0,0 +1,229 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb"
+	monitoring_pb "google.golang.org/genproto/googleapis/monitoring/v3"
+)
+
+var tsdbSinkSamples = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "gcm_export_tsdb_sink_samples_total",
+	Help: "Number of exported samples written to the local TSDB sink by whether they were written, failed to be written, or dropped because the queue was full.",
+}, []string{"result"})
+
+const (
+	// DefaultTSDBSinkQueueSize is the default number of batches that can be queued for
+	// the TSDB sink.
+	DefaultTSDBSinkQueueSize = 100
+
+	// Labels holding the GCM metric type and monitored resource type of the series
+	// written to the TSDB sink.
+	tsdbSinkMetricTypeLabel   = "gcm_metric_type"
+	tsdbSinkResourceTypeLabel = "gcm_resource_type"
+
+	// How far samples may be out of order in the TSDB sink, e.g. because the points
+	// of a series were sent in concurrent batches.
+	tsdbSinkOutOfOrderWindow = time.Hour
+)
+
+// TSDBSinkOpts represents exporter options for writing exported samples into a local
+// Prometheus TSDB, so that developers can inspect what is written to GCM, e.g. with
+// promtool, without a GCP project.
+type TSDBSinkOpts struct {
+	// Path of the TSDB directory. The sink is disabled if empty.
+	Path string
+	// Only write samples to the TSDB and make no requests to GCM, which then need no
+	// credentials. Samples are counted as sent.
+	Only bool
+	// Number of batches that can be queued for the TSDB. Batches are dropped if the
+	// queue is full. Defaults to DefaultTSDBSinkQueueSize when 0.
+	QueueSize int
+}
+
+func (o *TSDBSinkOpts) validate() error {
+	if o.Only && o.Path == "" {
+		return fmt.Errorf("TSDB sink path must be set to only write to the TSDB sink")
+	}
+	if o.QueueSize == 0 {
+		o.QueueSize = DefaultTSDBSinkQueueSize
+	}
+	if o.QueueSize < 0 {
+		return fmt.Errorf("TSDB sink queue size must be positive, got %d", o.QueueSize)
+	}
+	return nil
+}
+
+// tsdbSink writes the series of sent batches into a local TSDB. Every GCM series is
+// written as a Prometheus series with the labels of its monitored resource and metric,
+// its metric type, and the Prometheus metric name the metric type was derived from.
+// Distributions are written as _count, _sum, and _bucket series like a Prometheus
+// histogram.
+type tsdbSink struct {
+	logger log.Logger
+	db     *tsdb.DB
+	queue  chan [][]*monitoring_pb.TimeSeries
+}
+
+func openTSDBSink(logger log.Logger, opts TSDBSinkOpts) (*tsdbSink, error) {
+	dbOpts := tsdb.DefaultOptions()
+	dbOpts.OutOfOrderTimeWindow = tsdbSinkOutOfOrderWindow.Milliseconds()
+
+	db, err := tsdb.Open(opts.Path, log.With(logger, "component", "tsdb-sink"), nil, dbOpts, nil)
+	if err != nil {
+		return nil, fmt.Errorf("open TSDB sink: %w", err)
+	}
+	return &tsdbSink{
+		logger: logger,
+		db:     db,
+		queue:  make(chan [][]*monitoring_pb.TimeSeries, opts.QueueSize),
+	}, nil
+}
+
+// add queues the series of a batch, grouped into requests, for writing.
+func (s *tsdbSink) add(requests [][]*monitoring_pb.TimeSeries) {
+	select {
+	case s.queue <- requests:
+	default:
+		n := 0
+		for _, l := range requests {
+			n += len(l)
+		}
+		tsdbSinkSamples.WithLabelValues("dropped").Add(float64(n))
+	}
+}
+
+// run writes queued batches until the context is canceled and closes the TSDB afterwards.
+func (s *tsdbSink) run(ctx context.Context) {
+	defer func() {
+		if err := s.db.Close(); err != nil {
+			level.Error(s.logger).Log("msg", "closing TSDB sink failed", "err", err)
+		}
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case requests := <-s.queue:
+			s.write(ctx, requests)
+		}
+	}
+}
+
+// write appends the points of the series to the TSDB.
+func (s *tsdbSink) write(ctx context.Context, requests [][]*monitoring_pb.TimeSeries) {
+	var written, failed int
+
+	app := s.db.Appender(ctx)
+	for _, l := range requests {
+		for _, ts := range l {
+			if err := appendTSDBSinkSeries(app, ts); err != nil {
+				level.Debug(s.logger).Log("msg", "writing series to TSDB sink failed", "type", ts.Metric.Type, "err", err)
+				failed++
+				continue
+			}
+			written++
+		}
+	}
+	if err := app.Commit(); err != nil {
+		level.Error(s.logger).Log("msg", "committing samples to TSDB sink failed", "err", err)
+		failed += written
+		written = 0
+	}
+	tsdbSinkSamples.WithLabelValues("written").Add(float64(written))
+	tsdbSinkSamples.WithLabelValues("failed").Add(float64(failed))
+}
+
+// appendTSDBSinkSeries appends the point of the series as one or more samples.
+func appendTSDBSinkSeries(app storage.Appender, ts *monitoring_pb.TimeSeries) error {
+	if len(ts.Points) == 0 {
+		return fmt.Errorf("series has no points")
+	}
+	p := ts.Points[0]
+	t := p.Interval.EndTime.AsTime().UnixMilli()
+
+	b := labels.NewBuilder(labels.EmptyLabels())
+	for k, v := range ts.Resource.Labels {
+		b.Set(k, v)
+	}
+	for k, v := range ts.Metric.Labels {
+		b.Set(k, v)
+	}
+	b.Set(tsdbSinkMetricTypeLabel, ts.Metric.Type)
+	b.Set(tsdbSinkResourceTypeLabel, ts.Resource.Type)
+	name := tsdbSinkMetricName(ts.Metric.Type)
+
+	appendSample := func(name string, v float64) error {
+		b.Set(labels.MetricName, name)
+		_, err := app.Append(0, b.Labels(labels.EmptyLabels()), t, v)
+		return err
+	}
+	switch v := p.Value.Value.(type) {
+	case *monitoring_pb.TypedValue_DoubleValue:
+		return appendSample(name, v.DoubleValue)
+	case *monitoring_pb.TypedValue_Int64Value:
+		return appendSample(name, float64(v.Int64Value))
+	case *monitoring_pb.TypedValue_BoolValue:
+		if v.BoolValue {
+			return appendSample(name, 1)
+		}
+		return appendSample(name, 0)
+	case *monitoring_pb.TypedValue_DistributionValue:
+		d := v.DistributionValue
+		if err := appendSample(name+"_count", float64(d.Count)); err != nil {
+			return err
+		}
+		if err := appendSample(name+"_sum", d.Mean*float64(d.Count)); err != nil {
+			return err
+		}
+		bounds := d.BucketOptions.GetExplicitBuckets().GetBounds()
+		var cumulative int64
+		for i, n := range d.BucketCounts {
+			cumulative += n
+			le := math.Inf(1)
+			if i < len(bounds) {
+				le = bounds[i]
+			}
+			b.Set(labels.BucketLabel, strconv.FormatFloat(le, 'g', -1, 64))
+			if err := appendSample(name+"_bucket", float64(cumulative)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported value type %T", p.Value.Value)
+}
+
+// tsdbSinkMetricName returns the Prometheus metric name the GCM metric type was derived
+// from, i.e. the second to last element of its path.
+func tsdbSinkMetricName(metricType string) string {
+	parts := strings.Split(metricType, "/")
+	if len(parts) < 2 {
+		return metricType
+	}
+	return parts[len(parts)-2]
+}
@@ -0,0 +1,128 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	distribution_pb "google.golang.org/genproto/googleapis/api/distribution"
+	metric_pb "google.golang.org/genproto/googleapis/api/metric"
+	monitoredres_pb "google.golang.org/genproto/googleapis/api/monitoredres"
+	monitoring_pb "google.golang.org/genproto/googleapis/monitoring/v3"
+)
+
+func TestTSDBSink(t *testing.T) {
+	dir := t.TempDir()
+	opts := TSDBSinkOpts{Path: dir}
+	if err := opts.validate(); err != nil {
+		t.Fatal(err)
+	}
+	sink, err := openTSDBSink(log.NewNopLogger(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resource := &monitoredres_pb.MonitoredResource{
+		Type:   "prometheus_target",
+		Labels: map[string]string{"project_id": "p1", "job": "j1"},
+	}
+	end := time.Unix(1000, 0)
+	point := func(v *monitoring_pb.TypedValue) []*monitoring_pb.Point {
+		return []*monitoring_pb.Point{{
+			Interval: &monitoring_pb.TimeInterval{EndTime: timestamppb.New(end)},
+			Value:    v,
+		}}
+	}
+	sink.write(context.Background(), [][]*monitoring_pb.TimeSeries{{
+		{
+			Resource: resource,
+			Metric: &metric_pb.Metric{
+				Type:   "prometheus.googleapis.com/up/gauge",
+				Labels: map[string]string{"k1": "v1"},
+			},
+			Points: point(&monitoring_pb.TypedValue{Value: &monitoring_pb.TypedValue_DoubleValue{DoubleValue: 1}}),
+		}, {
+			Resource: resource,
+			Metric:   &metric_pb.Metric{Type: "prometheus.googleapis.com/latency_seconds/histogram"},
+			Points: point(&monitoring_pb.TypedValue{Value: &monitoring_pb.TypedValue_DistributionValue{
+				DistributionValue: &distribution_pb.Distribution{
+					Count: 6,
+					Mean:  0.5,
+					BucketOptions: &distribution_pb.Distribution_BucketOptions{
+						Options: &distribution_pb.Distribution_BucketOptions_ExplicitBuckets{
+							ExplicitBuckets: &distribution_pb.Distribution_BucketOptions_Explicit{Bounds: []float64{0.1, 1}},
+						},
+					},
+					BucketCounts: []int64{1, 3, 2},
+				},
+			}}),
+		},
+	}})
+	if err := sink.db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := tsdb.OpenDBReadOnly(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	q, err := db.Querier(context.Background(), math.MinInt64, math.MaxInt64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	got := map[string]float64{}
+	ss := q.Select(false, nil, labels.MustNewMatcher(labels.MatchEqual, "project_id", "p1"))
+	for ss.Next() {
+		s := ss.At()
+		it := s.Iterator()
+		for it.Next() != chunkenc.ValNone {
+			ts, v := it.At()
+			if ts != end.UnixMilli() {
+				t.Errorf("unexpected timestamp %d for series %s", ts, s.Labels())
+			}
+			got[s.Labels().String()] = v
+		}
+	}
+	if err := ss.Err(); err != nil {
+		t.Fatal(err)
+	}
+	const (
+		gauge     = `gcm_metric_type="prometheus.googleapis.com/up/gauge", gcm_resource_type="prometheus_target", job="j1", k1="v1"`
+		histogram = `gcm_metric_type="prometheus.googleapis.com/latency_seconds/histogram", gcm_resource_type="prometheus_target", job="j1"`
+	)
+	want := map[string]float64{
+		`{__name__="up", ` + gauge + `, project_id="p1"}`:                                    1,
+		`{__name__="latency_seconds_count", ` + histogram + `, project_id="p1"}`:             6,
+		`{__name__="latency_seconds_sum", ` + histogram + `, project_id="p1"}`:               3,
+		`{__name__="latency_seconds_bucket", ` + histogram + `, le="0.1", project_id="p1"}`:  1,
+		`{__name__="latency_seconds_bucket", ` + histogram + `, le="1", project_id="p1"}`:    4,
+		`{__name__="latency_seconds_bucket", ` + histogram + `, le="+Inf", project_id="p1"}`: 6,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected samples (-want, +got): %s", diff)
+	}
+}
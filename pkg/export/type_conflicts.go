@@ -0,0 +1,181 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"fmt"
+
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/textparse"
+)
+
+var metricTypeConflicts = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "gcm_export_metric_type_conflicts",
+	Help: "Number of active series whose metric type conflicts with the type of the other series of their metric, by metric name.",
+}, []string{"metric"})
+
+// Strategies for series whose metric type conflicts with the type of the other series
+// of their metric, e.g. because the type changed between scrapes.
+const (
+	// TypeConflictFork writes the series under the GCM metric type of its own
+	// Prometheus type, i.e. the metric is forked into one metric per type.
+	TypeConflictFork = "fork"
+	// TypeConflictDrop drops the series.
+	TypeConflictDrop = "drop"
+	// TypeConflictCoerce writes counter, gauge, and untyped series as the type of the
+	// other series of their metric. Series of other types are dropped.
+	TypeConflictCoerce = "coerce"
+)
+
+// TypeConflictOpts represents exporter options for handling series whose metric type
+// conflicts with the type of the other series of their metric. The type of a metric
+// is the type of its oldest active series.
+type TypeConflictOpts struct {
+	// Strategy is one of TypeConflictFork, TypeConflictDrop, or TypeConflictCoerce.
+	// Defaults to TypeConflictFork when empty.
+	Strategy string
+}
+
+func (o *TypeConflictOpts) validate() error {
+	switch o.Strategy {
+	case "":
+		o.Strategy = TypeConflictFork
+	case TypeConflictFork, TypeConflictDrop, TypeConflictCoerce:
+	default:
+		return fmt.Errorf("unknown type conflict strategy %q", o.Strategy)
+	}
+	return nil
+}
+
+// metricTypes tracks the types of the active series of a metric.
+type metricTypes struct {
+	// Type of the metric that conflicting series are resolved against.
+	established textparse.MetricType
+	// Number of series by type, excluding dropped ones.
+	series map[textparse.MetricType]int
+	// Number of series whose type conflicts with the established type.
+	conflicts int
+}
+
+// coercible returns whether series of the type can be written as another coercible type.
+func coercible(t textparse.MetricType) bool {
+	switch t {
+	case textparse.MetricTypeCounter, textparse.MetricTypeGauge, textparse.MetricTypeUnknown:
+		return true
+	}
+	return false
+}
+
+// typeKey returns the name under which the type of a series' metric is tracked. The
+// series of histograms and summaries are tracked under their base name, so that for
+// example untyped _bucket series conflict with a histogram of the same name.
+// Must be called with mtx held.
+func (c *seriesCache) typeKey(metricName, baseMetricName string, typ textparse.MetricType) string {
+	if coercible(typ) {
+		if base, _, ok := splitMetricSuffix(metricName); ok {
+			if _, ok := c.metricTypes[base]; ok {
+				return base
+			}
+		}
+	}
+	return baseMetricName
+}
+
+// resolveType tracks the type of the series and resolves conflicts with the type of
+// its metric according to the type conflict strategy. It returns the type the series
+// is written as and false if the series must be dropped.
+// Must be called with mtx held.
+func (c *seriesCache) resolveType(e *seriesCacheEntry, key string, typ textparse.MetricType) (textparse.MetricType, bool) {
+	c.releaseType(e)
+
+	mt, ok := c.metricTypes[key]
+	if !ok {
+		mt = &metricTypes{established: typ, series: map[textparse.MetricType]int{}}
+		c.metricTypes[key] = mt
+	}
+	e.typeKey = key
+	e.typ = typ
+
+	if typ != mt.established {
+		e.typeConflict = true
+		c.addTypeConflicts(key, mt, typ, 1)
+
+		switch c.typeConflicts {
+		case TypeConflictDrop:
+			e.typeDropped = true
+			return typ, false
+		case TypeConflictCoerce:
+			if !coercible(typ) || !coercible(mt.established) {
+				e.typeDropped = true
+				return typ, false
+			}
+			e.typ = mt.established
+		}
+	}
+	mt.series[e.typ]++
+	return e.typ, true
+}
+
+// releaseType removes the series from the tracked types of its metric. If no series of
+// the established type of the metric remain, the most common remaining type becomes
+// the established type. Must be called with mtx held.
+func (c *seriesCache) releaseType(e *seriesCacheEntry) {
+	if e.typeKey == "" {
+		return
+	}
+	key := e.typeKey
+	mt := c.metricTypes[key]
+
+	if e.typeConflict {
+		c.addTypeConflicts(key, mt, e.typ, -1)
+	}
+	if !e.typeDropped {
+		if mt.series[e.typ]--; mt.series[e.typ] <= 0 {
+			delete(mt.series, e.typ)
+		}
+	}
+	if mt.series[mt.established] == 0 {
+		var max int
+		for t, n := range mt.series {
+			if n > max {
+				mt.established, max = t, n
+			}
+		}
+	}
+	if len(mt.series) == 0 && mt.conflicts == 0 {
+		delete(c.metricTypes, key)
+	}
+	e.typeKey = ""
+	e.typeConflict = false
+	e.typeDropped = false
+}
+
+// addTypeConflicts updates the number of conflicting series of the metric. Must be
+// called with mtx held.
+func (c *seriesCache) addTypeConflicts(key string, mt *metricTypes, typ textparse.MetricType, n int) {
+	before := mt.conflicts
+	mt.conflicts += n
+
+	if mt.conflicts <= 0 {
+		mt.conflicts = 0
+		metricTypeConflicts.DeleteLabelValues(key)
+		return
+	}
+	if before == 0 {
+		level.Warn(c.logger).Log("msg", "metric has series of conflicting types", "metric", key, "type", mt.established, "conflicting_type", typ, "strategy", c.typeConflicts)
+	}
+	metricTypeConflicts.WithLabelValues(key).Set(float64(mt.conflicts))
+}
@@ -0,0 +1,139 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/textparse"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/prometheus/prometheus/tsdb/record"
+)
+
+func TestSeriesCache_typeConflicts(t *testing.T) {
+	externalLabels := labels.FromStrings("project_id", "p1", "location", "l1")
+	counter := testMetadataFunc(metricMetadataMap{
+		"metric1": {Type: textparse.MetricTypeCounter},
+		"metric2": {Type: textparse.MetricTypeHistogram},
+	})
+	gauge := testMetadataFunc(metricMetadataMap{
+		"metric1":        {Type: textparse.MetricTypeGauge},
+		"metric2_bucket": {Type: textparse.MetricTypeUnknown},
+	})
+
+	for _, tc := range []struct {
+		strategy string
+		// Whether the gauge series of metric1 is dropped and otherwise the metric type
+		// it is written as.
+		wantDropped bool
+		wantType    string
+		// Whether the untyped bucket series of metric2 is dropped.
+		wantBucketDropped bool
+	}{
+		{
+			strategy: TypeConflictFork,
+			wantType: "prometheus.googleapis.com/metric1/gauge",
+		}, {
+			strategy:          TypeConflictDrop,
+			wantDropped:       true,
+			wantBucketDropped: true,
+		}, {
+			strategy:          TypeConflictCoerce,
+			wantType:          "prometheus.googleapis.com/metric1/counter",
+			wantBucketDropped: true,
+		},
+	} {
+		t.Run(tc.strategy, func(t *testing.T) {
+			metricTypeConflicts.Reset()
+
+			cache := newSeriesCache(nil, nil, MetricTypePrefix, nil)
+			cache.typeConflicts = tc.strategy
+			cache.getLabelsByRef = func(ref storage.SeriesRef) labels.Labels {
+				switch ref {
+				case 4:
+					return labels.FromStrings("__name__", "metric2_bucket", "le", "1")
+				case 5:
+					return labels.FromStrings("__name__", "metric2_bucket", "instance", "i5", "le", "1")
+				}
+				return labels.FromStrings("__name__", "metric1", "instance", fmt.Sprintf("i%d", ref))
+			}
+			get := func(ref chunks.HeadSeriesRef, metadata MetadataFunc) *seriesCacheEntry {
+				e, ok := cache.get(record.RefSample{Ref: ref}, externalLabels, metadata)
+				if !ok {
+					t.Fatalf("no valid entry for series %d", ref)
+				}
+				return e
+			}
+			// Series 1 and 2 establish metric1 as a counter, series 3 is scraped from a
+			// target that exposes it as a gauge.
+			get(1, counter)
+			get(2, counter)
+			e := get(3, gauge)
+
+			if e.dropped != tc.wantDropped {
+				t.Errorf("expected dropped=%t, got %t", tc.wantDropped, e.dropped)
+			}
+			if !e.dropped {
+				var got string
+				if s := e.protos.gauge.proto; s != nil {
+					got = s.Metric.Type
+				} else {
+					got = e.protos.cumulative.proto.Metric.Type
+				}
+				if got != tc.wantType {
+					t.Errorf("expected metric type %q, got %q", tc.wantType, got)
+				}
+			}
+			if got := testutil.ToFloat64(metricTypeConflicts.WithLabelValues("metric1")); got != 1 {
+				t.Errorf("expected 1 conflicting series of metric1, got %v", got)
+			}
+
+			// Untyped bucket series conflict with a histogram of the same name.
+			get(4, counter)
+			if e := get(5, gauge); e.dropped != tc.wantBucketDropped {
+				t.Errorf("expected dropped=%t for bucket series, got %t", tc.wantBucketDropped, e.dropped)
+			}
+			if got := testutil.ToFloat64(metricTypeConflicts.WithLabelValues("metric2")); got != 1 {
+				t.Errorf("expected 1 conflicting series of metric2, got %v", got)
+			}
+
+			// Once the counter series are gone, the gauge series establishes the type
+			// of the metric on its next refresh.
+			cache.mtx.Lock()
+			cache.each(func(ref storage.SeriesRef, e *seriesCacheEntry) {
+				if ref == 1 || ref == 2 {
+					cache.remove(ref, e)
+				}
+			})
+			cache.mtx.Unlock()
+
+			cache.forceRefresh()
+			e = get(3, gauge)
+			if e.dropped || e.typeConflict {
+				t.Errorf("expected series to be exported without conflict, got dropped=%t conflict=%t", e.dropped, e.typeConflict)
+			}
+			if got := testutil.CollectAndCount(metricTypeConflicts); got != 1 {
+				t.Errorf("expected conflicts of only metric2, got %d metrics", got)
+			}
+			if got := cache.metricTypes["metric1"].established; got != textparse.MetricTypeGauge {
+				t.Errorf("expected gauge type for metric1, got %s", got)
+			}
+		})
+	}
+}
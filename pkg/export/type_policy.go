@@ -0,0 +1,105 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/textparse"
+)
+
+var typePolicySeries = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "gcm_export_type_policy_series",
+	Help: "Number of active series that are dropped or transformed by the export policy of their metric type, by type and action.",
+}, []string{"type", "action"})
+
+// Actions of the export policy for a metric type.
+const (
+	// TypePolicyKeep writes series of the type as usual.
+	TypePolicyKeep = "keep"
+	// TypePolicyDrop drops all series of the type.
+	TypePolicyDrop = "drop"
+	// TypePolicyCountSum only writes the _count and _sum series of histograms and
+	// summaries as cumulatives and drops their buckets and quantiles.
+	TypePolicyCountSum = "count-sum"
+)
+
+// TypePolicyOpts represents exporter options for dropping or transforming all series
+// of a metric type, e.g. to drop all summaries to reduce cost.
+type TypePolicyOpts struct {
+	// Actions by Prometheus metric type. Series of types without an action are kept.
+	// TypePolicyCountSum is only valid for histograms and summaries.
+	Actions map[textparse.MetricType]string
+	// MaxBucketSeries is the maximum number of active _bucket series of a histogram
+	// metric. Histograms of metrics with more bucket series are written as with
+	// TypePolicyCountSum until they are back within the limit. Unlimited if 0.
+	MaxBucketSeries int
+}
+
+func (o *TypePolicyOpts) validate() error {
+	for typ, action := range o.Actions {
+		switch typ {
+		case textparse.MetricTypeCounter, textparse.MetricTypeGauge, textparse.MetricTypeUnknown,
+			textparse.MetricTypeGaugeHistogram, textparse.MetricTypeHistogram, textparse.MetricTypeSummary:
+		default:
+			return fmt.Errorf("unknown metric type %q", typ)
+		}
+		switch action {
+		case TypePolicyKeep, TypePolicyDrop:
+		case TypePolicyCountSum:
+			if typ != textparse.MetricTypeHistogram && typ != textparse.MetricTypeSummary {
+				return fmt.Errorf("action %q is not supported for metric type %q", action, typ)
+			}
+		default:
+			return fmt.Errorf("unknown action %q for metric type %q", action, typ)
+		}
+	}
+	if o.MaxBucketSeries < 0 {
+		return fmt.Errorf("max bucket series must not be negative, got %d", o.MaxBucketSeries)
+	}
+	return nil
+}
+
+// policyAction returns the action of the type policy for a series of the type that
+// belongs to the metric. Must be called with mtx held.
+func (c *seriesCache) policyAction(typ textparse.MetricType, baseMetricName string) string {
+	if action, ok := c.typePolicy.Actions[typ]; ok && action != TypePolicyKeep {
+		return action
+	}
+	if typ == textparse.MetricTypeHistogram && c.typePolicy.MaxBucketSeries > 0 &&
+		c.metricSeries[baseMetricName+string(metricSuffixBucket)] > c.typePolicy.MaxBucketSeries {
+		return TypePolicyCountSum
+	}
+	return TypePolicyKeep
+}
+
+// setPolicyAction updates the type and the action of the type policy the series is
+// counted under. Kept series are not counted. Must be called with mtx held.
+func (c *seriesCache) setPolicyAction(e *seriesCacheEntry, typ textparse.MetricType, action string) {
+	if action == TypePolicyKeep {
+		typ, action = "", ""
+	}
+	if e.policyType == typ && e.policyAction == action {
+		return
+	}
+	if e.policyAction != "" {
+		typePolicySeries.WithLabelValues(string(e.policyType), e.policyAction).Dec()
+	}
+	if action != "" {
+		typePolicySeries.WithLabelValues(string(typ), action).Inc()
+	}
+	e.policyType, e.policyAction = typ, action
+}
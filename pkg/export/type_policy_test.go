@@ -0,0 +1,144 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/textparse"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/prometheus/prometheus/tsdb/record"
+	metric_pb "google.golang.org/genproto/googleapis/api/metric"
+)
+
+func TestTypePolicyOpts_validate(t *testing.T) {
+	valid := TypePolicyOpts{
+		Actions: map[textparse.MetricType]string{
+			textparse.MetricTypeSummary:   TypePolicyDrop,
+			textparse.MetricTypeHistogram: TypePolicyCountSum,
+			textparse.MetricTypeGauge:     TypePolicyKeep,
+		},
+		MaxBucketSeries: 100,
+	}
+	if err := valid.validate(); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	for _, o := range []TypePolicyOpts{
+		{Actions: map[textparse.MetricType]string{"foo": TypePolicyDrop}},
+		{Actions: map[textparse.MetricType]string{textparse.MetricTypeCounter: "foo"}},
+		{Actions: map[textparse.MetricType]string{textparse.MetricTypeCounter: TypePolicyCountSum}},
+		{MaxBucketSeries: -1},
+	} {
+		if err := o.validate(); err == nil {
+			t.Errorf("expected error for %+v", o)
+		}
+	}
+}
+
+func TestSeriesCache_typePolicy(t *testing.T) {
+	typePolicySeries.Reset()
+
+	cache := newSeriesCache(nil, nil, MetricTypePrefix, nil)
+	cache.typePolicy = TypePolicyOpts{
+		Actions:         map[textparse.MetricType]string{textparse.MetricTypeSummary: TypePolicyDrop},
+		MaxBucketSeries: 2,
+	}
+	series := map[storage.SeriesRef]labels.Labels{
+		1: labels.FromStrings("__name__", "rpc_duration_seconds", "quantile", "0.5"),
+		2: labels.FromStrings("__name__", "rpc_duration_seconds_count"),
+		3: labels.FromStrings("__name__", "http_duration_seconds_bucket", "le", "1"),
+		4: labels.FromStrings("__name__", "http_duration_seconds_bucket", "le", "+Inf"),
+		5: labels.FromStrings("__name__", "http_duration_seconds_sum"),
+		6: labels.FromStrings("__name__", "http_duration_seconds_bucket", "le", "2"),
+		7: labels.FromStrings("__name__", "requests_total"),
+	}
+	cache.getLabelsByRef = func(ref storage.SeriesRef) labels.Labels {
+		return series[ref]
+	}
+	externalLabels := labels.FromStrings("project_id", "p1", "location", "l1")
+	metadata := testMetadataFunc(metricMetadataMap{
+		"rpc_duration_seconds":  {Type: textparse.MetricTypeSummary},
+		"http_duration_seconds": {Type: textparse.MetricTypeHistogram},
+		"requests_total":        {Type: textparse.MetricTypeCounter},
+	})
+	get := func(ref storage.SeriesRef) *seriesCacheEntry {
+		t.Helper()
+		e, ok := cache.get(record.RefSample{Ref: chunks.HeadSeriesRef(ref)}, externalLabels, metadata)
+		if !ok {
+			t.Fatalf("no entry for series %d", ref)
+		}
+		return e
+	}
+
+	// Summaries are dropped entirely, other types are kept.
+	for _, ref := range []storage.SeriesRef{1, 2} {
+		if e := get(ref); !e.dropped || !e.policyDropped {
+			t.Errorf("expected series %d to be dropped by the type policy", ref)
+		}
+	}
+	if e := get(7); e.dropped {
+		t.Errorf("expected counter series to be kept")
+	}
+
+	// Within the bucket series limit, histograms are written as distributions.
+	if e := get(3); e.dropped || e.protos.cumulative.proto.ValueType != metric_pb.MetricDescriptor_DISTRIBUTION {
+		t.Errorf("expected bucket series to be written as distribution")
+	}
+	get(4)
+	get(5)
+
+	// The third bucket series exceeds the limit and the histogram is written as count
+	// and sum once its series are refreshed.
+	if e := get(6); !e.dropped || !e.policyDropped {
+		t.Errorf("expected bucket series exceeding the limit to be dropped")
+	}
+	cache.forceRefresh()
+	e := get(5)
+	if e.dropped {
+		t.Fatalf("expected sum series to be written")
+	}
+	if got, want := e.protos.cumulative.proto.Metric.Type, "prometheus.googleapis.com/http_duration_seconds_sum/counter"; got != want {
+		t.Errorf("expected metric type %q, got %q", want, got)
+	}
+	if got := e.protos.cumulative.proto.ValueType; got != metric_pb.MetricDescriptor_DOUBLE {
+		t.Errorf("expected double value type, got %s", got)
+	}
+	for _, ref := range []storage.SeriesRef{3, 4} {
+		if e := get(ref); !e.dropped {
+			t.Errorf("expected bucket series %d to be dropped after refresh", ref)
+		}
+	}
+
+	if got := testutil.ToFloat64(typePolicySeries.WithLabelValues("summary", TypePolicyDrop)); got != 2 {
+		t.Errorf("expected 2 dropped summary series, got %v", got)
+	}
+	if got := testutil.ToFloat64(typePolicySeries.WithLabelValues("histogram", TypePolicyCountSum)); got != 4 {
+		t.Errorf("expected 4 count-sum histogram series, got %v", got)
+	}
+
+	// Removed series are no longer counted.
+	cache.mtx.Lock()
+	cache.each(func(ref storage.SeriesRef, e *seriesCacheEntry) {
+		cache.remove(ref, e)
+	})
+	cache.mtx.Unlock()
+
+	if got := testutil.ToFloat64(typePolicySeries.WithLabelValues("histogram", TypePolicyCountSum)); got != 0 {
+		t.Errorf("expected no count-sum histogram series, got %v", got)
+	}
+}
@@ -65,6 +65,26 @@ func ClusterPodMonitoringResource() metav1.GroupVersionResource {
 	}
 }
 
+// PodMonitoringTargetStatusResource returns a PodMonitoringTargetStatus GroupVersionResource.
+// This can be used to enforce API types.
+func PodMonitoringTargetStatusResource() metav1.GroupVersionResource {
+	return metav1.GroupVersionResource{
+		Group:    monitoring.GroupName,
+		Version:  Version,
+		Resource: "podmonitoringtargetstatuses",
+	}
+}
+
+// ClusterPodMonitoringTargetStatusResource returns a ClusterPodMonitoringTargetStatus GroupVersionResource.
+// This can be used to enforce API types.
+func ClusterPodMonitoringTargetStatusResource() metav1.GroupVersionResource {
+	return metav1.GroupVersionResource{
+		Group:    monitoring.GroupName,
+		Version:  Version,
+		Resource: "clusterpodmonitoringtargetstatuses",
+	}
+}
+
 // OperatorConfigResource returns a OperatorConfig GroupVersionResource.
 // This can be used to enforce API types.
 func OperatorConfigResource() metav1.GroupVersionResource {
@@ -75,6 +95,26 @@ func OperatorConfigResource() metav1.GroupVersionResource {
 	}
 }
 
+// OperatorConfigTargetStatusResource returns a OperatorConfigTargetStatus GroupVersionResource.
+// This can be used to enforce API types.
+func OperatorConfigTargetStatusResource() metav1.GroupVersionResource {
+	return metav1.GroupVersionResource{
+		Group:    monitoring.GroupName,
+		Version:  Version,
+		Resource: "operatorconfigtargetstatuses",
+	}
+}
+
+// MonitoringStatusResource returns a MonitoringStatus GroupVersionResource.
+// This can be used to enforce API types.
+func MonitoringStatusResource() metav1.GroupVersionResource {
+	return metav1.GroupVersionResource{
+		Group:    monitoring.GroupName,
+		Version:  Version,
+		Resource: "monitoringstatuses",
+	}
+}
+
 // GlobalRulesResource returns a GlobalRules GroupVersionResource.
 // This can be used to enforce API types.
 func GlobalRulesResource() metav1.GroupVersionResource {
@@ -105,6 +145,16 @@ func RulesResource() metav1.GroupVersionResource {
 	}
 }
 
+// SilenceResource returns a Silence GroupVersionResource.
+// This can be used to enforce API types.
+func SilenceResource() metav1.GroupVersionResource {
+	return metav1.GroupVersionResource{
+		Group:    monitoring.GroupName,
+		Version:  Version,
+		Resource: "silences",
+	}
+}
+
 // Adds the list of known types to Scheme.
 func addKnownTypes(scheme *runtime.Scheme) error {
 	scheme.AddKnownTypes(SchemeGroupVersion,
@@ -112,6 +162,10 @@ func addKnownTypes(scheme *runtime.Scheme) error {
 		&PodMonitoringList{},
 		&ClusterPodMonitoring{},
 		&ClusterPodMonitoringList{},
+		&PodMonitoringTargetStatus{},
+		&PodMonitoringTargetStatusList{},
+		&ClusterPodMonitoringTargetStatus{},
+		&ClusterPodMonitoringTargetStatusList{},
 		&Rules{},
 		&RulesList{},
 		&ClusterRules{},
@@ -120,6 +174,12 @@ func addKnownTypes(scheme *runtime.Scheme) error {
 		&GlobalRulesList{},
 		&OperatorConfig{},
 		&OperatorConfigList{},
+		&OperatorConfigTargetStatus{},
+		&OperatorConfigTargetStatusList{},
+		&MonitoringStatus{},
+		&MonitoringStatusList{},
+		&Silence{},
+		&SilenceList{},
 	)
 	metav1.AddToGroupVersion(scheme, SchemeGroupVersion)
 	return nil
@@ -46,6 +46,7 @@ var (
 // OperatorConfig defines configuration of the gmp-operator.
 // +genclient
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:subresource:status
 // +kubebuilder:storageversion
 type OperatorConfig struct {
 	metav1.TypeMeta   `json:",inline"`
@@ -59,6 +60,37 @@ type OperatorConfig struct {
 	ManagedAlertmanager *ManagedAlertmanagerSpec `json:"managedAlertmanager,omitempty"`
 	// Features holds configuration for optional managed-collection features.
 	Features OperatorFeatures `json:"features,omitempty"`
+	// Endpoints overrides the Cloud Monitoring API endpoints that collectors and the
+	// rule-evaluator connect to.
+	Endpoints APIEndpoints `json:"endpoints,omitempty"`
+	// Most recently observed status of the managed collection.
+	// +optional
+	Status OperatorConfigStatus `json:"status,omitempty"`
+}
+
+// OperatorConfigStatus holds status information of the managed collection.
+type OperatorConfigStatus struct {
+	// Represents the latest available observations of the managed collection.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []MonitoringCondition `json:"conditions,omitempty"`
+}
+
+// APIEndpoints overrides the Cloud Monitoring API endpoints, e.g. with regional
+// endpoints for data residency or Private Service Connect endpoints for private
+// networking.
+type APIEndpoints struct {
+	// Export is the address of the endpoint that collectors and the rule-evaluator
+	// write metric data to as host:port. Defaults to monitoring.googleapis.com:443.
+	Export string `json:"export,omitempty"`
+	// TLSServerName is the name the certificate of the export endpoint is verified
+	// against if it differs from the host of the endpoint, e.g. monitoring.googleapis.com
+	// for a Private Service Connect endpoint that is addressed by a custom DNS name.
+	TLSServerName string `json:"tlsServerName,omitempty"`
+	// Query is the host of the endpoint the rule-evaluator evaluates rules against.
+	// Defaults to monitoring.googleapis.com.
+	Query string `json:"query,omitempty"`
 }
 
 // OperatorConfigList is a list of OperatorConfigs.
@@ -69,6 +101,88 @@ type OperatorConfigList struct {
 	Items           []OperatorConfig `json:"items"`
 }
 
+// OperatorConfigTargetStatus holds the target status of the kubelet scraping
+// configured in the OperatorConfig of the same name and namespace.
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:storageversion
+type OperatorConfigTargetStatus struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	// Represents the latest available observations of target state for each kubelet
+	// scrape endpoint.
+	EndpointStatuses []ScrapeEndpointStatus `json:"endpointStatuses,omitempty"`
+}
+
+// OperatorConfigTargetStatusList is a list of OperatorConfigTargetStatuses.
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type OperatorConfigTargetStatusList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []OperatorConfigTargetStatus `json:"items"`
+}
+
+// MonitoringStatus summarizes the reconciliation state of the managed monitoring
+// stack. It is a read-only singleton maintained by the operator and is meant to
+// be used by health checks that assert convergence after configuration changes.
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:subresource:status
+// +kubebuilder:storageversion
+type MonitoringStatus struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	// Most recently observed status of the monitoring stack.
+	// +optional
+	Status MonitoringStatusStatus `json:"status"`
+}
+
+// MonitoringStatusList is a list of MonitoringStatuses.
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type MonitoringStatusList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []MonitoringStatus `json:"items"`
+}
+
+// MonitoringStatusStatus holds the reconciliation state of the monitoring stack.
+type MonitoringStatusStatus struct {
+	// Generation of the OperatorConfig applied to collection and rules.
+	OperatorConfigGeneration int64 `json:"operatorConfigGeneration,omitempty"`
+	// State of the collectors.
+	Collection ComponentState `json:"collection,omitempty"`
+	// State of the rule-evaluator.
+	Rules ComponentState `json:"rules,omitempty"`
+	// Whether the generated configuration is rolled out to all components.
+	Converged bool `json:"converged"`
+}
+
+// ComponentState describes the configuration and rollout state of a managed component.
+type ComponentState struct {
+	// SHA-256 hash of the configuration generated for the component.
+	ConfigHash string `json:"configHash,omitempty"`
+	// Number of generated configuration files.
+	ConfigFiles int32 `json:"configFiles,omitempty"`
+	// Rollout state of the component's workload. Unset if the workload does not exist.
+	Rollout *RolloutState `json:"rollout,omitempty"`
+}
+
+// RolloutState describes the rollout state of a DaemonSet or Deployment.
+type RolloutState struct {
+	// Generation of the workload.
+	Generation int64 `json:"generation,omitempty"`
+	// Generation of the workload observed by its controller.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Number of desired Pods.
+	Desired int32 `json:"desired,omitempty"`
+	// Number of Pods running the current workload template.
+	Updated int32 `json:"updated,omitempty"`
+	// Number of ready Pods.
+	Ready int32 `json:"ready,omitempty"`
+	// Whether the current workload template is rolled out to all desired Pods.
+	Complete bool `json:"complete"`
+}
+
 // RuleEvaluatorSpec defines configuration for deploying rule-evaluator.
 type RuleEvaluatorSpec struct {
 	// ExternalLabels specifies external labels that are attached to any rule
@@ -79,6 +193,12 @@ type RuleEvaluatorSpec struct {
 	// If left blank, the rule-evaluator will try attempt to infer the Project ID
 	// from the environment.
 	QueryProjectID string `json:"queryProjectID,omitempty"`
+	// FanOutProjectIDs are GCP project IDs to evaluate rules against instead of
+	// queryProjectID, so that the same rules, e.g. of GlobalRules, are evaluated
+	// against each project. The project_id label of their results and alerts is set
+	// to the project. Rules of Rules and ClusterRules are still evaluated against
+	// queryProjectID only.
+	FanOutProjectIDs []string `json:"fanOutProjectIDs,omitempty"`
 	// The base URL used for the generator URL in the alert notification payload.
 	// Should point to an instance of a query frontend that gives access to queryProjectID.
 	GeneratorURL string `json:"generatorUrl,omitempty"`
@@ -91,6 +211,13 @@ type RuleEvaluatorSpec struct {
 	// Within GKE, this can typically be left empty if the compute default
 	// service account has the required permissions.
 	Credentials *v1.SecretKeySelector `json:"credentials,omitempty"`
+	// HighAvailability runs two rule-evaluator replicas that both evaluate all rules.
+	// Only the replica holding a lease writes the results of recording rules, while
+	// both send the same alerts, which Alertmanager deduplicates, so that a restart
+	// of a single replica does not cause gaps in alerting. The replicas are preferably
+	// scheduled on different nodes and a PodDisruptionBudget keeps one of them available
+	// during voluntary disruptions.
+	HighAvailability bool `json:"highAvailability,omitempty"`
 }
 
 // CollectionSpec specifies how the operator configures collection of metric data.
@@ -111,6 +238,36 @@ type CollectionSpec struct {
 	KubeletScraping *KubeletScraping `json:"kubeletScraping,omitempty"`
 	// Compression enables compression of metrics collection data
 	Compression CompressionType `json:"compression,omitempty"`
+	// Batching tunes how collectors batch metric data sent to Cloud Monitoring.
+	Batching *ExportBatching `json:"batching,omitempty"`
+	// MetricTypePrefixes maps namespaces to the prefix of the Cloud Monitoring metric
+	// types that metrics scraped from pods in the namespace are written as. The namespace
+	// is matched against the `namespace` label of the scraped series. The prefix set in a
+	// PodMonitoring or ClusterPodMonitoring takes precedence.
+	MetricTypePrefixes map[string]string `json:"metricTypePrefixes,omitempty"`
+	// PauseExport stops collectors from sending metric data to Cloud Monitoring while
+	// they continue to scrape. Scraped data is buffered until the buffers of the
+	// collectors are full and dropped afterwards.
+	PauseExport bool `json:"pauseExport,omitempty"`
+}
+
+// ExportBatching tunes how collectors batch metric data sent to Cloud Monitoring.
+// Larger batches and batch delays lead to fewer requests at the cost of latency.
+type ExportBatching struct {
+	// Maximum number of samples sent in a single request. Defaults to 200.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=200
+	BatchSize int32 `json:"batchSize,omitempty"`
+	// Maximum time a batch that is not full is held back before it is sent.
+	// Must be a valid Prometheus duration between 1ms and 10s. Defaults to 50ms.
+	// +kubebuilder:validation:Pattern="^((([0-9]+)y)?(([0-9]+)w)?(([0-9]+)d)?(([0-9]+)h)?(([0-9]+)m)?(([0-9]+)s)?(([0-9]+)ms)?|0)$"
+	BatchDelay string `json:"batchDelay,omitempty"`
+	// Maximum number of samples buffered for sending in each of the shards of a
+	// collector. Samples are dropped if the buffer of their shard is full.
+	// Defaults to 2048.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65536
+	ShardBufferSize int32 `json:"shardBufferSize,omitempty"`
 }
 
 // OperatorFeatures holds configuration for optional managed-collection features.
@@ -133,7 +290,50 @@ type ConfigSpec struct {
 type TargetStatusSpec struct {
 	// Enable target status reporting.
 	Enabled bool `json:"enabled,omitempty"`
-}
+	// Interval at which the target status is polled from the collectors.
+	// Must be a valid Prometheus duration of at least 10s. Defaults to 10s.
+	// Fetches from the individual collectors are spread over the first half
+	// of the interval.
+	// +kubebuilder:validation:Pattern="^((([0-9]+)y)?(([0-9]+)w)?(([0-9]+)d)?(([0-9]+)h)?(([0-9]+)m)?(([0-9]+)s)?(([0-9]+)ms)?|0)$"
+	Interval string `json:"interval,omitempty"`
+	// Maximum number of sample targets kept in each sample group of an endpoint status.
+	// Defaults to 5, which also applies if set to 0, so sample targets cannot be disabled.
+	// +kubebuilder:validation:Minimum=0
+	MaxSampleTargets int32 `json:"maxSampleTargets,omitempty"`
+	// Maximum number of sample groups kept in each endpoint status. Groups of unhealthy
+	// targets are kept in favor of healthy ones. Defaults to no limit.
+	// +kubebuilder:validation:Minimum=0
+	MaxSampleGroups int32 `json:"maxSampleGroups,omitempty"`
+	// Policy by which sample groups are truncated. Defaults to Sample.
+	TruncationPolicy TruncationPolicy `json:"truncationPolicy,omitempty"`
+	// Write target statuses into dedicated PodMonitoringTargetStatus and
+	// ClusterPodMonitoringTargetStatus objects instead of the status of the
+	// PodMonitoring and ClusterPodMonitoring resources. This avoids rewriting
+	// the monitoring resources on every poll.
+	StatusObjects bool `json:"statusObjects,omitempty"`
+	// Number of polls after which an unchanged target status is still rewritten to
+	// refresh its last update time. Unchanged statuses are otherwise not written to
+	// avoid needless API server traffic. Defaults to 10.
+	// +kubebuilder:validation:Minimum=0
+	RefreshPolls int32 `json:"refreshPolls,omitempty"`
+}
+
+// TruncationPolicy defines which sample groups are kept in endpoint statuses.
+// +kubebuilder:validation:Enum=Sample;UnhealthyOnly;TopErrors;CountsOnly
+type TruncationPolicy string
+
+const (
+	// Keep sample groups of unhealthy targets in favor of healthy ones, up to
+	// maxSampleGroups groups.
+	TruncationPolicySample TruncationPolicy = "Sample"
+	// Only keep sample groups of unhealthy targets, up to maxSampleGroups groups.
+	TruncationPolicyUnhealthyOnly TruncationPolicy = "UnhealthyOnly"
+	// Only keep the maxSampleGroups sample groups of unhealthy targets with the
+	// highest target counts.
+	TruncationPolicyTopErrors TruncationPolicy = "TopErrors"
+	// Only keep the target counts of endpoints and no sample groups.
+	TruncationPolicyCountsOnly TruncationPolicy = "CountsOnly"
+)
 
 // +kubebuilder:validation:Enum=none;gzip
 type CompressionType string
@@ -154,6 +354,15 @@ type ExportFilters struct {
 	// parameter of the Prometheus federation endpoint to selectively export data.
 	// Example: `["{job!='foobar'}", "{__name__!~'container_foo.*|container_bar.*'}"]`
 	MatchOneOf []string `json:"matchOneOf,omitempty"`
+	// A list of regular expressions of metric names. If set, only time series whose
+	// metric name fully matches at least one of them are exported. Applies in addition
+	// to matchOneOf and the relabeling rules of individual PodMonitorings.
+	// Example: `["kube_.+", "up"]`
+	AllowMetricNames []string `json:"allowMetricNames,omitempty"`
+	// A list of regular expressions of metric names. Time series whose metric name
+	// fully matches any of them are never exported, even if allowed otherwise.
+	// Example: `["go_.+", "process_.+"]`
+	DenyMetricNames []string `json:"denyMetricNames,omitempty"`
 }
 
 // AlertingSpec defines alerting configuration.
@@ -250,6 +459,10 @@ type PodMonitoringStatusContainer interface {
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 // +kubebuilder:subresource:status
 // +kubebuilder:storageversion
+// +kubebuilder:printcolumn:name="Targets",type=integer,JSONPath=`.status.summary.activeTargets`
+// +kubebuilder:printcolumn:name="Unhealthy",type=integer,JSONPath=`.status.summary.unhealthyTargets`
+// +kubebuilder:printcolumn:name="Status",type=string,JSONPath=`.status.summary.worstCondition`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 type PodMonitoring struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
@@ -277,6 +490,26 @@ type PodMonitoringList struct {
 	Items           []PodMonitoring `json:"items"`
 }
 
+// PodMonitoringTargetStatus holds the target status of the PodMonitoring
+// of the same name and namespace.
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:storageversion
+type PodMonitoringTargetStatus struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	// Represents the latest available observations of target state for each ScrapeEndpoint.
+	EndpointStatuses []ScrapeEndpointStatus `json:"endpointStatuses,omitempty"`
+}
+
+// PodMonitoringTargetStatusList is a list of PodMonitoringTargetStatuses.
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type PodMonitoringTargetStatusList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []PodMonitoringTargetStatus `json:"items"`
+}
+
 // ClusterPodMonitoring defines monitoring for a set of pods, scoped to all
 // pods within the cluster.
 // +genclient
@@ -285,6 +518,10 @@ type PodMonitoringList struct {
 // +kubebuilder:resource:scope=Cluster
 // +kubebuilder:subresource:status
 // +kubebuilder:storageversion
+// +kubebuilder:printcolumn:name="Targets",type=integer,JSONPath=`.status.summary.activeTargets`
+// +kubebuilder:printcolumn:name="Unhealthy",type=integer,JSONPath=`.status.summary.unhealthyTargets`
+// +kubebuilder:printcolumn:name="Status",type=string,JSONPath=`.status.summary.worstCondition`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 type ClusterPodMonitoring struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
@@ -312,6 +549,28 @@ type ClusterPodMonitoringList struct {
 	Items           []ClusterPodMonitoring `json:"items"`
 }
 
+// ClusterPodMonitoringTargetStatus holds the target status of the
+// ClusterPodMonitoring of the same name.
+// +genclient
+// +genclient:nonNamespaced
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:storageversion
+type ClusterPodMonitoringTargetStatus struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	// Represents the latest available observations of target state for each ScrapeEndpoint.
+	EndpointStatuses []ScrapeEndpointStatus `json:"endpointStatuses,omitempty"`
+}
+
+// ClusterPodMonitoringTargetStatusList is a list of ClusterPodMonitoringTargetStatuses.
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type ClusterPodMonitoringTargetStatusList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterPodMonitoringTargetStatus `json:"items"`
+}
+
 func (cm *ClusterPodMonitoring) ValidateCreate() error {
 	if len(cm.Spec.Endpoints) == 0 {
 		return errors.New("at least one endpoint is required")
@@ -391,10 +650,12 @@ func (status *PodMonitoringStatus) SetPodMonitoringCondition(gen int64, now meta
 
 	// Set up defaults.
 	for _, mc := range NewDefaultConditions(now) {
+		mc := mc
 		conds[mc.Type] = &mc
 	}
 	// Overwrite with any previous state.
 	for _, mc := range status.Conditions {
+		mc := mc
 		conds[mc.Type] = &mc
 	}
 
@@ -421,6 +682,10 @@ func (status *PodMonitoringStatus) SetPodMonitoringCondition(gen int64, now meta
 		for _, c := range conds {
 			status.Conditions = append(status.Conditions, *c)
 		}
+		// Sort to keep the order stable across updates.
+		sort.Slice(status.Conditions, func(i, j int) bool {
+			return status.Conditions[i].Type < status.Conditions[j].Type
+		})
 	}
 
 	return update, nil
@@ -471,8 +736,13 @@ func (pm *PodMonitoring) endpointScrapeConfig(index int, projectID, location, cl
 		Replacement: pm.Name,
 		TargetLabel: "job",
 	})
+	if pm.Spec.MetricTypePrefix != "" {
+		if err := ValidateMetricTypePrefix(pm.Spec.MetricTypePrefix); err != nil {
+			return nil, err
+		}
+	}
 
-	return endpointScrapeConfig(
+	cfg, err := endpointScrapeConfig(
 		pm.GetKey(),
 		projectID, location, cluster,
 		pm.Spec.Endpoints[index],
@@ -480,6 +750,19 @@ func (pm *PodMonitoring) endpointScrapeConfig(index int, projectID, location, cl
 		pm.Spec.TargetLabels.FromPod,
 		pm.Spec.Limits,
 	)
+	if err != nil {
+		return nil, err
+	}
+	// The prefix is set on the scraped series rather than the target so that it is applied
+	// after the label was dropped from the scraped series.
+	if pm.Spec.MetricTypePrefix != "" {
+		cfg.MetricRelabelConfigs = append(cfg.MetricRelabelConfigs, &relabel.Config{
+			Action:      relabel.Replace,
+			Replacement: pm.Spec.MetricTypePrefix,
+			TargetLabel: export.KeyMetricTypePrefix,
+		})
+	}
+	return cfg, nil
 }
 
 // relabelingsForSelector generates a sequence of relabeling rules that implement
@@ -699,6 +982,13 @@ func endpointScrapeConfig(id, projectID, location, cluster string, ep ScrapeEndp
 		}
 		metricRelabelCfgs = append(metricRelabelCfgs, rcfg)
 	}
+	// The metric type prefix label is reserved for rules generated by the operator.
+	// Drop it from scraped series so targets cannot choose the metric types they are
+	// written as.
+	metricRelabelCfgs = append(metricRelabelCfgs, &relabel.Config{
+		Action: relabel.LabelDrop,
+		Regex:  relabel.MustNewRegexp(regexp.QuoteMeta(export.KeyMetricTypePrefix)),
+	})
 
 	httpCfg := config.DefaultHTTPClientConfig
 	if ep.ProxyURL != "" {
@@ -816,8 +1106,13 @@ func (cm *ClusterPodMonitoring) endpointScrapeConfig(index int, projectID, locat
 		Replacement: cm.Name,
 		TargetLabel: "job",
 	})
+	if cm.Spec.MetricTypePrefix != "" {
+		if err := ValidateMetricTypePrefix(cm.Spec.MetricTypePrefix); err != nil {
+			return nil, err
+		}
+	}
 
-	return endpointScrapeConfig(
+	cfg, err := endpointScrapeConfig(
 		cm.GetKey(),
 		projectID, location, cluster,
 		cm.Spec.Endpoints[index],
@@ -825,6 +1120,19 @@ func (cm *ClusterPodMonitoring) endpointScrapeConfig(index int, projectID, locat
 		cm.Spec.TargetLabels.FromPod,
 		cm.Spec.Limits,
 	)
+	if err != nil {
+		return nil, err
+	}
+	// The prefix is set on the scraped series rather than the target so that it is applied
+	// after the label was dropped from the scraped series.
+	if cm.Spec.MetricTypePrefix != "" {
+		cfg.MetricRelabelConfigs = append(cfg.MetricRelabelConfigs, &relabel.Config{
+			Action:      relabel.Replace,
+			Replacement: cm.Spec.MetricTypePrefix,
+			TargetLabel: export.KeyMetricTypePrefix,
+		})
+	}
+	return cfg, nil
 }
 
 // convertRelabelingRule converts the rule to a relabel configuration. An error is returned
@@ -865,6 +1173,10 @@ func convertRelabelingRule(r RelabelingRule) (*relabel.Config, error) {
 		if isProtectedLabel(r.TargetLabel) {
 			return nil, fmt.Errorf("cannot relabel with action %q onto protected label %q", r.Action, r.TargetLabel)
 		}
+		// The metric type prefix may only be set through the metricTypePrefix field.
+		if r.TargetLabel == export.KeyMetricTypePrefix {
+			return nil, fmt.Errorf("cannot relabel with action %q onto label %q, use the metricTypePrefix field instead", r.Action, r.TargetLabel)
+		}
 	case relabel.LabelDrop:
 		if matchesAnyProtectedLabel(re) {
 			return nil, fmt.Errorf("regex %s would drop at least one of the protected labels %s", r.Regex, strings.Join(protectedLabels, ", "))
@@ -890,6 +1202,17 @@ func convertRelabelingRule(r RelabelingRule) (*relabel.Config, error) {
 	return rcfg, nil
 }
 
+var metricTypePrefixRe = regexp.MustCompile(`^(prometheus|custom|external|workload)[.]googleapis[.]com(/[a-zA-Z0-9_.-]+)*$`)
+
+// ValidateMetricTypePrefix returns an error if the prefix is not a valid prefix of
+// Cloud Monitoring metric types the exporter accepts.
+func ValidateMetricTypePrefix(prefix string) error {
+	if !metricTypePrefixRe.MatchString(prefix) {
+		return fmt.Errorf("invalid metric type prefix %q", prefix)
+	}
+	return export.ValidateMetricTypePrefix(prefix)
+}
+
 var protectedLabels = []string{
 	export.KeyProjectID,
 	export.KeyLocation,
@@ -965,6 +1288,13 @@ type PodMonitoringSpec struct {
 	TargetLabels TargetLabels `json:"targetLabels,omitempty"`
 	// Limits to apply at scrape time.
 	Limits *ScrapeLimits `json:"limits,omitempty"`
+	// Prefix of the Cloud Monitoring metric types the scraped metrics are written as,
+	// e.g. `custom.googleapis.com/team-a`. Must be one of or below the domains
+	// `prometheus.googleapis.com`, `custom.googleapis.com`, `external.googleapis.com`
+	// and `workload.googleapis.com`. Defaults to the metric type prefix of the
+	// namespace set in the OperatorConfig or `prometheus.googleapis.com`.
+	// +kubebuilder:validation:Pattern="^(prometheus|custom|external|workload)[.]googleapis[.]com(/[a-zA-Z0-9_.-]+)*$"
+	MetricTypePrefix string `json:"metricTypePrefix,omitempty"`
 }
 
 // ScrapeLimits limits applied to scraped targets.
@@ -996,6 +1326,13 @@ type ClusterPodMonitoringSpec struct {
 	TargetLabels TargetLabels `json:"targetLabels,omitempty"`
 	// Limits to apply at scrape time.
 	Limits *ScrapeLimits `json:"limits,omitempty"`
+	// Prefix of the Cloud Monitoring metric types the scraped metrics are written as,
+	// e.g. `custom.googleapis.com/team-a`. Must be one of or below the domains
+	// `prometheus.googleapis.com`, `custom.googleapis.com`, `external.googleapis.com`
+	// and `workload.googleapis.com`. Defaults to the metric type prefix of the
+	// namespace set in the OperatorConfig or `prometheus.googleapis.com`.
+	// +kubebuilder:validation:Pattern="^(prometheus|custom|external|workload)[.]googleapis[.]com(/[a-zA-Z0-9_.-]+)*$"
+	MetricTypePrefix string `json:"metricTypePrefix,omitempty"`
 }
 
 // ScrapeEndpoint specifies a Prometheus metrics endpoint to scrape.
@@ -1098,6 +1435,59 @@ type ScrapeEndpointStatus struct {
 	// Ideally, this should always be 1. Anything less can
 	// be considered a problem and should be investigated.
 	CollectorsFraction string `json:"collectorsFraction,omitempty"`
+	// Collector pods whose targets could not be fetched, along with the class
+	// of the error, e.g. "collector-x7k2p: timeout". Only set if the
+	// collectors fraction is less than 1.
+	// +optional
+	FailedCollectors []string `json:"failedCollectors,omitempty"`
+	// Total number of targets found by service discovery, before relabeling.
+	// Unset if the collectors do not report their service discovery state.
+	// A value of zero means that no pods matched the endpoint.
+	// +optional
+	DiscoveredTargets *int64 `json:"discoveredTargets,omitempty"`
+	// Service discovery errors reported by the collectors for the endpoint.
+	// +optional
+	DiscoveryErrors []string `json:"discoveryErrors,omitempty"`
+	// Total number of samples scraped from the active targets in their last
+	// scrape. Unset if not reported by all collectors.
+	// +optional
+	SamplesScraped *int64 `json:"samplesScraped,omitempty"`
+	// Total number of samples of the last scrape of the active targets that are
+	// left after metric relabeling. If zero while samples are scraped, metric
+	// relabeling drops all samples. Unset if not reported by all collectors.
+	// +optional
+	SamplesPostMetricRelabeling *int64 `json:"samplesPostMetricRelabeling,omitempty"`
+	// The most recent transitions of the endpoint between healthy and unhealthy,
+	// oldest first. The endpoint is healthy if none of its targets are unhealthy.
+	// +optional
+	HealthHistory []HealthTransition `json:"healthHistory,omitempty"`
+	// Number of health transitions within the last hour. A high count indicates
+	// a flapping endpoint rather than a steadily broken one.
+	// +optional
+	FlapCount int32 `json:"flapCount,omitempty"`
+	// Samples of the active targets rejected by Cloud Monitoring by reason, e.g.
+	// invalid labels, samples written out of order, or exceeded cardinality limits.
+	// Counted by the collectors since they started, counts of targets without
+	// rejections for an hour are reset. Unset if not reported by all collectors.
+	// +optional
+	RejectedSamples []RejectedSampleCount `json:"rejectedSamples,omitempty"`
+}
+
+// RejectedSampleCount is the number of samples rejected by Cloud Monitoring for a reason.
+type RejectedSampleCount struct {
+	// Reason the samples were rejected for, one of invalid-labels, too-old,
+	// cardinality, or invalid-request.
+	Reason string `json:"reason"`
+	// Number of rejected samples.
+	Count int64 `json:"count"`
+}
+
+// HealthTransition is a change in the health of a scrape endpoint.
+type HealthTransition struct {
+	// Whether the endpoint became healthy or unhealthy.
+	Healthy bool `json:"healthy"`
+	// Time at which the transition was observed.
+	Time metav1.Time `json:"time"`
 }
 
 type SampleGroup struct {
@@ -1115,6 +1505,19 @@ type SampleTarget struct {
 	LastError *string `json:"lastError,omitempty"`
 	// Scrape duration in seconds.
 	LastScrapeDurationSeconds string `json:"lastScrapeDurationSeconds,omitempty"`
+	// Time of the last scrape.
+	// +optional
+	LastScrapeTime *metav1.Time `json:"lastScrapeTime,omitempty"`
+	// The effective scrape interval of the target.
+	// +optional
+	ScrapeInterval string `json:"scrapeInterval,omitempty"`
+	// The effective scrape timeout of the target.
+	// +optional
+	ScrapeTimeout string `json:"scrapeTimeout,omitempty"`
+	// HTTP status code of the last scrape, if it failed with an unexpected
+	// status code.
+	// +optional
+	LastScrapeStatusCode *int32 `json:"lastScrapeStatusCode,omitempty"`
 	// Health status.
 	Health string `json:"health,omitempty"`
 }
@@ -1125,9 +1528,29 @@ type PodMonitoringStatus struct {
 	// +optional
 	ObservedGeneration int64 `json:"observedGeneration"`
 	// Represents the latest available observations of a podmonitor's current state.
-	Conditions []MonitoringCondition `json:"conditions,omitempty"`
+	// +listType=map
+	// +listMapKey=type
+	Conditions []MonitoringCondition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
 	// Represents the latest available observations of target state for each ScrapeEndpoint.
 	EndpointStatuses []ScrapeEndpointStatus `json:"endpointStatuses,omitempty"`
+	// Reference to the object holding the target status if it is not
+	// reported in this status.
+	TargetStatusRef *v1.LocalObjectReference `json:"targetStatusRef,omitempty"`
+	// Summary of the target status of all endpoints.
+	// +optional
+	Summary *TargetsSummary `json:"summary,omitempty"`
+}
+
+// TargetsSummary aggregates the target status of all endpoints of a monitoring resource.
+type TargetsSummary struct {
+	// Total number of active targets.
+	ActiveTargets int64 `json:"activeTargets"`
+	// Total number of active, unhealthy targets.
+	UnhealthyTargets int64 `json:"unhealthyTargets"`
+	// Reason of the most severe condition of the resource, i.e. of a False
+	// condition if any, otherwise of an Unknown condition, otherwise of the
+	// TargetsHealthy condition. Evaluated whenever the target status is written.
+	WorstCondition string `json:"worstCondition,omitempty"`
 }
 
 // MonitoringConditionType is the type of MonitoringCondition.
@@ -1137,6 +1560,13 @@ const (
 	// ConfigurationCreateSuccess indicates that the config generated from the
 	// monitoring resource was created successfully.
 	ConfigurationCreateSuccess MonitoringConditionType = "ConfigurationCreateSuccess"
+	// TargetsHealthy indicates whether all targets of the monitoring resource are
+	// healthy. It is Unknown if the target status of some collectors is missing.
+	TargetsHealthy MonitoringConditionType = "TargetsHealthy"
+	// ClockSkewed is set on the OperatorConfig and indicates whether the clock of
+	// some collectors is skewed against the GCM API, which rejects their samples as
+	// out of range unless their timestamps are adjusted.
+	ClockSkewed MonitoringConditionType = "ClockSkewed"
 )
 
 // MonitoringCondition describes a condition of a PodMonitoring.
@@ -1271,6 +1701,11 @@ type RuleGroup struct {
 	Name string `json:"name"`
 	// The interval at which to evaluate the rules. Must be a valid Prometheus duration.
 	Interval string `json:"interval"`
+	// QueryOffset is the duration by which the queries of the rules are evaluated
+	// before the evaluation time, e.g. to account for the ingestion delay of Cloud
+	// Monitoring. Selectors and subqueries pinned to a time with the @ modifier are
+	// not offset. Must be a valid Prometheus duration.
+	QueryOffset string `json:"queryOffset,omitempty"`
 	// A list of rules that are executed sequentially as part of this group.
 	Rules []Rule `json:"rules"`
 }
@@ -1301,6 +1736,115 @@ type RulesStatus struct {
 	// TODO: add status information.
 }
 
+// Silence defines a silence in the managed Alertmanager that mutes alerts
+// originating from the namespace of the resource. The silence is created when
+// the resource is created, updated along with it, and expired when the resource
+// is deleted.
+//
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:subresource:status
+// +kubebuilder:storageversion
+type Silence struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	// Specification of the silence.
+	Spec SilenceSpec `json:"spec"`
+	// Most recently observed status of the resource.
+	// +optional
+	Status SilenceStatus `json:"status"`
+}
+
+// SilenceList is a list of Silences.
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type SilenceList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Silence `json:"items"`
+}
+
+// SilenceSpec contains specification parameters for a Silence resource.
+type SilenceSpec struct {
+	// Matchers selecting the alerts to silence. A matcher for the namespace label
+	// of the resource is always added and must not be specified.
+	Matchers []SilenceMatcher `json:"matchers"`
+	// Time at which the silence starts. Defaults to the creation time of the resource.
+	StartsAt *metav1.Time `json:"startsAt,omitempty"`
+	// Time at which the silence ends.
+	EndsAt metav1.Time `json:"endsAt"`
+	// Comment describing the reason for the silence.
+	Comment string `json:"comment,omitempty"`
+	// Creator of the silence. Defaults to the name of the operator.
+	CreatedBy string `json:"createdBy,omitempty"`
+}
+
+// SilenceMatcher matches a label of alerts.
+type SilenceMatcher struct {
+	// Name of the label to match.
+	Name string `json:"name"`
+	// Value to match the label value against.
+	Value string `json:"value"`
+	// Type of the match. One of "=", "!=", "=~", or "!~". Defaults to "=".
+	// +kubebuilder:validation:Enum="=";"!=";"=~";"!~"
+	Type string `json:"type,omitempty"`
+}
+
+// SilenceState is the state of a silence in Alertmanager.
+type SilenceState string
+
+const (
+	SilenceStatePending SilenceState = "pending"
+	SilenceStateActive  SilenceState = "active"
+	SilenceStateExpired SilenceState = "expired"
+)
+
+// SilenceStatus contains status information for a Silence resource.
+type SilenceStatus struct {
+	// The generation observed by the controller.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration"`
+	// ID of the silence in Alertmanager.
+	SilenceID string `json:"silenceID,omitempty"`
+	// State of the silence in Alertmanager. One of pending, active, or expired.
+	State SilenceState `json:"state,omitempty"`
+	// Error of the last attempt to synchronize the silence with Alertmanager.
+	Message string `json:"message,omitempty"`
+}
+
+// Validate checks the silence for errors.
+func (s *Silence) Validate() error {
+	if len(s.Spec.Matchers) == 0 {
+		return errors.New("at least one matcher is required")
+	}
+	for i, m := range s.Spec.Matchers {
+		if m.Name == "" {
+			return fmt.Errorf("matcher %d: name must be set", i)
+		}
+		if !prommodel.LabelName(m.Name).IsValid() {
+			return fmt.Errorf("matcher %d: invalid label name %q", i, m.Name)
+		}
+		if m.Name == export.KeyNamespace {
+			return fmt.Errorf("matcher %d: label %q is set automatically and must not be matched on", i, m.Name)
+		}
+		switch m.Type {
+		case "", "=", "!=":
+		case "=~", "!~":
+			if _, err := regexp.Compile(m.Value); err != nil {
+				return fmt.Errorf("matcher %d: invalid regex %q: %w", i, m.Value, err)
+			}
+		default:
+			return fmt.Errorf("matcher %d: unknown match type %q", i, m.Type)
+		}
+	}
+	if s.Spec.EndsAt.IsZero() {
+		return errors.New("endsAt must be set")
+	}
+	if s.Spec.StartsAt != nil && !s.Spec.StartsAt.Before(&s.Spec.EndsAt) {
+		return errors.New("startsAt must be before endsAt")
+	}
+	return nil
+}
+
 var invalidLabelCharRE = regexp.MustCompile(`[^a-zA-Z0-9_]`)
 
 // sanitizeLabelName reproduces the label name cleanup Prometheus's service discovery applies.
@@ -25,6 +25,8 @@ import (
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	prommodel "github.com/prometheus/common/model"
+	promconfig "github.com/prometheus/prometheus/config"
+	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/model/relabel"
 	yaml "gopkg.in/yaml.v2"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -170,6 +172,23 @@ func TestValidatePodMonitoringCommon(t *testing.T) {
 			},
 			fail:        true,
 			errContains: `cannot relabel with action "replace" onto protected label "project_id"`,
+		}, {
+			desc: "metric relabeling: replace metric type prefix",
+			eps: []ScrapeEndpoint{
+				{
+					Port:     intstr.FromString("web"),
+					Interval: "10s",
+					MetricRelabeling: []RelabelingRule{
+						{
+							Action:      "replace",
+							TargetLabel: "__gmp_metric_type_prefix__",
+							Replacement: "custom.googleapis.com",
+						},
+					},
+				},
+			},
+			fail:        true,
+			errContains: `cannot relabel with action "replace" onto label "__gmp_metric_type_prefix__"`,
 		}, {
 			desc: "metric relabeling: protected labelkeep",
 			eps: []ScrapeEndpoint{
@@ -649,6 +668,8 @@ metric_relabel_configs:
 - regex: foo_.+
   modulus: 3
   action: keep
+- regex: __gmp_metric_type_prefix__
+  action: labeldrop
 kubernetes_sd_configs:
 - role: pod
   kubeconfig_file: ""
@@ -713,6 +734,9 @@ relabel_configs:
 - source_labels: [__meta_kubernetes_pod_label_key3]
   target_label: key3
   action: replace
+metric_relabel_configs:
+- regex: __gmp_metric_type_prefix__
+  action: labeldrop
 kubernetes_sd_configs:
 - role: pod
   kubeconfig_file: ""
@@ -728,6 +752,55 @@ kubernetes_sd_configs:
 	}
 }
 
+func TestPodMonitoring_MetricTypePrefix(t *testing.T) {
+	// Scraped series cannot choose their metric type prefix.
+	scraped := labels.FromStrings("__name__", "metric1", "__gmp_metric_type_prefix__", "custom.googleapis.com/other")
+
+	for _, c := range []struct {
+		prefix string
+		want   string
+	}{
+		{prefix: "", want: ""},
+		{prefix: "custom.googleapis.com/team-a", want: "custom.googleapis.com/team-a"},
+	} {
+		pm := &PodMonitoring{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "name1"},
+			Spec: PodMonitoringSpec{
+				Endpoints:        []ScrapeEndpoint{{Port: intstr.FromString("web"), Interval: "10s"}},
+				MetricTypePrefix: c.prefix,
+			},
+		}
+		scrapeCfgs, err := pm.ScrapeConfigs("test_project", "test_location", "test_cluster")
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Load the config as Prometheus would to apply relabeling defaults.
+		b, err := yaml.Marshal(scrapeCfgs[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		var scrapeCfg promconfig.ScrapeConfig
+		if err := yaml.Unmarshal(b, &scrapeCfg); err != nil {
+			t.Fatal(err)
+		}
+		got := relabel.Process(scraped, scrapeCfg.MetricRelabelConfigs...).Get("__gmp_metric_type_prefix__")
+		if got != c.want {
+			t.Errorf("expected prefix %q for resource prefix %q, got %q", c.want, c.prefix, got)
+		}
+	}
+
+	pm := &PodMonitoring{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "name1"},
+		Spec: PodMonitoringSpec{
+			Endpoints:        []ScrapeEndpoint{{Port: intstr.FromString("web"), Interval: "10s"}},
+			MetricTypePrefix: "example.com/team-a",
+		},
+	}
+	if _, err := pm.ScrapeConfigs("test_project", "test_location", "test_cluster"); err == nil {
+		t.Errorf("expected error for metric type prefix outside of the allowed domains")
+	}
+}
+
 func TestClusterPodMonitoring_ScrapeConfig(t *testing.T) {
 	// Generate YAML for one complex scrape config and make sure everything
 	// adds up. This primarily verifies that everything is included and marshalling
@@ -856,6 +929,8 @@ metric_relabel_configs:
 - regex: foo_.+
   modulus: 3
   action: keep
+- regex: __gmp_metric_type_prefix__
+  action: labeldrop
 kubernetes_sd_configs:
 - role: pod
   kubeconfig_file: ""
@@ -917,6 +992,9 @@ relabel_configs:
 - source_labels: [__meta_kubernetes_pod_label_key3]
   target_label: key3
   action: replace
+metric_relabel_configs:
+- regex: __gmp_metric_type_prefix__
+  action: labeldrop
 kubernetes_sd_configs:
 - role: pod
   kubeconfig_file: ""
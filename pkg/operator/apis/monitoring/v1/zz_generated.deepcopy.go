@@ -25,6 +25,22 @@ import (
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *APIEndpoints) DeepCopyInto(out *APIEndpoints) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new APIEndpoints.
+func (in *APIEndpoints) DeepCopy() *APIEndpoints {
+	if in == nil {
+		return nil
+	}
+	out := new(APIEndpoints)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *AlertingSpec) DeepCopyInto(out *AlertingSpec) {
 	*out = *in
@@ -187,6 +203,72 @@ func (in *ClusterPodMonitoringSpec) DeepCopy() *ClusterPodMonitoringSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterPodMonitoringTargetStatus) DeepCopyInto(out *ClusterPodMonitoringTargetStatus) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	if in.EndpointStatuses != nil {
+		in, out := &in.EndpointStatuses, &out.EndpointStatuses
+		*out = make([]ScrapeEndpointStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterPodMonitoringTargetStatus.
+func (in *ClusterPodMonitoringTargetStatus) DeepCopy() *ClusterPodMonitoringTargetStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterPodMonitoringTargetStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterPodMonitoringTargetStatus) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterPodMonitoringTargetStatusList) DeepCopyInto(out *ClusterPodMonitoringTargetStatusList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ClusterPodMonitoringTargetStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterPodMonitoringTargetStatusList.
+func (in *ClusterPodMonitoringTargetStatusList) DeepCopy() *ClusterPodMonitoringTargetStatusList {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterPodMonitoringTargetStatusList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterPodMonitoringTargetStatusList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterRules) DeepCopyInto(out *ClusterRules) {
 	*out = *in
@@ -269,6 +351,18 @@ func (in *CollectionSpec) DeepCopyInto(out *CollectionSpec) {
 		*out = new(KubeletScraping)
 		**out = **in
 	}
+	if in.Batching != nil {
+		in, out := &in.Batching, &out.Batching
+		*out = new(ExportBatching)
+		**out = **in
+	}
+	if in.MetricTypePrefixes != nil {
+		in, out := &in.MetricTypePrefixes, &out.MetricTypePrefixes
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 	return
 }
 
@@ -282,6 +376,27 @@ func (in *CollectionSpec) DeepCopy() *CollectionSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ComponentState) DeepCopyInto(out *ComponentState) {
+	*out = *in
+	if in.Rollout != nil {
+		in, out := &in.Rollout, &out.Rollout
+		*out = new(RolloutState)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ComponentState.
+func (in *ComponentState) DeepCopy() *ComponentState {
+	if in == nil {
+		return nil
+	}
+	out := new(ComponentState)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ConfigSpec) DeepCopyInto(out *ConfigSpec) {
 	*out = *in
@@ -298,6 +413,22 @@ func (in *ConfigSpec) DeepCopy() *ConfigSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExportBatching) DeepCopyInto(out *ExportBatching) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExportBatching.
+func (in *ExportBatching) DeepCopy() *ExportBatching {
+	if in == nil {
+		return nil
+	}
+	out := new(ExportBatching)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ExportFilters) DeepCopyInto(out *ExportFilters) {
 	*out = *in
@@ -306,6 +437,16 @@ func (in *ExportFilters) DeepCopyInto(out *ExportFilters) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.AllowMetricNames != nil {
+		in, out := &in.AllowMetricNames, &out.AllowMetricNames
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.DenyMetricNames != nil {
+		in, out := &in.DenyMetricNames, &out.DenyMetricNames
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -401,6 +542,23 @@ func (in *HTTPClientConfig) DeepCopy() *HTTPClientConfig {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HealthTransition) DeepCopyInto(out *HealthTransition) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HealthTransition.
+func (in *HealthTransition) DeepCopy() *HealthTransition {
+	if in == nil {
+		return nil
+	}
+	out := new(HealthTransition)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *KubeletScraping) DeepCopyInto(out *KubeletScraping) {
 	*out = *in
@@ -472,6 +630,84 @@ func (in *MonitoringCondition) DeepCopy() *MonitoringCondition {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MonitoringStatus) DeepCopyInto(out *MonitoringStatus) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Status.DeepCopyInto(&out.Status)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MonitoringStatus.
+func (in *MonitoringStatus) DeepCopy() *MonitoringStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(MonitoringStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *MonitoringStatus) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MonitoringStatusList) DeepCopyInto(out *MonitoringStatusList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]MonitoringStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MonitoringStatusList.
+func (in *MonitoringStatusList) DeepCopy() *MonitoringStatusList {
+	if in == nil {
+		return nil
+	}
+	out := new(MonitoringStatusList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *MonitoringStatusList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MonitoringStatusStatus) DeepCopyInto(out *MonitoringStatusStatus) {
+	*out = *in
+	in.Collection.DeepCopyInto(&out.Collection)
+	in.Rules.DeepCopyInto(&out.Rules)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MonitoringStatusStatus.
+func (in *MonitoringStatusStatus) DeepCopy() *MonitoringStatusStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(MonitoringStatusStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *OperatorConfig) DeepCopyInto(out *OperatorConfig) {
 	*out = *in
@@ -485,6 +721,8 @@ func (in *OperatorConfig) DeepCopyInto(out *OperatorConfig) {
 		(*in).DeepCopyInto(*out)
 	}
 	out.Features = in.Features
+	out.Endpoints = in.Endpoints
+	in.Status.DeepCopyInto(&out.Status)
 	return
 }
 
@@ -539,6 +777,95 @@ func (in *OperatorConfigList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OperatorConfigStatus) DeepCopyInto(out *OperatorConfigStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]MonitoringCondition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OperatorConfigStatus.
+func (in *OperatorConfigStatus) DeepCopy() *OperatorConfigStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(OperatorConfigStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OperatorConfigTargetStatus) DeepCopyInto(out *OperatorConfigTargetStatus) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	if in.EndpointStatuses != nil {
+		in, out := &in.EndpointStatuses, &out.EndpointStatuses
+		*out = make([]ScrapeEndpointStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OperatorConfigTargetStatus.
+func (in *OperatorConfigTargetStatus) DeepCopy() *OperatorConfigTargetStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(OperatorConfigTargetStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *OperatorConfigTargetStatus) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OperatorConfigTargetStatusList) DeepCopyInto(out *OperatorConfigTargetStatusList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]OperatorConfigTargetStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OperatorConfigTargetStatusList.
+func (in *OperatorConfigTargetStatusList) DeepCopy() *OperatorConfigTargetStatusList {
+	if in == nil {
+		return nil
+	}
+	out := new(OperatorConfigTargetStatusList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *OperatorConfigTargetStatusList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *OperatorFeatures) DeepCopyInto(out *OperatorFeatures) {
 	*out = *in
@@ -665,6 +992,16 @@ func (in *PodMonitoringStatus) DeepCopyInto(out *PodMonitoringStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.TargetStatusRef != nil {
+		in, out := &in.TargetStatusRef, &out.TargetStatusRef
+		*out = new(corev1.LocalObjectReference)
+		**out = **in
+	}
+	if in.Summary != nil {
+		in, out := &in.Summary, &out.Summary
+		*out = new(TargetsSummary)
+		**out = **in
+	}
 	return
 }
 
@@ -678,6 +1015,87 @@ func (in *PodMonitoringStatus) DeepCopy() *PodMonitoringStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PodMonitoringTargetStatus) DeepCopyInto(out *PodMonitoringTargetStatus) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	if in.EndpointStatuses != nil {
+		in, out := &in.EndpointStatuses, &out.EndpointStatuses
+		*out = make([]ScrapeEndpointStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodMonitoringTargetStatus.
+func (in *PodMonitoringTargetStatus) DeepCopy() *PodMonitoringTargetStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PodMonitoringTargetStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *PodMonitoringTargetStatus) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PodMonitoringTargetStatusList) DeepCopyInto(out *PodMonitoringTargetStatusList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]PodMonitoringTargetStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodMonitoringTargetStatusList.
+func (in *PodMonitoringTargetStatusList) DeepCopy() *PodMonitoringTargetStatusList {
+	if in == nil {
+		return nil
+	}
+	out := new(PodMonitoringTargetStatusList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *PodMonitoringTargetStatusList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RejectedSampleCount) DeepCopyInto(out *RejectedSampleCount) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RejectedSampleCount.
+func (in *RejectedSampleCount) DeepCopy() *RejectedSampleCount {
+	if in == nil {
+		return nil
+	}
+	out := new(RejectedSampleCount)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RelabelingRule) DeepCopyInto(out *RelabelingRule) {
 	*out = *in
@@ -699,6 +1117,22 @@ func (in *RelabelingRule) DeepCopy() *RelabelingRule {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RolloutState) DeepCopyInto(out *RolloutState) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RolloutState.
+func (in *RolloutState) DeepCopy() *RolloutState {
+	if in == nil {
+		return nil
+	}
+	out := new(RolloutState)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Rule) DeepCopyInto(out *Rule) {
 	*out = *in
@@ -739,6 +1173,11 @@ func (in *RuleEvaluatorSpec) DeepCopyInto(out *RuleEvaluatorSpec) {
 			(*out)[key] = val
 		}
 	}
+	if in.FanOutProjectIDs != nil {
+		in, out := &in.FanOutProjectIDs, &out.FanOutProjectIDs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	in.Alerting.DeepCopyInto(&out.Alerting)
 	if in.Credentials != nil {
 		in, out := &in.Credentials, &out.Credentials
@@ -924,6 +1363,15 @@ func (in *SampleTarget) DeepCopyInto(out *SampleTarget) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.LastScrapeTime != nil {
+		in, out := &in.LastScrapeTime, &out.LastScrapeTime
+		*out = (*in).DeepCopy()
+	}
+	if in.LastScrapeStatusCode != nil {
+		in, out := &in.LastScrapeStatusCode, &out.LastScrapeStatusCode
+		*out = new(int32)
+		**out = **in
+	}
 	return
 }
 
@@ -988,6 +1436,43 @@ func (in *ScrapeEndpointStatus) DeepCopyInto(out *ScrapeEndpointStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.FailedCollectors != nil {
+		in, out := &in.FailedCollectors, &out.FailedCollectors
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.DiscoveredTargets != nil {
+		in, out := &in.DiscoveredTargets, &out.DiscoveredTargets
+		*out = new(int64)
+		**out = **in
+	}
+	if in.DiscoveryErrors != nil {
+		in, out := &in.DiscoveryErrors, &out.DiscoveryErrors
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.SamplesScraped != nil {
+		in, out := &in.SamplesScraped, &out.SamplesScraped
+		*out = new(int64)
+		**out = **in
+	}
+	if in.SamplesPostMetricRelabeling != nil {
+		in, out := &in.SamplesPostMetricRelabeling, &out.SamplesPostMetricRelabeling
+		*out = new(int64)
+		**out = **in
+	}
+	if in.HealthHistory != nil {
+		in, out := &in.HealthHistory, &out.HealthHistory
+		*out = make([]HealthTransition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.RejectedSamples != nil {
+		in, out := &in.RejectedSamples, &out.RejectedSamples
+		*out = make([]RejectedSampleCount, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -1043,6 +1528,125 @@ func (in *SecretOrConfigMap) DeepCopy() *SecretOrConfigMap {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Silence) DeepCopyInto(out *Silence) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	out.Status = in.Status
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Silence.
+func (in *Silence) DeepCopy() *Silence {
+	if in == nil {
+		return nil
+	}
+	out := new(Silence)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *Silence) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SilenceList) DeepCopyInto(out *SilenceList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]Silence, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SilenceList.
+func (in *SilenceList) DeepCopy() *SilenceList {
+	if in == nil {
+		return nil
+	}
+	out := new(SilenceList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *SilenceList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SilenceMatcher) DeepCopyInto(out *SilenceMatcher) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SilenceMatcher.
+func (in *SilenceMatcher) DeepCopy() *SilenceMatcher {
+	if in == nil {
+		return nil
+	}
+	out := new(SilenceMatcher)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SilenceSpec) DeepCopyInto(out *SilenceSpec) {
+	*out = *in
+	if in.Matchers != nil {
+		in, out := &in.Matchers, &out.Matchers
+		*out = make([]SilenceMatcher, len(*in))
+		copy(*out, *in)
+	}
+	if in.StartsAt != nil {
+		in, out := &in.StartsAt, &out.StartsAt
+		*out = (*in).DeepCopy()
+	}
+	in.EndsAt.DeepCopyInto(&out.EndsAt)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SilenceSpec.
+func (in *SilenceSpec) DeepCopy() *SilenceSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SilenceSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SilenceStatus) DeepCopyInto(out *SilenceStatus) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SilenceStatus.
+func (in *SilenceStatus) DeepCopy() *SilenceStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(SilenceStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TLS) DeepCopyInto(out *TLS) {
 	*out = *in
@@ -1135,3 +1739,19 @@ func (in *TargetStatusSpec) DeepCopy() *TargetStatusSpec {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TargetsSummary) DeepCopyInto(out *TargetsSummary) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TargetsSummary.
+func (in *TargetsSummary) DeepCopy() *TargetsSummary {
+	if in == nil {
+		return nil
+	}
+	out := new(TargetsSummary)
+	in.DeepCopyInto(out)
+	return out
+}
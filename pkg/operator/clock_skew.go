@@ -0,0 +1,130 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+)
+
+const (
+	// Metric exposed by the collectors with the skew of their clock against the GCM API.
+	metricClockSkew = "gcm_export_clock_skew_seconds"
+	// Skew above which the clock of a collector is considered skewed. It matches the
+	// default --export.clock-skew-threshold of the collectors.
+	clockSkewThreshold = 30 * time.Second
+	// Maximum number of skewed collectors listed in the condition message.
+	maxClockSkewedCollectors = 10
+)
+
+// Reasons of the ClockSkewed condition.
+const (
+	reasonClockSkewed      = "ClockSkewed"
+	reasonClockSynced      = "ClockSynchronized"
+	reasonClockSkewUnknown = "NoCollectorsReported"
+)
+
+// parseClockSkew extracts the skew of the collector's clock against the GCM API from its
+// metrics. It returns nil if the collector does not expose it.
+func parseClockSkew(families map[string]*dto.MetricFamily) *time.Duration {
+	metrics := metricsOf(families, metricClockSkew)
+	if len(metrics) == 0 {
+		return nil
+	}
+	skew := time.Duration(metrics[0].GetGauge().GetValue() * float64(time.Second))
+	return &skew
+}
+
+// clockSkewCondition returns the ClockSkewed condition for the clock skews reported by
+// the collectors. Nil entries in states represent collectors whose state could not be
+// fetched.
+func clockSkewCondition(states []*collectorState) monitoringv1.MonitoringCondition {
+	var (
+		reported int
+		maxSkew  time.Duration
+		skewed   []string
+	)
+	for _, state := range states {
+		if state == nil || state.clockSkew == nil {
+			continue
+		}
+		reported++
+		skew := *state.clockSkew
+		if skew < 0 {
+			skew = -skew
+		}
+		if skew <= clockSkewThreshold {
+			continue
+		}
+		skewed = append(skewed, state.pod)
+		if skew > maxSkew {
+			maxSkew = skew
+		}
+	}
+	cond := monitoringv1.MonitoringCondition{Type: monitoringv1.ClockSkewed}
+
+	switch {
+	case len(skewed) > 0:
+		sort.Strings(skewed)
+		pods := strings.Join(skewed, ", ")
+		if len(skewed) > maxClockSkewedCollectors {
+			pods = fmt.Sprintf("%s and %d more", strings.Join(skewed[:maxClockSkewedCollectors], ", "), len(skewed)-maxClockSkewedCollectors)
+		}
+		cond.Status = corev1.ConditionTrue
+		cond.Reason = reasonClockSkewed
+		cond.Message = fmt.Sprintf("The clocks of %d of %d collectors are skewed against the GCM API by up to %s, which rejects their samples as out of range: %s",
+			len(skewed), reported, maxSkew.Round(time.Second), pods)
+	case reported == 0:
+		cond.Status = corev1.ConditionUnknown
+		cond.Reason = reasonClockSkewUnknown
+		cond.Message = "No collector reported the skew of its clock"
+	default:
+		cond.Status = corev1.ConditionFalse
+		cond.Reason = reasonClockSynced
+		cond.Message = fmt.Sprintf("The clocks of all %d reporting collectors are within %s of the GCM API", reported, clockSkewThreshold)
+	}
+	return cond
+}
+
+// writeClockSkewCondition sets the ClockSkewed condition in the status of the OperatorConfig
+// from the clock skews reported by the collectors. The status is only written if the
+// condition changed.
+func writeClockSkewCondition(ctx context.Context, kubeClient client.Client, config *monitoringv1.OperatorConfig, states []*collectorState) error {
+	status := config.Status.DeepCopy()
+	if !setCondition(&status.Conditions, clockSkewCondition(states), metav1.Now()) {
+		return nil
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"status": map[string]interface{}{
+			"conditions": status.Conditions,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return kubeClient.Status().Patch(ctx, config, client.RawPatch(types.MergePatchType, patch))
+}
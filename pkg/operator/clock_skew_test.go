@@ -0,0 +1,127 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+)
+
+func TestParseClockSkew(t *testing.T) {
+	families, err := parseMetrics(strings.NewReader(`
+# TYPE gcm_export_clock_skew_seconds gauge
+gcm_export_clock_skew_seconds -45.5
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if skew := parseClockSkew(families); skew == nil || *skew != -45500*time.Millisecond {
+		t.Errorf("expected skew of -45.5s but got %v", skew)
+	}
+	if skew := parseClockSkew(nil); skew != nil {
+		t.Errorf("expected no skew but got %v", *skew)
+	}
+}
+
+func TestClockSkewCondition(t *testing.T) {
+	state := func(pod string, skew time.Duration) *collectorState {
+		return &collectorState{pod: pod, clockSkew: &skew}
+	}
+	cases := []struct {
+		desc       string
+		states     []*collectorState
+		wantStatus corev1.ConditionStatus
+		wantReason string
+		wantMsg    string
+	}{
+		{
+			desc:       "no collectors",
+			wantStatus: corev1.ConditionUnknown,
+			wantReason: reasonClockSkewUnknown,
+		},
+		{
+			desc:       "unreachable collectors",
+			states:     []*collectorState{nil, {pod: "collector-a"}},
+			wantStatus: corev1.ConditionUnknown,
+			wantReason: reasonClockSkewUnknown,
+		},
+		{
+			desc:       "synchronized",
+			states:     []*collectorState{state("collector-a", time.Second), state("collector-b", -clockSkewThreshold), nil},
+			wantStatus: corev1.ConditionFalse,
+			wantReason: reasonClockSynced,
+			wantMsg:    "all 2 reporting collectors",
+		},
+		{
+			desc:       "skewed",
+			states:     []*collectorState{state("collector-c", -2*time.Minute), state("collector-a", time.Second), state("collector-b", 45*time.Second)},
+			wantStatus: corev1.ConditionTrue,
+			wantReason: reasonClockSkewed,
+			wantMsg:    "2 of 3 collectors are skewed against the GCM API by up to 2m0s, which rejects their samples as out of range: collector-b, collector-c",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			cond := clockSkewCondition(c.states)
+			if cond.Type != monitoringv1.ClockSkewed || cond.Status != c.wantStatus || cond.Reason != c.wantReason {
+				t.Errorf("unexpected condition %+v", cond)
+			}
+			if !strings.Contains(cond.Message, c.wantMsg) {
+				t.Errorf("expected message %q to contain %q", cond.Message, c.wantMsg)
+			}
+		})
+	}
+}
+
+func TestWriteClockSkewCondition(t *testing.T) {
+	ctx := context.Background()
+	scheme, err := NewScheme()
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := targetStatusConfig(&monitoringv1.TargetStatusSpec{})
+	kubeClient := &recordingStatusClient{Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(config).Build()}
+
+	skew := time.Minute
+	states := []*collectorState{{pod: "collector-a", clockSkew: &skew}}
+
+	for i := 0; i < 2; i++ {
+		if err := kubeClient.Get(ctx, client.ObjectKeyFromObject(config), config); err != nil {
+			t.Fatal(err)
+		}
+		if err := writeClockSkewCondition(ctx, kubeClient, config, states); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The unchanged condition is not written again.
+	if len(kubeClient.patchTypes) != 1 {
+		t.Errorf("expected 1 status patch but got %d", len(kubeClient.patchTypes))
+	}
+	var got monitoringv1.OperatorConfig
+	if err := kubeClient.Get(ctx, client.ObjectKeyFromObject(config), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Status.Conditions) != 1 || got.Status.Conditions[0].Type != monitoringv1.ClockSkewed || got.Status.Conditions[0].Status != corev1.ConditionTrue {
+		t.Errorf("unexpected conditions %+v", got.Status.Conditions)
+	}
+}
@@ -20,9 +20,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net"
 	"path"
+	"regexp"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/prometheus/common/config"
@@ -32,6 +35,7 @@ import (
 	discoverykube "github.com/prometheus/prometheus/discovery/kubernetes"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/model/relabel"
+	"github.com/prometheus/prometheus/promql/parser"
 	yaml "gopkg.in/yaml.v3"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
@@ -39,6 +43,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -85,17 +90,24 @@ func setupCollectionControllers(op *Operator) error {
 			&monitoringv1.OperatorConfig{},
 			builder.WithPredicates(objFilterOperatorConfig),
 		).
-		// Any update to a PodMonitoring requires regenerating the config.
+		// Any update to a PodMonitoring requires regenerating the config. Annotation
+		// changes are included as the export-only annotation changes the export filters.
 		Watches(
 			&source.Kind{Type: &monitoringv1.PodMonitoring{}},
 			enqueueConst(objRequest),
-			builder.WithPredicates(predicate.GenerationChangedPredicate{}),
+			builder.WithPredicates(predicate.Or(
+				predicate.GenerationChangedPredicate{},
+				predicate.AnnotationChangedPredicate{},
+			)),
 		).
 		// Any update to a ClusterPodMonitoring requires regenerating the config.
 		Watches(
 			&source.Kind{Type: &monitoringv1.ClusterPodMonitoring{}},
 			enqueueConst(objRequest),
-			builder.WithPredicates(predicate.GenerationChangedPredicate{}),
+			builder.WithPredicates(predicate.Or(
+				predicate.GenerationChangedPredicate{},
+				predicate.AnnotationChangedPredicate{},
+			)),
 		).
 		// The configuration we generate for the collectors.
 		Watches(
@@ -116,23 +128,28 @@ func setupCollectionControllers(op *Operator) error {
 			source.NewKindWithCache(&corev1.Secret{}, op.managedNamespacesCache),
 			enqueueConst(objRequest),
 			builder.WithPredicates(objFilterSecret)).
-		Complete(newCollectionReconciler(op.manager.GetClient(), op.opts))
+		Complete(newCollectionReconciler(op.manager.GetClient(), op.manager.GetEventRecorderFor(NameOperator), op.opts))
 	if err != nil {
 		return fmt.Errorf("create collector config controller: %w", err)
 	}
 	return nil
 }
 
+// Event reason for PodMonitorings with an export-only annotation that cannot be parsed.
+const reasonInvalidExportOnly = "InvalidExportOnlyAnnotation"
+
 type collectionReconciler struct {
 	client        client.Client
+	recorder      record.EventRecorder
 	opts          Options
 	statusUpdates []monitoringv1.PodMonitoringStatusContainer
 }
 
-func newCollectionReconciler(c client.Client, opts Options) *collectionReconciler {
+func newCollectionReconciler(c client.Client, recorder record.EventRecorder, opts Options) *collectionReconciler {
 	return &collectionReconciler{
-		client: c,
-		opts:   opts,
+		client:   c,
+		recorder: recorder,
+		opts:     opts,
 	}
 }
 
@@ -172,11 +189,12 @@ func (r *collectionReconciler) Reconcile(ctx context.Context, req reconcile.Requ
 		return reconcile.Result{}, fmt.Errorf("ensure collector secrets: %w", err)
 	}
 	// Deploy Prometheus collector as a node agent.
-	if err := r.ensureCollectorDaemonSet(ctx, &config.Collection); err != nil {
+	if err := r.ensureCollectorDaemonSet(ctx, &config.Collection, &config.Endpoints); err != nil {
 		return reconcile.Result{}, fmt.Errorf("ensure collector daemon set: %w", err)
 	}
 
-	if err := r.ensureCollectorConfig(ctx, &config.Collection, config.Features.Config.Compression); err != nil {
+	// The config is written last as it records the applied OperatorConfig generation.
+	if err := r.ensureCollectorConfig(ctx, &config.Collection, config.Features.Config.Compression, config.Generation); err != nil {
 		return reconcile.Result{}, fmt.Errorf("ensure collector config: %w", err)
 	}
 
@@ -226,7 +244,7 @@ func (r *collectionReconciler) ensureCollectorSecrets(ctx context.Context, spec
 }
 
 // ensureCollectorDaemonSet populates the collector DaemonSet with operator-provided values.
-func (r *collectionReconciler) ensureCollectorDaemonSet(ctx context.Context, spec *monitoringv1.CollectionSpec) error {
+func (r *collectionReconciler) ensureCollectorDaemonSet(ctx context.Context, spec *monitoringv1.CollectionSpec, endpoints *monitoringv1.APIEndpoints) error {
 	logger, _ := logr.FromContext(ctx)
 
 	var ds appsv1.DaemonSet
@@ -248,10 +266,41 @@ func (r *collectionReconciler) ensureCollectorDaemonSet(ctx context.Context, spe
 		fmt.Sprintf("--export.label.location=%q", location),
 		fmt.Sprintf("--export.label.cluster=%q", cluster),
 	}
-	// Populate export filtering from OperatorConfig.
-	for _, matcher := range spec.Filter.MatchOneOf {
+	// Populate export filtering from OperatorConfig and PodMonitoring annotations.
+	var podMons monitoringv1.PodMonitoringList
+	if err := r.client.List(ctx, &podMons); err != nil {
+		return fmt.Errorf("list PodMonitorings: %w", err)
+	}
+	var scopes []exportScope
+	for i := range podMons.Items {
+		pm := &podMons.Items[i]
+		value, ok := pm.Annotations[AnnotationExportOnly]
+		if !ok {
+			continue
+		}
+		metrics, err := parseExportOnly(value)
+		if err != nil {
+			// The annotation is ignored, so surface it on the PodMonitoring itself
+			// as users won't look at the operator logs.
+			logger.Error(err, "invalid export-only annotation", "namespace", pm.Namespace, "name", pm.Name)
+			r.recorder.Eventf(pm, corev1.EventTypeWarning, reasonInvalidExportOnly,
+				"Ignoring invalid %s annotation: %s", AnnotationExportOnly, err)
+			continue
+		}
+		scopes = append(scopes, exportScope{namespace: pm.Namespace, job: pm.Name, metrics: metrics})
+	}
+	matchers, err := exportMatchers(spec.Filter.MatchOneOf, scopes)
+	if err != nil {
+		return fmt.Errorf("build export filters: %w", err)
+	}
+	for _, matcher := range matchers {
 		flags = append(flags, fmt.Sprintf("--export.match=%q", matcher))
 	}
+	metricNameFlags, err := exportMetricNameFlags(&spec.Filter)
+	if err != nil {
+		return fmt.Errorf("build export filters: %w", err)
+	}
+	flags = append(flags, metricNameFlags...)
 	if spec.Credentials != nil {
 		p := path.Join(secretsDir, pathForSelector(r.opts.PublicNamespace, &monitoringv1.SecretOrConfigMap{Secret: spec.Credentials}))
 		flags = append(flags, fmt.Sprintf("--export.credentials-file=%q", p))
@@ -260,6 +309,23 @@ func (r *collectionReconciler) ensureCollectorDaemonSet(ctx context.Context, spe
 	if len(spec.Compression) > 0 && spec.Compression != monitoringv1.CompressionNone {
 		flags = append(flags, fmt.Sprintf("--export.compression=%s", spec.Compression))
 	}
+	batchingFlags, err := exportBatchingFlags(spec.Batching)
+	if err != nil {
+		return fmt.Errorf("build export batching flags: %w", err)
+	}
+	flags = append(flags, batchingFlags...)
+	if spec.PauseExport {
+		flags = append(flags, "--export.pause")
+	}
+	endpointFlags, err := exportEndpointFlags(endpoints)
+	if err != nil {
+		return fmt.Errorf("build export endpoint flags: %w", err)
+	}
+	flags = append(flags, endpointFlags...)
+	if r.opts.CollectorTLS {
+		flags = append(flags, fmt.Sprintf("--web.config.file=%s", path.Join(collectorTLSDir, collectorTLSWebConfig)))
+	}
+	configureCollectorTLS(&ds.Spec.Template.Spec, r.opts.CollectorTLS)
 
 	// Set EXTRA_ARGS envvar in Prometheus container.
 	for i, c := range ds.Spec.Template.Spec.Containers {
@@ -280,6 +346,74 @@ func (r *collectionReconciler) ensureCollectorDaemonSet(ctx context.Context, spe
 	return r.client.Update(ctx, &ds)
 }
 
+// exportBatchingFlags returns the collector flags for the export batching settings.
+// Unset settings keep the defaults of the collector.
+func exportBatchingFlags(spec *monitoringv1.ExportBatching) ([]string, error) {
+	if spec == nil {
+		return nil, nil
+	}
+	var flags []string
+
+	if spec.BatchSize != 0 {
+		if spec.BatchSize < 0 || spec.BatchSize > export.BatchSizeMax {
+			return nil, fmt.Errorf("batch size must be between 1 and %d, got %d", export.BatchSizeMax, spec.BatchSize)
+		}
+		flags = append(flags, fmt.Sprintf("--export.debug.batch-size=%d", spec.BatchSize))
+	}
+	if spec.BatchDelay != "" {
+		delay, err := prommodel.ParseDuration(spec.BatchDelay)
+		if err != nil {
+			return nil, fmt.Errorf("invalid batch delay: %w", err)
+		}
+		if time.Duration(delay) < export.BatchDelayMin || time.Duration(delay) > export.BatchDelayMax {
+			return nil, fmt.Errorf("batch delay must be between %s and %s, got %s", export.BatchDelayMin, export.BatchDelayMax, delay)
+		}
+		flags = append(flags, fmt.Sprintf("--export.debug.batch-delay=%s", time.Duration(delay)))
+	}
+	if spec.ShardBufferSize != 0 {
+		if spec.ShardBufferSize < 0 || spec.ShardBufferSize > export.ShardBufferSizeMax {
+			return nil, fmt.Errorf("shard buffer size must be between 1 and %d, got %d", export.ShardBufferSizeMax, spec.ShardBufferSize)
+		}
+		flags = append(flags, fmt.Sprintf("--export.debug.shard-buffer-size=%d", spec.ShardBufferSize))
+	}
+	return flags, nil
+}
+
+// exportMetricNameFlags returns the collector flags for the metric name filters.
+func exportMetricNameFlags(filter *monitoringv1.ExportFilters) ([]string, error) {
+	var flags []string
+	for _, expr := range filter.AllowMetricNames {
+		if _, err := regexp.Compile(expr); err != nil {
+			return nil, fmt.Errorf("invalid allowed metric name %q: %w", expr, err)
+		}
+		flags = append(flags, fmt.Sprintf("--export.metric-name.allow=%q", expr))
+	}
+	for _, expr := range filter.DenyMetricNames {
+		if _, err := regexp.Compile(expr); err != nil {
+			return nil, fmt.Errorf("invalid denied metric name %q: %w", expr, err)
+		}
+		flags = append(flags, fmt.Sprintf("--export.metric-name.deny=%q", expr))
+	}
+	return flags, nil
+}
+
+// exportEndpointFlags returns the flags of collectors and the rule-evaluator for the
+// Cloud Monitoring API endpoint metric data is written to. Unset settings keep the
+// defaults of the binaries.
+func exportEndpointFlags(spec *monitoringv1.APIEndpoints) ([]string, error) {
+	var flags []string
+	if spec.Export != "" {
+		if _, _, err := net.SplitHostPort(spec.Export); err != nil {
+			return nil, fmt.Errorf("invalid export endpoint %q: %w", spec.Export, err)
+		}
+		flags = append(flags, fmt.Sprintf("--export.endpoint=%q", spec.Export))
+	}
+	if spec.TLSServerName != "" {
+		flags = append(flags, fmt.Sprintf("--export.tls.server-name=%q", spec.TLSServerName))
+	}
+	return flags, nil
+}
+
 func resolveLabels(opts Options, externalLabels map[string]string) (projectID string, location string, cluster string) {
 	// Prioritize OperatorConfig's external labels over operator's flags
 	// to be consistent with our export layer's priorities.
@@ -302,6 +436,110 @@ func resolveLabels(opts Options, externalLabels map[string]string) (projectID st
 	return
 }
 
+// exportScope restricts the exported metrics of a single PodMonitoring job.
+type exportScope struct {
+	namespace, job string
+	metrics        []string
+}
+
+// parseExportOnly parses the comma-separated metric names of an export-only annotation.
+func parseExportOnly(value string) ([]string, error) {
+	var metrics []string
+	for _, m := range strings.Split(value, ",") {
+		m = strings.TrimSpace(m)
+		if m == "" {
+			continue
+		}
+		if !prommodel.IsValidMetricName(prommodel.LabelValue(m)) {
+			return nil, fmt.Errorf("invalid metric name %q", m)
+		}
+		metrics = append(metrics, m)
+	}
+	if len(metrics) == 0 {
+		return nil, fmt.Errorf("no metric names specified")
+	}
+	sort.Strings(metrics)
+	return metrics, nil
+}
+
+// exportMatchers combines the global export matchers with the export scopes of individual
+// jobs. Every global matcher is expanded so that a series matches it only if it is either
+// not produced by a scoped job or it is one of the metrics allowed for its job.
+func exportMatchers(matchOneOf []string, scopes []exportScope) ([]string, error) {
+	if len(scopes) == 0 {
+		return matchOneOf, nil
+	}
+	sort.Slice(scopes, func(i, j int) bool {
+		if scopes[i].namespace != scopes[j].namespace {
+			return scopes[i].namespace < scopes[j].namespace
+		}
+		return scopes[i].job < scopes[j].job
+	})
+	// Group the scoped jobs by namespace.
+	var (
+		namespaces []string
+		jobs       = map[string][]string{}
+	)
+	for _, s := range scopes {
+		if _, ok := jobs[s.namespace]; !ok {
+			namespaces = append(namespaces, s.namespace)
+		}
+		jobs[s.namespace] = append(jobs[s.namespace], s.job)
+	}
+
+	globals := [][]*labels.Matcher{nil}
+	if len(matchOneOf) > 0 {
+		globals = globals[:0]
+		for _, s := range matchOneOf {
+			sel, err := parser.ParseMetricSelector(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid metric matcher %q: %w", s, err)
+			}
+			globals = append(globals, sel)
+		}
+	}
+
+	var res []string
+	for _, g := range globals {
+		// Series from namespaces without any scoped jobs.
+		res = append(res, formatSelector(g,
+			labels.MustNewMatcher(labels.MatchNotRegexp, "namespace", regexpAlternation(namespaces)),
+		))
+		// Series from jobs without a scope in namespaces that have scoped jobs.
+		for _, ns := range namespaces {
+			res = append(res, formatSelector(g,
+				labels.MustNewMatcher(labels.MatchEqual, "namespace", ns),
+				labels.MustNewMatcher(labels.MatchNotRegexp, "job", regexpAlternation(jobs[ns])),
+			))
+		}
+		// Allowed series of scoped jobs.
+		for _, s := range scopes {
+			res = append(res, formatSelector(g,
+				labels.MustNewMatcher(labels.MatchEqual, "namespace", s.namespace),
+				labels.MustNewMatcher(labels.MatchEqual, "job", s.job),
+				labels.MustNewMatcher(labels.MatchRegexp, labels.MetricName, regexpAlternation(s.metrics)),
+			))
+		}
+	}
+	return res, nil
+}
+
+func regexpAlternation(values []string) string {
+	quoted := make([]string, 0, len(values))
+	for _, v := range values {
+		quoted = append(quoted, regexp.QuoteMeta(v))
+	}
+	return strings.Join(quoted, "|")
+}
+
+func formatSelector(sel []*labels.Matcher, extra ...*labels.Matcher) string {
+	var parts []string
+	for _, m := range append(append([]*labels.Matcher{}, sel...), extra...) {
+		parts = append(parts, m.String())
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
 func gzipData(data []byte) ([]byte, error) {
 	var b bytes.Buffer
 	gz := gzip.NewWriter(&b)
@@ -314,8 +552,9 @@ func gzipData(data []byte) ([]byte, error) {
 	return b.Bytes(), nil
 }
 
-// ensureCollectorConfig generates the collector config and creates or updates it.
-func (r *collectionReconciler) ensureCollectorConfig(ctx context.Context, spec *monitoringv1.CollectionSpec, compression monitoringv1.CompressionType) error {
+// ensureCollectorConfig generates the collector config and creates or updates it. The
+// config records the OperatorConfig generation it was applied for.
+func (r *collectionReconciler) ensureCollectorConfig(ctx context.Context, spec *monitoringv1.CollectionSpec, compression monitoringv1.CompressionType, generation int64) error {
 	cfg, err := r.makeCollectorConfig(ctx, spec)
 	if err != nil {
 		return fmt.Errorf("generate Prometheus config: %w", err)
@@ -331,6 +570,7 @@ func (r *collectionReconciler) ensureCollectorConfig(ctx context.Context, spec *
 			Name:      NameCollector,
 		},
 	}
+	setOperatorConfigGeneration(cm, generation)
 
 	// Thanos config-reloader detects gzip compression automatically, so no sync with
 	// config-reloaders is needed when switching between these.
@@ -365,101 +605,137 @@ func (r *collectionReconciler) ensureCollectorConfig(ctx context.Context, spec *
 func (r *collectionReconciler) makeCollectorConfig(ctx context.Context, spec *monitoringv1.CollectionSpec) (*promconfig.Config, error) {
 	logger, _ := logr.FromContext(ctx)
 
-	cfg := &promconfig.Config{
-		GlobalConfig: promconfig.GlobalConfig{
-			ExternalLabels: labels.FromMap(spec.ExternalLabels),
-		},
-	}
-
-	var err error
-	cfg.ScrapeConfigs, err = makeKubeletScrapeConfigs(spec.KubeletScraping)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create kubelet scrape config: %w", err)
-	}
-
-	// Generate a separate scrape job for every endpoint in every PodMonitoring.
 	var (
 		podMons        monitoringv1.PodMonitoringList
 		clusterPodMons monitoringv1.ClusterPodMonitoringList
-		cond           *monitoringv1.MonitoringCondition
 	)
 	if err := r.client.List(ctx, &podMons); err != nil {
 		return nil, fmt.Errorf("failed to list PodMonitorings: %w", err)
 	}
+	if err := r.client.List(ctx, &clusterPodMons); err != nil {
+		return nil, fmt.Errorf("failed to list ClusterPodMonitorings: %w", err)
+	}
 
 	var projectID, location, cluster = resolveLabels(r.opts, spec.ExternalLabels)
 
+	cfg, cfgErrs, err := GenerateCollectorConfig(spec, projectID, location, cluster, podMons.Items, clusterPodMons.Items)
+	if err != nil {
+		return nil, err
+	}
+	failed := map[client.Object]bool{}
+	for _, cfgErr := range cfgErrs {
+		logger.Error(cfgErr.Err, "generating scrape config failed for PodMonitoring endpoint",
+			"namespace", cfgErr.Object.GetNamespace(), "name", cfgErr.Object.GetName())
+		failed[cfgErr.Object] = true
+	}
+
 	// Mark status updates in batch with single timestamp.
-	for _, pm := range podMons.Items {
-		// Reassign so we can safely get a pointer.
-		pmon := pm
+	var objs []monitoringv1.PodMonitoringStatusContainer
+	for i := range podMons.Items {
+		objs = append(objs, &podMons.Items[i])
+	}
+	for i := range clusterPodMons.Items {
+		objs = append(objs, &clusterPodMons.Items[i])
+	}
+	now := metav1.Now()
 
-		cond = &monitoringv1.MonitoringCondition{
-			Type:   monitoringv1.ConfigurationCreateSuccess,
-			Status: corev1.ConditionTrue,
-		}
-		cfgs, err := pmon.ScrapeConfigs(projectID, location, cluster)
-		if err != nil {
-			msg := "generating scrape config failed for PodMonitoring endpoint"
-			cond = &monitoringv1.MonitoringCondition{
-				Type:    monitoringv1.ConfigurationCreateSuccess,
-				Status:  corev1.ConditionFalse,
-				Reason:  "ScrapeConfigError",
-				Message: msg,
-			}
-			logger.Error(err, msg, "namespace", pmon.Namespace, "name", pmon.Name)
+	for _, obj := range objs {
+		if failed[obj] {
 			continue
 		}
-		cfg.ScrapeConfigs = append(cfg.ScrapeConfigs, cfgs...)
-
-		change, err := pmon.Status.SetPodMonitoringCondition(pmon.GetGeneration(), metav1.Now(), cond)
+		change, err := obj.GetStatus().SetPodMonitoringCondition(obj.GetGeneration(), now, &monitoringv1.MonitoringCondition{
+			Type:   monitoringv1.ConfigurationCreateSuccess,
+			Status: corev1.ConditionTrue,
+		})
 		if err != nil {
 			// Log an error but let operator continue to avoid getting stuck
 			// on a potential bad resource.
 			logger.Error(err, "setting podmonitoring status state")
 		}
-
 		if change {
-			r.statusUpdates = append(r.statusUpdates, &pmon)
+			r.statusUpdates = append(r.statusUpdates, obj)
 		}
 	}
+	return cfg, nil
+}
 
-	if err := r.client.List(ctx, &clusterPodMons); err != nil {
-		return nil, fmt.Errorf("failed to list ClusterPodMonitorings: %w", err)
+// ScrapeConfigError is the error of a PodMonitoring or ClusterPodMonitoring for which
+// no scrape configuration could be generated.
+type ScrapeConfigError struct {
+	Object monitoringv1.PodMonitoringStatusContainer
+	Err    error
+}
+
+func (e *ScrapeConfigError) Error() string {
+	return fmt.Sprintf("generate scrape config for %s/%s: %s", e.Object.GetNamespace(), e.Object.GetName(), e.Err)
+}
+
+func (e *ScrapeConfigError) Unwrap() error {
+	return e.Err
+}
+
+// GenerateCollectorConfig renders the Prometheus configuration of the collectors from the
+// collection spec of the OperatorConfig and the given PodMonitorings and ClusterPodMonitorings.
+// The project ID, location and cluster are set as target labels of all scrape configs.
+//
+// Resources for which no scrape configs can be generated are left out of the configuration
+// and returned as ScrapeConfigErrors, whose Object points into the given slices. The
+// returned error is only set if no configuration can be generated at all.
+func GenerateCollectorConfig(
+	spec *monitoringv1.CollectionSpec,
+	projectID, location, cluster string,
+	podMonitorings []monitoringv1.PodMonitoring,
+	clusterPodMonitorings []monitoringv1.ClusterPodMonitoring,
+) (*promconfig.Config, []*ScrapeConfigError, error) {
+	cfg := &promconfig.Config{
+		GlobalConfig: promconfig.GlobalConfig{
+			ExternalLabels: labels.FromMap(spec.ExternalLabels),
+		},
 	}
 
-	// Mark status updates in batch with single timestamp.
-	for _, cm := range clusterPodMons.Items {
-		// Reassign so we can safely get a pointer.
-		cmon := cm
+	var err error
+	cfg.ScrapeConfigs, err = makeKubeletScrapeConfigs(spec.KubeletScraping)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create kubelet scrape config: %w", err)
+	}
+	numKubeletScrapeConfigs := len(cfg.ScrapeConfigs)
 
-		cond = &monitoringv1.MonitoringCondition{
-			Type:   monitoringv1.ConfigurationCreateSuccess,
-			Status: corev1.ConditionTrue,
-		}
-		cfgs, err := cmon.ScrapeConfigs(projectID, location, cluster)
+	// Generate a separate scrape job for every endpoint in every PodMonitoring.
+	var cfgErrs []*ScrapeConfigError
+
+	for i := range podMonitorings {
+		pm := &podMonitorings[i]
+		cfgs, err := pm.ScrapeConfigs(projectID, location, cluster)
 		if err != nil {
-			msg := "generating scrape config failed for PodMonitoring endpoint"
-			cond = &monitoringv1.MonitoringCondition{
-				Type:    monitoringv1.ConfigurationCreateSuccess,
-				Status:  corev1.ConditionFalse,
-				Reason:  "ScrapeConfigError",
-				Message: msg,
-			}
-			logger.Error(err, msg, "namespace", cmon.Namespace, "name", cmon.Name)
+			cfgErrs = append(cfgErrs, &ScrapeConfigError{Object: pm, Err: err})
 			continue
 		}
 		cfg.ScrapeConfigs = append(cfg.ScrapeConfigs, cfgs...)
-
-		change, err := cmon.Status.SetPodMonitoringCondition(cmon.GetGeneration(), metav1.Now(), cond)
+	}
+	for i := range clusterPodMonitorings {
+		cpm := &clusterPodMonitorings[i]
+		cfgs, err := cpm.ScrapeConfigs(projectID, location, cluster)
 		if err != nil {
-			// Log an error but let operator continue to avoid getting stuck
-			// on a potential bad resource.
-			logger.Error(err, "setting podmonitoring status state")
+			cfgErrs = append(cfgErrs, &ScrapeConfigError{Object: cpm, Err: err})
+			continue
 		}
+		cfg.ScrapeConfigs = append(cfg.ScrapeConfigs, cfgs...)
+	}
 
-		if change {
-			r.statusUpdates = append(r.statusUpdates, &cmon)
+	// The metric type prefix label is reserved for rules generated by the operator. The
+	// scrape configs of PodMonitorings and ClusterPodMonitorings already drop it from
+	// scraped series.
+	for _, sc := range cfg.ScrapeConfigs[:numKubeletScrapeConfigs] {
+		sc.MetricRelabelConfigs = append(sc.MetricRelabelConfigs, &relabel.Config{
+			Action: relabel.LabelDrop,
+			Regex:  relabel.MustNewRegexp(regexp.QuoteMeta(export.KeyMetricTypePrefix)),
+		})
+	}
+	// Namespace defaults for the metric type prefix apply to all series after the prefix
+	// of the resource itself. Kubelet scrape configs are not namespaced.
+	if prefixRelabelCfgs := metricTypePrefixRelabelConfigs(spec.MetricTypePrefixes); len(prefixRelabelCfgs) > 0 {
+		for _, sc := range cfg.ScrapeConfigs[numKubeletScrapeConfigs:] {
+			sc.MetricRelabelConfigs = append(sc.MetricRelabelConfigs, prefixRelabelCfgs...)
 		}
 	}
 
@@ -468,7 +744,30 @@ func (r *collectionReconciler) makeCollectorConfig(ctx context.Context, spec *mo
 		return cfg.ScrapeConfigs[i].JobName < cfg.ScrapeConfigs[j].JobName
 	})
 
-	return cfg, nil
+	return cfg, cfgErrs, nil
+}
+
+// metricTypePrefixRelabelConfigs returns metric relabeling rules that set the metric type
+// prefix of series by their namespace label if it was not set before.
+func metricTypePrefixRelabelConfigs(prefixes map[string]string) []*relabel.Config {
+	namespaces := make([]string, 0, len(prefixes))
+	for namespace := range prefixes {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+
+	var res []*relabel.Config
+	for _, namespace := range namespaces {
+		res = append(res, &relabel.Config{
+			Action:       relabel.Replace,
+			SourceLabels: prommodel.LabelNames{"namespace", export.KeyMetricTypePrefix},
+			Separator:    ";",
+			Regex:        relabel.MustNewRegexp(regexp.QuoteMeta(namespace) + ";"),
+			Replacement:  prefixes[namespace],
+			TargetLabel:  export.KeyMetricTypePrefix,
+		})
+	}
+	return res
 }
 
 type podMonitoringDefaulter struct{}
@@ -16,20 +16,26 @@ package operator
 
 import (
 	"context"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/GoogleCloudPlatform/prometheus-engine/pkg/export"
 	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
 	"github.com/go-logr/logr"
 	"github.com/go-logr/logr/testr"
 	"github.com/google/go-cmp/cmp"
 	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/relabel"
+	"github.com/prometheus/prometheus/promql/parser"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/utils/pointer"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
@@ -130,7 +136,7 @@ func TestCollectionStatus(t *testing.T) {
 		}).
 		Build()
 
-	collectionReconciler := newCollectionReconciler(kubeClient, opts)
+	collectionReconciler := newCollectionReconciler(kubeClient, record.NewFakeRecorder(10), opts)
 	collectionReconciler.Reconcile(ctx, reconcile.Request{
 		NamespacedName: types.NamespacedName{
 			Namespace: opts.PublicNamespace,
@@ -157,3 +163,321 @@ func TestCollectionStatus(t *testing.T) {
 		t.Fatalf("invalid PodMonitorings found: %d", amount)
 	}
 }
+
+func TestGenerateCollectorConfig(t *testing.T) {
+	pms := []monitoringv1.PodMonitoring{
+		{
+			ObjectMeta: v1.ObjectMeta{Name: "valid", Namespace: "ns1"},
+			Spec: monitoringv1.PodMonitoringSpec{
+				Endpoints: []monitoringv1.ScrapeEndpoint{{
+					Port:     intstr.FromString("metrics"),
+					Interval: "10s",
+				}},
+			},
+		},
+		{
+			ObjectMeta: v1.ObjectMeta{Name: "invalid", Namespace: "ns1"},
+			Spec: monitoringv1.PodMonitoringSpec{
+				Endpoints: []monitoringv1.ScrapeEndpoint{{
+					Port:     intstr.FromString("metrics"),
+					Interval: "foo",
+				}},
+			},
+		},
+	}
+	cpms := []monitoringv1.ClusterPodMonitoring{
+		{
+			ObjectMeta: v1.ObjectMeta{Name: "cluster"},
+			Spec: monitoringv1.ClusterPodMonitoringSpec{
+				Endpoints: []monitoringv1.ScrapeEndpoint{{
+					Port:     intstr.FromString("metrics"),
+					Interval: "10s",
+				}},
+			},
+		},
+	}
+	spec := &monitoringv1.CollectionSpec{
+		ExternalLabels: map[string]string{"foo": "bar"},
+	}
+
+	cfg, cfgErrs, err := GenerateCollectorConfig(spec, "test-proj", "test-loc", "test-cluster", pms, cpms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var jobs []string
+	for _, sc := range cfg.ScrapeConfigs {
+		jobs = append(jobs, sc.JobName)
+	}
+	wantJobs := []string{"ClusterPodMonitoring/cluster/metrics", "PodMonitoring/ns1/valid/metrics"}
+	if diff := cmp.Diff(wantJobs, jobs); diff != "" {
+		t.Errorf("unexpected jobs (-want, +got): %s", diff)
+	}
+	if got := cfg.GlobalConfig.ExternalLabels.Get("foo"); got != "bar" {
+		t.Errorf("expected external label foo=bar, got %q", got)
+	}
+	if len(cfgErrs) != 1 || cfgErrs[0].Object != &pms[1] {
+		t.Errorf("expected scrape config error for invalid PodMonitoring, got %v", cfgErrs)
+	}
+}
+
+func TestMetricTypePrefixRelabelConfigs(t *testing.T) {
+	cfgs := metricTypePrefixRelabelConfigs(map[string]string{
+		"team-a":  "custom.googleapis.com/team-a",
+		"team-a2": "custom.googleapis.com/team-a2",
+	})
+	cases := []struct {
+		lset labels.Labels
+		want string
+	}{
+		{
+			lset: labels.FromStrings("namespace", "team-a"),
+			want: "custom.googleapis.com/team-a",
+		}, {
+			lset: labels.FromStrings("namespace", "team-a2"),
+			want: "custom.googleapis.com/team-a2",
+		}, {
+			lset: labels.FromStrings("namespace", "team-b"),
+			want: "",
+		}, {
+			// The prefix of the resource takes precedence.
+			lset: labels.FromStrings("namespace", "team-a", export.KeyMetricTypePrefix, "example.com"),
+			want: "example.com",
+		},
+	}
+	for _, c := range cases {
+		if got := relabel.Process(c.lset, cfgs...).Get(export.KeyMetricTypePrefix); got != c.want {
+			t.Errorf("expected prefix %q for %s, got %q", c.want, c.lset, got)
+		}
+	}
+}
+
+func TestExportMatchers(t *testing.T) {
+	scopes := []exportScope{
+		{namespace: "team-a", job: "app", metrics: []string{"foo", "bar"}},
+		{namespace: "team-b", job: "app", metrics: []string{"baz"}},
+	}
+	cases := []struct {
+		doc        string
+		matchOneOf []string
+		series     map[string]bool
+	}{
+		{
+			doc: "no global filter",
+			series: map[string]bool{
+				`foo{namespace="team-a",job="app"}`:   true,
+				`baz{namespace="team-a",job="app"}`:   false,
+				`baz{namespace="team-b",job="app"}`:   true,
+				`foo{namespace="team-b",job="app"}`:   false,
+				`foo{namespace="team-a",job="other"}`: true,
+				`foo{namespace="team-c",job="app"}`:   true,
+				`foo{job="kubelet"}`:                  true,
+			},
+		},
+		{
+			doc:        "with global filter",
+			matchOneOf: []string{`{__name__!="bar"}`},
+			series: map[string]bool{
+				`foo{namespace="team-a",job="app"}`:   true,
+				`bar{namespace="team-a",job="app"}`:   false,
+				`baz{namespace="team-a",job="app"}`:   false,
+				`baz{namespace="team-b",job="app"}`:   true,
+				`bar{namespace="team-a",job="other"}`: false,
+				`foo{namespace="team-c",job="app"}`:   true,
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.doc, func(t *testing.T) {
+			res, err := exportMatchers(c.matchOneOf, scopes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var matchers export.Matchers
+			for _, s := range res {
+				if err := matchers.Set(s); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for s, want := range c.series {
+				lset, err := parser.ParseMetric(s)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := matchers.Matches(lset); got != want {
+					t.Errorf("series %s: expected match %v but got %v", s, want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestParseExportOnly(t *testing.T) {
+	got, err := parseExportOnly(" foo, bar ,,baz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"bar", "baz", "foo"}, got); diff != "" {
+		t.Errorf("unexpected metrics (-want, +got): %s", diff)
+	}
+	for _, s := range []string{"", " , ", "foo,1bar"} {
+		if _, err := parseExportOnly(s); err == nil {
+			t.Errorf("expected error for %q", s)
+		}
+	}
+}
+
+func TestInvalidExportOnlyEvent(t *testing.T) {
+	scheme, err := NewScheme()
+	if err != nil {
+		t.Fatal("Unable to get scheme")
+	}
+	logger := testr.New(t)
+	ctx := logr.NewContext(context.Background(), logger)
+	opts := Options{
+		ProjectID: "test-proj",
+		Location:  "test-loc",
+		Cluster:   "test-cluster",
+	}
+	if err := opts.defaultAndValidate(logger); err != nil {
+		t.Fatal("Invalid options:", err)
+	}
+
+	kubeClient := fake.
+		NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(&monitoringv1.PodMonitoring{
+			ObjectMeta: v1.ObjectMeta{
+				Name:        "prom-example",
+				Namespace:   "gmp-test",
+				Annotations: map[string]string{AnnotationExportOnly: "foo,1bar"},
+			},
+		}).
+		WithObjects(&appsv1.DaemonSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      NameCollector,
+				Namespace: opts.OperatorNamespace,
+			},
+			Spec: appsv1.DaemonSetSpec{
+				Template: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{{
+							Name: "prometheus",
+						}},
+					},
+				},
+			},
+		}).
+		Build()
+
+	recorder := record.NewFakeRecorder(10)
+	if err := newCollectionReconciler(kubeClient, recorder, opts).ensureCollectorDaemonSet(ctx, &monitoringv1.CollectionSpec{}, &monitoringv1.APIEndpoints{}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case event := <-recorder.Events:
+		if !strings.HasPrefix(event, "Warning "+reasonInvalidExportOnly) {
+			t.Errorf("unexpected event %q", event)
+		}
+	default:
+		t.Fatal("expected event for invalid export-only annotation")
+	}
+}
+
+func TestExportBatchingFlags(t *testing.T) {
+	got, err := exportBatchingFlags(&monitoringv1.ExportBatching{
+		BatchSize:       100,
+		BatchDelay:      "1s",
+		ShardBufferSize: 4096,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"--export.debug.batch-size=100",
+		"--export.debug.batch-delay=1s",
+		"--export.debug.shard-buffer-size=4096",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected flags (-want, +got): %s", diff)
+	}
+	// Unset settings keep the collector defaults.
+	for _, spec := range []*monitoringv1.ExportBatching{nil, {}} {
+		got, err := exportBatchingFlags(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) > 0 {
+			t.Errorf("unexpected flags %v", got)
+		}
+	}
+	for _, spec := range []*monitoringv1.ExportBatching{
+		{BatchSize: 201},
+		{BatchDelay: "0"},
+		{BatchDelay: "xyz"},
+		{ShardBufferSize: 100000},
+	} {
+		if _, err := exportBatchingFlags(spec); err == nil {
+			t.Errorf("expected error for %+v", spec)
+		}
+	}
+}
+
+func TestExportEndpointFlags(t *testing.T) {
+	got, err := exportEndpointFlags(&monitoringv1.APIEndpoints{
+		Export:        "10.0.0.1:443",
+		TLSServerName: "monitoring.googleapis.com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`--export.endpoint="10.0.0.1:443"`,
+		`--export.tls.server-name="monitoring.googleapis.com"`,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected flags (-want, +got): %s", diff)
+	}
+	// Unset endpoints keep the defaults.
+	got, err = exportEndpointFlags(&monitoringv1.APIEndpoints{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) > 0 {
+		t.Errorf("unexpected flags %v", got)
+	}
+
+	url, err := queryTargetURL(&monitoringv1.APIEndpoints{Query: "monitoring.us-east1.rep.googleapis.com"}, "p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "https://monitoring.us-east1.rep.googleapis.com/v1/projects/p1/location/global/prometheus"; url != want {
+		t.Errorf("expected query target URL %q, got %q", want, url)
+	}
+}
+
+func TestExportMetricNameFlags(t *testing.T) {
+	got, err := exportMetricNameFlags(&monitoringv1.ExportFilters{
+		MatchOneOf:       []string{`{job="a"}`},
+		AllowMetricNames: []string{"kube_.+", "up"},
+		DenyMetricNames:  []string{"kube_pod_.+"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`--export.metric-name.allow="kube_.+"`,
+		`--export.metric-name.allow="up"`,
+		`--export.metric-name.deny="kube_pod_.+"`,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected flags (-want, +got): %s", diff)
+	}
+	for _, filter := range []*monitoringv1.ExportFilters{
+		{AllowMetricNames: []string{"kube_("}},
+		{DenyMetricNames: []string{"[a-"}},
+	} {
+		if _, err := exportMetricNameFlags(filter); err == nil {
+			t.Errorf("expected error for %+v", filter)
+		}
+	}
+}
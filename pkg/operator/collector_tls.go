@@ -0,0 +1,320 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"path"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	certutil "k8s.io/client-go/util/cert"
+	"k8s.io/client-go/util/keyutil"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// Keys of the collector TLS secret. The CA key is only used by the operator and not
+// mounted into the collector pods.
+const (
+	collectorTLSCACert    = "ca.crt"
+	collectorTLSCAKey     = "ca.key"
+	collectorTLSWebConfig = "web-config.yaml"
+)
+
+const (
+	// Name of the config-reloader container of the collector pods.
+	collectorConfigReloaderContainerName = "config-reloader"
+
+	// Validity of the serving certificates issued to the collectors.
+	collectorCertValidity = 365 * 24 * time.Hour
+	// Serving certificates are re-issued once they expire within this duration.
+	collectorCertRenewBefore = 30 * 24 * time.Hour
+	// Interval at which the serving certificate is checked for renewal.
+	collectorCertCheckInterval = 12 * time.Hour
+)
+
+// collectorWebConfig is the Prometheus web configuration that makes the collectors
+// serve their API over TLS. The certificate files are re-read on every handshake,
+// so renewed certificates are picked up without restarting the collectors.
+var collectorWebConfig = fmt.Sprintf(`tls_server_config:
+  cert_file: %s
+  key_file: %s
+`, path.Join(collectorTLSDir, corev1.TLSCertKey), path.Join(collectorTLSDir, corev1.TLSPrivateKeyKey))
+
+// setupCollectorTLS provisions the serving certificate of the collectors if they are
+// configured to serve over TLS and keeps renewing it on the elected leader.
+func setupCollectorTLS(ctx context.Context, op *Operator) error {
+	if !op.opts.CollectorTLS {
+		return nil
+	}
+	// Every replica needs the certificate authority to verify the collectors in case
+	// it gets elected, so it's read before the manager starts.
+	caData, err := ensureCollectorTLSSecret(ctx, op.client, op.opts, time.Now())
+	if err != nil {
+		return err
+	}
+	op.collectorCA = caData
+
+	return op.manager.Add(manager.RunnableFunc(func(ctx context.Context) error {
+		ticker := time.NewTicker(collectorCertCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+				if _, err := ensureCollectorTLSSecret(ctx, op.client, op.opts, time.Now()); err != nil {
+					op.logger.Error(err, "renew collector serving certificate")
+				}
+			}
+		}
+	}))
+}
+
+// ensureCollectorTLSSecret ensures the collector TLS secret holds a certificate
+// authority and a valid serving certificate signed by it, and returns the certificate
+// authority in PEM format. The certificate authority is kept as long as it's valid so
+// that running operator replicas keep trusting re-issued serving certificates.
+func ensureCollectorTLSSecret(ctx context.Context, kubeClient client.Client, opts Options, now time.Time) ([]byte, error) {
+	caData, err := updateCollectorTLSSecret(ctx, kubeClient, opts, now)
+	if apierrors.IsAlreadyExists(err) || apierrors.IsConflict(err) {
+		// Another replica created or renewed the secret concurrently.
+		caData, err = updateCollectorTLSSecret(ctx, kubeClient, opts, now)
+	}
+	return caData, err
+}
+
+func updateCollectorTLSSecret(ctx context.Context, kubeClient client.Client, opts Options, now time.Time) ([]byte, error) {
+	secret := &corev1.Secret{}
+	err := kubeClient.Get(ctx, client.ObjectKey{Namespace: opts.OperatorNamespace, Name: CollectorTLSSecretName}, secret)
+	exists := err == nil
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("get collector TLS secret: %w", err)
+	}
+	if !exists {
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      CollectorTLSSecretName,
+				Namespace: opts.OperatorNamespace,
+				Labels: map[string]string{
+					LabelAppName: NameCollector,
+				},
+				Annotations: map[string]string{
+					AnnotationMetricName: componentName,
+				},
+			},
+		}
+	}
+	if secret.Data == nil {
+		secret.Data = map[string][]byte{}
+	}
+	changed := false
+
+	caCert, caKey, err := parseCollectorCA(secret.Data, now)
+	if err != nil {
+		if caCert, caKey, err = generateCollectorCA(); err != nil {
+			return nil, fmt.Errorf("generate collector certificate authority: %w", err)
+		}
+		caKeyData, err := keyutil.MarshalPrivateKeyToPEM(caKey)
+		if err != nil {
+			return nil, fmt.Errorf("encode collector certificate authority key: %w", err)
+		}
+		secret.Data[collectorTLSCACert] = encodeCertPEM(caCert)
+		secret.Data[collectorTLSCAKey] = caKeyData
+		changed = true
+	}
+	if changed || verifyCollectorCert(secret.Data, caCert, opts.CollectorTLSServerName, now) != nil {
+		crt, key, err := generateCollectorCert(caCert, caKey, opts.CollectorTLSServerName, now)
+		if err != nil {
+			return nil, fmt.Errorf("generate collector serving certificate: %w", err)
+		}
+		secret.Data[corev1.TLSCertKey] = crt
+		secret.Data[corev1.TLSPrivateKeyKey] = key
+		changed = true
+	}
+	if string(secret.Data[collectorTLSWebConfig]) != collectorWebConfig {
+		secret.Data[collectorTLSWebConfig] = []byte(collectorWebConfig)
+		changed = true
+	}
+
+	if !exists {
+		if err := kubeClient.Create(ctx, secret); err != nil {
+			return nil, fmt.Errorf("create collector TLS secret: %w", err)
+		}
+	} else if changed {
+		if err := kubeClient.Update(ctx, secret); err != nil {
+			return nil, fmt.Errorf("update collector TLS secret: %w", err)
+		}
+	}
+	return secret.Data[collectorTLSCACert], nil
+}
+
+// parseCollectorCA parses the certificate authority from the collector TLS secret data.
+// It returns an error if it's missing or expires within the renewal period.
+func parseCollectorCA(data map[string][]byte, now time.Time) (*x509.Certificate, crypto.Signer, error) {
+	certs, err := certutil.ParseCertsPEM(data[collectorTLSCACert])
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := keyutil.ParsePrivateKeyPEM(data[collectorTLSCAKey])
+	if err != nil {
+		return nil, nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, nil, errors.New("unsupported certificate authority key")
+	}
+	if !certs[0].IsCA || now.Add(collectorCertRenewBefore).After(certs[0].NotAfter) {
+		return nil, nil, errors.New("certificate authority expired")
+	}
+	return certs[0], signer, nil
+}
+
+// verifyCollectorCert verifies that the serving certificate in the collector TLS secret
+// data is signed by the certificate authority, valid for the server name, and does not
+// expire within the renewal period.
+func verifyCollectorCert(data map[string][]byte, caCert *x509.Certificate, serverName string, now time.Time) error {
+	certs, err := certutil.ParseCertsPEM(data[corev1.TLSCertKey])
+	if err != nil {
+		return err
+	}
+	if _, err := keyutil.ParsePrivateKeyPEM(data[corev1.TLSPrivateKeyKey]); err != nil {
+		return err
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(caCert)
+
+	_, err = certs[0].Verify(x509.VerifyOptions{
+		DNSName:     serverName,
+		Roots:       roots,
+		CurrentTime: now.Add(collectorCertRenewBefore),
+	})
+	return err
+}
+
+func generateCollectorCA() (*x509.Certificate, crypto.Signer, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	caCert, err := certutil.NewSelfSignedCACert(certutil.Config{CommonName: "gmp-collector-ca"}, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return caCert, key, nil
+}
+
+// generateCollectorCert issues a serving certificate for the server name the operator
+// verifies the collectors against. It's also valid for localhost, which the
+// config-reloader uses to reach the collector.
+func generateCollectorCert(caCert *x509.Certificate, caKey crypto.Signer, serverName string, now time.Time) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: serverName},
+		DNSNames:     []string{serverName, "localhost"},
+		// Allow for some clock skew between the operator and the collectors.
+		NotBefore:   now.Add(-time.Hour).UTC(),
+		NotAfter:    now.Add(collectorCertValidity).UTC(),
+		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, caCert, key.Public(), caKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyData, err := keyutil.MarshalPrivateKeyToPEM(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: certutil.CertificateBlockType, Bytes: der}), keyData, nil
+}
+
+func encodeCertPEM(c *x509.Certificate) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: certutil.CertificateBlockType, Bytes: c.Raw})
+}
+
+// configureCollectorTLS configures the collector pods to serve over TLS with the
+// certificate from the collector TLS secret, or reverts it if disabled. The Prometheus
+// flags are set separately through the EXTRA_ARGS of the collector.
+func configureCollectorTLS(spec *corev1.PodSpec, enabled bool) {
+	setSecretVolume(spec, &corev1.SecretVolumeSource{
+		SecretName: CollectorTLSSecretName,
+		Items: []corev1.KeyToPath{
+			{Key: collectorTLSCACert, Path: collectorTLSCACert},
+			{Key: corev1.TLSCertKey, Path: corev1.TLSCertKey},
+			{Key: corev1.TLSPrivateKeyKey, Path: corev1.TLSPrivateKeyKey},
+			{Key: collectorTLSWebConfig, Path: collectorTLSWebConfig},
+		},
+	}, collectorTLSDir, enabled, CollectorPrometheusContainerName, collectorConfigReloaderContainerName)
+
+	from, to := "http://", "https://"
+	scheme := corev1.URISchemeHTTPS
+	if !enabled {
+		from, to = to, from
+		scheme = corev1.URISchemeHTTP
+	}
+	for i := range spec.Containers {
+		c := &spec.Containers[i]
+
+		switch c.Name {
+		case CollectorPrometheusContainerName:
+			for _, probe := range []*corev1.Probe{c.LivenessProbe, c.ReadinessProbe} {
+				if probe != nil && probe.HTTPGet != nil {
+					probe.HTTPGet.Scheme = scheme
+				}
+			}
+		case collectorConfigReloaderContainerName:
+			var args []string
+			for _, arg := range c.Args {
+				if strings.HasPrefix(arg, "--tls-ca-file=") {
+					continue
+				}
+				for _, flag := range []string{"--reload-url=", "--ready-url="} {
+					if strings.HasPrefix(arg, flag+from) {
+						arg = flag + to + strings.TrimPrefix(arg, flag+from)
+					}
+				}
+				args = append(args, arg)
+			}
+			if enabled {
+				args = append(args, "--tls-ca-file="+path.Join(collectorTLSDir, collectorTLSCACert))
+			}
+			c.Args = args
+		}
+	}
+}
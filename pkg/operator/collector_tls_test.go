@@ -0,0 +1,180 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestEnsureCollectorTLSSecret(t *testing.T) {
+	ctx := context.Background()
+	scheme, err := NewScheme()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme).Build()
+	opts := Options{
+		OperatorNamespace:      "gmp-system",
+		CollectorTLS:           true,
+		CollectorTLSServerName: "collector.gmp-system.svc",
+	}
+	now := time.Now()
+
+	getSecret := func() *corev1.Secret {
+		var secret corev1.Secret
+		if err := kubeClient.Get(ctx, client.ObjectKey{Namespace: "gmp-system", Name: CollectorTLSSecretName}, &secret); err != nil {
+			t.Fatal(err)
+		}
+		return &secret
+	}
+	verify := func(secret *corev1.Secret, serverName string, now time.Time) {
+		t.Helper()
+		caCert, _, err := parseCollectorCA(secret.Data, now)
+		if err != nil {
+			t.Fatalf("invalid certificate authority: %s", err)
+		}
+		if err := verifyCollectorCert(secret.Data, caCert, serverName, now); err != nil {
+			t.Fatalf("invalid serving certificate: %s", err)
+		}
+		if err := verifyCollectorCert(secret.Data, caCert, "localhost", now); err != nil {
+			t.Fatalf("invalid serving certificate for localhost: %s", err)
+		}
+		if got := string(secret.Data[collectorTLSWebConfig]); got != collectorWebConfig {
+			t.Errorf("unexpected web config %q", got)
+		}
+	}
+
+	// The secret is created with a new certificate authority.
+	caData, err := ensureCollectorTLSSecret(ctx, kubeClient, opts, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := getSecret()
+	if !bytes.Equal(caData, secret.Data[collectorTLSCACert]) {
+		t.Errorf("returned certificate authority does not match the secret")
+	}
+	verify(secret, opts.CollectorTLSServerName, now)
+
+	// A valid secret is not updated.
+	if _, err := ensureCollectorTLSSecret(ctx, kubeClient, opts, now); err != nil {
+		t.Fatal(err)
+	}
+	if got := getSecret(); got.ResourceVersion != secret.ResourceVersion {
+		t.Errorf("expected secret to be unchanged")
+	}
+
+	// Serving certificates about to expire are re-issued by the same certificate authority.
+	later := now.Add(collectorCertValidity - collectorCertRenewBefore + time.Hour)
+	caData, err = ensureCollectorTLSSecret(ctx, kubeClient, opts, later)
+	if err != nil {
+		t.Fatal(err)
+	}
+	renewed := getSecret()
+	if !bytes.Equal(caData, secret.Data[collectorTLSCACert]) {
+		t.Errorf("expected certificate authority to be kept")
+	}
+	if bytes.Equal(renewed.Data[corev1.TLSCertKey], secret.Data[corev1.TLSCertKey]) {
+		t.Errorf("expected serving certificate to be renewed")
+	}
+	verify(renewed, opts.CollectorTLSServerName, later)
+
+	// Changing the server name re-issues the serving certificate.
+	opts.CollectorTLSServerName = "collector.example.com"
+	if _, err := ensureCollectorTLSSecret(ctx, kubeClient, opts, later); err != nil {
+		t.Fatal(err)
+	}
+	verify(getSecret(), opts.CollectorTLSServerName, later)
+}
+
+func TestConfigureCollectorTLS(t *testing.T) {
+	podSpec := func() *corev1.PodSpec {
+		return &corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name: collectorConfigReloaderContainerName,
+					Args: []string{
+						"--config-file=/prometheus/config/config.yaml",
+						"--reload-url=http://localhost:19090/-/reload",
+						"--ready-url=http://localhost:19090/-/ready",
+					},
+				},
+				{
+					Name: CollectorPrometheusContainerName,
+					VolumeMounts: []corev1.VolumeMount{
+						{Name: "storage", MountPath: "/prometheus/data"},
+					},
+					LivenessProbe: &corev1.Probe{
+						ProbeHandler: corev1.ProbeHandler{
+							HTTPGet: &corev1.HTTPGetAction{Path: "/-/healthy", Scheme: corev1.URISchemeHTTP},
+						},
+					},
+					ReadinessProbe: &corev1.Probe{
+						ProbeHandler: corev1.ProbeHandler{
+							HTTPGet: &corev1.HTTPGetAction{Path: "/-/ready", Scheme: corev1.URISchemeHTTP},
+						},
+					},
+				},
+			},
+			Volumes: []corev1.Volume{
+				{Name: "storage", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+			},
+		}
+	}
+	spec := podSpec()
+
+	configureCollectorTLS(spec, true)
+	configureCollectorTLS(spec, true)
+
+	want := []string{
+		"--config-file=/prometheus/config/config.yaml",
+		"--reload-url=https://localhost:19090/-/reload",
+		"--ready-url=https://localhost:19090/-/ready",
+		"--tls-ca-file=/etc/collector-tls/ca.crt",
+	}
+	if diff := cmp.Diff(want, spec.Containers[0].Args); diff != "" {
+		t.Errorf("unexpected config-reloader args (-want, +got): %s", diff)
+	}
+	prom := spec.Containers[1]
+	if prom.LivenessProbe.HTTPGet.Scheme != corev1.URISchemeHTTPS || prom.ReadinessProbe.HTTPGet.Scheme != corev1.URISchemeHTTPS {
+		t.Errorf("expected probes to use HTTPS")
+	}
+	for _, c := range spec.Containers {
+		if n := len(c.VolumeMounts); c.VolumeMounts[n-1].Name != CollectorTLSSecretName || c.VolumeMounts[n-1].MountPath != collectorTLSDir {
+			t.Errorf("expected TLS volume to be mounted once into %q, got %v", c.Name, c.VolumeMounts)
+		}
+	}
+	if len(spec.Volumes) != 2 {
+		t.Fatalf("expected 2 volumes, got %v", spec.Volumes)
+	}
+	for _, item := range spec.Volumes[1].Secret.Items {
+		if item.Key == collectorTLSCAKey {
+			t.Errorf("certificate authority key must not be mounted")
+		}
+	}
+
+	// Disabling TLS restores the original pod spec.
+	configureCollectorTLS(spec, false)
+	if diff := cmp.Diff(podSpec(), spec); diff != "" {
+		t.Errorf("unexpected pod spec after disabling TLS (-want, +got): %s", diff)
+	}
+}
@@ -16,26 +16,80 @@ package operator
 
 import (
 	"errors"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
 
 	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
 	prometheusv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 const (
-	// How many targets to keep in each group.
-	maxSampleTargetSize = 5
+	// How many targets to keep in each group by default.
+	defaultMaxSampleTargets = 5
 )
 
-func buildEndpointStatuses(targets []*prometheusv1.TargetsResult) (map[string][]monitoringv1.ScrapeEndpointStatus, error) {
+// Matches the error of scrapes that failed with an unexpected HTTP status code,
+// e.g. "server returned HTTP status 503 Service Unavailable".
+var scrapeStatusCodeRe = regexp.MustCompile(`server returned HTTP status (\d{3})\b`)
+
+// scrapeStatusCode returns the HTTP status code of the scrape error, or nil if the
+// error does not contain one.
+func scrapeStatusCode(lastError string) *int32 {
+	m := scrapeStatusCodeRe.FindStringSubmatch(lastError)
+	if m == nil {
+		return nil
+	}
+	code, err := strconv.ParseInt(m[1], 10, 32)
+	if err != nil {
+		return nil
+	}
+	res := int32(code)
+	return &res
+}
+
+// sampleLimits bounds the sample data kept in each endpoint status.
+type sampleLimits struct {
+	// Maximum number of targets kept in each sample group.
+	maxTargets int
+	// Maximum number of sample groups. Zero means no limit.
+	maxGroups int
+	// Policy by which sample groups are truncated.
+	policy monitoringv1.TruncationPolicy
+}
+
+// sampleLimitsFromSpec returns the sample limits configured in the target status spec.
+func sampleLimitsFromSpec(spec *monitoringv1.TargetStatusSpec) sampleLimits {
+	limits := sampleLimits{
+		maxTargets: defaultMaxSampleTargets,
+		maxGroups:  int(spec.MaxSampleGroups),
+		policy:     spec.TruncationPolicy,
+	}
+	// Zero cannot be told apart from unset and applies the default as well.
+	if spec.MaxSampleTargets > 0 {
+		limits.maxTargets = int(spec.MaxSampleTargets)
+	}
+	return limits
+}
+
+// BuildEndpointStatuses aggregates the active targets fetched from the collectors into
+// endpoint statuses, keyed by the job of the PodMonitoring or ClusterPodMonitoring they
+// belong to. The sample targets kept for each endpoint are limited as configured in
+// the target status spec. Nil entries in targets represent unreachable collectors.
+func BuildEndpointStatuses(targets []*prometheusv1.TargetsResult, spec *monitoringv1.TargetStatusSpec) (map[string][]monitoringv1.ScrapeEndpointStatus, error) {
+	return buildEndpointStatuses(targets, sampleLimitsFromSpec(spec))
+}
+
+func buildEndpointStatuses(targets []*prometheusv1.TargetsResult, limits sampleLimits) (map[string][]monitoringv1.ScrapeEndpointStatus, error) {
 	endpointBuilder := &scrapeEndpointBuilder{
 		mapByJobByEndpoint: make(map[string]map[string]*scrapeEndpointStatusBuilder),
 		total:              0,
 		failed:             0,
 		time:               metav1.Now(),
+		limits:             limits,
 	}
 
 	for _, target := range targets {
@@ -52,6 +106,7 @@ type scrapeEndpointBuilder struct {
 	total              uint32
 	failed             uint32
 	time               metav1.Time
+	limits             sampleLimits
 }
 
 func (b *scrapeEndpointBuilder) add(target *prometheusv1.TargetsResult) error {
@@ -84,7 +139,7 @@ func (b *scrapeEndpointBuilder) addActiveTarget(activeTarget prometheusv1.Active
 
 	statusBuilder, exists := mapByEndpoint[endpoint]
 	if !exists {
-		statusBuilder = newScrapeEndpointStatusBuilder(&activeTarget, time)
+		statusBuilder = newScrapeEndpointStatusBuilder(&activeTarget, time, b.limits)
 		mapByEndpoint[endpoint] = statusBuilder
 	}
 	statusBuilder.addSampleTarget(&activeTarget)
@@ -118,9 +173,12 @@ func (b *scrapeEndpointBuilder) build() map[string][]monitoringv1.ScrapeEndpoint
 type scrapeEndpointStatusBuilder struct {
 	status       monitoringv1.ScrapeEndpointStatus
 	groupByError map[string]*monitoringv1.SampleGroup
+	// Errors of groups that contain unhealthy targets.
+	unhealthyGroups map[string]bool
+	limits          sampleLimits
 }
 
-func newScrapeEndpointStatusBuilder(target *prometheusv1.ActiveTarget, time metav1.Time) *scrapeEndpointStatusBuilder {
+func newScrapeEndpointStatusBuilder(target *prometheusv1.ActiveTarget, time metav1.Time, limits sampleLimits) *scrapeEndpointStatusBuilder {
 	return &scrapeEndpointStatusBuilder{
 		status: monitoringv1.ScrapeEndpointStatus{
 			Name:               target.ScrapePool,
@@ -129,7 +187,9 @@ func newScrapeEndpointStatusBuilder(target *prometheusv1.ActiveTarget, time meta
 			LastUpdateTime:     time,
 			CollectorsFraction: "0",
 		},
-		groupByError: make(map[string]*monitoringv1.SampleGroup),
+		groupByError:    make(map[string]*monitoringv1.SampleGroup),
+		unhealthyGroups: make(map[string]bool),
+		limits:          limits,
 	}
 }
 
@@ -144,6 +204,7 @@ func (b *scrapeEndpointStatusBuilder) addSampleTarget(target *prometheusv1.Activ
 		}
 	} else {
 		b.status.UnhealthyTargets++
+		b.unhealthyGroups[errorType] = true
 	}
 
 	sampleGroup, ok := b.groupByError[errorType]
@@ -152,6 +213,15 @@ func (b *scrapeEndpointStatusBuilder) addSampleTarget(target *prometheusv1.Activ
 		LastError:                 lastError,
 		Labels:                    target.Labels,
 		LastScrapeDurationSeconds: strconv.FormatFloat(target.LastScrapeDuration, 'f', -1, 64),
+		// The operator does not relabel the scrape interval and timeout, so the
+		// discovered labels hold their effective values.
+		ScrapeInterval:       target.DiscoveredLabels[model.ScrapeIntervalLabel],
+		ScrapeTimeout:        target.DiscoveredLabels[model.ScrapeTimeoutLabel],
+		LastScrapeStatusCode: scrapeStatusCode(target.LastError),
+	}
+	if !target.LastScrape.IsZero() {
+		lastScrape := metav1.NewTime(target.LastScrape)
+		sampleTarget.LastScrapeTime = &lastScrape
 	}
 	if !ok {
 		sampleGroup = &monitoringv1.SampleGroup{
@@ -166,8 +236,14 @@ func (b *scrapeEndpointStatusBuilder) addSampleTarget(target *prometheusv1.Activ
 
 // build a deterministic (regarding array ordering) status object.
 func (b *scrapeEndpointStatusBuilder) build() monitoringv1.ScrapeEndpointStatus {
+	if b.limits.policy == monitoringv1.TruncationPolicyCountsOnly {
+		return b.status
+	}
 	// Deterministic sample group by error.
-	for _, sampleGroup := range b.groupByError {
+	for errorType, sampleGroup := range b.groupByError {
+		if !b.unhealthyGroups[errorType] && (b.limits.policy == monitoringv1.TruncationPolicyUnhealthyOnly || b.limits.policy == monitoringv1.TruncationPolicyTopErrors) {
+			continue
+		}
 		sort.SliceStable(sampleGroup.SampleTargets, func(i, j int) bool {
 			// Every sample target is guaranteed to have an instance label.
 			lhsInstance := sampleGroup.SampleTargets[i].Labels["instance"]
@@ -175,8 +251,8 @@ func (b *scrapeEndpointStatusBuilder) build() monitoringv1.ScrapeEndpointStatus
 			return lhsInstance < rhsInstance
 		})
 		sampleTargetsSize := len(sampleGroup.SampleTargets)
-		if sampleTargetsSize > maxSampleTargetSize {
-			sampleTargetsSize = maxSampleTargetSize
+		if sampleTargetsSize > b.limits.maxTargets {
+			sampleTargetsSize = b.limits.maxTargets
 		}
 		sampleGroup.SampleTargets = sampleGroup.SampleTargets[0:sampleTargetsSize]
 		b.status.SampleGroups = append(b.status.SampleGroups, *sampleGroup)
@@ -192,5 +268,14 @@ func (b *scrapeEndpointStatusBuilder) build() monitoringv1.ScrapeEndpointStatus
 		}
 		return *lhsError < *rhsError
 	})
+	if b.limits.policy == monitoringv1.TruncationPolicyTopErrors {
+		sort.SliceStable(b.status.SampleGroups, func(i, j int) bool {
+			return *b.status.SampleGroups[i].Count > *b.status.SampleGroups[j].Count
+		})
+	}
+	// Healthy targets are sorted last and thus dropped first.
+	if b.limits.maxGroups > 0 && len(b.status.SampleGroups) > b.limits.maxGroups {
+		b.status.SampleGroups = b.status.SampleGroups[:b.limits.maxGroups]
+	}
 	return b.status
 }
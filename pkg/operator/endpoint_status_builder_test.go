@@ -0,0 +1,149 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	prometheusv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"k8s.io/utils/pointer"
+
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+)
+
+func TestBuildEndpointStatuses_TruncationPolicy(t *testing.T) {
+	const pool = "PodMonitoring/gmp-test/prom-example-1/metrics"
+
+	// Targets with 3 timeouts, 1 refused connection, and 2 healthy targets.
+	var active []prometheusv1.ActiveTarget
+	for i, lastError := range []string{"timeout", "timeout", "refused", "timeout", "", ""} {
+		health := prometheusv1.HealthBad
+		if lastError == "" {
+			health = prometheusv1.HealthGood
+		}
+		active = append(active, prometheusv1.ActiveTarget{
+			ScrapePool: pool,
+			Health:     health,
+			LastError:  lastError,
+			Labels:     model.LabelSet{"instance": model.LabelValue(fmt.Sprint(i))},
+		})
+	}
+	targets := []*prometheusv1.TargetsResult{{Active: active}}
+
+	// groups returns the error and count of each sample group.
+	groups := func(status monitoringv1.ScrapeEndpointStatus) []string {
+		var res []string
+		for _, g := range status.SampleGroups {
+			e := "healthy"
+			if g.SampleTargets[0].LastError != nil {
+				e = *g.SampleTargets[0].LastError
+			}
+			res = append(res, fmt.Sprintf("%s=%d", e, *g.Count))
+		}
+		return res
+	}
+
+	testCases := []struct {
+		policy    monitoringv1.TruncationPolicy
+		maxGroups int32
+		want      []string
+	}{
+		{
+			policy: "",
+			want:   []string{"refused=1", "timeout=3", "healthy=2"},
+		},
+		{
+			policy:    monitoringv1.TruncationPolicySample,
+			maxGroups: 2,
+			want:      []string{"refused=1", "timeout=3"},
+		},
+		{
+			policy: monitoringv1.TruncationPolicyUnhealthyOnly,
+			want:   []string{"refused=1", "timeout=3"},
+		},
+		{
+			policy: monitoringv1.TruncationPolicyTopErrors,
+			want:   []string{"timeout=3", "refused=1"},
+		},
+		{
+			policy:    monitoringv1.TruncationPolicyTopErrors,
+			maxGroups: 1,
+			want:      []string{"timeout=3"},
+		},
+		{
+			policy: monitoringv1.TruncationPolicyCountsOnly,
+			want:   nil,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s-%d", tc.policy, tc.maxGroups), func(t *testing.T) {
+			endpointMap, err := BuildEndpointStatuses(targets, &monitoringv1.TargetStatusSpec{
+				TruncationPolicy: tc.policy,
+				MaxSampleGroups:  tc.maxGroups,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			statuses := endpointMap["PodMonitoring/gmp-test/prom-example-1"]
+			if len(statuses) != 1 {
+				t.Fatalf("expected 1 endpoint status, got %d", len(statuses))
+			}
+			if statuses[0].ActiveTargets != 6 || statuses[0].UnhealthyTargets != 4 {
+				t.Errorf("unexpected target counts %d/%d", statuses[0].UnhealthyTargets, statuses[0].ActiveTargets)
+			}
+			if diff := cmp.Diff(tc.want, groups(statuses[0])); diff != "" {
+				t.Errorf("unexpected sample groups (-want, +got): %s", diff)
+			}
+		})
+	}
+}
+
+func TestScrapeStatusCode(t *testing.T) {
+	testCases := []struct {
+		lastError string
+		want      *int32
+	}{
+		{"server returned HTTP status 503 Service Unavailable", pointer.Int32(503)},
+		{"server returned HTTP status 404 Not Found", pointer.Int32(404)},
+		{"Get \"http://10.0.0.1:8080/metrics\": context deadline exceeded", nil},
+		{"", nil},
+	}
+	for _, tc := range testCases {
+		if diff := cmp.Diff(tc.want, scrapeStatusCode(tc.lastError)); diff != "" {
+			t.Errorf("unexpected status code for %q (-want, +got): %s", tc.lastError, diff)
+		}
+	}
+}
+
+func TestSampleLimitsFromSpec(t *testing.T) {
+	testCases := []struct {
+		maxSampleTargets int32
+		want             int
+	}{
+		// Zero cannot be told apart from unset and applies the default.
+		{0, defaultMaxSampleTargets},
+		{1, 1},
+		{10, 10},
+	}
+	for _, tc := range testCases {
+		got := sampleLimitsFromSpec(&monitoringv1.TargetStatusSpec{MaxSampleTargets: tc.maxSampleTargets})
+		if got.maxTargets != tc.want {
+			t.Errorf("unexpected max targets for %d: want %d, got %d", tc.maxSampleTargets, tc.want, got.maxTargets)
+		}
+	}
+}
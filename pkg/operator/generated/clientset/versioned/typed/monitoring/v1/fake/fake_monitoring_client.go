@@ -30,6 +30,10 @@ func (c *FakeMonitoringV1) ClusterPodMonitorings() v1.ClusterPodMonitoringInterf
 	return &FakeClusterPodMonitorings{c}
 }
 
+func (c *FakeMonitoringV1) ClusterPodMonitoringTargetStatuses() v1.ClusterPodMonitoringTargetStatusInterface {
+	return &FakeClusterPodMonitoringTargetStatuses{c}
+}
+
 func (c *FakeMonitoringV1) ClusterRules() v1.ClusterRulesInterface {
 	return &FakeClusterRules{c}
 }
@@ -38,18 +42,34 @@ func (c *FakeMonitoringV1) GlobalRules() v1.GlobalRulesInterface {
 	return &FakeGlobalRules{c}
 }
 
+func (c *FakeMonitoringV1) MonitoringStatuses(namespace string) v1.MonitoringStatusInterface {
+	return &FakeMonitoringStatuses{c, namespace}
+}
+
 func (c *FakeMonitoringV1) OperatorConfigs(namespace string) v1.OperatorConfigInterface {
 	return &FakeOperatorConfigs{c, namespace}
 }
 
+func (c *FakeMonitoringV1) OperatorConfigTargetStatuses(namespace string) v1.OperatorConfigTargetStatusInterface {
+	return &FakeOperatorConfigTargetStatuses{c, namespace}
+}
+
 func (c *FakeMonitoringV1) PodMonitorings(namespace string) v1.PodMonitoringInterface {
 	return &FakePodMonitorings{c, namespace}
 }
 
+func (c *FakeMonitoringV1) PodMonitoringTargetStatuses(namespace string) v1.PodMonitoringTargetStatusInterface {
+	return &FakePodMonitoringTargetStatuses{c, namespace}
+}
+
 func (c *FakeMonitoringV1) Rules(namespace string) v1.RulesInterface {
 	return &FakeRules{c, namespace}
 }
 
+func (c *FakeMonitoringV1) Silences(namespace string) v1.SilenceInterface {
+	return &FakeSilences{c, namespace}
+}
+
 // RESTClient returns a RESTClient that is used to communicate
 // with API server by this client implementation.
 func (c *FakeMonitoringV1) RESTClient() rest.Interface {
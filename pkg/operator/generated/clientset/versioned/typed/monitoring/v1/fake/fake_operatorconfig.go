@@ -100,6 +100,18 @@ func (c *FakeOperatorConfigs) Update(ctx context.Context, operatorConfig *monito
 	return obj.(*monitoringv1.OperatorConfig), err
 }
 
+// UpdateStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+func (c *FakeOperatorConfigs) UpdateStatus(ctx context.Context, operatorConfig *monitoringv1.OperatorConfig, opts v1.UpdateOptions) (*monitoringv1.OperatorConfig, error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewUpdateSubresourceAction(operatorconfigsResource, "status", c.ns, operatorConfig), &monitoringv1.OperatorConfig{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*monitoringv1.OperatorConfig), err
+}
+
 // Delete takes name of the operatorConfig and deletes it. Returns an error if one occurs.
 func (c *FakeOperatorConfigs) Delete(ctx context.Context, name string, opts v1.DeleteOptions) error {
 	_, err := c.Fake.
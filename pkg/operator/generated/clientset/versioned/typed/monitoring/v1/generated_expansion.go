@@ -18,12 +18,22 @@ package v1
 
 type ClusterPodMonitoringExpansion interface{}
 
+type ClusterPodMonitoringTargetStatusExpansion interface{}
+
 type ClusterRulesExpansion interface{}
 
 type GlobalRulesExpansion interface{}
 
+type MonitoringStatusExpansion interface{}
+
 type OperatorConfigExpansion interface{}
 
+type OperatorConfigTargetStatusExpansion interface{}
+
 type PodMonitoringExpansion interface{}
 
+type PodMonitoringTargetStatusExpansion interface{}
+
 type RulesExpansion interface{}
+
+type SilenceExpansion interface{}
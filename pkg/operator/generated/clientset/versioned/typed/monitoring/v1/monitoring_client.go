@@ -27,11 +27,16 @@ import (
 type MonitoringV1Interface interface {
 	RESTClient() rest.Interface
 	ClusterPodMonitoringsGetter
+	ClusterPodMonitoringTargetStatusesGetter
 	ClusterRulesGetter
 	GlobalRulesGetter
+	MonitoringStatusesGetter
 	OperatorConfigsGetter
+	OperatorConfigTargetStatusesGetter
 	PodMonitoringsGetter
+	PodMonitoringTargetStatusesGetter
 	RulesGetter
+	SilencesGetter
 }
 
 // MonitoringV1Client is used to interact with features provided by the monitoring.googleapis.com group.
@@ -43,6 +48,10 @@ func (c *MonitoringV1Client) ClusterPodMonitorings() ClusterPodMonitoringInterfa
 	return newClusterPodMonitorings(c)
 }
 
+func (c *MonitoringV1Client) ClusterPodMonitoringTargetStatuses() ClusterPodMonitoringTargetStatusInterface {
+	return newClusterPodMonitoringTargetStatuses(c)
+}
+
 func (c *MonitoringV1Client) ClusterRules() ClusterRulesInterface {
 	return newClusterRules(c)
 }
@@ -51,18 +60,34 @@ func (c *MonitoringV1Client) GlobalRules() GlobalRulesInterface {
 	return newGlobalRules(c)
 }
 
+func (c *MonitoringV1Client) MonitoringStatuses(namespace string) MonitoringStatusInterface {
+	return newMonitoringStatuses(c, namespace)
+}
+
 func (c *MonitoringV1Client) OperatorConfigs(namespace string) OperatorConfigInterface {
 	return newOperatorConfigs(c, namespace)
 }
 
+func (c *MonitoringV1Client) OperatorConfigTargetStatuses(namespace string) OperatorConfigTargetStatusInterface {
+	return newOperatorConfigTargetStatuses(c, namespace)
+}
+
 func (c *MonitoringV1Client) PodMonitorings(namespace string) PodMonitoringInterface {
 	return newPodMonitorings(c, namespace)
 }
 
+func (c *MonitoringV1Client) PodMonitoringTargetStatuses(namespace string) PodMonitoringTargetStatusInterface {
+	return newPodMonitoringTargetStatuses(c, namespace)
+}
+
 func (c *MonitoringV1Client) Rules(namespace string) RulesInterface {
 	return newRules(c, namespace)
 }
 
+func (c *MonitoringV1Client) Silences(namespace string) SilenceInterface {
+	return newSilences(c, namespace)
+}
+
 // NewForConfig creates a new MonitoringV1Client for the given config.
 // NewForConfig is equivalent to NewForConfigAndClient(c, httpClient),
 // where httpClient was generated with rest.HTTPClientFor(c).
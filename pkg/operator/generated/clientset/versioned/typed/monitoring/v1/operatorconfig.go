@@ -38,6 +38,7 @@ type OperatorConfigsGetter interface {
 type OperatorConfigInterface interface {
 	Create(ctx context.Context, operatorConfig *v1.OperatorConfig, opts metav1.CreateOptions) (*v1.OperatorConfig, error)
 	Update(ctx context.Context, operatorConfig *v1.OperatorConfig, opts metav1.UpdateOptions) (*v1.OperatorConfig, error)
+	UpdateStatus(ctx context.Context, operatorConfig *v1.OperatorConfig, opts metav1.UpdateOptions) (*v1.OperatorConfig, error)
 	Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error
 	DeleteCollection(ctx context.Context, opts metav1.DeleteOptions, listOpts metav1.ListOptions) error
 	Get(ctx context.Context, name string, opts metav1.GetOptions) (*v1.OperatorConfig, error)
@@ -133,6 +134,22 @@ func (c *operatorConfigs) Update(ctx context.Context, operatorConfig *v1.Operato
 	return
 }
 
+// UpdateStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+func (c *operatorConfigs) UpdateStatus(ctx context.Context, operatorConfig *v1.OperatorConfig, opts metav1.UpdateOptions) (result *v1.OperatorConfig, err error) {
+	result = &v1.OperatorConfig{}
+	err = c.client.Put().
+		Namespace(c.ns).
+		Resource("operatorconfigs").
+		Name(operatorConfig.Name).
+		SubResource("status").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(operatorConfig).
+		Do(ctx).
+		Into(result)
+	return
+}
+
 // Delete takes name of the operatorConfig and deletes it. Returns an error if one occurs.
 func (c *operatorConfigs) Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error {
 	return c.client.Delete().
@@ -53,16 +53,26 @@ func (f *sharedInformerFactory) ForResource(resource schema.GroupVersionResource
 	// Group=monitoring.googleapis.com, Version=v1
 	case v1.SchemeGroupVersion.WithResource("clusterpodmonitorings"):
 		return &genericInformer{resource: resource.GroupResource(), informer: f.Monitoring().V1().ClusterPodMonitorings().Informer()}, nil
+	case v1.SchemeGroupVersion.WithResource("clusterpodmonitoringtargetstatuses"):
+		return &genericInformer{resource: resource.GroupResource(), informer: f.Monitoring().V1().ClusterPodMonitoringTargetStatuses().Informer()}, nil
 	case v1.SchemeGroupVersion.WithResource("clusterrules"):
 		return &genericInformer{resource: resource.GroupResource(), informer: f.Monitoring().V1().ClusterRules().Informer()}, nil
 	case v1.SchemeGroupVersion.WithResource("globalrules"):
 		return &genericInformer{resource: resource.GroupResource(), informer: f.Monitoring().V1().GlobalRules().Informer()}, nil
+	case v1.SchemeGroupVersion.WithResource("monitoringstatuses"):
+		return &genericInformer{resource: resource.GroupResource(), informer: f.Monitoring().V1().MonitoringStatuses().Informer()}, nil
 	case v1.SchemeGroupVersion.WithResource("operatorconfigs"):
 		return &genericInformer{resource: resource.GroupResource(), informer: f.Monitoring().V1().OperatorConfigs().Informer()}, nil
+	case v1.SchemeGroupVersion.WithResource("operatorconfigtargetstatuses"):
+		return &genericInformer{resource: resource.GroupResource(), informer: f.Monitoring().V1().OperatorConfigTargetStatuses().Informer()}, nil
 	case v1.SchemeGroupVersion.WithResource("podmonitorings"):
 		return &genericInformer{resource: resource.GroupResource(), informer: f.Monitoring().V1().PodMonitorings().Informer()}, nil
+	case v1.SchemeGroupVersion.WithResource("podmonitoringtargetstatuses"):
+		return &genericInformer{resource: resource.GroupResource(), informer: f.Monitoring().V1().PodMonitoringTargetStatuses().Informer()}, nil
 	case v1.SchemeGroupVersion.WithResource("rules"):
 		return &genericInformer{resource: resource.GroupResource(), informer: f.Monitoring().V1().Rules().Informer()}, nil
+	case v1.SchemeGroupVersion.WithResource("silences"):
+		return &genericInformer{resource: resource.GroupResource(), informer: f.Monitoring().V1().Silences().Informer()}, nil
 
 	}
 
@@ -24,16 +24,26 @@ import (
 type Interface interface {
 	// ClusterPodMonitorings returns a ClusterPodMonitoringInformer.
 	ClusterPodMonitorings() ClusterPodMonitoringInformer
+	// ClusterPodMonitoringTargetStatuses returns a ClusterPodMonitoringTargetStatusInformer.
+	ClusterPodMonitoringTargetStatuses() ClusterPodMonitoringTargetStatusInformer
 	// ClusterRules returns a ClusterRulesInformer.
 	ClusterRules() ClusterRulesInformer
 	// GlobalRules returns a GlobalRulesInformer.
 	GlobalRules() GlobalRulesInformer
+	// MonitoringStatuses returns a MonitoringStatusInformer.
+	MonitoringStatuses() MonitoringStatusInformer
 	// OperatorConfigs returns a OperatorConfigInformer.
 	OperatorConfigs() OperatorConfigInformer
+	// OperatorConfigTargetStatuses returns a OperatorConfigTargetStatusInformer.
+	OperatorConfigTargetStatuses() OperatorConfigTargetStatusInformer
 	// PodMonitorings returns a PodMonitoringInformer.
 	PodMonitorings() PodMonitoringInformer
+	// PodMonitoringTargetStatuses returns a PodMonitoringTargetStatusInformer.
+	PodMonitoringTargetStatuses() PodMonitoringTargetStatusInformer
 	// Rules returns a RulesInformer.
 	Rules() RulesInformer
+	// Silences returns a SilenceInformer.
+	Silences() SilenceInformer
 }
 
 type version struct {
@@ -52,6 +62,11 @@ func (v *version) ClusterPodMonitorings() ClusterPodMonitoringInformer {
 	return &clusterPodMonitoringInformer{factory: v.factory, tweakListOptions: v.tweakListOptions}
 }
 
+// ClusterPodMonitoringTargetStatuses returns a ClusterPodMonitoringTargetStatusInformer.
+func (v *version) ClusterPodMonitoringTargetStatuses() ClusterPodMonitoringTargetStatusInformer {
+	return &clusterPodMonitoringTargetStatusInformer{factory: v.factory, tweakListOptions: v.tweakListOptions}
+}
+
 // ClusterRules returns a ClusterRulesInformer.
 func (v *version) ClusterRules() ClusterRulesInformer {
 	return &clusterRulesInformer{factory: v.factory, tweakListOptions: v.tweakListOptions}
@@ -62,17 +77,37 @@ func (v *version) GlobalRules() GlobalRulesInformer {
 	return &globalRulesInformer{factory: v.factory, tweakListOptions: v.tweakListOptions}
 }
 
+// MonitoringStatuses returns a MonitoringStatusInformer.
+func (v *version) MonitoringStatuses() MonitoringStatusInformer {
+	return &monitoringStatusInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
+}
+
 // OperatorConfigs returns a OperatorConfigInformer.
 func (v *version) OperatorConfigs() OperatorConfigInformer {
 	return &operatorConfigInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
 }
 
+// OperatorConfigTargetStatuses returns a OperatorConfigTargetStatusInformer.
+func (v *version) OperatorConfigTargetStatuses() OperatorConfigTargetStatusInformer {
+	return &operatorConfigTargetStatusInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
+}
+
 // PodMonitorings returns a PodMonitoringInformer.
 func (v *version) PodMonitorings() PodMonitoringInformer {
 	return &podMonitoringInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
 }
 
+// PodMonitoringTargetStatuses returns a PodMonitoringTargetStatusInformer.
+func (v *version) PodMonitoringTargetStatuses() PodMonitoringTargetStatusInformer {
+	return &podMonitoringTargetStatusInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
+}
+
 // Rules returns a RulesInformer.
 func (v *version) Rules() RulesInformer {
 	return &rulesInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
 }
+
+// Silences returns a SilenceInformer.
+func (v *version) Silences() SilenceInformer {
+	return &silenceInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
+}
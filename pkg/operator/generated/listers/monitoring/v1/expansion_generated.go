@@ -20,6 +20,10 @@ package v1
 // ClusterPodMonitoringLister.
 type ClusterPodMonitoringListerExpansion interface{}
 
+// ClusterPodMonitoringTargetStatusListerExpansion allows custom methods to be added to
+// ClusterPodMonitoringTargetStatusLister.
+type ClusterPodMonitoringTargetStatusListerExpansion interface{}
+
 // ClusterRulesListerExpansion allows custom methods to be added to
 // ClusterRulesLister.
 type ClusterRulesListerExpansion interface{}
@@ -28,6 +32,14 @@ type ClusterRulesListerExpansion interface{}
 // GlobalRulesLister.
 type GlobalRulesListerExpansion interface{}
 
+// MonitoringStatusListerExpansion allows custom methods to be added to
+// MonitoringStatusLister.
+type MonitoringStatusListerExpansion interface{}
+
+// MonitoringStatusNamespaceListerExpansion allows custom methods to be added to
+// MonitoringStatusNamespaceLister.
+type MonitoringStatusNamespaceListerExpansion interface{}
+
 // OperatorConfigListerExpansion allows custom methods to be added to
 // OperatorConfigLister.
 type OperatorConfigListerExpansion interface{}
@@ -36,6 +48,14 @@ type OperatorConfigListerExpansion interface{}
 // OperatorConfigNamespaceLister.
 type OperatorConfigNamespaceListerExpansion interface{}
 
+// OperatorConfigTargetStatusListerExpansion allows custom methods to be added to
+// OperatorConfigTargetStatusLister.
+type OperatorConfigTargetStatusListerExpansion interface{}
+
+// OperatorConfigTargetStatusNamespaceListerExpansion allows custom methods to be added to
+// OperatorConfigTargetStatusNamespaceLister.
+type OperatorConfigTargetStatusNamespaceListerExpansion interface{}
+
 // PodMonitoringListerExpansion allows custom methods to be added to
 // PodMonitoringLister.
 type PodMonitoringListerExpansion interface{}
@@ -44,6 +64,14 @@ type PodMonitoringListerExpansion interface{}
 // PodMonitoringNamespaceLister.
 type PodMonitoringNamespaceListerExpansion interface{}
 
+// PodMonitoringTargetStatusListerExpansion allows custom methods to be added to
+// PodMonitoringTargetStatusLister.
+type PodMonitoringTargetStatusListerExpansion interface{}
+
+// PodMonitoringTargetStatusNamespaceListerExpansion allows custom methods to be added to
+// PodMonitoringTargetStatusNamespaceLister.
+type PodMonitoringTargetStatusNamespaceListerExpansion interface{}
+
 // RulesListerExpansion allows custom methods to be added to
 // RulesLister.
 type RulesListerExpansion interface{}
@@ -51,3 +79,11 @@ type RulesListerExpansion interface{}
 // RulesNamespaceListerExpansion allows custom methods to be added to
 // RulesNamespaceLister.
 type RulesNamespaceListerExpansion interface{}
+
+// SilenceListerExpansion allows custom methods to be added to
+// SilenceLister.
+type SilenceListerExpansion interface{}
+
+// SilenceNamespaceListerExpansion allows custom methods to be added to
+// SilenceNamespaceLister.
+type SilenceNamespaceListerExpansion interface{}
@@ -0,0 +1,306 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+)
+
+const (
+	// NameMonitoringStatus is the name of the MonitoringStatus singleton in the public namespace.
+	NameMonitoringStatus = "status"
+)
+
+func setupMonitoringStatusControllers(op *Operator) error {
+	// The singleton OperatorConfig is the request object we reconcile against.
+	objRequest := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Namespace: op.opts.PublicNamespace,
+			Name:      NameOperatorConfig,
+		},
+	}
+	// Default OperatorConfig filter.
+	objFilterOperatorConfig := namespacedNamePredicate{
+		namespace: op.opts.PublicNamespace,
+		name:      NameOperatorConfig,
+	}
+	// MonitoringStatus singleton filter.
+	objFilterMonitoringStatus := namespacedNamePredicate{
+		namespace: op.opts.PublicNamespace,
+		name:      NameMonitoringStatus,
+	}
+	// Generated collector, rule-evaluator, and rules configuration filter.
+	rulesShard := rulesShardFilter(op.opts.OperatorNamespace)
+	objFilterGeneratedConfig := predicate.NewPredicateFuncs(func(object client.Object) bool {
+		if object.GetNamespace() == op.opts.OperatorNamespace && (object.GetName() == NameCollector || object.GetName() == NameRuleEvaluator) {
+			return true
+		}
+		return rulesShard(object)
+	})
+	// Collector DaemonSet filter.
+	objFilterCollector := namespacedNamePredicate{
+		namespace: op.opts.OperatorNamespace,
+		name:      NameCollector,
+	}
+	// Rule-evaluator Deployment filter.
+	objFilterRuleEvaluator := namespacedNamePredicate{
+		namespace: op.opts.OperatorNamespace,
+		name:      NameRuleEvaluator,
+	}
+
+	err := ctrl.NewControllerManagedBy(op.manager).
+		Named("monitoring-status").
+		// Filter events without changes for all watches.
+		WithEventFilter(predicate.ResourceVersionChangedPredicate{}).
+		For(
+			&monitoringv1.OperatorConfig{},
+			builder.WithPredicates(objFilterOperatorConfig),
+		).
+		// Restore the singleton if it was modified or deleted.
+		Watches(
+			&source.Kind{Type: &monitoringv1.MonitoringStatus{}},
+			enqueueConst(objRequest),
+			builder.WithPredicates(objFilterMonitoringStatus),
+		).
+		Watches(
+			&source.Kind{Type: &corev1.ConfigMap{}},
+			enqueueConst(objRequest),
+			builder.WithPredicates(objFilterGeneratedConfig),
+		).
+		Watches(
+			&source.Kind{Type: &appsv1.DaemonSet{}},
+			enqueueConst(objRequest),
+			builder.WithPredicates(objFilterCollector),
+		).
+		Watches(
+			&source.Kind{Type: &appsv1.Deployment{}},
+			enqueueConst(objRequest),
+			builder.WithPredicates(objFilterRuleEvaluator),
+		).
+		Complete(newMonitoringStatusReconciler(op.manager.GetClient(), op.opts))
+	if err != nil {
+		return fmt.Errorf("create monitoring status controller: %w", err)
+	}
+	return nil
+}
+
+// monitoringStatusReconciler maintains the MonitoringStatus singleton.
+type monitoringStatusReconciler struct {
+	client client.Client
+	opts   Options
+}
+
+func newMonitoringStatusReconciler(c client.Client, opts Options) *monitoringStatusReconciler {
+	return &monitoringStatusReconciler{
+		client: c,
+		opts:   opts,
+	}
+}
+
+func (r *monitoringStatusReconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	logger, _ := logr.FromContext(ctx)
+	logger.Info("reconciling monitoring status")
+
+	status, err := r.buildStatus(ctx)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	var obj monitoringv1.MonitoringStatus
+	key := types.NamespacedName{Namespace: r.opts.PublicNamespace, Name: NameMonitoringStatus}
+	if err := r.client.Get(ctx, key, &obj); apierrors.IsNotFound(err) {
+		obj = monitoringv1.MonitoringStatus{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: key.Namespace,
+				Name:      key.Name,
+			},
+		}
+		if err := r.client.Create(ctx, &obj); err != nil {
+			return reconcile.Result{}, fmt.Errorf("create monitoring status: %w", err)
+		}
+	} else if err != nil {
+		return reconcile.Result{}, fmt.Errorf("get monitoring status: %w", err)
+	}
+	if equality.Semantic.DeepEqual(obj.Status, *status) {
+		return reconcile.Result{}, nil
+	}
+	obj.Status = *status
+	if err := r.client.Status().Update(ctx, &obj); err != nil {
+		return reconcile.Result{}, fmt.Errorf("update monitoring status: %w", err)
+	}
+	return reconcile.Result{}, nil
+}
+
+// buildStatus collects the current state of the generated configuration and
+// the managed workloads.
+func (r *monitoringStatusReconciler) buildStatus(ctx context.Context) (*monitoringv1.MonitoringStatusStatus, error) {
+	status := &monitoringv1.MonitoringStatusStatus{}
+
+	// Collector configuration and rollout.
+	var collectorConfig corev1.ConfigMap
+	err := r.client.Get(ctx, types.NamespacedName{Namespace: r.opts.OperatorNamespace, Name: NameCollector}, &collectorConfig)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("get collector config: %w", err)
+	} else if err == nil {
+		status.Collection.ConfigHash, status.Collection.ConfigFiles = hashConfigMaps(collectorConfig)
+	}
+	// The collector and rule-evaluator configs are written last by their reconcilers and
+	// record the OperatorConfig generation that was applied. The lower one is reported.
+	var ruleEvaluatorConfig corev1.ConfigMap
+	err = r.client.Get(ctx, types.NamespacedName{Namespace: r.opts.OperatorNamespace, Name: NameRuleEvaluator}, &ruleEvaluatorConfig)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("get rule-evaluator config: %w", err)
+	}
+	collectionGeneration := operatorConfigGeneration(&collectorConfig)
+	rulesGeneration := operatorConfigGeneration(&ruleEvaluatorConfig)
+	if collectionGeneration < rulesGeneration {
+		status.OperatorConfigGeneration = collectionGeneration
+	} else {
+		status.OperatorConfigGeneration = rulesGeneration
+	}
+	var ds appsv1.DaemonSet
+	err = r.client.Get(ctx, types.NamespacedName{Namespace: r.opts.OperatorNamespace, Name: NameCollector}, &ds)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("get collector DaemonSet: %w", err)
+	} else if err == nil {
+		status.Collection.Rollout = daemonSetRollout(&ds)
+	}
+
+	// Rule-evaluator configuration and rollout.
+	var cms corev1.ConfigMapList
+	if err := r.client.List(ctx, &cms, client.InNamespace(r.opts.OperatorNamespace)); err != nil {
+		return nil, fmt.Errorf("list generated rules: %w", err)
+	}
+	var rulesConfigs []corev1.ConfigMap
+	filter := rulesShardFilter(r.opts.OperatorNamespace)
+	for _, cm := range cms.Items {
+		if filter(&cm) {
+			rulesConfigs = append(rulesConfigs, cm)
+		}
+	}
+	if len(rulesConfigs) > 0 {
+		status.Rules.ConfigHash, status.Rules.ConfigFiles = hashConfigMaps(rulesConfigs...)
+	}
+	var deploy appsv1.Deployment
+	err = r.client.Get(ctx, types.NamespacedName{Namespace: r.opts.OperatorNamespace, Name: NameRuleEvaluator}, &deploy)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("get rule-evaluator Deployment: %w", err)
+	} else if err == nil {
+		status.Rules.Rollout = deploymentRollout(&deploy)
+	}
+
+	status.Converged = rolloutComplete(status.Collection.Rollout) && rolloutComplete(status.Rules.Rollout)
+	return status, nil
+}
+
+// setOperatorConfigGeneration records the OperatorConfig generation a generated config
+// was applied for.
+func setOperatorConfigGeneration(cm *corev1.ConfigMap, generation int64) {
+	if cm.Annotations == nil {
+		cm.Annotations = map[string]string{}
+	}
+	cm.Annotations[AnnotationOperatorConfigGeneration] = strconv.FormatInt(generation, 10)
+}
+
+// operatorConfigGeneration returns the OperatorConfig generation a generated config was
+// applied for, or 0 if it is unknown.
+func operatorConfigGeneration(cm *corev1.ConfigMap) int64 {
+	generation, err := strconv.ParseInt(cm.Annotations[AnnotationOperatorConfigGeneration], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return generation
+}
+
+// hashConfigMaps returns a hash over the data of all ConfigMaps and the total number of
+// files they contain. Files are hashed in order of their names.
+func hashConfigMaps(cms ...corev1.ConfigMap) (string, int32) {
+	files := map[string][]byte{}
+	for _, cm := range cms {
+		for k, v := range cm.Data {
+			files[k] = []byte(v)
+		}
+		for k, v := range cm.BinaryData {
+			files[k] = v
+		}
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	h := sha256.New()
+	for _, name := range names {
+		fmt.Fprintf(h, "%s\x00%d\x00", name, len(files[name]))
+		h.Write(files[name])
+	}
+	return hex.EncodeToString(h.Sum(nil)), int32(len(names))
+}
+
+func daemonSetRollout(ds *appsv1.DaemonSet) *monitoringv1.RolloutState {
+	s := &monitoringv1.RolloutState{
+		Generation:         ds.Generation,
+		ObservedGeneration: ds.Status.ObservedGeneration,
+		Desired:            ds.Status.DesiredNumberScheduled,
+		Updated:            ds.Status.UpdatedNumberScheduled,
+		Ready:              ds.Status.NumberReady,
+	}
+	s.Complete = s.ObservedGeneration >= s.Generation && s.Updated == s.Desired && s.Ready == s.Desired
+	return s
+}
+
+func deploymentRollout(deploy *appsv1.Deployment) *monitoringv1.RolloutState {
+	s := &monitoringv1.RolloutState{
+		Generation:         deploy.Generation,
+		ObservedGeneration: deploy.Status.ObservedGeneration,
+		// Replicas default to 1 if unset.
+		Desired: 1,
+		Updated: deploy.Status.UpdatedReplicas,
+		Ready:   deploy.Status.ReadyReplicas,
+	}
+	if deploy.Spec.Replicas != nil {
+		s.Desired = *deploy.Spec.Replicas
+	}
+	s.Complete = s.ObservedGeneration >= s.Generation && s.Updated == s.Desired && s.Ready == s.Desired
+	return s
+}
+
+// rolloutComplete returns true if the rollout is complete. Workloads that do not exist,
+// for example because users deliberately removed them, do not block convergence.
+func rolloutComplete(s *monitoringv1.RolloutState) bool {
+	return s == nil || s.Complete
+}
@@ -0,0 +1,168 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/testr"
+	"github.com/google/go-cmp/cmp"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+)
+
+func TestMonitoringStatusReconciler(t *testing.T) {
+	ctx := logr.NewContext(context.Background(), testr.New(t))
+	scheme, err := NewScheme()
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := Options{
+		OperatorNamespace: "gmp-system",
+		PublicNamespace:   "gmp-public",
+	}
+	// The latest OperatorConfig generation is not applied yet.
+	config := &monitoringv1.OperatorConfig{
+		ObjectMeta: metav1.ObjectMeta{Namespace: opts.PublicNamespace, Name: NameOperatorConfig, Generation: 4},
+	}
+	collectorConfig := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: opts.OperatorNamespace, Name: NameCollector},
+		Data:       map[string]string{configFilename: "global: {}"},
+	}
+	setOperatorConfigGeneration(collectorConfig, 3)
+	ruleEvaluatorConfig := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: opts.OperatorNamespace, Name: NameRuleEvaluator},
+		Data:       map[string]string{configFilename: "global: {}"},
+	}
+	setOperatorConfigGeneration(ruleEvaluatorConfig, 2)
+	rulesConfig := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: opts.OperatorNamespace, Name: nameRulesGenerated},
+		Data:       map[string]string{"empty.yaml": "", "rules__ns__a.yaml": "groups: []"},
+	}
+	ds := &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: opts.OperatorNamespace, Name: NameCollector, Generation: 2},
+		Status: appsv1.DaemonSetStatus{
+			ObservedGeneration:     2,
+			DesiredNumberScheduled: 3,
+			UpdatedNumberScheduled: 3,
+			NumberReady:            3,
+		},
+	}
+	deploy := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: opts.OperatorNamespace, Name: NameRuleEvaluator, Generation: 5},
+		Spec:       appsv1.DeploymentSpec{Replicas: pointer.Int32(2)},
+		Status: appsv1.DeploymentStatus{
+			ObservedGeneration: 5,
+			UpdatedReplicas:    1,
+			ReadyReplicas:      2,
+		},
+	}
+	kubeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(config, collectorConfig, ruleEvaluatorConfig, rulesConfig, ds, deploy).
+		Build()
+
+	r := newMonitoringStatusReconciler(kubeClient, opts)
+	reconcileAndGet := func() monitoringv1.MonitoringStatusStatus {
+		t.Helper()
+		req := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: opts.PublicNamespace, Name: NameOperatorConfig}}
+		if _, err := r.Reconcile(ctx, req); err != nil {
+			t.Fatal(err)
+		}
+		var obj monitoringv1.MonitoringStatus
+		if err := kubeClient.Get(ctx, types.NamespacedName{Namespace: opts.PublicNamespace, Name: NameMonitoringStatus}, &obj); err != nil {
+			t.Fatal(err)
+		}
+		return obj.Status
+	}
+
+	collectorHash, _ := hashConfigMaps(*collectorConfig)
+	rulesHash, _ := hashConfigMaps(*rulesConfig)
+	want := monitoringv1.MonitoringStatusStatus{
+		// The lower of the generations applied by the collection and rules reconcilers.
+		OperatorConfigGeneration: 2,
+		Collection: monitoringv1.ComponentState{
+			ConfigHash:  collectorHash,
+			ConfigFiles: 1,
+			Rollout: &monitoringv1.RolloutState{
+				Generation:         2,
+				ObservedGeneration: 2,
+				Desired:            3,
+				Updated:            3,
+				Ready:              3,
+				Complete:           true,
+			},
+		},
+		Rules: monitoringv1.ComponentState{
+			ConfigHash:  rulesHash,
+			ConfigFiles: 2,
+			Rollout: &monitoringv1.RolloutState{
+				Generation:         5,
+				ObservedGeneration: 5,
+				Desired:            2,
+				Updated:            1,
+				Ready:              2,
+				Complete:           false,
+			},
+		},
+		Converged: false,
+	}
+	if diff := cmp.Diff(want, reconcileAndGet()); diff != "" {
+		t.Fatalf("unexpected status (-want, +got): %s", diff)
+	}
+
+	// Apply the OperatorConfig for rules and complete the rule-evaluator rollout.
+	setOperatorConfigGeneration(ruleEvaluatorConfig, 4)
+	if err := kubeClient.Update(ctx, ruleEvaluatorConfig); err != nil {
+		t.Fatal(err)
+	}
+	deploy.Status.UpdatedReplicas = 2
+	if err := kubeClient.Status().Update(ctx, deploy); err != nil {
+		t.Fatal(err)
+	}
+	want.OperatorConfigGeneration = 3
+	want.Rules.Rollout.Updated = 2
+	want.Rules.Rollout.Complete = true
+	want.Converged = true
+	if diff := cmp.Diff(want, reconcileAndGet()); diff != "" {
+		t.Fatalf("unexpected status (-want, +got): %s", diff)
+	}
+}
+
+func TestHashConfigMaps(t *testing.T) {
+	a := corev1.ConfigMap{Data: map[string]string{"a.yaml": "foo"}}
+	b := corev1.ConfigMap{Data: map[string]string{"b.yaml": "bar"}}
+	combined := corev1.ConfigMap{Data: map[string]string{"a.yaml": "foo", "b.yaml": "bar"}}
+
+	h1, n1 := hashConfigMaps(a, b)
+	h2, n2 := hashConfigMaps(combined)
+	if h1 != h2 || n1 != 2 || n2 != 2 {
+		t.Errorf("expected equal hashes for the same files but got %s (%d) and %s (%d)", h1, n1, h2, n2)
+	}
+	// Moving content between files must change the hash.
+	h3, _ := hashConfigMaps(corev1.ConfigMap{Data: map[string]string{"a.yaml": "foob", "b.yaml": "ar"}})
+	if h1 == h3 {
+		t.Errorf("expected different hashes")
+	}
+}
@@ -13,6 +13,19 @@
 // limitations under the License.
 
 // Package operator contains the Prometheus operator.
+//
+// Besides running the operator through New and Run, the package exposes the
+// transformations the reconcilers apply as functions that do not access the
+// Kubernetes API. They take custom resources as input and return the rendered
+// configuration or status, so that other controllers and test harnesses can
+// reuse them:
+//
+//   - GenerateCollectorConfig renders the collector Prometheus configuration from
+//     the OperatorConfig and all PodMonitorings and ClusterPodMonitorings.
+//   - BuildEndpointStatuses builds the target status of PodMonitorings and
+//     ClusterPodMonitorings from the targets of the collectors.
+//   - GenerateRules, GenerateClusterRules and GenerateGlobalRules render scoped
+//     rule files for the rule-evaluator.
 package operator
 
 import (
@@ -38,6 +51,7 @@ import (
 	runtimeutil "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
 	"k8s.io/client-go/util/cert"
 	"k8s.io/client-go/util/workqueue"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -60,6 +74,8 @@ const (
 
 	// NameOperator is a fixed name used in various resources managed by the operator.
 	NameOperator = "gmp-operator"
+	// nameLeaderElection is the name of the Lease used for leader election among operator replicas.
+	nameLeaderElection = "gmp-operator-leader"
 	// componentName is a fixed name used in various resources managed by the operator.
 	componentName = "managed_prometheus"
 
@@ -70,6 +86,18 @@ const (
 	LabelAppName = "app.kubernetes.io/name"
 	// AnnotationMetricName is the component name, will be exposed as metric name.
 	AnnotationMetricName = "components.gke.io/component-name"
+	// AnnotationExportOnly is the PodMonitoring annotation that restricts the exported
+	// metrics of its job to the given comma-separated list of metric names.
+	AnnotationExportOnly = "monitoring.googleapis.com/export-only"
+	// AnnotationStatus is the PodMonitoring and ClusterPodMonitoring annotation that
+	// excludes the resource from target status updates if set to "disabled".
+	AnnotationStatus = "monitoring.googleapis.com/status"
+	// AnnotationRefreshStatus is the PodMonitoring and ClusterPodMonitoring annotation
+	// that triggers an on-demand target status poll whenever its value changes.
+	AnnotationRefreshStatus = "monitoring.googleapis.com/refresh-status"
+	// AnnotationOperatorConfigGeneration is the annotation of the generated collector and
+	// rule-evaluator configs that holds the OperatorConfig generation they were applied for.
+	AnnotationOperatorConfigGeneration = "monitoring.googleapis.com/operator-config-generation"
 	// ClusterAutoscalerSafeEvictionLabel is the annotation label that determines
 	// whether the cluster autoscaler can safely evict a Pod when the Pod doesn't
 	// satisfy certain eviction criteria.
@@ -84,6 +112,8 @@ const (
 
 	// The level of concurrency to use to fetch all targets.
 	defaultTargetPollConcurrency = 4
+	// The number of requests per second to write target status with.
+	defaultTargetStatusQPS = 10
 )
 
 // Operator to implement managed collection for Google Prometheus Engine.
@@ -97,6 +127,9 @@ type Operator struct {
 	// resource from multiple namespaces (not to be confused with cluster-wide
 	// resources).
 	managedNamespacesCache cache.Cache
+	// Certificate authority of the collector serving certificates in PEM format,
+	// if collectors serve over TLS.
+	collectorCA []byte
 }
 
 // Options for the Operator.
@@ -125,6 +158,21 @@ type Options struct {
 	// The number of upper bound threads to use for target polling otherwise
 	// use the default.
 	TargetPollConcurrency uint16
+	// The maximum number of requests per second to write target status with,
+	// otherwise use the default.
+	TargetStatusQPS float64
+	// Elect a leader among operator replicas. Only the leader runs the controllers,
+	// including target status polling, while all replicas serve webhooks.
+	LeaderElection bool
+	// Make the collectors serve over HTTPS with a certificate provisioned and renewed
+	// by the operator, and fetch the target status from them over HTTPS.
+	CollectorTLS bool
+	// Server name the collector certificates are issued for and verified against, as
+	// collectors are addressed by pod IP. Defaults to collector.<OperatorNamespace>.svc.
+	CollectorTLSServerName string
+	// File holding a bearer token to authenticate target status requests to
+	// collectors. It is read on every request so that the token can be rotated.
+	CollectorAuthTokenFile string
 }
 
 func (o *Options) defaultAndValidate(logger logr.Logger) error {
@@ -150,6 +198,15 @@ func (o *Options) defaultAndValidate(logger logr.Logger) error {
 	if o.TargetPollConcurrency == 0 {
 		o.TargetPollConcurrency = defaultTargetPollConcurrency
 	}
+	if o.TargetStatusQPS <= 0 {
+		o.TargetStatusQPS = defaultTargetStatusQPS
+	}
+	if o.CollectorTLSServerName != "" && !o.CollectorTLS {
+		return errors.New("CollectorTLSServerName requires CollectorTLS")
+	}
+	if o.CollectorTLS && o.CollectorTLSServerName == "" {
+		o.CollectorTLSServerName = fmt.Sprintf("%s.%s.svc", NameCollector, o.OperatorNamespace)
+	}
 	return nil
 }
 
@@ -196,6 +253,13 @@ func New(logger logr.Logger, clientConfig *rest.Config, opts Options) (*Operator
 		// Don't run a metrics server with the manager. Metrics are being served
 		// explicitly in the main routine.
 		MetricsBindAddress: "0",
+		// Leader election is required to run multiple replicas without concurrent
+		// reconciliation and target status polling.
+		LeaderElection:                opts.LeaderElection,
+		LeaderElectionID:              nameLeaderElection,
+		LeaderElectionNamespace:       opts.OperatorNamespace,
+		LeaderElectionResourceLock:    resourcelock.LeasesResourceLock,
+		LeaderElectionReleaseOnCancel: true,
 		// Manage cluster-wide and namespace resources at the same time.
 		NewCache: cache.NewCacheFunc(func(config *rest.Config, options cache.Options) (cache.Cache, error) {
 			return cache.New(clientConfig, cache.Options{
@@ -212,6 +276,12 @@ func New(logger logr.Logger, clientConfig *rest.Config, opts Options) (*Operator
 					&monitoringv1.ClusterPodMonitoring{}: {
 						Field: fields.Everything(),
 					},
+					&monitoringv1.PodMonitoringTargetStatus{}: {
+						Field: fields.Everything(),
+					},
+					&monitoringv1.ClusterPodMonitoringTargetStatus{}: {
+						Field: fields.Everything(),
+					},
 					&monitoringv1.GlobalRules{}: {
 						Field: fields.Everything(),
 					},
@@ -221,6 +291,9 @@ func New(logger logr.Logger, clientConfig *rest.Config, opts Options) (*Operator
 					&monitoringv1.Rules{}: {
 						Field: fields.Everything(),
 					},
+					&monitoringv1.Silence{}: {
+						Field: fields.Everything(),
+					},
 					&corev1.Secret{}: {
 						// We can only have 1 namespace specified here. While we
 						// need to access secrets from multiple namespaces, we
@@ -233,6 +306,12 @@ func New(logger logr.Logger, clientConfig *rest.Config, opts Options) (*Operator
 					&monitoringv1.OperatorConfig{}: {
 						Field: fields.SelectorFromSet(fields.Set{"metadata.namespace": opts.PublicNamespace}),
 					},
+					&monitoringv1.OperatorConfigTargetStatus{}: {
+						Field: fields.SelectorFromSet(fields.Set{"metadata.namespace": opts.PublicNamespace}),
+					},
+					&monitoringv1.MonitoringStatus{}: {
+						Field: fields.SelectorFromSet(fields.Set{"metadata.namespace": opts.PublicNamespace}),
+					},
 					&corev1.Service{}: {
 						Field: fields.SelectorFromSet(fields.Set{
 							"metadata.namespace": opts.OperatorNamespace,
@@ -353,6 +432,10 @@ func (o *Operator) setupAdmissionWebhooks(ctx context.Context) error {
 		validatePath(monitoringv1.GlobalRulesResource()),
 		admission.WithCustomValidator(&monitoringv1.GlobalRules{}, &globalRulesValidator{}),
 	)
+	s.Register(
+		validatePath(monitoringv1.SilenceResource()),
+		admission.WithCustomValidator(&monitoringv1.Silence{}, &silenceValidator{}),
+	)
 	// Defaulting webhooks.
 	s.Register(
 		defaultPath(monitoringv1.PodMonitoringResource()),
@@ -386,9 +469,18 @@ func (o *Operator) Run(ctx context.Context, registry prometheus.Registerer) erro
 	if err := setupOperatorConfigControllers(o); err != nil {
 		return fmt.Errorf("setup rule-evaluator controllers: %w", err)
 	}
+	if err := setupCollectorTLS(ctx, o); err != nil {
+		return fmt.Errorf("setup collector TLS: %w", err)
+	}
 	if err := setupTargetStatusPoller(o, registry); err != nil {
 		return fmt.Errorf("setup target status processor: %w", err)
 	}
+	if err := setupSilenceControllers(o); err != nil {
+		return fmt.Errorf("setup silence controllers: %w", err)
+	}
+	if err := setupMonitoringStatusControllers(o); err != nil {
+		return fmt.Errorf("setup monitoring status controllers: %w", err)
+	}
 
 	o.logger.Info("starting GMP operator")
 
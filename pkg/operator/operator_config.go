@@ -16,6 +16,8 @@ package operator
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"net/url"
@@ -36,10 +38,13 @@ import (
 	yaml "gopkg.in/yaml.v3"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -61,11 +66,15 @@ const (
 const (
 	RulesSecretName              = "rules"
 	CollectionSecretName         = "collection"
+	CollectorTLSSecretName       = "collector-tls"
+	RuleEvaluatorHASecretName    = "rule-evaluator-ha"
 	AlertmanagerSecretName       = "alertmanager"
 	AlertmanagerPublicSecretName = "alertmanager"
 	AlertmanagerPublicSecretKey  = "alertmanager.yaml"
 	rulesDir                     = "/etc/rules"
 	secretsDir                   = "/etc/secrets"
+	collectorTLSDir              = "/etc/collector-tls"
+	ruleEvaluatorHADir           = "/etc/rule-evaluator-ha"
 	alertmanagerConfigKey        = "config.yaml"
 )
 
@@ -213,11 +222,11 @@ func (r *operatorConfigReconciler) Reconcile(ctx context.Context, req reconcile.
 	} else if err != nil {
 		return reconcile.Result{}, fmt.Errorf("get operatorconfig for incoming: %q: %w", req.String(), err)
 	}
-	// Ensure the rule-evaluator config and grab any to-be-mirrored
+	// Generate the rule-evaluator config and grab any to-be-mirrored
 	// secret data on the way.
-	secretData, err := r.ensureRuleEvaluatorConfig(ctx, &config.Rules)
+	cfg, secretData, err := r.makeRuleEvaluatorConfig(ctx, &config.Rules)
 	if err != nil {
-		return reconcile.Result{}, fmt.Errorf("ensure rule-evaluator config: %w", err)
+		return reconcile.Result{}, fmt.Errorf("make rule-evaluator configmap: %w", err)
 	}
 
 	if err := r.ensureAlertmanagerConfigSecret(ctx, config.ManagedAlertmanager); err != nil {
@@ -231,29 +240,39 @@ func (r *operatorConfigReconciler) Reconcile(ctx context.Context, req reconcile.
 	}
 
 	// Ensure the rule-evaluator deployment and volume mounts.
-	if err := r.ensureRuleEvaluatorDeployment(ctx, &config.Rules); err != nil {
+	if err := r.ensureRuleEvaluatorDeployment(ctx, &config.Rules, &config.Endpoints); err != nil {
 		return reconcile.Result{}, fmt.Errorf("ensure rule-evaluator deploy: %w", err)
 	}
+	if err := r.ensureRuleEvaluatorPodDisruptionBudget(ctx, &config.Rules); err != nil {
+		return reconcile.Result{}, fmt.Errorf("ensure rule-evaluator pdb: %w", err)
+	}
+	if err := r.ensureRuleEvaluatorService(ctx, &config.Rules); err != nil {
+		return reconcile.Result{}, fmt.Errorf("ensure rule-evaluator service: %w", err)
+	}
+
+	// Write the config last so that it only records the OperatorConfig generation once
+	// everything else was applied.
+	if err := r.ensureRuleEvaluatorConfig(ctx, cfg, config.Generation); err != nil {
+		return reconcile.Result{}, fmt.Errorf("ensure rule-evaluator config: %w", err)
+	}
 
 	return reconcile.Result{}, nil
 }
 
-// ensureRuleEvaluatorConfig reconciles the config for rule-evaluator.
-func (r *operatorConfigReconciler) ensureRuleEvaluatorConfig(ctx context.Context, spec *monitoringv1.RuleEvaluatorSpec) (map[string][]byte, error) {
-	cfg, secretData, err := r.makeRuleEvaluatorConfig(ctx, spec)
-	if err != nil {
-		return nil, fmt.Errorf("make rule-evaluator configmap: %w", err)
-	}
+// ensureRuleEvaluatorConfig reconciles the config for rule-evaluator and records the
+// OperatorConfig generation it was applied for.
+func (r *operatorConfigReconciler) ensureRuleEvaluatorConfig(ctx context.Context, cfg *corev1.ConfigMap, generation int64) error {
+	setOperatorConfigGeneration(cfg, generation)
 
 	// Upsert rule-evaluator config.
 	if err := r.client.Update(ctx, cfg); apierrors.IsNotFound(err) {
 		if err := r.client.Create(ctx, cfg); err != nil {
-			return nil, fmt.Errorf("create rule-evaluator config: %w", err)
+			return fmt.Errorf("create rule-evaluator config: %w", err)
 		}
 	} else if err != nil {
-		return nil, fmt.Errorf("update rule-evaluator config: %w", err)
+		return fmt.Errorf("update rule-evaluator config: %w", err)
 	}
-	return secretData, nil
+	return nil
 }
 
 // makeRuleEvaluatorConfig creates the config for rule-evaluator.
@@ -383,8 +402,19 @@ func (r *operatorConfigReconciler) ensureAlertmanagerConfigSecret(ctx context.Co
 	return nil
 }
 
+const (
+	// ruleEvaluatorHAReplicas is the number of rule-evaluator replicas if high availability
+	// is enabled.
+	ruleEvaluatorHAReplicas = 2
+	// Port of the rule-evaluator web endpoint. It matches the --web.listen-address of the
+	// rule-evaluator Deployment.
+	ruleEvaluatorPort = 19092
+	// Key of the token the rule-evaluator replicas authenticate to each other with.
+	ruleEvaluatorHATokenKey = "token"
+)
+
 // ensureRuleEvaluatorDeployment reconciles the Deployment for rule-evaluator.
-func (r *operatorConfigReconciler) ensureRuleEvaluatorDeployment(ctx context.Context, spec *monitoringv1.RuleEvaluatorSpec) error {
+func (r *operatorConfigReconciler) ensureRuleEvaluatorDeployment(ctx context.Context, spec *monitoringv1.RuleEvaluatorSpec, endpoints *monitoringv1.APIEndpoints) error {
 	logger, _ := logr.FromContext(ctx)
 
 	var deploy appsv1.Deployment
@@ -414,6 +444,22 @@ func (r *operatorConfigReconciler) ensureRuleEvaluatorDeployment(ctx context.Con
 		queryProjectID = spec.QueryProjectID
 	}
 	flags = append(flags, fmt.Sprintf("--query.project-id=%q", queryProjectID))
+	for _, p := range spec.FanOutProjectIDs {
+		flags = append(flags, fmt.Sprintf("--query.fan-out-project-id=%q", p))
+	}
+
+	endpointFlags, err := exportEndpointFlags(endpoints)
+	if err != nil {
+		return fmt.Errorf("build export endpoint flags: %w", err)
+	}
+	flags = append(flags, endpointFlags...)
+	targetURL, err := queryTargetURL(endpoints, queryProjectID)
+	if err != nil {
+		return fmt.Errorf("build query target URL: %w", err)
+	}
+	if targetURL != "" {
+		flags = append(flags, fmt.Sprintf("--query.target-url=%q", targetURL))
+	}
 
 	if spec.Credentials != nil {
 		p := path.Join(secretsDir, pathForSelector(r.opts.PublicNamespace, &monitoringv1.SecretOrConfigMap{Secret: spec.Credentials}))
@@ -423,6 +469,48 @@ func (r *operatorConfigReconciler) ensureRuleEvaluatorDeployment(ctx context.Con
 	if spec.GeneratorURL != "" {
 		flags = append(flags, fmt.Sprintf("--query.generator-url=%q", spec.GeneratorURL))
 	}
+	if spec.HighAvailability {
+		// Both replicas send the same alerts, which Alertmanager deduplicates as the
+		// replicas have identical external labels. Recording rule results of both
+		// replicas would conflict in GCM, so only the holder of the lease writes them.
+		flags = append(flags,
+			"--export.ha.backend=kube",
+			fmt.Sprintf("--export.ha.kube.namespace=%q", r.opts.OperatorNamespace),
+			fmt.Sprintf("--export.ha.kube.name=%q", NameRuleEvaluator),
+		)
+		// The replicas sync their alerting state through the headless Service, as they
+		// don't have stable names.
+		if err := r.ensureRuleEvaluatorHASecret(ctx); err != nil {
+			return err
+		}
+		flags = append(flags,
+			fmt.Sprintf("--ha.peer-url=%q", fmt.Sprintf("http://%s.%s.svc:%d", NameRuleEvaluator, r.opts.OperatorNamespace, ruleEvaluatorPort)),
+			fmt.Sprintf("--ha.auth-token-file=%q", path.Join(ruleEvaluatorHADir, ruleEvaluatorHATokenKey)),
+		)
+		replicas := int32(ruleEvaluatorHAReplicas)
+		deploy.Spec.Replicas = &replicas
+
+		// Spread the replicas across nodes, so that a single node failure does not take
+		// down both. Anti-affinity that was set on the Deployment otherwise is kept.
+		podSpec := &deploy.Spec.Template.Spec
+		if podSpec.Affinity == nil {
+			podSpec.Affinity = &corev1.Affinity{}
+		}
+		if podSpec.Affinity.PodAntiAffinity == nil {
+			podSpec.Affinity.PodAntiAffinity = ruleEvaluatorAntiAffinity()
+		}
+	} else {
+		if deploy.Spec.Replicas != nil && *deploy.Spec.Replicas == ruleEvaluatorHAReplicas {
+			// Scale down again once high availability is disabled.
+			replicas := int32(1)
+			deploy.Spec.Replicas = &replicas
+		}
+		if affinity := deploy.Spec.Template.Spec.Affinity; affinity != nil && equality.Semantic.DeepEqual(affinity.PodAntiAffinity, ruleEvaluatorAntiAffinity()) {
+			affinity.PodAntiAffinity = nil
+		}
+	}
+	setSecretVolume(&deploy.Spec.Template.Spec, &corev1.SecretVolumeSource{SecretName: RuleEvaluatorHASecretName},
+		ruleEvaluatorHADir, spec.HighAvailability, "evaluator")
 
 	// Set EXTRA_ARGS envvar in evaluator container.
 	for i, c := range deploy.Spec.Template.Spec.Containers {
@@ -445,6 +533,157 @@ func (r *operatorConfigReconciler) ensureRuleEvaluatorDeployment(ctx context.Con
 	return r.client.Update(ctx, &deploy)
 }
 
+// ruleEvaluatorAntiAffinity returns the anti-affinity that spreads rule-evaluator
+// replicas across nodes if high availability is enabled. It is only preferred, so that
+// both replicas are still scheduled on single-node clusters.
+func ruleEvaluatorAntiAffinity() *corev1.PodAntiAffinity {
+	return &corev1.PodAntiAffinity{
+		PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{{
+			Weight: 100,
+			PodAffinityTerm: corev1.PodAffinityTerm{
+				LabelSelector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{LabelAppName: NameRuleEvaluator},
+				},
+				TopologyKey: corev1.LabelHostname,
+			},
+		}},
+	}
+}
+
+// ensureRuleEvaluatorHASecret creates the Secret with the token the rule-evaluator replicas
+// authenticate to each other with. An existing token is kept, so that it can be rotated
+// by deleting the Secret.
+func (r *operatorConfigReconciler) ensureRuleEvaluatorHASecret(ctx context.Context) error {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return fmt.Errorf("generate rule-evaluator HA token: %w", err)
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        RuleEvaluatorHASecretName,
+			Namespace:   r.opts.OperatorNamespace,
+			Annotations: componentAnnotations(),
+			Labels:      rulesLabels(),
+		},
+		Data: map[string][]byte{ruleEvaluatorHATokenKey: []byte(hex.EncodeToString(token))},
+	}
+	if err := r.client.Create(ctx, secret); err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("create rule-evaluator HA secret: %w", err)
+	}
+	return nil
+}
+
+// ensureRuleEvaluatorService reconciles the headless Service through which the
+// rule-evaluator replicas sync their alerting state if high availability is enabled.
+// It is deleted otherwise.
+func (r *operatorConfigReconciler) ensureRuleEvaluatorService(ctx context.Context, spec *monitoringv1.RuleEvaluatorSpec) error {
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      NameRuleEvaluator,
+			Namespace: r.opts.OperatorNamespace,
+			Labels:    rulesLabels(),
+		},
+	}
+	if !spec.HighAvailability {
+		if err := r.client.Delete(ctx, svc); client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("delete rule-evaluator Service: %w", err)
+		}
+		return nil
+	}
+	svc.Spec = corev1.ServiceSpec{
+		ClusterIP: corev1.ClusterIPNone,
+		Selector:  map[string]string{LabelAppName: NameRuleEvaluator},
+		Ports: []corev1.ServicePort{{
+			Name:       "web",
+			Port:       ruleEvaluatorPort,
+			TargetPort: intstr.FromInt(ruleEvaluatorPort),
+		}},
+	}
+	if err := r.client.Patch(ctx, svc, client.Merge); apierrors.IsNotFound(err) {
+		if err := r.client.Create(ctx, svc); err != nil {
+			return fmt.Errorf("create rule-evaluator Service: %w", err)
+		}
+	} else if err != nil {
+		return fmt.Errorf("patch rule-evaluator Service: %w", err)
+	}
+	return nil
+}
+
+// setSecretVolume mounts the secret into the given containers of the pod at mountPath,
+// or removes the volume and its mounts if disabled. The volume is named after the secret.
+func setSecretVolume(spec *corev1.PodSpec, source *corev1.SecretVolumeSource, mountPath string, enabled bool, containers ...string) {
+	name := source.SecretName
+	mounted := map[string]bool{}
+	for _, c := range containers {
+		mounted[c] = true
+	}
+
+	var volumes []corev1.Volume
+	for _, v := range spec.Volumes {
+		if v.Name != name {
+			volumes = append(volumes, v)
+		}
+	}
+	if enabled {
+		volumes = append(volumes, corev1.Volume{
+			Name:         name,
+			VolumeSource: corev1.VolumeSource{Secret: source},
+		})
+	}
+	spec.Volumes = volumes
+
+	for i := range spec.Containers {
+		c := &spec.Containers[i]
+		if !mounted[c.Name] {
+			continue
+		}
+		var mounts []corev1.VolumeMount
+		for _, m := range c.VolumeMounts {
+			if m.Name != name {
+				mounts = append(mounts, m)
+			}
+		}
+		if enabled {
+			mounts = append(mounts, corev1.VolumeMount{Name: name, MountPath: mountPath, ReadOnly: true})
+		}
+		c.VolumeMounts = mounts
+	}
+}
+
+// ensureRuleEvaluatorPodDisruptionBudget reconciles the PodDisruptionBudget that keeps one
+// rule-evaluator replica available during voluntary disruptions, such as node drains, if
+// high availability is enabled. It is deleted otherwise.
+func (r *operatorConfigReconciler) ensureRuleEvaluatorPodDisruptionBudget(ctx context.Context, spec *monitoringv1.RuleEvaluatorSpec) error {
+	pdb := &policyv1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      NameRuleEvaluator,
+			Namespace: r.opts.OperatorNamespace,
+			Labels:    rulesLabels(),
+		},
+	}
+	if !spec.HighAvailability {
+		if err := r.client.Delete(ctx, pdb); client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("delete rule-evaluator PodDisruptionBudget: %w", err)
+		}
+		return nil
+	}
+	minAvailable := intstr.FromInt(1)
+	pdb.Spec = policyv1.PodDisruptionBudgetSpec{
+		MinAvailable: &minAvailable,
+		Selector: &metav1.LabelSelector{
+			MatchLabels: map[string]string{LabelAppName: NameRuleEvaluator},
+		},
+	}
+	if err := r.client.Patch(ctx, pdb, client.Merge); apierrors.IsNotFound(err) {
+		if err := r.client.Create(ctx, pdb); err != nil {
+			return fmt.Errorf("create rule-evaluator PodDisruptionBudget: %w", err)
+		}
+	} else if err != nil {
+		return fmt.Errorf("patch rule-evaluator PodDisruptionBudget: %w", err)
+	}
+	return nil
+}
+
 // makeAlertmanagerConfigs creates the alertmanager_config entries as described in
 // https://prometheus.io/docs/prometheus/latest/configuration/configuration/#alertmanager_config.
 func (r *operatorConfigReconciler) makeAlertmanagerConfigs(ctx context.Context, spec *monitoringv1.AlertingSpec) (promconfig.AlertmanagerConfigs, map[string][]byte, error) {
@@ -697,12 +936,34 @@ func pathForSelector(namespace string, scm *monitoringv1.SecretOrConfigMap) stri
 	return ""
 }
 
+// queryTargetURL returns the URL of the Prometheus query API of the project at the
+// query endpoint, or an empty string if the endpoint is not overridden.
+func queryTargetURL(spec *monitoringv1.APIEndpoints, projectID string) (string, error) {
+	if spec.Query == "" {
+		return "", nil
+	}
+	if u, err := url.Parse("https://" + spec.Query); err != nil || u.Host != spec.Query {
+		return "", fmt.Errorf("query endpoint must be a host, got %q", spec.Query)
+	}
+	return fmt.Sprintf("https://%s/v1/projects/%s/location/global/prometheus", spec.Query, projectID), nil
+}
+
 func validateRules(rules *monitoringv1.RuleEvaluatorSpec) error {
 	if rules.GeneratorURL != "" {
 		if _, err := url.Parse(rules.GeneratorURL); err != nil {
 			return fmt.Errorf("failed to parse generator URL: %w", err)
 		}
 	}
+	fanOutProjectIDs := map[string]bool{}
+	for _, p := range rules.FanOutProjectIDs {
+		if p == "" || p == rules.QueryProjectID {
+			return fmt.Errorf("fan-out project ID %q must be set and differ from the query project ID", p)
+		}
+		if fanOutProjectIDs[p] {
+			return fmt.Errorf("duplicate fan-out project ID %q", p)
+		}
+		fanOutProjectIDs[p] = true
+	}
 
 	if err := validateSecretKeySelector(rules.Credentials); err != nil {
 		return fmt.Errorf("invalid credentials: %w", err)
@@ -777,6 +1038,17 @@ func (v *operatorConfigValidator) ValidateCreate(ctx context.Context, o runtime.
 	if err := validateSecretKeySelector(oc.Collection.Credentials); err != nil {
 		return fmt.Errorf("invalid collection credentials: %w", err)
 	}
+	if _, err := exportBatchingFlags(oc.Collection.Batching); err != nil {
+		return fmt.Errorf("invalid collection batching: %w", err)
+	}
+	if _, err := exportMetricNameFlags(&oc.Collection.Filter); err != nil {
+		return fmt.Errorf("invalid collection filter: %w", err)
+	}
+	for namespace, prefix := range oc.Collection.MetricTypePrefixes {
+		if err := monitoringv1.ValidateMetricTypePrefix(prefix); err != nil {
+			return fmt.Errorf("invalid metric type prefix for namespace %q: %w", namespace, err)
+		}
+	}
 	if oc.ManagedAlertmanager != nil {
 		if err := validateSecretKeySelector(oc.ManagedAlertmanager.ConfigSecret); err != nil {
 			return fmt.Errorf("invalid managed alert manager config secret: %w", err)
@@ -785,6 +1057,15 @@ func (v *operatorConfigValidator) ValidateCreate(ctx context.Context, o runtime.
 	if err := validateRules(&oc.Rules); err != nil {
 		return fmt.Errorf("invalid rules config: %w", err)
 	}
+	if _, err := exportEndpointFlags(&oc.Endpoints); err != nil {
+		return fmt.Errorf("invalid endpoints: %w", err)
+	}
+	if _, err := queryTargetURL(&oc.Endpoints, ""); err != nil {
+		return fmt.Errorf("invalid endpoints: %w", err)
+	}
+	if _, err := targetStatusPollInterval(&oc.Features.TargetStatus); err != nil {
+		return fmt.Errorf("invalid target status config: %w", err)
+	}
 	return nil
 }
 
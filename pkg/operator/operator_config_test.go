@@ -20,8 +20,17 @@ import (
 	"testing"
 
 	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/testr"
+	"github.com/google/go-cmp/cmp"
+	appsv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
 func TestOperatorConfigValidator(t *testing.T) {
@@ -61,6 +70,46 @@ func TestOperatorConfigValidator(t *testing.T) {
 			},
 			err: `OperatorConfig must be in namespace "foo" with name "config"`,
 		},
+		{
+			desc: "valid endpoints",
+			oc: &monitoringv1.OperatorConfig{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "foo",
+					Name:      "config",
+				},
+				Endpoints: monitoringv1.APIEndpoints{
+					Export:        "monitoring-psc.p.googleapis.com:443",
+					TLSServerName: "monitoring.googleapis.com",
+					Query:         "monitoring-psc.p.googleapis.com",
+				},
+			},
+		},
+		{
+			desc: "bad export endpoint",
+			oc: &monitoringv1.OperatorConfig{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "foo",
+					Name:      "config",
+				},
+				Endpoints: monitoringv1.APIEndpoints{
+					Export: "monitoring.googleapis.com",
+				},
+			},
+			err: `invalid export endpoint "monitoring.googleapis.com"`,
+		},
+		{
+			desc: "bad query endpoint",
+			oc: &monitoringv1.OperatorConfig{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "foo",
+					Name:      "config",
+				},
+				Endpoints: monitoringv1.APIEndpoints{
+					Query: "https://monitoring.googleapis.com/v1",
+				},
+			},
+			err: `query endpoint must be a host`,
+		},
 		{
 			desc: "bad scrape interval",
 			oc: &monitoringv1.OperatorConfig{
@@ -91,6 +140,35 @@ func TestOperatorConfigValidator(t *testing.T) {
 			},
 			err: `invalid scrape interval: empty duration string`,
 		},
+		{
+			desc: "target status poll interval",
+			oc: &monitoringv1.OperatorConfig{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "foo",
+					Name:      "config",
+				},
+				Features: monitoringv1.OperatorFeatures{
+					TargetStatus: monitoringv1.TargetStatusSpec{
+						Interval: "1m",
+					},
+				},
+			},
+		},
+		{
+			desc: "target status poll interval too short",
+			oc: &monitoringv1.OperatorConfig{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "foo",
+					Name:      "config",
+				},
+				Features: monitoringv1.OperatorFeatures{
+					TargetStatus: monitoringv1.TargetStatusSpec{
+						Interval: "5s",
+					},
+				},
+			},
+			err: `invalid target status config: poll interval 5s must not be less than 10s`,
+		},
 		{
 			desc: "bad generator URL",
 			oc: &monitoringv1.OperatorConfig{
@@ -104,6 +182,46 @@ func TestOperatorConfigValidator(t *testing.T) {
 			},
 			err: `failed to parse generator URL: parse "~:://example.com": first path segment in URL cannot contain colon`,
 		},
+		{
+			desc: "fan-out project IDs",
+			oc: &monitoringv1.OperatorConfig{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "foo",
+					Name:      "config",
+				},
+				Rules: monitoringv1.RuleEvaluatorSpec{
+					QueryProjectID:   "p0",
+					FanOutProjectIDs: []string{"p1", "p2"},
+				},
+			},
+		},
+		{
+			desc: "duplicate fan-out project ID",
+			oc: &monitoringv1.OperatorConfig{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "foo",
+					Name:      "config",
+				},
+				Rules: monitoringv1.RuleEvaluatorSpec{
+					FanOutProjectIDs: []string{"p1", "p1"},
+				},
+			},
+			err: `duplicate fan-out project ID "p1"`,
+		},
+		{
+			desc: "fan-out project ID of query project",
+			oc: &monitoringv1.OperatorConfig{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "foo",
+					Name:      "config",
+				},
+				Rules: monitoringv1.RuleEvaluatorSpec{
+					QueryProjectID:   "p0",
+					FanOutProjectIDs: []string{"p0"},
+				},
+			},
+			err: `fan-out project ID "p0" must be set and differ from the query project ID`,
+		},
 		{
 			desc: "missing collection credentials secret key",
 			oc: &monitoringv1.OperatorConfig{
@@ -133,6 +251,37 @@ func TestOperatorConfigValidator(t *testing.T) {
 				},
 			},
 		},
+		{
+			desc: "collection batching",
+			oc: &monitoringv1.OperatorConfig{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "foo",
+					Name:      "config",
+				},
+				Collection: monitoringv1.CollectionSpec{
+					Batching: &monitoringv1.ExportBatching{
+						BatchSize:       100,
+						BatchDelay:      "500ms",
+						ShardBufferSize: 4096,
+					},
+				},
+			},
+		},
+		{
+			desc: "collection batch delay too long",
+			oc: &monitoringv1.OperatorConfig{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "foo",
+					Name:      "config",
+				},
+				Collection: monitoringv1.CollectionSpec{
+					Batching: &monitoringv1.ExportBatching{
+						BatchDelay: "1m",
+					},
+				},
+			},
+			err: "invalid collection batching: batch delay must be between 1ms and 10s, got 1m",
+		},
 		{
 			desc: "missing managed alert manager config secret key",
 			oc: &monitoringv1.OperatorConfig{
@@ -389,3 +538,208 @@ func TestOperatorConfigValidator(t *testing.T) {
 		})
 	}
 }
+
+func TestEnsureRuleEvaluatorDeployment(t *testing.T) {
+	ctx := logr.NewContext(context.Background(), testr.New(t))
+	scheme, err := NewScheme()
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := Options{
+		ProjectID:         "p1",
+		Location:          "l1",
+		Cluster:           "c1",
+		OperatorNamespace: "gmp-system",
+		PublicNamespace:   "gmp-public",
+	}
+	deploy := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: opts.OperatorNamespace, Name: NameRuleEvaluator},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: pointer.Int32(1),
+			Template: v1.PodTemplateSpec{
+				Spec: v1.PodSpec{Containers: []v1.Container{{Name: "evaluator"}}},
+			},
+		},
+	}
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(deploy).Build()
+	r := newOperatorConfigReconciler(kubeClient, opts)
+
+	var got appsv1.Deployment
+	ensure := func(spec *monitoringv1.RuleEvaluatorSpec) (int32, string) {
+		t.Helper()
+		if err := r.ensureRuleEvaluatorDeployment(ctx, spec, &monitoringv1.APIEndpoints{}); err != nil {
+			t.Fatal(err)
+		}
+		got = appsv1.Deployment{}
+		if err := kubeClient.Get(ctx, client.ObjectKeyFromObject(deploy), &got); err != nil {
+			t.Fatal(err)
+		}
+		return *got.Spec.Replicas, got.Spec.Template.Spec.Containers[0].Env[0].Value
+	}
+
+	replicas, args := ensure(&monitoringv1.RuleEvaluatorSpec{HighAvailability: true})
+	if replicas != ruleEvaluatorHAReplicas {
+		t.Errorf("expected %d replicas, got %d", ruleEvaluatorHAReplicas, replicas)
+	}
+	if affinity := got.Spec.Template.Spec.Affinity; affinity == nil || !cmp.Equal(ruleEvaluatorAntiAffinity(), affinity.PodAntiAffinity) {
+		t.Errorf("expected replicas to be spread across nodes, got affinity %v", affinity)
+	}
+	for _, want := range []string{
+		"--export.ha.backend=kube",
+		`--export.ha.kube.namespace="gmp-system"`,
+		`--export.ha.kube.name="rule-evaluator"`,
+		`--ha.peer-url="http://rule-evaluator.gmp-system.svc:19092"`,
+		`--ha.auth-token-file="/etc/rule-evaluator-ha/token"`,
+	} {
+		if !strings.Contains(args, want) {
+			t.Errorf("expected args %q to contain %q", args, want)
+		}
+	}
+	wantMounts := []v1.VolumeMount{{Name: RuleEvaluatorHASecretName, MountPath: ruleEvaluatorHADir, ReadOnly: true}}
+	if diff := cmp.Diff(wantMounts, got.Spec.Template.Spec.Containers[0].VolumeMounts); diff != "" {
+		t.Errorf("unexpected volume mounts (-want, +got): %s", diff)
+	}
+
+	// The token is generated once and kept.
+	var secret v1.Secret
+	if err := kubeClient.Get(ctx, client.ObjectKey{Namespace: opts.OperatorNamespace, Name: RuleEvaluatorHASecretName}, &secret); err != nil {
+		t.Fatal(err)
+	}
+	token := string(secret.Data[ruleEvaluatorHATokenKey])
+	if len(token) != 64 {
+		t.Errorf("unexpected token %q", token)
+	}
+	ensure(&monitoringv1.RuleEvaluatorSpec{HighAvailability: true})
+	if err := kubeClient.Get(ctx, client.ObjectKeyFromObject(&secret), &secret); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(secret.Data[ruleEvaluatorHATokenKey]); got != token {
+		t.Errorf("expected token %q to be kept, got %q", token, got)
+	}
+
+	_, args = ensure(&monitoringv1.RuleEvaluatorSpec{FanOutProjectIDs: []string{"p2", "p3"}})
+	for _, want := range []string{
+		`--query.fan-out-project-id="p2"`,
+		`--query.fan-out-project-id="p3"`,
+	} {
+		if !strings.Contains(args, want) {
+			t.Errorf("expected args %q to contain %q", args, want)
+		}
+	}
+
+	replicas, args = ensure(&monitoringv1.RuleEvaluatorSpec{})
+	if replicas != 1 {
+		t.Errorf("expected 1 replica after disabling high availability, got %d", replicas)
+	}
+	if strings.Contains(args, "--export.ha") || strings.Contains(args, "--ha.") {
+		t.Errorf("unexpected HA flags in args %q", args)
+	}
+	if podSpec := got.Spec.Template.Spec; len(podSpec.Volumes) > 0 || len(podSpec.Containers[0].VolumeMounts) > 0 {
+		t.Errorf("unexpected volumes after disabling high availability: %v", podSpec.Volumes)
+	}
+	if affinity := got.Spec.Template.Spec.Affinity; affinity != nil && affinity.PodAntiAffinity != nil {
+		t.Errorf("unexpected anti-affinity after disabling high availability: %v", affinity.PodAntiAffinity)
+	}
+
+	// Anti-affinity that was set otherwise is kept.
+	custom := &v1.PodAntiAffinity{
+		RequiredDuringSchedulingIgnoredDuringExecution: []v1.PodAffinityTerm{{TopologyKey: "topology.kubernetes.io/zone"}},
+	}
+	got.Spec.Template.Spec.Affinity = &v1.Affinity{PodAntiAffinity: custom}
+	if err := kubeClient.Update(ctx, &got); err != nil {
+		t.Fatal(err)
+	}
+	for _, ha := range []bool{true, false} {
+		ensure(&monitoringv1.RuleEvaluatorSpec{HighAvailability: ha})
+		if diff := cmp.Diff(custom, got.Spec.Template.Spec.Affinity.PodAntiAffinity); diff != "" {
+			t.Errorf("unexpected anti-affinity with high availability %v (-want, +got): %s", ha, diff)
+		}
+	}
+}
+
+func TestEnsureRuleEvaluatorService(t *testing.T) {
+	ctx := logr.NewContext(context.Background(), testr.New(t))
+	scheme, err := NewScheme()
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := Options{
+		OperatorNamespace: "gmp-system",
+		PublicNamespace:   "gmp-public",
+	}
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme).Build()
+	r := newOperatorConfigReconciler(kubeClient, opts)
+	key := client.ObjectKey{Namespace: opts.OperatorNamespace, Name: NameRuleEvaluator}
+
+	// Ensuring twice must not fail on the existing Service.
+	for i := 0; i < 2; i++ {
+		if err := r.ensureRuleEvaluatorService(ctx, &monitoringv1.RuleEvaluatorSpec{HighAvailability: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var svc v1.Service
+	if err := kubeClient.Get(ctx, key, &svc); err != nil {
+		t.Fatal(err)
+	}
+	if svc.Spec.ClusterIP != v1.ClusterIPNone {
+		t.Errorf("expected headless Service, got cluster IP %q", svc.Spec.ClusterIP)
+	}
+	if len(svc.Spec.Ports) != 1 || svc.Spec.Ports[0].Port != ruleEvaluatorPort {
+		t.Errorf("unexpected ports %v", svc.Spec.Ports)
+	}
+	if diff := cmp.Diff(map[string]string{LabelAppName: NameRuleEvaluator}, svc.Spec.Selector); diff != "" {
+		t.Errorf("unexpected selector (-want, +got): %s", diff)
+	}
+
+	// The Service is deleted once high availability is disabled.
+	for i := 0; i < 2; i++ {
+		if err := r.ensureRuleEvaluatorService(ctx, &monitoringv1.RuleEvaluatorSpec{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := kubeClient.Get(ctx, key, &svc); !apierrors.IsNotFound(err) {
+		t.Errorf("expected Service to be deleted, got error %v", err)
+	}
+}
+
+func TestEnsureRuleEvaluatorPodDisruptionBudget(t *testing.T) {
+	ctx := logr.NewContext(context.Background(), testr.New(t))
+	scheme, err := NewScheme()
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := Options{
+		OperatorNamespace: "gmp-system",
+		PublicNamespace:   "gmp-public",
+	}
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme).Build()
+	r := newOperatorConfigReconciler(kubeClient, opts)
+	key := client.ObjectKey{Namespace: opts.OperatorNamespace, Name: NameRuleEvaluator}
+
+	// Ensuring twice must not fail on the existing PodDisruptionBudget.
+	for i := 0; i < 2; i++ {
+		if err := r.ensureRuleEvaluatorPodDisruptionBudget(ctx, &monitoringv1.RuleEvaluatorSpec{HighAvailability: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var pdb policyv1.PodDisruptionBudget
+	if err := kubeClient.Get(ctx, key, &pdb); err != nil {
+		t.Fatal(err)
+	}
+	if pdb.Spec.MinAvailable == nil || pdb.Spec.MinAvailable.IntValue() != 1 {
+		t.Errorf("expected one replica to be kept available, got %v", pdb.Spec.MinAvailable)
+	}
+	if diff := cmp.Diff(map[string]string{LabelAppName: NameRuleEvaluator}, pdb.Spec.Selector.MatchLabels); diff != "" {
+		t.Errorf("unexpected selector (-want, +got): %s", diff)
+	}
+
+	// The PodDisruptionBudget is deleted once high availability is disabled.
+	for i := 0; i < 2; i++ {
+		if err := r.ensureRuleEvaluatorPodDisruptionBudget(ctx, &monitoringv1.RuleEvaluatorSpec{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := kubeClient.Get(ctx, key, &pdb); !apierrors.IsNotFound(err) {
+		t.Errorf("expected PodDisruptionBudget to be deleted, got error %v", err)
+	}
+}
@@ -17,14 +17,18 @@ package operator
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strconv"
 
 	"github.com/go-logr/logr"
 	yaml "gopkg.in/yaml.v3"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/pointer"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -39,6 +43,16 @@ import (
 
 const (
 	nameRulesGenerated = "rules-generated"
+	// Name of the rule-evaluator volume that holds the generated rule files.
+	nameRulesVolume = "rules"
+	// Label of generated rules ConfigMaps holding their shard index.
+	labelRulesShard = "monitoring.googleapis.com/rules-shard"
+	// Maximum total size of the rule files in a single generated ConfigMap. Kubernetes
+	// limits ConfigMaps to 1MiB, which leaves headroom for the object metadata.
+	maxRulesConfigMapSize = 1<<20 - 64<<10
+	// Maximum number of generated rules ConfigMaps. The operator's RBAC role only grants
+	// access to ConfigMaps of these names.
+	maxRulesShards = 8
 )
 
 func setupRulesControllers(op *Operator) error {
@@ -54,10 +68,12 @@ func setupRulesControllers(op *Operator) error {
 		namespace: op.opts.PublicNamespace,
 		name:      NameOperatorConfig,
 	}
-	// Rule-evaluator rules ConfigMap filter.
-	objFilterRulesGenerated := namespacedNamePredicate{
+	// Rule-evaluator rules ConfigMaps filter.
+	objFilterRulesGenerated := predicate.NewPredicateFuncs(rulesShardFilter(op.opts.OperatorNamespace))
+	// Rule-evaluator Deployment filter.
+	objFilterRuleEvaluator := namespacedNamePredicate{
 		namespace: op.opts.OperatorNamespace,
-		name:      nameRulesGenerated,
+		name:      NameRuleEvaluator,
 	}
 
 	// Reconcile the generated rules that are used by the rule-evaluator deployment.
@@ -90,6 +106,12 @@ func setupRulesControllers(op *Operator) error {
 			enqueueConst(objRequest),
 			builder.WithPredicates(objFilterRulesGenerated),
 		).
+		// The rule-evaluator mounts all generated ConfigMaps.
+		Watches(
+			&source.Kind{Type: &appsv1.Deployment{}},
+			enqueueConst(objRequest),
+			builder.WithPredicates(objFilterRuleEvaluator),
+		).
 		Complete(newRulesReconciler(op.manager.GetClient(), op.opts))
 	if err != nil {
 		return fmt.Errorf("create rules config controller: %w", err)
@@ -129,23 +151,33 @@ func (r *rulesReconciler) Reconcile(ctx context.Context, req reconcile.Request)
 	return reconcile.Result{}, nil
 }
 
+// rulesShardFilter filters the generated rules ConfigMaps in the given namespace.
+func rulesShardFilter(ns string) func(object client.Object) bool {
+	return func(object client.Object) bool {
+		if object.GetNamespace() != ns {
+			return false
+		}
+		_, ok := object.GetLabels()[labelRulesShard]
+		return ok || object.GetName() == nameRulesGenerated
+	}
+}
+
+// rulesShardName returns the name of the generated rules ConfigMap with the given index.
+// The first shard keeps the name of the former single ConfigMap.
+func rulesShardName(index int) string {
+	if index == 0 {
+		return nameRulesGenerated
+	}
+	return fmt.Sprintf("%s-%d", nameRulesGenerated, index)
+}
+
 func (r *rulesReconciler) ensureRuleConfigs(ctx context.Context, projectID, location, cluster string) error {
 	logger, _ := logr.FromContext(ctx)
 
-	// Re-generate the configmap that's loaded by the rule-evaluator.
-	cm := &corev1.ConfigMap{
-		ObjectMeta: metav1.ObjectMeta{
-			Namespace: r.opts.OperatorNamespace,
-			Name:      nameRulesGenerated,
-			Labels: map[string]string{
-				LabelAppName: NameRuleEvaluator,
-			},
-		},
-		// Ensure there's always at least an empty dummy file as the evaluator
-		// expects at least one match.
-		Data: map[string]string{
-			"empty.yaml": "",
-		},
+	// Ensure there's always at least an empty dummy file as the evaluator
+	// expects at least one match.
+	files := map[string]string{
+		"empty.yaml": "",
 	}
 
 	// Generate a final rule file for each Rules resource.
@@ -162,13 +194,13 @@ func (r *rulesReconciler) ensureRuleConfigs(ctx context.Context, projectID, loca
 		return fmt.Errorf("list rules: %w", err)
 	}
 	for _, rs := range rulesList.Items {
-		result, err := generateRules(&rs, projectID, location, cluster)
+		result, err := GenerateRules(&rs, projectID, location, cluster)
 		if err != nil {
 			// TODO(freinartz): update resource condition.
 			logger.Error(err, "converting rules failed", "rules_namespace", rs.Namespace, "rules_name", rs.Name)
 		}
 		filename := fmt.Sprintf("rules__%s__%s.yaml", rs.Namespace, rs.Name)
-		cm.Data[filename] = result
+		files[filename] = result
 	}
 
 	var clusterRulesList monitoringv1.ClusterRulesList
@@ -176,13 +208,13 @@ func (r *rulesReconciler) ensureRuleConfigs(ctx context.Context, projectID, loca
 		return fmt.Errorf("list cluster rules: %w", err)
 	}
 	for _, rs := range clusterRulesList.Items {
-		result, err := generateClusterRules(&rs, projectID, location, cluster)
+		result, err := GenerateClusterRules(&rs, projectID, location, cluster)
 		if err != nil {
 			// TODO(freinartz): update resource condition.
 			logger.Error(err, "converting rules failed", "clusterrules_name", rs.Name)
 		}
 		filename := fmt.Sprintf("clusterrules__%s.yaml", rs.Name)
-		cm.Data[filename] = string(result)
+		files[filename] = string(result)
 	}
 
 	var globalRulesList monitoringv1.GlobalRulesList
@@ -190,27 +222,153 @@ func (r *rulesReconciler) ensureRuleConfigs(ctx context.Context, projectID, loca
 		return fmt.Errorf("list global rules: %w", err)
 	}
 	for _, rs := range globalRulesList.Items {
-		result, err := generateGlobalRules(&rs)
+		result, err := GenerateGlobalRules(&rs)
 		if err != nil {
 			// TODO(freinartz): update resource condition.
 			logger.Error(err, "converting rules failed", "globalrules_name", rs.Name)
 		}
 		filename := fmt.Sprintf("globalrules__%s.yaml", rs.Name)
-		cm.Data[filename] = string(result)
+		files[filename] = string(result)
 	}
 
-	// Create or update generated rule ConfigMap.
-	if err := r.client.Update(ctx, cm); apierrors.IsNotFound(err) {
-		if err := r.client.Create(ctx, cm); err != nil {
-			return fmt.Errorf("create generated rules: %w", err)
+	// Create or update generated rule ConfigMaps.
+	shards := shardRuleFiles(files, maxRulesConfigMapSize)
+	if len(shards) > maxRulesShards {
+		return fmt.Errorf("generated rules require %d ConfigMaps, exceeding the maximum of %d", len(shards), maxRulesShards)
+	}
+	names := make([]string, 0, len(shards))
+	for i, data := range shards {
+		cm := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: r.opts.OperatorNamespace,
+				Name:      rulesShardName(i),
+				Labels: map[string]string{
+					LabelAppName:    NameRuleEvaluator,
+					labelRulesShard: strconv.Itoa(i),
+				},
+			},
+			Data: data,
+		}
+		if err := r.client.Update(ctx, cm); apierrors.IsNotFound(err) {
+			if err := r.client.Create(ctx, cm); err != nil {
+				return fmt.Errorf("create generated rules: %w", err)
+			}
+		} else if err != nil {
+			return fmt.Errorf("update generated rules: %w", err)
+		}
+		names = append(names, cm.Name)
+	}
+
+	rolledOut, err := r.ensureRuleEvaluatorVolume(ctx, names)
+	if err != nil {
+		return fmt.Errorf("ensure rule-evaluator rules volume: %w", err)
+	}
+	// Shards that are no longer needed may still be mounted by rule-evaluator pods of the
+	// previous revision. Keep them until the rollout completed. The Deployment watch
+	// triggers another reconciliation once its status changes.
+	if !rolledOut {
+		return nil
+	}
+	var cms corev1.ConfigMapList
+	if err := r.client.List(ctx, &cms, client.InNamespace(r.opts.OperatorNamespace), client.HasLabels{labelRulesShard}); err != nil {
+		return fmt.Errorf("list generated rules: %w", err)
+	}
+	for _, cm := range cms.Items {
+		index, err := strconv.Atoi(cm.Labels[labelRulesShard])
+		if err == nil && index < len(shards) {
+			continue
+		}
+		if err := r.client.Delete(ctx, &cm); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("delete generated rules %q: %w", cm.Name, err)
 		}
-	} else if err != nil {
-		return fmt.Errorf("update generated rules: %w", err)
 	}
 	return nil
 }
 
-func generateRules(apiRules *monitoringv1.Rules, projectID, location, cluster string) (string, error) {
+// shardRuleFiles distributes the rule files across as few ConfigMap data maps as possible
+// without exceeding maxSize per map. Files are assigned in order of their names so that
+// the result is deterministic. A single file exceeding maxSize gets a shard of its own.
+func shardRuleFiles(files map[string]string, maxSize int) []map[string]string {
+	filenames := make([]string, 0, len(files))
+	for f := range files {
+		filenames = append(filenames, f)
+	}
+	sort.Strings(filenames)
+
+	var (
+		shards []map[string]string
+		size   int
+	)
+	for _, f := range filenames {
+		n := len(f) + len(files[f])
+		if len(shards) == 0 || size+n > maxSize {
+			shards = append(shards, map[string]string{})
+			size = 0
+		}
+		shards[len(shards)-1][f] = files[f]
+		size += n
+	}
+	return shards
+}
+
+// ensureRuleEvaluatorVolume ensures that the rules volume of the rule-evaluator
+// projects all generated rules ConfigMaps into the rules directory. It returns true
+// if no pods that may mount a different set of ConfigMaps remain.
+func (r *rulesReconciler) ensureRuleEvaluatorVolume(ctx context.Context, names []string) (bool, error) {
+	var deploy appsv1.Deployment
+	err := r.client.Get(ctx, client.ObjectKey{Namespace: r.opts.OperatorNamespace, Name: NameRuleEvaluator}, &deploy)
+	// Missing Deployments are already reported when reconciling the OperatorConfig.
+	if apierrors.IsNotFound(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	sources := make([]corev1.VolumeProjection, 0, len(names))
+	for _, name := range names {
+		sources = append(sources, corev1.VolumeProjection{
+			ConfigMap: &corev1.ConfigMapProjection{
+				LocalObjectReference: corev1.LocalObjectReference{Name: name},
+			},
+		})
+	}
+	volumes := deploy.Spec.Template.Spec.Volumes
+	for i, v := range volumes {
+		if v.Name != nameRulesVolume {
+			continue
+		}
+		if projectsConfigMaps(v, names) {
+			// Pods of the previous revision are only gone once all replicas are updated.
+			return deploymentRollout(&deploy).Complete && deploy.Status.Replicas == deploy.Status.UpdatedReplicas, nil
+		}
+		volumes[i].VolumeSource = corev1.VolumeSource{
+			Projected: &corev1.ProjectedVolumeSource{
+				Sources:     sources,
+				DefaultMode: pointer.Int32(420),
+			},
+		}
+		return false, r.client.Update(ctx, &deploy)
+	}
+	return false, fmt.Errorf("volume %q not found", nameRulesVolume)
+}
+
+// projectsConfigMaps returns true if the volume consists of exactly the given ConfigMaps.
+func projectsConfigMaps(v corev1.Volume, names []string) bool {
+	if v.Projected == nil || len(v.Projected.Sources) != len(names) {
+		return false
+	}
+	for i, s := range v.Projected.Sources {
+		if s.ConfigMap == nil || s.ConfigMap.Name != names[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// GenerateRules converts the Rules resource into a Prometheus rule file. All rules are
+// scoped to the project, location and cluster, as well as the namespace of the resource.
+func GenerateRules(apiRules *monitoringv1.Rules, projectID, location, cluster string) (string, error) {
 	rs, err := rules.FromAPIRules(apiRules.Spec.Groups)
 	if err != nil {
 		return "", fmt.Errorf("converting rules failed: %w", err)
@@ -230,7 +388,9 @@ func generateRules(apiRules *monitoringv1.Rules, projectID, location, cluster st
 	return string(result), nil
 }
 
-func generateClusterRules(apiRules *monitoringv1.ClusterRules, projectID, location, cluster string) (string, error) {
+// GenerateClusterRules converts the ClusterRules resource into a Prometheus rule file.
+// All rules are scoped to the project, location and cluster.
+func GenerateClusterRules(apiRules *monitoringv1.ClusterRules, projectID, location, cluster string) (string, error) {
 	rs, err := rules.FromAPIRules(apiRules.Spec.Groups)
 	if err != nil {
 		return "", fmt.Errorf("converting rules failed: %w", err)
@@ -249,7 +409,9 @@ func generateClusterRules(apiRules *monitoringv1.ClusterRules, projectID, locati
 	return string(result), nil
 }
 
-func generateGlobalRules(apiRules *monitoringv1.GlobalRules) (string, error) {
+// GenerateGlobalRules converts the GlobalRules resource into a Prometheus rule file.
+// Rules are not scoped and evaluate against all data of the queried projects.
+func GenerateGlobalRules(apiRules *monitoringv1.GlobalRules) (string, error) {
 	rs, err := rules.FromAPIRules(apiRules.Spec.Groups)
 	if err != nil {
 		return "", fmt.Errorf("converting rules failed: %w", err)
@@ -269,7 +431,7 @@ type rulesValidator struct {
 }
 
 func (v *rulesValidator) ValidateCreate(ctx context.Context, o runtime.Object) error {
-	_, err := generateRules(o.(*monitoringv1.Rules), "test_project", "test_location", "test_cluster")
+	_, err := GenerateRules(o.(*monitoringv1.Rules), "test_project", "test_location", "test_cluster")
 	return err
 }
 
@@ -286,7 +448,7 @@ type clusterRulesValidator struct {
 }
 
 func (v *clusterRulesValidator) ValidateCreate(ctx context.Context, o runtime.Object) error {
-	_, err := generateClusterRules(o.(*monitoringv1.ClusterRules), "test_project", "test_location", "test_cluster")
+	_, err := GenerateClusterRules(o.(*monitoringv1.ClusterRules), "test_project", "test_location", "test_cluster")
 	return err
 }
 
@@ -301,7 +463,7 @@ func (v *clusterRulesValidator) ValidateDelete(ctx context.Context, o runtime.Ob
 type globalRulesValidator struct{}
 
 func (v *globalRulesValidator) ValidateCreate(ctx context.Context, o runtime.Object) error {
-	_, err := generateGlobalRules(o.(*monitoringv1.GlobalRules))
+	_, err := GenerateGlobalRules(o.(*monitoringv1.GlobalRules))
 	return err
 }
 
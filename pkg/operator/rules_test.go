@@ -15,11 +15,17 @@
 package operator
 
 import (
+	"context"
+	"sort"
 	"testing"
 
 	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
 	"github.com/google/go-cmp/cmp"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
 func TestGenerateRules(t *testing.T) {
@@ -92,7 +98,7 @@ func TestGenerateRules(t *testing.T) {
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			got, err := generateRules(test.apiRules, test.projectID, test.location, test.clusterName)
+			got, err := GenerateRules(test.apiRules, test.projectID, test.location, test.clusterName)
 			if (err == nil && test.wantErr) || (err != nil && !test.wantErr) {
 				t.Fatalf("expected err: %v; actual %v", test.wantErr, err)
 			}
@@ -169,7 +175,7 @@ func TestGenerateClusterRules(t *testing.T) {
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			got, err := generateClusterRules(test.apiRules, test.projectID, test.location, test.clusterName)
+			got, err := GenerateClusterRules(test.apiRules, test.projectID, test.location, test.clusterName)
 			if (err == nil && test.wantErr) || (err != nil && !test.wantErr) {
 				t.Fatalf("expected err: %v; actual %v", test.wantErr, err)
 			}
@@ -236,7 +242,7 @@ func TestGenerateGlobalRules(t *testing.T) {
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			got, err := generateGlobalRules(test.apiRules)
+			got, err := GenerateGlobalRules(test.apiRules)
 			if (err == nil && test.wantErr) || (err != nil && !test.wantErr) {
 				t.Fatalf("expected err: %v; actual %v", test.wantErr, err)
 			}
@@ -246,3 +252,120 @@ func TestGenerateGlobalRules(t *testing.T) {
 		})
 	}
 }
+
+func TestShardRuleFiles(t *testing.T) {
+	files := map[string]string{
+		"a.yaml": "0123456789",
+		"b.yaml": "0123456789",
+		"c.yaml": "0123456789012345678901234567890123456789",
+		"d.yaml": "",
+	}
+	want := []map[string]string{
+		{"a.yaml": "0123456789", "b.yaml": "0123456789"},
+		{"c.yaml": "0123456789012345678901234567890123456789"},
+		{"d.yaml": ""},
+	}
+	if diff := cmp.Diff(want, shardRuleFiles(files, 40)); diff != "" {
+		t.Errorf("unexpected shards (-want, +got): %s", diff)
+	}
+}
+
+func TestEnsureRuleConfigs(t *testing.T) {
+	scheme, err := NewScheme()
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := Options{
+		OperatorNamespace: "gmp-system",
+		PublicNamespace:   "gmp-public",
+	}
+	deploy := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: opts.OperatorNamespace, Name: NameRuleEvaluator},
+		Spec: appsv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Volumes: []corev1.Volume{{
+						Name: nameRulesVolume,
+						VolumeSource: corev1.VolumeSource{
+							ConfigMap: &corev1.ConfigMapVolumeSource{
+								LocalObjectReference: corev1.LocalObjectReference{Name: nameRulesGenerated},
+							},
+						},
+					}},
+				},
+			},
+		},
+	}
+	// A shard left over from a previous reconciliation with more rules.
+	stale := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: opts.OperatorNamespace,
+			Name:      rulesShardName(1),
+			Labels:    map[string]string{labelRulesShard: "1"},
+		},
+	}
+	rules := &monitoringv1.Rules{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "rules1"},
+		Spec: monitoringv1.RulesSpec{
+			Groups: []monitoringv1.RuleGroup{{
+				Name:  "group-1",
+				Rules: []monitoringv1.Rule{{Record: "foo:sum", Expr: "sum(foo)"}},
+			}},
+		},
+	}
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(deploy, stale, rules).Build()
+
+	r := newRulesReconciler(kubeClient, opts)
+	if err := r.ensureRuleConfigs(context.Background(), "p", "l", "c"); err != nil {
+		t.Fatal(err)
+	}
+	// The stale shard must be kept while pods of the previous revision may still mount it.
+	var cms corev1.ConfigMapList
+	if err := kubeClient.List(context.Background(), &cms); err != nil {
+		t.Fatal(err)
+	}
+	if len(cms.Items) != 2 {
+		t.Fatalf("expected stale ConfigMap to be kept during rollout but got %v", cms.Items)
+	}
+
+	// Complete the rollout.
+	var rolled appsv1.Deployment
+	if err := kubeClient.Get(context.Background(), client.ObjectKeyFromObject(deploy), &rolled); err != nil {
+		t.Fatal(err)
+	}
+	rolled.Status = appsv1.DeploymentStatus{
+		ObservedGeneration: rolled.Generation,
+		Replicas:           1,
+		UpdatedReplicas:    1,
+		ReadyReplicas:      1,
+	}
+	if err := kubeClient.Status().Update(context.Background(), &rolled); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.ensureRuleConfigs(context.Background(), "p", "l", "c"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := kubeClient.List(context.Background(), &cms); err != nil {
+		t.Fatal(err)
+	}
+	if len(cms.Items) != 1 || cms.Items[0].Name != nameRulesGenerated {
+		t.Fatalf("expected only ConfigMap %q but got %v", nameRulesGenerated, cms.Items)
+	}
+	var files []string
+	for f := range cms.Items[0].Data {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+	if diff := cmp.Diff([]string{"empty.yaml", "rules__ns1__rules1.yaml"}, files); diff != "" {
+		t.Errorf("unexpected rule files (-want, +got): %s", diff)
+	}
+
+	var got appsv1.Deployment
+	if err := kubeClient.Get(context.Background(), client.ObjectKeyFromObject(deploy), &got); err != nil {
+		t.Fatal(err)
+	}
+	if !projectsConfigMaps(got.Spec.Template.Spec.Volumes[0], []string{nameRulesGenerated}) {
+		t.Errorf("unexpected rules volume: %v", got.Spec.Template.Spec.Volumes[0])
+	}
+}
@@ -0,0 +1,407 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/clock"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/GoogleCloudPlatform/prometheus-engine/pkg/export"
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+)
+
+const (
+	// silenceFinalizer ensures silences are expired in Alertmanager before
+	// the Silence resource is deleted.
+	silenceFinalizer = "monitoring.googleapis.com/silence"
+	// Period after which silences are checked against Alertmanager again. This ensures
+	// silences are recreated if Alertmanager lost its state.
+	silenceResyncPeriod = 5 * time.Minute
+)
+
+var errSilenceNotFound = errors.New("silence not found")
+
+func setupSilenceControllers(op *Operator) error {
+	err := ctrl.NewControllerManagedBy(op.manager).
+		Named("silences").
+		// Filter events without changes.
+		WithEventFilter(predicate.ResourceVersionChangedPredicate{}).
+		For(&monitoringv1.Silence{}).
+		Complete(newSilenceReconciler(op.manager.GetClient(), op.opts))
+	if err != nil {
+		return fmt.Errorf("create silences controller: %w", err)
+	}
+	return nil
+}
+
+type silenceReconciler struct {
+	client     client.Client
+	opts       Options
+	httpClient *http.Client
+	clock      clock.Clock
+	// Returns the base URL of the managed Alertmanager.
+	alertmanagerURL func(context.Context) (*url.URL, error)
+}
+
+func newSilenceReconciler(c client.Client, opts Options) *silenceReconciler {
+	r := &silenceReconciler{
+		client:     c,
+		opts:       opts,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		clock:      clock.RealClock{},
+	}
+	r.alertmanagerURL = r.managedAlertmanagerURL
+	return r
+}
+
+// managedAlertmanagerURL returns the URL of the managed Alertmanager service.
+func (r *silenceReconciler) managedAlertmanagerURL(ctx context.Context) (*url.URL, error) {
+	var svc corev1.Service
+	key := types.NamespacedName{Namespace: r.opts.OperatorNamespace, Name: NameAlertmanager}
+	if err := r.client.Get(ctx, key, &svc); err != nil {
+		return nil, fmt.Errorf("get managed Alertmanager service: %w", err)
+	}
+	// Alertmanager service should have one port defined.
+	if len(svc.Spec.Ports) == 0 {
+		return nil, errors.New("managed Alertmanager service has no ports")
+	}
+	return &url.URL{
+		Scheme: "http",
+		Host:   fmt.Sprintf("%s.%s:%d", svc.Name, svc.Namespace, svc.Spec.Ports[0].Port),
+	}, nil
+}
+
+func (r *silenceReconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	logger, _ := logr.FromContext(ctx)
+	logger.Info("reconciling silence")
+
+	var silence monitoringv1.Silence
+	if err := r.client.Get(ctx, req.NamespacedName, &silence); apierrors.IsNotFound(err) {
+		return reconcile.Result{}, nil
+	} else if err != nil {
+		return reconcile.Result{}, fmt.Errorf("get silence: %w", err)
+	}
+
+	if !silence.DeletionTimestamp.IsZero() {
+		if !controllerutil.ContainsFinalizer(&silence, silenceFinalizer) {
+			return reconcile.Result{}, nil
+		}
+		if err := r.expireSilence(ctx, silence.Status.SilenceID); err != nil {
+			return reconcile.Result{}, fmt.Errorf("expire silence: %w", err)
+		}
+		controllerutil.RemoveFinalizer(&silence, silenceFinalizer)
+		if err := r.client.Update(ctx, &silence); err != nil {
+			return reconcile.Result{}, fmt.Errorf("remove finalizer: %w", err)
+		}
+		return reconcile.Result{}, nil
+	}
+	if controllerutil.AddFinalizer(&silence, silenceFinalizer) {
+		if err := r.client.Update(ctx, &silence); err != nil {
+			return reconcile.Result{}, fmt.Errorf("add finalizer: %w", err)
+		}
+	}
+
+	status, requeueAfter, syncErr := r.syncSilence(ctx, &silence)
+	if syncErr != nil {
+		status.Message = syncErr.Error()
+	}
+	if status != silence.Status {
+		if err := patchSilenceStatus(ctx, r.client, &silence, status); err != nil {
+			return reconcile.Result{}, fmt.Errorf("patch silence status: %w", err)
+		}
+	}
+	if syncErr != nil {
+		return reconcile.Result{}, syncErr
+	}
+	return reconcile.Result{RequeueAfter: requeueAfter}, nil
+}
+
+// syncSilence ensures that Alertmanager holds a silence matching the Silence resource.
+// It returns the resulting status and the duration after which the silence should be
+// synchronized again.
+func (r *silenceReconciler) syncSilence(ctx context.Context, silence *monitoringv1.Silence) (monitoringv1.SilenceStatus, time.Duration, error) {
+	now := r.clock.Now()
+	status := monitoringv1.SilenceStatus{
+		ObservedGeneration: silence.Generation,
+		SilenceID:          silence.Status.SilenceID,
+		State:              silence.Status.State,
+	}
+	desired := alertmanagerSilenceFor(silence)
+
+	if !now.Before(desired.EndsAt) {
+		// The silence is over. Make sure it is no longer active in Alertmanager.
+		if err := r.expireSilence(ctx, status.SilenceID); err != nil {
+			return status, 0, fmt.Errorf("expire silence: %w", err)
+		}
+		status.State = monitoringv1.SilenceStateExpired
+		return status, 0, nil
+	}
+
+	var current *alertmanagerSilence
+	if status.SilenceID != "" {
+		s, err := r.getSilence(ctx, status.SilenceID)
+		if err != nil && !errors.Is(err, errSilenceNotFound) {
+			return status, 0, fmt.Errorf("get silence: %w", err)
+		}
+		current = s
+	}
+	if current == nil || current.Status.State == monitoringv1.SilenceStateExpired || !current.matches(desired, now) {
+		// Alertmanager updates the silence with the given ID in place if possible
+		// and otherwise replaces it with a new one.
+		if current != nil && current.Status.State != monitoringv1.SilenceStateExpired {
+			desired.ID = current.ID
+		}
+		id, err := r.postSilence(ctx, desired)
+		if err != nil {
+			return status, 0, fmt.Errorf("post silence: %w", err)
+		}
+		status.SilenceID = id
+	}
+
+	requeueAfter := silenceResyncPeriod
+	if now.Before(desired.StartsAt) {
+		status.State = monitoringv1.SilenceStatePending
+		if d := desired.StartsAt.Sub(now); d < requeueAfter {
+			requeueAfter = d
+		}
+	} else {
+		status.State = monitoringv1.SilenceStateActive
+	}
+	if d := desired.EndsAt.Sub(now); d < requeueAfter {
+		requeueAfter = d
+	}
+	return status, requeueAfter, nil
+}
+
+func patchSilenceStatus(ctx context.Context, kubeClient client.Client, obj client.Object, status monitoringv1.SilenceStatus) error {
+	patchStatus := map[string]interface{}{
+		"observedGeneration": status.ObservedGeneration,
+		"silenceID":          status.SilenceID,
+		"state":              status.State,
+		"message":            status.Message,
+	}
+	patchObject := map[string]interface{}{"status": patchStatus}
+
+	patchBytes, err := json.Marshal(patchObject)
+	if err != nil {
+		return err
+	}
+	patch := client.RawPatch(types.MergePatchType, patchBytes)
+	return kubeClient.Status().Patch(ctx, obj, patch)
+}
+
+// alertmanagerSilence is a silence as represented by the Alertmanager v2 API.
+type alertmanagerSilence struct {
+	ID        string                `json:"id,omitempty"`
+	Matchers  []alertmanagerMatcher `json:"matchers"`
+	StartsAt  time.Time             `json:"startsAt"`
+	EndsAt    time.Time             `json:"endsAt"`
+	CreatedBy string                `json:"createdBy"`
+	Comment   string                `json:"comment"`
+	Status    struct {
+		State monitoringv1.SilenceState `json:"state"`
+	} `json:"status,omitempty"`
+}
+
+type alertmanagerMatcher struct {
+	Name    string `json:"name"`
+	Value   string `json:"value"`
+	IsRegex bool   `json:"isRegex"`
+	IsEqual bool   `json:"isEqual"`
+}
+
+// alertmanagerSilenceFor converts the Silence resource into an Alertmanager silence
+// that is scoped to the namespace of the resource.
+func alertmanagerSilenceFor(silence *monitoringv1.Silence) *alertmanagerSilence {
+	s := &alertmanagerSilence{
+		StartsAt:  silence.CreationTimestamp.Time,
+		EndsAt:    silence.Spec.EndsAt.Time,
+		CreatedBy: silence.Spec.CreatedBy,
+		Comment:   silence.Spec.Comment,
+	}
+	if silence.Spec.StartsAt != nil {
+		s.StartsAt = silence.Spec.StartsAt.Time
+	}
+	if s.CreatedBy == "" {
+		s.CreatedBy = NameOperator
+	}
+	if s.Comment == "" {
+		s.Comment = fmt.Sprintf("Managed by Silence %s/%s", silence.Namespace, silence.Name)
+	}
+	for _, m := range silence.Spec.Matchers {
+		s.Matchers = append(s.Matchers, alertmanagerMatcher{
+			Name:    m.Name,
+			Value:   m.Value,
+			IsRegex: m.Type == "=~" || m.Type == "!~",
+			IsEqual: m.Type != "!=" && m.Type != "!~",
+		})
+	}
+	s.Matchers = append(s.Matchers, alertmanagerMatcher{
+		Name:    export.KeyNamespace,
+		Value:   silence.Namespace,
+		IsEqual: true,
+	})
+	sortMatchers(s.Matchers)
+	return s
+}
+
+func sortMatchers(ms []alertmanagerMatcher) {
+	sort.Slice(ms, func(i, j int) bool {
+		if ms[i].Name != ms[j].Name {
+			return ms[i].Name < ms[j].Name
+		}
+		return ms[i].Value < ms[j].Value
+	})
+}
+
+// matches returns true if the silence in Alertmanager is equivalent to the desired one.
+func (s *alertmanagerSilence) matches(desired *alertmanagerSilence, now time.Time) bool {
+	ms := append([]alertmanagerMatcher{}, s.Matchers...)
+	sortMatchers(ms)
+	if len(ms) != len(desired.Matchers) {
+		return false
+	}
+	for i := range ms {
+		if ms[i] != desired.Matchers[i] {
+			return false
+		}
+	}
+	// Alertmanager moves the start of a silence to the time it was created if it
+	// starts in the past. So only compare start times that are still in the future.
+	if now.Before(desired.StartsAt) && !s.StartsAt.Equal(desired.StartsAt) {
+		return false
+	}
+	return s.EndsAt.Equal(desired.EndsAt) &&
+		s.CreatedBy == desired.CreatedBy &&
+		s.Comment == desired.Comment
+}
+
+func (r *silenceReconciler) getSilence(ctx context.Context, id string) (*alertmanagerSilence, error) {
+	var s alertmanagerSilence
+	if err := r.doAlertmanagerRequest(ctx, http.MethodGet, path.Join("/api/v2/silence", id), nil, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (r *silenceReconciler) postSilence(ctx context.Context, s *alertmanagerSilence) (string, error) {
+	var resp struct {
+		SilenceID string `json:"silenceID"`
+	}
+	if err := r.doAlertmanagerRequest(ctx, http.MethodPost, "/api/v2/silences", s, &resp); err != nil {
+		return "", err
+	}
+	return resp.SilenceID, nil
+}
+
+// expireSilence expires the silence with the given ID if it is not expired already.
+func (r *silenceReconciler) expireSilence(ctx context.Context, id string) error {
+	if id == "" {
+		return nil
+	}
+	s, err := r.getSilence(ctx, id)
+	if errors.Is(err, errSilenceNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if s.Status.State == monitoringv1.SilenceStateExpired {
+		return nil
+	}
+	err = r.doAlertmanagerRequest(ctx, http.MethodDelete, path.Join("/api/v2/silence", id), nil, nil)
+	if errors.Is(err, errSilenceNotFound) {
+		return nil
+	}
+	return err
+}
+
+func (r *silenceReconciler) doAlertmanagerRequest(ctx context.Context, method, p string, in, out interface{}) error {
+	u, err := r.alertmanagerURL(ctx)
+	if err != nil {
+		return err
+	}
+	u.Path = path.Join(u.Path, p)
+
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("marshal request: %w", err)
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return errSilenceNotFound
+	}
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
+
+type silenceValidator struct{}
+
+func (v *silenceValidator) ValidateCreate(ctx context.Context, o runtime.Object) error {
+	return o.(*monitoringv1.Silence).Validate()
+}
+
+func (v *silenceValidator) ValidateUpdate(ctx context.Context, _, o runtime.Object) error {
+	return v.ValidateCreate(ctx, o)
+}
+
+func (v *silenceValidator) ValidateDelete(ctx context.Context, o runtime.Object) error {
+	return nil
+}
@@ -0,0 +1,346 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/testr"
+	"github.com/google/go-cmp/cmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clocktesting "k8s.io/utils/clock/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+)
+
+// fakeAlertmanager implements the silence endpoints of the Alertmanager v2 API.
+type fakeAlertmanager struct {
+	mtx      sync.Mutex
+	nextID   int
+	silences map[string]*alertmanagerSilence
+	now      func() time.Time
+}
+
+func (am *fakeAlertmanager) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	am.mtx.Lock()
+	defer am.mtx.Unlock()
+
+	switch {
+	case req.Method == http.MethodPost && req.URL.Path == "/api/v2/silences":
+		var s alertmanagerSilence
+		if err := json.NewDecoder(req.Body).Decode(&s); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if s.ID == "" {
+			am.nextID++
+			s.ID = fmt.Sprintf("silence-%d", am.nextID)
+		} else if _, ok := am.silences[s.ID]; !ok {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		if s.StartsAt.Before(am.now()) {
+			s.StartsAt = am.now()
+		}
+		s.Status.State = monitoringv1.SilenceStateActive
+		am.silences[s.ID] = &s
+		json.NewEncoder(w).Encode(map[string]string{"silenceID": s.ID})
+	case strings.HasPrefix(req.URL.Path, "/api/v2/silence/"):
+		s, ok := am.silences[strings.TrimPrefix(req.URL.Path, "/api/v2/silence/")]
+		if !ok {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		switch req.Method {
+		case http.MethodGet:
+			json.NewEncoder(w).Encode(s)
+		case http.MethodDelete:
+			if s.Status.State == monitoringv1.SilenceStateExpired {
+				http.Error(w, "already expired", http.StatusInternalServerError)
+				return
+			}
+			s.Status.State = monitoringv1.SilenceStateExpired
+		}
+	default:
+		http.Error(w, "not found", http.StatusNotFound)
+	}
+}
+
+func TestSilenceReconciler(t *testing.T) {
+	logger := testr.New(t)
+	ctx := logr.NewContext(context.Background(), logger)
+
+	scheme, err := NewScheme()
+	if err != nil {
+		t.Fatal("Unable to get scheme")
+	}
+	now := time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+	clock := clocktesting.NewFakeClock(now)
+
+	am := &fakeAlertmanager{
+		silences: map[string]*alertmanagerSilence{},
+		now:      clock.Now,
+	}
+	server := httptest.NewServer(am)
+	defer server.Close()
+
+	silence := &monitoringv1.Silence{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "maintenance",
+			Namespace:         "team-a",
+			Generation:        1,
+			CreationTimestamp: metav1.NewTime(now),
+		},
+		Spec: monitoringv1.SilenceSpec{
+			Matchers: []monitoringv1.SilenceMatcher{
+				{Name: "alertname", Value: "HighLatency"},
+				{Name: "instance", Value: "db-.*", Type: "=~"},
+			},
+			EndsAt:  metav1.NewTime(now.Add(time.Hour)),
+			Comment: "database maintenance",
+		},
+	}
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(silence).Build()
+
+	r := newSilenceReconciler(kubeClient, Options{})
+	r.clock = clock
+	r.alertmanagerURL = func(context.Context) (*url.URL, error) {
+		return url.Parse(server.URL)
+	}
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "team-a", Name: "maintenance"}}
+
+	reconcileAndGet := func() (reconcile.Result, *monitoringv1.Silence) {
+		t.Helper()
+		res, err := r.Reconcile(ctx, req)
+		if err != nil {
+			t.Fatalf("reconcile: %s", err)
+		}
+		var got monitoringv1.Silence
+		if err := kubeClient.Get(ctx, req.NamespacedName, &got); client.IgnoreNotFound(err) != nil {
+			t.Fatalf("get silence: %s", err)
+		}
+		return res, &got
+	}
+
+	// Initial reconciliation creates the silence in Alertmanager scoped to the namespace.
+	res, got := reconcileAndGet()
+	if diff := cmp.Diff(monitoringv1.SilenceStatus{
+		ObservedGeneration: 1,
+		SilenceID:          "silence-1",
+		State:              monitoringv1.SilenceStateActive,
+	}, got.Status); diff != "" {
+		t.Fatalf("unexpected status (-want, +got): %s", diff)
+	}
+	if res.RequeueAfter != silenceResyncPeriod {
+		t.Errorf("expected requeue after %s but got %s", silenceResyncPeriod, res.RequeueAfter)
+	}
+	if !strings.Contains(strings.Join(got.Finalizers, ","), silenceFinalizer) {
+		t.Errorf("expected finalizer to be set, got %v", got.Finalizers)
+	}
+	wantMatchers := []alertmanagerMatcher{
+		{Name: "alertname", Value: "HighLatency", IsEqual: true},
+		{Name: "instance", Value: "db-.*", IsRegex: true, IsEqual: true},
+		{Name: "namespace", Value: "team-a", IsEqual: true},
+	}
+	if diff := cmp.Diff(wantMatchers, am.silences["silence-1"].Matchers); diff != "" {
+		t.Fatalf("unexpected matchers (-want, +got): %s", diff)
+	}
+
+	// Reconciling an unchanged silence must not create a new one.
+	reconcileAndGet()
+	if len(am.silences) != 1 {
+		t.Fatalf("expected 1 silence but got %d", len(am.silences))
+	}
+
+	// A silence lost by Alertmanager is recreated.
+	delete(am.silences, "silence-1")
+	_, got = reconcileAndGet()
+	if got.Status.SilenceID != "silence-2" {
+		t.Fatalf("expected silence to be recreated, got ID %q", got.Status.SilenceID)
+	}
+
+	// Updates to the spec are propagated to the existing silence.
+	got.Spec.EndsAt = metav1.NewTime(now.Add(2 * time.Hour))
+	got.Generation = 2
+	if err := kubeClient.Update(ctx, got); err != nil {
+		t.Fatal(err)
+	}
+	_, got = reconcileAndGet()
+	if got.Status.SilenceID != "silence-2" || got.Status.ObservedGeneration != 2 {
+		t.Fatalf("unexpected status %+v", got.Status)
+	}
+	if want := now.Add(2 * time.Hour); !am.silences["silence-2"].EndsAt.Equal(want) {
+		t.Fatalf("expected silence to end at %s but got %s", want, am.silences["silence-2"].EndsAt)
+	}
+
+	// Deleting the resource expires the silence and removes the finalizer.
+	if err := kubeClient.Delete(ctx, got); err != nil {
+		t.Fatal(err)
+	}
+	_, got = reconcileAndGet()
+	if state := am.silences["silence-2"].Status.State; state != monitoringv1.SilenceStateExpired {
+		t.Fatalf("expected silence to be expired but got state %q", state)
+	}
+	if len(got.Finalizers) > 0 {
+		t.Fatalf("expected finalizer to be removed, got %v", got.Finalizers)
+	}
+}
+
+func TestSilenceReconcilerSchedule(t *testing.T) {
+	logger := testr.New(t)
+	ctx := logr.NewContext(context.Background(), logger)
+
+	scheme, err := NewScheme()
+	if err != nil {
+		t.Fatal("Unable to get scheme")
+	}
+	now := time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+	clock := clocktesting.NewFakeClock(now)
+
+	am := &fakeAlertmanager{
+		silences: map[string]*alertmanagerSilence{},
+		now:      clock.Now,
+	}
+	server := httptest.NewServer(am)
+	defer server.Close()
+
+	startsAt := metav1.NewTime(now.Add(time.Minute))
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(&monitoringv1.Silence{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "upgrade",
+			Namespace: "team-a",
+		},
+		Spec: monitoringv1.SilenceSpec{
+			Matchers: []monitoringv1.SilenceMatcher{{Name: "severity", Value: "critical", Type: "!="}},
+			StartsAt: &startsAt,
+			EndsAt:   metav1.NewTime(now.Add(3 * time.Minute)),
+		},
+	}).Build()
+
+	r := newSilenceReconciler(kubeClient, Options{})
+	r.clock = clock
+	r.alertmanagerURL = func(context.Context) (*url.URL, error) {
+		return url.Parse(server.URL)
+	}
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "team-a", Name: "upgrade"}}
+
+	cases := []struct {
+		advance     time.Duration
+		wantState   monitoringv1.SilenceState
+		wantRequeue time.Duration
+	}{
+		{0, monitoringv1.SilenceStatePending, time.Minute},
+		{time.Minute, monitoringv1.SilenceStateActive, 2 * time.Minute},
+		{2 * time.Minute, monitoringv1.SilenceStateExpired, 0},
+	}
+	for i, c := range cases {
+		clock.Step(c.advance)
+
+		res, err := r.Reconcile(ctx, req)
+		if err != nil {
+			t.Fatalf("case %d: reconcile: %s", i, err)
+		}
+		var got monitoringv1.Silence
+		if err := kubeClient.Get(ctx, req.NamespacedName, &got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Status.State != c.wantState {
+			t.Errorf("case %d: expected state %q but got %q", i, c.wantState, got.Status.State)
+		}
+		if res.RequeueAfter != c.wantRequeue {
+			t.Errorf("case %d: expected requeue after %s but got %s", i, c.wantRequeue, res.RequeueAfter)
+		}
+	}
+	if state := am.silences["silence-1"].Status.State; state != monitoringv1.SilenceStateExpired {
+		t.Errorf("expected silence to be expired in Alertmanager but got state %q", state)
+	}
+}
+
+func TestSilenceValidator(t *testing.T) {
+	now := time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		desc    string
+		spec    monitoringv1.SilenceSpec
+		wantErr bool
+	}{
+		{
+			desc: "valid",
+			spec: monitoringv1.SilenceSpec{
+				Matchers: []monitoringv1.SilenceMatcher{{Name: "alertname", Value: "A.*", Type: "=~"}},
+				EndsAt:   metav1.NewTime(now),
+			},
+		}, {
+			desc: "no matchers",
+			spec: monitoringv1.SilenceSpec{
+				EndsAt: metav1.NewTime(now),
+			},
+			wantErr: true,
+		}, {
+			desc: "namespace matcher",
+			spec: monitoringv1.SilenceSpec{
+				Matchers: []monitoringv1.SilenceMatcher{{Name: "namespace", Value: "other"}},
+				EndsAt:   metav1.NewTime(now),
+			},
+			wantErr: true,
+		}, {
+			desc: "invalid regex",
+			spec: monitoringv1.SilenceSpec{
+				Matchers: []monitoringv1.SilenceMatcher{{Name: "alertname", Value: "(", Type: "=~"}},
+				EndsAt:   metav1.NewTime(now),
+			},
+			wantErr: true,
+		}, {
+			desc: "missing end",
+			spec: monitoringv1.SilenceSpec{
+				Matchers: []monitoringv1.SilenceMatcher{{Name: "alertname", Value: "A"}},
+			},
+			wantErr: true,
+		}, {
+			desc: "starts after end",
+			spec: monitoringv1.SilenceSpec{
+				Matchers: []monitoringv1.SilenceMatcher{{Name: "alertname", Value: "A"}},
+				StartsAt: &metav1.Time{Time: now.Add(time.Hour)},
+				EndsAt:   metav1.NewTime(now),
+			},
+			wantErr: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			v := &silenceValidator{}
+			err := v.ValidateCreate(context.Background(), &monitoringv1.Silence{Spec: c.spec})
+			if err == nil && c.wantErr {
+				t.Fatalf("expected error but got none")
+			}
+			if err != nil && !c.wantErr {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		})
+	}
+}
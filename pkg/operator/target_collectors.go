@@ -0,0 +1,100 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"syscall"
+
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+)
+
+// Maximum number of failed collectors listed in an endpoint status.
+const maxFailedCollectors = 10
+
+var errNoPodIP = errors.New("pod does not have IP allocated")
+
+// collectorStatusError is returned if a collector responded with an unexpected HTTP
+// status code.
+type collectorStatusError struct {
+	statusCode int
+	err        error
+}
+
+func (e *collectorStatusError) Error() string {
+	return e.err.Error()
+}
+
+func (e *collectorStatusError) Unwrap() error {
+	return e.err
+}
+
+// fetchErrorClass returns the class of an error of fetching the targets of a collector.
+// Unlike the error itself, it does not contain addresses and is stable across polls.
+func fetchErrorClass(err error) string {
+	var (
+		netErr          net.Error
+		statusErr       *collectorStatusError
+		verificationErr *tls.CertificateVerificationError
+		authorityErr    x509.UnknownAuthorityError
+	)
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, errNoPodIP):
+		return "no pod IP"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "connection refused"
+	case errors.As(err, &verificationErr), errors.As(err, &authorityErr):
+		return "TLS verification failed"
+	case errors.As(err, &statusErr):
+		return fmt.Sprintf("HTTP %d", statusErr.statusCode)
+	default:
+		return "unknown error"
+	}
+}
+
+// addFailedCollectors lists the collectors whose targets could not be fetched in all
+// endpoint statuses, as each of them may have scraped targets of any endpoint.
+func addFailedCollectors(endpointMap map[string][]monitoringv1.ScrapeEndpointStatus, states []*collectorState) {
+	var failed []string
+	for _, state := range states {
+		if state != nil && state.fetchError != "" {
+			failed = append(failed, fmt.Sprintf("%s: %s", state.pod, state.fetchError))
+		}
+	}
+	if len(failed) == 0 {
+		return
+	}
+	sort.Strings(failed)
+	if len(failed) > maxFailedCollectors {
+		failed = append(failed[:maxFailedCollectors], fmt.Sprintf("and %d more", len(failed)-maxFailedCollectors))
+	}
+	for _, endpointStatuses := range endpointMap {
+		for i := range endpointStatuses {
+			endpointStatuses[i].FailedCollectors = failed
+		}
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+)
+
+func TestFetchErrorClass(t *testing.T) {
+	cases := []struct {
+		err  error
+		want string
+	}{
+		{err: nil, want: ""},
+		{err: errNoPodIP, want: "no pod IP"},
+		{err: fmt.Errorf("unable to fetch targets: %w", context.DeadlineExceeded), want: "timeout"},
+		{err: fmt.Errorf("unable to fetch targets: %w", context.Canceled), want: "canceled"},
+		{
+			err: fmt.Errorf("unable to fetch targets: %w", &url.Error{
+				Op:  "Get",
+				URL: "http://10.0.0.1:19090/api/v1/targets",
+				Err: &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)},
+			}),
+			want: "connection refused",
+		},
+		{
+			err:  &collectorStatusError{statusCode: 403, err: errors.New("unable to decode targets with status code 403")},
+			want: "HTTP 403",
+		},
+		{err: errors.New("unable to fetch targets: bad_data: error"), want: "unknown error"},
+	}
+	for _, c := range cases {
+		if got := fetchErrorClass(c.err); got != c.want {
+			t.Errorf("expected class %q for error %v, got %q", c.want, c.err, got)
+		}
+	}
+}
+
+func TestAddFailedCollectors(t *testing.T) {
+	endpointMap := map[string][]monitoringv1.ScrapeEndpointStatus{
+		"PodMonitoring/gmp-test/a": {{Name: "PodMonitoring/gmp-test/a/metrics"}},
+		"PodMonitoring/gmp-test/b": {{Name: "PodMonitoring/gmp-test/b/metrics"}},
+	}
+	states := []*collectorState{
+		{pod: "collector-c", fetchError: "timeout"},
+		{pod: "collector-b"},
+		{pod: "collector-a", fetchError: "connection refused"},
+	}
+	addFailedCollectors(endpointMap, states)
+
+	want := []string{"collector-a: connection refused", "collector-c: timeout"}
+	for job, statuses := range endpointMap {
+		if diff := cmp.Diff(want, statuses[0].FailedCollectors); diff != "" {
+			t.Errorf("unexpected failed collectors of %s (-want, +got): %s", job, diff)
+		}
+	}
+
+	// The list is truncated.
+	states = nil
+	for i := 0; i < maxFailedCollectors+2; i++ {
+		states = append(states, &collectorState{pod: fmt.Sprintf("collector-%02d", i), fetchError: "timeout"})
+	}
+	addFailedCollectors(endpointMap, states)
+	got := endpointMap["PodMonitoring/gmp-test/a"][0].FailedCollectors
+	if len(got) != maxFailedCollectors+1 || got[maxFailedCollectors] != "and 2 more" {
+		t.Errorf("unexpected failed collectors: %v", got)
+	}
+}
@@ -0,0 +1,204 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	prometheusv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	authnv1 "k8s.io/api/authentication/v1"
+	authzv1 "k8s.io/api/authorization/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Path under which the operator serves the last fetched targets of all collectors.
+const targetsDebugPath = "/debug/targets"
+
+// targetsSnapshot holds the targets fetched from all collectors in the last poll.
+type targetsSnapshot struct {
+	mtx        sync.Mutex
+	time       time.Time
+	collectors int
+	targets    []*prometheusv1.TargetsResult
+}
+
+// set replaces the snapshot with the targets fetched at the given time. A nil entry
+// represents a collector whose targets could not be fetched.
+func (s *targetsSnapshot) set(t time.Time, targets []*prometheusv1.TargetsResult) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.time = t
+	s.collectors = len(targets)
+	s.targets = targets
+}
+
+// targetsView is the merged view of the targets of all collectors.
+type targetsView struct {
+	// Time at which the targets were fetched. Zero if no poll happened yet on this replica,
+	// e.g. because it is not the leader.
+	FetchTime time.Time `json:"fetchTime"`
+	// Number of collectors whose targets were fetched and number of collectors that could
+	// not be reached.
+	Collectors            int `json:"collectors"`
+	UnreachableCollectors int `json:"unreachableCollectors"`
+	// Active targets grouped by scrape pool.
+	ScrapePools []scrapePoolView `json:"scrapePools"`
+}
+
+type scrapePoolView struct {
+	Name             string                      `json:"name"`
+	ActiveTargets    int                         `json:"activeTargets"`
+	UnhealthyTargets int                         `json:"unhealthyTargets"`
+	Targets          []prometheusv1.ActiveTarget `json:"targets"`
+}
+
+// view returns the merged view of the targets in the snapshot.
+func (s *targetsSnapshot) view() *targetsView {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	v := &targetsView{
+		FetchTime:   s.time,
+		Collectors:  s.collectors,
+		ScrapePools: []scrapePoolView{},
+	}
+	pools := map[string]*scrapePoolView{}
+
+	for _, result := range s.targets {
+		if result == nil {
+			v.UnreachableCollectors++
+			continue
+		}
+		for _, target := range result.Active {
+			pool, ok := pools[target.ScrapePool]
+			if !ok {
+				pool = &scrapePoolView{Name: target.ScrapePool}
+				pools[target.ScrapePool] = pool
+			}
+			pool.ActiveTargets++
+			if target.Health != prometheusv1.HealthGood {
+				pool.UnhealthyTargets++
+			}
+			pool.Targets = append(pool.Targets, target)
+		}
+	}
+	for _, pool := range pools {
+		sort.Slice(pool.Targets, func(i, j int) bool {
+			return pool.Targets[i].ScrapeURL < pool.Targets[j].ScrapeURL
+		})
+		v.ScrapePools = append(v.ScrapePools, *pool)
+	}
+	sort.Slice(v.ScrapePools, func(i, j int) bool {
+		return v.ScrapePools[i].Name < v.ScrapePools[j].Name
+	})
+	return v
+}
+
+var targetsDebugTemplate = template.Must(template.New("targets").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Targets</title></head>
+<body>
+<h1>Targets</h1>
+{{if .FetchTime.IsZero}}<p>No targets were fetched on this operator replica yet.</p>
+{{else}}<p>Fetched at {{.FetchTime}} from {{.Collectors}} collectors, {{.UnreachableCollectors}} unreachable.</p>
+{{end}}{{range .ScrapePools}}<h2>{{.Name}} ({{.UnhealthyTargets}}/{{.ActiveTargets}} unhealthy)</h2>
+<table border="1">
+<tr><th>Endpoint</th><th>Health</th><th>Labels</th><th>Last scrape</th><th>Duration</th><th>Error</th></tr>
+{{range .Targets}}<tr><td>{{.ScrapeURL}}</td><td>{{.Health}}</td><td>{{.Labels}}</td><td>{{.LastScrape}}</td><td>{{.LastScrapeDuration}}s</td><td>{{.LastError}}</td></tr>
+{{end}}</table>
+{{end}}</body>
+</html>
+`))
+
+// targetsDebugHandler serves the merged targets of the last poll as JSON, or as HTML if
+// requested by the client. Requests are authenticated and authorized against the
+// Kubernetes API server, i.e. the caller's bearer token must be allowed to get the
+// non-resource URL of the handler.
+type targetsDebugHandler struct {
+	logger     logr.Logger
+	kubeClient client.Client
+	snapshot   *targetsSnapshot
+}
+
+func (h *targetsDebugHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if status := h.authorize(r); status != http.StatusOK {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	v := h.snapshot.view()
+
+	if r.URL.Query().Get("format") == "html" || strings.Contains(r.Header.Get("Accept"), "text/html") {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := targetsDebugTemplate.Execute(w, v); err != nil {
+			h.logger.Error(err, "rendering targets")
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		h.logger.Error(err, "encoding targets")
+	}
+}
+
+// authorize authenticates the bearer token of the request through a TokenReview and
+// checks through a SubjectAccessReview that the user may get the request path.
+// It returns the HTTP status code to respond with if the request is denied.
+func (h *targetsDebugHandler) authorize(r *http.Request) int {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return http.StatusUnauthorized
+	}
+	tr := &authnv1.TokenReview{
+		Spec: authnv1.TokenReviewSpec{Token: token},
+	}
+	if err := h.kubeClient.Create(r.Context(), tr); err != nil {
+		h.logger.Error(err, "creating token review")
+		return http.StatusInternalServerError
+	}
+	if !tr.Status.Authenticated {
+		return http.StatusUnauthorized
+	}
+	extra := map[string]authzv1.ExtraValue{}
+	for k, v := range tr.Status.User.Extra {
+		extra[k] = authzv1.ExtraValue(v)
+	}
+	sar := &authzv1.SubjectAccessReview{
+		Spec: authzv1.SubjectAccessReviewSpec{
+			User:   tr.Status.User.Username,
+			UID:    tr.Status.User.UID,
+			Groups: tr.Status.User.Groups,
+			Extra:  extra,
+			NonResourceAttributes: &authzv1.NonResourceAttributes{
+				Path: r.URL.Path,
+				Verb: "get",
+			},
+		},
+	}
+	if err := h.kubeClient.Create(r.Context(), sar); err != nil {
+		h.logger.Error(err, "creating subject access review")
+		return http.StatusInternalServerError
+	}
+	if !sar.Status.Allowed {
+		return http.StatusForbidden
+	}
+	return http.StatusOK
+}
@@ -0,0 +1,146 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/google/go-cmp/cmp"
+	prometheusv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	authnv1 "k8s.io/api/authentication/v1"
+	authzv1 "k8s.io/api/authorization/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// reviewClient answers TokenReviews and SubjectAccessReviews like the API server
+// would for a fixed set of tokens and allowed users.
+type reviewClient struct {
+	client.Client
+	tokens  map[string]string
+	allowed map[string]bool
+}
+
+func (c *reviewClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	switch o := obj.(type) {
+	case *authnv1.TokenReview:
+		user, ok := c.tokens[o.Spec.Token]
+		o.Status.Authenticated = ok
+		o.Status.User.Username = user
+	case *authzv1.SubjectAccessReview:
+		o.Status.Allowed = c.allowed[o.Spec.User] && o.Spec.NonResourceAttributes.Path == targetsDebugPath
+	}
+	return nil
+}
+
+func TestTargetsDebugHandler(t *testing.T) {
+	snapshot := &targetsSnapshot{}
+	snapshot.set(time.Date(2022, time.January, 4, 0, 0, 0, 0, time.UTC), []*prometheusv1.TargetsResult{
+		{
+			Active: []prometheusv1.ActiveTarget{{
+				ScrapePool: "PodMonitoring/gmp-test/prom-example-1/metrics",
+				ScrapeURL:  "http://10.0.0.2:8080/metrics",
+				Health:     prometheusv1.HealthBad,
+				LastError:  "connection refused",
+			}, {
+				ScrapePool: "ClusterPodMonitoring/prom-example-2/metrics",
+				ScrapeURL:  "http://10.0.0.3:8080/metrics",
+				Health:     prometheusv1.HealthGood,
+			}},
+		},
+		{
+			Active: []prometheusv1.ActiveTarget{{
+				ScrapePool: "PodMonitoring/gmp-test/prom-example-1/metrics",
+				ScrapeURL:  "http://10.0.0.1:8080/metrics",
+				Health:     prometheusv1.HealthGood,
+			}},
+		},
+		nil,
+	})
+	h := &targetsDebugHandler{
+		logger: testr.New(t),
+		kubeClient: &reviewClient{
+			tokens:  map[string]string{"token-a": "alice", "token-b": "bob"},
+			allowed: map[string]bool{"alice": true},
+		},
+		snapshot: snapshot,
+	}
+
+	get := func(token, query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, targetsDebugPath+query, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := get("", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d without token, got %d", http.StatusUnauthorized, w.Code)
+	}
+	if w := get("invalid", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d for invalid token, got %d", http.StatusUnauthorized, w.Code)
+	}
+	if w := get("token-b", ""); w.Code != http.StatusForbidden {
+		t.Errorf("expected status %d for unauthorized user, got %d", http.StatusForbidden, w.Code)
+	}
+
+	w := get("token-a", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body)
+	}
+	var got targetsView
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Collectors != 3 || got.UnreachableCollectors != 1 {
+		t.Errorf("unexpected collectors %d, unreachable %d", got.Collectors, got.UnreachableCollectors)
+	}
+	type pool struct {
+		name              string
+		active, unhealthy int
+		urls              []string
+	}
+	var gotPools []pool
+	for _, p := range got.ScrapePools {
+		var urls []string
+		for _, target := range p.Targets {
+			urls = append(urls, target.ScrapeURL)
+		}
+		gotPools = append(gotPools, pool{p.Name, p.ActiveTargets, p.UnhealthyTargets, urls})
+	}
+	wantPools := []pool{
+		{"ClusterPodMonitoring/prom-example-2/metrics", 1, 0, []string{"http://10.0.0.3:8080/metrics"}},
+		{"PodMonitoring/gmp-test/prom-example-1/metrics", 2, 1, []string{"http://10.0.0.1:8080/metrics", "http://10.0.0.2:8080/metrics"}},
+	}
+	if diff := cmp.Diff(wantPools, gotPools, cmp.AllowUnexported(pool{})); diff != "" {
+		t.Errorf("unexpected scrape pools (-want, +got): %s", diff)
+	}
+
+	w = get("token-a", "?format=html")
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("unexpected content type %q", ct)
+	}
+	if !strings.Contains(w.Body.String(), "connection refused") {
+		t.Errorf("expected scrape error in HTML output: %s", w.Body)
+	}
+}
@@ -0,0 +1,334 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	prometheusv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+)
+
+// Metrics exposed by the collectors that describe the state of service discovery.
+const (
+	metricDiscoveredTargets  = "prometheus_sd_discovered_targets"
+	metricFailedConfigs      = "prometheus_sd_failed_configs"
+	metricKubernetesFailures = "prometheus_sd_kubernetes_failures_total"
+	metricTargetSyncFailed   = "prometheus_target_sync_failed_total"
+)
+
+// Errors reported in the endpoint statuses for the service discovery metrics.
+const (
+	discoveryErrorFailedConfigs      = "service discovery configuration failed to load"
+	discoveryErrorKubernetesFailures = "requests to the Kubernetes API failed"
+	discoveryErrorTargetSyncFailed   = "discovered targets failed to sync"
+)
+
+const (
+	// Duration after which the counters of a collector are forgotten if it was not
+	// polled again, e.g. because the pod was deleted.
+	discoveryCountersTTL = time.Hour
+	// Number of polls for which a failure counter must stay unchanged before its error
+	// is no longer reported, so that errors of intermittent failures don't flicker.
+	discoveryErrorPolls = 3
+)
+
+// collectorDiscovery is the service discovery state reported by a collector.
+type collectorDiscovery struct {
+	// Current number of discovered targets, before relabeling, by scrape pool.
+	discoveredTargets map[string]int64
+	// Errors by scrape pool.
+	errors map[string][]string
+}
+
+// discoveryCounters holds the values of the failure counters of a collector from the
+// previous poll and the number of polls since they last increased. Errors are reported
+// until the counters stayed unchanged for discoveryErrorPolls polls.
+type discoveryCounters struct {
+	time                time.Time
+	kubernetesFailures  float64
+	kubernetesUnchanged int
+	syncFailures        map[string]float64
+	syncUnchanged       map[string]int
+}
+
+// newGetCollectorStateFn returns a getCollectorStateFn that reads the service discovery
+// state from the metrics of the collector and queries the sample counts of its targets,
+// using TLS and authentication as configured in the options.
+func newGetCollectorStateFn(opts Options, caData []byte) (getCollectorStateFn, error) {
+	scheme, rt, err := collectorRoundTripper(opts, caData)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		mtx  sync.Mutex
+		last = map[string]*discoveryCounters{}
+	)
+	getDiscovery := func(families map[string]*dto.MetricFamily, pod *corev1.Pod) *collectorDiscovery {
+		key := pod.Namespace + "/" + pod.Name
+		now := time.Now()
+
+		mtx.Lock()
+		defer mtx.Unlock()
+
+		for k, counters := range last {
+			if now.Sub(counters.time) > discoveryCountersTTL {
+				delete(last, k)
+			}
+		}
+		discovery, counters := parseDiscovery(families, last[key])
+		counters.time = now
+		last[key] = counters
+		return discovery
+	}
+	return func(ctx context.Context, logger logr.Logger, port int32, pod *corev1.Pod, targets *prometheusv1.TargetsResult) (*collectorState, error) {
+		var state collectorState
+
+		families, metricsErr := getCollectorMetrics(ctx, scheme, rt, port, pod)
+		if metricsErr == nil {
+			state.discovery = getDiscovery(families, pod)
+			state.rejections = parseRejections(families, targets)
+			state.clockSkew = parseClockSkew(families)
+		}
+		var samplesErr error
+		state.samples, samplesErr = getSampleCounts(ctx, scheme, rt, port, pod, targets)
+		return &state, errors.Join(metricsErr, samplesErr)
+	}, nil
+}
+
+// getCollectorMetrics fetches the metrics of the collector in the pod.
+func getCollectorMetrics(ctx context.Context, scheme string, rt http.RoundTripper, port int32, pod *corev1.Pod) (map[string]*dto.MetricFamily, error) {
+	if pod.Status.PodIP == "" {
+		return nil, errNoPodIP
+	}
+	u := url.URL{
+		Scheme: scheme,
+		Host:   net.JoinHostPort(pod.Status.PodIP, strconv.Itoa(int(port))),
+		Path:   "/metrics",
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create request: %w", err)
+	}
+	req.Header.Set("Accept", string(expfmt.FmtText))
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch metrics: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to fetch metrics: unexpected status code %d", resp.StatusCode)
+	}
+	return parseMetrics(resp.Body)
+}
+
+func parseMetrics(r io.Reader) (map[string]*dto.MetricFamily, error) {
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(r)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse metrics: %w", err)
+	}
+	return families, nil
+}
+
+// parseDiscovery extracts the service discovery state from the metrics of a collector.
+// Failure counters are compared against their values of the previous poll, if any, and
+// their errors are reported until they stayed unchanged for discoveryErrorPolls polls.
+// Errors that are not specific to a scrape pool are reported for all scrape pools of
+// the collector. It returns the state and the counters to compare against next time.
+func parseDiscovery(families map[string]*dto.MetricFamily, prev *discoveryCounters) (*collectorDiscovery, *discoveryCounters) {
+	discovery := &collectorDiscovery{
+		discoveredTargets: map[string]int64{},
+		errors:            map[string][]string{},
+	}
+	counters := &discoveryCounters{
+		kubernetesUnchanged: discoveryErrorPolls,
+		syncFailures:        map[string]float64{},
+		syncUnchanged:       map[string]int{},
+	}
+	var globalErrors []string
+
+	for _, m := range metricsOf(families, metricDiscoveredTargets) {
+		// The notifier runs its own service discovery for Alertmanagers.
+		if labelValue(m, "name") != "scrape" {
+			continue
+		}
+		discovery.discoveredTargets[labelValue(m, "config")] = int64(m.GetGauge().GetValue())
+	}
+	for _, m := range metricsOf(families, metricFailedConfigs) {
+		if labelValue(m, "name") == "scrape" && m.GetGauge().GetValue() > 0 {
+			globalErrors = append(globalErrors, discoveryErrorFailedConfigs)
+		}
+	}
+	for _, m := range metricsOf(families, metricKubernetesFailures) {
+		counters.kubernetesFailures += m.GetCounter().GetValue()
+	}
+	if prev != nil {
+		counters.kubernetesUnchanged = pollsUnchanged(prev.kubernetesFailures, counters.kubernetesFailures, prev.kubernetesUnchanged)
+	}
+	if counters.kubernetesUnchanged < discoveryErrorPolls {
+		globalErrors = append(globalErrors, discoveryErrorKubernetesFailures)
+	}
+	for _, m := range metricsOf(families, metricTargetSyncFailed) {
+		pool := labelValue(m, "scrape_job")
+		counters.syncFailures[pool] = m.GetCounter().GetValue()
+		counters.syncUnchanged[pool] = discoveryErrorPolls
+
+		if prev != nil {
+			unchanged, ok := prev.syncUnchanged[pool]
+			if !ok {
+				unchanged = discoveryErrorPolls
+			}
+			counters.syncUnchanged[pool] = pollsUnchanged(prev.syncFailures[pool], counters.syncFailures[pool], unchanged)
+		}
+		if counters.syncUnchanged[pool] < discoveryErrorPolls {
+			discovery.errors[pool] = append(discovery.errors[pool], discoveryErrorTargetSyncFailed)
+		}
+	}
+	if len(globalErrors) > 0 {
+		for pool := range discovery.discoveredTargets {
+			discovery.errors[pool] = append(discovery.errors[pool], globalErrors...)
+		}
+	}
+	return discovery, counters
+}
+
+// pollsUnchanged returns the number of polls since the counter last increased, given
+// its value and number of unchanged polls as of the previous poll.
+func pollsUnchanged(prev, cur float64, prevUnchanged int) int {
+	if counterIncreased(prev, cur) {
+		return 0
+	}
+	if prevUnchanged < discoveryErrorPolls {
+		return prevUnchanged + 1
+	}
+	return discoveryErrorPolls
+}
+
+// counterIncreased returns whether the counter increased from prev to cur. A lower
+// current value indicates a counter reset, e.g. by a collector restart.
+func counterIncreased(prev, cur float64) bool {
+	return cur > prev || (cur < prev && cur > 0)
+}
+
+func metricsOf(families map[string]*dto.MetricFamily, name string) []*dto.Metric {
+	if mf, ok := families[name]; ok {
+		return mf.GetMetric()
+	}
+	return nil
+}
+
+func labelValue(m *dto.Metric, name string) string {
+	for _, l := range m.GetLabel() {
+		if l.GetName() == name {
+			return l.GetValue()
+		}
+	}
+	return ""
+}
+
+// addDiscoveryStatuses adds the service discovery state of the collectors to the endpoint
+// statuses. Endpoints that are known to service discovery but have no active targets get
+// an endpoint status without targets, so that endpoints that matched no pods can be told
+// apart from endpoints whose discovery is broken. Nil entries in states represent
+// collectors whose state could not be fetched.
+func addDiscoveryStatuses(endpointMap map[string][]monitoringv1.ScrapeEndpointStatus, states []*collectorState, now metav1.Time) {
+	var (
+		reported   int
+		discovered = map[string]int64{}
+		// Number of collectors reporting each error by scrape pool.
+		poolErrors = map[string]map[string]int{}
+	)
+	for _, state := range states {
+		if state == nil || state.discovery == nil {
+			continue
+		}
+		d := state.discovery
+		reported++
+		for pool, n := range d.discoveredTargets {
+			discovered[pool] += n
+		}
+		for pool, errs := range d.errors {
+			if _, ok := discovered[pool]; !ok {
+				discovered[pool] = 0
+			}
+			if poolErrors[pool] == nil {
+				poolErrors[pool] = map[string]int{}
+			}
+			for _, e := range errs {
+				poolErrors[pool][e]++
+			}
+		}
+	}
+	if reported == 0 {
+		return
+	}
+	collectorsFraction := strconv.FormatFloat(float64(reported)/float64(len(states)), 'f', -1, 64)
+
+	for pool, n := range discovered {
+		i := strings.LastIndex(pool, "/")
+		if i == -1 {
+			continue
+		}
+		job := pool[:i]
+
+		var status *monitoringv1.ScrapeEndpointStatus
+		for j := range endpointMap[job] {
+			if endpointMap[job][j].Name == pool {
+				status = &endpointMap[job][j]
+				break
+			}
+		}
+		if status == nil {
+			endpointMap[job] = append(endpointMap[job], monitoringv1.ScrapeEndpointStatus{
+				Name:               pool,
+				LastUpdateTime:     now,
+				CollectorsFraction: collectorsFraction,
+			})
+			status = &endpointMap[job][len(endpointMap[job])-1]
+		}
+		status.DiscoveredTargets = new(int64)
+		*status.DiscoveredTargets = n
+
+		for e, count := range poolErrors[pool] {
+			status.DiscoveryErrors = append(status.DiscoveryErrors, fmt.Sprintf("%s on %d collectors", e, count))
+		}
+		sort.Strings(status.DiscoveryErrors)
+	}
+	for job := range endpointMap {
+		endpointStatuses := endpointMap[job]
+		sort.SliceStable(endpointStatuses, func(i, j int) bool {
+			return endpointStatuses[i].Name < endpointStatuses[j].Name
+		})
+	}
+}
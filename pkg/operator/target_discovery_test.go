@@ -0,0 +1,236 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/google/go-cmp/cmp"
+	prometheusv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	dto "github.com/prometheus/client_model/go"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+)
+
+func TestParseDiscovery(t *testing.T) {
+	parse := func(text string, prev *discoveryCounters) (*collectorDiscovery, *discoveryCounters) {
+		t.Helper()
+		families, err := parseMetrics(strings.NewReader(text))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parseDiscovery(families, prev)
+	}
+	metrics := func(kubernetesFailures, syncFailures string) string {
+		return `# TYPE prometheus_sd_discovered_targets gauge
+prometheus_sd_discovered_targets{config="PodMonitoring/gmp-test/a/metrics",name="scrape"} 3
+prometheus_sd_discovered_targets{config="PodMonitoring/gmp-test/b/metrics",name="scrape"} 0
+prometheus_sd_discovered_targets{config="config-0",name="notify"} 1
+# TYPE prometheus_sd_failed_configs gauge
+prometheus_sd_failed_configs{name="scrape"} 0
+# TYPE prometheus_sd_kubernetes_failures_total counter
+prometheus_sd_kubernetes_failures_total ` + kubernetesFailures + `
+# TYPE prometheus_target_sync_failed_total counter
+prometheus_target_sync_failed_total{scrape_job="PodMonitoring/gmp-test/a/metrics"} ` + syncFailures + `
+prometheus_target_sync_failed_total{scrape_job="PodMonitoring/gmp-test/b/metrics"} 0
+`
+	}
+
+	// Counters are not reported without a previous value to compare against.
+	discovery, counters := parse(metrics("2", "1"), nil)
+	wantDiscovered := map[string]int64{
+		"PodMonitoring/gmp-test/a/metrics": 3,
+		"PodMonitoring/gmp-test/b/metrics": 0,
+	}
+	if diff := cmp.Diff(wantDiscovered, discovery.discoveredTargets); diff != "" {
+		t.Errorf("unexpected discovered targets (-want, +got): %s", diff)
+	}
+	if len(discovery.errors) != 0 {
+		t.Errorf("unexpected errors: %v", discovery.errors)
+	}
+
+	discovery, counters = parse(metrics("2", "3"), counters)
+	wantErrors := map[string][]string{
+		"PodMonitoring/gmp-test/a/metrics": {discoveryErrorTargetSyncFailed},
+	}
+	if diff := cmp.Diff(wantErrors, discovery.errors); diff != "" {
+		t.Errorf("unexpected errors (-want, +got): %s", diff)
+	}
+
+	// Kubernetes API failures affect all scrape pools of the collector. The sync error
+	// is still reported although its counter did not increase again.
+	discovery, counters = parse(metrics("5", "3"), counters)
+	wantErrors = map[string][]string{
+		"PodMonitoring/gmp-test/a/metrics": {discoveryErrorTargetSyncFailed, discoveryErrorKubernetesFailures},
+		"PodMonitoring/gmp-test/b/metrics": {discoveryErrorKubernetesFailures},
+	}
+	if diff := cmp.Diff(wantErrors, discovery.errors); diff != "" {
+		t.Errorf("unexpected errors (-want, +got): %s", diff)
+	}
+}
+
+func TestParseDiscovery_MultiplePolls(t *testing.T) {
+	metrics := func(kubernetesFailures, syncFailures int) map[string]*dto.MetricFamily {
+		t.Helper()
+		families, err := parseMetrics(strings.NewReader(fmt.Sprintf(`# TYPE prometheus_sd_discovered_targets gauge
+prometheus_sd_discovered_targets{config="PodMonitoring/gmp-test/a/metrics",name="scrape"} 3
+# TYPE prometheus_sd_kubernetes_failures_total counter
+prometheus_sd_kubernetes_failures_total %d
+# TYPE prometheus_target_sync_failed_total counter
+prometheus_target_sync_failed_total{scrape_job="PodMonitoring/gmp-test/a/metrics"} %d
+`, kubernetesFailures, syncFailures)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return families
+	}
+	const (
+		k8s  = discoveryErrorKubernetesFailures
+		sync = discoveryErrorTargetSyncFailed
+	)
+	// Errors are kept until their counter stayed unchanged for discoveryErrorPolls polls
+	// and are reported again as soon as it increases. Counter resets count as increases.
+	polls := []struct {
+		kubernetesFailures, syncFailures int
+		want                             []string
+	}{
+		{0, 0, nil},
+		{1, 0, []string{k8s}},
+		{1, 2, []string{sync, k8s}},
+		{1, 2, []string{sync, k8s}},
+		{1, 2, []string{sync}},
+		{1, 2, nil},
+		{1, 2, nil},
+		{2, 2, []string{k8s}},
+		{2, 1, []string{sync, k8s}},
+	}
+	var counters *discoveryCounters
+	for i, p := range polls {
+		var discovery *collectorDiscovery
+		discovery, counters = parseDiscovery(metrics(p.kubernetesFailures, p.syncFailures), counters)
+		if diff := cmp.Diff(p.want, discovery.errors["PodMonitoring/gmp-test/a/metrics"]); diff != "" {
+			t.Errorf("poll %d: unexpected errors (-want, +got): %s", i, diff)
+		}
+	}
+}
+
+func TestAddDiscoveryStatuses(t *testing.T) {
+	now := metav1.Now()
+	endpointMap, err := BuildEndpointStatuses([]*prometheusv1.TargetsResult{{
+		Active: []prometheusv1.ActiveTarget{{
+			ScrapePool: "PodMonitoring/gmp-test/a/metrics",
+			Health:     prometheusv1.HealthGood,
+		}},
+	}, {}}, &monitoringv1.TargetStatusSpec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addDiscoveryStatuses(endpointMap, []*collectorState{
+		{discovery: &collectorDiscovery{
+			discoveredTargets: map[string]int64{
+				"PodMonitoring/gmp-test/a/metrics": 2,
+				"PodMonitoring/gmp-test/a/other":   0,
+			},
+			errors: map[string][]string{
+				"PodMonitoring/gmp-test/a/other": {discoveryErrorFailedConfigs},
+			},
+		}},
+		{discovery: &collectorDiscovery{
+			discoveredTargets: map[string]int64{
+				"PodMonitoring/gmp-test/a/metrics": 1,
+				"PodMonitoring/gmp-test/a/other":   0,
+			},
+		}},
+		nil,
+	}, now)
+
+	statuses := endpointMap["PodMonitoring/gmp-test/a"]
+	if len(statuses) != 2 {
+		t.Fatalf("expected 2 endpoint statuses, got %d", len(statuses))
+	}
+	if statuses[0].ActiveTargets != 1 || *statuses[0].DiscoveredTargets != 3 || len(statuses[0].DiscoveryErrors) != 0 {
+		t.Errorf("unexpected status: %+v", statuses[0])
+	}
+	want := monitoringv1.ScrapeEndpointStatus{
+		Name:               "PodMonitoring/gmp-test/a/other",
+		LastUpdateTime:     now,
+		CollectorsFraction: "0.6666666666666666",
+		DiscoveredTargets:  new(int64),
+		DiscoveryErrors:    []string{discoveryErrorFailedConfigs + " on 1 collectors"},
+	}
+	if diff := cmp.Diff(want, statuses[1]); diff != "" {
+		t.Errorf("unexpected status (-want, +got): %s", diff)
+	}
+}
+
+func TestUpdateTargetStatus_Discovery(t *testing.T) {
+	pm := &monitoringv1.PodMonitoring{
+		ObjectMeta: metav1.ObjectMeta{Name: "prom-example-1", Namespace: "gmp-test"},
+	}
+	scheme, err := NewScheme()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(pm).Build()
+
+	update := func(discovery *collectorDiscovery) (monitoringv1.ScrapeEndpointStatus, monitoringv1.MonitoringCondition) {
+		t.Helper()
+		targets := []*prometheusv1.TargetsResult{{}}
+		if err := (&targetStatusReconciler{logger: testr.New(t), kubeClient: kubeClient}).updateTargetStatus(context.Background(), targets, []*collectorState{{discovery: discovery}}, nil); err != nil {
+			t.Fatal(err)
+		}
+		var got monitoringv1.PodMonitoring
+		if err := kubeClient.Get(context.Background(), client.ObjectKeyFromObject(pm), &got); err != nil {
+			t.Fatal(err)
+		}
+		if len(got.Status.EndpointStatuses) != 1 || len(got.Status.Conditions) != 1 {
+			t.Fatalf("unexpected status: %+v", got.Status)
+		}
+		return got.Status.EndpointStatuses[0], got.Status.Conditions[0]
+	}
+
+	// No pods matched the endpoint.
+	status, cond := update(&collectorDiscovery{
+		discoveredTargets: map[string]int64{"PodMonitoring/gmp-test/prom-example-1/metrics": 0},
+	})
+	if status.DiscoveredTargets == nil || *status.DiscoveredTargets != 0 || status.ActiveTargets != 0 {
+		t.Errorf("unexpected endpoint status: %+v", status)
+	}
+	if cond.Status != corev1.ConditionTrue {
+		t.Errorf("unexpected condition: %v", cond)
+	}
+
+	// Service discovery is broken.
+	status, cond = update(&collectorDiscovery{
+		discoveredTargets: map[string]int64{"PodMonitoring/gmp-test/prom-example-1/metrics": 0},
+		errors: map[string][]string{
+			"PodMonitoring/gmp-test/prom-example-1/metrics": {discoveryErrorKubernetesFailures},
+		},
+	})
+	if diff := cmp.Diff([]string{discoveryErrorKubernetesFailures + " on 1 collectors"}, status.DiscoveryErrors); diff != "" {
+		t.Errorf("unexpected discovery errors (-want, +got): %s", diff)
+	}
+	if cond.Status != corev1.ConditionFalse || cond.Reason != reasonDiscoveryFailed || cond.Message != "Service discovery failed for endpoints: metrics" {
+		t.Errorf("unexpected condition: %v", cond)
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+)
+
+const (
+	// Event reasons for target health transitions.
+	reasonTargetsUnhealthy   = "TargetsUnhealthy"
+	reasonTargetsHealthy     = "TargetsHealthy"
+	reasonTargetsDisappeared = "TargetsDisappeared"
+)
+
+// targetHealthEvents emits Events on PodMonitorings and ClusterPodMonitorings when
+// the health of one of their endpoints changes, so that `kubectl describe` shows why
+// scraping broke.
+type targetHealthEvents struct {
+	recorder record.EventRecorder
+	// Health of the endpoints observed in the previous poll by endpoint name.
+	last map[string]endpointHealth
+}
+
+type endpointHealth struct {
+	job     string
+	healthy bool
+}
+
+func newTargetHealthEvents(recorder record.EventRecorder) *targetHealthEvents {
+	return &targetHealthEvents{
+		recorder: recorder,
+		last:     map[string]endpointHealth{},
+	}
+}
+
+// observe compares the endpoint statuses with the ones of the previous poll and emits
+// an Event for each endpoint whose health changed. Endpoints that are unhealthy when first
+// observed are reported as well. Disappeared endpoints are only reported if all collectors
+// were polled successfully, as the targets of unreachable collectors are missing too.
+func (e *targetHealthEvents) observe(ctx context.Context, logger logr.Logger, kubeClient client.Client, endpointMap map[string][]monitoringv1.ScrapeEndpointStatus, allCollectors bool) {
+	current := map[string]endpointHealth{}
+
+	for job, endpointStatuses := range endpointMap {
+		// Kubelet scraping is not configured through a PodMonitoring.
+		if strings.HasPrefix(job, "kubelet") {
+			continue
+		}
+		for _, status := range endpointStatuses {
+			// Endpoints that are only known to service discovery have no targets.
+			if status.ActiveTargets == 0 {
+				continue
+			}
+			health := endpointHealth{
+				job:     job,
+				healthy: status.UnhealthyTargets == 0,
+			}
+			current[status.Name] = health
+
+			prev, seen := e.last[status.Name]
+			switch {
+			case !health.healthy && (!seen || prev.healthy):
+				e.emit(ctx, logger, kubeClient, job, corev1.EventTypeWarning, reasonTargetsUnhealthy,
+					fmt.Sprintf("Endpoint %s has %d of %d targets unhealthy: %s",
+						endpointName(status.Name), status.UnhealthyTargets, status.ActiveTargets, topError(&status)))
+			case health.healthy && seen && !prev.healthy:
+				e.emit(ctx, logger, kubeClient, job, corev1.EventTypeNormal, reasonTargetsHealthy,
+					fmt.Sprintf("All %d targets of endpoint %s are healthy", status.ActiveTargets, endpointName(status.Name)))
+			}
+		}
+	}
+	for name, prev := range e.last {
+		if _, ok := current[name]; ok {
+			continue
+		}
+		if !allCollectors {
+			// Keep the previous state until it can be determined reliably.
+			current[name] = prev
+			continue
+		}
+		e.emit(ctx, logger, kubeClient, prev.job, corev1.EventTypeWarning, reasonTargetsDisappeared,
+			fmt.Sprintf("Endpoint %s has no targets anymore", endpointName(name)))
+	}
+	e.last = current
+}
+
+// emit records an Event on the PodMonitoring or ClusterPodMonitoring of the job.
+func (e *targetHealthEvents) emit(ctx context.Context, logger logr.Logger, kubeClient client.Client, job, eventType, reason, message string) {
+	pm, err := buildPodMonitoring(job)
+	if err != nil {
+		logger.Error(err, "building podmonitoring for event", "job", job)
+		return
+	}
+	// Fetch the object as Events reference it by UID.
+	if err := kubeClient.Get(ctx, client.ObjectKeyFromObject(pm), pm); apierrors.IsNotFound(err) {
+		return
+	} else if err != nil {
+		logger.Error(err, "get podmonitoring for event", "job", job)
+		return
+	}
+	e.recorder.Event(pm, eventType, reason, message)
+}
+
+// endpointName returns the endpoint of the scrape pool name of an endpoint status.
+func endpointName(name string) string {
+	return name[strings.LastIndex(name, "/")+1:]
+}
+
+// topError returns the error of the largest error group of the endpoint.
+func topError(status *monitoringv1.ScrapeEndpointStatus) string {
+	var (
+		top   = "unknown error"
+		count int32
+	)
+	for _, group := range status.SampleGroups {
+		if len(group.SampleTargets) == 0 || group.Count == nil {
+			continue
+		}
+		// All targets of a group have the same error.
+		lastErr := group.SampleTargets[0].LastError
+		if lastErr == nil || *lastErr == "" || *group.Count <= count {
+			continue
+		}
+		top, count = *lastErr, *group.Count
+	}
+	return top
+}
@@ -0,0 +1,103 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/google/go-cmp/cmp"
+	prometheusv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+)
+
+func TestTargetHealthEvents(t *testing.T) {
+	scheme, err := NewScheme()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pm := &monitoringv1.PodMonitoring{
+		ObjectMeta: metav1.ObjectMeta{Name: "prom-example", Namespace: "gmp-test"},
+	}
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(pm).Build()
+	recorder := record.NewFakeRecorder(10)
+	events := newTargetHealthEvents(recorder)
+
+	target := func(instance, health, lastErr string) prometheusv1.ActiveTarget {
+		return prometheusv1.ActiveTarget{
+			Health:     prometheusv1.HealthStatus(health),
+			LastError:  lastErr,
+			ScrapePool: "PodMonitoring/gmp-test/prom-example/metrics",
+			Labels:     model.LabelSet{"instance": model.LabelValue(instance)},
+		}
+	}
+	poll := func(targets ...*prometheusv1.TargetsResult) []string {
+		t.Helper()
+		r := &targetStatusReconciler{logger: testr.New(t), kubeClient: kubeClient, healthEvents: events}
+		if err := r.updateTargetStatus(context.Background(), targets, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for {
+			select {
+			case e := <-recorder.Events:
+				got = append(got, e)
+			default:
+				return got
+			}
+		}
+	}
+
+	// Healthy endpoints are not reported when first observed.
+	healthy := &prometheusv1.TargetsResult{Active: []prometheusv1.ActiveTarget{
+		target("a", "up", ""),
+		target("b", "up", ""),
+	}}
+	if got := poll(healthy); len(got) > 0 {
+		t.Errorf("unexpected events: %v", got)
+	}
+	// Transition to unhealthy reports the most frequent error.
+	unhealthy := &prometheusv1.TargetsResult{Active: []prometheusv1.ActiveTarget{
+		target("a", "down", "connection refused"),
+		target("b", "down", "connection refused"),
+		target("c", "down", "timeout"),
+	}}
+	want := []string{"Warning TargetsUnhealthy Endpoint metrics has 3 of 3 targets unhealthy: connection refused"}
+	if diff := cmp.Diff(want, poll(unhealthy)); diff != "" {
+		t.Errorf("unexpected events (-want, +got): %s", diff)
+	}
+	// No repeated events while the health does not change.
+	if got := poll(unhealthy); len(got) > 0 {
+		t.Errorf("unexpected events: %v", got)
+	}
+	want = []string{"Normal TargetsHealthy All 2 targets of endpoint metrics are healthy"}
+	if diff := cmp.Diff(want, poll(healthy)); diff != "" {
+		t.Errorf("unexpected events (-want, +got): %s", diff)
+	}
+	// Targets missing due to an unreachable collector are not reported.
+	if got := poll(nil); len(got) > 0 {
+		t.Errorf("unexpected events: %v", got)
+	}
+	want = []string{"Warning TargetsDisappeared Endpoint metrics has no targets anymore"}
+	if diff := cmp.Diff(want, poll(&prometheusv1.TargetsResult{})); diff != "" {
+		t.Errorf("unexpected events (-want, +got): %s", diff)
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"time"
+
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+)
+
+const (
+	// Maximum number of health transitions kept for each endpoint.
+	maxHealthHistory = 10
+	// Window within which health transitions count as flaps.
+	flapWindow = time.Hour
+)
+
+// mergeHealthHistory carries the health history of the old endpoint statuses over to
+// the new ones and records a transition for each endpoint whose health changed. An
+// endpoint is healthy if none of its targets are unhealthy. The new endpoint statuses
+// are modified in place.
+func mergeHealthHistory(old, new []monitoringv1.ScrapeEndpointStatus) {
+	oldByName := make(map[string]*monitoringv1.ScrapeEndpointStatus, len(old))
+	for i := range old {
+		oldByName[old[i].Name] = &old[i]
+	}
+	for i := range new {
+		status := &new[i]
+		now := status.LastUpdateTime
+
+		var history []monitoringv1.HealthTransition
+		if prev, ok := oldByName[status.Name]; ok {
+			history = append(history, prev.HealthHistory...)
+
+			if healthy := status.UnhealthyTargets == 0; healthy != (prev.UnhealthyTargets == 0) {
+				history = append(history, monitoringv1.HealthTransition{
+					Healthy: healthy,
+					Time:    now,
+				})
+			}
+		}
+		if len(history) > maxHealthHistory {
+			history = history[len(history)-maxHealthHistory:]
+		}
+		var flaps int32
+		for _, t := range history {
+			if now.Sub(t.Time.Time) < flapWindow {
+				flaps++
+			}
+		}
+		status.HealthHistory = history
+		status.FlapCount = flaps
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+)
+
+func TestMergeHealthHistory(t *testing.T) {
+	start := time.Date(2022, time.January, 4, 0, 0, 0, 0, time.UTC)
+
+	// poll returns the endpoint statuses after a poll at the given offset from start
+	// with the given number of unhealthy targets.
+	var statuses []monitoringv1.ScrapeEndpointStatus
+	poll := func(offset time.Duration, unhealthy int64) monitoringv1.ScrapeEndpointStatus {
+		next := []monitoringv1.ScrapeEndpointStatus{{
+			Name:             "PodMonitoring/gmp-test/prom-example-1/metrics",
+			ActiveTargets:    2,
+			UnhealthyTargets: unhealthy,
+			LastUpdateTime:   metav1.NewTime(start.Add(offset)),
+		}}
+		mergeHealthHistory(statuses, next)
+		statuses = next
+		return next[0]
+	}
+
+	// No transition is recorded for the first observation.
+	if got := poll(0, 0); len(got.HealthHistory) != 0 || got.FlapCount != 0 {
+		t.Errorf("unexpected history %v and flap count %d", got.HealthHistory, got.FlapCount)
+	}
+	// A change in the number of unhealthy targets is no transition.
+	poll(time.Minute, 1)
+	got := poll(2*time.Minute, 2)
+	want := []monitoringv1.HealthTransition{
+		{Healthy: false, Time: metav1.NewTime(start.Add(time.Minute))},
+	}
+	if diff := cmp.Diff(want, got.HealthHistory); diff != "" {
+		t.Errorf("unexpected history (-want, +got): %s", diff)
+	}
+
+	// Flapping endpoint.
+	for i := 0; i < maxHealthHistory; i++ {
+		got = poll(time.Duration(3+i)*time.Minute, int64(i%2))
+	}
+	if len(got.HealthHistory) != maxHealthHistory || got.FlapCount != maxHealthHistory {
+		t.Errorf("unexpected history %v and flap count %d", got.HealthHistory, got.FlapCount)
+	}
+	if last := got.HealthHistory[maxHealthHistory-1]; !last.Healthy == (got.UnhealthyTargets == 0) {
+		t.Errorf("unexpected last transition %v", last)
+	}
+
+	// Transitions older than the flap window are kept but not counted.
+	got = poll(flapWindow+5*time.Minute, got.UnhealthyTargets)
+	if len(got.HealthHistory) != maxHealthHistory || got.FlapCount != 7 {
+		t.Errorf("unexpected history %v and flap count %d", got.HealthHistory, got.FlapCount)
+	}
+}
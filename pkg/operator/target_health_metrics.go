@@ -0,0 +1,91 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+)
+
+var (
+	targetsActiveDesc = prometheus.NewDesc(
+		"prometheus_engine_targets_active",
+		"Number of active targets of an endpoint as of the last target status poll.",
+		[]string{"resource", "endpoint"}, nil,
+	)
+	targetsUnhealthyDesc = prometheus.NewDesc(
+		"prometheus_engine_targets_unhealthy",
+		"Number of unhealthy targets of an endpoint as of the last target status poll.",
+		[]string{"resource", "endpoint"}, nil,
+	)
+)
+
+// targetHealthMetrics exposes the target counts of the endpoint statuses computed in
+// the last poll as metrics, so that scrape failures can be alerted on. The resource
+// label is the kind, namespace and name of the PodMonitoring or ClusterPodMonitoring,
+// e.g. "PodMonitoring/default/app", or the job of kubelet scraping.
+type targetHealthMetrics struct {
+	mtx       sync.Mutex
+	endpoints map[string]targetCounts
+}
+
+type targetCounts struct {
+	active, unhealthy int64
+}
+
+func newTargetHealthMetrics() *targetHealthMetrics {
+	return &targetHealthMetrics{
+		endpoints: map[string]targetCounts{},
+	}
+}
+
+// update replaces the exposed target counts with the ones of the endpoint statuses.
+func (m *targetHealthMetrics) update(endpointMap map[string][]monitoringv1.ScrapeEndpointStatus) {
+	endpoints := map[string]targetCounts{}
+	for _, endpointStatuses := range endpointMap {
+		for _, status := range endpointStatuses {
+			endpoints[status.Name] = targetCounts{
+				active:    status.ActiveTargets,
+				unhealthy: status.UnhealthyTargets,
+			}
+		}
+	}
+	m.mtx.Lock()
+	m.endpoints = endpoints
+	m.mtx.Unlock()
+}
+
+func (m *targetHealthMetrics) Describe(ch chan<- *prometheus.Desc) {
+	ch <- targetsActiveDesc
+	ch <- targetsUnhealthyDesc
+}
+
+func (m *targetHealthMetrics) Collect(ch chan<- prometheus.Metric) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	for name, counts := range m.endpoints {
+		resource, endpoint := name, ""
+		if i := strings.LastIndex(name, "/"); i >= 0 {
+			resource, endpoint = name[:i], name[i+1:]
+		}
+		ch <- prometheus.MustNewConstMetric(targetsActiveDesc, prometheus.GaugeValue, float64(counts.active), resource, endpoint)
+		ch <- prometheus.MustNewConstMetric(targetsUnhealthyDesc, prometheus.GaugeValue, float64(counts.unhealthy), resource, endpoint)
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+)
+
+func TestTargetHealthMetrics(t *testing.T) {
+	m := newTargetHealthMetrics()
+	m.update(map[string][]monitoringv1.ScrapeEndpointStatus{
+		"PodMonitoring/ns1/a": {{
+			Name:             "PodMonitoring/ns1/a/metrics",
+			ActiveTargets:    3,
+			UnhealthyTargets: 1,
+		}},
+		"ClusterPodMonitoring/b": {{
+			Name:          "ClusterPodMonitoring/b/http",
+			ActiveTargets: 2,
+		}},
+	})
+	want := `
+# HELP prometheus_engine_targets_active Number of active targets of an endpoint as of the last target status poll.
+# TYPE prometheus_engine_targets_active gauge
+prometheus_engine_targets_active{endpoint="http",resource="ClusterPodMonitoring/b"} 2
+prometheus_engine_targets_active{endpoint="metrics",resource="PodMonitoring/ns1/a"} 3
+# HELP prometheus_engine_targets_unhealthy Number of unhealthy targets of an endpoint as of the last target status poll.
+# TYPE prometheus_engine_targets_unhealthy gauge
+prometheus_engine_targets_unhealthy{endpoint="http",resource="ClusterPodMonitoring/b"} 0
+prometheus_engine_targets_unhealthy{endpoint="metrics",resource="PodMonitoring/ns1/a"} 1
+`
+	if err := testutil.CollectAndCompare(m, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+
+	// Endpoints that disappeared are no longer exposed.
+	m.update(map[string][]monitoringv1.ScrapeEndpointStatus{
+		"PodMonitoring/ns1/a": {{
+			Name:          "PodMonitoring/ns1/a/metrics",
+			ActiveTargets: 3,
+		}},
+	})
+	want = `
+# HELP prometheus_engine_targets_active Number of active targets of an endpoint as of the last target status poll.
+# TYPE prometheus_engine_targets_active gauge
+prometheus_engine_targets_active{endpoint="metrics",resource="PodMonitoring/ns1/a"} 3
+# HELP prometheus_engine_targets_unhealthy Number of unhealthy targets of an endpoint as of the last target status poll.
+# TYPE prometheus_engine_targets_unhealthy gauge
+prometheus_engine_targets_unhealthy{endpoint="metrics",resource="PodMonitoring/ns1/a"} 0
+`
+	if err := testutil.CollectAndCompare(m, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"sort"
+
+	prometheusv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/GoogleCloudPlatform/prometheus-engine/pkg/export"
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+)
+
+// targetKey identifies a target by the labels the exporter counts rejected samples by.
+type targetKey struct {
+	namespace, job, instance string
+}
+
+// parseRejections extracts the samples rejected by GCM from the metrics of a collector
+// and sums them by the scrape pool of the given targets and the rejection reason.
+func parseRejections(families map[string]*dto.MetricFamily, targets *prometheusv1.TargetsResult) map[string]map[string]int64 {
+	pools := make(map[targetKey]string, len(targets.Active))
+	for _, target := range targets.Active {
+		pools[targetKey{
+			namespace: string(target.Labels[export.KeyNamespace]),
+			job:       string(target.Labels[export.KeyJob]),
+			instance:  string(target.Labels[export.KeyInstance]),
+		}] = target.ScrapePool
+	}
+	res := map[string]map[string]int64{}
+
+	for _, m := range metricsOf(families, export.TargetSamplesRejectedMetric) {
+		pool, ok := pools[targetKey{
+			namespace: labelValue(m, export.KeyNamespace),
+			job:       labelValue(m, export.KeyJob),
+			instance:  labelValue(m, export.KeyInstance),
+		}]
+		if !ok {
+			continue
+		}
+		counts, ok := res[pool]
+		if !ok {
+			counts = map[string]int64{}
+			res[pool] = counts
+		}
+		counts[labelValue(m, "reason")] += int64(m.GetCounter().GetValue())
+	}
+	return res
+}
+
+// addRejectedSamples adds the samples rejected by GCM as reported by the collectors to
+// the endpoint statuses. Like sample counts, they are only set if all collectors
+// reported them.
+func addRejectedSamples(endpointMap map[string][]monitoringv1.ScrapeEndpointStatus, states []*collectorState) {
+	if len(states) == 0 {
+		return
+	}
+	totals := map[string]map[string]int64{}
+	for _, state := range states {
+		if state == nil || state.rejections == nil {
+			return
+		}
+		for pool, counts := range state.rejections {
+			total, ok := totals[pool]
+			if !ok {
+				total = map[string]int64{}
+				totals[pool] = total
+			}
+			for reason, count := range counts {
+				total[reason] += count
+			}
+		}
+	}
+	for _, endpointStatuses := range endpointMap {
+		for i := range endpointStatuses {
+			status := &endpointStatuses[i]
+			if status.ActiveTargets == 0 {
+				continue
+			}
+			var rejected []monitoringv1.RejectedSampleCount
+			for reason, count := range totals[status.Name] {
+				if count > 0 {
+					rejected = append(rejected, monitoringv1.RejectedSampleCount{Reason: reason, Count: count})
+				}
+			}
+			sort.Slice(rejected, func(i, j int) bool {
+				return rejected[i].Reason < rejected[j].Reason
+			})
+			status.RejectedSamples = rejected
+		}
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	prometheusv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+)
+
+func TestParseRejections(t *testing.T) {
+	families, err := parseMetrics(strings.NewReader(`
+# TYPE gcm_export_target_samples_rejected_total counter
+gcm_export_target_samples_rejected_total{namespace="gmp-test",job="a",instance="a-1",reason="too-old"} 10
+gcm_export_target_samples_rejected_total{namespace="gmp-test",job="a",instance="a-2",reason="too-old"} 5
+gcm_export_target_samples_rejected_total{namespace="gmp-test",job="a",instance="a-2",reason="invalid-labels"} 3
+gcm_export_target_samples_rejected_total{namespace="gmp-test",job="b",instance="b-1",reason="cardinality"} 7
+gcm_export_target_samples_rejected_total{namespace="other",job="a",instance="a-1",reason="too-old"} 1000
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	targets := &prometheusv1.TargetsResult{
+		Active: []prometheusv1.ActiveTarget{{
+			ScrapePool: "PodMonitoring/gmp-test/a/metrics",
+			Labels:     model.LabelSet{"namespace": "gmp-test", "instance": "a-1", "job": "a"},
+		}, {
+			ScrapePool: "PodMonitoring/gmp-test/a/metrics",
+			Labels:     model.LabelSet{"namespace": "gmp-test", "instance": "a-2", "job": "a"},
+		}, {
+			ScrapePool: "PodMonitoring/gmp-test/b/metrics",
+			Labels:     model.LabelSet{"namespace": "gmp-test", "instance": "b-1", "job": "b"},
+		}},
+	}
+	want := map[string]map[string]int64{
+		"PodMonitoring/gmp-test/a/metrics": {"too-old": 15, "invalid-labels": 3},
+		"PodMonitoring/gmp-test/b/metrics": {"cardinality": 7},
+	}
+	if diff := cmp.Diff(want, parseRejections(families, targets)); diff != "" {
+		t.Errorf("unexpected rejections (-want, +got): %s", diff)
+	}
+}
+
+func TestAddRejectedSamples(t *testing.T) {
+	newEndpointMap := func() map[string][]monitoringv1.ScrapeEndpointStatus {
+		return map[string][]monitoringv1.ScrapeEndpointStatus{
+			"PodMonitoring/gmp-test/a": {{
+				Name:          "PodMonitoring/gmp-test/a/metrics",
+				ActiveTargets: 3,
+			}, {
+				Name:          "PodMonitoring/gmp-test/a/other",
+				ActiveTargets: 1,
+			}, {
+				// Only known to service discovery.
+				Name: "PodMonitoring/gmp-test/a/none",
+			}},
+		}
+	}
+	states := []*collectorState{
+		{rejections: map[string]map[string]int64{
+			"PodMonitoring/gmp-test/a/metrics": {"too-old": 10, "invalid-labels": 2},
+			"PodMonitoring/gmp-test/a/none":    {"too-old": 1},
+		}},
+		{rejections: map[string]map[string]int64{
+			"PodMonitoring/gmp-test/a/metrics": {"too-old": 5},
+			"PodMonitoring/gmp-test/a/other":   {"cardinality": 0},
+		}},
+	}
+
+	endpointMap := newEndpointMap()
+	addRejectedSamples(endpointMap, states)
+	want := map[string][]monitoringv1.ScrapeEndpointStatus{
+		"PodMonitoring/gmp-test/a": {{
+			Name:          "PodMonitoring/gmp-test/a/metrics",
+			ActiveTargets: 3,
+			RejectedSamples: []monitoringv1.RejectedSampleCount{
+				{Reason: "invalid-labels", Count: 2},
+				{Reason: "too-old", Count: 15},
+			},
+		}, {
+			Name:          "PodMonitoring/gmp-test/a/other",
+			ActiveTargets: 1,
+		}, {
+			Name: "PodMonitoring/gmp-test/a/none",
+		}},
+	}
+	if diff := cmp.Diff(want, endpointMap); diff != "" {
+		t.Errorf("unexpected endpoint statuses (-want, +got): %s", diff)
+	}
+
+	// Partial counts are not reported.
+	endpointMap = newEndpointMap()
+	addRejectedSamples(endpointMap, append(states, &collectorState{}))
+	if diff := cmp.Diff(newEndpointMap(), endpointMap); diff != "" {
+		t.Errorf("unexpected endpoint statuses (-want, +got): %s", diff)
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	prometheusv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	corev1 "k8s.io/api/core/v1"
+
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+)
+
+// Query for the number of samples of the last scrape of each target of a collector.
+const samplesQuery = `{__name__=~"scrape_samples_scraped|scrape_samples_post_metric_relabeling"}`
+
+// sampleCounts are the number of samples of the last scrapes of a set of targets.
+type sampleCounts struct {
+	scraped              int64
+	postMetricRelabeling int64
+}
+
+// queryResponse is the response envelope of the Prometheus query API for instant queries.
+type queryResponse struct {
+	Status string `json:"status"`
+	Data   struct {
+		ResultType string       `json:"resultType"`
+		Result     model.Vector `json:"result"`
+	} `json:"data"`
+	ErrorType string `json:"errorType"`
+	Error     string `json:"error"`
+}
+
+// getSampleCounts queries the sample counts of the last scrape of each target from the
+// collector in the pod and returns them summed by the scrape pool of the given targets.
+func getSampleCounts(ctx context.Context, scheme string, rt http.RoundTripper, port int32, pod *corev1.Pod, targets *prometheusv1.TargetsResult) (map[string]*sampleCounts, error) {
+	if pod.Status.PodIP == "" {
+		return nil, errNoPodIP
+	}
+	u := url.URL{
+		Scheme:   scheme,
+		Host:     net.JoinHostPort(pod.Status.PodIP, strconv.Itoa(int(port))),
+		Path:     "/api/v1/query",
+		RawQuery: url.Values{"query": []string{samplesQuery}}.Encode(),
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create request: %w", err)
+	}
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query samples: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var res queryResponse
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, fmt.Errorf("unable to decode samples with status code %d: %w", resp.StatusCode, err)
+	}
+	if res.Status != "success" {
+		return nil, fmt.Errorf("unable to query samples: %s: %s", res.ErrorType, res.Error)
+	}
+	return sumSampleCounts(res.Data.Result, targets), nil
+}
+
+// sumSampleCounts sums the sample counts of the targets by scrape pool. The series of
+// the sample counts carry the labels of the target they belong to.
+func sumSampleCounts(vector model.Vector, targets *prometheusv1.TargetsResult) map[string]*sampleCounts {
+	pools := make(map[model.Fingerprint]string, len(targets.Active))
+	for _, target := range targets.Active {
+		pools[target.Labels.Fingerprint()] = target.ScrapePool
+	}
+	res := map[string]*sampleCounts{}
+
+	for _, sample := range vector {
+		labels := model.LabelSet(sample.Metric).Clone()
+		name := labels[model.MetricNameLabel]
+		delete(labels, model.MetricNameLabel)
+
+		pool, ok := pools[labels.Fingerprint()]
+		if !ok {
+			continue
+		}
+		counts, ok := res[pool]
+		if !ok {
+			counts = &sampleCounts{}
+			res[pool] = counts
+		}
+		switch name {
+		case "scrape_samples_scraped":
+			counts.scraped += int64(sample.Value)
+		case "scrape_samples_post_metric_relabeling":
+			counts.postMetricRelabeling += int64(sample.Value)
+		}
+	}
+	return res
+}
+
+// addSampleCounts adds the sample counts reported by the collectors to the endpoint
+// statuses. The counts are only set if all collectors reported them, as partial
+// counts would be misleading.
+func addSampleCounts(endpointMap map[string][]monitoringv1.ScrapeEndpointStatus, states []*collectorState) {
+	if len(states) == 0 {
+		return
+	}
+	totals := map[string]*sampleCounts{}
+	for _, state := range states {
+		if state == nil || state.samples == nil {
+			return
+		}
+		for pool, counts := range state.samples {
+			total, ok := totals[pool]
+			if !ok {
+				total = &sampleCounts{}
+				totals[pool] = total
+			}
+			total.scraped += counts.scraped
+			total.postMetricRelabeling += counts.postMetricRelabeling
+		}
+	}
+	for _, endpointStatuses := range endpointMap {
+		for i := range endpointStatuses {
+			status := &endpointStatuses[i]
+			if status.ActiveTargets == 0 {
+				continue
+			}
+			total, ok := totals[status.Name]
+			if !ok {
+				total = &sampleCounts{}
+			}
+			scraped, postMetricRelabeling := total.scraped, total.postMetricRelabeling
+			status.SamplesScraped = &scraped
+			status.SamplesPostMetricRelabeling = &postMetricRelabeling
+		}
+	}
+}
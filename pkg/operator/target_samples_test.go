@@ -0,0 +1,143 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	prometheusv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/pointer"
+
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+)
+
+func TestGetSampleCounts(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/query" || r.URL.Query().Get("query") != samplesQuery {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[
+{"metric":{"__name__":"scrape_samples_scraped","instance":"a-1","job":"a"},"value":[1641254400,"100"]},
+{"metric":{"__name__":"scrape_samples_post_metric_relabeling","instance":"a-1","job":"a"},"value":[1641254400,"60"]},
+{"metric":{"__name__":"scrape_samples_scraped","instance":"a-2","job":"a"},"value":[1641254400,"20"]},
+{"metric":{"__name__":"scrape_samples_post_metric_relabeling","instance":"a-2","job":"a"},"value":[1641254400,"0"]},
+{"metric":{"__name__":"scrape_samples_scraped","instance":"b-1","job":"b"},"value":[1641254400,"5"]},
+{"metric":{"__name__":"scrape_samples_scraped","instance":"unknown","job":"a"},"value":[1641254400,"1000"]}
+]}}`)
+	}))
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, portStr, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pod := &corev1.Pod{Status: corev1.PodStatus{PodIP: host}}
+
+	targets := &prometheusv1.TargetsResult{
+		Active: []prometheusv1.ActiveTarget{{
+			ScrapePool: "PodMonitoring/gmp-test/a/metrics",
+			Labels:     model.LabelSet{"instance": "a-1", "job": "a"},
+		}, {
+			ScrapePool: "PodMonitoring/gmp-test/a/metrics",
+			Labels:     model.LabelSet{"instance": "a-2", "job": "a"},
+		}, {
+			ScrapePool: "PodMonitoring/gmp-test/b/metrics",
+			Labels:     model.LabelSet{"instance": "b-1", "job": "b"},
+		}},
+	}
+	got, err := getSampleCounts(context.Background(), "http", http.DefaultTransport, int32(port), pod, targets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]*sampleCounts{
+		"PodMonitoring/gmp-test/a/metrics": {scraped: 120, postMetricRelabeling: 60},
+		"PodMonitoring/gmp-test/b/metrics": {scraped: 5},
+	}
+	if diff := cmp.Diff(want, got, cmp.AllowUnexported(sampleCounts{})); diff != "" {
+		t.Errorf("unexpected sample counts (-want, +got): %s", diff)
+	}
+}
+
+func TestAddSampleCounts(t *testing.T) {
+	newEndpointMap := func() map[string][]monitoringv1.ScrapeEndpointStatus {
+		return map[string][]monitoringv1.ScrapeEndpointStatus{
+			"PodMonitoring/gmp-test/a": {{
+				Name:          "PodMonitoring/gmp-test/a/metrics",
+				ActiveTargets: 3,
+			}, {
+				Name:          "PodMonitoring/gmp-test/a/other",
+				ActiveTargets: 1,
+			}, {
+				// Only known to service discovery.
+				Name: "PodMonitoring/gmp-test/a/none",
+			}},
+		}
+	}
+	states := []*collectorState{
+		{samples: map[string]*sampleCounts{
+			"PodMonitoring/gmp-test/a/metrics": {scraped: 100, postMetricRelabeling: 50},
+		}},
+		{samples: map[string]*sampleCounts{
+			"PodMonitoring/gmp-test/a/metrics": {scraped: 10, postMetricRelabeling: 5},
+		}},
+	}
+
+	endpointMap := newEndpointMap()
+	addSampleCounts(endpointMap, states)
+	want := map[string][]monitoringv1.ScrapeEndpointStatus{
+		"PodMonitoring/gmp-test/a": {{
+			Name:                        "PodMonitoring/gmp-test/a/metrics",
+			ActiveTargets:               3,
+			SamplesScraped:              pointer.Int64(110),
+			SamplesPostMetricRelabeling: pointer.Int64(55),
+		}, {
+			Name:                        "PodMonitoring/gmp-test/a/other",
+			ActiveTargets:               1,
+			SamplesScraped:              pointer.Int64(0),
+			SamplesPostMetricRelabeling: pointer.Int64(0),
+		}, {
+			Name: "PodMonitoring/gmp-test/a/none",
+		}},
+	}
+	if diff := cmp.Diff(want, endpointMap); diff != "" {
+		t.Errorf("unexpected endpoint statuses (-want, +got): %s", diff)
+	}
+
+	// Partial counts are not reported.
+	endpointMap = newEndpointMap()
+	addSampleCounts(endpointMap, append(states, &collectorState{}))
+	if diff := cmp.Diff(newEndpointMap(), endpointMap); diff != "" {
+		t.Errorf("unexpected endpoint statuses (-want, +got): %s", diff)
+	}
+}
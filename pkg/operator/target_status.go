@@ -16,9 +16,18 @@ package operator
 
 import (
 	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash/fnv"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -28,16 +37,21 @@ import (
 	"github.com/prometheus/client_golang/api"
 	prometheusv1 "github.com/prometheus/client_golang/api/prometheus/v1"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/config"
+	"github.com/prometheus/common/model"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
 	"k8s.io/utils/clock"
 	"k8s.io/utils/pointer"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
@@ -56,17 +70,53 @@ var (
 	minPollDuration = 10 * time.Second
 )
 
+const (
+	// Field manager for server-side apply of the target status fields.
+	fieldManagerTargetStatus = "gmp-operator-target-status"
+	// Name of the reconcile request of an on-demand poll.
+	refreshRequestName = "refresh"
+)
+
 // Responsible for fetching the targets given a pod.
 type getTargetFn func(ctx context.Context, logger logr.Logger, port int32, pod *corev1.Pod) (*prometheusv1.TargetsResult, error)
 
+// collectorState is the state of a collector besides its targets. Each pointer and map
+// field is nil if it could not be fetched.
+type collectorState struct {
+	// Name of the collector pod.
+	pod string
+	// Class of the error if the targets of the collector could not be fetched.
+	fetchError string
+	discovery  *collectorDiscovery
+	// Sample counts of the targets by scrape pool.
+	samples map[string]*sampleCounts
+	// Samples of the targets rejected by GCM by scrape pool and reason.
+	rejections map[string]map[string]int64
+	// Skew of the collector's clock against the GCM API.
+	clockSkew *time.Duration
+}
+
+// Responsible for fetching the collector state given a pod and its targets.
+type getCollectorStateFn func(ctx context.Context, logger logr.Logger, port int32, pod *corev1.Pod, targets *prometheusv1.TargetsResult) (*collectorState, error)
+
 // targetStatusReconciler to hold cached client state and source channel.
 type targetStatusReconciler struct {
-	ch         chan<- event.GenericEvent
-	opts       Options
-	getTarget  getTargetFn
-	clock      clock.Clock
-	logger     logr.Logger
-	kubeClient client.Client
+	ch chan<- event.GenericEvent
+	// Receives on-demand poll requests. Requests that arrive while one is pending
+	// are coalesced.
+	refresh       chan struct{}
+	opts          Options
+	getTarget     getTargetFn
+	getState      getCollectorStateFn
+	clock         clock.Clock
+	logger        logr.Logger
+	kubeClient    client.Client
+	healthEvents  *targetHealthEvents
+	healthMetrics *targetHealthMetrics
+	snapshot      *targetsSnapshot
+	statusQueue   *targetStatusQueue
+	// Whether to spread the target fetches of a poll over the poll interval.
+	spreadFetches bool
 }
 
 // setupTargetStatusPoller sets up a reconciler that polls and populate target
@@ -75,19 +125,45 @@ func setupTargetStatusPoller(op *Operator, registry prometheus.Registerer) error
 	if err := registry.Register(targetStatusDuration); err != nil {
 		return err
 	}
+	healthMetrics := newTargetHealthMetrics()
+	if err := registry.Register(healthMetrics); err != nil {
+		return err
+	}
 
+	getTarget, err := newGetTargetFn(op.opts, op.collectorCA)
+	if err != nil {
+		return fmt.Errorf("create target fetcher: %w", err)
+	}
+	getState, err := newGetCollectorStateFn(op.opts, op.collectorCA)
+	if err != nil {
+		return fmt.Errorf("create collector state fetcher: %w", err)
+	}
 	ch := make(chan event.GenericEvent, 1)
 
-	reconciler := &targetStatusReconciler{
-		ch:         ch,
-		opts:       op.opts,
-		getTarget:  getTarget,
+	snapshot := &targetsSnapshot{}
+	op.manager.GetWebhookServer().Register(targetsDebugPath, &targetsDebugHandler{
 		logger:     op.logger,
 		kubeClient: op.manager.GetClient(),
-		clock:      clock.RealClock{},
+		snapshot:   snapshot,
+	})
+
+	reconciler := &targetStatusReconciler{
+		ch:            ch,
+		refresh:       make(chan struct{}, 1),
+		opts:          op.opts,
+		getTarget:     getTarget,
+		getState:      getState,
+		logger:        op.logger,
+		kubeClient:    op.manager.GetClient(),
+		clock:         clock.RealClock{},
+		healthEvents:  newTargetHealthEvents(op.manager.GetEventRecorderFor(NameOperator)),
+		healthMetrics: healthMetrics,
+		snapshot:      snapshot,
+		statusQueue:   newTargetStatusQueue(op.logger, op.manager.GetClient(), op.opts.TargetStatusQPS),
+		spreadFetches: true,
 	}
 
-	err := ctrl.NewControllerManagedBy(op.manager).
+	err = ctrl.NewControllerManagedBy(op.manager).
 		Named("target-status").
 		// controller-runtime requires a For clause of the manager otherwise
 		// this controller will fail to build at runtime when calling
@@ -107,11 +183,32 @@ func setupTargetStatusPoller(op *Operator, registry prometheus.Registerer) error
 		Watches(&source.Channel{
 			Source: ch,
 		}, &handler.EnqueueRequestForObject{}).
+		// Changes of the refresh annotation interrupt the wait for the next poll
+		// instead of being reconciled themselves.
+		Watches(
+			&source.Kind{Type: &monitoringv1.PodMonitoring{}},
+			reconciler.refreshHandler(),
+			builder.WithPredicates(refreshRequested()),
+		).
+		Watches(
+			&source.Kind{Type: &monitoringv1.ClusterPodMonitoring{}},
+			reconciler.refreshHandler(),
+			builder.WithPredicates(refreshRequested()),
+		).
 		Complete(reconciler)
 	if err != nil {
 		return fmt.Errorf("create target status controller: %w", err)
 	}
 
+	// Runnables that don't implement manager.LeaderElectionRunnable only start on the
+	// elected leader, so that a single replica polls collectors and writes statuses.
+	if err := op.manager.Add(manager.RunnableFunc(func(ctx context.Context) error {
+		reconciler.statusQueue.run(ctx)
+		return nil
+	})); err != nil {
+		return fmt.Errorf("unable to start target status queue: %w", err)
+	}
+
 	// Start the controller only once.
 	if err := op.manager.Add(manager.RunnableFunc(func(ctx context.Context) error {
 		reconciler.ch <- event.GenericEvent{
@@ -151,22 +248,81 @@ func shouldPoll(ctx context.Context, cfgNamespacedName types.NamespacedName, kub
 	return true, nil
 }
 
+// targetStatusPollInterval returns the configured poll interval or the default if
+// none is set.
+func targetStatusPollInterval(spec *monitoringv1.TargetStatusSpec) (time.Duration, error) {
+	if spec.Interval == "" {
+		return minPollDuration, nil
+	}
+	interval, err := model.ParseDuration(spec.Interval)
+	if err != nil {
+		return 0, fmt.Errorf("invalid poll interval: %w", err)
+	}
+	if time.Duration(interval) < minPollDuration {
+		return 0, fmt.Errorf("poll interval %s must not be less than %s", interval, minPollDuration)
+	}
+	return time.Duration(interval), nil
+}
+
+// Default number of polls after which unchanged target statuses are rewritten.
+const defaultRefreshPolls = 10
+
+// targetStatusRefreshInterval returns the age after which unchanged target statuses are
+// rewritten to refresh their last update time.
+func targetStatusRefreshInterval(spec *monitoringv1.TargetStatusSpec) time.Duration {
+	interval, err := targetStatusPollInterval(spec)
+	if err != nil {
+		interval = minPollDuration
+	}
+	polls := spec.RefreshPolls
+	if polls == 0 {
+		polls = defaultRefreshPolls
+	}
+	return time.Duration(polls) * interval
+}
+
+// pollInterval returns the poll interval of the current OperatorConfig. The interval
+// is read on every poll so that changes apply without restarting the operator.
+func pollInterval(ctx context.Context, logger logr.Logger, cfgNamespacedName types.NamespacedName, kubeClient client.Client) time.Duration {
+	var config monitoringv1.OperatorConfig
+	if err := kubeClient.Get(ctx, cfgNamespacedName, &config); err != nil {
+		if !apierrors.IsNotFound(err) {
+			logger.Error(err, "get operatorconfig for poll interval")
+		}
+		return minPollDuration
+	}
+	interval, err := targetStatusPollInterval(&config.Features.TargetStatus)
+	if err != nil {
+		logger.Error(err, "invalid target status poll interval, using default")
+		return minPollDuration
+	}
+	return interval
+}
+
 // Reconcile polls the collector pods, fetches and aggregates target status and
 // upserts into each PodMonitoring's Status field.
 func (r *targetStatusReconciler) Reconcile(ctx context.Context, request reconcile.Request) (reconcile.Result, error) {
-	timer := r.clock.NewTimer(minPollDuration)
-
-	now := time.Now()
-
 	cfgNamespacedName := types.NamespacedName{
 		Name:      NameOperatorConfig,
 		Namespace: r.opts.PublicNamespace,
 	}
+	interval := pollInterval(ctx, r.logger, cfgNamespacedName, r.kubeClient)
+	timer := r.clock.NewTimer(interval)
+	start := r.clock.Now()
+
+	now := time.Now()
 
 	if should, err := shouldPoll(ctx, cfgNamespacedName, r.kubeClient); err != nil {
 		r.logger.Error(err, "should poll")
 	} else if should {
-		if err := pollAndUpdate(ctx, r.logger, r.opts, r.getTarget, r.kubeClient); err != nil {
+		var spread time.Duration
+		// On-demand polls fetch all targets immediately.
+		if r.spreadFetches && request.Name != refreshRequestName {
+			// Spread fetches over the first half of the poll interval so that the
+			// statuses can be written before the next poll.
+			spread = interval / 2
+		}
+		if err := r.pollAndUpdate(ctx, spread); err != nil {
 			r.logger.Error(err, "poll and update")
 		} else {
 			// Only log metrics if target polling was successful.
@@ -183,36 +339,110 @@ func (r *targetStatusReconciler) Reconcile(ctx context.Context, request reconcil
 		r.ch <- event.GenericEvent{
 			Object: &appsv1.DaemonSet{},
 		}
+	case <-r.refresh:
+		timer.Stop()
+		// On-demand polls start no earlier than the minimum poll duration after the
+		// previous poll. Requests that arrive while waiting are served by the same poll.
+		if wait := minPollDuration - r.clock.Since(start); wait > 0 {
+			select {
+			case <-ctx.Done():
+				return reconcile.Result{}, nil
+			case <-r.clock.After(wait):
+			}
+		}
+		select {
+		case <-r.refresh:
+		default:
+		}
+		r.ch <- event.GenericEvent{
+			Object: &appsv1.DaemonSet{
+				ObjectMeta: metav1.ObjectMeta{Name: refreshRequestName},
+			},
+		}
 	}
 
 	return reconcile.Result{}, nil
 }
 
-// pollAndUpdate fetches and updates the target status in each collector pod.
-func pollAndUpdate(ctx context.Context, logger logr.Logger, opts Options, getTarget getTargetFn, kubeClient client.Client) error {
-	targets, err := fetchTargets(ctx, logger, opts, getTarget, kubeClient)
+// refreshHandler returns an event handler that requests an on-demand poll.
+func (r *targetStatusReconciler) refreshHandler() handler.EventHandler {
+	return handler.Funcs{
+		UpdateFunc: func(event.UpdateEvent, workqueue.RateLimitingInterface) {
+			r.requestRefresh()
+		},
+	}
+}
+
+// requestRefresh requests a poll that starts without waiting for the poll interval to
+// elapse. It does not block if a request is already pending.
+func (r *targetStatusReconciler) requestRefresh() {
+	select {
+	case r.refresh <- struct{}{}:
+	default:
+	}
+}
+
+// refreshRequested returns a predicate that matches updates of monitoring resources
+// that set a new value for the refresh annotation.
+func refreshRequested() predicate.Predicate {
+	return predicate.Funcs{
+		CreateFunc: func(event.CreateEvent) bool { return false },
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			value := e.ObjectNew.GetAnnotations()[AnnotationRefreshStatus]
+			return value != "" && value != e.ObjectOld.GetAnnotations()[AnnotationRefreshStatus]
+		},
+		DeleteFunc:  func(event.DeleteEvent) bool { return false },
+		GenericFunc: func(event.GenericEvent) bool { return false },
+	}
+}
+
+// pollAndUpdate fetches the targets of each collector pod, spreading the fetches over
+// the given duration, and updates the target status.
+func (r *targetStatusReconciler) pollAndUpdate(ctx context.Context, spread time.Duration) error {
+	var config monitoringv1.OperatorConfig
+	if err := r.kubeClient.Get(ctx, types.NamespacedName{Namespace: r.opts.PublicNamespace, Name: NameOperatorConfig}, &config); err != nil {
+		return fmt.Errorf("get operatorconfig: %w", err)
+	}
+	targets, states, err := r.fetchTargets(ctx, spread)
 	if err != nil {
 		return err
 	}
+	if r.snapshot != nil {
+		r.snapshot.set(time.Now(), targets)
+	}
 
-	return updateTargetStatus(ctx, logger, kubeClient, targets)
+	return r.updateTargetStatus(ctx, targets, states, &config)
 }
 
-// fetchTargets retrieves the Prometheus targets using the given target function
-// for each collector pod.
-func fetchTargets(ctx context.Context, logger logr.Logger, opts Options, getTarget getTargetFn, kubeClient client.Client) ([]*prometheusv1.TargetsResult, error) {
-	namespace := opts.OperatorNamespace
+// fetchOffset returns the delay within the spread duration after which the targets of
+// the pod are fetched. The delay is derived from the pod name, so that each collector
+// is polled at the same offset in every poll.
+func fetchOffset(pod *corev1.Pod, spread time.Duration) time.Duration {
+	if spread <= 0 {
+		return 0
+	}
+	h := fnv.New64a()
+	h.Write([]byte(pod.Namespace + "/" + pod.Name))
+	return time.Duration(h.Sum64() % uint64(spread))
+}
+
+// fetchTargets retrieves the Prometheus targets of each collector pod. If the reconciler
+// has a collector state function, the state of each reachable collector pod is retrieved
+// as well. The fetches are spread over the given duration to avoid load spikes on large
+// clusters.
+func (r *targetStatusReconciler) fetchTargets(ctx context.Context, spread time.Duration) ([]*prometheusv1.TargetsResult, []*collectorState, error) {
+	namespace := r.opts.OperatorNamespace
 	var ds appsv1.DaemonSet
-	if err := kubeClient.Get(ctx, client.ObjectKey{
+	if err := r.kubeClient.Get(ctx, client.ObjectKey{
 		Name:      NameCollector,
 		Namespace: namespace,
 	}, &ds); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	selector, err := metav1.LabelSelectorAsSelector(ds.Spec.Selector)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	var port *int32
@@ -225,41 +455,71 @@ func fetchTargets(ctx context.Context, logger logr.Logger, opts Options, getTarg
 		}
 	}
 	if port == nil {
-		return nil, errors.New("Unable to detect Prometheus port")
+		return nil, nil, errors.New("Unable to detect Prometheus port")
 	}
 
-	pods, err := getPrometheusPods(ctx, kubeClient, opts, selector)
+	pods, err := getPrometheusPods(ctx, r.kubeClient, r.opts, selector)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	// Set up pod job queue and jobs
 	podDiscoveryCh := make(chan prometheusPod)
 	wg := sync.WaitGroup{}
-	wg.Add(int(opts.TargetPollConcurrency))
+	wg.Add(int(r.opts.TargetPollConcurrency))
 
+	type collectorResult struct {
+		target *prometheusv1.TargetsResult
+		state  *collectorState
+	}
 	// Must be unbounded or else we deadlock.
-	targetCh := make(chan *prometheusv1.TargetsResult)
+	targetCh := make(chan collectorResult)
 
-	for i := uint16(0); i < opts.TargetPollConcurrency; i++ {
+	for i := uint16(0); i < r.opts.TargetPollConcurrency; i++ {
 		// Wrapper function so we can defer in this scope.
 		go func() {
 			defer wg.Done()
 			for prometheusPod := range podDiscoveryCh {
 				// Fetch operation is blocking.
-				target, err := getTarget(ctx, logger, prometheusPod.port, prometheusPod.pod)
+				target, err := r.getTarget(ctx, r.logger, prometheusPod.port, prometheusPod.pod)
 				if err != nil {
-					logger.Error(err, "failed to fetch target", "pod", prometheusPod.pod.GetName())
+					r.logger.Error(err, "failed to fetch target", "pod", prometheusPod.pod.GetName())
+				}
+				state := &collectorState{}
+				if r.getState != nil && target != nil {
+					if state, err = r.getState(ctx, r.logger, prometheusPod.port, prometheusPod.pod, target); err != nil {
+						r.logger.Error(err, "failed to fetch collector state", "pod", prometheusPod.pod.GetName())
+					}
+					if state == nil {
+						state = &collectorState{}
+					}
+				}
+				state.pod = prometheusPod.pod.GetName()
+				if target == nil {
+					state.fetchError = fetchErrorClass(err)
 				}
 				// nil represents being unable to reach a target.
-				targetCh <- target
+				targetCh <- collectorResult{target: target, state: state}
 			}
 		}()
 	}
 
+	sort.SliceStable(pods, func(i, j int) bool {
+		return fetchOffset(pods[i], spread) < fetchOffset(pods[j], spread)
+	})
+	start := r.clock.Now()
+
 	// Unbuffered channels are blocking so make sure we end the goroutine processing them.
 	go func() {
+	dispatch:
 		for _, pod := range pods {
+			if wait := start.Add(fetchOffset(pod, spread)).Sub(r.clock.Now()); wait > 0 {
+				select {
+				case <-ctx.Done():
+					break dispatch
+				case <-r.clock.After(wait):
+				}
+			}
 			podDiscoveryCh <- prometheusPod{
 				port: *port,
 				pod:  pod,
@@ -275,11 +535,13 @@ func fetchTargets(ctx context.Context, logger logr.Logger, opts Options, getTarg
 	}()
 
 	results := make([]*prometheusv1.TargetsResult, 0)
-	for target := range targetCh {
-		results = append(results, target)
+	var states []*collectorState
+	for res := range targetCh {
+		results = append(results, res.target)
+		states = append(states, res.state)
 	}
 
-	return results, nil
+	return results, states, nil
 }
 
 func buildPodMonitoringFromJob(job []string) (*monitoringv1.PodMonitoring, error) {
@@ -330,56 +592,534 @@ func buildPodMonitoring(job string) (monitoringv1.PodMonitoringStatusContainer,
 	return nil, fmt.Errorf("unable to parse job: %s", job)
 }
 
-func patchPodMonitoringStatus(ctx context.Context, kubeClient client.Client, object client.Object, status monitoringv1.PodMonitoringStatus) error {
-	patchStatus := map[string]interface{}{
-		"endpointStatuses": status.EndpointStatuses,
+// applyPodMonitoringStatus writes the target status fields of the given PodMonitoring or
+// ClusterPodMonitoring using server-side apply. The fields are owned by a dedicated field
+// manager, which avoids conflicts with other writers of the status, such as the collection
+// reconciler. The applied object carries no resourceVersion, so the write never fails due
+// to a stale object.
+func applyPodMonitoringStatus(ctx context.Context, kubeClient client.Client, object client.Object, status monitoringv1.PodMonitoringStatus) error {
+	gvk, err := apiutil.GVKForObject(object, kubeClient.Scheme())
+	if err != nil {
+		return fmt.Errorf("get object kind: %w", err)
+	}
+	// Always apply the endpoint statuses, even if empty, so that statuses written
+	// before the switch to server-side apply are cleared as well.
+	endpointStatuses := status.EndpointStatuses
+	if endpointStatuses == nil {
+		endpointStatuses = []monitoringv1.ScrapeEndpointStatus{}
+	}
+	applyStatus := map[string]interface{}{
+		"endpointStatuses": endpointStatuses,
+		"targetStatusRef":  status.TargetStatusRef,
+	}
+	if status.Summary != nil {
+		applyStatus["summary"] = status.Summary
+	}
+	// Conditions are a map list, so only the TargetsHealthy condition is owned by the
+	// field manager and other conditions are left untouched.
+	for _, cond := range status.Conditions {
+		if cond.Type == monitoringv1.TargetsHealthy {
+			applyStatus["conditions"] = []monitoringv1.MonitoringCondition{cond}
+		}
+	}
+	applyMeta := map[string]interface{}{"name": object.GetName()}
+	if ns := object.GetNamespace(); ns != "" {
+		applyMeta["namespace"] = ns
+	}
+	applyObject := map[string]interface{}{
+		"apiVersion": gvk.GroupVersion().String(),
+		"kind":       gvk.Kind,
+		"metadata":   applyMeta,
+		"status":     applyStatus,
 	}
-	patchObject := map[string]interface{}{"status": patchStatus}
 
-	patchBytes, err := json.Marshal(patchObject)
+	applyBytes, err := json.Marshal(applyObject)
 	if err != nil {
 		return fmt.Errorf("unable to marshall status: %w", err)
 	}
-	patch := client.RawPatch(types.MergePatchType, patchBytes)
-	if err := kubeClient.Status().Patch(ctx, object, patch); err != nil {
-		return fmt.Errorf("unable to patch status: %w", err)
+	patch := client.RawPatch(types.ApplyPatchType, applyBytes)
+	// The operator is the sole owner of the target status fields. Force the apply so
+	// that ownership is taken over from earlier non-apply writes of the same fields.
+	opts := &client.SubResourcePatchOptions{
+		PatchOptions: client.PatchOptions{
+			FieldManager: fieldManagerTargetStatus,
+			Force:        pointer.Bool(true),
+		},
+	}
+	if err := kubeClient.Status().Patch(ctx, object, patch, opts); err != nil {
+		return fmt.Errorf("unable to apply status: %w", err)
 	}
 	return nil
 }
 
 // updateTargetStatus populates the status object of each pod using the given
-// Prometheus targets.
-func updateTargetStatus(ctx context.Context, logger logr.Logger, kubeClient client.Client, targets []*prometheusv1.TargetsResult) error {
-	endpointMap, err := buildEndpointStatuses(targets)
+// Prometheus targets. The collector states in states are added to the endpoint statuses,
+// a nil entry represents a collector whose state is unknown. If the reconciler has health
+// events, Events are emitted for endpoints whose health changed. If it has health metrics,
+// the target counts of all endpoints are exposed through them. If it has a status queue,
+// the target statuses of monitoring resources are written through it instead of right
+// away. If config is not nil, the target status settings are taken from it and the
+// endpoint statuses of kubelet scraping are written into its OperatorConfigTargetStatus.
+// If the reconciler also fetches collector states, the ClockSkewed condition of the
+// OperatorConfig is set from the clock skews the collectors report.
+func (r *targetStatusReconciler) updateTargetStatus(ctx context.Context, targets []*prometheusv1.TargetsResult, states []*collectorState, config *monitoringv1.OperatorConfig) error {
+	spec := &monitoringv1.TargetStatusSpec{}
+	if config != nil {
+		spec = &config.Features.TargetStatus
+	}
+	endpointMap, err := BuildEndpointStatuses(targets, spec)
 	if err != nil {
 		return err
 	}
+	addDiscoveryStatuses(endpointMap, states, metav1.Now())
+	addSampleCounts(endpointMap, states)
+	addRejectedSamples(endpointMap, states)
+	addFailedCollectors(endpointMap, states)
+	if r.healthMetrics != nil {
+		r.healthMetrics.update(endpointMap)
+	}
+	if r.healthEvents != nil {
+		allCollectors := true
+		for _, target := range targets {
+			// nil represents being unable to reach a collector.
+			if target == nil {
+				allCollectors = false
+			}
+		}
+		r.healthEvents.observe(ctx, r.logger, r.kubeClient, endpointMap, allCollectors)
+	}
 
-	var patchErr error
+	refresh := targetStatusRefreshInterval(spec)
+
+	var (
+		patchErr        error
+		kubeletStatuses []monitoringv1.ScrapeEndpointStatus
+	)
 	for job, endpointStatuses := range endpointMap {
-		// Kubelet scraping is configured through hard-coding and not through
-		// a PodMonitoring. As there's no status to update, we skip.
+		// Kubelet scraping is configured through the OperatorConfig and not through
+		// a PodMonitoring. Its status is written separately below.
 		if strings.HasPrefix(job, "kubelet") {
+			kubeletStatuses = append(kubeletStatuses, endpointStatuses...)
 			continue
 		}
-		podMonitoringStatusContainer, err := buildPodMonitoring(job)
-		if err != nil {
-			return fmt.Errorf("building podmonitoring: %s: %w", job, err)
+		if r.statusQueue != nil {
+			r.statusQueue.add(job, &targetStatusWrite{
+				endpointStatuses: endpointStatuses,
+				statusObjects:    spec.StatusObjects,
+				refresh:          refresh,
+			})
+			continue
 		}
-		podMonitoringStatusContainer.GetStatus().EndpointStatuses = endpointStatuses
-
-		if err := patchPodMonitoringStatus(ctx, kubeClient, podMonitoringStatusContainer, *podMonitoringStatusContainer.GetStatus()); err != nil {
+		err := writeTargetStatus(ctx, r.kubeClient, job, endpointStatuses, spec.StatusObjects, refresh)
+		if apierrors.IsNotFound(err) {
+			// The resource was deleted since its targets were fetched.
+			continue
+		}
+		if err != nil {
 			// Save and log any error encountered while patching the status.
 			// We don't want to prematurely return if the error was transient
 			// as we should continue patching all statuses before exiting.
 			patchErr = err
-			logger.Error(err, "patching podmonitoring status", "job", job)
+			r.logger.Error(err, "patching podmonitoring status", "job", job)
+		}
+	}
+	if config != nil {
+		if err := writeKubeletTargetStatus(ctx, r.kubeClient, config, kubeletStatuses, refresh); err != nil {
+			patchErr = err
+			r.logger.Error(err, "writing kubelet target status")
+		}
+	}
+	// The clock skew is read along with the collector state.
+	if config != nil && r.getState != nil {
+		if err := writeClockSkewCondition(ctx, r.kubeClient, config, states); err != nil {
+			patchErr = err
+			r.logger.Error(err, "writing clock skew condition")
 		}
 	}
 
 	return patchErr
 }
 
+// writeTargetStatus writes the endpoint statuses of the monitoring resource of the job,
+// either into a target status object or into the status of the resource itself.
+func writeTargetStatus(ctx context.Context, kubeClient client.Client, job string, endpointStatuses []monitoringv1.ScrapeEndpointStatus, statusObjects bool, refresh time.Duration) error {
+	pm, err := buildPodMonitoring(job)
+	if err != nil {
+		return fmt.Errorf("building podmonitoring: %s: %w", job, err)
+	}
+	if statusObjects {
+		return writeTargetStatusObject(ctx, kubeClient, pm, endpointStatuses, refresh)
+	}
+	return writeTargetStatusInline(ctx, kubeClient, pm, endpointStatuses, refresh)
+}
+
+// writeKubeletTargetStatus writes the endpoint statuses of kubelet scraping into the
+// OperatorConfigTargetStatus of the OperatorConfig. The object is deleted once kubelet
+// scraping is disabled. While it is enabled, the object is kept even if no kubelet
+// targets were found, e.g. because no collector could be reached.
+func writeKubeletTargetStatus(ctx context.Context, kubeClient client.Client, config *monitoringv1.OperatorConfig, endpointStatuses []monitoringv1.ScrapeEndpointStatus, refresh time.Duration) error {
+	sort.Slice(endpointStatuses, func(i, j int) bool {
+		return endpointStatuses[i].Name < endpointStatuses[j].Name
+	})
+	obj := &monitoringv1.OperatorConfigTargetStatus{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: config.Namespace,
+			Name:      config.Name,
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: monitoringv1.SchemeGroupVersion.String(),
+				Kind:       "OperatorConfig",
+				Name:       config.Name,
+				UID:        config.UID,
+			}},
+		},
+		EndpointStatuses: endpointStatuses,
+	}
+	current, err := getTargetStatusObject(ctx, kubeClient, obj)
+	mergeHealthHistory(current, endpointStatuses)
+	switch {
+	case apierrors.IsNotFound(err):
+		if len(endpointStatuses) == 0 {
+			return nil
+		}
+		if err := kubeClient.Create(ctx, obj); err != nil {
+			return fmt.Errorf("create kubelet target status: %w", err)
+		}
+	case err != nil:
+		return fmt.Errorf("get kubelet target status: %w", err)
+	case config.Collection.KubeletScraping == nil:
+		if err := kubeClient.Delete(ctx, obj); client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("delete kubelet target status: %w", err)
+		}
+	case len(endpointStatuses) == 0:
+		return nil
+	case endpointStatusesChanged(current, endpointStatuses, refresh, time.Now()):
+		if err := kubeClient.Patch(ctx, obj, client.Merge); err != nil {
+			return fmt.Errorf("patch kubelet target status: %w", err)
+		}
+	}
+	return nil
+}
+
+// writeTargetStatusInline writes the endpoint statuses into the status of the PodMonitoring
+// or ClusterPodMonitoring. The write is skipped if the status did not change and was last
+// written within the refresh interval.
+func writeTargetStatusInline(ctx context.Context, kubeClient client.Client, pm monitoringv1.PodMonitoringStatusContainer, endpointStatuses []monitoringv1.ScrapeEndpointStatus, refresh time.Duration) error {
+	// Fetch the current status to compare against it and to keep the transition time
+	// of the TargetsHealthy condition.
+	if err := kubeClient.Get(ctx, client.ObjectKeyFromObject(pm), pm); err != nil {
+		return err
+	}
+	if targetStatusDisabled(pm) {
+		return clearTargetStatus(ctx, kubeClient, pm)
+	}
+	status := pm.GetStatus()
+	now := metav1.Now()
+	mergeHealthHistory(status.EndpointStatuses, endpointStatuses)
+	condChanged := setTargetsHealthyCondition(status, endpointStatuses, now)
+	summaryChanged := setTargetsSummary(status, endpointStatuses)
+	if !condChanged && !summaryChanged && status.TargetStatusRef == nil && !endpointStatusesChanged(status.EndpointStatuses, endpointStatuses, refresh, now.Time) {
+		return nil
+	}
+	status.EndpointStatuses = endpointStatuses
+	status.TargetStatusRef = nil
+
+	return applyPodMonitoringStatus(ctx, kubeClient, pm, *status)
+}
+
+// writeTargetStatusObject writes the endpoint statuses into the dedicated target status
+// object of the PodMonitoring or ClusterPodMonitoring and references it from their status.
+// The target status object is only written if the endpoint statuses changed or were last
+// written before the refresh interval. The status of the monitoring resource itself is only
+// patched if the reference is missing, it still holds inline endpoint statuses, or the
+// TargetsHealthy condition or the summary changed.
+func writeTargetStatusObject(ctx context.Context, kubeClient client.Client, pm monitoringv1.PodMonitoringStatusContainer, endpointStatuses []monitoringv1.ScrapeEndpointStatus, refresh time.Duration) error {
+	if err := kubeClient.Get(ctx, client.ObjectKeyFromObject(pm), pm); err != nil {
+		return err
+	}
+	if targetStatusDisabled(pm) {
+		return clearTargetStatus(ctx, kubeClient, pm)
+	}
+	obj, err := buildTargetStatusObject(pm, endpointStatuses)
+	if err != nil {
+		return err
+	}
+	now := metav1.Now()
+
+	current, err := getTargetStatusObject(ctx, kubeClient, obj)
+	mergeHealthHistory(current, endpointStatuses)
+	switch {
+	case apierrors.IsNotFound(err):
+		if err := kubeClient.Create(ctx, obj); err != nil {
+			return fmt.Errorf("create target status: %w", err)
+		}
+	case err != nil:
+		return fmt.Errorf("get target status: %w", err)
+	case endpointStatusesChanged(current, endpointStatuses, refresh, now.Time):
+		// Custom resources do not support unconditional updates, patch the full object instead.
+		if err := kubeClient.Patch(ctx, obj, client.Merge); err != nil {
+			return fmt.Errorf("patch target status: %w", err)
+		}
+	}
+
+	status := pm.GetStatus()
+	condChanged := setTargetsHealthyCondition(status, endpointStatuses, now)
+	summaryChanged := setTargetsSummary(status, endpointStatuses)
+	if !condChanged && !summaryChanged && status.TargetStatusRef != nil && status.TargetStatusRef.Name == obj.GetName() && len(status.EndpointStatuses) == 0 {
+		return nil
+	}
+	status.EndpointStatuses = nil
+	status.TargetStatusRef = &corev1.LocalObjectReference{Name: obj.GetName()}
+	return applyPodMonitoringStatus(ctx, kubeClient, pm, *status)
+}
+
+// targetStatusDisabled returns true if target status updates are disabled for the
+// resource through its annotation.
+func targetStatusDisabled(pm monitoringv1.PodMonitoringStatusContainer) bool {
+	return pm.GetAnnotations()[AnnotationStatus] == "disabled"
+}
+
+// clearTargetStatus removes the target status fields from the status of the resource.
+// Once cleared, the status is not written again.
+func clearTargetStatus(ctx context.Context, kubeClient client.Client, pm monitoringv1.PodMonitoringStatusContainer) error {
+	status := pm.GetStatus()
+
+	var (
+		conds   []monitoringv1.MonitoringCondition
+		hadCond bool
+	)
+	for _, cond := range status.Conditions {
+		if cond.Type == monitoringv1.TargetsHealthy {
+			hadCond = true
+			continue
+		}
+		conds = append(conds, cond)
+	}
+	if !hadCond && len(status.EndpointStatuses) == 0 && status.TargetStatusRef == nil && status.Summary == nil {
+		return nil
+	}
+	status.Conditions = conds
+	status.EndpointStatuses = nil
+	status.TargetStatusRef = nil
+	status.Summary = nil
+	return applyPodMonitoringStatus(ctx, kubeClient, pm, *status)
+}
+
+// getTargetStatusObject returns the endpoint statuses of the existing target status
+// object with the name and namespace of obj.
+func getTargetStatusObject(ctx context.Context, kubeClient client.Client, obj client.Object) ([]monitoringv1.ScrapeEndpointStatus, error) {
+	switch o := obj.DeepCopyObject().(type) {
+	case *monitoringv1.PodMonitoringTargetStatus:
+		err := kubeClient.Get(ctx, client.ObjectKeyFromObject(obj), o)
+		return o.EndpointStatuses, err
+	case *monitoringv1.ClusterPodMonitoringTargetStatus:
+		err := kubeClient.Get(ctx, client.ObjectKeyFromObject(obj), o)
+		return o.EndpointStatuses, err
+	case *monitoringv1.OperatorConfigTargetStatus:
+		err := kubeClient.Get(ctx, client.ObjectKeyFromObject(obj), o)
+		return o.EndpointStatuses, err
+	}
+	return nil, fmt.Errorf("unexpected target status type %T", obj)
+}
+
+// endpointStatusesChanged returns true if the new endpoint statuses differ from the old
+// ones, ignoring their last update time and sample counts, or if the old ones were last updated longer than
+// the refresh interval ago.
+func endpointStatusesChanged(old, new []monitoringv1.ScrapeEndpointStatus, refresh time.Duration, now time.Time) bool {
+	if len(old) != len(new) {
+		return true
+	}
+	for _, status := range old {
+		if now.Sub(status.LastUpdateTime.Time) >= refresh {
+			return true
+		}
+	}
+	return endpointStatusesDigest(old) != endpointStatusesDigest(new)
+}
+
+// endpointStatusesDigest returns a digest of the endpoint statuses ignoring their last
+// update time and all fields that change with every scrape or discovery, such as sample
+// counts and the last scrape time and duration of sample targets. These are only
+// refreshed along with the last update time.
+func endpointStatusesDigest(endpointStatuses []monitoringv1.ScrapeEndpointStatus) string {
+	h := sha256.New()
+	enc := json.NewEncoder(h)
+	for _, status := range endpointStatuses {
+		status.LastUpdateTime = metav1.Time{}
+		status.SamplesScraped = nil
+		status.SamplesPostMetricRelabeling = nil
+		status.RejectedSamples = nil
+		status.DiscoveredTargets = nil
+
+		// Copy the sample groups to not modify the targets of the caller.
+		groups := make([]monitoringv1.SampleGroup, 0, len(status.SampleGroups))
+		for _, group := range status.SampleGroups {
+			targets := make([]monitoringv1.SampleTarget, 0, len(group.SampleTargets))
+			for _, target := range group.SampleTargets {
+				target.LastScrapeTime = nil
+				target.LastScrapeDurationSeconds = ""
+				targets = append(targets, target)
+			}
+			group.SampleTargets = targets
+			groups = append(groups, group)
+		}
+		status.SampleGroups = groups
+
+		// Encoding the API types cannot fail.
+		_ = enc.Encode(status)
+	}
+	return string(h.Sum(nil))
+}
+
+// Reasons of the TargetsHealthy condition.
+const (
+	reasonAllTargetsHealthy     = "AllTargetsHealthy"
+	reasonCollectorsUnreachable = "CollectorsUnreachable"
+	reasonDiscoveryFailed       = "DiscoveryFailed"
+)
+
+// targetsHealthyCondition returns the TargetsHealthy condition for the endpoint statuses
+// of a monitoring resource.
+func targetsHealthyCondition(endpointStatuses []monitoringv1.ScrapeEndpointStatus) monitoringv1.MonitoringCondition {
+	var (
+		active, unhealthy  int64
+		unhealthyEndpoints []string
+		failedEndpoints    []string
+		allCollectors      = true
+	)
+	for _, status := range endpointStatuses {
+		active += status.ActiveTargets
+		unhealthy += status.UnhealthyTargets
+		if status.UnhealthyTargets > 0 {
+			unhealthyEndpoints = append(unhealthyEndpoints, endpointName(status.Name))
+		}
+		if len(status.DiscoveryErrors) > 0 {
+			failedEndpoints = append(failedEndpoints, endpointName(status.Name))
+		}
+		if status.CollectorsFraction != "1" {
+			allCollectors = false
+		}
+	}
+	sort.Strings(unhealthyEndpoints)
+	sort.Strings(failedEndpoints)
+
+	cond := monitoringv1.MonitoringCondition{Type: monitoringv1.TargetsHealthy}
+	switch {
+	case len(failedEndpoints) > 0:
+		cond.Status = corev1.ConditionFalse
+		cond.Reason = reasonDiscoveryFailed
+		cond.Message = fmt.Sprintf("Service discovery failed for endpoints: %s", strings.Join(failedEndpoints, ", "))
+	case unhealthy > 0:
+		cond.Status = corev1.ConditionFalse
+		cond.Reason = reasonTargetsUnhealthy
+		cond.Message = fmt.Sprintf("%d of %d targets are unhealthy in endpoints: %s", unhealthy, active, strings.Join(unhealthyEndpoints, ", "))
+	case !allCollectors:
+		cond.Status = corev1.ConditionUnknown
+		cond.Reason = reasonCollectorsUnreachable
+		cond.Message = "The targets of some collectors could not be fetched"
+	default:
+		cond.Status = corev1.ConditionTrue
+		cond.Reason = reasonAllTargetsHealthy
+		cond.Message = fmt.Sprintf("All %d targets are healthy", active)
+	}
+	return cond
+}
+
+// setTargetsHealthyCondition sets the TargetsHealthy condition in the status based on the
+// endpoint statuses. It returns true if the status, reason or message of the condition changed.
+func setTargetsHealthyCondition(status *monitoringv1.PodMonitoringStatus, endpointStatuses []monitoringv1.ScrapeEndpointStatus, now metav1.Time) bool {
+	return setCondition(&status.Conditions, targetsHealthyCondition(endpointStatuses), now)
+}
+
+// setCondition replaces the condition of the same type in the conditions or adds it. It
+// returns true if the status, reason or message of the condition changed.
+func setCondition(conditions *[]monitoringv1.MonitoringCondition, cond monitoringv1.MonitoringCondition, now metav1.Time) bool {
+	cond.LastUpdateTime = now
+	cond.LastTransitionTime = now
+
+	for i := range *conditions {
+		old := &(*conditions)[i]
+		if old.Type != cond.Type {
+			continue
+		}
+		if old.Status == cond.Status {
+			cond.LastTransitionTime = old.LastTransitionTime
+		}
+		changed := old.Status != cond.Status || old.Reason != cond.Reason || old.Message != cond.Message
+		*old = cond
+		return changed
+	}
+	*conditions = append(*conditions, cond)
+	return true
+}
+
+// setTargetsSummary sets the summary of the target status from the endpoint statuses and
+// the conditions in the status. It returns true if the summary changed.
+func setTargetsSummary(status *monitoringv1.PodMonitoringStatus, endpointStatuses []monitoringv1.ScrapeEndpointStatus) bool {
+	summary := &monitoringv1.TargetsSummary{}
+	for _, eps := range endpointStatuses {
+		summary.ActiveTargets += eps.ActiveTargets
+		summary.UnhealthyTargets += eps.UnhealthyTargets
+	}
+	severity := func(s corev1.ConditionStatus) int {
+		switch s {
+		case corev1.ConditionFalse:
+			return 2
+		case corev1.ConditionUnknown:
+			return 1
+		}
+		return 0
+	}
+	var worst *monitoringv1.MonitoringCondition
+	for i := range status.Conditions {
+		cond := &status.Conditions[i]
+		if worst == nil || severity(cond.Status) > severity(worst.Status) ||
+			(severity(cond.Status) == severity(worst.Status) && cond.Type == monitoringv1.TargetsHealthy) {
+			worst = cond
+		}
+	}
+	if worst != nil {
+		summary.WorstCondition = worst.Reason
+		if summary.WorstCondition == "" {
+			summary.WorstCondition = string(worst.Type)
+		}
+	}
+	changed := status.Summary == nil || *status.Summary != *summary
+	status.Summary = summary
+	return changed
+}
+
+// buildTargetStatusObject returns the target status object for the given PodMonitoring
+// or ClusterPodMonitoring. The object is owned by the monitoring resource so that it is
+// garbage collected along with it.
+func buildTargetStatusObject(pm monitoringv1.PodMonitoringStatusContainer, endpointStatuses []monitoringv1.ScrapeEndpointStatus) (client.Object, error) {
+	owner := metav1.OwnerReference{
+		APIVersion: monitoringv1.SchemeGroupVersion.String(),
+		Name:       pm.GetName(),
+		UID:        pm.GetUID(),
+	}
+	meta := metav1.ObjectMeta{
+		Namespace: pm.GetNamespace(),
+		Name:      pm.GetName(),
+	}
+	switch pm.(type) {
+	case *monitoringv1.PodMonitoring:
+		owner.Kind = "PodMonitoring"
+		meta.OwnerReferences = []metav1.OwnerReference{owner}
+		return &monitoringv1.PodMonitoringTargetStatus{
+			ObjectMeta:       meta,
+			EndpointStatuses: endpointStatuses,
+		}, nil
+	case *monitoringv1.ClusterPodMonitoring:
+		owner.Kind = "ClusterPodMonitoring"
+		meta.OwnerReferences = []metav1.OwnerReference{owner}
+		return &monitoringv1.ClusterPodMonitoringTargetStatus{
+			ObjectMeta:       meta,
+			EndpointStatuses: endpointStatuses,
+		}, nil
+	}
+	return nil, fmt.Errorf("unexpected monitoring resource type %T", pm)
+}
+
 func getPrometheusPods(ctx context.Context, kubeClient client.Client, opts Options, selector labels.Selector) ([]*corev1.Pod, error) {
 	var podList corev1.PodList
 	if err := kubeClient.List(ctx, &podList, client.InNamespace(opts.OperatorNamespace), client.MatchingLabelsSelector{
@@ -399,24 +1139,88 @@ func getPrometheusPods(ctx context.Context, kubeClient client.Client, opts Optio
 	return podsFiltered, nil
 }
 
-func getTarget(ctx context.Context, logger logr.Logger, port int32, pod *corev1.Pod) (*prometheusv1.TargetsResult, error) {
+// newGetTargetFn returns a getTargetFn that fetches the targets from the collector
+// API, using TLS and authentication as configured in the options.
+func newGetTargetFn(opts Options, caData []byte) (getTargetFn, error) {
+	scheme, rt, err := collectorRoundTripper(opts, caData)
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context, logger logr.Logger, port int32, pod *corev1.Pod) (*prometheusv1.TargetsResult, error) {
+		return getTarget(ctx, scheme, rt, port, pod)
+	}, nil
+}
+
+// collectorRoundTripper returns the URL scheme and round tripper to make requests to
+// the collectors with, using TLS and authentication as configured in the options.
+// Collector certificates are verified against the given certificate authority.
+func collectorRoundTripper(opts Options, caData []byte) (string, http.RoundTripper, error) {
+	scheme := "http"
+	rt := api.DefaultRoundTripper
+
+	if opts.CollectorTLS {
+		scheme = "https"
+		tlsConfig := &tls.Config{
+			ServerName: opts.CollectorTLSServerName,
+			RootCAs:    x509.NewCertPool(),
+		}
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caData) {
+			return "", nil, errors.New("no valid collector certificate authority found")
+		}
+		transport := api.DefaultRoundTripper.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+		rt = transport
+	}
+	if opts.CollectorAuthTokenFile != "" {
+		rt = config.NewAuthorizationCredentialsFileRoundTripper("Bearer", opts.CollectorAuthTokenFile, rt)
+	}
+	return scheme, rt, nil
+}
+
+// targetsResponse is the response envelope of the Prometheus targets API.
+type targetsResponse struct {
+	Status    string                     `json:"status"`
+	Data      prometheusv1.TargetsResult `json:"data"`
+	ErrorType string                     `json:"errorType"`
+	Error     string                     `json:"error"`
+}
+
+// getTarget fetches the active targets of the collector in the pod. Dropped targets
+// are not requested as they are not part of the target status and may make up the
+// majority of the response on collectors with many discovered pods. The response is
+// decoded while it is read to not hold the full payload in memory.
+func getTarget(ctx context.Context, scheme string, rt http.RoundTripper, port int32, pod *corev1.Pod) (*prometheusv1.TargetsResult, error) {
 	if pod.Status.PodIP == "" {
-		return nil, errors.New("pod does not have IP allocated")
+		return nil, errNoPodIP
 	}
-	podURL := fmt.Sprintf("http://%s:%d", pod.Status.PodIP, port)
-	client, err := api.NewClient(api.Config{
-		Address: podURL,
-	})
+	u := url.URL{
+		Scheme:   scheme,
+		Host:     net.JoinHostPort(pod.Status.PodIP, strconv.Itoa(int(port))),
+		Path:     "/api/v1/targets",
+		RawQuery: url.Values{"state": []string{"active"}}.Encode(),
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
 	if err != nil {
-		return nil, fmt.Errorf("unable to create Prometheus client: %w", err)
+		return nil, fmt.Errorf("unable to create request: %w", err)
 	}
-	v1api := prometheusv1.NewAPI(client)
-	targetsResult, err := v1api.Targets(ctx)
+	resp, err := rt.RoundTrip(req)
 	if err != nil {
 		return nil, fmt.Errorf("unable to fetch targets: %w", err)
 	}
+	defer resp.Body.Close()
 
-	return &targetsResult, nil
+	var res targetsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		err = fmt.Errorf("unable to decode targets with status code %d: %w", resp.StatusCode, err)
+		if resp.StatusCode != http.StatusOK {
+			err = &collectorStatusError{statusCode: resp.StatusCode, err: err}
+		}
+		return nil, err
+	}
+	if res.Status != "success" {
+		return nil, fmt.Errorf("unable to fetch targets: %s: %s", res.ErrorType, res.Error)
+	}
+	return &res.Data, nil
 }
 
 type prometheusPod struct {
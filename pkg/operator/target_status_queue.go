@@ -0,0 +1,254 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"golang.org/x/time/rate"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+)
+
+const (
+	// Number of workers writing queued target statuses.
+	targetStatusWriteWorkers = 2
+	// Bounds of the backoff for resources whose target status failed to be written.
+	minTargetStatusBackoff = 5 * time.Second
+	maxTargetStatusBackoff = 5 * time.Minute
+)
+
+// targetStatusWrite is a queued target status write of a monitoring resource.
+type targetStatusWrite struct {
+	endpointStatuses []monitoringv1.ScrapeEndpointStatus
+	statusObjects    bool
+	refresh          time.Duration
+}
+
+// targetStatusQueue writes the target status of monitoring resources in the background.
+// Requests to the API server are rate-limited in total. Resources whose target health
+// changed are written before all others, and resources whose writes failed are backed
+// off individually. Only the latest target status of a resource is kept in the queue,
+// so that no backlog of outdated writes builds up.
+type targetStatusQueue struct {
+	logger     logr.Logger
+	kubeClient client.Client
+
+	mtx  sync.Mutex
+	cond *sync.Cond
+	// Queued writes by job, and the jobs in the order in which they are written.
+	pending        map[string]*targetStatusWrite
+	urgent, normal []string
+	// Target health of each job when it was last queued.
+	health map[string]corev1.ConditionStatus
+	// Time before which no writes are queued for jobs that failed to be written.
+	notBefore map[string]time.Time
+	backoff   workqueue.RateLimiter
+	now       func() time.Time
+}
+
+// newTargetStatusQueue returns a queue that writes through the given client with at most
+// qps requests per second.
+func newTargetStatusQueue(logger logr.Logger, kubeClient client.Client, qps float64) *targetStatusQueue {
+	burst := int(qps)
+	if burst < 1 {
+		burst = 1
+	}
+	q := &targetStatusQueue{
+		logger: logger,
+		kubeClient: &rateLimitedClient{
+			Client:  kubeClient,
+			limiter: rate.NewLimiter(rate.Limit(qps), burst),
+		},
+		pending:   map[string]*targetStatusWrite{},
+		health:    map[string]corev1.ConditionStatus{},
+		notBefore: map[string]time.Time{},
+		backoff:   workqueue.NewItemExponentialFailureRateLimiter(minTargetStatusBackoff, maxTargetStatusBackoff),
+		now:       time.Now,
+	}
+	q.cond = sync.NewCond(&q.mtx)
+	return q
+}
+
+// add queues the target status write of the job. A write that is already queued for the
+// job is replaced.
+func (q *targetStatusQueue) add(job string, w *targetStatusWrite) {
+	health := targetsHealthyCondition(w.endpointStatuses).Status
+
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	if t, ok := q.notBefore[job]; ok && q.now().Before(t) {
+		return
+	}
+	prev, seen := q.health[job]
+	q.health[job] = health
+
+	_, queued := q.pending[job]
+	q.pending[job] = w
+
+	switch {
+	case seen && prev != health:
+		q.urgent = append(q.urgent, job)
+	case !queued:
+		q.normal = append(q.normal, job)
+	default:
+		return
+	}
+	q.cond.Signal()
+}
+
+// next blocks until a write is queued and returns it. It returns false if the
+// context was canceled.
+func (q *targetStatusQueue) next(ctx context.Context) (string, *targetStatusWrite, bool) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	for {
+		if ctx.Err() != nil {
+			return "", nil, false
+		}
+		var job string
+		switch {
+		case len(q.urgent) > 0:
+			job, q.urgent = q.urgent[0], q.urgent[1:]
+		case len(q.normal) > 0:
+			job, q.normal = q.normal[0], q.normal[1:]
+		default:
+			q.cond.Wait()
+			continue
+		}
+		// A job is queued again when its health changed, in which case it was
+		// possibly written already.
+		if w, ok := q.pending[job]; ok {
+			delete(q.pending, job)
+			return job, w, true
+		}
+	}
+}
+
+// done records the result of writing the target status of the job.
+func (q *targetStatusQueue) done(job string, err error) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	switch {
+	case err == nil:
+		q.backoff.Forget(job)
+		delete(q.notBefore, job)
+	case apierrors.IsNotFound(err):
+		// The resource was deleted since its targets were fetched.
+		q.backoff.Forget(job)
+		delete(q.notBefore, job)
+		delete(q.health, job)
+	default:
+		q.notBefore[job] = q.now().Add(q.backoff.When(job))
+	}
+}
+
+// run writes queued target statuses until the context is canceled.
+func (q *targetStatusQueue) run(ctx context.Context) {
+	go func() {
+		<-ctx.Done()
+		q.mtx.Lock()
+		q.cond.Broadcast()
+		q.mtx.Unlock()
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(targetStatusWriteWorkers)
+	for i := 0; i < targetStatusWriteWorkers; i++ {
+		go func() {
+			defer wg.Done()
+			for {
+				job, w, ok := q.next(ctx)
+				if !ok {
+					return
+				}
+				err := writeTargetStatus(ctx, q.kubeClient, job, w.endpointStatuses, w.statusObjects, w.refresh)
+				if err != nil && !apierrors.IsNotFound(err) {
+					q.logger.Error(err, "patching podmonitoring status", "job", job)
+				}
+				q.done(job, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// rateLimitedClient is a client whose writes are rate-limited. Reads are served from
+// the informer cache and are not limited.
+type rateLimitedClient struct {
+	client.Client
+	limiter *rate.Limiter
+}
+
+func (c *rateLimitedClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if err := c.limiter.Wait(ctx); err != nil {
+		return err
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func (c *rateLimitedClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	if err := c.limiter.Wait(ctx); err != nil {
+		return err
+	}
+	return c.Client.Delete(ctx, obj, opts...)
+}
+
+func (c *rateLimitedClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	if err := c.limiter.Wait(ctx); err != nil {
+		return err
+	}
+	return c.Client.Update(ctx, obj, opts...)
+}
+
+func (c *rateLimitedClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if err := c.limiter.Wait(ctx); err != nil {
+		return err
+	}
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+func (c *rateLimitedClient) Status() client.SubResourceWriter {
+	return &rateLimitedStatusWriter{SubResourceWriter: c.Client.Status(), limiter: c.limiter}
+}
+
+type rateLimitedStatusWriter struct {
+	client.SubResourceWriter
+	limiter *rate.Limiter
+}
+
+func (w *rateLimitedStatusWriter) Update(ctx context.Context, obj client.Object, opts ...client.SubResourceUpdateOption) error {
+	if err := w.limiter.Wait(ctx); err != nil {
+		return err
+	}
+	return w.SubResourceWriter.Update(ctx, obj, opts...)
+}
+
+func (w *rateLimitedStatusWriter) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+	if err := w.limiter.Wait(ctx); err != nil {
+		return err
+	}
+	return w.SubResourceWriter.Patch(ctx, obj, patch, opts...)
+}
@@ -0,0 +1,140 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/google/go-cmp/cmp"
+	prometheusv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	monitoringv1 "github.com/GoogleCloudPlatform/prometheus-engine/pkg/operator/apis/monitoring/v1"
+)
+
+func TestTargetStatusQueue_Order(t *testing.T) {
+	q := newTargetStatusQueue(testr.New(t), nil, 10)
+	now := time.Date(2022, time.January, 4, 0, 0, 0, 0, time.UTC)
+	q.now = func() time.Time { return now }
+
+	write := func(unhealthy int64) *targetStatusWrite {
+		return &targetStatusWrite{
+			endpointStatuses: []monitoringv1.ScrapeEndpointStatus{{
+				Name:               "metrics",
+				ActiveTargets:      1,
+				UnhealthyTargets:   unhealthy,
+				CollectorsFraction: "1",
+			}},
+		}
+	}
+	drain := func() []string {
+		t.Helper()
+		var jobs []string
+		for len(q.pending) > 0 {
+			job, _, ok := q.next(context.Background())
+			if !ok {
+				t.Fatal("unexpected end of queue")
+			}
+			jobs = append(jobs, job)
+		}
+		// Drop jobs that were queued again and written already.
+		q.urgent, q.normal = nil, nil
+		return jobs
+	}
+
+	// Writes of a job are coalesced.
+	q.add("a", write(0))
+	q.add("b", write(0))
+	q.add("a", write(0))
+	if diff := cmp.Diff([]string{"a", "b"}, drain()); diff != "" {
+		t.Errorf("unexpected order (-want, +got): %s", diff)
+	}
+
+	// Jobs whose health changed are written first.
+	q.add("a", write(0))
+	q.add("b", write(1))
+	if diff := cmp.Diff([]string{"b", "a"}, drain()); diff != "" {
+		t.Errorf("unexpected order (-want, +got): %s", diff)
+	}
+
+	// Jobs that failed to be written are backed off.
+	q.done("a", errors.New("error"))
+	q.add("a", write(0))
+	q.add("b", write(1))
+	if diff := cmp.Diff([]string{"b"}, drain()); diff != "" {
+		t.Errorf("unexpected order (-want, +got): %s", diff)
+	}
+	now = now.Add(maxTargetStatusBackoff)
+	q.add("a", write(0))
+	if diff := cmp.Diff([]string{"a"}, drain()); diff != "" {
+		t.Errorf("unexpected order (-want, +got): %s", diff)
+	}
+}
+
+func TestUpdateTargetStatus_Queue(t *testing.T) {
+	pm := &monitoringv1.PodMonitoring{
+		ObjectMeta: metav1.ObjectMeta{Name: "prom-example-1", Namespace: "gmp-test"},
+	}
+	scheme, err := NewScheme()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(pm).Build()
+	q := newTargetStatusQueue(testr.New(t), kubeClient, 100)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		q.run(ctx)
+		close(done)
+	}()
+
+	targets := []*prometheusv1.TargetsResult{{
+		Active: []prometheusv1.ActiveTarget{{
+			ScrapePool: "PodMonitoring/gmp-test/prom-example-1/metrics",
+			Health:     prometheusv1.HealthGood,
+		}, {
+			// The resource does not exist.
+			ScrapePool: "PodMonitoring/gmp-test/prom-example-2/metrics",
+			Health:     prometheusv1.HealthGood,
+		}},
+	}}
+	if err := (&targetStatusReconciler{logger: testr.New(t), kubeClient: kubeClient, statusQueue: q}).updateTargetStatus(ctx, targets, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var got monitoringv1.PodMonitoring
+	for deadline := time.Now().Add(10 * time.Second); ; {
+		if err := kubeClient.Get(ctx, client.ObjectKeyFromObject(pm), &got); err != nil {
+			t.Fatal(err)
+		}
+		if len(got.Status.EndpointStatuses) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("target status was not written")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	<-done
+}
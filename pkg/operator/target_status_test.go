@@ -16,10 +16,18 @@ package operator
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -32,10 +40,12 @@ import (
 	"github.com/prometheus/common/model"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/utils/clock"
 	tclock "k8s.io/utils/clock/testing"
 	"k8s.io/utils/pointer"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -49,6 +59,7 @@ type updateTargetStatusTestCase struct {
 	targets               []*prometheusv1.TargetsResult
 	podMonitorings        []monitoringv1.PodMonitoring
 	clusterPodMonitorings []monitoringv1.ClusterPodMonitoring
+	targetStatus          monitoringv1.TargetStatusSpec
 	expErr                bool
 }
 
@@ -60,9 +71,10 @@ func expand(testCases []updateTargetStatusTestCase) []updateTargetStatusTestCase
 	for _, tc := range testCases {
 		if len(tc.podMonitorings) == 0 {
 			dataFinal = append(dataFinal, updateTargetStatusTestCase{
-				desc:    tc.desc,
-				targets: tc.targets,
-				expErr:  tc.expErr,
+				desc:         tc.desc,
+				targets:      tc.targets,
+				targetStatus: tc.targetStatus,
+				expErr:       tc.expErr,
 			})
 			continue
 		}
@@ -107,6 +119,7 @@ func expand(testCases []updateTargetStatusTestCase) []updateTargetStatusTestCase
 			desc:           tc.desc + "-pod-monitoring",
 			targets:        tc.targets,
 			podMonitorings: tc.podMonitorings,
+			targetStatus:   tc.targetStatus,
 			expErr:         tc.expErr,
 		}
 		dataFinal = append(dataFinal, dataPodMonitorings)
@@ -114,6 +127,7 @@ func expand(testCases []updateTargetStatusTestCase) []updateTargetStatusTestCase
 			desc:                  tc.desc + "-cluster-pod-monitoring",
 			targets:               clusterTargets,
 			clusterPodMonitorings: clusterPodMonitorings,
+			targetStatus:          tc.targetStatus,
 			expErr:                tc.expErr,
 		}
 		prometheusTargetsBoth := append(tc.targets, clusterTargets...)
@@ -122,6 +136,7 @@ func expand(testCases []updateTargetStatusTestCase) []updateTargetStatusTestCase
 			targets:               prometheusTargetsBoth,
 			podMonitorings:        tc.podMonitorings,
 			clusterPodMonitorings: clusterPodMonitorings,
+			targetStatus:          tc.targetStatus,
 			expErr:                tc.expErr,
 		}
 		dataFinal = append(dataFinal, dataClusterPodMonitorings)
@@ -238,6 +253,65 @@ func TestUpdateTargetStatus(t *testing.T) {
 					},
 				}},
 		},
+		// Single healthy target with scrape time, interval and timeout.
+		{
+			desc: "single-healthy-target-scrape-schedule",
+			targets: []*prometheusv1.TargetsResult{
+				{
+					Active: []prometheusv1.ActiveTarget{{
+						Health:     "up",
+						LastError:  "",
+						ScrapePool: "PodMonitoring/gmp-test/prom-example-1/metrics",
+						DiscoveredLabels: map[string]string{
+							"__scrape_interval__": "30s",
+							"__scrape_timeout__":  "10s",
+						},
+						Labels: model.LabelSet(map[model.LabelName]model.LabelValue{
+							"instance": "a",
+						}),
+						LastScrape:         time.Date(2022, time.January, 3, 23, 59, 45, 0, time.UTC),
+						LastScrapeDuration: 1.2,
+					}},
+				},
+			},
+			podMonitorings: []monitoringv1.PodMonitoring{
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "prom-example-1", Namespace: "gmp-test"},
+					Spec: v1.PodMonitoringSpec{
+						Endpoints: []v1.ScrapeEndpoint{{
+							Port: intstr.FromString("metrics"),
+						}},
+					},
+					Status: monitoringv1.PodMonitoringStatus{
+						EndpointStatuses: []v1.ScrapeEndpointStatus{
+							{
+								Name:             "PodMonitoring/gmp-test/prom-example-1/metrics",
+								ActiveTargets:    1,
+								UnhealthyTargets: 0,
+								LastUpdateTime:   date,
+								SampleGroups: []v1.SampleGroup{
+									{
+										SampleTargets: []v1.SampleTarget{
+											{
+												Health: "up",
+												Labels: map[model.LabelName]model.LabelValue{
+													"instance": "a",
+												},
+												LastScrapeDurationSeconds: "1.2",
+												LastScrapeTime:            &metav1.Time{Time: time.Date(2022, time.January, 3, 23, 59, 45, 0, time.UTC)},
+												ScrapeInterval:            "30s",
+												ScrapeTimeout:             "10s",
+											},
+										},
+										Count: pointer.Int32(1),
+									},
+								},
+								CollectorsFraction: "1",
+							},
+						},
+					},
+				}},
+		},
 		// Collectors target fetch failure.
 		{
 			desc: "collectors-target-fetch-failure",
@@ -1058,6 +1132,98 @@ func TestUpdateTargetStatus(t *testing.T) {
 					},
 				}},
 		},
+		// Multiple targets with custom sample limits.
+		{
+			desc: "multiple-targets-custom-limits",
+			targets: []*prometheusv1.TargetsResult{
+				{
+					Active: []prometheusv1.ActiveTarget{{
+						Health:     "up",
+						ScrapePool: "PodMonitoring/gmp-test/prom-example-1/metrics",
+						Labels: model.LabelSet(map[model.LabelName]model.LabelValue{
+							"instance": "a",
+						}),
+						LastScrapeDuration: 1.2,
+					}, {
+						Health:     "down",
+						LastError:  "err x",
+						ScrapePool: "PodMonitoring/gmp-test/prom-example-1/metrics",
+						Labels: model.LabelSet(map[model.LabelName]model.LabelValue{
+							"instance": "c",
+						}),
+						LastScrapeDuration: 2.4,
+					}, {
+						Health:     "down",
+						LastError:  "err x",
+						ScrapePool: "PodMonitoring/gmp-test/prom-example-1/metrics",
+						Labels: model.LabelSet(map[model.LabelName]model.LabelValue{
+							"instance": "b",
+						}),
+						LastScrapeDuration: 3.6,
+					}, {
+						Health:     "down",
+						LastError:  "err y",
+						ScrapePool: "PodMonitoring/gmp-test/prom-example-1/metrics",
+						Labels: model.LabelSet(map[model.LabelName]model.LabelValue{
+							"instance": "d",
+						}),
+						LastScrapeDuration: 4.7,
+					}},
+				},
+			},
+			targetStatus: monitoringv1.TargetStatusSpec{
+				MaxSampleTargets: 1,
+				MaxSampleGroups:  2,
+			},
+			podMonitorings: []monitoringv1.PodMonitoring{
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "prom-example-1", Namespace: "gmp-test"},
+					Spec: v1.PodMonitoringSpec{
+						Endpoints: []v1.ScrapeEndpoint{{
+							Port: intstr.FromString("metrics"),
+						}},
+					},
+					Status: monitoringv1.PodMonitoringStatus{
+						EndpointStatuses: []v1.ScrapeEndpointStatus{
+							{
+								Name:             "PodMonitoring/gmp-test/prom-example-1/metrics",
+								ActiveTargets:    4,
+								UnhealthyTargets: 3,
+								LastUpdateTime:   date,
+								SampleGroups: []v1.SampleGroup{
+									{
+										SampleTargets: []v1.SampleTarget{
+											{
+												Health:    "down",
+												LastError: pointer.String("err x"),
+												Labels: map[model.LabelName]model.LabelValue{
+													"instance": "b",
+												},
+												LastScrapeDurationSeconds: "3.6",
+											},
+										},
+										Count: pointer.Int32(2),
+									},
+									{
+										SampleTargets: []v1.SampleTarget{
+											{
+												Health:    "down",
+												LastError: pointer.String("err y"),
+												Labels: map[model.LabelName]model.LabelValue{
+													"instance": "d",
+												},
+												LastScrapeDurationSeconds: "4.7",
+											},
+										},
+										Count: pointer.Int32(1),
+									},
+								},
+								CollectorsFraction: "1",
+							},
+						},
+					},
+				}},
+		},
 		{
 			desc: "kubelet hardcoded scrape configs",
 			targets: []*prometheusv1.TargetsResult{
@@ -1107,7 +1273,7 @@ func TestUpdateTargetStatus(t *testing.T) {
 
 			kubeClient := clientBuilder.Build()
 
-			err := updateTargetStatus(context.Background(), testr.New(t), kubeClient, testCase.targets)
+			err := (&targetStatusReconciler{logger: testr.New(t), kubeClient: kubeClient}).updateTargetStatus(context.Background(), testCase.targets, nil, targetStatusConfig(&testCase.targetStatus))
 			if err != nil && !testCase.expErr {
 				t.Fatalf("unexpected error updating target status: %s", err)
 			}
@@ -1121,6 +1287,8 @@ func TestUpdateTargetStatus(t *testing.T) {
 					t.Fatal("Unable to find PodMonitoring:", podMonitoring.GetKey(), err)
 				}
 				normalizeEndpointStatuses(after.Status.EndpointStatuses, date)
+				// The TargetsHealthy condition is covered by TestTargetsHealthyCondition.
+				removeTargetsHealthSummary(&after.Status)
 				if !cmp.Equal(podMonitoring.Status, after.Status) {
 					t.Errorf("PodMonitoring does not match: %s\n%s", podMonitoring.GetKey(), cmp.Diff(podMonitoring.Status, after.Status))
 				}
@@ -1134,6 +1302,8 @@ func TestUpdateTargetStatus(t *testing.T) {
 					t.Fatal("Unable to find ClusterPodMonitoring:", clusterPodMonitoring.GetKey(), err)
 				}
 				normalizeEndpointStatuses(after.Status.EndpointStatuses, date)
+				// The TargetsHealthy condition is covered by TestTargetsHealthyCondition.
+				removeTargetsHealthSummary(&after.Status)
 				if !cmp.Equal(clusterPodMonitoring.Status, after.Status) {
 					t.Errorf("ClusterPodMonitoring does not match: %s\n%s", clusterPodMonitoring.GetKey(), cmp.Diff(clusterPodMonitoring.Status, after.Status))
 				}
@@ -1142,6 +1312,325 @@ func TestUpdateTargetStatus(t *testing.T) {
 	}
 }
 
+func TestUpdateTargetStatusObjects(t *testing.T) {
+	var date = metav1.Date(2022, time.January, 4, 0, 0, 0, 0, time.UTC)
+
+	scheme, err := NewScheme()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pm := &monitoringv1.PodMonitoring{
+		ObjectMeta: metav1.ObjectMeta{Name: "prom-example-1", Namespace: "gmp-test", UID: "pm-uid"},
+		Status: monitoringv1.PodMonitoringStatus{
+			EndpointStatuses: []monitoringv1.ScrapeEndpointStatus{{
+				Name: "PodMonitoring/gmp-test/prom-example-1/metrics",
+			}},
+		},
+	}
+	cpm := &monitoringv1.ClusterPodMonitoring{
+		ObjectMeta: metav1.ObjectMeta{Name: "prom-example-2", UID: "cpm-uid"},
+	}
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(pm, cpm).Build()
+
+	targets := []*prometheusv1.TargetsResult{{
+		Active: []prometheusv1.ActiveTarget{{
+			Health:     "up",
+			ScrapePool: "PodMonitoring/gmp-test/prom-example-1/metrics",
+			Labels: model.LabelSet{
+				"instance": "a",
+			},
+			LastScrapeDuration: 1,
+		}, {
+			Health:     "up",
+			ScrapePool: "ClusterPodMonitoring/prom-example-2/metrics",
+			Labels: model.LabelSet{
+				"instance": "b",
+			},
+			LastScrapeDuration: 1,
+		}},
+	}}
+	spec := &monitoringv1.TargetStatusSpec{StatusObjects: true}
+	// Writing twice must not fail on existing target status objects.
+	for i := 0; i < 2; i++ {
+		if err := (&targetStatusReconciler{logger: testr.New(t), kubeClient: kubeClient}).updateTargetStatus(context.Background(), targets, nil, targetStatusConfig(spec)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var pmStatus monitoringv1.PodMonitoringTargetStatus
+	if err := kubeClient.Get(context.Background(), client.ObjectKeyFromObject(pm), &pmStatus); err != nil {
+		t.Fatal(err)
+	}
+	normalizeEndpointStatuses(pmStatus.EndpointStatuses, date)
+	wantPM := []monitoringv1.ScrapeEndpointStatus{{
+		Name:           "PodMonitoring/gmp-test/prom-example-1/metrics",
+		ActiveTargets:  1,
+		LastUpdateTime: date,
+		SampleGroups: []monitoringv1.SampleGroup{{
+			SampleTargets: []monitoringv1.SampleTarget{{
+				Health:                    "up",
+				Labels:                    model.LabelSet{"instance": "a"},
+				LastScrapeDurationSeconds: "1",
+			}},
+			Count: pointer.Int32(1),
+		}},
+		CollectorsFraction: "1",
+	}}
+	if diff := cmp.Diff(wantPM, pmStatus.EndpointStatuses); diff != "" {
+		t.Errorf("unexpected PodMonitoringTargetStatus (-want, +got): %s", diff)
+	}
+	if diff := cmp.Diff("pm-uid", string(pmStatus.OwnerReferences[0].UID)); diff != "" {
+		t.Errorf("unexpected owner (-want, +got): %s", diff)
+	}
+
+	var cpmStatus monitoringv1.ClusterPodMonitoringTargetStatus
+	if err := kubeClient.Get(context.Background(), client.ObjectKeyFromObject(cpm), &cpmStatus); err != nil {
+		t.Fatal(err)
+	}
+	if len(cpmStatus.EndpointStatuses) != 1 || cpmStatus.EndpointStatuses[0].Name != "ClusterPodMonitoring/prom-example-2/metrics" {
+		t.Errorf("unexpected ClusterPodMonitoringTargetStatus: %v", cpmStatus.EndpointStatuses)
+	}
+
+	// The monitoring resources only reference the status objects.
+	var gotPM monitoringv1.PodMonitoring
+	if err := kubeClient.Get(context.Background(), client.ObjectKeyFromObject(pm), &gotPM); err != nil {
+		t.Fatal(err)
+	}
+	if len(gotPM.Status.Conditions) != 1 || gotPM.Status.Conditions[0].Type != monitoringv1.TargetsHealthy || gotPM.Status.Conditions[0].Status != corev1.ConditionTrue {
+		t.Errorf("unexpected conditions: %v", gotPM.Status.Conditions)
+	}
+	removeTargetsHealthSummary(&gotPM.Status)
+	wantStatus := monitoringv1.PodMonitoringStatus{
+		TargetStatusRef: &corev1.LocalObjectReference{Name: "prom-example-1"},
+	}
+	if diff := cmp.Diff(wantStatus, gotPM.Status); diff != "" {
+		t.Errorf("unexpected PodMonitoring status (-want, +got): %s", diff)
+	}
+
+	// Disabling status objects reports the status inline again.
+	spec.StatusObjects = false
+	if err := (&targetStatusReconciler{logger: testr.New(t), kubeClient: kubeClient}).updateTargetStatus(context.Background(), targets, nil, targetStatusConfig(spec)); err != nil {
+		t.Fatal(err)
+	}
+	if err := kubeClient.Get(context.Background(), client.ObjectKeyFromObject(pm), &gotPM); err != nil {
+		t.Fatal(err)
+	}
+	if gotPM.Status.TargetStatusRef != nil || len(gotPM.Status.EndpointStatuses) != 1 {
+		t.Errorf("unexpected PodMonitoring status: %v", gotPM.Status)
+	}
+}
+
+// removeTargetsHealthSummary removes the TargetsHealthy condition and the summary, which
+// are derived from the endpoint statuses, from the status.
+func removeTargetsHealthSummary(status *monitoringv1.PodMonitoringStatus) {
+	status.Summary = nil
+	var conds []monitoringv1.MonitoringCondition
+	for _, cond := range status.Conditions {
+		if cond.Type != monitoringv1.TargetsHealthy {
+			conds = append(conds, cond)
+		}
+	}
+	status.Conditions = conds
+}
+
+func TestTargetsHealthyCondition(t *testing.T) {
+	pm := &monitoringv1.PodMonitoring{
+		ObjectMeta: metav1.ObjectMeta{Name: "prom-example-1", Namespace: "gmp-test"},
+		Spec: monitoringv1.PodMonitoringSpec{
+			Endpoints: []monitoringv1.ScrapeEndpoint{{Port: intstr.FromString("metrics")}},
+		},
+	}
+	// The condition set by the collection reconciler must be left untouched.
+	pm.Status.SetPodMonitoringCondition(pm.GetGeneration(), metav1.Now(), &monitoringv1.MonitoringCondition{
+		Type:   monitoringv1.ConfigurationCreateSuccess,
+		Status: corev1.ConditionTrue,
+	})
+	scheme, err := NewScheme()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(pm).Build()
+
+	targets := func(health ...string) []*prometheusv1.TargetsResult {
+		var active []prometheusv1.ActiveTarget
+		for i, h := range health {
+			active = append(active, prometheusv1.ActiveTarget{
+				Health:     prometheusv1.HealthStatus(h),
+				ScrapePool: "PodMonitoring/gmp-test/prom-example-1/metrics",
+				Labels:     model.LabelSet{"instance": model.LabelValue(fmt.Sprint(i))},
+			})
+		}
+		return []*prometheusv1.TargetsResult{{Active: active}}
+	}
+	getCondition := func() monitoringv1.MonitoringCondition {
+		t.Helper()
+		var got monitoringv1.PodMonitoring
+		if err := kubeClient.Get(context.Background(), client.ObjectKeyFromObject(pm), &got); err != nil {
+			t.Fatal(err)
+		}
+		var res *monitoringv1.MonitoringCondition
+		for i, cond := range got.Status.Conditions {
+			switch cond.Type {
+			case monitoringv1.TargetsHealthy:
+				res = &got.Status.Conditions[i]
+			case monitoringv1.ConfigurationCreateSuccess:
+			default:
+				t.Fatalf("unexpected condition %q", cond.Type)
+			}
+		}
+		if len(got.Status.Conditions) != 2 || res == nil {
+			t.Fatalf("unexpected conditions: %v", got.Status.Conditions)
+		}
+		return *res
+	}
+	update := func(targets []*prometheusv1.TargetsResult) {
+		t.Helper()
+		if err := (&targetStatusReconciler{logger: testr.New(t), kubeClient: kubeClient}).updateTargetStatus(context.Background(), targets, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	update(targets("up", "up"))
+	cond := getCondition()
+	if cond.Status != corev1.ConditionTrue || cond.Reason != "AllTargetsHealthy" || cond.Message != "All 2 targets are healthy" {
+		t.Errorf("unexpected condition: %v", cond)
+	}
+	// Keep the transition time while the status does not change.
+	transition := metav1.NewTime(time.Now().Add(-time.Hour).Truncate(time.Second))
+	var got monitoringv1.PodMonitoring
+	if err := kubeClient.Get(context.Background(), client.ObjectKeyFromObject(pm), &got); err != nil {
+		t.Fatal(err)
+	}
+	for i := range got.Status.Conditions {
+		got.Status.Conditions[i].LastTransitionTime = transition
+	}
+	if err := kubeClient.Status().Update(context.Background(), &got); err != nil {
+		t.Fatal(err)
+	}
+	update(targets("up", "up"))
+	if cond := getCondition(); !cond.LastTransitionTime.Equal(&transition) {
+		t.Errorf("expected transition time %v, got %v", transition, cond.LastTransitionTime)
+	}
+
+	update(targets("up", "down"))
+	cond = getCondition()
+	if cond.Status != corev1.ConditionFalse || cond.Reason != "TargetsUnhealthy" || cond.Message != "1 of 2 targets are unhealthy in endpoints: metrics" {
+		t.Errorf("unexpected condition: %v", cond)
+	}
+	if cond.LastTransitionTime.Equal(&transition) {
+		t.Errorf("expected transition time to be updated")
+	}
+
+	// A missing collector response makes the health unknown.
+	update(append(targets("up"), nil))
+	cond = getCondition()
+	if cond.Status != corev1.ConditionUnknown || cond.Reason != "CollectorsUnreachable" {
+		t.Errorf("unexpected condition: %v", cond)
+	}
+}
+
+// recordingStatusClient records the options of status patches.
+type recordingStatusClient struct {
+	client.Client
+	patchTypes []types.PatchType
+	patchOpts  []client.SubResourcePatchOptions
+}
+
+func (c *recordingStatusClient) Status() client.SubResourceWriter {
+	return &recordingStatusWriter{SubResourceWriter: c.Client.Status(), c: c}
+}
+
+type recordingStatusWriter struct {
+	client.SubResourceWriter
+	c *recordingStatusClient
+}
+
+func (w *recordingStatusWriter) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+	var o client.SubResourcePatchOptions
+	o.ApplyOptions(opts)
+	w.c.patchTypes = append(w.c.patchTypes, patch.Type())
+	w.c.patchOpts = append(w.c.patchOpts, o)
+	return w.SubResourceWriter.Patch(ctx, obj, patch, opts...)
+}
+
+func TestApplyPodMonitoringStatus(t *testing.T) {
+	ctx := context.Background()
+	scheme, err := NewScheme()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pm := &monitoringv1.PodMonitoring{
+		ObjectMeta: metav1.ObjectMeta{Name: "prom-example", Namespace: "gmp-test"},
+	}
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(pm).Build()
+	kubeClient := &recordingStatusClient{Client: fakeClient}
+
+	// Keep a stale copy before another writer updates the status concurrently.
+	stale := pm.DeepCopy()
+	if err := kubeClient.Get(ctx, client.ObjectKeyFromObject(pm), stale); err != nil {
+		t.Fatal(err)
+	}
+	conditions := []monitoringv1.MonitoringCondition{{
+		Type:   monitoringv1.ConfigurationCreateSuccess,
+		Status: corev1.ConditionTrue,
+	}}
+	if err := patchCollectionStatus(ctx, kubeClient, pm.DeepCopy(), &monitoringv1.PodMonitoringStatus{
+		ObservedGeneration: 2,
+		Conditions:         conditions,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	kubeClient.patchTypes, kubeClient.patchOpts = nil, nil
+
+	// Writing the endpoint statuses based on the stale object must not conflict.
+	endpointStatuses := []monitoringv1.ScrapeEndpointStatus{{
+		Name:             "PodMonitoring/gmp-test/prom-example/metrics",
+		ActiveTargets:    1,
+		UnhealthyTargets: 0,
+	}}
+	if err := applyPodMonitoringStatus(ctx, kubeClient, stale, monitoringv1.PodMonitoringStatus{
+		EndpointStatuses: endpointStatuses,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]types.PatchType{types.ApplyPatchType}, kubeClient.patchTypes); diff != "" {
+		t.Errorf("unexpected patch types (-want, +got): %s", diff)
+	}
+	for _, o := range kubeClient.patchOpts {
+		if o.FieldManager != fieldManagerTargetStatus {
+			t.Errorf("expected field manager %q but got %q", fieldManagerTargetStatus, o.FieldManager)
+		}
+		if o.Force == nil || !*o.Force {
+			t.Errorf("expected forced apply")
+		}
+	}
+
+	// Fields owned by other writers are preserved.
+	var got monitoringv1.PodMonitoring
+	if err := kubeClient.Get(ctx, client.ObjectKeyFromObject(pm), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := monitoringv1.PodMonitoringStatus{
+		ObservedGeneration: 2,
+		Conditions:         conditions,
+		EndpointStatuses:   endpointStatuses,
+	}
+	if diff := cmp.Diff(want, got.Status); diff != "" {
+		t.Errorf("unexpected status (-want, +got): %s", diff)
+	}
+
+	// Applying an empty status clears the endpoint statuses only.
+	if err := applyPodMonitoringStatus(ctx, kubeClient, stale, monitoringv1.PodMonitoringStatus{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := kubeClient.Get(ctx, client.ObjectKeyFromObject(pm), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Status.EndpointStatuses) != 0 || len(got.Status.Conditions) != 1 {
+		t.Errorf("unexpected status: %v", got.Status)
+	}
+}
+
 func getPodKey(pod *corev1.Pod, port int32) string {
 	return fmt.Sprintf("%s:%d", pod.Status.PodIP, port)
 }
@@ -1149,6 +1638,9 @@ func getPodKey(pod *corev1.Pod, port int32) string {
 func normalizeEndpointStatuses(endpointStatuses []monitoringv1.ScrapeEndpointStatus, time metav1.Time) {
 	for i := range endpointStatuses {
 		endpointStatuses[i].LastUpdateTime = time
+		for j := range endpointStatuses[i].HealthHistory {
+			endpointStatuses[i].HealthHistory[j].Time = time
+		}
 	}
 }
 
@@ -1362,6 +1854,8 @@ func TestPolling(t *testing.T) {
 				},
 			},
 			CollectorsFraction: "1",
+			HealthHistory:      []v1.HealthTransition{{Healthy: false}},
+			FlapCount:          1,
 		},
 	}
 	expectStatus(t, "second tick", statusTick2)
@@ -1395,33 +1889,196 @@ func TestPolling(t *testing.T) {
 				},
 			},
 			CollectorsFraction: "1",
+			HealthHistory:      []v1.HealthTransition{{Healthy: false}, {Healthy: true}},
+			FlapCount:          2,
 		},
 	}
 	expectStatus(t, "third tick", statusTick3)
 }
 
-func TestShouldPoll(t *testing.T) {
+func TestPollInterval(t *testing.T) {
 	scheme, err := NewScheme()
 	if err != nil {
 		t.Fatal("unable to get scheme")
 	}
+	cfgNamespacedName := types.NamespacedName{Name: "config", Namespace: "gmp-public"}
+
 	cases := []struct {
-		desc   string
-		objs   []client.Object
-		should bool
-		expErr bool
+		desc     string
+		interval string
+		missing  bool
+		want     time.Duration
 	}{
 		{
-			desc: "should poll targets - podmonitorings",
-			objs: []client.Object{
-				&monitoringv1.OperatorConfig{
-					ObjectMeta: metav1.ObjectMeta{
-						Name:      "config",
-						Namespace: "gmp-public",
-					},
-					Features: monitoringv1.OperatorFeatures{
-						TargetStatus: monitoringv1.TargetStatusSpec{
-							Enabled: true,
+			desc:    "no operatorconfig",
+			missing: true,
+			want:    minPollDuration,
+		},
+		{
+			desc: "default",
+			want: minPollDuration,
+		},
+		{
+			desc:     "custom",
+			interval: "1m30s",
+			want:     90 * time.Second,
+		},
+		{
+			desc:     "below minimum",
+			interval: "5s",
+			want:     minPollDuration,
+		},
+		{
+			desc:     "invalid",
+			interval: "xyz",
+			want:     minPollDuration,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			clientBuilder := fake.NewClientBuilder().WithScheme(scheme)
+			if !c.missing {
+				clientBuilder.WithObjects(&monitoringv1.OperatorConfig{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      cfgNamespacedName.Name,
+						Namespace: cfgNamespacedName.Namespace,
+					},
+					Features: monitoringv1.OperatorFeatures{
+						TargetStatus: monitoringv1.TargetStatusSpec{
+							Enabled:  true,
+							Interval: c.interval,
+						},
+					},
+				})
+			}
+			got := pollInterval(context.Background(), testr.New(t), cfgNamespacedName, clientBuilder.Build())
+			if got != c.want {
+				t.Errorf("expected interval %s but got %s", c.want, got)
+			}
+		})
+	}
+}
+
+func TestRefreshRequested(t *testing.T) {
+	pm := func(value string) *monitoringv1.PodMonitoring {
+		pm := &monitoringv1.PodMonitoring{
+			ObjectMeta: metav1.ObjectMeta{Name: "prom-example-1", Namespace: "gmp-test"},
+		}
+		if value != "" {
+			pm.Annotations = map[string]string{AnnotationRefreshStatus: value}
+		}
+		return pm
+	}
+	cases := []struct {
+		desc     string
+		old, new string
+		want     bool
+	}{
+		{desc: "unset", want: false},
+		{desc: "set", new: "1", want: true},
+		{desc: "changed", old: "1", new: "2", want: true},
+		{desc: "unchanged", old: "1", new: "1", want: false},
+		{desc: "removed", old: "1", want: false},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			got := refreshRequested().Update(event.UpdateEvent{ObjectOld: pm(c.old), ObjectNew: pm(c.new)})
+			if got != c.want {
+				t.Errorf("expected %t but got %t", c.want, got)
+			}
+		})
+	}
+	if refreshRequested().Create(event.CreateEvent{Object: pm("1")}) {
+		t.Error("unexpected refresh on create")
+	}
+}
+
+func TestReconcile_Refresh(t *testing.T) {
+	scheme, err := NewScheme()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(&monitoringv1.OperatorConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: NameOperatorConfig, Namespace: "gmp-public"},
+	}).Build()
+
+	ch := make(chan event.GenericEvent, 1)
+	clock := tclock.NewFakeClock(time.Now())
+	reconciler := &targetStatusReconciler{
+		ch:         ch,
+		refresh:    make(chan struct{}, 1),
+		opts:       Options{PublicNamespace: "gmp-public"},
+		logger:     testr.New(t),
+		kubeClient: kubeClient,
+		clock:      clock,
+	}
+	// Requests are coalesced until the reconciler picks them up.
+	reconciler.requestRefresh()
+	reconciler.requestRefresh()
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := reconciler.Reconcile(context.Background(), reconcile.Request{})
+		errc <- err
+	}()
+	if err := wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		return len(reconciler.refresh) == 0, nil
+	}); err != nil {
+		t.Fatal("refresh request was not picked up")
+	}
+	// Requests while waiting for the minimum poll duration are served by the same poll.
+	reconciler.requestRefresh()
+
+	select {
+	case e := <-ch:
+		t.Fatalf("unexpected poll %q before the minimum poll duration", e.Object.GetName())
+	case <-time.After(100 * time.Millisecond):
+	}
+	clock.Step(minPollDuration)
+
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("reconcile did not return")
+	}
+	select {
+	case e := <-ch:
+		if e.Object.GetName() != refreshRequestName {
+			t.Errorf("expected refresh request, got %q", e.Object.GetName())
+		}
+	default:
+		t.Fatal("expected poll to be requested")
+	}
+	if len(reconciler.refresh) != 0 {
+		t.Errorf("expected no pending refresh, got %d", len(reconciler.refresh))
+	}
+}
+
+func TestShouldPoll(t *testing.T) {
+	scheme, err := NewScheme()
+	if err != nil {
+		t.Fatal("unable to get scheme")
+	}
+	cases := []struct {
+		desc   string
+		objs   []client.Object
+		should bool
+		expErr bool
+	}{
+		{
+			desc: "should poll targets - podmonitorings",
+			objs: []client.Object{
+				&monitoringv1.OperatorConfig{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "config",
+						Namespace: "gmp-public",
+					},
+					Features: monitoringv1.OperatorFeatures{
+						TargetStatus: monitoringv1.TargetStatusSpec{
+							Enabled: true,
 						},
 					},
 				},
@@ -1625,7 +2282,13 @@ func TestFetchTargets(t *testing.T) {
 
 			kubeClient := kubeClientBuilder.Build()
 
-			targets, err := fetchTargets(ctx, logger, opts, targetFetchFromMap(prometheusTargetMap), kubeClient)
+			targets, _, err := (&targetStatusReconciler{
+				logger:     logger,
+				opts:       opts,
+				getTarget:  targetFetchFromMap(prometheusTargetMap),
+				kubeClient: kubeClient,
+				clock:      clock.RealClock{},
+			}).fetchTargets(ctx, 0)
 			if err != nil {
 				t.Fatal("Unable to fetch targets", err)
 			}
@@ -1660,3 +2323,598 @@ func TestFetchTargets(t *testing.T) {
 		})
 	}
 }
+
+func TestNewGetTargetFn(t *testing.T) {
+	const (
+		token      = "secret-token"
+		serverName = "collector.gmp-system.svc"
+	)
+	// Serve with a certificate issued like the ones provisioned for the collectors.
+	caCert, caKey, err := generateCollectorCA()
+	if err != nil {
+		t.Fatal(err)
+	}
+	crt, key, err := generateCollectorCert(caCert, caKey, serverName, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverCert, err := tls.X509KeyPair(crt, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherCA, _, err := generateCollectorCA()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/targets" {
+			http.NotFound(w, r)
+			return
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer "+token {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		// Only active targets are needed for the target status.
+		if got := r.URL.Query().Get("state"); got != "active" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, `{"status":"error","errorType":"bad_data","error":"unexpected state %q"}`, got)
+			return
+		}
+		fmt.Fprint(w, `{"status":"success","data":{"activeTargets":[{"scrapePool":"a","health":"up"}],"droppedTargets":[]}}`)
+	}))
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{serverCert}}
+	srv.StartTLS()
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, portStr, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pod := &corev1.Pod{Status: corev1.PodStatus{PodIP: host}}
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte(token), 0600); err != nil {
+		t.Fatal(err)
+	}
+	caData := encodeCertPEM(caCert)
+
+	cases := []struct {
+		doc     string
+		opts    Options
+		caData  []byte
+		wantErr bool
+	}{
+		{
+			doc: "tls and token",
+			opts: Options{
+				CollectorTLS:           true,
+				CollectorTLSServerName: serverName,
+				CollectorAuthTokenFile: tokenFile,
+			},
+			caData: caData,
+		},
+		{
+			doc: "wrong server name",
+			opts: Options{
+				CollectorTLS:           true,
+				CollectorTLSServerName: "other.com",
+				CollectorAuthTokenFile: tokenFile,
+			},
+			caData:  caData,
+			wantErr: true,
+		},
+		{
+			doc: "unknown certificate authority",
+			opts: Options{
+				CollectorTLS:           true,
+				CollectorTLSServerName: serverName,
+				CollectorAuthTokenFile: tokenFile,
+			},
+			caData:  encodeCertPEM(otherCA),
+			wantErr: true,
+		},
+		{
+			doc: "missing token",
+			opts: Options{
+				CollectorTLS:           true,
+				CollectorTLSServerName: serverName,
+			},
+			caData:  caData,
+			wantErr: true,
+		},
+		{
+			doc: "plain http",
+			opts: Options{
+				CollectorAuthTokenFile: tokenFile,
+			},
+			wantErr: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.doc, func(t *testing.T) {
+			getTarget, err := newGetTargetFn(c.opts, c.caData)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := getTarget(context.Background(), testr.New(t), int32(port), pod)
+			if c.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(res.Active) != 1 || res.Active[0].ScrapePool != "a" {
+				t.Errorf("unexpected targets %+v", res)
+			}
+		})
+	}
+
+	if _, err := newGetTargetFn(Options{CollectorTLS: true}, []byte("invalid")); err == nil {
+		t.Error("expected error for invalid certificate authority")
+	}
+}
+
+func TestGetTarget_Errors(t *testing.T) {
+	cases := []struct {
+		doc     string
+		status  int
+		body    string
+		wantErr string
+	}{
+		{
+			doc:     "api error",
+			status:  http.StatusUnprocessableEntity,
+			body:    `{"status":"error","errorType":"execution","error":"boom"}`,
+			wantErr: "execution: boom",
+		},
+		{
+			doc:     "non-json response",
+			status:  http.StatusForbidden,
+			body:    "forbidden",
+			wantErr: "status code 403",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.doc, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(c.status)
+				fmt.Fprint(w, c.body)
+			}))
+			defer srv.Close()
+
+			u, err := url.Parse(srv.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			host, portStr, err := net.SplitHostPort(u.Host)
+			if err != nil {
+				t.Fatal(err)
+			}
+			port, err := strconv.Atoi(portStr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pod := &corev1.Pod{Status: corev1.PodStatus{PodIP: host}}
+
+			_, err = getTarget(context.Background(), "http", http.DefaultTransport, int32(port), pod)
+			if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+				t.Errorf("expected error containing %q, got %v", c.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestUpdateTargetStatus_SkipUnchanged(t *testing.T) {
+	ctx := context.Background()
+	scheme, err := NewScheme()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pm := &monitoringv1.PodMonitoring{
+		ObjectMeta: metav1.ObjectMeta{Name: "prom-example-1", Namespace: "gmp-test"},
+	}
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(pm).Build()
+	kubeClient := &recordingStatusClient{Client: fakeClient}
+
+	// Each poll observes a later scrape with a different duration, as on a real collector.
+	var (
+		lastScrape = time.Now()
+		polls      int
+	)
+	targets := func(health string) []*prometheusv1.TargetsResult {
+		polls++
+		return []*prometheusv1.TargetsResult{{
+			Active: []prometheusv1.ActiveTarget{{
+				Health:             prometheusv1.HealthStatus(health),
+				ScrapePool:         "PodMonitoring/gmp-test/prom-example-1/metrics",
+				Labels:             model.LabelSet{"instance": "a"},
+				LastScrape:         lastScrape.Add(time.Duration(polls) * 10 * time.Second),
+				LastScrapeDuration: 0.1 * float64(polls),
+			}},
+		}}
+	}
+	spec := &monitoringv1.TargetStatusSpec{}
+	update := func(targets []*prometheusv1.TargetsResult, wantPatches int) {
+		t.Helper()
+		kubeClient.patchTypes = nil
+		if err := (&targetStatusReconciler{logger: testr.New(t), kubeClient: kubeClient}).updateTargetStatus(ctx, targets, nil, targetStatusConfig(spec)); err != nil {
+			t.Fatal(err)
+		}
+		if len(kubeClient.patchTypes) != wantPatches {
+			t.Errorf("expected %d status patches, got %d", wantPatches, len(kubeClient.patchTypes))
+		}
+	}
+
+	update(targets("up"), 1)
+	// Unchanged statuses are not written again.
+	update(targets("up"), 0)
+	update(targets("down"), 1)
+
+	// Statuses older than the refresh interval are rewritten even if unchanged.
+	var got monitoringv1.PodMonitoring
+	if err := kubeClient.Get(ctx, client.ObjectKeyFromObject(pm), &got); err != nil {
+		t.Fatal(err)
+	}
+	got.Status.EndpointStatuses[0].LastUpdateTime = metav1.NewTime(time.Now().Add(-targetStatusRefreshInterval(spec)))
+	if err := kubeClient.Status().Update(ctx, &got); err != nil {
+		t.Fatal(err)
+	}
+	update(targets("down"), 1)
+	update(targets("down"), 0)
+}
+
+func TestSetTargetsSummary(t *testing.T) {
+	endpointStatuses := []monitoringv1.ScrapeEndpointStatus{
+		{Name: "PodMonitoring/gmp-test/prom-example-1/a", ActiveTargets: 3, UnhealthyTargets: 1},
+		{Name: "PodMonitoring/gmp-test/prom-example-1/b", ActiveTargets: 2},
+	}
+	status := &monitoringv1.PodMonitoringStatus{
+		Conditions: []monitoringv1.MonitoringCondition{
+			{Type: monitoringv1.ConfigurationCreateSuccess, Status: corev1.ConditionTrue},
+			{Type: monitoringv1.TargetsHealthy, Status: corev1.ConditionTrue, Reason: "AllTargetsHealthy"},
+		},
+	}
+	if !setTargetsSummary(status, endpointStatuses) {
+		t.Errorf("expected summary to change")
+	}
+	want := &monitoringv1.TargetsSummary{ActiveTargets: 5, UnhealthyTargets: 1, WorstCondition: "AllTargetsHealthy"}
+	if diff := cmp.Diff(want, status.Summary); diff != "" {
+		t.Errorf("unexpected summary (-want, +got): %s", diff)
+	}
+	if setTargetsSummary(status, endpointStatuses) {
+		t.Errorf("expected summary to be unchanged")
+	}
+
+	// A failing condition is the worst, even if it is not about targets.
+	status.Conditions[0].Status = corev1.ConditionFalse
+	status.Conditions[1].Status = corev1.ConditionUnknown
+	status.Conditions[1].Reason = "CollectorsUnreachable"
+	if !setTargetsSummary(status, endpointStatuses) {
+		t.Errorf("expected summary to change")
+	}
+	if got := status.Summary.WorstCondition; got != string(monitoringv1.ConfigurationCreateSuccess) {
+		t.Errorf("unexpected worst condition %q", got)
+	}
+}
+
+func TestEndpointStatusesChanged(t *testing.T) {
+	now := time.Now()
+	status := monitoringv1.ScrapeEndpointStatus{
+		Name:           "PodMonitoring/gmp-test/prom-example-1/metrics",
+		ActiveTargets:  1,
+		LastUpdateTime: metav1.NewTime(now.Add(-time.Minute)),
+		SampleGroups: []monitoringv1.SampleGroup{{
+			SampleTargets: []monitoringv1.SampleTarget{{
+				Health:                    "up",
+				Labels:                    model.LabelSet{"instance": "a"},
+				LastScrapeTime:            &metav1.Time{Time: now.Add(-time.Minute)},
+				LastScrapeDurationSeconds: "0.1",
+			}},
+			Count: pointer.Int32(1),
+		}},
+		CollectorsFraction: "1",
+		DiscoveredTargets:  pointer.Int64(3),
+		SamplesScraped:     pointer.Int64(100),
+		RejectedSamples:    []monitoringv1.RejectedSampleCount{{Reason: "out-of-order", Count: 1}},
+	}
+	// All fields that change with every scrape or discovery differ.
+	updated := *status.DeepCopy()
+	updated.LastUpdateTime = metav1.NewTime(now)
+	updated.SampleGroups[0].SampleTargets[0].LastScrapeTime = &metav1.Time{Time: now}
+	updated.SampleGroups[0].SampleTargets[0].LastScrapeDurationSeconds = "0.25"
+	updated.DiscoveredTargets = pointer.Int64(4)
+	updated.SamplesScraped = pointer.Int64(120)
+	updated.RejectedSamples = []monitoringv1.RejectedSampleCount{{Reason: "out-of-order", Count: 2}}
+
+	if endpointStatusesChanged([]monitoringv1.ScrapeEndpointStatus{status}, []monitoringv1.ScrapeEndpointStatus{updated}, time.Hour, now) {
+		t.Errorf("expected statuses differing in per-scrape fields to be unchanged")
+	}
+	if updated.SampleGroups[0].SampleTargets[0].LastScrapeTime == nil {
+		t.Errorf("expected sample targets of the statuses to be left unmodified")
+	}
+	if !endpointStatusesChanged([]monitoringv1.ScrapeEndpointStatus{status}, []monitoringv1.ScrapeEndpointStatus{updated}, time.Minute, now) {
+		t.Errorf("expected statuses older than the refresh interval to be changed")
+	}
+	updated.SampleGroups[0].SampleTargets[0].Health = "down"
+	if !endpointStatusesChanged([]monitoringv1.ScrapeEndpointStatus{status}, []monitoringv1.ScrapeEndpointStatus{updated}, time.Hour, now) {
+		t.Errorf("expected statuses with different health to be changed")
+	}
+	if !endpointStatusesChanged(nil, []monitoringv1.ScrapeEndpointStatus{updated}, time.Hour, now) {
+		t.Errorf("expected added status to be changed")
+	}
+}
+
+func TestFetchTargets_Spread(t *testing.T) {
+	ctx := context.Background()
+	logger := testr.New(t)
+	opts := Options{
+		ProjectID:             "test-proj",
+		Location:              "test-loc",
+		Cluster:               "test-cluster",
+		TargetPollConcurrency: 4,
+	}
+	if err := opts.defaultAndValidate(logger); err != nil {
+		t.Fatal("Invalid options:", err)
+	}
+	scheme, err := NewScheme()
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := int32(19090)
+	kubeClientBuilder := fake.NewClientBuilder().WithScheme(scheme).WithObjects(&appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      NameCollector,
+			Namespace: opts.OperatorNamespace,
+		},
+		Spec: appsv1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{},
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name: "prometheus",
+						Ports: []corev1.ContainerPort{{
+							Name:          "prom-metrics",
+							ContainerPort: port,
+						}},
+					}},
+				},
+			},
+		},
+	})
+	var pods []*corev1.Pod
+	for i := 0; i < 8; i++ {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("pod-%d", i),
+				Namespace: opts.OperatorNamespace,
+			},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "prometheus"}},
+			},
+			Status: corev1.PodStatus{
+				Phase: corev1.PodRunning,
+				PodIP: fmt.Sprint(i),
+				ContainerStatuses: []corev1.ContainerStatus{{
+					Name:  "prometheus",
+					Ready: true,
+				}},
+			},
+		}
+		kubeClientBuilder.WithObjects(pod)
+		pods = append(pods, pod)
+	}
+	kubeClient := kubeClientBuilder.Build()
+
+	const spread = 10 * time.Second
+	fakeClock := tclock.NewFakeClock(time.Now())
+
+	var (
+		mtx     sync.Mutex
+		fetched = map[string]time.Time{}
+	)
+	getTarget := func(_ context.Context, _ logr.Logger, _ int32, pod *corev1.Pod) (*prometheusv1.TargetsResult, error) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		fetched[pod.Name] = fakeClock.Now()
+		return &prometheusv1.TargetsResult{}, nil
+	}
+
+	start := fakeClock.Now()
+	done := make(chan []*prometheusv1.TargetsResult)
+	go func() {
+		targets, _, err := (&targetStatusReconciler{
+			logger:     logger,
+			opts:       opts,
+			getTarget:  getTarget,
+			kubeClient: kubeClient,
+			clock:      fakeClock,
+		}).fetchTargets(ctx, spread)
+		if err != nil {
+			t.Error(err)
+		}
+		done <- targets
+	}()
+
+	// Advance the clock in steps until all pods were fetched.
+	var targets []*prometheusv1.TargetsResult
+	for targets == nil {
+		select {
+		case targets = <-done:
+		case <-time.After(10 * time.Millisecond):
+			if fakeClock.Since(start) > spread {
+				t.Fatal("fetches did not finish within the spread duration")
+			}
+			fakeClock.Step(time.Second)
+		}
+	}
+	if len(targets) != len(pods) {
+		t.Fatalf("expected %d targets, got %d", len(pods), len(targets))
+	}
+
+	offsets := map[time.Duration]bool{}
+	for _, pod := range pods {
+		offset := fetchOffset(pod, spread)
+		offsets[offset] = true
+		at, ok := fetched[pod.Name]
+		if !ok {
+			t.Fatalf("pod %s was not fetched", pod.Name)
+		}
+		if at.Sub(start) < offset {
+			t.Errorf("pod %s fetched after %s, before its offset %s", pod.Name, at.Sub(start), offset)
+		}
+		if offset < 0 || offset >= spread {
+			t.Errorf("offset %s of pod %s not within spread %s", offset, pod.Name, spread)
+		}
+	}
+	if len(offsets) < 2 {
+		t.Errorf("expected fetches to be spread, got offsets %v", offsets)
+	}
+}
+
+func TestUpdateTargetStatus_Disabled(t *testing.T) {
+	ctx := context.Background()
+	scheme, err := NewScheme()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pm := &monitoringv1.PodMonitoring{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "prom-example-1",
+			Namespace:   "gmp-test",
+			Annotations: map[string]string{AnnotationStatus: "disabled"},
+		},
+		Status: monitoringv1.PodMonitoringStatus{
+			EndpointStatuses: []monitoringv1.ScrapeEndpointStatus{{
+				Name:          "PodMonitoring/gmp-test/prom-example-1/metrics",
+				ActiveTargets: 1,
+			}},
+		},
+	}
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(pm).Build()
+	kubeClient := &recordingStatusClient{Client: fakeClient}
+
+	targets := []*prometheusv1.TargetsResult{{
+		Active: []prometheusv1.ActiveTarget{{
+			Health:     "up",
+			ScrapePool: "PodMonitoring/gmp-test/prom-example-1/metrics",
+			Labels:     model.LabelSet{"instance": "a"},
+		}},
+	}}
+	for _, spec := range []*monitoringv1.TargetStatusSpec{{}, {StatusObjects: true}} {
+		// Statuses written before the annotation was set are cleared once.
+		kubeClient.patchTypes = nil
+		for i := 0; i < 2; i++ {
+			if err := (&targetStatusReconciler{logger: testr.New(t), kubeClient: kubeClient}).updateTargetStatus(ctx, targets, nil, targetStatusConfig(spec)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var got monitoringv1.PodMonitoring
+		if err := kubeClient.Get(ctx, client.ObjectKeyFromObject(pm), &got); err != nil {
+			t.Fatal(err)
+		}
+		if len(got.Status.EndpointStatuses) != 0 || got.Status.TargetStatusRef != nil {
+			t.Errorf("expected target status to be cleared, got %v", got.Status)
+		}
+		var obj monitoringv1.PodMonitoringTargetStatus
+		if err := kubeClient.Get(ctx, client.ObjectKeyFromObject(pm), &obj); !apierrors.IsNotFound(err) {
+			t.Errorf("expected no target status object, got error %v", err)
+		}
+		if spec.StatusObjects && len(kubeClient.patchTypes) != 0 {
+			t.Errorf("expected no status patches, got %d", len(kubeClient.patchTypes))
+		}
+		if !spec.StatusObjects && len(kubeClient.patchTypes) != 1 {
+			t.Errorf("expected one status patch, got %d", len(kubeClient.patchTypes))
+		}
+	}
+}
+
+// targetStatusConfig returns an OperatorConfig with the given target status settings.
+func targetStatusConfig(spec *monitoringv1.TargetStatusSpec) *monitoringv1.OperatorConfig {
+	return &monitoringv1.OperatorConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: NameOperatorConfig, Namespace: "gmp-public"},
+		Features:   monitoringv1.OperatorFeatures{TargetStatus: *spec},
+	}
+}
+
+func TestUpdateTargetStatus_Kubelet(t *testing.T) {
+	ctx := context.Background()
+	scheme, err := NewScheme()
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &monitoringv1.OperatorConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: NameOperatorConfig, Namespace: "gmp-public", UID: "config-uid"},
+		Collection: monitoringv1.CollectionSpec{
+			KubeletScraping: &monitoringv1.KubeletScraping{Interval: "30s"},
+		},
+	}
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(config).Build()
+	r := &targetStatusReconciler{logger: testr.New(t), kubeClient: kubeClient}
+
+	kubeletTargets := func(health ...string) []*prometheusv1.TargetsResult {
+		var active []prometheusv1.ActiveTarget
+		for i, h := range health {
+			for _, pool := range []string{"kubelet/metrics", "kubelet/cadvisor"} {
+				active = append(active, prometheusv1.ActiveTarget{
+					Health:     prometheusv1.HealthStatus(h),
+					ScrapePool: pool,
+					Labels:     model.LabelSet{"instance": model.LabelValue(fmt.Sprintf("node-%d", i))},
+				})
+			}
+		}
+		return []*prometheusv1.TargetsResult{{Active: active}}
+	}
+
+	if err := r.updateTargetStatus(ctx, kubeletTargets("up", "down"), nil, config); err != nil {
+		t.Fatal(err)
+	}
+	var got monitoringv1.OperatorConfigTargetStatus
+	if err := kubeClient.Get(ctx, client.ObjectKeyFromObject(config), &got); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, status := range got.EndpointStatuses {
+		names = append(names, status.Name)
+		if status.ActiveTargets != 2 || status.UnhealthyTargets != 1 {
+			t.Errorf("unexpected target counts of %s: %d/%d", status.Name, status.UnhealthyTargets, status.ActiveTargets)
+		}
+	}
+	if diff := cmp.Diff([]string{"kubelet/cadvisor", "kubelet/metrics"}, names); diff != "" {
+		t.Errorf("unexpected endpoints (-want, +got): %s", diff)
+	}
+	if diff := cmp.Diff("config-uid", string(got.OwnerReferences[0].UID)); diff != "" {
+		t.Errorf("unexpected owner (-want, +got): %s", diff)
+	}
+
+	// The status is kept while kubelet scraping is enabled, even if no kubelet targets
+	// were found, e.g. because no collector could be reached.
+	if err := r.updateTargetStatus(ctx, []*prometheusv1.TargetsResult{nil}, nil, config); err != nil {
+		t.Fatal(err)
+	}
+	if err := kubeClient.Get(ctx, client.ObjectKeyFromObject(config), &got); err != nil {
+		t.Errorf("expected kubelet target status to be kept, got error %v", err)
+	}
+
+	// The status is deleted once kubelet scraping is disabled.
+	config.Collection.KubeletScraping = nil
+	if err := r.updateTargetStatus(ctx, []*prometheusv1.TargetsResult{{}}, nil, config); err != nil {
+		t.Fatal(err)
+	}
+	if err := kubeClient.Get(ctx, client.ObjectKeyFromObject(config), &got); !apierrors.IsNotFound(err) {
+		t.Errorf("expected kubelet target status to be deleted, got error %v", err)
+	}
+}
@@ -16,6 +16,7 @@ package rules
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/model/labels"
@@ -31,14 +32,27 @@ import (
 // Prometheus upstream validation logic.
 func FromAPIRules(groups []monitoringv1.RuleGroup) (result rulefmt.RuleGroups, err error) {
 	for _, g := range groups {
-		var rules []rulefmt.RuleNode
+		var (
+			rules       []rulefmt.RuleNode
+			queryOffset model.Duration
+		)
+		if g.QueryOffset != "" {
+			queryOffset, err = model.ParseDuration(g.QueryOffset)
+			if err != nil {
+				return result, fmt.Errorf("parse query offset: %w", err)
+			}
+		}
 
 		for _, r := range g.Rules {
 			rule := rulefmt.RuleNode{
 				Labels:      r.Labels,
 				Annotations: r.Annotations,
 			}
-			rule.Expr.SetString(r.Expr)
+			expr, err := OffsetExpr(r.Expr, time.Duration(queryOffset))
+			if err != nil {
+				return result, err
+			}
+			rule.Expr.SetString(expr)
 			if r.Record != "" {
 				rule.Record.SetString(r.Record)
 			}
@@ -121,6 +135,40 @@ func Scope(groups *rulefmt.RuleGroups, lset map[string]string) error {
 	return nil
 }
 
+// OffsetExpr adds the offset to all selectors and subqueries of the PromQL expression,
+// so that it is evaluated against data from the offset before the evaluation time.
+// Selectors and subqueries that are pinned to a time with the @ modifier are not
+// offset, nor are the selectors within subqueries, which are relative to the subquery.
+func OffsetExpr(expr string, offset time.Duration) (string, error) {
+	if offset == 0 {
+		return expr, nil
+	}
+	e, err := parser.ParseExpr(expr)
+	if err != nil {
+		return "", fmt.Errorf("parse PromQL expression: %w", err)
+	}
+	offsetNode(e, offset)
+	return e.String(), nil
+}
+
+func offsetNode(node parser.Node, offset time.Duration) {
+	switch n := node.(type) {
+	case *parser.VectorSelector:
+		if n.Timestamp == nil && n.StartOrEnd == 0 {
+			n.OriginalOffset += offset
+		}
+		return
+	case *parser.SubqueryExpr:
+		if n.Timestamp == nil && n.StartOrEnd == 0 {
+			n.OriginalOffset += offset
+		}
+		return
+	}
+	for _, c := range parser.Children(node) {
+		offsetNode(c, offset)
+	}
+}
+
 func setLabel(r *rulefmt.RuleNode, name, value string) error {
 	if v, ok := r.Labels[name]; ok {
 		return fmt.Errorf("label %q already set on rule with unexpected value %q", name, v)
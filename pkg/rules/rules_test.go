@@ -16,6 +16,7 @@ package rules
 
 import (
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/prometheus/prometheus/model/rulefmt"
@@ -71,3 +72,38 @@ func TestScope(t *testing.T) {
 		t.Fatalf("unexpected result (-want, +got):\n %s", diff)
 	}
 }
+
+func TestOffsetExpr(t *testing.T) {
+	cases := []struct {
+		expr, want string
+	}{
+		{
+			expr: `sum(rate(my_metric[5m])) / my_metric2 offset 1m`,
+			want: `sum(rate(my_metric[5m] offset 30s)) / my_metric2 offset 1m30s`,
+		},
+		{
+			expr: `max_over_time(rate(my_metric[1m])[10m:1m])`,
+			want: `max_over_time(rate(my_metric[1m])[10m:1m] offset 30s)`,
+		},
+		{
+			expr: `my_metric @ 1000 + my_metric2`,
+			want: `my_metric @ 1000.000 + my_metric2 offset 30s`,
+		},
+		{
+			expr: `vector(1)`,
+			want: `vector(1)`,
+		},
+	}
+	for _, c := range cases {
+		got, err := OffsetExpr(c.expr, 30*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != c.want {
+			t.Errorf("expected %q for %q, got %q", c.want, c.expr, got)
+		}
+	}
+	if _, err := OffsetExpr("sum(", time.Second); err == nil {
+		t.Errorf("expected error for invalid expression")
+	}
+}